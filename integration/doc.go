@@ -0,0 +1,3 @@
+// Package integration holds end-to-end tests that run the relay on loopback
+// UDP sockets and feed it source datagrams from testdata/.
+package integration
@@ -0,0 +1,2766 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/activity"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/auth"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/relay"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/tlspeer"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// harness is a relay running on ephemeral loopback ports with a capturing target
+type harness struct {
+	relay  *relay.Relay
+	target *net.UDPConn
+	source *net.UDPConn
+	cancel context.CancelFunc
+	errc   chan error
+}
+
+// testConfig returns the default configuration bound to loopback ephemeral ports
+func testConfig(targetPort int) *config.Config {
+	cfg := &config.Config{}
+	cfg.Listen.Address = "127.0.0.1"
+	cfg.Listen.Port = 0
+	cfg.Target.Address = "127.0.0.1"
+	cfg.Target.Port = targetPort
+	cfg.Target.Format = "n1mm"
+	cfg.Formatting.AutoDetect = true
+	cfg.Formatting.SourceType = "auto"
+	cfg.Formatting.N1MM.Station = "W1AW"
+	cfg.Formatting.N1MM.Operator = "K1ABC"
+	cfg.Formatting.N1MM.Contest = "GENERAL"
+	cfg.Formatting.Time.OutputUTC = true
+	cfg.Formatting.RST.NormalizeDB = true
+	return cfg
+}
+
+// startHarness starts a relay; modify may adjust the configuration first
+func startHarness(t testing.TB, modify func(*config.Config)) *harness {
+	t.Helper()
+
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open target socket: %v", err)
+	}
+
+	cfg := testConfig(target.LocalAddr().(*net.UDPAddr).Port)
+	if modify != nil {
+		modify(cfg)
+	}
+
+	r, err := relay.New(cfg)
+	if err != nil {
+		target.Close()
+		t.Fatalf("relay.New failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &harness{relay: r, target: target, cancel: cancel, errc: make(chan error, 1)}
+	go func() { h.errc <- r.Run(ctx) }()
+
+	select {
+	case <-r.Ready():
+	case err := <-h.errc:
+		cancel()
+		target.Close()
+		t.Fatalf("relay failed to start: %v", err)
+	case <-time.After(5 * time.Second):
+		cancel()
+		target.Close()
+		t.Fatal("relay did not become ready")
+	}
+
+	h.source, err = net.DialUDP("udp", nil, r.ListenAddr().(*net.UDPAddr))
+	if err != nil {
+		h.stop(t)
+		t.Fatalf("failed to open source socket: %v", err)
+	}
+
+	t.Cleanup(func() { h.stop(t) })
+	return h
+}
+
+// stop shuts the relay down and checks it exited cleanly
+func (h *harness) stop(t testing.TB) {
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	h.cancel = nil
+	if err := <-h.errc; err != nil {
+		t.Errorf("Run returned error: %v", err)
+	}
+	if h.source != nil {
+		h.source.Close()
+	}
+	h.target.Close()
+}
+
+// send injects a raw datagram into the relay
+func (h *harness) send(t testing.TB, payload []byte) {
+	t.Helper()
+	if _, err := h.source.Write(payload); err != nil {
+		t.Fatalf("failed to send datagram: %v", err)
+	}
+}
+
+// receive waits for the next datagram forwarded to the target.
+// ok is false if nothing arrives within timeout.
+func (h *harness) receive(t testing.TB, timeout time.Duration) (string, bool) {
+	t.Helper()
+	buf := make([]byte, 65536)
+	h.target.SetReadDeadline(time.Now().Add(timeout))
+	n, _, err := h.target.ReadFromUDP(buf)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return "", false
+		}
+		t.Fatalf("failed to read from target: %v", err)
+	}
+	return string(buf[:n]), true
+}
+
+// readPacket loads a datagram from testdata
+func readPacket(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return data
+}
+
+func TestCapturedPackets(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{"wsjtx_logged_adif.bin", []string{
+			"<call>K2ABC</call>", "<band>20m</band>", "<mode>FT8</mode>",
+			"<snt>-15</snt>", "<rcv>-08</rcv>", "<timestamp>2024-06-01 14:23:15</timestamp>",
+		}},
+		{"js8call_logged_adif.bin", []string{
+			"<call>VE3XYZ</call>", "<band>40m</band>", "<timestamp>2024-06-01 15:10:00</timestamp>",
+		}},
+		{"varac_adif.txt", []string{
+			"<call>N7AKG</call>", "<band>20m</band>", "<mode>DYNAMIC</mode>",
+			"<timestamp>2024-06-01 16:00:00</timestamp>",
+		}},
+		{"varac_json.txt", []string{
+			"<call>W1ABC</call>", "<mode>VARA HF</mode>", "<rxfreq>1410500</rxfreq>",
+			"<timestamp>2024-06-01 16:05:00</timestamp>",
+		}},
+		{"n1mm_contactinfo.xml", []string{
+			"<call>DL1XYZ</call>", "<mode>CW</mode>", "<timestamp>2024-06-01 17:00:12</timestamp>",
+		}},
+		{"fldigi_adif.txt", []string{
+			"<call>G4ABC</call>", "<mode>PSK31</mode>", "<snt>599</snt>", "<rcv>579</rcv>",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			h := startHarness(t, nil)
+			h.send(t, readPacket(t, test.file))
+
+			output, ok := h.receive(t, 2*time.Second)
+			if !ok {
+				t.Fatalf("no datagram forwarded for %s", test.file)
+			}
+
+			for _, element := range []string{"<contactinfo", "<mycall>W1AW</mycall>", "<operator>K1ABC</operator>"} {
+				if !strings.Contains(output, element) {
+					t.Errorf("output missing %s: %s", element, output)
+				}
+			}
+			for _, element := range test.expected {
+				if !strings.Contains(output, element) {
+					t.Errorf("output missing %s: %s", element, output)
+				}
+			}
+		})
+	}
+}
+
+func TestWSJTXLoggedPair(t *testing.T) {
+	binary := readPacket(t, "wsjtx_qso_logged.bin")
+	adif := readPacket(t, "wsjtx_logged_adif.bin")
+
+	// WSJT-X sends the binary message first; the pair goes out as one QSO
+	// with the comment and exchange only the binary message has
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listen.PreserveOrder = true
+	})
+	h.send(t, binary)
+	h.send(t, adif)
+	output, ok := h.receive(t, time.Second)
+	if !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	for _, element := range []string{"<call>K2ABC</call>", "<snt>-15</snt>", "<comment>FD 73</comment>", "3A"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("QSO forwarded twice: %s", output)
+	}
+
+	// A Logged ADIF message from a source not yet seen sending binary ones
+	// goes out at once; a late binary partner corrects it
+	h = startHarness(t, nil)
+	h.send(t, adif)
+	if _, ok := h.receive(t, time.Second); !ok {
+		t.Fatal("Logged ADIF message was not forwarded")
+	}
+	h.send(t, binary)
+	output, ok = h.receive(t, time.Second)
+	if !ok || !strings.HasPrefix(output, "<contactreplace>") || !strings.Contains(output, "<comment>FD 73</comment>") {
+		t.Errorf("late QSO Logged message should correct the QSO: %s", output)
+	}
+
+	// Without a partner the binary message goes out on its own
+	h = startHarness(t, nil)
+	h.send(t, binary)
+	output, ok = h.receive(t, 4*time.Second)
+	if !ok || !strings.Contains(output, "<call>K2ABC</call>") || !strings.Contains(output, "<band>20m</band>") {
+		t.Errorf("lone QSO Logged message not forwarded: %s", output)
+	}
+}
+
+func TestHeartbeatNotForwarded(t *testing.T) {
+	h := startHarness(t, nil)
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("heartbeat should not be forwarded, got: %s", output)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Watchdog.Enabled = true
+		cfg.Watchdog.Timeout = 300 * time.Millisecond
+		cfg.Watchdog.Heartbeat = true
+		cfg.Heartbeat.Payload = "watchdog"
+	})
+
+	if output, ok := h.receive(t, 2*time.Second); !ok || output != "watchdog" {
+		t.Fatalf("expected a heartbeat when the watchdog trips, got %q", output)
+	}
+
+	// It trips once per silence
+	if output, ok := h.receive(t, time.Second); ok {
+		t.Fatalf("expected no second heartbeat while silent, got %q", output)
+	}
+
+	// A packet resets it, so the next silence trips it again
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || output != "watchdog" {
+		t.Errorf("expected a heartbeat after the next silence, got %q", output)
+	}
+}
+
+func TestAdditionalTargetFormat(t *testing.T) {
+	adifTarget, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open second target: %v", err)
+	}
+	defer adifTarget.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Targets = []config.TargetConfig{{
+			Address: "127.0.0.1",
+			Port:    adifTarget.LocalAddr().(*net.UDPAddr).Port,
+			Format:  "adif",
+		}}
+	})
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>K2ABC</call>") {
+		t.Errorf("primary target did not receive N1MM XML: %q", output)
+	}
+
+	buf := make([]byte, 4096)
+	adifTarget.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := adifTarget.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("second target received nothing: %v", err)
+	}
+	if !strings.Contains(string(buf[:n]), "<CALL:5>K2ABC") {
+		t.Errorf("second target should receive ADIF, got: %s", buf[:n])
+	}
+}
+
+func TestStrictADIF(t *testing.T) {
+	adifTarget, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open second target: %v", err)
+	}
+	defer adifTarget.Close()
+	adifAddr := adifTarget.LocalAddr().String()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.ADIF.Strict = true
+		cfg.Stats.ErrorSamples = 5
+		cfg.Targets = []config.TargetConfig{{
+			Address: "127.0.0.1",
+			Port:    adifTarget.LocalAddr().(*net.UDPAddr).Port,
+			Format:  "adif",
+		}}
+	})
+	read := func() (string, bool) {
+		buf := make([]byte, 4096)
+		adifTarget.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, _, err := adifTarget.ReadFromUDP(buf)
+		return string(buf[:n]), err == nil
+	}
+
+	// VARA isn't an ADIF mode: N1MM still gets the QSO, the ADIF target doesn't
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:6>14.105<MODE:4>VARA<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("primary target did not receive the QSO")
+	}
+	if output, ok := read(); ok {
+		t.Errorf("ADIF target should not receive invalid ADIF, got: %s", output)
+	}
+	failures := h.relay.ParseFailures()
+	if len(failures) != 1 || failures[0].Source != adifAddr || !strings.Contains(failures[0].Error, `MODE "VARA"`) {
+		t.Errorf("expected the refused record in the failures, got %+v", failures)
+	}
+
+	// A valid QSO goes through
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if output, ok := read(); !ok || !strings.Contains(output, "<BAND:3>40m") {
+		t.Errorf("ADIF target should receive the valid QSO, got: %q", output)
+	}
+}
+
+func TestSerialNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serial.json")
+	start := func() *harness {
+		return startHarness(t, func(cfg *config.Config) {
+			cfg.Formatting.N1MM.Contest = "CQ-WPX-CW"
+			cfg.Serial.Mode = "auto"
+			cfg.Serial.Path = path
+		})
+	}
+	qso := func(h *harness, payload string) string {
+		h.send(t, []byte(payload))
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("QSO was not forwarded")
+		}
+		return output
+	}
+	fldigi := "<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"
+
+	h := start()
+	for _, want := range []string{"<sntnr>1</sntnr>", "<sntnr>2</sntnr>"} {
+		if output := qso(h, fldigi); !strings.Contains(output, want) {
+			t.Errorf("expected %s: %s", want, output)
+		}
+	}
+	// N1MM numbers its own QSOs
+	n1mm := `<contactinfo><contestname>CQ-WPX-CW</contestname><call>DL1XYZ</call><rxfreq>1402500</rxfreq><mode>CW</mode><sntnr>57</sntnr></contactinfo>`
+	if output := qso(h, n1mm); !strings.Contains(output, "<sntnr>57</sntnr>") {
+		t.Errorf("the source's serial should be kept: %s", output)
+	}
+	h.stop(t)
+
+	// Numbering carries on after a restart
+	h = start()
+	if output := qso(h, fldigi); !strings.Contains(output, "<sntnr>3</sntnr>") {
+		t.Errorf("expected serial 3 after a restart: %s", output)
+	}
+}
+
+func TestOperatorOnDuty(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.N1MM.Operator = "N7AKG"
+	})
+	defer h.stop(t)
+	fldigi := "<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"
+	operator := func() string {
+		h.send(t, []byte(fldigi))
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("QSO was not forwarded")
+		}
+		return output
+	}
+
+	if err := h.relay.SetOperator("k1abc"); err != nil {
+		t.Fatalf("SetOperator failed: %v", err)
+	}
+	if output := operator(); !strings.Contains(output, "<operator>K1ABC</operator>") {
+		t.Errorf("expected the operator on duty: %s", output)
+	}
+	if err := h.relay.SetOperator("not a call"); err == nil {
+		t.Error("expected an invalid callsign to be refused")
+	}
+	if err := h.relay.SetOperator(""); err != nil {
+		t.Fatalf("SetOperator failed: %v", err)
+	}
+	if output := operator(); !strings.Contains(output, "<operator>N7AKG</operator>") {
+		t.Errorf("expected the configured operator again: %s", output)
+	}
+}
+
+func TestReviewQueue(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Review.Enabled = true
+		cfg.Review.Timeout = 0
+	})
+	defer h.stop(t)
+
+	h.send(t, []byte("<CALL:5>G4ABD<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Fatalf("QSO forwarded before review: %s", output)
+	}
+	pending := h.relay.PendingQSOs()
+	if len(pending) != 1 || pending[0].QSO.Callsign != "G4ABD" {
+		t.Fatalf("expected the QSO held for review, got %+v", pending)
+	}
+
+	corrected := pending[0].QSO
+	corrected.Callsign = "G4ABC"
+	if _, err := h.relay.ForwardPending(strconv.Itoa(pending[0].Number), &corrected); err != nil {
+		t.Fatalf("ForwardPending failed: %v", err)
+	}
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok || !strings.Contains(output, "<call>G4ABC</call>") {
+		t.Errorf("expected the corrected QSO: %q", output)
+	}
+
+	h.send(t, []byte("<CALL:5>K1XYZ<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.relay.PendingQSOs()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(h.relay.PendingQSOs()) != 1 {
+		t.Fatal("second QSO was not held for review")
+	}
+	if _, err := h.relay.DiscardPending(h.relay.PendingQSOs()[0].QSO.ID); err != nil {
+		t.Fatalf("DiscardPending failed: %v", err)
+	}
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Errorf("discarded QSO was forwarded: %s", output)
+	}
+}
+
+func TestReviewTimeout(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Review.Enabled = true
+		cfg.Review.Timeout = 200 * time.Millisecond
+	})
+	defer h.stop(t)
+
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>G4ABC</call>") {
+		t.Errorf("expected the unreviewed QSO forwarded after the timeout: %q", output)
+	}
+}
+
+func TestReviewPolledSources(t *testing.T) {
+	// QSOs the relay reads itself, from fldigi's XML-RPC interface and
+	// Winlink session logs, are held like those sent to it
+	var mu sync.Mutex
+	call, record := "K1ABC", ""
+	fldigi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		result := call
+		if strings.Contains(string(body), "log.get_record") {
+			result = record
+		}
+		mu.Unlock()
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(result))
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value>%s</value></param></params></methodResponse>`, escaped.String())
+	}))
+	defer fldigi.Close()
+	logs := t.TempDir()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Review.Enabled = true
+		cfg.Review.Timeout = 0
+		cfg.Fldigi.Enabled = true
+		cfg.Fldigi.Address = strings.TrimPrefix(fldigi.URL, "http://")
+		cfg.Fldigi.PollInterval = 20 * time.Millisecond
+		cfg.Winlink.Enabled = true
+		cfg.Winlink.LogFiles = []string{filepath.Join(logs, "*.log")}
+		cfg.Winlink.PollInterval = 20 * time.Millisecond
+	})
+
+	// Save the fldigi QSO, and write a Winlink log; one created after
+	// startup is read from the beginning
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	call, record = "", "<CALL:5>K1ABC <QSO_DATE:8>20240601 <TIME_ON:6>150000 <FREQ:8>7.070000 <MODE:5>PSK31 <EOR>"
+	mu.Unlock()
+	session := "2024/06/01 14:23:01 *** Connected to KN6KB-10 (VARA HF)\n" +
+		"2024/06/01 14:23:02 Dial frequency: 14103.000 kHz\n" +
+		"2024/06/01 14:25:30 *** Disconnected from KN6KB-10\n"
+	if err := os.WriteFile(filepath.Join(logs, "session.log"), []byte(session), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	held := func() map[string]bool {
+		calls := make(map[string]bool)
+		for _, p := range h.relay.PendingQSOs() {
+			calls[p.QSO.Callsign] = true
+		}
+		return calls
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(held()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls := held(); !calls["K1ABC"] || !calls["KN6KB"] {
+		t.Errorf("expected the fldigi and Winlink QSOs held for review, got %v", calls)
+	}
+	if output, ok := h.receive(t, 200*time.Millisecond); ok {
+		t.Errorf("QSO forwarded before review: %s", output)
+	}
+}
+
+func TestSNRReports(t *testing.T) {
+	adifTarget, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open second target: %v", err)
+	}
+	defer adifTarget.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Targets = []config.TargetConfig{{
+			Address:    "127.0.0.1",
+			Port:       adifTarget.LocalAddr().(*net.UDPAddr).Port,
+			Format:     "adif",
+			SNRReports: "comment",
+		}}
+	})
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+
+	// The primary target keeps the dB reports
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<snt>-15</snt>") {
+		t.Errorf("primary target should get the dB report: %q", output)
+	}
+
+	buf := make([]byte, 4096)
+	adifTarget.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := adifTarget.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("second target received nothing: %v", err)
+	}
+	output := string(buf[:n])
+	if !strings.Contains(output, "<RST_SENT:3>599") || !strings.Contains(output, "<RST_RCVD:3>599") ||
+		!strings.Contains(output, "SNR sent -15 rcvd -08") {
+		t.Errorf("second target should get 599 with the SNR in the comment: %s", output)
+	}
+}
+
+func TestQSOIDs(t *testing.T) {
+	second, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open second target: %v", err)
+	}
+	defer second.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.N1MM.App = "Relay {version}"
+		cfg.Formatting.N1MM.SendID = true
+		cfg.Version = "1.4.0"
+		cfg.Targets = []config.TargetConfig{{Address: "127.0.0.1", Port: second.LocalAddr().(*net.UDPAddr).Port, Format: "n1mm"}}
+	})
+	idPattern := regexp.MustCompile(`<ID>([0-9a-f]{32})</ID>`)
+
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	if !strings.Contains(output, "<app>Relay 1.4.0</app>") {
+		t.Errorf("configured app name missing: %s", output)
+	}
+	first := idPattern.FindStringSubmatch(output)
+	if first == nil {
+		t.Fatalf("QSO forwarded without an ID: %s", output)
+	}
+
+	// Every target sees the same ID for a QSO
+	buf := make([]byte, 4096)
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := second.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("second target received nothing: %v", err)
+	}
+	if m := idPattern.FindStringSubmatch(string(buf[:n])); m == nil || m[1] != first[1] {
+		t.Errorf("second target got a different ID: %s", buf[:n])
+	}
+
+	// and the next QSO gets a new one
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || strings.Contains(output, first[1]) {
+		t.Errorf("second QSO should have a new ID: %s", output)
+	}
+}
+
+func TestQSOEdits(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.N1MM.SendID = true
+	})
+	idPattern := regexp.MustCompile(`<ID>([0-9a-f]{32})</ID>`)
+
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	match := idPattern.FindStringSubmatch(output)
+	if match == nil {
+		t.Fatalf("QSO forwarded without an ID: %s", output)
+	}
+	id := match[1]
+
+	// A correction through the API replaces the contact by ID
+	qso, ok := h.relay.QSO(id)
+	if !ok {
+		t.Fatalf("forwarded QSO %s not found", id)
+	}
+	qso.Callsign = "K9XYZ"
+	if err := h.relay.ReplaceQSO(qso); err != nil {
+		t.Fatalf("ReplaceQSO failed: %v", err)
+	}
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok || !strings.HasPrefix(output, "<contactreplace>") || !strings.Contains(output, "<call>K9XYZ</call>") ||
+		!strings.Contains(output, "<ID>"+id+"</ID>") {
+		t.Errorf("expected contactreplace for %s: %s", id, output)
+	}
+
+	if err := h.relay.DeleteQSO(id); err != nil {
+		t.Fatalf("DeleteQSO failed: %v", err)
+	}
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok || !strings.HasPrefix(output, "<contactdelete>") || !strings.Contains(output, "<ID>"+id+"</ID>") {
+		t.Errorf("expected contactdelete for %s: %s", id, output)
+	}
+	if _, ok := h.relay.QSO(id); ok {
+		t.Error("deleted QSO is still known")
+	}
+	if err := h.relay.DeleteQSO(id); err == nil {
+		t.Error("expected deleting an unknown QSO to fail")
+	}
+
+	// Deletions from a logger that sends them are passed on
+	h.send(t, []byte(`<contactdelete><app>N1MM</app><timestamp>2024-06-01 12:00:00</timestamp><call>K1ABC</call><contestnr>1</contestnr><StationName>PC2</StationName><ID>0123456789abcdef0123456789abcdef</ID></contactdelete>`))
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok || !strings.HasPrefix(output, "<contactdelete>") || !strings.Contains(output, "<ID>0123456789abcdef0123456789abcdef</ID>") {
+		t.Errorf("expected the N1MM deletion to be forwarded: %s", output)
+	}
+}
+
+func TestSendOnce(t *testing.T) {
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open target socket: %v", err)
+	}
+	defer target.Close()
+
+	r, err := relay.New(testConfig(target.LocalAddr().(*net.UDPAddr).Port))
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	results, err := r.Send(readPacket(t, "fldigi_adif_batch.txt"), "", "fldigi_adif_batch.txt")
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(results) < 2 {
+		t.Fatalf("expected a result per record, got %d", len(results))
+	}
+
+	buf := make([]byte, 65536)
+	for _, res := range results {
+		if res.Err != nil || res.Sent != 1 || res.Type != "fldigi" {
+			t.Errorf("record not sent: %+v", res)
+			continue
+		}
+		target.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := target.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("target received nothing: %v", err)
+		}
+		if !strings.Contains(string(buf[:n]), "<call>"+res.QSO.Callsign+"</call>") {
+			t.Errorf("expected %s in output: %s", res.QSO.Callsign, buf[:n])
+		}
+	}
+
+	// A pinned type that doesn't fit is reported per record, not sent
+	results, err = r.Send([]byte("not a QSO"), "n1mm", "test")
+	if err != nil || len(results) != 1 || results[0].Err == nil {
+		t.Errorf("expected a parse failure, got %+v, %v", results, err)
+	}
+}
+
+func TestSourceOverrides(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.Overrides = []config.SourceOverride{
+			{Source: "10.0.0.0/8", Operator: "NOPE"},
+			{Source: "127.0.0.1", Type: "fldigi", Operator: "KB7JS"},
+			{Type: "wsjt-x", Operator: "N7FT", Contest: "ARRL-DIGI"},
+		}
+	})
+
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	for _, element := range []string{"<mycall>W1AW</mycall>", "<operator>N7FT</operator>", "<contestname>ARRL-DIGI</contestname>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	for _, element := range []string{"<operator>KB7JS</operator>", "<contestname>GENERAL</contestname>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+}
+
+func TestCallAliases(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.CallAliases = []config.CallAlias{
+			{Call: "K1ABC", Station: "N7XX", Source: "10.0.0.0/8"},
+			{Call: "k1abc", Station: "K7CLB", From: "2024-06-01 12:00", Until: "2024-06-02 12:00"},
+			{Call: "K1ABC", Station: "W7YY", Operator: "K1ABC/7", From: "22:00", Until: "06:00"},
+		}
+	})
+
+	qso := func(date, time string) []byte {
+		return []byte("<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<STATION_CALLSIGN:5>K1ABC<QSO_DATE:8>" + date + "<TIME_ON:6>" + time + "<PROGRAMID:6>fldigi<EOR>")
+	}
+	for _, tc := range []struct {
+		date, time string
+		want       []string
+	}{
+		{"20240601", "150000", []string{"<mycall>K7CLB</mycall>", "<operator>K1ABC</operator>"}},
+		{"20240603", "230000", []string{"<mycall>W7YY</mycall>", "<operator>K1ABC/7</operator>"}},
+		{"20240603", "150000", []string{"<mycall>W1AW</mycall>"}}, // No alias matches
+	} {
+		h.send(t, qso(tc.date, tc.time))
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("no datagram forwarded")
+		}
+		for _, element := range tc.want {
+			if !strings.Contains(output, element) {
+				t.Errorf("%s %s: output missing %s: %s", tc.date, tc.time, element, output)
+			}
+		}
+	}
+}
+
+func TestFieldMappings(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.Mappings = []config.FieldMapping{
+			{Type: "wsjt-x", Set: map[string]string{"exchange1": "{{.grid}}"}},
+			{Source: "127.0.0.1", Type: "fldigi", Match: map[string]string{"mode": "^PSK"}, Set: map[string]string{"comment": "{{.mode}} via fldigi"}},
+		}
+	})
+
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<GRIDSQUARE:4>io91<QSO_DATE:8>20240601<TIME_ON:6>150000<PROGRAMID:6>fldigi<EOR>"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	for _, element := range []string{"<gridsquare>IO91</gridsquare>", "<comment>PSK31 via fldigi</comment>", "<exchange1></exchange1>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+
+	// Replaced at runtime
+	err := h.relay.SetFieldMappings([]config.FieldMapping{{Set: map[string]string{"exchange1": "{{.grid}}"}}})
+	if err != nil {
+		t.Fatalf("SetFieldMappings failed: %v", err)
+	}
+	if err := h.relay.SetFieldMappings([]config.FieldMapping{{Set: map[string]string{"exchange9": "x"}}}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<GRIDSQUARE:4>IO91<QSO_DATE:8>20240601<TIME_ON:6>150100<PROGRAMID:6>fldigi<EOR>"))
+	if output, ok = h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<exchange1>IO91</exchange1>") {
+		t.Errorf("replaced mapping not applied: %q", output)
+	}
+}
+
+func TestN1MMBridge(t *testing.T) {
+	passthrough, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open pass-through socket: %v", err)
+	}
+	defer passthrough.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Bridge.Enabled = true
+		cfg.Bridge.ListenAddress = "127.0.0.1"
+		cfg.Bridge.ListenPort = 0
+		cfg.Bridge.Forward = []string{passthrough.LocalAddr().String()}
+		cfg.Bridge.WSJTXModeSync = true
+	})
+
+	// The heartbeat tells the relay where WSJT-X is listening
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+	time.Sleep(100 * time.Millisecond)
+
+	n1mm, err := net.DialUDP("udp", nil, h.relay.BridgeAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to open N1MM socket: %v", err)
+	}
+	defer n1mm.Close()
+	radioInfo := readPacket(t, "n1mm_radioinfo.xml")
+	if _, err := n1mm.Write(radioInfo); err != nil {
+		t.Fatalf("failed to send RadioInfo: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	passthrough.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := passthrough.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("RadioInfo was not passed through: %v", err)
+	}
+	if string(buf[:n]) != string(radioInfo) {
+		t.Errorf("pass-through altered the datagram: %s", buf[:n])
+	}
+
+	h.source.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err = h.source.Read(buf)
+	if err != nil {
+		t.Fatalf("WSJT-X did not receive a Configure message: %v", err)
+	}
+	h2, ok := wsjtx.ParseHeader(buf[:n])
+	if !ok || h2.Type != wsjtx.MessageConfigure || h2.ID != "WSJT-X" {
+		t.Fatalf("unexpected message to WSJT-X: %+v", h2)
+	}
+	if !strings.Contains(string(buf[:n]), "FT4") {
+		t.Errorf("Configure message should select FT4: % x", buf[:n])
+	}
+}
+
+// statusMessage builds the start of a WSJT-X Status message
+func statusMessage(id string, dialHz uint64, mode string) []byte {
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, wsjtx.Magic)
+	buf = binary.BigEndian.AppendUint32(buf, wsjtx.SchemaVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(wsjtx.MessageStatus))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(id)))
+	buf = append(buf, id...)
+	buf = binary.BigEndian.AppendUint64(buf, dialHz)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(mode)))
+	return append(buf, mode...)
+}
+
+// decodeMessage builds a new WSJT-X Decode message
+func decodeMessage(id string, snr int32, message string) []byte {
+	appendUTF8 := func(buf []byte, s string) []byte {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+		return append(buf, s...)
+	}
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, wsjtx.Magic)
+	buf = binary.BigEndian.AppendUint32(buf, wsjtx.SchemaVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(wsjtx.MessageDecode))
+	buf = appendUTF8(buf, id)
+	buf = append(buf, 1)                               // new
+	buf = binary.BigEndian.AppendUint32(buf, 43200000) // 12:00:00
+	buf = binary.BigEndian.AppendUint32(buf, uint32(snr))
+	buf = binary.BigEndian.AppendUint64(buf, 0)    // delta time
+	buf = binary.BigEndian.AppendUint32(buf, 1500) // delta frequency
+	buf = appendUTF8(buf, "~")
+	buf = appendUTF8(buf, message)
+	return append(buf, 0, 0) // low confidence, off air
+}
+
+func TestBandActivity(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Activity.Enabled = true
+		cfg.Activity.Window = time.Hour
+	})
+
+	h.send(t, statusMessage("WSJT-X", 14074000, "FT8"))
+	h.send(t, decodeMessage("WSJT-X", -12, "CQ K1ABC FN42"))
+	h.send(t, decodeMessage("WSJT-X", -3, "CQ DX JA1XYZ PM95"))
+	h.send(t, decodeMessage("WSJT-X", 0, "K1ABC W1XYZ -05"))
+
+	var bands []activity.Band
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d, err := h.relay.Activity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bands = d.Bands
+		if len(bands) == 1 && bands[0].CQs == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(bands) != 1 || bands[0].Band != "20m" || bands[0].CQs != 2 || bands[0].Calls != 2 || bands[0].BestSNR != -3 {
+		t.Errorf("activity = %+v, want 2 CQs from 2 calls on 20m with best SNR -3", bands)
+	}
+}
+
+func TestWorkedBeforeHighlight(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.WSJTX.Highlight.Enabled = true
+		cfg.WSJTX.Highlight.Background = "#c0c0c0"
+	})
+
+	// Work K2ABC on 20m FT8
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("logged QSO was not forwarded")
+	}
+
+	expectHighlight := func(what string) []byte {
+		t.Helper()
+		buf := make([]byte, 4096)
+		h.source.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := h.source.Read(buf)
+		if err != nil {
+			t.Fatalf("WSJT-X received no highlight %s: %v", what, err)
+		}
+		header, ok := wsjtx.ParseHeader(buf[:n])
+		if !ok || header.Type != wsjtx.MessageHighlightCallsign || header.ID != "WSJT-X" {
+			t.Fatalf("unexpected message to WSJT-X: %+v", header)
+		}
+		if !strings.Contains(string(buf[:n]), "K2ABC") {
+			t.Errorf("highlight %s should name K2ABC: % x", what, buf[:n])
+		}
+		return buf[:n]
+	}
+
+	h.send(t, statusMessage("WSJT-X", 14074000, "FT8"))
+	set := expectHighlight("on 20m FT8")
+
+	// Moving to 40m removes the highlight again
+	h.send(t, statusMessage("WSJT-X", 7074000, "FT8"))
+	cleared := expectHighlight("cleared on 40m")
+	if string(set) == string(cleared) {
+		t.Error("moving band should clear the highlight colors")
+	}
+}
+
+func TestExchangeLookup(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Bridge.Enabled = true
+		cfg.Bridge.ListenAddress = "127.0.0.1"
+		cfg.Bridge.ListenPort = 0
+		cfg.Formatting.Exchange.Lookup = true
+	})
+
+	// N1MM announces what its call history knows about G4ABC
+	n1mm, err := net.DialUDP("udp", nil, h.relay.BridgeAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to open N1MM socket: %v", err)
+	}
+	defer n1mm.Close()
+	if _, err := n1mm.Write(readPacket(t, "n1mm_lookupinfo.xml")); err != nil {
+		t.Fatalf("failed to send lookupinfo: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The Fldigi QSO carries no exchange; the relay fills it in
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	if !strings.Contains(output, "<exchange1>14</exchange1>") {
+		t.Errorf("exchange was not prefilled: %s", output)
+	}
+
+	// Calls N1MM hasn't looked up are left without one
+	h.send(t, readPacket(t, "varac_adif.txt"))
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	if !strings.Contains(output, "<exchange1></exchange1>") {
+		t.Errorf("exchange of an unknown call was filled in: %s", output)
+	}
+}
+
+func TestRigFrequency(t *testing.T) {
+	// A stand-in rigctld with the radio on 20m FT8
+	rigctld, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start rigctld: %v", err)
+	}
+	defer rigctld.Close()
+	go func() {
+		for {
+			conn, err := rigctld.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					cmd, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.TrimSpace(cmd) == "f" {
+						conn.Write([]byte("14074000\n"))
+					} else {
+						conn.Write([]byte("PKTUSB\n3000\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Rig.Enabled = true
+		cfg.Rig.Address = rigctld.Addr().String()
+		cfg.Rig.PollInterval = 50 * time.Millisecond
+		cfg.Rig.RadioInfo = true
+	})
+
+	// The first poll is announced to N1MM as a RadioInfo message
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok || !strings.Contains(output, "<RadioInfo>") || !strings.Contains(output, "<Freq>1407400</Freq>") ||
+		!strings.Contains(output, "<Mode>USB</Mode>") {
+		t.Fatalf("expected RadioInfo for 14.074 USB, got %q", output)
+	}
+
+	// A QSO without a frequency is logged on the radio's frequency
+	h.send(t, []byte("QSO with W1ABC"))
+	output, ok = h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("no datagram forwarded")
+	}
+	for _, element := range []string{"<call>W1ABC</call>", "<rxfreq>1407400</rxfreq>", "<band>20m</band>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+}
+
+func TestFldigiXMLRPC(t *testing.T) {
+	// A stand-in fldigi: the log entry holds K1ABC until it is saved
+	var mu sync.Mutex
+	call, record := "K1ABC", ""
+	fldigi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		result := call
+		if strings.Contains(string(body), "log.get_record") {
+			result = record
+		}
+		mu.Unlock()
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(result))
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value>%s</value></param></params></methodResponse>`, escaped.String())
+	}))
+	defer fldigi.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Fldigi.Enabled = true
+		cfg.Fldigi.Address = strings.TrimPrefix(fldigi.URL, "http://")
+		cfg.Fldigi.PollInterval = 20 * time.Millisecond
+	})
+
+	// Let the relay see the call being entered, then save the QSO
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	call, record = "", "<CALL:5>K1ABC <QSO_DATE:8>20240601 <TIME_ON:6>150000 <FREQ:8>7.070000 <MODE:5>PSK31 <RST_SENT:3>599 <EOR>"
+	mu.Unlock()
+
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("saved fldigi QSO was not relayed")
+	}
+	for _, element := range []string{"<call>K1ABC</call>", "<band>40m</band>", "<mode>PSK31</mode>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+	if output, ok := h.receive(t, 200*time.Millisecond); ok {
+		t.Errorf("QSO relayed twice: %s", output)
+	}
+}
+
+func TestGPSGrid(t *testing.T) {
+	// A stand-in gpsd with a 3D fix in FN31
+	gpsd, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start gpsd: %v", err)
+	}
+	defer gpsd.Close()
+	go func() {
+		conn, err := gpsd.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+		for i := 0; i < 20; i++ {
+			if _, err := conn.Write([]byte(`{"class":"TPV","mode":3,"lat":41.714775,"lon":-72.727260}` + "\n")); err != nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.GPS.Enabled = true
+		cfg.GPS.Address = gpsd.Addr().String()
+		cfg.GPS.Precision = 6
+	})
+
+	// Wait for the first fix; QSOs before it go out without a grid
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		h.send(t, []byte("QSO with W1ABC"))
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("no datagram forwarded")
+		}
+		if strings.Contains(output, "<RoverLocation>FN31pr</RoverLocation>") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("QSO was not stamped with the GPS grid: %s", output)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestJTAlert(t *testing.T) {
+	h := startHarness(t, nil)
+
+	// The station broadcast is remembered, not forwarded
+	h.send(t, []byte(`<?xml version="1.0" encoding="utf-8"?><JTAlert><Station><MyCall>N7AKG</MyCall><MyGrid>CN87ts</MyGrid><Band>20m</Band><Mode>FT8</Mode></Station></JTAlert>`))
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Fatalf("station broadcast was forwarded: %s", output)
+	}
+
+	h.send(t, []byte(`<?xml version="1.0" encoding="utf-8"?><JTAlert><LastQSO><ADIF>&lt;CALL:6&gt;VK2ABC&lt;BAND:3&gt;20m&lt;MODE:3&gt;FT8&lt;FREQ:9&gt;14.074512&lt;QSO_DATE:8&gt;20240601&lt;TIME_ON:6&gt;081500&lt;EOR&gt;</ADIF></LastQSO></JTAlert>`))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("JTAlert last QSO was not forwarded")
+	}
+	for _, element := range []string{"<call>VK2ABC</call>", "<mode>FT8</mode>", "<RoverLocation>CN87ts</RoverLocation>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+}
+
+func TestPreserveOrder(t *testing.T) {
+	const total, burst = 300, 50
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listen.Workers = 8
+		cfg.Listen.PreserveOrder = true
+	})
+
+	// Bursts of distinct calls from one source, sent back to back; with eight
+	// workers sharing a queue they would be forwarded in a shuffled order
+	for sent := 0; sent < total; sent += burst {
+		calls := make([]string, burst)
+		for i := range calls {
+			n := sent + i
+			calls[i] = fmt.Sprintf("K1%c%c%c", 'A'+n/676, 'A'+n/26%26, 'A'+n%26)
+			h.send(t, []byte(fmt.Sprintf("<CALL:5>%s<MODE:2>CW<PROGRAMID:6>fldigi<EOR>", calls[i])))
+		}
+
+		for i, want := range calls {
+			output, ok := h.receive(t, 2*time.Second)
+			if !ok {
+				t.Fatalf("only %d of %d QSOs forwarded", sent+i, total)
+			}
+			if !strings.Contains(output, "<call>"+want+"</call>") {
+				t.Fatalf("QSO %d out of order: want %s, got %s", sent+i, want, output)
+			}
+		}
+	}
+}
+
+func TestTargetUnreachableAlert(t *testing.T) {
+	alerts := make(chan string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		alerts <- body["content"]
+	}))
+	defer webhook.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Alerts.Enabled = true
+		cfg.Alerts.Events = []string{"target_unreachable"}
+		cfg.Alerts.TargetFailures = 2
+		cfg.Alerts.Discord.WebhookURL = webhook.URL
+	})
+	targetAddr := h.target.LocalAddr().String()
+
+	// With nothing listening, the kernel reports the refused port on the
+	// sends that follow the first one
+	h.target.Close()
+	for i := 0; i < 5; i++ {
+		h.send(t, readPacket(t, "fldigi_adif.txt"))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	select {
+	case content := <-alerts:
+		if !strings.Contains(content, "Target unreachable: "+targetAddr) {
+			t.Errorf("unexpected alert: %s", content)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no target unreachable alert")
+	}
+}
+
+func TestTargetResponses(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Target.ResponseTimeout = time.Second
+		cfg.Journal.Path = journalPath
+	})
+	targetAddr := h.target.LocalAddr().String()
+
+	// The target acknowledges the first QSO and rejects the second
+	go func() {
+		buf := make([]byte, 65536)
+		for _, reply := range []string{"OK 1 QSO logged", "ERROR: duplicate contact"} {
+			_, from, err := h.target.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			h.target.WriteToUDP([]byte(reply), from)
+		}
+	}()
+
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	time.Sleep(200 * time.Millisecond)
+	h.send(t, readPacket(t, "varac_json.txt"))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		snap := h.relay.Stats()
+		if snap.Acknowledged[targetAddr] == 1 && snap.Rejected[targetAddr] == 1 {
+			if snap.QSOs != 1 || snap.TargetErrors[targetAddr] != 1 {
+				t.Errorf("a rejected QSO should count as a failed send: %+v", snap)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replies not counted: %+v", snap)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	j, err := journal.Open(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	entries, err := j.Entries(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || len(entries[0].Responses) != 1 {
+		t.Fatalf("expected the acknowledged QSO journaled with its reply, got %+v", entries)
+	}
+	if resp := entries[0].Responses[0]; resp.Target != targetAddr || resp.Status != journal.ResponseOK || resp.Reply != "OK 1 QSO logged" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.log")
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Log.Trace = true
+		cfg.Log.TraceFile = path
+	})
+
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	h.stop(t)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read trace: %v", err)
+	}
+	trace := string(data)
+	for _, expected := range []string{
+		"ad bc cb da",    // hex dump of the WSJT-X magic
+		"|<CALL:5>G4ABC", // ASCII column
+		"detected general (rule wsjtx-binary)",
+		"dropped: parse failed: binary protocol message",
+		"detected fldigi (rule fldigi)",
+		"parsed QSO with G4ABC on 20m PSK31",
+		"forwarded to 1 of 1 targets",
+	} {
+		if !strings.Contains(trace, expected) {
+			t.Errorf("trace missing %q:\n%s", expected, trace)
+		}
+	}
+}
+
+func TestPinnedListener(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listeners = []config.ListenerConfig{{Address: "127.0.0.1", Port: 0, SourceType: "fldigi"}}
+	})
+
+	addrs := h.relay.ListenAddrs()
+	if len(addrs) != 2 {
+		t.Fatalf("expected the main listener and one more, got %v", addrs)
+	}
+	fldigi, err := net.DialUDP("udp", nil, addrs[1].(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to open fldigi socket: %v", err)
+	}
+	defer fldigi.Close()
+
+	// Bare ADIF without a program id: only the pinned type makes this fldigi
+	if _, err := fldigi.Write([]byte("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<RST_SENT:3>599<RST_RCVD:3>579<EOR>")); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("QSO sent to the pinned listener was not forwarded")
+	}
+	for _, element := range []string{"<call>G4ABC</call>", "<mode>CW</mode>", "<band>40m</band>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+
+	// The main listener still detects
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>K2ABC</call>") {
+		t.Errorf("main listener did not forward WSJT-X QSO: %q", output)
+	}
+
+	cfg := testConfig(0)
+	cfg.Listeners = []config.ListenerConfig{{Address: "127.0.0.1", SourceType: "fldgi"}}
+	if _, err := relay.New(cfg); err == nil {
+		t.Error("expected an error for an unknown listener source type")
+	}
+}
+
+func TestRawListener(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listeners = []config.ListenerConfig{{Address: "127.0.0.1", Raw: true, Prepend: "\x02", Append: "\r\n"}}
+	})
+
+	raw, err := net.DialUDP("udp", nil, h.relay.ListenAddrs()[1].(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to open raw socket: %v", err)
+	}
+	defer raw.Close()
+
+	// A QSO that would otherwise be parsed goes out byte for byte
+	packet := readPacket(t, "n1mm_contactinfo.xml")
+	if _, err := raw.Write(packet); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("datagram sent to the raw listener was not repeated")
+	}
+	if want := "\x02" + string(packet) + "\r\n"; output != want {
+		t.Errorf("raw datagram was changed:\n got %q\nwant %q", output, want)
+	}
+
+	cfg := testConfig(0)
+	cfg.Listeners = []config.ListenerConfig{{Address: "127.0.0.1", Raw: true, SourceType: "n1mm"}}
+	if _, err := relay.New(cfg); err == nil {
+		t.Error("expected an error for a raw listener with a source type")
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	// Another program already owns the port and allows sharing it
+	other, err := relay.ListenUDP("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("failed to bind shared socket: %v", err)
+	}
+	defer other.Close()
+	port := other.LocalAddr().(*net.UDPAddr).Port
+
+	if conn, err := relay.ListenUDP(other.LocalAddr().String(), false); err == nil {
+		conn.Close()
+		t.Fatal("expected binding the shared port without reuse_port to fail")
+	}
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listen.Port = port
+		cfg.Listen.ReusePort = true
+	})
+	if got := h.relay.ListenAddr().(*net.UDPAddr).Port; got != port {
+		t.Errorf("relay listening on port %d, want shared port %d", got, port)
+	}
+}
+
+func TestMulticastListener(t *testing.T) {
+	const group = "239.255.42.99"
+	probe, err := relay.ListenMulticast(group, 0, "")
+	if err != nil {
+		t.Skipf("multicast not available: %v", err)
+	}
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listeners = []config.ListenerConfig{{Port: port, MulticastGroup: group, SourceType: "wsjt-x"}}
+	})
+
+	// WSJT-X sends to the group; the relay receives it like any other listener
+	sender, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.ParseIP(group), Port: port})
+	if err != nil {
+		t.Fatalf("failed to open multicast sender: %v", err)
+	}
+	defer sender.Close()
+	if _, err := sender.Write(readPacket(t, "wsjtx_logged_adif.bin")); err != nil {
+		t.Skipf("multicast send failed: %v", err)
+	}
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Skip("multicast datagram not looped back on this host")
+	}
+	if !strings.Contains(output, "<call>K2ABC</call>") {
+		t.Errorf("multicast QSO not forwarded: %q", output)
+	}
+
+	cfg := testConfig(0)
+	cfg.Listeners = []config.ListenerConfig{{Port: port, MulticastGroup: "192.168.1.5"}}
+	if _, err := relay.New(cfg); err == nil || !strings.Contains(err.Error(), "not a multicast") {
+		t.Errorf("expected an error for a unicast group address, got %v", err)
+	}
+}
+
+func TestInterfaceBinding(t *testing.T) {
+	var loopback string
+	interfaces, _ := net.Interfaces()
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			if ip, err := relay.InterfaceAddr(ifi.Name); err == nil && ip.Equal(net.IPv4(127, 0, 0, 1)) {
+				loopback = ifi.Name
+				break
+			}
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface with 127.0.0.1")
+	}
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Listen.Address = ""
+		cfg.Listen.Interface = loopback
+		cfg.Target.Interface = loopback
+	})
+	if ip := h.relay.ListenAddr().(*net.UDPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("listener bound %s, want the interface's 127.0.0.1", ip)
+	}
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>K2ABC</call>") {
+		t.Errorf("QSO not forwarded from the interface: %q", output)
+	}
+
+	// Interfaces and addresses this computer doesn't have fail at startup
+	for _, modify := range []func(*config.Config){
+		func(cfg *config.Config) { cfg.Listen.Interface = "nosuchif0" },
+		func(cfg *config.Config) { cfg.Target.Interface = "nosuchif0" },
+		func(cfg *config.Config) { cfg.Target.LocalAddress = "192.0.2.1" },
+	} {
+		cfg := testConfig(0)
+		modify(cfg)
+		if _, err := relay.New(cfg); err == nil {
+			t.Errorf("expected a startup error for %+v / %+v", cfg.MainListener(), cfg.Target)
+		}
+	}
+}
+
+func TestLargeDatagrams(t *testing.T) {
+	// An N1MM contactinfo well past the old 4KB buffer
+	large := strings.Replace(string(readPacket(t, "n1mm_contactinfo.xml")),
+		"<call>", "<misctext>"+strings.Repeat("x", 10000)+"</misctext><call>", 1)
+
+	h := startHarness(t, nil)
+	h.send(t, []byte(large))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>DL1XYZ</call>") {
+		t.Errorf("large datagram was not relayed intact: %q", output)
+	}
+
+	// With a small buffer the truncated datagram is dropped, not mis-parsed
+	small := startHarness(t, func(cfg *config.Config) {
+		cfg.Listen.BufferSize = 1024
+	})
+	small.send(t, []byte(large))
+	if output, ok := small.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("truncated datagram should be dropped, got: %s", output)
+	}
+}
+
+func TestClockDrift(t *testing.T) {
+	// A QSO logged by a machine whose clock is an hour behind
+	qsoTime := time.Now().UTC().Add(-time.Hour)
+	adif := fmt.Sprintf("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<QSO_DATE:8>%s<TIME_ON:6>%s<PROGRAM_ID:6>FLDIGI<EOR>",
+		qsoTime.Format("20060102"), qsoTime.Format("150405"))
+
+	timestamp := func(t *testing.T, output string) time.Time {
+		t.Helper()
+		_, rest, _ := strings.Cut(output, "<timestamp>")
+		value, _, _ := strings.Cut(rest, "</timestamp>")
+		ts, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			t.Fatalf("no timestamp in output: %s", output)
+		}
+		return ts
+	}
+
+	for _, tc := range []struct {
+		action string
+		want   time.Duration // expected offset from now
+	}{
+		{"replace", 0},
+		{"clamp", -5 * time.Minute},
+	} {
+		t.Run(tc.action, func(t *testing.T) {
+			h := startHarness(t, func(cfg *config.Config) {
+				cfg.Formatting.Time.OutputUTC = true
+				cfg.Formatting.Time.DriftThreshold = 5 * time.Minute
+				cfg.Formatting.Time.DriftAction = tc.action
+			})
+			h.send(t, []byte(adif))
+			output, ok := h.receive(t, 2*time.Second)
+			if !ok {
+				t.Fatal("QSO was not forwarded")
+			}
+			offset := timestamp(t, output).Sub(time.Now().UTC())
+			if offset < tc.want-5*time.Second || offset > tc.want+5*time.Second {
+				t.Errorf("timestamp is %s from now, expected about %s: %s", offset.Round(time.Second), tc.want, output)
+			}
+		})
+	}
+
+	cfg := testConfig(0)
+	cfg.Formatting.Time.DriftThreshold = time.Minute
+	cfg.Formatting.Time.DriftAction = "ignore"
+	if _, err := relay.New(cfg); err == nil {
+		t.Error("expected an error for an unknown drift action")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	// A QSO from a log VarAC replays when it starts
+	adif := func(age time.Duration) []byte {
+		qsoTime := time.Now().UTC().Add(-age)
+		return []byte(fmt.Sprintf("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<QSO_DATE:8>%s<TIME_ON:6>%s<PROGRAM_ID:6>FLDIGI<EOR>",
+			qsoTime.Format("20060102"), qsoTime.Format("150405")))
+	}
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.Time.MaxAge = 30 * time.Minute
+		// Drift compensation would otherwise make the old QSO new
+		cfg.Formatting.Time.DriftThreshold = 5 * time.Minute
+	})
+	h.send(t, adif(2*time.Hour))
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("old QSO should be dropped, got: %s", output)
+	}
+	if dropped := h.relay.Stats().Dropped["too_old"]; dropped != 1 {
+		t.Errorf("counted %d old QSOs, want 1", dropped)
+	}
+	h.send(t, adif(10*time.Minute))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Error("QSO within max_age was not forwarded")
+	}
+
+	flag := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.Time.MaxAge = 30 * time.Minute
+		cfg.Formatting.Time.MaxAgeAction = "flag"
+	})
+	flag.send(t, adif(2*time.Hour))
+	if output, ok := flag.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<comment>Old QSO: logged 2h0m0s ago</comment>") {
+		t.Errorf("old QSO should be forwarded with a note: %q", output)
+	}
+
+	accept := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.Time.MaxAge = 30 * time.Minute
+		cfg.Formatting.Time.AcceptOld = true
+	})
+	accept.send(t, adif(2*time.Hour))
+	if output, ok := accept.receive(t, 2*time.Second); !ok || strings.Contains(output, "Old QSO") {
+		t.Errorf("accept_old should forward the QSO as it is: %q", output)
+	}
+}
+
+func TestWorkedBeforeDatabase(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.WorkedDB.Enabled = true
+		cfg.WorkedDB.Path = filepath.Join(t.TempDir(), "worked.jsonl")
+		cfg.WorkedDB.Annotate = true
+	})
+
+	qso := func(mode string) string {
+		h.send(t, []byte(fmt.Sprintf("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:%d>%s<PROGRAM_ID:6>FLDIGI<EOR>", len(mode), mode)))
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("QSO was not forwarded")
+		}
+		return output
+	}
+
+	if output := qso("CW"); !strings.Contains(output, "<comment>NEW CALL</comment>") {
+		t.Errorf("first QSO should be a new call: %s", output)
+	}
+	if output := qso("CW"); !strings.Contains(output, "<comment></comment>") {
+		t.Errorf("repeat QSO should not be annotated: %s", output)
+	}
+	if output := qso("RTTY"); !strings.Contains(output, "<comment>NEW BAND/MODE</comment>") {
+		t.Errorf("QSO on another mode should be a new slot: %s", output)
+	}
+
+	record, status, err := h.relay.WorkedBefore("G4ABC", "40m", "CW")
+	if err != nil || len(record.Slots) != 2 || status.NewSlot {
+		t.Errorf("unexpected lookup %+v %+v %v", record, status, err)
+	}
+}
+
+func TestMultiRecordDatagram(t *testing.T) {
+	h := startHarness(t, nil)
+	h.send(t, readPacket(t, "fldigi_adif_batch.txt"))
+
+	var calls []string
+	for i := 0; i < 3; i++ {
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatalf("expected 3 forwarded QSOs, got %d", i)
+		}
+		start := strings.Index(output, "<call>")
+		end := strings.Index(output, "</call>")
+		if start < 0 || end < start {
+			t.Fatalf("forwarded datagram has no call: %s", output)
+		}
+		calls = append(calls, output[start+len("<call>"):end])
+	}
+
+	// Records are processed in order within the datagram
+	if strings.Join(calls, ",") != "G4ABC,F5XYZ,EA3A" {
+		t.Errorf("forwarded calls = %v", calls)
+	}
+}
+
+func TestTargetHeartbeat(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Heartbeat.Enabled = true
+		cfg.Heartbeat.Interval = 100 * time.Millisecond
+	})
+
+	// One heartbeat at startup and then one per interval
+	for i := 0; i < 2; i++ {
+		output, ok := h.receive(t, time.Second)
+		if !ok {
+			t.Fatalf("heartbeat %d not received", i+1)
+		}
+		for _, element := range []string{"<AppInfo>", "<app>N7AKG-UDP-Translator</app>", "<StationName>W1AW</StationName>", "<contestname>GENERAL</contestname>"} {
+			if !strings.Contains(output, element) {
+				t.Errorf("heartbeat missing %s: %s", element, output)
+			}
+		}
+	}
+
+	custom := startHarness(t, func(cfg *config.Config) {
+		cfg.Heartbeat.Enabled = true
+		cfg.Heartbeat.Interval = time.Minute
+		cfg.Heartbeat.Payload = "PING N7AKG"
+	})
+	if output, ok := custom.receive(t, time.Second); !ok || output != "PING N7AKG" {
+		t.Errorf("custom heartbeat = %q, %v", output, ok)
+	}
+}
+
+func TestSignedSources(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.Keys = []config.SourceKey{{Source: "127.0.0.1", Secret: "s3cret"}}
+		cfg.Auth.Trusted = nil
+		cfg.Auth.MaxSkew = time.Minute
+	})
+	packet := readPacket(t, "fldigi_adif.txt")
+
+	h.send(t, packet)
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("unsigned datagram should be dropped, got: %s", output)
+	}
+
+	h.send(t, auth.Sign(packet, "wrong", time.Now()))
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("badly signed datagram should be dropped, got: %s", output)
+	}
+
+	h.send(t, auth.Sign(packet, "s3cret", time.Now()))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>G4ABC</call>") {
+		t.Errorf("signed datagram was not relayed: %q", output)
+	}
+
+	stats := h.relay.GetStats()
+	if stats["auth_rejected_unsigned"] != uint64(1) || stats["auth_rejected_invalid"] != uint64(1) {
+		t.Errorf("rejection counters = %v unsigned, %v invalid", stats["auth_rejected_unsigned"], stats["auth_rejected_invalid"])
+	}
+}
+
+func TestRelayChaining(t *testing.T) {
+	central := startHarness(t, func(cfg *config.Config) {
+		cfg.Chain.NodeID = "central"
+		cfg.Chain.TCPListen = "127.0.0.1:0"
+	})
+	centralUDP := central.relay.ListenAddr().(*net.UDPAddr)
+	centralTCP := central.relay.ChainAddr().(*net.TCPAddr)
+
+	tests := []struct {
+		name     string
+		protocol string
+		port     int
+	}{
+		{"udp", "udp", centralUDP.Port},
+		{"tcp", "tcp", centralTCP.Port},
+	}
+
+	for _, test := range tests {
+		remote := startHarness(t, func(cfg *config.Config) {
+			cfg.Chain.NodeID = "site-" + test.name
+			cfg.Target = config.TargetConfig{Address: "127.0.0.1", Port: test.port, Format: "relay", Protocol: test.protocol}
+			cfg.Formatting.Overrides = []config.SourceOverride{{Operator: "N1XYZ"}}
+		})
+		remote.send(t, readPacket(t, "fldigi_adif.txt"))
+
+		// The central relay does the final N1MM formatting; the remote
+		// site's operator override travels with the QSO
+		output, ok := central.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatalf("%s: chained QSO not relayed by the central instance", test.name)
+		}
+		for _, element := range []string{"<call>G4ABC</call>", "<operator>N1XYZ</operator>", "<mode>PSK31</mode>"} {
+			if !strings.Contains(output, element) {
+				t.Errorf("%s: central output missing %s: %s", test.name, element, output)
+			}
+		}
+	}
+
+	// A QSO that has already passed through the central relay is dropped
+	loop := `{"n7akg_relay":1,"qso":{"callsign":"G4ABC","datetime":"2024-06-01T15:00:00Z","path":["central","site-udp"]}}`
+	central.send(t, []byte(loop))
+	if output, ok := central.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("looped QSO should be dropped, got: %s", output)
+	}
+}
+
+func TestRelayChainingOlderRelay(t *testing.T) {
+	// An older relay reads chained QSOs but never answers the hello
+	old, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	remote := startHarness(t, func(cfg *config.Config) {
+		cfg.Chain.NodeID = "site-north"
+		cfg.Target = config.TargetConfig{Address: "127.0.0.1", Port: old.Addr().(*net.TCPAddr).Port, Format: "relay", Protocol: "tcp"}
+	})
+	remote.send(t, readPacket(t, "fldigi_adif.txt"))
+
+	old.(*net.TCPListener).SetDeadline(time.Now().Add(2 * time.Second))
+	conn, err := old.Accept()
+	if err != nil {
+		t.Fatalf("remote relay did not connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	hello, err := reader.ReadString('\n')
+	if err != nil || !formatter.IsRelayHello(hello) {
+		t.Fatalf("expected a hello first, got %q, %v", hello, err)
+	}
+	envelope, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(envelope, `{"n7akg_relay":1,"qso":{"callsign":"G4ABC"`) {
+		t.Errorf("expected a version 1 envelope after no reply, got %q, %v", envelope, err)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	h := startHarness(t, nil)
+	sub := h.relay.Subscribe()
+	defer sub.Close()
+
+	next := func() events.Event {
+		t.Helper()
+		select {
+		case e := <-sub.Events():
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event")
+		}
+		return events.Event{}
+	}
+
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	e := next()
+	if e.Type != events.TypeQSO || e.QSO == nil || e.QSO.Callsign != "G4ABC" || e.QSO.ID == "" || e.Source != "fldigi" || e.Targets != 1 {
+		t.Errorf("expected a qso event for G4ABC, got %+v", e)
+	}
+
+	h.relay.Pause()
+	h.relay.Resume()
+	if e := next(); e.Type != events.TypePaused {
+		t.Errorf("expected paused, got %+v", e)
+	}
+	if e := next(); e.Type != events.TypeResumed {
+		t.Errorf("expected resumed, got %+v", e)
+	}
+
+	h.stop(t)
+	if e := next(); e.Type != events.TypeStopping {
+		t.Errorf("expected stopping, got %+v", e)
+	}
+}
+
+func TestTargetFraming(t *testing.T) {
+	// Length framing on a UDP target: one frame per datagram
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Target.Format = "adif"
+		cfg.Target.Framing = "length"
+	})
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	if len(output) < 4 || int(binary.BigEndian.Uint32([]byte(output))) != len(output)-4 || !strings.Contains(output, "<CALL:5>G4ABC") {
+		t.Errorf("expected a length-prefixed ADIF record, got %q", output)
+	}
+
+	// A consumer that isn't a relay reads lines over TCP with no hello
+	consumer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	h = startHarness(t, func(cfg *config.Config) {
+		cfg.Target = config.TargetConfig{Address: "127.0.0.1", Port: consumer.Addr().(*net.TCPAddr).Port, Format: "adif", Protocol: "tcp", Framing: "line"}
+	})
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+
+	consumer.(*net.TCPListener).SetDeadline(time.Now().Add(2 * time.Second))
+	conn, err := consumer.Accept()
+	if err != nil {
+		t.Fatalf("relay did not connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(line, "<CALL:5>G4ABC") || strings.Count(line, "\n") != 1 {
+		t.Errorf("expected one ADIF record per line, got %q, %v", line, err)
+	}
+}
+
+// writeCert creates a self-signed relay certificate in dir and returns its
+// paths and fingerprint
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile, fingerprint string) {
+	t.Helper()
+	certPEM, keyPEM, fingerprint, err := tlspeer.Generate(name, time.Hour)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, fingerprint
+}
+
+func TestRelayChainingTLS(t *testing.T) {
+	dir := t.TempDir()
+	centralCert, centralKey, centralFP := writeCert(t, dir, "central")
+	siteCert, siteKey, siteFP := writeCert(t, dir, "site-north")
+	strangerCert, strangerKey, _ := writeCert(t, dir, "stranger")
+
+	central := startHarness(t, func(cfg *config.Config) {
+		cfg.Chain.NodeID = "central"
+		cfg.Chain.TCPListen = "127.0.0.1:0"
+		cfg.Chain.TLS.Cert = centralCert
+		cfg.Chain.TLS.Key = centralKey
+		cfg.Chain.TLS.Fingerprints = []string{siteFP}
+	})
+	centralTLS := central.relay.ChainAddr().(*net.TCPAddr)
+
+	remote := func(name, cert, key string) *harness {
+		return startHarness(t, func(cfg *config.Config) {
+			cfg.Chain.NodeID = name
+			cfg.Chain.TLS.Cert = cert
+			cfg.Chain.TLS.Key = key
+			cfg.Chain.TLS.Fingerprints = []string{centralFP}
+			cfg.Target = config.TargetConfig{Address: "127.0.0.1", Port: centralTLS.Port, Format: "relay", Protocol: "tls"}
+		})
+	}
+
+	site := remote("site-north", siteCert, siteKey)
+	site.send(t, readPacket(t, "fldigi_adif.txt"))
+	if output, ok := central.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>G4ABC</call>") {
+		t.Fatalf("QSO chained over TLS not relayed: %q", output)
+	}
+
+	// A relay whose certificate the central relay hasn't pinned is refused
+	stranger := remote("stranger", strangerCert, strangerKey)
+	stranger.send(t, readPacket(t, "fldigi_adif.txt"))
+	if output, ok := central.receive(t, time.Second); ok {
+		t.Errorf("QSO from an untrusted relay should be refused, got: %s", output)
+	}
+	if rejected := central.relay.Stats().Dropped["auth_invalid"]; rejected == 0 {
+		t.Error("refused connection not counted as auth_invalid")
+	}
+}
+
+func TestRelayLoopMarker(t *testing.T) {
+	a := startHarness(t, func(cfg *config.Config) {
+		cfg.Chain.NodeID = "relay-a"
+	})
+	aPort := a.relay.ListenAddr().(*net.UDPAddr).Port
+	b := startHarness(t, func(cfg *config.Config) {
+		cfg.Chain.NodeID = "relay-b"
+		cfg.Targets = []config.TargetConfig{{Address: "127.0.0.1", Port: aPort, Format: "n1mm"}}
+	})
+	bPort := b.relay.ListenAddr().(*net.UDPAddr).Port
+
+	// Each relay sends N1MM XML to the other, as two relays on one LAN
+	// pointed at the broadcast address would
+	targets := append(a.relay.Targets(), config.TargetConfig{Address: "127.0.0.1", Port: bPort, Format: "n1mm"})
+	if err := a.relay.SetTargets(targets); err != nil {
+		t.Fatal(err)
+	}
+
+	a.send(t, readPacket(t, "fldigi_adif.txt"))
+	if output, ok := a.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<!-- X-Relay: relay-a -->") {
+		t.Fatalf("relay-a output missing its marker: %q", output)
+	}
+	if output, ok := b.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<!-- X-Relay: relay-a,relay-b -->") {
+		t.Fatalf("relay-b output missing the path: %q", output)
+	}
+
+	// relay-a drops the QSO relay-b sent back, so neither forwards it again
+	if output, ok := a.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("relay-a forwarded its own QSO again: %s", output)
+	}
+	if output, ok := b.receive(t, 100*time.Millisecond); ok {
+		t.Errorf("relay-b got the QSO again: %s", output)
+	}
+	if dropped := a.relay.Stats().Dropped["relay_loop"]; dropped != 1 {
+		t.Errorf("relay-a counted %d looped QSOs, want 1", dropped)
+	}
+}
+
+func TestParseFailureSamples(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Stats.ErrorSamples = 5
+		cfg.Listen.PreserveOrder = true // the failures are in before the QSO
+	})
+
+	// WSJT-X heartbeats never carry a QSO and are not kept
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+	h.send(t, []byte("fldigi log line without a callsign"))
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO not relayed")
+	}
+
+	failures := h.relay.ParseFailures()
+	if len(failures) != 1 {
+		t.Fatalf("expected one failure sample, got %+v", failures)
+	}
+	f := failures[0]
+	if f.Type != "fldigi" || f.Payload != "fldigi log line without a callsign" || f.Error == "" ||
+		f.Source != h.source.LocalAddr().String() {
+		t.Errorf("unexpected failure sample: %+v", f)
+	}
+}
+
+func TestStatsPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Stats.Path = path
+	})
+
+	h.send(t, readPacket(t, "fldigi_adif.txt"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO not relayed")
+	}
+	h.send(t, readPacket(t, "wsjtx_heartbeat.bin"))
+	h.receive(t, 300*time.Millisecond)
+
+	live := h.relay.Stats()
+	if live.Rates.QSOs1m != 1 {
+		t.Errorf("QSO rate = %v per minute, expected 1", live.Rates.QSOs1m)
+	}
+
+	// Counters are saved at shutdown and picked up by the next run
+	target := h.target.LocalAddr().String()
+	h.stop(t)
+
+	saved, err := stats.Load(path)
+	if err != nil {
+		t.Fatalf("stats not saved: %v", err)
+	}
+	if saved.Received["fldigi"] != 1 || saved.QSOs != 1 || saved.Forwarded[target] != 1 {
+		t.Errorf("unexpected saved counters: %+v", saved)
+	}
+	if len(saved.ParseFailures) == 0 {
+		t.Errorf("heartbeat should count as a parse failure: %+v", saved.ParseFailures)
+	}
+
+	restarted := startHarness(t, func(cfg *config.Config) {
+		cfg.Stats.Path = path
+	})
+	if got := restarted.relay.Stats(); got.QSOs != 1 || !got.Since.Equal(saved.Since) {
+		t.Errorf("counters not restored after restart: %+v", got)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	// A QSO the source held back for three minutes before broadcasting
+	qsoTime := time.Now().UTC().Add(-3 * time.Minute)
+	adif := fmt.Sprintf("<CALL:5>G4ABC<FREQ:6>7.0350<MODE:2>CW<QSO_DATE:8>%s<TIME_ON:6>%s<PROGRAM_ID:6>FLDIGI<EOR>",
+		qsoTime.Format("20060102"), qsoTime.Format("150405"))
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Stats.LatencyWarn = time.Minute
+	})
+	h.send(t, []byte(adif))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+
+	l, ok := h.relay.Stats().Latency["fldigi"]
+	if !ok || l.Count != 1 || l.Last < 175 || l.Last > 185 {
+		t.Errorf("expected one fldigi QSO about 180s late, got %+v", h.relay.Stats().Latency)
+	}
+}
+
+func TestVarACEvents(t *testing.T) {
+	beacon := []byte(`{"app":"VarAC","type":"beacon","call":"W1ABC","freq":"14.105","mode":"VARA HF"}`)
+
+	// By default beacons are dropped and counted
+	h := startHarness(t, nil)
+	h.send(t, beacon)
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Errorf("beacon should not be forwarded: %s", output)
+	}
+	if n := h.relay.Stats().Dropped["varac_beacon"]; n != 1 {
+		t.Errorf("expected one counted beacon, got %d", n)
+	}
+	if qsos := h.relay.Stats().QSOs; qsos != 0 {
+		t.Errorf("beacon counted as %d QSOs", qsos)
+	}
+
+	h = startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.VarAC.Events = "spot"
+	})
+	h.send(t, beacon)
+	output, ok := h.receive(t, 2*time.Second)
+	if !ok {
+		t.Fatal("beacon was not forwarded as a spot")
+	}
+	if !strings.Contains(output, "<spot>") || !strings.Contains(output, "<dxcall>W1ABC</dxcall>") {
+		t.Errorf("expected an N1MM spot: %s", output)
+	}
+	if qsos := h.relay.Stats().QSOs; qsos != 0 {
+		t.Errorf("spot counted as %d QSOs", qsos)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	h := startHarness(t, nil)
+
+	done := make(chan struct{})
+	go func() {
+		h.stop(t)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop after context cancel")
+	}
+}
+
+func TestPauseAndJournalReplay(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Journal.Path = journalPath
+	})
+
+	h.send(t, readPacket(t, "varac_json.txt"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+
+	// Paused relays read but don't forward
+	h.relay.Pause()
+	h.send(t, readPacket(t, "n1mm_contactinfo.xml"))
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("paused relay forwarded: %s", output)
+	}
+	h.relay.Resume()
+
+	count, err := h.relay.Replay(time.Time{})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 replayed QSO, got %d", count)
+	}
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>W1ABC</call>") {
+		t.Errorf("replayed QSO not received: %q", output)
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	var targets [2]*net.UDPConn
+	for i := range targets {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("failed to open target socket: %v", err)
+		}
+		defer conn.Close()
+		targets[i] = conn
+	}
+
+	cfg := testConfig(targets[0].LocalAddr().(*net.UDPAddr).Port)
+	pc := testConfig(targets[1].LocalAddr().(*net.UDPAddr).Port)
+	pc.Name = "digital"
+	pc.Formatting.N1MM.Contest = "ARRL-RTTY"
+	cfg.PipelineConfigs = []*config.Config{pc}
+
+	s, err := relay.NewSupervisor(cfg)
+	if err != nil {
+		t.Fatalf("relay.NewSupervisor failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Errorf("Run returned error: %v", err)
+		}
+	}()
+	select {
+	case <-s.Ready():
+	case err := <-errc:
+		t.Fatalf("supervisor failed to start: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not become ready")
+	}
+
+	// A QSO sent to the pipeline goes to its target only, with its formatting
+	source, err := net.DialUDP("udp", nil, s.Pipeline("digital").ListenAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err := source.Write(readPacket(t, "fldigi_adif.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	targets[1].SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := targets[1].Read(buf)
+	if err != nil {
+		t.Fatalf("pipeline target received nothing: %v", err)
+	}
+	if output := string(buf[:n]); !strings.Contains(output, "<contestname>ARRL-RTTY</contestname>") {
+		t.Errorf("pipeline formatting not used: %s", output)
+	}
+	targets[0].SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if n, err := targets[0].Read(buf); err == nil {
+		t.Errorf("main target received the pipeline's QSO: %s", buf[:n])
+	}
+
+	snap := s.Stats()
+	if snap.QSOs != 0 || snap.Pipelines["digital"].QSOs != 1 {
+		t.Errorf("expected the QSO counted for the pipeline only: main %d, pipelines %+v", snap.QSOs, snap.Pipelines)
+	}
+}
+
+func TestListenerRebind(t *testing.T) {
+	h := startHarness(t, nil)
+	addr := h.relay.ListenAddr().String()
+
+	// Closing the sockets underneath the read loops, as a network change
+	// does, makes the relay bind the same ports again
+	h.relay.Rebind()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Datagrams sent before the rebind completes are lost, and the
+		// port unreachable reports fail the next write
+		h.source.Write(readPacket(t, "fldigi_adif.txt"))
+		if _, ok := h.receive(t, 300*time.Millisecond); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no QSO relayed after the rebind")
+		}
+	}
+	if got := h.relay.ListenAddr().String(); got != addr {
+		t.Errorf("rebound on %s, want %s", got, addr)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	// Text messages one per line, without any sockets
+	r, err := relay.New(testConfig(0))
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	in := strings.NewReader("<call:5>K2ABC <mode:3>FT8 <qso_date:8>20240601 <time_on:6>142315 <freq:9>14.075123 <eor>\n\n" +
+		`<contactinfo><app>N1MM</app><timestamp>2024-06-01 15:00:00</timestamp><call>W9XYZ</call><band>14</band><rxfreq>1402500</rxfreq><mode>CW</mode></contactinfo>` + "\r\n")
+	var out bytes.Buffer
+	if err := r.RunStream(context.Background(), relay.Stream{In: in, Out: &out, Format: "adif"}); err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "<CALL:5>K2ABC") || !strings.Contains(lines[1], "<CALL:5>W9XYZ") {
+		t.Errorf("expected the two QSOs in order, got: %q", out.String())
+	}
+	if got := r.Stats().Forwarded["output"]; got != 2 {
+		t.Errorf("forwarded %d QSOs, want 2", got)
+	}
+
+	// Binary WSJT-X messages need length framing; the pair becomes one QSO
+	r, err = relay.New(testConfig(0))
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	var framed bytes.Buffer
+	relay.WriteFrame(&framed, relay.FramingLength, readPacket(t, "wsjtx_qso_logged.bin"))
+	relay.WriteFrame(&framed, relay.FramingLength, readPacket(t, "wsjtx_logged_adif.bin"))
+	out.Reset()
+	if err := r.RunStream(context.Background(), relay.Stream{In: &framed, Out: &out, Framing: relay.FramingLength}); err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	var size uint32
+	if err := binary.Read(&out, binary.BigEndian, &size); err != nil || int(size) != out.Len() {
+		t.Fatalf("expected one framed message, got %d bytes for %d (%v)", out.Len(), size, err)
+	}
+	if output := out.String(); !strings.Contains(output, "<call>K2ABC</call>") || !strings.Contains(output, "<comment>FD 73</comment>") {
+		t.Errorf("expected the merged QSO, got: %s", output)
+	}
+
+	// COBS frames carry binary messages too, and each output frame ends
+	// with the only zero byte in it
+	r, err = relay.New(testConfig(0))
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	framed.Reset()
+	relay.WriteFrame(&framed, relay.FramingCOBS, readPacket(t, "wsjtx_qso_logged.bin"))
+	relay.WriteFrame(&framed, relay.FramingCOBS, readPacket(t, "wsjtx_logged_adif.bin"))
+	out.Reset()
+	if err := r.RunStream(context.Background(), relay.Stream{In: &framed, Out: &out, Framing: relay.FramingCOBS}); err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	frame := out.Bytes()
+	if bytes.IndexByte(frame, 0) != len(frame)-1 {
+		t.Fatalf("expected one COBS frame, got %q", frame)
+	}
+	if output := string(decodeCOBS(t, frame[:len(frame)-1])); !strings.Contains(output, "<call>K2ABC</call>") || !strings.Contains(output, "<comment>FD 73</comment>") {
+		t.Errorf("expected the merged QSO, got: %s", output)
+	}
+
+	// A message longer than any datagram ends the stream with an error
+	r, err = relay.New(testConfig(0))
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	framed.Reset()
+	binary.Write(&framed, binary.BigEndian, uint32(1<<20))
+	if err := r.RunStream(context.Background(), relay.Stream{In: &framed, Out: io.Discard, Framing: relay.FramingLength}); err == nil {
+		t.Error("expected an error for an oversized frame")
+	}
+}
+
+func TestRunStreamReview(t *testing.T) {
+	// QSOs held for review are written out when the input ends, even with
+	// no timeout to release them
+	cfg := testConfig(0)
+	cfg.Review.Enabled = true
+	cfg.Review.Timeout = 0
+	r, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	in := strings.NewReader("<call:5>K2ABC <mode:3>FT8 <qso_date:8>20240601 <time_on:6>142315 <freq:9>14.075123 <eor>\n")
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- r.RunStream(context.Background(), relay.Stream{In: in, Out: &out, Format: "adif"}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RunStream failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunStream did not return at the end of its input")
+	}
+	if !strings.Contains(out.String(), "<CALL:5>K2ABC") {
+		t.Errorf("held QSO not written at the end of the input: %q", out.String())
+	}
+}
+
+// decodeCOBS undoes COBS encoding of one frame without its zero byte
+func decodeCOBS(t *testing.T, frame []byte) []byte {
+	t.Helper()
+	var out []byte
+	for len(frame) > 0 {
+		code := int(frame[0])
+		if code == 0 || code > len(frame) {
+			t.Fatalf("bad COBS frame: %q", frame)
+		}
+		out = append(out, frame[1:code]...)
+		frame = frame[code:]
+		if code < 0xFF && len(frame) > 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func TestConsole(t *testing.T) {
+	h := startHarness(t, nil)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	h.relay.SetConsole(logging.NewConsole(pw, false))
+
+	lines := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	h.send(t, readPacket(t, "wsjtx_logged_adif.bin"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	select {
+	case line := <-lines:
+		for _, field := range []string{"K2ABC", "20m", "FT8", "wsjt-x", "✓ " + h.target.LocalAddr().String()} {
+			if !strings.Contains(line, field) {
+				t.Errorf("console line missing %q: %s", field, line)
+			}
+		}
+		if strings.Contains(line, "\x1b[") {
+			t.Errorf("console line colored with colors off: %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no console line for the QSO")
+	}
+}
+
+func TestScoring(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Scoring.Contest = "auto"
+		cfg.Formatting.N1MM.Contest = "ARRL-FD"
+	})
+
+	// CW and digital QSOs are 2 points; a dupe is worth nothing
+	packet := readPacket(t, "wsjtx_logged_adif.bin")
+	for _, points := range []string{"2", "0"} {
+		h.send(t, packet)
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			t.Fatal("QSO was not forwarded")
+		}
+		if !strings.Contains(output, "<points>"+points+"</points>") || !strings.Contains(output, "<ismultiplier1>0</ismultiplier1>") {
+			t.Errorf("expected %s points and no multiplier: %s", points, output)
+		}
+	}
+}
+
+func TestRotator(t *testing.T) {
+	// A stand-in rotctld that acknowledges every command
+	rotctld, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start rotctld: %v", err)
+	}
+	defer rotctld.Close()
+	commands := make(chan string, 10)
+	go func() {
+		conn, err := rotctld.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+			conn.Write([]byte("RPRT 0\n"))
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case cmd := <-commands:
+			if cmd != want {
+				t.Errorf("rotctld got %q, want %q", cmd, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("rotctld got nothing, want %q", want)
+		}
+	}
+
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Control.Grid = "FN31"
+		cfg.Rotator.Enabled = true
+		cfg.Rotator.Address = rotctld.Addr().String()
+		cfg.Rotator.InProgress = true
+	})
+
+	h.send(t, []byte("<CALL:5>G4ABC<FREQ:6>14.070<MODE:5>PSK31<GRIDSQUARE:4>IO91<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if _, ok := h.receive(t, 2*time.Second); !ok {
+		t.Fatal("QSO was not forwarded")
+	}
+	expect("P 52.2 0")
+
+	// WSJT-X calling a JA station: Status with the DX call and grid
+	appendUTF8 := func(buf []byte, s string) []byte {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+		return append(buf, s...)
+	}
+	status := statusMessage("WSJT-X", 14074000, "FT8")
+	for _, s := range []string{"JA1ABC", "", "FT8"} {
+		status = appendUTF8(status, s)
+	}
+	status = append(status, 1, 0, 0)
+	status = binary.BigEndian.AppendUint32(status, 1500)
+	status = binary.BigEndian.AppendUint32(status, 1500)
+	for _, s := range []string{"W1AW", "FN31", "PM95"} {
+		status = appendUTF8(status, s)
+	}
+	h.send(t, status)
+	expect("P 334.2 0")
+}
+
+func TestCallsignRouting(t *testing.T) {
+	club, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open club target: %v", err)
+	}
+	defer club.Close()
+
+	// The main target takes W1AW/7's QSOs, the second the club call's
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.N1MM.Station = "W1AW/7"
+		cfg.Target.MyCalls = []string{"w1aw/7"}
+		cfg.Targets = []config.TargetConfig{{
+			Address: "127.0.0.1",
+			Port:    club.LocalAddr().(*net.UDPAddr).Port,
+			Format:  "adif",
+			MyCalls: []string{"K7C"},
+		}}
+	})
+	receiveClub := func(d time.Duration) (string, bool) {
+		buf := make([]byte, 4096)
+		club.SetReadDeadline(time.Now().Add(d))
+		n, _, err := club.ReadFromUDP(buf)
+		return string(buf[:n]), err == nil
+	}
+
+	h.send(t, []byte(`<contactinfo app="N1MM Logger Plus"><mycall>K7C</mycall><call>G4ABC</call><band>14</band><mode>CW</mode></contactinfo>`))
+	if output, ok := receiveClub(2 * time.Second); !ok || !strings.Contains(output, "<CALL:5>G4ABC") {
+		t.Errorf("club call's QSO not sent to its target: %q", output)
+	}
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Errorf("club call's QSO sent to the main target: %s", output)
+	}
+
+	// Without a call from the source, the configured station routes it
+	h.send(t, []byte("<CALL:5>K2XYZ<MODE:5>PSK31<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<call>K2XYZ</call>") {
+		t.Errorf("station's QSO not sent to the main target: %q", output)
+	}
+	if output, ok := receiveClub(300 * time.Millisecond); ok {
+		t.Errorf("station's QSO sent to the club target: %s", output)
+	}
+
+	h.send(t, []byte("<CALL:5>K2XYZ<MODE:5>PSK31<STATION_CALLSIGN:4>N7XX<PROGRAM_ID:6>FLDIGI<EOR>"))
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Errorf("QSO under another call was sent: %s", output)
+	}
+	if dropped := h.relay.Stats().Dropped["no_route"]; dropped != 1 {
+		t.Errorf("counted %d unrouted QSOs, want 1", dropped)
+	}
+}
+
+func TestJS8CallDirectedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "js8.csv")
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Messages.Path = path
+	})
+
+	h.send(t, []byte(`{"type":"RX.DIRECTED","value":"K1ABC: @HB HEARTBEAT FN42","params":{"FROM":"K1ABC","TO":"@HB","CMD":" HEARTBEAT","GRID":" FN42","FREQ":7079500,"SNR":-5}}`))
+	h.send(t, []byte(`{"type":"RX.DIRECTED","value":"K1ABC: N7AKG MSG HELLO ♢","params":{"FROM":"K1ABC","TO":"N7AKG","CMD":" MSG","FREQ":7079500,"SNR":-12,"TEXT":"K1ABC: N7AKG MSG HELLO ♢"}}`))
+
+	// Directed messages are kept, not forwarded as QSOs
+	if output, ok := h.receive(t, 500*time.Millisecond); ok {
+		t.Errorf("directed message forwarded: %s", output)
+	}
+	var messages []formatter.JS8Message
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && (len(messages) == 0 || h.relay.Stats().Dropped["js8call_heartbeat"] == 0) {
+		time.Sleep(20 * time.Millisecond)
+		messages, _ = h.relay.Messages(10, time.Time{}, "N7AKG")
+	}
+	if len(messages) != 1 || messages[0].Text != "K1ABC: N7AKG MSG HELLO" {
+		t.Errorf("message log holds %+v", messages)
+	}
+	if dropped := h.relay.Stats().Dropped["js8call_heartbeat"]; dropped != 1 {
+		t.Errorf("counted %d dropped heartbeats, want 1", dropped)
+	}
+	if qsos := h.relay.Stats().QSOs; qsos != 0 {
+		t.Errorf("counted %d QSOs, want 0", qsos)
+	}
+}
+
+func TestBandChangeRadioInfo(t *testing.T) {
+	h := startHarness(t, func(cfg *config.Config) {
+		cfg.Formatting.N1MM.BandChanges = true
+	})
+
+	// WSJT-X moving to 20m moves N1MM's band map; staying there doesn't
+	h.send(t, statusMessage("WSJT-X", 14074000, "FT8"))
+	if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<RadioInfo>") ||
+		!strings.Contains(output, "<Freq>1407400</Freq>") || !strings.Contains(output, "<Mode>USB</Mode>") {
+		t.Errorf("expected RadioInfo for 20m, got %q", output)
+	}
+	h.send(t, statusMessage("WSJT-X", 14076000, "FT8"))
+	if output, ok := h.receive(t, 300*time.Millisecond); ok {
+		t.Errorf("RadioInfo sent without a band change: %s", output)
+	}
+
+	// A QSO on 40m is followed by RadioInfo for 40m
+	h.send(t, []byte("<CALL:5>K2XYZ<MODE:2>CW<FREQ:5>7.030<PROGRAM_ID:6>FLDIGI<EOR>"))
+	var radioInfo string
+	for i := 0; i < 2; i++ {
+		output, ok := h.receive(t, 2*time.Second)
+		if !ok {
+			break
+		}
+		if strings.Contains(output, "<RadioInfo>") {
+			radioInfo = output
+		}
+	}
+	if !strings.Contains(radioInfo, "<Freq>703000</Freq>") || !strings.Contains(radioInfo, "<Mode>CW</Mode>") {
+		t.Errorf("expected RadioInfo for 40m, got %q", radioInfo)
+	}
+}
+
+func TestN1MMBroadcasts(t *testing.T) {
+	radioInfo := `<?xml version="1.0" encoding="utf-8"?><RadioInfo><app>N1MM</app><StationName>RUN</StationName><RadioNr>1</RadioNr><Freq>1402530</Freq><Mode>CW</Mode></RadioInfo>`
+	spot := `<?xml version="1.0" encoding="utf-8"?><spot><app>N1MM</app><dxcall>G4ABC</dxcall><frequency>14025.3</frequency><spottercall>K1TTT</spottercall><action>add</action><mode>CW</mode></spot>`
+	score := `<?xml version="1.0" encoding="utf-8"?><dynamicresults><contest>CQ-WW-CW</contest><call>N7AKG</call><score>12345</score></dynamicresults>`
+
+	t.Run("ignored by default", func(t *testing.T) {
+		h := startHarness(t, func(cfg *config.Config) {})
+		h.send(t, []byte(radioInfo))
+		h.send(t, []byte(score))
+		if output, ok := h.receive(t, 500*time.Millisecond); ok {
+			t.Errorf("N1MM broadcast forwarded: %s", output)
+		}
+		snapshot := h.relay.Stats()
+		if snapshot.Dropped["n1mm_radioinfo"] != 1 || snapshot.Dropped["n1mm_score"] != 1 {
+			t.Errorf("dropped %v, want one n1mm_radioinfo and one n1mm_score", snapshot.Dropped)
+		}
+		if len(snapshot.ParseFailures) != 0 {
+			t.Errorf("N1MM broadcasts counted as parse failures: %v", snapshot.ParseFailures)
+		}
+	})
+
+	t.Run("convert and pass", func(t *testing.T) {
+		h := startHarness(t, func(cfg *config.Config) {
+			cfg.Formatting.N1MMBroadcasts.Spot = "convert"
+			cfg.Formatting.N1MMBroadcasts.Score = "pass"
+		})
+		h.send(t, []byte(spot))
+		if output, ok := h.receive(t, 2*time.Second); !ok || !strings.Contains(output, "<dxcall>G4ABC</dxcall>") ||
+			!strings.Contains(output, "<frequency>14025.3</frequency>") || strings.Contains(output, "<spottercall>K1TTT</spottercall>") {
+			t.Errorf("expected the spot relayed under this station, got %q", output)
+		}
+		h.send(t, []byte(score))
+		if output, ok := h.receive(t, 2*time.Second); !ok || output != score {
+			t.Errorf("expected the score passed unchanged, got %q", output)
+		}
+	})
+
+	t.Run("posted to scoreboards", func(t *testing.T) {
+		posts := make(chan string, 4)
+		board := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			posts <- req.FormValue("xml")
+		}))
+		defer board.Close()
+
+		h := startHarness(t, func(cfg *config.Config) {
+			cfg.Scoreboard.Enabled = true
+			cfg.Scoreboard.Boards = []string{board.URL}
+			cfg.Scoreboard.Interval = 50 * time.Millisecond
+		})
+		h.send(t, []byte(score))
+		select {
+		case posted := <-posts:
+			if posted != score {
+				t.Errorf("expected the score posted unchanged, got %q", posted)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("score not posted")
+		}
+		if dropped := h.relay.Stats().Dropped["n1mm_score"]; dropped != 0 {
+			t.Errorf("posted score counted as dropped %d times", dropped)
+		}
+	})
+}
+
+func TestDedup(t *testing.T) {
+	qso := []byte("<CALL:5>K2XYZ<MODE:2>CW<FREQ:5>7.030<PROGRAM_ID:6>FLDIGI<EOR>")
+
+	for _, scope := range []string{"relay", "target"} {
+		t.Run("repeat dropped with scope "+scope, func(t *testing.T) {
+			h := startHarness(t, func(cfg *config.Config) {
+				cfg.Dedup.Enabled = true
+				cfg.Dedup.Window = time.Minute
+				cfg.Dedup.Fields = []string{"callsign", "band", "mode"}
+				cfg.Dedup.Scope = scope
+			})
+			h.send(t, qso)
+			if _, ok := h.receive(t, 2*time.Second); !ok {
+				t.Fatal("first QSO not forwarded")
+			}
+			h.send(t, qso)
+			if output, ok := h.receive(t, 500*time.Millisecond); ok {
+				t.Errorf("repeat forwarded: %s", output)
+			}
+			h.send(t, []byte("<CALL:5>K2XYZ<MODE:2>CW<FREQ:6>14.030<PROGRAM_ID:6>FLDIGI<EOR>"))
+			if _, ok := h.receive(t, 2*time.Second); !ok {
+				t.Error("QSO on another band not forwarded")
+			}
+			snapshot := h.relay.Stats()
+			if snapshot.Duplicates["fldigi"] != 1 || snapshot.Dropped["duplicate"] != 1 {
+				t.Errorf("duplicates %v, dropped %v; want one fldigi duplicate dropped", snapshot.Duplicates, snapshot.Dropped)
+			}
+		})
+	}
+
+	for _, scope := range []string{"relay", "target"} {
+		t.Run("concurrent burst with scope "+scope, func(t *testing.T) {
+			// Workers handling the same repeat at once forward it only once.
+			// Waiting for a reply keeps each send going long enough for the
+			// others to reach the target.
+			h := startHarness(t, func(cfg *config.Config) {
+				cfg.Listen.Workers = 8
+				cfg.Target.ResponseTimeout = 200 * time.Millisecond
+				cfg.Dedup.Enabled = true
+				cfg.Dedup.Window = time.Minute
+				cfg.Dedup.Fields = []string{"callsign", "band", "mode"}
+				cfg.Dedup.Scope = scope
+			})
+			const burst = 20
+			var wg sync.WaitGroup
+			for i := 0; i < burst; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := h.source.Write(qso); err != nil {
+						t.Errorf("failed to send datagram: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if _, ok := h.receive(t, 2*time.Second); !ok {
+				t.Fatal("QSO not forwarded")
+			}
+			if output, ok := h.receive(t, 500*time.Millisecond); ok {
+				t.Errorf("repeat forwarded: %s", output)
+			}
+			snapshot := h.relay.Stats()
+			if snapshot.Duplicates["fldigi"] != burst-1 {
+				t.Errorf("duplicates %v; want %d fldigi duplicates", snapshot.Duplicates, burst-1)
+			}
+		})
+	}
+
+	t.Run("let through by source type", func(t *testing.T) {
+		h := startHarness(t, func(cfg *config.Config) {
+			cfg.Dedup.Enabled = true
+			cfg.Dedup.Window = time.Minute
+			cfg.Dedup.Fields = []string{"callsign", "band", "mode"}
+			cfg.Dedup.Rules = []config.DedupRule{{Type: "fldigi", Window: 0}}
+		})
+		for i := 0; i < 2; i++ {
+			h.send(t, qso)
+			if _, ok := h.receive(t, 2*time.Second); !ok {
+				t.Fatalf("QSO %d not forwarded", i+1)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package integration
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+// pileupBurst is how many QSOs arrive back to back, roughly what a fox logs
+// in one FT8 cycle during a busy DXpedition
+const pileupBurst = 50
+
+// pileupMaxInFlight is the size of the relay's worker pool
+const pileupMaxInFlight = 64
+
+// startPileupHarness starts a relay in performance mode. The per-QSO log
+// lines are discarded so they don't dominate the measurement.
+func startPileupHarness(tb testing.TB) *harness {
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	h := startHarness(tb, func(cfg *config.Config) {
+		cfg.Performance.Enabled = true
+		cfg.Performance.MaxInFlight = pileupMaxInFlight
+		cfg.Performance.SocketBuffer = 4 << 20
+		cfg.Performance.SendQueue = 1024
+	})
+	h.target.SetReadBuffer(4 << 20)
+	return h
+}
+
+// counter tracks datagrams arriving at the target
+type counter struct {
+	received atomic.Int64
+	last     atomic.Int64 // UnixNano of the latest datagram
+	done     chan struct{}
+}
+
+// count reads from the target in the background until want datagrams have
+// arrived or nothing has arrived for a second
+func (h *harness) count(want int) *counter {
+	c := &counter{done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		buf := make([]byte, 65536)
+		for c.received.Load() < int64(want) {
+			h.target.SetReadDeadline(time.Now().Add(time.Second))
+			if _, _, err := h.target.ReadFromUDP(buf); err != nil {
+				return
+			}
+			c.last.Store(time.Now().UnixNano())
+			c.received.Add(1)
+		}
+	}()
+	return c
+}
+
+// pileup sends total copies of payload in bursts. Each burst is sent without
+// pause; the next one starts once the previous burst has been relayed, so the
+// relay always has a full burst to work through. afterBurst, if set, runs
+// after each burst has been sent.
+func (h *harness) pileup(tb testing.TB, c *counter, payload []byte, total int, afterBurst func()) {
+	tb.Helper()
+	for sent := 0; sent < total; {
+		n := pileupBurst
+		if total-sent < n {
+			n = total - sent
+		}
+		for i := 0; i < n; i++ {
+			h.send(tb, payload)
+		}
+		if afterBurst != nil {
+			afterBurst()
+		}
+
+		previous := int64(sent)
+		sent += n
+		deadline := time.Now().Add(2 * time.Second)
+		for c.received.Load() < previous {
+			if time.Now().After(deadline) {
+				tb.Fatalf("relay stalled: %d of %d QSOs relayed", c.received.Load(), sent)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+}
+
+func TestPileupThroughput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("throughput test skipped in short mode")
+	}
+
+	const total = 2000
+	payload := readPacket(t, "wsjtx_logged_adif.bin")
+	h := startPileupHarness(t)
+
+	baseline := runtime.NumGoroutine()
+	peak := baseline
+	c := h.count(total)
+
+	start := time.Now()
+	h.pileup(t, c, payload, total, func() {
+		if n := runtime.NumGoroutine(); n > peak {
+			peak = n
+		}
+	})
+	<-c.done
+
+	received := c.received.Load()
+	if received != total {
+		t.Fatalf("relayed %d of %d QSOs", received, total)
+	}
+
+	elapsed := time.Unix(0, c.last.Load()).Sub(start)
+	rate := float64(received) / elapsed.Seconds()
+	t.Logf("relayed %d QSOs in %v (%.0f msgs/sec), peak %d goroutines", received, elapsed, rate, peak)
+	if rate < 1000 {
+		t.Errorf("throughput %.0f msgs/sec, want at least 1000", rate)
+	}
+
+	// One goroutine per worker plus the counter; anything beyond that means
+	// bursts are spawning unbounded work
+	if limit := baseline + pileupMaxInFlight + 8; peak > limit {
+		t.Errorf("peak of %d goroutines exceeds %d", peak, limit)
+	}
+}
+
+func BenchmarkRelayThroughput(b *testing.B) {
+	payload := readPacket(b, "wsjtx_logged_adif.bin")
+	h := startPileupHarness(b)
+	c := h.count(b.N)
+
+	b.ResetTimer()
+	start := time.Now()
+	h.pileup(b, c, payload, b.N, nil)
+	<-c.done
+	b.StopTimer()
+
+	if received := c.received.Load(); received > 0 {
+		elapsed := time.Unix(0, c.last.Load()).Sub(start)
+		b.ReportMetric(float64(received)/elapsed.Seconds(), "msgs/s")
+	}
+}
@@ -0,0 +1,213 @@
+package activity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the summary window and digest settings
+type Config struct {
+	Window         time.Duration // How far back summaries look
+	DigestInterval time.Duration // Time between digests; 0 disables them
+	WebhookURL     string        // Digests are POSTed here as JSON; empty only logs them
+}
+
+// CQ is a station heard calling CQ
+type CQ struct {
+	Call string
+	Grid string
+	Band string
+	Mode string
+	SNR  int
+	Time time.Time
+}
+
+// Band summarizes the CQs heard on one band and mode
+type Band struct {
+	Band    string    `json:"band"`
+	Mode    string    `json:"mode"`
+	CQs     int       `json:"cqs"`
+	Calls   int       `json:"calls"` // Distinct stations
+	BestSNR int       `json:"best_snr"`
+	Last    time.Time `json:"last"`
+}
+
+// Digest is the band activity over the window ending at Time, busiest
+// band first
+type Digest struct {
+	Time   time.Time `json:"time"`
+	Window string    `json:"window"`
+	Bands  []Band    `json:"bands"`
+	Text   string    `json:"text"`
+}
+
+// source is the band and mode a decoding program is on
+type source struct {
+	band, mode string
+}
+
+// Tracker aggregates the CQ calls decoded by WSJT-X instances
+type Tracker struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	sources map[string]source
+	cqs     []CQ // Oldest first
+}
+
+// New creates a tracker. A zero window summarizes the last 15 minutes.
+func New(cfg Config) *Tracker {
+	if cfg.Window <= 0 {
+		cfg.Window = 15 * time.Minute
+	}
+	return &Tracker{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		sources: make(map[string]source),
+	}
+}
+
+// SetBand records the band and mode a decoding program (e.g. a WSJT-X
+// instance id) is on, from its status messages
+func (t *Tracker) SetBand(id, band, mode string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sources[id] = source{band: band, mode: mode}
+}
+
+// Heard records a CQ decoded by a program. CQs from programs whose band is
+// not known yet are ignored.
+func (t *Tracker) Heard(id, call, grid string, snr int, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	src, ok := t.sources[id]
+	if !ok || src.band == "" {
+		return
+	}
+	t.cqs = append(t.cqs, CQ{Call: call, Grid: grid, Band: src.band, Mode: src.mode, SNR: snr, Time: at})
+	t.prune(at)
+}
+
+// prune drops CQs older than the window. The caller holds t.mu.
+func (t *Tracker) prune(now time.Time) {
+	cutoff := now.Add(-t.cfg.Window)
+	i := sort.Search(len(t.cqs), func(i int) bool { return t.cqs[i].Time.After(cutoff) })
+	if i > 0 {
+		t.cqs = append(t.cqs[:0], t.cqs[i:]...)
+	}
+}
+
+// Summary returns the activity per band and mode over the window ending at
+// now, busiest first
+func (t *Tracker) Summary(now time.Time) []Band {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+
+	type key struct{ band, mode string }
+	bands := make(map[key]*Band)
+	calls := make(map[key]map[string]bool)
+	for _, cq := range t.cqs {
+		k := key{cq.Band, cq.Mode}
+		b, ok := bands[k]
+		if !ok {
+			b = &Band{Band: cq.Band, Mode: cq.Mode, BestSNR: cq.SNR}
+			bands[k] = b
+			calls[k] = make(map[string]bool)
+		}
+		b.CQs++
+		calls[k][cq.Call] = true
+		if cq.SNR > b.BestSNR {
+			b.BestSNR = cq.SNR
+		}
+		b.Last = cq.Time
+	}
+
+	summary := make([]Band, 0, len(bands))
+	for k, b := range bands {
+		b.Calls = len(calls[k])
+		summary = append(summary, *b)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].CQs != summary[j].CQs {
+			return summary[i].CQs > summary[j].CQs
+		}
+		return summary[i].Band+summary[i].Mode < summary[j].Band+summary[j].Mode
+	})
+	return summary
+}
+
+// Digest summarizes the activity over the window ending at now
+func (t *Tracker) Digest(now time.Time) Digest {
+	d := Digest{Time: now.UTC(), Window: t.cfg.Window.String(), Bands: t.Summary(now)}
+
+	if len(d.Bands) == 0 {
+		d.Text = fmt.Sprintf("Band activity, last %s: no CQs heard", t.cfg.Window)
+		return d
+	}
+	parts := make([]string, len(d.Bands))
+	for i, b := range d.Bands {
+		parts[i] = fmt.Sprintf("%s %s %d CQs from %d stations (best %+d dB)", b.Band, b.Mode, b.CQs, b.Calls, b.BestSNR)
+	}
+	d.Text = fmt.Sprintf("Band activity, last %s: %s", t.cfg.Window, strings.Join(parts, ", "))
+	return d
+}
+
+// Run logs a digest, and posts it to the webhook, every DigestInterval until
+// ctx is cancelled
+func (t *Tracker) Run(ctx context.Context) {
+	if t.cfg.DigestInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(t.cfg.DigestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d := t.Digest(now)
+			log.Print(d.Text)
+			if t.cfg.WebhookURL == "" {
+				continue
+			}
+			if err := t.post(ctx, d); err != nil {
+				log.Printf("Failed to post band activity digest: %v", err)
+			}
+		}
+	}
+}
+
+// post sends a digest to the webhook as JSON
+func (t *Tracker) post(ctx context.Context, d Digest) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	tracker := New(Config{Window: 10 * time.Minute})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing counts until the instance's band is known
+	tracker.Heard("WSJT-X", "K1ABC", "FN42", -3, start)
+
+	tracker.SetBand("WSJT-X", "20m", "FT8")
+	tracker.SetBand("WSJT-X - 40m", "40m", "FT8")
+	tracker.Heard("WSJT-X", "K1ABC", "FN42", -10, start)
+	tracker.Heard("WSJT-X", "K1ABC", "FN42", -8, start.Add(15*time.Second))
+	tracker.Heard("WSJT-X", "JA1XYZ", "PM95", -20, start.Add(30*time.Second))
+	tracker.Heard("WSJT-X - 40m", "W1AW", "FN31", +5, start.Add(45*time.Second))
+
+	bands := tracker.Summary(start.Add(time.Minute))
+	if len(bands) != 2 {
+		t.Fatalf("expected 2 bands, got %+v", bands)
+	}
+	if b := bands[0]; b.Band != "20m" || b.Mode != "FT8" || b.CQs != 3 || b.Calls != 2 || b.BestSNR != -8 {
+		t.Errorf("20m summary = %+v", b)
+	}
+	if b := bands[1]; b.Band != "40m" || b.CQs != 1 || b.BestSNR != 5 {
+		t.Errorf("40m summary = %+v", b)
+	}
+
+	// CQs drop out of the window
+	bands = tracker.Summary(start.Add(10*time.Minute + 20*time.Second))
+	if len(bands) != 2 || bands[0].CQs != 1 || bands[1].CQs != 1 {
+		t.Errorf("expected one CQ per band after the window moved, got %+v", bands)
+	}
+
+	d := tracker.Digest(start.Add(time.Hour))
+	if len(d.Bands) != 0 || d.Text != "Band activity, last 10m0s: no CQs heard" {
+		t.Errorf("empty digest = %+v", d)
+	}
+}
+
+func TestDigestWebhook(t *testing.T) {
+	received := make(chan Digest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var d Digest
+		if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+			t.Errorf("invalid digest: %v", err)
+		}
+		select {
+		case received <- d:
+		default:
+		}
+	}))
+	defer server.Close()
+
+	tracker := New(Config{DigestInterval: 10 * time.Millisecond, WebhookURL: server.URL})
+	tracker.SetBand("WSJT-X", "20m", "FT8")
+	tracker.Heard("WSJT-X", "K1ABC", "FN42", -10, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tracker.Run(ctx)
+
+	select {
+	case d := <-received:
+		if len(d.Bands) != 1 || !strings.Contains(d.Text, "20m FT8 1 CQs from 1 stations (best -10 dB)") {
+			t.Errorf("digest = %+v", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no digest posted")
+	}
+}
@@ -0,0 +1,314 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event names an alert rule
+type Event string
+
+// Alert rules
+const (
+	EventNewDXCC           Event = "new_dxcc"           // first QSO with a DXCC entity
+	EventParseFailures     Event = "parse_failures"     // parse failures per minute above the limit
+	EventTargetUnreachable Event = "target_unreachable" // consecutive send failures to a target
+	EventNoPackets         Event = "no_packets"         // no source packets within the watchdog timeout
+)
+
+// events are the known alert rules
+var events = map[Event]bool{
+	EventNewDXCC:           true,
+	EventParseFailures:     true,
+	EventTargetUnreachable: true,
+	EventNoPackets:         true,
+}
+
+// Alert is one notification
+type Alert struct {
+	Event Event
+	Title string
+	Text  string
+}
+
+// Config holds the alert rules and where alerts are sent
+type Config struct {
+	Events                 []Event       // Rules to enable; empty enables all
+	ParseFailuresPerMinute int           // Parse failures in a minute that raise an alert
+	TargetFailures         int           // Consecutive send failures before a target is unreachable
+	Cooldown               time.Duration // Minimum time between repeats of the same alert
+	Notifiers              []Notifier
+}
+
+// Manager applies the alert rules to relay events and sends the resulting
+// alerts to every notifier
+type Manager struct {
+	cfg    Config
+	events map[Event]bool
+	alerts chan Alert
+	now    func() time.Time
+
+	mu       sync.Mutex
+	entities map[string]bool      // DXCC entities worked
+	failures []time.Time          // parse failures in the last minute
+	targets  map[string]*target   // consecutive failures per target
+	last     map[string]time.Time // last time each alert was sent
+	silent   bool                 // a no packets alert was raised
+}
+
+// target tracks the send failures of one target
+type target struct {
+	failures    int
+	succeeded   bool // the last send worked
+	unreachable bool
+}
+
+// NewManager creates an alert manager. It does not send anything until Run
+// is called.
+func NewManager(cfg Config) (*Manager, error) {
+	if len(cfg.Notifiers) == 0 {
+		return nil, fmt.Errorf("alerts: no notifier configured (desktop, telegram or discord)")
+	}
+	if cfg.ParseFailuresPerMinute <= 0 {
+		cfg.ParseFailuresPerMinute = 10
+	}
+	if cfg.TargetFailures <= 0 {
+		cfg.TargetFailures = 3
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 15 * time.Minute
+	}
+
+	enabled := make(map[Event]bool)
+	for _, e := range cfg.Events {
+		if !events[e] {
+			return nil, fmt.Errorf("alerts: unknown event %q", e)
+		}
+		enabled[e] = true
+	}
+	if len(enabled) == 0 {
+		enabled = events
+	}
+
+	return &Manager{
+		cfg:      cfg,
+		events:   enabled,
+		alerts:   make(chan Alert, 16),
+		now:      time.Now,
+		entities: make(map[string]bool),
+		targets:  make(map[string]*target),
+		last:     make(map[string]time.Time),
+	}, nil
+}
+
+// Enabled reports whether an alert rule is on
+func (m *Manager) Enabled(e Event) bool {
+	return m.events[e]
+}
+
+// Worked records a DXCC entity worked before the relay started, e.g. from
+// the journal, without raising an alert
+func (m *Manager) Worked(entity string) {
+	if entity == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entities[entity] = true
+}
+
+// QSO raises an alert the first time a DXCC entity is worked
+func (m *Manager) QSO(call, entity string) {
+	if !m.events[EventNewDXCC] || entity == "" {
+		return
+	}
+
+	m.mu.Lock()
+	seen := m.entities[entity]
+	m.entities[entity] = true
+	m.mu.Unlock()
+
+	if !seen {
+		m.raise("", Alert{
+			Event: EventNewDXCC,
+			Title: "New DXCC: " + entity,
+			Text:  fmt.Sprintf("%s is the first QSO with %s", call, entity),
+		})
+	}
+}
+
+// ParseFailed counts a message that could not be parsed and raises an
+// alert when the count over the last minute passes the limit
+func (m *Manager) ParseFailed() {
+	if !m.events[EventParseFailures] {
+		return
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(m.failures) && !m.failures[i].After(cutoff) {
+		i++
+	}
+	m.failures = append(m.failures[i:], now)
+	count := len(m.failures)
+	m.mu.Unlock()
+
+	if count >= m.cfg.ParseFailuresPerMinute {
+		m.raise(string(EventParseFailures), Alert{
+			Event: EventParseFailures,
+			Title: "Parse failures",
+			Text:  fmt.Sprintf("%d messages could not be parsed in the last minute", count),
+		})
+	}
+}
+
+// TargetFailed counts a failed send to a target and raises an alert once
+// the failures in a row reach the limit. A UDP socket only reports a refused
+// port on the send after the one that triggered it, so a single success
+// between failures doesn't break the run.
+func (m *Manager) TargetFailed(addr string, err error) {
+	if !m.events[EventTargetUnreachable] {
+		return
+	}
+
+	m.mu.Lock()
+	t := m.targets[addr]
+	if t == nil {
+		t = &target{}
+		m.targets[addr] = t
+	}
+	t.failures++
+	t.succeeded = false
+	report := t.failures == m.cfg.TargetFailures
+	if report {
+		t.unreachable = true
+	}
+	m.mu.Unlock()
+
+	if report {
+		m.raise(string(EventTargetUnreachable)+" "+addr, Alert{
+			Event: EventTargetUnreachable,
+			Title: "Target unreachable: " + addr,
+			Text:  fmt.Sprintf("%d sends to %s failed: %v", m.cfg.TargetFailures, addr, err),
+		})
+	}
+}
+
+// TargetOK records a successful send to a target. Two in a row end a run
+// of failures and report the recovery of an unreachable target.
+func (m *Manager) TargetOK(addr string) {
+	if !m.events[EventTargetUnreachable] {
+		return
+	}
+
+	m.mu.Lock()
+	t := m.targets[addr]
+	if t == nil {
+		m.mu.Unlock()
+		return
+	}
+	if !t.succeeded {
+		t.succeeded = true
+		m.mu.Unlock()
+		return
+	}
+	recovered := t.unreachable
+	delete(m.targets, addr)
+	m.mu.Unlock()
+
+	if recovered {
+		m.raise("", Alert{
+			Event: EventTargetUnreachable,
+			Title: "Target reachable: " + addr,
+			Text:  fmt.Sprintf("Sends to %s are working again", addr),
+		})
+	}
+}
+
+// NoPackets raises an alert when no source packets have arrived for the
+// given time
+func (m *Manager) NoPackets(silence time.Duration) {
+	if !m.events[EventNoPackets] {
+		return
+	}
+
+	raised := m.raise(string(EventNoPackets), Alert{
+		Event: EventNoPackets,
+		Title: "No packets received",
+		Text:  fmt.Sprintf("No packets have arrived for %s; check that the sources are still broadcasting", silence.Round(time.Second)),
+	})
+	if raised {
+		m.mu.Lock()
+		m.silent = true
+		m.mu.Unlock()
+	}
+}
+
+// PacketsResumed reports that packets are arriving again after a no packets
+// alert
+func (m *Manager) PacketsResumed(silence time.Duration) {
+	if !m.events[EventNoPackets] {
+		return
+	}
+
+	m.mu.Lock()
+	recovered := m.silent
+	m.silent = false
+	m.mu.Unlock()
+
+	if recovered {
+		m.raise("", Alert{
+			Event: EventNoPackets,
+			Title: "Packets received",
+			Text:  fmt.Sprintf("Packets are arriving again after %s without any", silence.Round(time.Second)),
+		})
+	}
+}
+
+// raise queues an alert and reports whether it was. Alerts with a key are
+// not repeated within the cooldown. The queue never blocks the relay; when
+// it is full the alert is dropped.
+func (m *Manager) raise(key string, a Alert) bool {
+	if key != "" {
+		now := m.now()
+		m.mu.Lock()
+		if last, ok := m.last[key]; ok && now.Sub(last) < m.cfg.Cooldown {
+			m.mu.Unlock()
+			return false
+		}
+		m.last[key] = now
+		m.mu.Unlock()
+	}
+
+	select {
+	case m.alerts <- a:
+		return true
+	default:
+		log.Printf("Alert queue full, dropping %q", a.Title)
+		return false
+	}
+}
+
+// Run sends queued alerts to the notifiers until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-m.alerts:
+			log.Printf("Alert: %s: %s", a.Title, a.Text)
+			for _, n := range m.cfg.Notifiers {
+				sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+				if err := n.Notify(sendCtx, a); err != nil {
+					log.Printf("Failed to send %s alert: %v", n.Name(), err)
+				}
+				cancel()
+			}
+		}
+	}
+}
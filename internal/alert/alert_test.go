@@ -0,0 +1,221 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Notifier that keeps what it is sent
+type recorder struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Notify(ctx context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+// queued returns the titles of the alerts waiting to be sent
+func queued(m *Manager) []string {
+	var titles []string
+	for {
+		select {
+		case a := <-m.alerts:
+			titles = append(titles, a.Title)
+		default:
+			return titles
+		}
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	if _, err := NewManager(Config{}); err == nil {
+		t.Error("Expected error without notifiers")
+	}
+	if _, err := NewManager(Config{Notifiers: []Notifier{&recorder{}}, Events: []Event{"nope"}}); err == nil {
+		t.Error("Expected error for unknown event")
+	}
+
+	m, err := NewManager(Config{Notifiers: []Notifier{&recorder{}}, Events: []Event{EventParseFailures}})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if !m.Enabled(EventParseFailures) || m.Enabled(EventNewDXCC) {
+		t.Errorf("Expected only parse_failures enabled: %v", m.events)
+	}
+}
+
+func TestNewDXCC(t *testing.T) {
+	m, _ := NewManager(Config{Notifiers: []Notifier{&recorder{}}})
+	m.Worked("Canada")
+
+	m.QSO("VE3ABC", "Canada")
+	m.QSO("DL1XYZ", "Fed. Rep. of Germany")
+	m.QSO("DL2XYZ", "Fed. Rep. of Germany")
+
+	if titles := queued(m); len(titles) != 1 || titles[0] != "New DXCC: Fed. Rep. of Germany" {
+		t.Errorf("Expected one new DXCC alert, got %v", titles)
+	}
+}
+
+func TestParseFailureRate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	m, _ := NewManager(Config{Notifiers: []Notifier{&recorder{}}, ParseFailuresPerMinute: 3, Cooldown: 10 * time.Minute})
+	m.now = func() time.Time { return now }
+
+	// Failures spread out over more than a minute don't add up
+	for i := 0; i < 4; i++ {
+		m.ParseFailed()
+		now = now.Add(40 * time.Second)
+	}
+	if titles := queued(m); len(titles) != 0 {
+		t.Errorf("Expected no alert for a slow failure rate, got %v", titles)
+	}
+
+	for i := 0; i < 5; i++ {
+		m.ParseFailed()
+	}
+	if titles := queued(m); len(titles) != 1 {
+		t.Errorf("Expected one alert within the cooldown, got %v", titles)
+	}
+
+	now = now.Add(11 * time.Minute)
+	for i := 0; i < 3; i++ {
+		m.ParseFailed()
+	}
+	if titles := queued(m); len(titles) != 1 {
+		t.Errorf("Expected the alert to repeat after the cooldown, got %v", titles)
+	}
+}
+
+func TestTargetUnreachable(t *testing.T) {
+	m, _ := NewManager(Config{Notifiers: []Notifier{&recorder{}}, TargetFailures: 2})
+	refused := errors.New("connection refused")
+
+	m.TargetFailed("127.0.0.1:12060", refused)
+	m.TargetOK("127.0.0.1:12060")
+	m.TargetOK("127.0.0.1:12060")
+	m.TargetFailed("127.0.0.1:12060", refused)
+	if titles := queued(m); len(titles) != 0 {
+		t.Errorf("Expected no alert before consecutive failures, got %v", titles)
+	}
+
+	// A refused UDP port shows up on every other send
+	m.TargetOK("127.0.0.1:12060")
+	m.TargetFailed("127.0.0.1:12060", refused)
+	m.TargetOK("127.0.0.1:12060")
+	m.TargetOK("127.0.0.1:12060")
+	expected := []string{"Target unreachable: 127.0.0.1:12060", "Target reachable: 127.0.0.1:12060"}
+	if titles := queued(m); strings.Join(titles, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, titles)
+	}
+}
+
+func TestNoPackets(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	m, _ := NewManager(Config{Notifiers: []Notifier{&recorder{}}, Cooldown: time.Hour})
+	m.now = func() time.Time { return now }
+
+	// No recovery without an alert first
+	m.PacketsResumed(time.Minute)
+	m.NoPackets(10 * time.Minute)
+	m.PacketsResumed(12 * time.Minute)
+
+	// A second silence within the cooldown is neither alerted nor recovered
+	now = now.Add(20 * time.Minute)
+	m.NoPackets(10 * time.Minute)
+	m.PacketsResumed(11 * time.Minute)
+
+	expected := []string{"No packets received", "Packets received"}
+	if titles := queued(m); strings.Join(titles, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, titles)
+	}
+}
+
+func TestRunSendsToNotifiers(t *testing.T) {
+	rec := &recorder{}
+	m, _ := NewManager(Config{Notifiers: []Notifier{rec}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+
+	m.QSO("JA1ABC", "Japan")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.alerts)
+		rec.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alert was not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestWebhooks(t *testing.T) {
+	var (
+		path    string
+		form    string
+		content string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Content-Type") == "application/json" {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			content = body["content"]
+		} else {
+			r.ParseForm()
+			form = r.PostForm.Get("chat_id") + " " + r.PostForm.Get("text")
+		}
+		if strings.Contains(path, "bad") {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	a := Alert{Event: EventNewDXCC, Title: "New DXCC: Japan", Text: "JA1ABC is the first QSO with Japan"}
+
+	telegram := &Telegram{Token: "123:abc", ChatID: "42", api: server.URL}
+	if err := telegram.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Telegram notify failed: %v", err)
+	}
+	if path != "/bot123:abc/sendMessage" || form != "42 New DXCC: Japan\nJA1ABC is the first QSO with Japan" {
+		t.Errorf("Unexpected Telegram request %s: %q", path, form)
+	}
+
+	discord := &Discord{WebhookURL: server.URL + "/api/webhooks/1/token"}
+	if err := discord.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Discord notify failed: %v", err)
+	}
+	if content != "**New DXCC: Japan**\nJA1ABC is the first QSO with Japan" {
+		t.Errorf("Unexpected Discord content %q", content)
+	}
+
+	bad := &Telegram{Token: "bad", ChatID: "42", api: server.URL}
+	err := bad.Notify(context.Background(), a)
+	if err == nil || strings.Contains(err.Error(), "bad") {
+		t.Errorf("Expected an error without the token in it, got %v", err)
+	}
+}
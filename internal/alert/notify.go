@@ -0,0 +1,130 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Notifier delivers an alert to one destination
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// httpClient is shared by the webhook notifiers
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Desktop shows alerts as desktop notifications using the platform's own
+// tool: notify-send on Linux, osascript on macOS and PowerShell on Windows
+type Desktop struct{}
+
+// Name identifies the notifier in log messages
+func (Desktop) Name() string { return "desktop" }
+
+// Notify shows the alert
+func (Desktop) Notify(ctx context.Context, a Alert) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", a.Text, a.Title)
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms; `+
+			`$n = New-Object System.Windows.Forms.NotifyIcon; `+
+			`$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; `+
+			`$n.ShowBalloonTip(10000, '%s', '%s', 'Warning'); Start-Sleep -Seconds 10; $n.Dispose()`,
+			powershellQuote(a.Title), powershellQuote(a.Text))
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", script)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=N7AKG-UDP-Translator", a.Title, a.Text)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w %s", cmd.Path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// powershellQuote escapes s for a single-quoted PowerShell string
+func powershellQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// Telegram sends alerts through a Telegram bot to a chat
+type Telegram struct {
+	Token  string // Bot token from @BotFather
+	ChatID string // Chat, group or channel id
+	api    string // API base URL; tests point it at a local server
+}
+
+// Name identifies the notifier in log messages
+func (t *Telegram) Name() string { return "telegram" }
+
+// Notify sends the alert with the Bot API's sendMessage method
+func (t *Telegram) Notify(ctx context.Context, a Alert) error {
+	api := t.api
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+
+	form := url.Values{
+		"chat_id": {t.ChatID},
+		"text":    {a.Title + "\n" + a.Text},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		api+"/bot"+t.Token+"/sendMessage", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return send(req)
+}
+
+// Discord posts alerts to a Discord channel webhook
+type Discord struct {
+	WebhookURL string
+}
+
+// Name identifies the notifier in log messages
+func (d *Discord) Name() string { return "discord" }
+
+// Notify posts the alert as a webhook message
+func (d *Discord) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(map[string]string{
+		"username": "N7AKG-UDP-Translator",
+		"content":  "**" + a.Title + "**\n" + a.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(req)
+}
+
+// send performs a webhook request and checks the response status
+func send(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The error includes the URL, which for Telegram contains the token
+		return fmt.Errorf("request to %s failed", req.URL.Host)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package aprs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Reporting modes
+const (
+	ModeQSO     = "qso"     // one status packet per logged QSO
+	ModeSummary = "summary" // periodic status packet with the QSO count
+)
+
+// Config holds the APRS-IS connection and reporting settings
+type Config struct {
+	Server      string        // APRS-IS server, host:port
+	Callsign    string        // Login and source callsign (with SSID if any)
+	Passcode    string        // APRS-IS passcode for Callsign
+	Mode        string        // ModeQSO or ModeSummary
+	Interval    time.Duration // Summary interval
+	MinInterval time.Duration // Minimum time between packets
+	Software    string        // Software name sent at login
+	Redact      bool          // Mask callsigns worked, e.g. W1***
+}
+
+// Client sends status packets to APRS-IS for logged QSOs
+type Client struct {
+	cfg     Config
+	packets chan string
+
+	mu    sync.Mutex
+	count int
+	last  *formatter.QSO
+}
+
+// NewClient creates an APRS-IS client. It does not connect until Run is called.
+func NewClient(cfg Config) (*Client, error) {
+	cfg.Callsign = strings.ToUpper(strings.TrimSpace(cfg.Callsign))
+	if cfg.Callsign == "" {
+		return nil, fmt.Errorf("aprs: callsign is required")
+	}
+	if cfg.Passcode == "" {
+		return nil, fmt.Errorf("aprs: passcode is required")
+	}
+	if cfg.Passcode != Passcode(cfg.Callsign) {
+		return nil, fmt.Errorf("aprs: passcode does not match callsign %s", cfg.Callsign)
+	}
+	if cfg.Server == "" {
+		cfg.Server = "rotate.aprs2.net:14580"
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeQSO
+	}
+	if cfg.Mode != ModeQSO && cfg.Mode != ModeSummary {
+		return nil, fmt.Errorf("aprs: unknown mode %q", cfg.Mode)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Minute
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = time.Minute
+	}
+	if cfg.Software == "" {
+		cfg.Software = "N7AKG-UDP-Translator"
+	}
+
+	return &Client{
+		cfg:     cfg,
+		packets: make(chan string, 16),
+	}, nil
+}
+
+// QSO records a logged QSO. In QSO mode a status packet is queued for it;
+// if the queue is full the packet is dropped rather than blocking the relay.
+func (c *Client) QSO(qso *formatter.QSO) {
+	c.mu.Lock()
+	c.count++
+	// Keep a copy: the relay may recycle the QSO once it has been delivered
+	last := *qso
+	c.last = &last
+	c.mu.Unlock()
+
+	if c.cfg.Mode != ModeQSO {
+		return
+	}
+
+	select {
+	case c.packets <- c.statusPacket(c.qsoStatus(qso)):
+	default:
+		log.Printf("APRS-IS queue full, dropping status for %s", qso.Callsign)
+	}
+}
+
+// Run connects to APRS-IS and sends queued packets until ctx is cancelled,
+// reconnecting after connection failures
+func (c *Client) Run(ctx context.Context) error {
+	var summary <-chan time.Time
+	if c.cfg.Mode == ModeSummary {
+		ticker := time.NewTicker(c.cfg.Interval)
+		defer ticker.Stop()
+		summary = ticker.C
+	}
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var lastSent time.Time
+	for {
+		var packet string
+		select {
+		case <-ctx.Done():
+			return nil
+		case packet = <-c.packets:
+		case <-summary:
+			text, ok := c.summaryStatus()
+			if !ok {
+				continue
+			}
+			packet = c.statusPacket(text)
+		}
+
+		// Respect APRS-IS etiquette by spacing packets out
+		if wait := c.cfg.MinInterval - time.Since(lastSent); !lastSent.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		if conn == nil {
+			var err error
+			conn, err = c.connect(ctx)
+			if err != nil {
+				log.Printf("APRS-IS connection failed: %v", err)
+				continue
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write([]byte(packet + "\r\n")); err != nil {
+			log.Printf("APRS-IS send failed: %v", err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+		lastSent = time.Now()
+	}
+}
+
+// connect opens a connection and logs in
+func (c *Client) connect(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", c.cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// The server greets with a comment line before accepting the login
+	if _, err := reader.ReadString('\n'); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading server banner: %w", err)
+	}
+
+	login := fmt.Sprintf("user %s pass %s vers %s\r\n", c.cfg.Callsign, c.cfg.Passcode, c.cfg.Software)
+	if _, err := conn.Write([]byte(login)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading login reply: %w", err)
+	}
+	if strings.Contains(reply, "unverified") {
+		conn.Close()
+		return nil, fmt.Errorf("login not verified, check the passcode for %s", c.cfg.Callsign)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// statusPacket wraps status text in a TNC2 status packet
+func (c *Client) statusPacket(text string) string {
+	return fmt.Sprintf("%s>APRS,TCPIP*:>%s", c.cfg.Callsign, text)
+}
+
+// qsoStatus describes one QSO
+func (c *Client) qsoStatus(qso *formatter.QSO) string {
+	call := qso.Callsign
+	if c.cfg.Redact {
+		call = formatter.RedactCallsign(call)
+	}
+	parts := []string{"QSO", call}
+	if qso.Band != "" {
+		parts = append(parts, qso.Band)
+	}
+	if qso.Mode != "" {
+		parts = append(parts, qso.Mode)
+	}
+	return strings.Join(parts, " ")
+}
+
+// summaryStatus describes the QSOs logged so far; it reports false when
+// nothing has been logged yet
+func (c *Client) summaryStatus() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.count == 0 {
+		return "", false
+	}
+	text := fmt.Sprintf("%d QSOs logged", c.count)
+	if c.last != nil {
+		text += ", last " + c.qsoStatus(c.last)
+	}
+	return text, true
+}
+
+// Passcode computes the APRS-IS passcode for a callsign. The SSID is ignored.
+func Passcode(callsign string) string {
+	call := strings.ToUpper(callsign)
+	if i := strings.Index(call, "-"); i >= 0 {
+		call = call[:i]
+	}
+
+	hash := 0x73e2
+	for i := 0; i < len(call); i += 2 {
+		hash ^= int(call[i]) << 8
+		if i+1 < len(call) {
+			hash ^= int(call[i+1])
+		}
+	}
+	return fmt.Sprintf("%d", hash&0x7fff)
+}
@@ -0,0 +1,103 @@
+package aprs
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+func TestPasscode(t *testing.T) {
+	// Passcodes are derived from the base call, the SSID doesn't matter
+	if Passcode("N0CALL") != "13023" {
+		t.Errorf("Passcode(N0CALL) = %s, want 13023", Passcode("N0CALL"))
+	}
+	if Passcode("n0call-9") != Passcode("N0CALL") {
+		t.Error("Passcode should ignore case and SSID")
+	}
+}
+
+func TestNewClientValidation(t *testing.T) {
+	if _, err := NewClient(Config{Callsign: "N0CALL", Passcode: "12345"}); err == nil {
+		t.Error("expected error for wrong passcode")
+	}
+	if _, err := NewClient(Config{Callsign: "N0CALL", Passcode: "13023", Mode: "beacon"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestClientSendsQSOStatus(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("# aprsc 2.1.14\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, "user ") {
+				conn.Write([]byte("# logresp N0CALL-7 verified, server T2TEST\r\n"))
+			}
+			lines <- line
+		}
+	}()
+
+	client, err := NewClient(Config{
+		Server:   ln.Addr().String(),
+		Callsign: "N0CALL-7",
+		Passcode: "13023",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	client.QSO(&formatter.QSO{Callsign: "K1ABC", Band: "20m", Mode: "FT8"})
+
+	want := []string{
+		"user N0CALL-7 pass 13023 vers N7AKG-UDP-Translator",
+		"N0CALL-7>APRS,TCPIP*:>QSO K1ABC 20m FT8",
+	}
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Errorf("got %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestRedactedStatus(t *testing.T) {
+	client, err := NewClient(Config{Callsign: "N0CALL-7", Passcode: "13023", Redact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := client.statusPacket(client.qsoStatus(&formatter.QSO{Callsign: "K1ABC", Band: "20m", Mode: "FT8"}))
+	if want := "N0CALL-7>APRS,TCPIP*:>QSO K1*** 20m FT8"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// header starts every daily file so loggers accept it as ADIF
+const header = "N7AKG-UDP-Translator QSO archive\n<ADIF_VER:5>3.1.4 <PROGRAMID:20>N7AKG-UDP-Translator <EOH>\n"
+
+// Archive appends ADIF records to one file per UTC day (dir/2024-06-01.adi)
+// and removes files older than the retention period
+type Archive struct {
+	dir       string
+	retention time.Duration // 0 keeps files forever
+	now       func() time.Time
+
+	day  string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Open creates the archive directory if needed. retentionDays of 0 keeps
+// every file.
+func Open(dir string, retentionDays int) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	return &Archive{
+		dir:       dir,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+		now:       time.Now,
+	}, nil
+}
+
+// Append writes one ADIF record to today's file
+func (a *Archive) Append(record string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	day := a.now().UTC().Format(dateLayout)
+	if day != a.day || a.file == nil {
+		if err := a.rotate(day); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.file.WriteString(record + "\n"); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// rotate switches to the file for day and prunes expired files
+func (a *Archive) rotate(day string) error {
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+
+	path := filepath.Join(a.dir, day+".adi")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		if _, err := file.WriteString(header); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write archive header: %w", err)
+		}
+	}
+
+	a.file = file
+	a.day = day
+	a.prune()
+	return nil
+}
+
+// prune removes daily files older than the retention period
+func (a *Archive) prune() {
+	if a.retention <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := a.now().UTC().Add(-a.retention).Format(dateLayout)
+	for _, entry := range entries {
+		name := entry.Name()
+		day := strings.TrimSuffix(name, ".adi")
+		if entry.IsDir() || day == name {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, day); err != nil {
+			// Not one of ours
+			continue
+		}
+		if day < cutoff {
+			os.Remove(filepath.Join(a.dir, name))
+		}
+	}
+}
+
+// Close closes the current file
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDailyRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file well past retention and an unrelated file that must be kept
+	os.WriteFile(filepath.Join(dir, "2024-05-01.adi"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.adi"), []byte("keep"), 0644)
+
+	a, err := Open(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	now := time.Date(2024, 6, 1, 23, 59, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	if err := a.Append("<CALL:5>K1ABC <EOR>"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := a.Append("<CALL:4>W1AW <EOR>"); err != nil {
+		t.Fatal(err)
+	}
+
+	day1, err := os.ReadFile(filepath.Join(dir, "2024-06-01.adi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(day1), header) || !strings.Contains(string(day1), "K1ABC") || strings.Contains(string(day1), "W1AW") {
+		t.Errorf("unexpected 2024-06-01.adi contents:\n%s", day1)
+	}
+
+	day2, err := os.ReadFile(filepath.Join(dir, "2024-06-02.adi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(day2), "W1AW") {
+		t.Errorf("unexpected 2024-06-02.adi contents:\n%s", day2)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2024-05-01.adi")); !os.IsNotExist(err) {
+		t.Error("expected expired file to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.adi")); err != nil {
+		t.Error("unrelated file should be kept")
+	}
+}
@@ -0,0 +1,96 @@
+// Package auth signs and verifies datagrams with a shared-secret HMAC so a
+// relay reachable over the internet only accepts QSOs from trusted senders.
+//
+// A signed datagram is the original payload followed by a trailer line:
+//
+//	<payload>\nHMAC-SHA256 <unix seconds> <hex signature>
+//
+// The signature covers the timestamp and the payload, so a captured datagram
+// stops being accepted once its timestamp is older than the allowed skew.
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// trailerPrefix starts the signature line appended to a payload
+const trailerPrefix = "\nHMAC-SHA256 "
+
+var (
+	// ErrUnsigned means the datagram carries no signature trailer
+	ErrUnsigned = errors.New("datagram is not signed")
+
+	// ErrInvalidSignature means the trailer is malformed or does not match
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrExpired means the signature timestamp is outside the allowed skew
+	ErrExpired = errors.New("signature timestamp outside allowed clock skew")
+)
+
+// Sign appends a signature trailer for payload, timestamped now
+func Sign(payload []byte, secret string, now time.Time) []byte {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	signed := make([]byte, 0, len(payload)+len(trailerPrefix)+len(ts)+1+sha256.Size*2)
+	signed = append(signed, payload...)
+	signed = append(signed, trailerPrefix...)
+	signed = append(signed, ts...)
+	signed = append(signed, ' ')
+	return append(signed, hex.EncodeToString(sum(secret, ts, payload))...)
+}
+
+// Signed reports whether a datagram carries a signature trailer
+func Signed(datagram []byte) bool {
+	return bytes.LastIndex(datagram, []byte(trailerPrefix)) >= 0
+}
+
+// Verify checks a signed datagram against secret and returns the original
+// payload. A maxSkew of 0 disables the timestamp check.
+func Verify(datagram []byte, secret string, now time.Time, maxSkew time.Duration) ([]byte, error) {
+	i := bytes.LastIndex(datagram, []byte(trailerPrefix))
+	if i < 0 {
+		return nil, ErrUnsigned
+	}
+	payload := datagram[:i]
+
+	fields := bytes.Fields(datagram[i+len(trailerPrefix):])
+	if len(fields) != 2 {
+		return nil, ErrInvalidSignature
+	}
+	ts := string(fields[0])
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	signature := make([]byte, hex.DecodedLen(len(fields[1])))
+	if _, err := hex.Decode(signature, fields[1]); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	if !hmac.Equal(signature, sum(secret, ts, payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	if maxSkew > 0 {
+		skew := now.Sub(time.Unix(unix, 0))
+		if skew > maxSkew || skew < -maxSkew {
+			return nil, ErrExpired
+		}
+	}
+
+	return payload, nil
+}
+
+// sum computes the HMAC-SHA256 of the timestamp and payload
+func sum(secret, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte{'\n'})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte("<call:5>K2ABC<band:3>20m<mode:3>FT8<eor>")
+	signed := Sign(payload, "s3cret", now)
+
+	got, err := Verify(signed, "s3cret", now.Add(time.Minute), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("Verify returned %q, expected %q", got, payload)
+	}
+
+	tampered := bytes.Replace(signed, []byte("K2ABC"), []byte("K2ABD"), 1)
+
+	tests := []struct {
+		name     string
+		datagram []byte
+		secret   string
+		now      time.Time
+		err      error
+	}{
+		{"unsigned", payload, "s3cret", now, ErrUnsigned},
+		{"wrong secret", signed, "other", now, ErrInvalidSignature},
+		{"tampered payload", tampered, "s3cret", now, ErrInvalidSignature},
+		{"malformed trailer", append(append([]byte{}, payload...), "\nHMAC-SHA256 zz"...), "s3cret", now, ErrInvalidSignature},
+		{"too old", signed, "s3cret", now.Add(10 * time.Minute), ErrExpired},
+		{"from the future", signed, "s3cret", now.Add(-10 * time.Minute), ErrExpired},
+	}
+
+	for _, test := range tests {
+		if _, err := Verify(test.datagram, test.secret, test.now, 5*time.Minute); !errors.Is(err, test.err) {
+			t.Errorf("%s: Verify error = %v; expected %v", test.name, err, test.err)
+		}
+	}
+
+	// Binary payloads (WSJT-X) survive signing unchanged
+	binary := []byte{0xad, 0xbc, 0xcb, 0xda, 0, 0, 0, 2, '\n', 0xff}
+	if got, err := Verify(Sign(binary, "s3cret", now), "s3cret", now, 0); err != nil || !bytes.Equal(got, binary) {
+		t.Errorf("binary payload: got %v, %v", got, err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open relay socket: %v", err)
+	}
+	defer relay.Close()
+
+	signer, err := NewSigner("127.0.0.1:0", relay.LocalAddr().String(), "s3cret")
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go signer.Run(ctx)
+
+	app, err := net.DialUDP("udp", nil, signer.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to open application socket: %v", err)
+	}
+	defer app.Close()
+	app.Write([]byte("<call:5>K2ABC<eor>"))
+
+	buf := make([]byte, 4096)
+	relay.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := relay.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no signed datagram received: %v", err)
+	}
+	payload, err := Verify(buf[:n], "s3cret", time.Now(), time.Minute)
+	if err != nil || string(payload) != "<call:5>K2ABC<eor>" {
+		t.Errorf("forwarded datagram %q did not verify: %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// Signer receives datagrams on a local port, signs them and forwards them
+// to a remote relay. Local applications send to the signer instead of the
+// relay, so they need no changes of their own.
+type Signer struct {
+	conn   *net.UDPConn
+	target *net.UDPConn
+	secret string
+}
+
+// NewSigner opens the local listener and the connection to the relay
+func NewSigner(listen, target, secret string) (*Signer, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("a secret is required")
+	}
+
+	listenAddr, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve listen address: %w", err)
+	}
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve relay address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+	out, err := net.DialUDP("udp", nil, targetAddr)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create UDP sender for %s: %w", target, err)
+	}
+
+	return &Signer{conn: conn, target: out, secret: secret}, nil
+}
+
+// LocalAddr returns the address the signer listens on
+func (s *Signer) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Run signs and forwards datagrams until ctx is cancelled, then closes both
+// sockets
+func (s *Signer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.conn.Close()
+	}()
+	defer s.target.Close()
+
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading UDP message: %v", err)
+			continue
+		}
+
+		if _, err := s.target.Write(Sign(buffer[:n], s.secret, time.Now())); err != nil {
+			log.Printf("Failed to forward signed datagram to %s: %v", s.target.RemoteAddr(), err)
+		}
+	}
+}
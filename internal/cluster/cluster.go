@@ -0,0 +1,251 @@
+// Package cluster runs two relays as a primary and a backup. Each node sends
+// a heartbeat datagram to the other once per interval, saying whether it is
+// active. Only the active node runs the relay; the standby node holds no
+// relay sockets, so a backup on the same computer can bind the listen port
+// when it takes over.
+//
+// Failover is not preemptive: a standby node becomes active when it has not
+// heard from an active peer within the timeout, and a primary that comes
+// back leaves the backup active. Should both end up active, e.g. after a
+// network partition heals, the backup stands down.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/auth"
+)
+
+// Role is a node's part in the election
+type Role string
+
+// Roles
+const (
+	RolePrimary Role = "primary"
+	RoleBackup  Role = "backup"
+)
+
+// maxSkew is the largest accepted age of a signed heartbeat. FT8 already
+// needs both computers' clocks within a second or two.
+const maxSkew = time.Minute
+
+// Config describes one node
+type Config struct {
+	NodeID   string        // Name in logs and heartbeats
+	Role     Role          // primary or backup
+	Listen   string        // host:port receiving the peer's heartbeats
+	Peer     string        // host:port of the peer's Listen address
+	Interval time.Duration // Time between heartbeats
+	Timeout  time.Duration // Time without an active peer before taking over
+	Secret   string        // Shared secret signing heartbeats; empty sends them unsigned
+}
+
+// heartbeat is the datagram the nodes exchange
+type heartbeat struct {
+	Magic    int    `json:"n7akg_cluster"`
+	Node     string `json:"node"`
+	Role     Role   `json:"role"`
+	Active   bool   `json:"active"`
+	Stopping bool   `json:"stopping,omitempty"` // Sent once at shutdown so the peer takes over at once
+}
+
+// Node is one relay of a primary/backup pair
+type Node struct {
+	cfg    Config
+	conn   *net.UDPConn
+	peer   *net.UDPAddr
+	active atomic.Bool
+
+	sendFailing bool // The last heartbeat failed to send; only used by Run
+}
+
+// New binds the heartbeat socket. The node stays on standby until Run.
+func New(cfg Config) (*Node, error) {
+	if cfg.Role != RolePrimary && cfg.Role != RoleBackup {
+		return nil, fmt.Errorf("cluster: unknown role %q (use primary or backup)", cfg.Role)
+	}
+	if cfg.Interval <= 0 || cfg.Timeout <= cfg.Interval {
+		return nil, fmt.Errorf("cluster: timeout (%s) must be longer than interval (%s)", cfg.Timeout, cfg.Interval)
+	}
+
+	peer, err := net.ResolveUDPAddr("udp", cfg.Peer)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: bad peer address %q: %w", cfg.Peer, err)
+	}
+	listen, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: bad listen address %q: %w", cfg.Listen, err)
+	}
+	conn, err := net.ListenUDP("udp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: %w", err)
+	}
+	return &Node{cfg: cfg, conn: conn, peer: peer}, nil
+}
+
+// Addr returns the address the node receives heartbeats on
+func (n *Node) Addr() net.Addr {
+	return n.conn.LocalAddr()
+}
+
+// Active reports whether this node is running the relay
+func (n *Node) Active() bool {
+	return n.active.Load()
+}
+
+// Run takes part in the election until ctx is cancelled, calling serve while
+// this node is active. serve must return once its context is cancelled. If
+// it fails, the node stands by and tries again after the timeout.
+func (n *Node) Run(ctx context.Context, serve func(context.Context) error) error {
+	defer n.conn.Close()
+
+	received := make(chan heartbeat, 16)
+	go n.receive(received)
+
+	// A primary only waits to hear whether a backup is already active; a
+	// backup gives the primary the full timeout to start
+	wait := 2 * n.cfg.Interval
+	if n.cfg.Role == RoleBackup {
+		wait = n.cfg.Timeout
+	}
+	deadline := time.Now().Add(wait)
+	log.Printf("Cluster: %s node %s standing by, heartbeats on %s", n.cfg.Role, n.cfg.NodeID, n.Addr())
+
+	ticker := time.NewTicker(n.cfg.Interval)
+	defer ticker.Stop()
+
+	var stop context.CancelFunc
+	var served chan error
+	activate := func() {
+		log.Printf("Cluster: %s node %s taking over", n.cfg.Role, n.cfg.NodeID)
+		n.active.Store(true)
+		n.send(false)
+
+		var serveCtx context.Context
+		serveCtx, stop = context.WithCancel(ctx)
+		served = make(chan error, 1)
+		go func() { served <- serve(serveCtx) }()
+	}
+	standDown := func() {
+		stop()
+		if err := <-served; err != nil {
+			log.Printf("Cluster: relay error while standing down: %v", err)
+		}
+		served = nil
+		n.active.Store(false)
+		n.send(false)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if served != nil {
+				standDown()
+			}
+			n.send(true)
+			return nil
+
+		case err := <-served:
+			served = nil
+			n.active.Store(false)
+			log.Printf("Cluster: relay stopped: %v; standing by", err)
+			deadline = time.Now().Add(n.cfg.Timeout)
+			n.send(false)
+
+		case hb := <-received:
+			switch {
+			case hb.Stopping:
+				if !n.Active() {
+					log.Printf("Cluster: peer %s is shutting down", hb.Node)
+					deadline = time.Now()
+				}
+			case !hb.Active:
+			case !n.Active():
+				deadline = time.Now().Add(n.cfg.Timeout)
+			case n.yieldsTo(hb):
+				log.Printf("Cluster: %s node %s is also active; standing down", hb.Role, hb.Node)
+				standDown()
+				deadline = time.Now().Add(n.cfg.Timeout)
+			}
+
+		case <-ticker.C:
+			n.send(false)
+		}
+
+		if !n.Active() && !time.Now().Before(deadline) {
+			activate()
+		}
+	}
+}
+
+// yieldsTo reports whether this node should stand down for another active
+// node: the primary wins, and between nodes of the same role (a
+// misconfiguration) the lower node ID does
+func (n *Node) yieldsTo(hb heartbeat) bool {
+	if n.cfg.Role != hb.Role {
+		return n.cfg.Role == RoleBackup
+	}
+	return hb.Node < n.cfg.NodeID
+}
+
+// send sends a heartbeat to the peer
+func (n *Node) send(stopping bool) {
+	payload, err := json.Marshal(heartbeat{Magic: 1, Node: n.cfg.NodeID, Role: n.cfg.Role, Active: n.Active(), Stopping: stopping})
+	if err != nil {
+		return
+	}
+	if n.cfg.Secret != "" {
+		payload = auth.Sign(payload, n.cfg.Secret, time.Now())
+	}
+	_, err = n.conn.WriteToUDP(payload, n.peer)
+	if err != nil && !n.sendFailing {
+		log.Printf("Cluster: failed to send heartbeat to %s: %v", n.peer, err)
+	}
+	n.sendFailing = err != nil
+}
+
+// receive reads the peer's heartbeats until the socket is closed. Refused
+// heartbeats are logged at most once a minute.
+func (n *Node) receive(received chan<- heartbeat) {
+	buffer := make([]byte, 2048)
+	var lastRefused time.Time
+	for {
+		size, from, err := n.conn.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		payload := buffer[:size]
+		if n.cfg.Secret != "" {
+			if payload, err = auth.Verify(payload, n.cfg.Secret, time.Now(), maxSkew); err != nil {
+				if time.Since(lastRefused) >= time.Minute {
+					log.Printf("Cluster: ignoring heartbeat from %s: %v", from, err)
+					lastRefused = time.Now()
+				}
+				continue
+			}
+		}
+		var hb heartbeat
+		if err := json.Unmarshal(payload, &hb); err != nil || hb.Magic != 1 {
+			continue
+		}
+		if hb.Node == n.cfg.NodeID {
+			// Our own heartbeat, e.g. with the peer set to this node
+			continue
+		}
+		select {
+		case received <- hb:
+		default:
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// newNode creates a node on loopback
+func newNode(t *testing.T, id string, role Role, secret string) *Node {
+	t.Helper()
+	n, err := New(Config{
+		NodeID:   id,
+		Role:     role,
+		Listen:   "127.0.0.1:0",
+		Peer:     "127.0.0.1:9", // Changed by pair
+		Interval: 20 * time.Millisecond,
+		Timeout:  150 * time.Millisecond,
+		Secret:   secret,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return n
+}
+
+// pair points two nodes at each other. Nodes already running keep their
+// peer.
+func pair(a, b *Node) {
+	a.peer = b.Addr().(*net.UDPAddr)
+	b.peer = a.Addr().(*net.UDPAddr)
+}
+
+// run runs a node until the test ends or the returned function is called
+func run(t *testing.T, n *Node) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.Run(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// waitFor polls until n's active state is want
+func waitFor(t *testing.T, n *Node, want bool, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for n.Active() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: active = %v after %s, want %v", n.cfg.NodeID, n.Active(), within, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// stays checks that n's active state doesn't change for a while
+func stays(t *testing.T, n *Node, want bool, period time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(period)
+	for time.Now().Before(deadline) {
+		if n.Active() != want {
+			t.Fatalf("%s: active = %v, want %v", n.cfg.NodeID, n.Active(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	primary := newNode(t, "shack", RolePrimary, "s3cret")
+	backup := newNode(t, "spare", RoleBackup, "s3cret")
+	pair(primary, backup)
+	stopPrimary := run(t, primary)
+	run(t, backup)
+
+	waitFor(t, primary, true, time.Second)
+	stays(t, backup, false, 300*time.Millisecond)
+
+	// A primary shutting down hands over at once
+	stopPrimary()
+	waitFor(t, backup, true, 100*time.Millisecond)
+
+	// A primary that comes back, on the same address, leaves the backup
+	// active
+	restarted, err := New(Config{NodeID: "shack", Role: RolePrimary, Listen: primary.Addr().String(), Peer: backup.Addr().String(),
+		Interval: 20 * time.Millisecond, Timeout: 150 * time.Millisecond, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	run(t, restarted)
+	stays(t, restarted, false, 300*time.Millisecond)
+	if !backup.Active() {
+		t.Error("backup stood down for a restarted primary")
+	}
+}
+
+func TestTakeoverAfterTimeout(t *testing.T) {
+	backup := newNode(t, "spare", RoleBackup, "")
+	run(t, backup)
+
+	// No heartbeats from the primary at all
+	stays(t, backup, false, 100*time.Millisecond)
+	waitFor(t, backup, true, time.Second)
+
+	// Both active: the backup stands down for the primary
+	sender, err := net.DialUDP("udp", nil, backup.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	payload, _ := json.Marshal(heartbeat{Magic: 1, Node: "shack", Role: RolePrimary, Active: true})
+	sender.Write(payload)
+	waitFor(t, backup, false, time.Second)
+}
+
+func TestUnsignedHeartbeatIgnored(t *testing.T) {
+	backup := newNode(t, "spare", RoleBackup, "s3cret")
+	run(t, backup)
+	sender, err := net.DialUDP("udp", nil, backup.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// A forged active primary would keep the backup on standby forever
+	payload, _ := json.Marshal(heartbeat{Magic: 1, Node: "shack", Role: RolePrimary, Active: true})
+	for i := 0; i < 10; i++ {
+		sender.Write(payload)
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitFor(t, backup, true, time.Second)
+}
+
+func TestNewErrors(t *testing.T) {
+	base := Config{NodeID: "a", Role: RolePrimary, Listen: "127.0.0.1:0", Peer: "127.0.0.1:2335", Interval: time.Second, Timeout: 5 * time.Second}
+
+	bad := []Config{base, base, base}
+	bad[0].Role = "leader"
+	bad[1].Timeout = time.Second
+	bad[2].Peer = "nowhere"
+	for _, cfg := range bad {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package comport sends a line for each logged QSO to a serial port, for
+// LED displays, keyers and embedded loggers that take text over RS-232.
+// Lines are made from a template, so each device gets the layout it expects.
+package comport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/mapping"
+)
+
+// DefaultTemplate is the line sent when none is configured
+const DefaultTemplate = "{{.time}} {{.callsign}} {{.band}} {{.mode}} {{.rst_sent}} {{.rst_rcvd}}"
+
+// Bauds are the supported baud rates
+var Bauds = []int{1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200, 230400}
+
+// ValidBaud reports whether baud is a supported baud rate
+func ValidBaud(baud int) bool {
+	for _, b := range Bauds {
+		if b == baud {
+			return true
+		}
+	}
+	return false
+}
+
+// lineEndings are what may end each line, by name
+var lineEndings = map[string]string{
+	"crlf": "\r\n",
+	"lf":   "\n",
+	"cr":   "\r",
+}
+
+// ValidLineEnding reports whether name names a line ending
+func ValidLineEnding(name string) bool {
+	_, ok := lineEndings[strings.ToLower(name)]
+	return ok
+}
+
+// writeTimeout bounds a write to a port whose device has stopped reading
+const writeTimeout = 10 * time.Second
+
+// retryInterval is how long after a failed open the port is tried again
+const retryInterval = 5 * time.Second
+
+// lineBreaks become spaces in rendered lines
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// Config holds the serial port and line settings
+type Config struct {
+	Port       string // Device, e.g. /dev/ttyUSB0
+	Baud       int    // One of Bauds; 8 data bits, no parity, 1 stop bit
+	Template   string // text/template for each line; DefaultTemplate if empty
+	LineEnding string // crlf (default), lf or cr
+	Redact     bool   // Mask callsigns worked, e.g. W1***
+}
+
+// Sink writes QSO lines to a serial port
+type Sink struct {
+	cfg    Config
+	tmpl   *template.Template
+	ending string
+	lines  chan string
+}
+
+// New creates a sink. The port is not opened until Run is called.
+func New(cfg Config) (*Sink, error) {
+	if cfg.Port == "" {
+		return nil, fmt.Errorf("serial port: port is required")
+	}
+	if cfg.Baud == 0 {
+		cfg.Baud = 9600
+	}
+	if !ValidBaud(cfg.Baud) {
+		return nil, fmt.Errorf("serial port: unsupported baud rate %d", cfg.Baud)
+	}
+	if cfg.Template == "" {
+		cfg.Template = DefaultTemplate
+	}
+	tmpl, err := template.New("line").Funcs(mapping.Funcs()).Option("missingkey=zero").Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("serial port: template: %w", err)
+	}
+	if cfg.LineEnding == "" {
+		cfg.LineEnding = "crlf"
+	}
+	ending, ok := lineEndings[strings.ToLower(cfg.LineEnding)]
+	if !ok {
+		return nil, fmt.Errorf("serial port: unknown line ending %q", cfg.LineEnding)
+	}
+
+	return &Sink{
+		cfg:    cfg,
+		tmpl:   tmpl,
+		ending: ending,
+		lines:  make(chan string, 64),
+	}, nil
+}
+
+// Line renders the line for a QSO, without the line ending. The template
+// sees the fields mappings do, plus date (YYYY-MM-DD) and time (HHMM, UTC).
+func (s *Sink) Line(qso *formatter.QSO, msgType formatter.MessageType) (string, error) {
+	v := mapping.Values(qso, msgType)
+	if s.cfg.Redact {
+		v["callsign"] = formatter.RedactCallsign(v["callsign"])
+	}
+	if !qso.DateTime.IsZero() {
+		v["date"] = qso.DateTime.UTC().Format("2006-01-02")
+		v["time"] = qso.DateTime.UTC().Format("1504")
+	}
+
+	var b strings.Builder
+	if err := s.tmpl.Execute(&b, v); err != nil {
+		return "", err
+	}
+	// A line break inside the line would split it on the display; other
+	// spacing is kept for fixed-width layouts
+	return strings.TrimRight(lineBreaks.Replace(b.String()), " "), nil
+}
+
+// QSO queues the line for a logged QSO; if the queue is full the line is
+// dropped rather than blocking the relay
+func (s *Sink) QSO(qso *formatter.QSO, msgType formatter.MessageType) {
+	line, err := s.Line(qso, msgType)
+	if err != nil {
+		log.Printf("Serial port line for %s failed: %v", qso.Callsign, err)
+		return
+	}
+	select {
+	case s.lines <- line + s.ending:
+	default:
+		log.Printf("Serial port queue full, dropping line for %s", qso.Callsign)
+	}
+}
+
+// Check opens and configures the port, then closes it, to find a missing
+// device or missing permissions before a QSO needs the port
+func Check(path string, baud int) error {
+	port, err := open(path, baud)
+	if err != nil {
+		return err
+	}
+	return port.Close()
+}
+
+// Run opens the port and writes queued lines until ctx is cancelled,
+// reopening it after a failure such as a USB adapter being unplugged
+func (s *Sink) Run(ctx context.Context) error {
+	var port *os.File
+	defer func() {
+		if port != nil {
+			port.Close()
+		}
+	}()
+
+	var failed time.Time
+	for {
+		var line string
+		select {
+		case <-ctx.Done():
+			return nil
+		case line = <-s.lines:
+		}
+
+		if port == nil {
+			// Lines queued while the port is missing are dropped, but the
+			// failure is only logged once per retry interval
+			if time.Since(failed) < retryInterval {
+				continue
+			}
+			var err error
+			if port, err = open(s.cfg.Port, s.cfg.Baud); err != nil {
+				log.Printf("Serial port %s open failed: %v", s.cfg.Port, err)
+				failed = time.Now()
+				continue
+			}
+		}
+
+		port.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := port.WriteString(line); err != nil {
+			log.Printf("Serial port %s write failed: %v", s.cfg.Port, err)
+			port.Close()
+			port = nil
+			failed = time.Now()
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package comport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+func TestLine(t *testing.T) {
+	qso := &formatter.QSO{
+		Callsign: "K2ABC",
+		Band:     "20m",
+		Mode:     "FT8",
+		RST_Sent: "-05",
+		RST_Rcvd: "-12",
+		Comment:  "first\nsecond",
+		DateTime: time.Date(2024, 6, 1, 14, 23, 15, 0, time.UTC),
+	}
+	tests := []struct {
+		template string
+		redact   bool
+		want     string
+	}{
+		{"", false, "1423 K2ABC 20m FT8 -05 -12"},
+		{"{{.date}} {{printf \"%-8s\" .callsign}}|{{lower .mode}}", false, "2024-06-01 K2ABC   |ft8"},
+		{"{{.callsign}} {{.comment}}", false, "K2ABC first second"},
+		{"{{.callsign}} {{.exchange}}", false, "K2ABC"},
+		{"", true, "1423 K2*** 20m FT8 -05 -12"},
+	}
+	for _, tt := range tests {
+		s, err := New(Config{Port: "/dev/null", Template: tt.template, Redact: tt.redact})
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", tt.template, err)
+		}
+		if got, err := s.Line(qso, formatter.MessageType("wsjt-x")); err != nil || got != tt.want {
+			t.Errorf("Line with %q = %q, %v; want %q", tt.template, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{Port: "/dev/ttyUSB0", Baud: 300},
+		{Port: "/dev/ttyUSB0", Template: "{{.callsign"},
+		{Port: "/dev/ttyUSB0", LineEnding: "nl"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package comport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// openPTY opens a pseudo-terminal and returns its master and the path of
+// the serial port it stands in for
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func TestRun(t *testing.T) {
+	master, path := openPTY(t)
+
+	s, err := New(Config{Port: path, Baud: 19200, Template: "{{.callsign}} {{.band}}"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	s.QSO(&formatter.QSO{Callsign: "G4ABC", Band: "40m"}, formatter.MessageType("fldigi"))
+	s.QSO(&formatter.QSO{Callsign: "W9XYZ", Band: "20m"}, formatter.MessageType("fldigi"))
+
+	// Raw mode: the line endings arrive as sent, without output processing
+	want := "G4ABC 40m\r\nW9XYZ 20m\r\n"
+	master.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(master, got); err != nil || string(got) != want {
+		t.Errorf("port received %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	_, path := openPTY(t)
+	if err := Check(path, 9600); err != nil {
+		t.Errorf("Check(%s) failed: %v", path, err)
+	}
+	if err := Check("/dev/null", 9600); err == nil {
+		t.Error("Check succeeded for a device that isn't a serial port")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package comport
+
+import (
+	"errors"
+	"os"
+)
+
+// open is not available: serial ports are only configured on Linux and
+// Windows
+func open(path string, baud int) (*os.File, error) {
+	return nil, errors.New("serial ports are only supported on Linux and Windows")
+}
@@ -0,0 +1,92 @@
+package comport
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// GetCommState and SetCommState are not wrapped by x/sys/windows
+var (
+	kernel32         = windows.NewLazySystemDLL("kernel32.dll")
+	procGetCommState = kernel32.NewProc("GetCommState")
+	procSetCommState = kernel32.NewProc("SetCommState")
+)
+
+// dcb is the Win32 DCB structure describing a serial port's settings
+type dcb struct {
+	DCBlength  uint32
+	BaudRate   uint32
+	Flags      uint32 // fBinary, fParity, flow control and the other bit fields
+	wReserved  uint16
+	XonLim     uint16
+	XoffLim    uint16
+	ByteSize   byte
+	Parity     byte
+	StopBits   byte
+	XonChar    byte
+	XoffChar   byte
+	ErrorChar  byte
+	EofChar    byte
+	EvtChar    byte
+	wReserved1 uint16
+}
+
+// DCB flags: binary mode with DTR and RTS held on, and no flow control
+const (
+	dcbBinary        = 1 << 0
+	dcbDTRControlOn  = 1 << 4
+	dcbRTSControlOn  = 1 << 12
+	noParity         = 0
+	oneStopBit       = 0
+	dataBits         = 8
+	devicePathPrefix = `\\.\`
+)
+
+// open opens a COM port for writing in 8N1 mode at baud, without flow
+// control. Writes time out after writeTimeout, since Windows doesn't
+// support write deadlines on COM ports.
+func open(path string, baud int) (*os.File, error) {
+	if !ValidBaud(baud) {
+		return nil, fmt.Errorf("unsupported baud rate %d", baud)
+	}
+
+	// COM10 and up are only reachable through the device namespace
+	name := path
+	if !strings.HasPrefix(name, devicePathPrefix) {
+		name = devicePathPrefix + name
+	}
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	state := dcb{DCBlength: uint32(unsafe.Sizeof(dcb{}))}
+	if r, _, err := procGetCommState.Call(uintptr(h), uintptr(unsafe.Pointer(&state))); r == 0 {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("not a serial port: %w", err)
+	}
+	state.BaudRate = uint32(baud)
+	state.Flags = dcbBinary | dcbDTRControlOn | dcbRTSControlOn
+	state.ByteSize = dataBits
+	state.Parity = noParity
+	state.StopBits = oneStopBit
+	if r, _, err := procSetCommState.Call(uintptr(h), uintptr(unsafe.Pointer(&state))); r == 0 {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("configuring the port: %w", err)
+	}
+
+	timeouts := windows.CommTimeouts{WriteTotalTimeoutConstant: uint32(writeTimeout.Milliseconds())}
+	if err := windows.SetCommTimeouts(h, &timeouts); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("configuring the port: %w", err)
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
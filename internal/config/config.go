@@ -1,27 +1,197 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/comport"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/scoring"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
+// TargetConfig describes one destination for relayed QSOs
+type TargetConfig struct {
+	Address  string `yaml:"address" mapstructure:"address" json:"address"`
+	Port     int    `yaml:"port" mapstructure:"port" json:"port"`
+	Format   string `yaml:"format" mapstructure:"format" json:"format"`                 // Output format: n1mm, wintest, dxlog, adif, relay
+	Protocol string `yaml:"protocol" mapstructure:"protocol" json:"protocol,omitempty"` // udp (default), tcp or tls; tcp and tls need the relay format or framing
+
+	// How consumers that join messages into a stream tell them apart: line
+	// (newline after each), length (4-byte big-endian length before each)
+	// or cobs (COBS encoded, zero byte after each). Empty sends UDP
+	// datagrams as they are; tcp and tls targets in the relay format are
+	// always line framed.
+	Framing string `yaml:"framing" mapstructure:"framing" json:"framing,omitempty"`
+
+	// How dB reports (FT8 -05) are sent: keep (default), rst (as 599) or
+	// comment (as 599, with the dB reports in the comment)
+	SNRReports string `yaml:"snr_reports" mapstructure:"snr_reports" json:"snr_reports,omitempty"`
+
+	// Loggers that answer each datagram: wait this long for the reply to a
+	// QSO and record it in the journal and stats; 0 sends without waiting.
+	// A reply matching response_error (by default one mentioning an error,
+	// failure or rejection) counts as a failed send. UDP targets only.
+	ResponseTimeout time.Duration `yaml:"response_timeout" mapstructure:"response_timeout" json:"response_timeout,omitempty"`
+	ResponseError   string        `yaml:"response_error" mapstructure:"response_error" json:"response_error,omitempty"` // Regular expression for error replies, case-insensitive
+
+	// Special event stations: send a target only the QSOs made under these
+	// station calls or by these operators. Empty lists match every QSO.
+	MyCalls   []string `yaml:"my_calls" mapstructure:"my_calls" json:"my_calls,omitempty"`
+	Operators []string `yaml:"operators" mapstructure:"operators" json:"operators,omitempty"`
+
+	// Multi-homed hosts: send from this interface's IPv4 address, or from
+	// this local address, so broadcasts leave on the right subnet. Empty
+	// lets the OS choose by its routes.
+	Interface    string `yaml:"interface" mapstructure:"interface" json:"interface,omitempty"`
+	LocalAddress string `yaml:"local_address" mapstructure:"local_address" json:"local_address,omitempty"`
+}
+
+// ListenerConfig is an additional UDP port the relay receives on
+type ListenerConfig struct {
+	Address    string `yaml:"address" mapstructure:"address" json:"address"`
+	Port       int    `yaml:"port" mapstructure:"port" json:"port"`
+	SourceType string `yaml:"source_type" mapstructure:"source_type" json:"source_type,omitempty"` // Parse everything received as this type, skipping detection; empty or auto detects
+	ReusePort  bool   `yaml:"reuse_port" mapstructure:"reuse_port" json:"reuse_port,omitempty"`    // Share the port with other programs that also allow it
+	Interface  string `yaml:"interface" mapstructure:"interface" json:"interface,omitempty"`       // Bind this interface's IPv4 address instead of address, e.g. eth1
+
+	// Join a multicast group instead of binding address, e.g. WSJT-X set to
+	// send to 239.255.0.1
+	MulticastGroup     string `yaml:"multicast_group" mapstructure:"multicast_group" json:"multicast_group,omitempty"`
+	MulticastInterface string `yaml:"multicast_interface" mapstructure:"multicast_interface" json:"multicast_interface,omitempty"` // Interface name to join on, e.g. eth0; empty lets the OS choose
+
+	// Raw listeners repeat datagrams unchanged instead of parsing them
+	Raw     bool     `yaml:"raw" mapstructure:"raw" json:"raw,omitempty"`
+	Forward []string `yaml:"forward" mapstructure:"forward" json:"forward,omitempty"` // host:port to repeat to; empty sends to every target
+	Prepend string   `yaml:"prepend" mapstructure:"prepend" json:"prepend,omitempty"` // Bytes added before each datagram
+	Append  string   `yaml:"append" mapstructure:"append" json:"append,omitempty"`    // Bytes added after each datagram, e.g. "\r\n"
+}
+
+// SourceOverride sets the station identity for QSOs from matching sources.
+// Empty match fields match anything; empty identity fields keep the default.
+type SourceOverride struct {
+	Source   string `yaml:"source" mapstructure:"source" json:"source"` // Source IP address or CIDR, e.g. 192.168.1.21 or 192.168.1.0/24
+	Type     string `yaml:"type" mapstructure:"type" json:"type"`       // Detected source type, e.g. wsjt-x
+	Station  string `yaml:"station" mapstructure:"station" json:"station"`
+	Operator string `yaml:"operator" mapstructure:"operator" json:"operator"`
+	Contest  string `yaml:"contest" mapstructure:"contest" json:"contest"`
+
+	// N1MM network identity of the computer the source runs on
+	StationName string `yaml:"station_name" mapstructure:"station_name" json:"station_name,omitempty"`
+	NetBiosName string `yaml:"netbios_name" mapstructure:"netbios_name" json:"netbios_name,omitempty"`
+	RadioNr     int    `yaml:"radio_nr" mapstructure:"radio_nr" json:"radio_nr,omitempty"`
+}
+
+// CallAlias credits QSOs an operator logged under their own call to a club
+// call. The conditions that are set must all match.
+type CallAlias struct {
+	Call     string `yaml:"call" mapstructure:"call" json:"call"`                 // Call the source logs under (mycall, STATION_CALLSIGN) or as operator
+	Station  string `yaml:"station" mapstructure:"station" json:"station"`        // Club call sent as mycall
+	Operator string `yaml:"operator" mapstructure:"operator" json:"operator"`     // Operator sent; empty sends call
+	Source   string `yaml:"source" mapstructure:"source" json:"source,omitempty"` // Source IP address or CIDR; empty matches any
+	From     string `yaml:"from" mapstructure:"from" json:"from,omitempty"`       // UTC start of the QSOs, "2024-06-22 18:00", or "18:00" for every day
+	Until    string `yaml:"until" mapstructure:"until" json:"until,omitempty"`    // UTC end, in the same form as from
+}
+
+// FieldMapping rewrites fields of parsed QSOs before they are formatted,
+// e.g. to put a JS8Call grid into N1MM's exchange1. The conditions that are
+// set must all match.
+type FieldMapping struct {
+	Source string            `yaml:"source" mapstructure:"source" json:"source,omitempty"` // Source IP address or CIDR
+	Type   string            `yaml:"type" mapstructure:"type" json:"type,omitempty"`       // Detected source type, e.g. js8call
+	Match  map[string]string `yaml:"match" mapstructure:"match" json:"match,omitempty"`    // Field name to regular expression, case-insensitive
+	Set    map[string]string `yaml:"set" mapstructure:"set" json:"set"`                    // Field name to template, e.g. exchange: "{{.grid}}"
+}
+
+// DedupRule recognizes repeats of QSOs from one type of source, in place of
+// the dedup settings. Fields and scope left empty are taken from them.
+type DedupRule struct {
+	Type   string        `yaml:"type" mapstructure:"type"`     // Detected source type, e.g. varac
+	Window time.Duration `yaml:"window" mapstructure:"window"` // How long a forwarded QSO blocks its repeats; 0 lets them through
+	Fields []string      `yaml:"fields" mapstructure:"fields"` // QSO fields that must match, e.g. callsign, band, mode
+	Scope  string        `yaml:"scope" mapstructure:"scope"`   // relay or target
+}
+
+// OverlayConfig themes the control API's streaming overlay page. Colors
+// and the font are CSS values; empty ones come from the theme.
+type OverlayConfig struct {
+	Title      string   `yaml:"title" mapstructure:"title"`           // Heading, e.g. "W1AW Field Day"; empty shows none
+	Theme      string   `yaml:"theme" mapstructure:"theme"`           // dark, light or transparent
+	Background string   `yaml:"background" mapstructure:"background"` // e.g. "rgba(0, 0, 0, 0.6)"
+	Text       string   `yaml:"text" mapstructure:"text"`
+	Accent     string   `yaml:"accent" mapstructure:"accent"` // Callsign and numbers
+	Font       string   `yaml:"font" mapstructure:"font"`     // CSS font-family
+	FontSize   int      `yaml:"font_size" mapstructure:"font_size"`
+	Show       []string `yaml:"show" mapstructure:"show"` // last_qso, count, rate, band, in order
+}
+
+// DetectionRule classifies incoming messages. All conditions that are set
+// must match; text is compared case-insensitively.
+type DetectionRule struct {
+	Name        string   `yaml:"name" mapstructure:"name" json:"name"`                                   // Same name as a built-in rule replaces it
+	Type        string   `yaml:"type" mapstructure:"type" json:"type"`                                   // Source type to assign, e.g. fldigi; general ignores the message
+	Magic       string   `yaml:"magic" mapstructure:"magic" json:"magic,omitempty"`                      // Leading bytes in hex, e.g. adbccbda
+	Contains    []string `yaml:"contains" mapstructure:"contains" json:"contains,omitempty"`             // All of these
+	ContainsAny []string `yaml:"contains_any" mapstructure:"contains_any" json:"contains_any,omitempty"` // At least one of these
+	NotContains []string `yaml:"not_contains" mapstructure:"not_contains" json:"not_contains,omitempty"` // None of these
+	Regex       string   `yaml:"regex" mapstructure:"regex" json:"regex,omitempty"`                      // Go regular expression
+	Before      string   `yaml:"before" mapstructure:"before" json:"before,omitempty"`                   // Check just before this rule; default is before all built-ins
+}
+
+// SourceKey is the shared secret a source signs its datagrams with
+type SourceKey struct {
+	Source string `yaml:"source" mapstructure:"source" json:"source"` // Source IP address or CIDR; empty matches any source
+	Secret string `yaml:"secret" mapstructure:"secret" json:"secret"`
+}
+
 // Config holds the application configuration
 type Config struct {
 	Listen struct {
-		Address string `yaml:"address" mapstructure:"address"`
-		Port    int    `yaml:"port" mapstructure:"port"`
+		Address       string `yaml:"address" mapstructure:"address"`
+		Port          int    `yaml:"port" mapstructure:"port"`
+		BufferSize    int    `yaml:"buffer_size" mapstructure:"buffer_size"`       // Largest datagram accepted, up to 65536 bytes
+		Workers       int    `yaml:"workers" mapstructure:"workers"`               // Goroutines processing datagrams
+		QueueSize     int    `yaml:"queue_size" mapstructure:"queue_size"`         // Datagrams waiting per queue; reads pause when full
+		PreserveOrder bool   `yaml:"preserve_order" mapstructure:"preserve_order"` // Forward each source's QSOs in the order received
+		ReusePort     bool   `yaml:"reuse_port" mapstructure:"reuse_port"`         // Share the port with other programs that also allow it (SO_REUSEADDR/SO_REUSEPORT)
+		Interface     string `yaml:"interface" mapstructure:"interface"`           // Bind this interface's IPv4 address instead of address, e.g. eth1
+
+		ReceiveBuffer int           `yaml:"receive_buffer" mapstructure:"receive_buffer"` // Kernel receive buffer (SO_RCVBUF) of every listener in bytes; 0 keeps the OS default
+		DropCheck     time.Duration `yaml:"drop_check" mapstructure:"drop_check"`         // How often to read the kernel's drop counters (Linux); 0 disables
+
+		MulticastGroup     string `yaml:"multicast_group" mapstructure:"multicast_group"`         // Join this group instead of binding address, e.g. 239.255.0.1
+		MulticastInterface string `yaml:"multicast_interface" mapstructure:"multicast_interface"` // Interface name to join on; empty lets the OS choose
 	} `yaml:"listen" mapstructure:"listen"`
 
-	Target struct {
-		Address string `yaml:"address" mapstructure:"address"`
-		Port    int    `yaml:"port" mapstructure:"port"`
-	} `yaml:"target" mapstructure:"target"`
+	// Additional ports to receive on, e.g. one per application
+	Listeners []ListenerConfig `yaml:"listeners" mapstructure:"listeners"`
+
+	Target TargetConfig `yaml:"target" mapstructure:"target"`
+
+	// Additional targets that receive every relayed QSO alongside Target
+	Targets []TargetConfig `yaml:"targets" mapstructure:"targets"`
 
 	Verbose bool `yaml:"verbose" mapstructure:"verbose"`
 
+	// Log output
+	Log struct {
+		Format    string `yaml:"format" mapstructure:"format"`         // text, json, or auto (json inside a container)
+		Output    string `yaml:"output" mapstructure:"output"`         // stdout, stderr, or auto (stdout inside a container)
+		Trace     bool   `yaml:"trace" mapstructure:"trace"`           // Dump every datagram and what became of it
+		TraceFile string `yaml:"trace_file" mapstructure:"trace_file"` // Write the trace here instead of the log
+		Console   string `yaml:"console" mapstructure:"console"`       // One short line per relayed QSO on stdout instead of the log lines: on, off, or auto (on when stdout is a terminal)
+
+		// Levels sets the log level of each module (relay, formatter,
+		// enrichment, sinks, or all) to info or debug, over verbose
+		Levels map[string]string `yaml:"levels" mapstructure:"levels"`
+	} `yaml:"log" mapstructure:"log"`
+
 	// Message formatting options
 	Formatting struct {
 		// Source format detection
@@ -33,66 +203,711 @@ type Config struct {
 			Station  string `yaml:"station" mapstructure:"station"`
 			Operator string `yaml:"operator" mapstructure:"operator"`
 			Contest  string `yaml:"contest" mapstructure:"contest"`
+
+			// Multi-computer networks attribute contacts to a PC by these
+			StationName string `yaml:"station_name" mapstructure:"station_name"` // N1MM station (computer) name; empty uses the station callsign
+			NetBiosName string `yaml:"netbios_name" mapstructure:"netbios_name"` // Computer's NetBIOS name; empty uses station_name
+			RadioNr     int    `yaml:"radio_nr" mapstructure:"radio_nr"`         // Radio number for SO2R; default 1
+
+			// How the relay identifies itself and its QSOs
+			App    string `yaml:"app" mapstructure:"app"`         // contactinfo app name; "{version}" is replaced by the relay version
+			SendID bool   `yaml:"send_id" mapstructure:"send_id"` // Send a unique ID (GUID) with each QSO
+
+			// Send RadioInfo to n1mm targets when a QSO or WSJT-X status is on a new band
+			BandChanges bool `yaml:"band_changes" mapstructure:"band_changes"`
 		} `yaml:"n1mm" mapstructure:"n1mm"`
+
+		// Per-source station/operator/contest; the first matching entry wins
+		Overrides []SourceOverride `yaml:"overrides" mapstructure:"overrides"`
+
+		// Personal calls credited to a club call; the first matching entry wins
+		CallAliases []CallAlias `yaml:"call_aliases" mapstructure:"call_aliases"`
+
+		// Field rewrites after parsing; every matching entry applies, in order
+		Mappings []FieldMapping `yaml:"mappings" mapstructure:"mappings"`
+
+		// Timestamp handling options
+		Time struct {
+			// Time zone assumed for each source type's timestamps (e.g. n1mm: "America/New_York")
+			SourceTimezones map[string]string `yaml:"source_timezones" mapstructure:"source_timezones"`
+			OutputUTC       bool              `yaml:"output_utc" mapstructure:"output_utc"`             // Always emit UTC timestamps
+			UseReceiveTime  bool              `yaml:"use_receive_time" mapstructure:"use_receive_time"` // Stamp QSOs with relay receive time
+			DriftThreshold  time.Duration     `yaml:"drift_threshold" mapstructure:"drift_threshold"`   // Correct timestamps further than this from the relay clock; 0 disables
+			DriftAction     string            `yaml:"drift_action" mapstructure:"drift_action"`         // replace (use relay time) or clamp (move to the threshold)
+
+			// Logged QSOs older than max_age, e.g. a log a source replays when
+			// it starts, are dropped or forwarded with a note in the comment;
+			// accept_old (or --accept-old) lets them through
+			MaxAge       time.Duration `yaml:"max_age" mapstructure:"max_age"`               // 0 disables
+			MaxAgeAction string        `yaml:"max_age_action" mapstructure:"max_age_action"` // drop or flag
+			AcceptOld    bool          `yaml:"accept_old" mapstructure:"accept_old"`         // Forward old QSOs anyway, e.g. while importing a log
+		} `yaml:"time" mapstructure:"time"`
+
+		// Signal report defaults and normalization
+		RST struct {
+			Defaults    map[string]string `yaml:"defaults" mapstructure:"defaults"`         // Default report per mode (e.g. SSB: "59")
+			NormalizeDB bool              `yaml:"normalize_db" mapstructure:"normalize_db"` // Pad dB reports to sign+two digits
+		} `yaml:"rst" mapstructure:"rst"`
+
+		// Callsign checks
+		Callsign struct {
+			RejectInvalid bool `yaml:"reject_invalid" mapstructure:"reject_invalid"` // Drop QSOs whose callsign fails validation
+		} `yaml:"callsign" mapstructure:"callsign"`
+
+		// Plain text log lines from legacy programs (DigiPan, MixW, ...)
+		TextLog struct {
+			Format string `yaml:"format" mapstructure:"format"` // e.g. "{date} {time} {call} {freq} {mode} {rst_sent} {rst_rcvd}"; empty disables
+		} `yaml:"textlog" mapstructure:"textlog"`
+
+		// VarAC broadcasts that aren't QSOs
+		VarAC struct {
+			Events string `yaml:"events" mapstructure:"events"` // Beacons, pings and CQs: drop, count (drop and count them in the stats) or spot (forward as N1MM spots)
+		} `yaml:"varac" mapstructure:"varac"`
+
+		// N1MM broadcasts that aren't contacts, e.g. when listening on N1MM's
+		// "all messages" port: ignore (drop and count them in the stats),
+		// convert, or pass (send unchanged to n1mm targets)
+		N1MMBroadcasts struct {
+			RadioInfo  string `yaml:"radioinfo" mapstructure:"radioinfo"`   // ignore or pass
+			Spot       string `yaml:"spot" mapstructure:"spot"`             // ignore, convert (relay as a spot) or pass
+			LookupInfo string `yaml:"lookupinfo" mapstructure:"lookupinfo"` // ignore, convert (learn the exchange for exchange.lookup) or pass
+			Score      string `yaml:"score" mapstructure:"score"`           // dynamicresults: ignore or pass
+			AppInfo    string `yaml:"appinfo" mapstructure:"appinfo"`       // ignore or pass
+		} `yaml:"n1mm_broadcasts" mapstructure:"n1mm_broadcasts"`
+
+		// Message type detection rules used with auto_detect
+		Detection struct {
+			Rules   []DetectionRule `yaml:"rules" mapstructure:"rules"`     // Custom rules, checked in order
+			Disable []string        `yaml:"disable" mapstructure:"disable"` // Built-in rules to leave out, e.g. varac-json
+		} `yaml:"detection" mapstructure:"detection"`
+
+		// N1MM XML layout
+		XML struct {
+			Indent      bool   `yaml:"indent" mapstructure:"indent"`           // One indented element per line instead of compact single-line XML
+			Declaration bool   `yaml:"declaration" mapstructure:"declaration"` // Prefix messages with <?xml version="1.0" encoding="utf-8"?>
+			FieldOrder  string `yaml:"field_order" mapstructure:"field_order"` // n1mm (N1MM's own element order) or legacy
+		} `yaml:"xml" mapstructure:"xml"`
+
+		// ADIF and DXLog output checks
+		ADIF struct {
+			Strict bool `yaml:"strict" mapstructure:"strict"` // Refuse QSOs whose ADIF fails ADIF 3.1.4 validation instead of sending them
+		} `yaml:"adif" mapstructure:"adif"`
+
+		// Received exchange handling
+		Exchange struct {
+			Lookup bool `yaml:"lookup" mapstructure:"lookup"` // Prefill missing exchanges from earlier QSOs and N1MM lookupinfo
+
+			// Exchange parser per contest (e.g. SKCC-WES: skcc); contests not listed are chosen by name
+			Parsers map[string]string `yaml:"parsers" mapstructure:"parsers"`
+		} `yaml:"exchange" mapstructure:"exchange"`
+
+		// Super Check Partial callsign checks
+		SCP struct {
+			File        string `yaml:"file" mapstructure:"file"`                 // MASTER.SCP path; empty disables the check
+			MaxDistance int    `yaml:"max_distance" mapstructure:"max_distance"` // Edits allowed between a call and a known call
+			AutoCorrect bool   `yaml:"auto_correct" mapstructure:"auto_correct"` // Replace the call when there is a single candidate
+		} `yaml:"scp" mapstructure:"scp"`
 	} `yaml:"formatting" mapstructure:"formatting"`
 
+	// Journal of relayed QSOs, used for replay
+	Journal struct {
+		Path string `yaml:"path" mapstructure:"path"` // JSON-lines file; empty disables the journal
+	} `yaml:"journal" mapstructure:"journal"`
+
+	// JS8Call directed messages, kept apart from QSOs
+	Messages struct {
+		Path       string `yaml:"path" mapstructure:"path"`             // CSV file; empty discards directed messages
+		Heartbeats bool   `yaml:"heartbeats" mapstructure:"heartbeats"` // Also keep @HB heartbeats
+	} `yaml:"messages" mapstructure:"messages"`
+
+	// Worked-before database of calls, band/mode slots and DXCC entities
+	WorkedDB struct {
+		Enabled  bool   `yaml:"enabled" mapstructure:"enabled"`
+		Path     string `yaml:"path" mapstructure:"path"`         // JSON-lines file; seed it with the import-worked command
+		Annotate bool   `yaml:"annotate" mapstructure:"annotate"` // Prefix comments with NEW DXCC, NEW CALL or NEW BAND/MODE
+	} `yaml:"worked_db" mapstructure:"worked_db"`
+
+	// Counters and rates, persisted across restarts
+	Stats struct {
+		Path         string        `yaml:"path" mapstructure:"path"`                   // JSON file the counters are saved to; empty keeps them in memory only
+		SaveInterval time.Duration `yaml:"save_interval" mapstructure:"save_interval"` // How often the counters are saved
+		CTYFile      string        `yaml:"cty_file" mapstructure:"cty_file"`           // cty.dat for DXCC multipliers in the rate meter; alerts.cty_file also works
+		ErrorSamples int           `yaml:"error_samples" mapstructure:"error_samples"` // How many recent parse failures to keep for the errors command; 0 keeps none
+		LatencyWarn  time.Duration `yaml:"latency_warn" mapstructure:"latency_warn"`   // Log a warning when a QSO is forwarded longer than this after its timestamp; 0 disables
+	} `yaml:"stats" mapstructure:"stats"`
+
+	// Contest points and multipliers in the N1MM contactinfo
+	Scoring struct {
+		Contest string `yaml:"contest" mapstructure:"contest"` // cqww, arrldx, wpx, fieldday, or auto (from formatting.n1mm.contest); empty disables
+	} `yaml:"scoring" mapstructure:"scoring"`
+
+	// Sent serial numbers for contests whose exchange has one
+	Serial struct {
+		Mode  string `yaml:"mode" mapstructure:"mode"`   // off, auto (when the QSO's contest has a serial exchange) or on
+		Path  string `yaml:"path" mapstructure:"path"`   // File the last serial is saved to so numbering survives restarts; empty keeps it in memory
+		Start int    `yaml:"start" mapstructure:"start"` // First serial number
+	} `yaml:"serial" mapstructure:"serial"`
+
+	// Hold parsed QSOs for the operator to check before they are forwarded
+	Review struct {
+		Enabled bool          `yaml:"enabled" mapstructure:"enabled"`
+		Timeout time.Duration `yaml:"timeout" mapstructure:"timeout"` // Forward a QSO nobody has reviewed after this long; 0 holds it until released
+	} `yaml:"review" mapstructure:"review"`
+
+	// Drop repeats of QSOs already forwarded, e.g. a QSO logged twice or
+	// sent by two programs
+	Dedup struct {
+		Enabled bool          `yaml:"enabled" mapstructure:"enabled"`
+		Window  time.Duration `yaml:"window" mapstructure:"window"` // How long a forwarded QSO blocks its repeats
+		Fields  []string      `yaml:"fields" mapstructure:"fields"` // QSO fields that must match, e.g. callsign, band, mode
+		Scope   string        `yaml:"scope" mapstructure:"scope"`   // relay (a repeat goes to no target) or target (each target gets a QSO once)
+		Rules   []DedupRule   `yaml:"rules" mapstructure:"rules"`   // Per source type; the first matching rule applies
+	} `yaml:"dedup" mapstructure:"dedup"`
+
+	// Daily ADIF archive of forwarded QSOs
+	Archive struct {
+		Enabled       bool   `yaml:"enabled" mapstructure:"enabled"`
+		Directory     string `yaml:"directory" mapstructure:"directory"`           // One YYYY-MM-DD.adi file per UTC day
+		RetentionDays int    `yaml:"retention_days" mapstructure:"retention_days"` // Delete older files; 0 keeps everything
+	} `yaml:"archive" mapstructure:"archive"`
+
+	// Remote control REST API
+	Control struct {
+		Enabled bool   `yaml:"enabled" mapstructure:"enabled"`
+		Address string `yaml:"address" mapstructure:"address"` // Must be a loopback address
+		Token   string `yaml:"token" mapstructure:"token"`     // Bearer token; generated at startup if empty
+		Grid    string `yaml:"grid" mapstructure:"grid"`       // This station's locator, where /api/map paths and rotator headings start
+
+		// The page served at /overlay, for OBS browser sources
+		Overlay OverlayConfig `yaml:"overlay" mapstructure:"overlay"`
+	} `yaml:"control" mapstructure:"control"`
+
+	// Reverse bridge for N1MM's own broadcasts
+	Bridge struct {
+		Enabled       bool     `yaml:"enabled" mapstructure:"enabled"`
+		ListenAddress string   `yaml:"listen_address" mapstructure:"listen_address"`
+		ListenPort    int      `yaml:"listen_port" mapstructure:"listen_port"`         // Where N1MM's Broadcast Data is sent
+		Forward       []string `yaml:"forward" mapstructure:"forward"`                 // host:port to pass N1MM broadcasts through to
+		WSJTXModeSync bool     `yaml:"wsjtx_mode_sync" mapstructure:"wsjtx_mode_sync"` // Push N1MM mode changes to WSJT-X
+	} `yaml:"bridge" mapstructure:"bridge"`
+
+	// Winlink Express / VARA session log ingestion
+	Winlink struct {
+		Enabled      bool          `yaml:"enabled" mapstructure:"enabled"`
+		LogFiles     []string      `yaml:"log_files" mapstructure:"log_files"`         // Glob patterns for session log files
+		Mode         string        `yaml:"mode" mapstructure:"mode"`                   // Mode used when the log doesn't name one
+		PollInterval time.Duration `yaml:"poll_interval" mapstructure:"poll_interval"` // How often to check the logs for new lines
+	} `yaml:"winlink" mapstructure:"winlink"`
+
+	// Logged QSOs read from fldigi's XML-RPC interface
+	Fldigi struct {
+		Enabled      bool          `yaml:"enabled" mapstructure:"enabled"`
+		Address      string        `yaml:"address" mapstructure:"address"`             // fldigi XML-RPC host:port
+		PollInterval time.Duration `yaml:"poll_interval" mapstructure:"poll_interval"` // How often to check fldigi's log entry
+	} `yaml:"fldigi" mapstructure:"fldigi"`
+
+	// APRS-IS status reports for logged QSOs
+	APRS struct {
+		Enabled     bool          `yaml:"enabled" mapstructure:"enabled"`
+		Server      string        `yaml:"server" mapstructure:"server"`             // APRS-IS server host:port
+		Callsign    string        `yaml:"callsign" mapstructure:"callsign"`         // Login and packet source, e.g. N7AKG-7
+		Passcode    string        `yaml:"passcode" mapstructure:"passcode"`         // APRS-IS passcode for the callsign
+		Mode        string        `yaml:"mode" mapstructure:"mode"`                 // qso (packet per QSO) or summary (periodic count)
+		Interval    time.Duration `yaml:"interval" mapstructure:"interval"`         // Summary interval
+		MinInterval time.Duration `yaml:"min_interval" mapstructure:"min_interval"` // Minimum time between packets
+	} `yaml:"aprs" mapstructure:"aprs"`
+
+	// Online scoreboard posting of N1MM's score broadcasts
+	Scoreboard struct {
+		Enabled  bool          `yaml:"enabled" mapstructure:"enabled"`
+		Boards   []string      `yaml:"boards" mapstructure:"boards"`     // contestonlinescore, cqcontest or http(s) URLs
+		Interval time.Duration `yaml:"interval" mapstructure:"interval"` // Time between posts of a changed score
+		Retries  int           `yaml:"retries" mapstructure:"retries"`   // Further attempts at a failed post before the next interval
+	} `yaml:"scoreboard" mapstructure:"scoreboard"`
+
+	// A summary line per logged QSO on a serial port, for hardware displays
+	// and embedded loggers
+	SerialPort struct {
+		Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`
+		Port       string `yaml:"port" mapstructure:"port"`               // Device, e.g. /dev/ttyUSB0
+		Baud       int    `yaml:"baud" mapstructure:"baud"`               // 8 data bits, no parity, 1 stop bit
+		Template   string `yaml:"template" mapstructure:"template"`       // Line layout, e.g. "{{.time}} {{.callsign}} {{.band}}"
+		LineEnding string `yaml:"line_ending" mapstructure:"line_ending"` // crlf, lf or cr
+	} `yaml:"serial_port" mapstructure:"serial_port"`
+
+	// Notifications for events that need attention on unattended relays
+	Alerts struct {
+		Enabled                bool          `yaml:"enabled" mapstructure:"enabled"`
+		Events                 []string      `yaml:"events" mapstructure:"events"`                                       // new_dxcc, parse_failures, target_unreachable, no_packets; empty enables all
+		CTYFile                string        `yaml:"cty_file" mapstructure:"cty_file"`                                   // cty.dat country file, needed for new_dxcc
+		ParseFailuresPerMinute int           `yaml:"parse_failures_per_minute" mapstructure:"parse_failures_per_minute"` // Parse failures in a minute that raise an alert
+		TargetFailures         int           `yaml:"target_failures" mapstructure:"target_failures"`                     // Consecutive send failures before a target is unreachable
+		Cooldown               time.Duration `yaml:"cooldown" mapstructure:"cooldown"`                                   // Minimum time between repeats of the same alert
+		Desktop                bool          `yaml:"desktop" mapstructure:"desktop"`                                     // Desktop notifications
+		Telegram               struct {
+			BotToken string `yaml:"bot_token" mapstructure:"bot_token"`
+			ChatID   string `yaml:"chat_id" mapstructure:"chat_id"`
+		} `yaml:"telegram" mapstructure:"telegram"`
+		Discord struct {
+			WebhookURL string `yaml:"webhook_url" mapstructure:"webhook_url"`
+		} `yaml:"discord" mapstructure:"discord"`
+	} `yaml:"alerts" mapstructure:"alerts"`
+
+	// Callsign masking for outputs others can see. Messages forwarded to
+	// loggers, chained relays and the journal always keep full callsigns.
+	Privacy struct {
+		RedactCallsigns bool `yaml:"redact_callsigns" mapstructure:"redact_callsigns"` // Mask callsigns (W1ABC -> W1***) in alerts, APRS-IS packets and serial port lines
+	} `yaml:"privacy" mapstructure:"privacy"`
+
+	// Relay-to-relay chaining for multi-site setups
+	Chain struct {
+		NodeID    string `yaml:"node_id" mapstructure:"node_id"`       // Identifies this relay in chained QSO paths and loop markers; defaults to the host name
+		MaxHops   int    `yaml:"max_hops" mapstructure:"max_hops"`     // Drop chained QSOs that have passed through this many relays
+		TCPListen string `yaml:"tcp_listen" mapstructure:"tcp_listen"` // host:port accepting chained QSOs over TCP; empty disables
+
+		// Relay protocol version sent to relay targets, 0 for the newest. TCP
+		// and TLS connections agree on a version by themselves; set 1 for
+		// UDP targets that are older relays.
+		ProtocolVersion int `yaml:"protocol_version" mapstructure:"protocol_version"`
+
+		// TLS for chain connections over public networks. With cert set,
+		// tcp_listen only accepts relays presenting a trusted certificate;
+		// targets with protocol tls always use it. Only certificates are
+		// supported; Go's TLS has no pre-shared keys.
+		TLS struct {
+			Cert         string   `yaml:"cert" mapstructure:"cert"`                 // This relay's certificate (PEM)
+			Key          string   `yaml:"key" mapstructure:"key"`                   // Its private key (PEM)
+			CA           string   `yaml:"ca" mapstructure:"ca"`                     // CA certificate (PEM) that signs the other relays' certificates
+			Fingerprints []string `yaml:"fingerprints" mapstructure:"fingerprints"` // SHA-256 fingerprints of trusted relay certificates, e.g. self-signed ones
+		} `yaml:"tls" mapstructure:"tls"`
+	} `yaml:"chain" mapstructure:"chain"`
+
+	// Shared-secret HMAC verification of incoming datagrams
+	Auth struct {
+		Enabled bool          `yaml:"enabled" mapstructure:"enabled"`
+		Keys    []SourceKey   `yaml:"keys" mapstructure:"keys"`         // Per-source secrets; a source may have several during key rotation
+		Trusted []string      `yaml:"trusted" mapstructure:"trusted"`   // Sources (IP or CIDR) accepted without a signature
+		MaxSkew time.Duration `yaml:"max_skew" mapstructure:"max_skew"` // Largest accepted signature age; 0 disables the check
+	} `yaml:"auth" mapstructure:"auth"`
+
+	// Periodic keepalive datagrams so operators can see the path to each target is alive
+	Heartbeat struct {
+		Enabled  bool          `yaml:"enabled" mapstructure:"enabled"`
+		Interval time.Duration `yaml:"interval" mapstructure:"interval"` // Time between heartbeats
+		Payload  string        `yaml:"payload" mapstructure:"payload"`   // Custom datagram; empty sends an N1MM AppInfo message
+	} `yaml:"heartbeat" mapstructure:"heartbeat"`
+
+	// Warning when the sources go quiet, e.g. WSJT-X stopped broadcasting
+	Watchdog struct {
+		Enabled   bool          `yaml:"enabled" mapstructure:"enabled"`
+		Timeout   time.Duration `yaml:"timeout" mapstructure:"timeout"`     // Time without source packets before the watchdog trips
+		Heartbeat bool          `yaml:"heartbeat" mapstructure:"heartbeat"` // Also send a heartbeat to every target when it trips
+	} `yaml:"watchdog" mapstructure:"watchdog"`
+
+	// Primary/backup failover between two relays; see package cluster
+	Cluster struct {
+		Enabled  bool          `yaml:"enabled" mapstructure:"enabled"`
+		Role     string        `yaml:"role" mapstructure:"role"`         // primary or backup
+		Listen   string        `yaml:"listen" mapstructure:"listen"`     // host:port receiving the other relay's heartbeats
+		Peer     string        `yaml:"peer" mapstructure:"peer"`         // host:port of the other relay's cluster listen address
+		Interval time.Duration `yaml:"interval" mapstructure:"interval"` // Time between heartbeats
+		Timeout  time.Duration `yaml:"timeout" mapstructure:"timeout"`   // Time without an active peer before taking over
+		Secret   string        `yaml:"secret" mapstructure:"secret"`     // Shared secret signing heartbeats; empty sends them unsigned
+	} `yaml:"cluster" mapstructure:"cluster"`
+
+	// Commands sent back to WSJT-X
+	WSJTX struct {
+		// Color stations already worked on the current band and mode
+		Highlight struct {
+			Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`
+			Background string `yaml:"background" mapstructure:"background"` // #rrggbb; empty leaves the background alone
+			Foreground string `yaml:"foreground" mapstructure:"foreground"` // #rrggbb; empty leaves the text color alone
+		} `yaml:"highlight" mapstructure:"highlight"`
+	} `yaml:"wsjtx" mapstructure:"wsjtx"`
+
+	// Per-band summary of the CQ calls WSJT-X decodes
+	Activity struct {
+		Enabled        bool          `yaml:"enabled" mapstructure:"enabled"`
+		Window         time.Duration `yaml:"window" mapstructure:"window"`                   // How far back the summary looks
+		DigestInterval time.Duration `yaml:"digest_interval" mapstructure:"digest_interval"` // Time between logged digests; 0 disables them
+		WebhookURL     string        `yaml:"webhook_url" mapstructure:"webhook_url"`         // POST each digest here as JSON
+	} `yaml:"activity" mapstructure:"activity"`
+
+	// Radio frequency and mode from a Hamlib rigctld daemon
+	Rig struct {
+		Enabled      bool          `yaml:"enabled" mapstructure:"enabled"`
+		Address      string        `yaml:"address" mapstructure:"address"`             // rigctld host:port
+		PollInterval time.Duration `yaml:"poll_interval" mapstructure:"poll_interval"` // Time between frequency/mode polls
+		RadioInfo    bool          `yaml:"radio_info" mapstructure:"radio_info"`       // Send N1MM RadioInfo to n1mm targets when the radio changes
+	} `yaml:"rig" mapstructure:"rig"`
+
+	// Station location from gpsd for rovers and portable operation
+	GPS struct {
+		Enabled   bool   `yaml:"enabled" mapstructure:"enabled"`
+		Address   string `yaml:"address" mapstructure:"address"`     // gpsd host:port
+		Precision int    `yaml:"precision" mapstructure:"precision"` // Grid locator length: 4 (FN31), 6 (FN31pr) or 8
+	} `yaml:"gps" mapstructure:"gps"`
+
+	// Antenna rotator turned toward each QSO's grid square
+	Rotator struct {
+		Enabled    bool    `yaml:"enabled" mapstructure:"enabled"`
+		Protocol   string  `yaml:"protocol" mapstructure:"protocol"`       // rotctld or n1mm (N1MM Rotor's UDP XML)
+		Address    string  `yaml:"address" mapstructure:"address"`         // rotctld or N1MM Rotor host:port
+		Rotor      string  `yaml:"rotor" mapstructure:"rotor"`             // Rotator name in N1MM Rotor
+		InProgress bool    `yaml:"in_progress" mapstructure:"in_progress"` // Also turn when WSJT-X starts calling a station
+		MinChange  float64 `yaml:"min_change" mapstructure:"min_change"`   // Degrees; smaller turns are skipped
+	} `yaml:"rotator" mapstructure:"rotator"`
+
+	// High-throughput mode for QSO bursts (FT8 fox/hound DXpeditions)
+	Performance struct {
+		Enabled      bool `yaml:"enabled" mapstructure:"enabled"`
+		MaxInFlight  int  `yaml:"max_in_flight" mapstructure:"max_in_flight"` // Worker pool size, replacing listen.workers
+		SocketBuffer int  `yaml:"socket_buffer" mapstructure:"socket_buffer"` // Kernel receive/send buffer in bytes; 0 keeps the OS default
+		SendQueue    int  `yaml:"send_queue" mapstructure:"send_queue"`       // Messages queued per target before new ones are dropped
+	} `yaml:"performance" mapstructure:"performance"`
+
+	// Further relay pipelines run in this process, each with its own
+	// listeners, targets and formatting; see buildPipelines
+	Pipelines []map[string]interface{} `yaml:"pipelines" mapstructure:"pipelines"`
+
+	// Include names further config files merged under this one, relative to
+	// it; glob patterns such as stations/*.yaml are read in name order
+	Include []string `yaml:"include" mapstructure:"include"`
+
 	// Metadata (not from config file)
+	// Profile names the entry of the profiles section applied on top of the
+	// rest of the file, e.g. "contest"; empty uses the file as written
+	Profile  string                 `yaml:"profile" mapstructure:"profile"`
+	Profiles map[string]interface{} `yaml:"profiles" mapstructure:"profiles"` // Named sets of settings merged over the file
+
 	ConfigFileUsed string // Path to config file if one was loaded
+	Version        string `mapstructure:"-"` // Relay build version
+
+	Name            string    `mapstructure:"-"` // Pipeline name; empty for the main relay
+	PipelineConfigs []*Config `mapstructure:"-"` // Enabled pipelines, built from Pipelines by Load
 }
 
-// Load loads the configuration from file or creates default configuration
+// EnvPrefix is the prefix of the environment variables that override
+// config keys, e.g. UDP_LOGGER_LISTEN_PORT for listen.port
+const EnvPrefix = "UDP_LOGGER"
+
+// Load loads the configuration from file or creates default configuration.
+// Environment variables override both the defaults and the file.
 func Load(configFile string) (*Config, error) {
+	return load(configFile, true, "")
+}
+
+// LoadProfile loads the configuration like Load and then applies the named
+// profile from the file's profiles section, overriding the profile key
+func LoadProfile(configFile, profile string) (*Config, error) {
+	return load(configFile, true, profile)
+}
+
+// LoadEnv loads the defaults and environment variables only, without
+// looking for a config file. This suits containers where everything is
+// passed through the environment.
+func LoadEnv() (*Config, error) {
+	return load("", false, "")
+}
+
+func load(configFile string, useFile bool, profile string) (*Config, error) {
+	cfg := defaults()
+
+	// Environment variable support. Every key is bound explicitly so that
+	// keys missing from the config file can still be set from the environment.
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	bindEnv(reflect.TypeOf(Config{}), "")
+
+	if useFile {
+		if err := readConfigFile(configFile); err != nil {
+			return nil, err
+		}
+		if profile == "" {
+			profile = viper.GetString("profile")
+		}
+		if err := applyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unmarshal into struct, collecting every problem with the file rather
+	// than stopping at the first
+	problems := unknownKeys(viper.AllSettings(), reflect.TypeOf(Config{}), "")
+	sort.Strings(problems)
+	strict := func(dc *mapstructure.DecoderConfig) { dc.ErrorUnused = true }
+	if err := viper.Unmarshal(cfg, viper.DecodeHook(envDecodeHook), strict); err != nil {
+		problems = append(problems, decodeProblems(err, len(problems) > 0)...)
+	}
+	problems = append(problems, cfg.validate()...)
+	if len(problems) == 0 {
+		problems = cfg.buildPipelines()
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	// Store the config file path that was used
+	if useFile {
+		cfg.ConfigFileUsed = viper.ConfigFileUsed()
+		cfg.Profile = strings.ToLower(profile)
+		for _, pc := range cfg.PipelineConfigs {
+			pc.ConfigFileUsed, pc.Profile = cfg.ConfigFileUsed, cfg.Profile
+		}
+	}
+
+	return cfg, nil
+}
+
+// defaults returns the built-in configuration
+func defaults() *Config {
 	cfg := &Config{}
 
-	// Set defaults
 	cfg.Listen.Address = "0.0.0.0"
 	cfg.Listen.Port = 2333
+	cfg.Listen.BufferSize = 65536
+	cfg.Listen.Workers = 4
+	cfg.Listen.QueueSize = 256
+	cfg.Listen.DropCheck = 30 * time.Second
 	cfg.Target.Address = "127.0.0.1"
 	cfg.Target.Port = 12060
+	cfg.Target.Format = "n1mm"
 	cfg.Verbose = false
+	cfg.Log.Format = "auto"
+	cfg.Log.Output = "auto"
+	cfg.Log.Console = "auto"
 	cfg.Formatting.AutoDetect = true
 	cfg.Formatting.SourceType = "auto"
 	cfg.Formatting.N1MM.Station = "UDP-RELAY"
 	cfg.Formatting.N1MM.Operator = "OP"
 	cfg.Formatting.N1MM.Contest = "GENERAL"
+	cfg.Formatting.N1MM.RadioNr = 1
+	cfg.Formatting.N1MM.App = "N7AKG-UDP-Translator"
+	cfg.Formatting.N1MM.SendID = true
+	cfg.Formatting.Time.OutputUTC = true
+	cfg.Formatting.Time.DriftAction = "replace"
+	cfg.Formatting.Time.MaxAgeAction = "drop"
+	cfg.Formatting.RST.NormalizeDB = true
+	cfg.Formatting.SCP.MaxDistance = 1
+	cfg.Formatting.XML.Declaration = true
+	cfg.Formatting.XML.FieldOrder = "n1mm"
+	cfg.Formatting.VarAC.Events = "count"
+	cfg.Formatting.N1MMBroadcasts.RadioInfo = "ignore"
+	cfg.Formatting.N1MMBroadcasts.Spot = "ignore"
+	cfg.Formatting.N1MMBroadcasts.LookupInfo = "ignore"
+	cfg.Formatting.N1MMBroadcasts.Score = "ignore"
+	cfg.Formatting.N1MMBroadcasts.AppInfo = "ignore"
+	cfg.Dedup.Window = 2 * time.Minute
+	cfg.Dedup.Fields = []string{"callsign", "band", "mode"}
+	cfg.Dedup.Scope = "relay"
+	cfg.Archive.Directory = "logs"
+	cfg.Serial.Mode = "off"
+	cfg.Serial.Path = "serial.json"
+	cfg.Serial.Start = 1
+	cfg.Review.Timeout = 30 * time.Second
+	cfg.Control.Address = "127.0.0.1:8075"
+	cfg.Bridge.ListenAddress = "0.0.0.0"
+	cfg.Bridge.ListenPort = 12061
+	cfg.Bridge.WSJTXModeSync = true
+	cfg.Winlink.Mode = "VARA HF"
+	cfg.Winlink.PollInterval = 2 * time.Second
+	cfg.Fldigi.Address = "127.0.0.1:7362"
+	cfg.Fldigi.PollInterval = time.Second
+	cfg.APRS.Server = "rotate.aprs2.net:14580"
+	cfg.APRS.Mode = "qso"
+	cfg.APRS.Interval = 15 * time.Minute
+	cfg.APRS.MinInterval = time.Minute
+	cfg.Scoreboard.Boards = []string{"contestonlinescore"}
+	cfg.Scoreboard.Interval = 2 * time.Minute
+	cfg.Scoreboard.Retries = 3
+	cfg.Control.Overlay.Theme = "dark"
+	cfg.Control.Overlay.FontSize = 32
+	cfg.Control.Overlay.Show = []string{"last_qso", "count", "rate", "band"}
+	cfg.SerialPort.Baud = 9600
+	cfg.SerialPort.Template = comport.DefaultTemplate
+	cfg.SerialPort.LineEnding = "crlf"
+	cfg.Alerts.ParseFailuresPerMinute = 10
+	cfg.Alerts.TargetFailures = 3
+	cfg.Alerts.Cooldown = 15 * time.Minute
+	cfg.Stats.SaveInterval = time.Minute
+	cfg.Stats.ErrorSamples = 50
+	cfg.WorkedDB.Path = "worked.jsonl"
+	cfg.WorkedDB.Annotate = true
+	cfg.GPS.Address = "127.0.0.1:2947"
+	cfg.GPS.Precision = 4
+	cfg.Chain.MaxHops = 8
+	cfg.Auth.Trusted = []string{"127.0.0.0/8", "::1"}
+	cfg.Auth.MaxSkew = 5 * time.Minute
+	cfg.Heartbeat.Interval = 30 * time.Second
+	cfg.Watchdog.Timeout = 10 * time.Minute
+	cfg.Cluster.Role = "primary"
+	cfg.Cluster.Listen = "0.0.0.0:2335"
+	cfg.Cluster.Interval = time.Second
+	cfg.Cluster.Timeout = 5 * time.Second
+	cfg.WSJTX.Highlight.Background = "#c0c0c0"
+	cfg.WSJTX.Highlight.Foreground = "#000000"
+	cfg.Activity.Window = 15 * time.Minute
+	cfg.Activity.DigestInterval = 15 * time.Minute
+	cfg.Rig.Address = "127.0.0.1:4532"
+	cfg.Rig.PollInterval = time.Second
+	cfg.Rotator.Protocol = "rotctld"
+	cfg.Rotator.Address = "127.0.0.1:4533"
+	cfg.Rotator.MinChange = 5
+	cfg.Performance.MaxInFlight = 64
+	cfg.Performance.SocketBuffer = 4 << 20
+	cfg.Performance.SendQueue = 1024
+
+	return cfg
+}
 
+// readConfigFile reads the given file, or looks for the default config file.
+// A missing default file is not an error.
+func readConfigFile(configFile string) error {
 	if configFile != "" {
 		viper.SetConfigFile(configFile)
 	} else {
 		// Look for config in home directory
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return cfg, nil // Return defaults if can't find home
+		if home, err := os.UserHomeDir(); err == nil {
+			viper.AddConfigPath(home)
 		}
-
-		viper.AddConfigPath(home)
 		viper.AddConfigPath(".")
 		viper.SetConfigType("yaml")
 		viper.SetConfigName(".N7AKG-UDP-Translator")
 	}
 
-	// Environment variable support
-	viper.SetEnvPrefix("UDP_LOGGER")
-	viper.AutomaticEnv()
-
-	// Try to read config file
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Config file not found, use defaults
-			return cfg, nil
+			// Config file not found, use defaults and environment
+			return nil
 		}
-		return nil, fmt.Errorf("error reading config file: %w", err)
+		return fmt.Errorf("error reading config file: %w", err)
 	}
+	return applyIncludes()
+}
 
-	// Unmarshal into struct
-	if err := viper.Unmarshal(cfg); err != nil {
-		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+// applyProfile merges the named profile over the settings read from the
+// file. Environment variables still take precedence over the profile.
+func applyProfile(name string) error {
+	if name == "" {
+		return nil
 	}
 
-	// Store the config file path that was used
-	cfg.ConfigFileUsed = viper.ConfigFileUsed()
+	profiles := viper.GetStringMap("profiles")
+	settings, ok := profiles[strings.ToLower(name)].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q: the config file has no profiles section", name)
+		}
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
 
-	return cfg, nil
+	if err := viper.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("error applying profile %q: %w", name, err)
+	}
+	return nil
+}
+
+// bindEnv binds an environment variable to every leaf key of the config
+// struct, using the mapstructure tags as key names
+func bindEnv(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		key := prefix + tag
+		if field.Type.Kind() == reflect.Struct {
+			bindEnv(field.Type, key+".")
+			continue
+		}
+		viper.BindEnv(key)
+	}
+}
+
+// EnvVar returns the environment variable name for a config key
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envDecodeHook converts string values from the environment into the
+// config's types: durations, comma-separated lists, and JSON for lists of
+// structs (targets), lists of maps (pipelines) and maps
+func envDecodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	str, ok := data.(string)
+	if !ok || from.Kind() != reflect.String {
+		return data, nil
+	}
+
+	switch {
+	case to == reflect.TypeOf(time.Duration(0)):
+		return time.ParseDuration(str)
+	case to.Kind() == reflect.Map, to.Kind() == reflect.Slice && (to.Elem().Kind() == reflect.Struct || to.Elem().Kind() == reflect.Map):
+		if strings.TrimSpace(str) == "" {
+			return reflect.Zero(to).Interface(), nil
+		}
+		value := reflect.New(to)
+		if err := json.Unmarshal([]byte(str), value.Interface()); err != nil {
+			return nil, fmt.Errorf("expected JSON for %s: %w", to, err)
+		}
+		return value.Elem().Interface(), nil
+	case to.Kind() == reflect.Slice:
+		if strings.TrimSpace(str) == "" {
+			return []string{}, nil
+		}
+		parts := strings.Split(str, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts, nil
+	}
+
+	return data, nil
+}
+
+// AllTargets returns the primary target followed by any additional targets
+func (c *Config) AllTargets() []TargetConfig {
+	targets := make([]TargetConfig, 0, 1+len(c.Targets))
+	targets = append(targets, c.Target)
+	for _, t := range c.Targets {
+		if t.Format == "" {
+			t.Format = "n1mm"
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// MainListener returns the listen section as a listener
+func (c *Config) MainListener() ListenerConfig {
+	return ListenerConfig{
+		Address:            c.Listen.Address,
+		Port:               c.Listen.Port,
+		ReusePort:          c.Listen.ReusePort,
+		Interface:          c.Listen.Interface,
+		MulticastGroup:     c.Listen.MulticastGroup,
+		MulticastInterface: c.Listen.MulticastInterface,
+	}
+}
+
+// ScoringContest returns the contest whose rules score QSOs. With auto it is
+// the one formatting.n1mm.contest names; ok is false when scoring is off or
+// auto finds no supported contest.
+func (c *Config) ScoringContest() (contest scoring.Contest, ok bool) {
+	switch c.Scoring.Contest {
+	case "":
+		return "", false
+	case "auto":
+		return scoring.ContestFromName(c.Formatting.N1MM.Contest)
+	}
+	return scoring.Contest(c.Scoring.Contest), true
 }
 
 // SaveDefault saves a default configuration file to the user's home directory
@@ -108,13 +923,38 @@ func SaveDefault() error {
 listen:
   address: "0.0.0.0"
   port: 2333
+  buffer_size: 65536        # largest datagram accepted; larger ones are dropped as truncated
+  workers: 4                # goroutines processing datagrams
+  queue_size: 256
+  preserve_order: false     # forward each source's QSOs strictly in the order received
+  reuse_port: false         # share the port with programs that also allow it
+  interface: ""             # bind this interface's IPv4 address instead, e.g. "eth1"; empty uses address
+  multicast_group: ""       # join e.g. 239.255.0.1 when WSJT-X sends to a multicast group
+  receive_buffer: 0         # SO_RCVBUF in bytes; 0 keeps the OS default
+  drop_check: 30s           # log datagrams the kernel dropped (Linux); 0 disables
+
+listeners: []               # more ports, e.g. {address: "0.0.0.0", port: 2237, source_type: "fldigi"} or {port: 12070, raw: true}
 
 target:
   address: "127.0.0.1"
   port: 12060    # N1MM Logger Plus default UDP port
+  format: "n1mm" # Options: n1mm, wintest, dxlog, adif, relay
+  framing: ""    # line, length or cobs for consumers that split a stream; empty sends plain datagrams
+  interface: ""  # send from this interface's IPv4 address on multi-homed hosts, e.g. "eth1"
+
+# Additional targets, e.g. a Win-Test or DXLog.net station
+targets: []
 
 verbose: false
 
+log:
+  format: "auto"            # text, json, or auto (json when running in a container)
+  output: "auto"            # stdout, stderr, or auto (stdout when running in a container)
+  trace: false              # hex dump of every datagram and what became of it (--trace)
+  trace_file: ""            # write the trace here instead of the log
+  console: "auto"           # one colored line per relayed QSO: on, off, or auto (when stdout is a terminal)
+  levels: {}                # e.g. {formatter: debug} for one module's verbose output
+
 formatting:
   auto_detect: true
   source_type: "auto"  # Options: auto, wsjt-x, fldigi, js8call, etc.
@@ -123,6 +963,272 @@ formatting:
     station: "UDP-RELAY"
     operator: "OP"
     contest: "GENERAL"
+    station_name: ""        # N1MM multi-computer networks: this PC's station name
+    netbios_name: ""        # and NetBIOS name; empty uses station_name
+    radio_nr: 1
+    app: "N7AKG-UDP-Translator" # "{version}" adds the relay version
+    send_id: true           # unique ID (GUID) per QSO
+    band_changes: false     # RadioInfo to n1mm targets when QSOs or WSJT-X change band
+
+  overrides: []             # per-source identity, e.g. {source: "192.168.1.21", operator: "K1ABC"}
+  call_aliases: []          # club call for personal calls, e.g. {call: "K1ABC", station: "W1AW"}
+  mappings: []              # field rewrites, e.g. {type: "js8call", set: {exchange: "{{.grid}}"}}
+
+  time:
+    source_timezones: {}    # e.g. n1mm: "America/New_York" if a source PC logs local time
+    output_utc: true
+    use_receive_time: false
+    drift_threshold: 0s     # e.g. 5m to correct QSOs from PCs with a wrong clock
+    drift_action: "replace" # replace (relay time) or clamp (to the threshold)
+    max_age: 0s             # e.g. 30m to stop logs a source replays at startup
+    max_age_action: "drop"  # drop or flag (note the age in the comment)
+    accept_old: false       # forward old QSOs anyway (also --accept-old)
+
+  rst:
+    defaults: {}            # e.g. SSB: "59", RTTY: "599", FT8: "+00"
+    normalize_db: true
+
+  callsign:
+    reject_invalid: false
+
+  textlog:
+    format: ""              # e.g. "{date} {time} {call} {freq} {mode} {rst_sent} {rst_rcvd}" for DigiPan/MixW lines
+
+  varac:
+    events: count           # beacons, pings and CQs: drop, count, or spot (N1MM spot messages)
+
+  n1mm_broadcasts:          # N1MM messages that aren't contacts: ignore, convert, or pass
+    radioinfo: ignore       # ignore or pass
+    spot: ignore            # convert relays them as spots
+    lookupinfo: ignore      # convert prefills exchanges (exchange.lookup)
+    score: ignore           # dynamicresults; ignore or pass
+    appinfo: ignore         # ignore or pass
+
+  detection:
+    rules: []               # custom detection rules, checked before the built-ins
+    disable: []             # built-in rules to leave out, e.g. ["varac-json"]
+
+  xml:
+    indent: false           # compact single-line XML; some N1MM versions reject indented messages
+    declaration: true       # prefix <?xml version="1.0" encoding="utf-8"?>
+    field_order: "n1mm"     # n1mm (N1MM's own element order) or legacy
+
+  adif:
+    strict: false           # refuse QSOs whose ADIF/DXLog output fails ADIF 3.1.4 validation
+
+  exchange:
+    lookup: false           # prefill missing exchanges from earlier QSOs and N1MM lookupinfo
+    parsers: {}             # per contest: skcc, qso_party, roundup, field_day, grid, eu_vhf, none or auto
+
+  scp:
+    file: ""                # path to MASTER.SCP to flag likely busted calls
+    max_distance: 1
+    auto_correct: false
+
+journal:
+  path: ""                  # e.g. "journal.jsonl" to keep a replayable record of relayed QSOs
+
+# JS8Call directed messages (MSG, QUERY...), never forwarded as QSOs
+messages:
+  path: ""                  # e.g. "messages.csv"; empty discards them
+  heartbeats: false         # also keep @HB heartbeats
+
+worked_db:
+  enabled: false
+  path: "worked.jsonl"      # seed with: N7AKG-UDP-Translator import-worked log.adi
+  annotate: true            # NEW DXCC / NEW CALL / NEW BAND/MODE in comments
+
+stats:
+  path: ""                  # e.g. "stats.json" to keep counters across restarts
+  save_interval: 1m
+  cty_file: ""              # cty.dat to count DXCC multipliers in the rate meter
+  error_samples: 50         # recent parse failures kept for the errors command
+  latency_warn: 0s          # e.g. 2m to warn about sources that hold QSOs back
+
+scoring:
+  contest: ""               # cqww, arrldx, wpx, fieldday or auto; all but fieldday need stats.cty_file
+
+serial:
+  mode: "off"               # off, auto (contests with a serial exchange, e.g. CQ-WPX-CW) or on
+  path: "serial.json"       # last serial sent, so numbering survives restarts
+  start: 1
+
+review:
+  enabled: false            # hold QSOs for correction before forwarding
+  timeout: 30s              # forward unreviewed QSOs after this; 0s waits
+
+dedup:
+  enabled: false            # drop repeats of QSOs already forwarded
+  window: 2m
+  fields: ["callsign", "band", "mode"]
+  scope: "relay"            # relay or target (each target gets a QSO once)
+  rules: []                 # per source type, e.g. {type: "varac", window: 0s}
+
+archive:
+  enabled: false
+  directory: "logs"         # daily ADIF files, e.g. logs/2024-06-01.adi
+  retention_days: 0         # 0 keeps every file
+
+control:
+  enabled: false
+  address: "127.0.0.1:8075"
+  token: ""                 # generated and printed at startup if empty
+  grid: ""                  # this station's locator, e.g. FN31pr, for QSO paths in /api/map
+  overlay:                  # live page for OBS browser sources at /overlay?token=...
+    title: ""
+    theme: "dark"           # dark, light or transparent
+    background: ""          # CSS colors and font override the theme
+    text: ""
+    accent: ""
+    font: ""
+    font_size: 32           # px
+    show: ["last_qso", "count", "rate", "band"]
+
+bridge:
+  enabled: false
+  listen_address: "0.0.0.0"
+  listen_port: 12061        # point N1MM's Broadcast Data here
+  forward: []               # e.g. "127.0.0.1:2237" to pass N1MM broadcasts through
+  wsjtx_mode_sync: true
+
+winlink:
+  enabled: false
+  log_files: []             # e.g. "C:/RMS Express/Logs/*Session*.log"
+  mode: "VARA HF"
+  poll_interval: 2s
+
+fldigi:
+  enabled: false            # read logged QSOs over XML-RPC instead of UDP
+  address: "127.0.0.1:7362"
+  poll_interval: 1s
+
+aprs:
+  enabled: false
+  server: "rotate.aprs2.net:14580"
+  callsign: ""
+  passcode: ""
+  mode: "qso"               # qso or summary
+  interval: 15m             # summary mode only
+  min_interval: 1m
+
+scoreboard:
+  enabled: false            # post N1MM's score broadcasts to online scoreboards
+  boards: ["contestonlinescore"]  # contestonlinescore, cqcontest or http(s) URLs
+  interval: 2m
+  retries: 3
+
+serial_port:
+  enabled: false            # a line per logged QSO for a display or embedded logger
+  port: ""                  # e.g. /dev/ttyUSB0, or COM3 on Windows
+  baud: 9600                # 8N1, no flow control
+  template: "{{.time}} {{.callsign}} {{.band}} {{.mode}} {{.rst_sent}} {{.rst_rcvd}}"
+  line_ending: "crlf"       # crlf, lf or cr
+
+# Alerts for unattended relays (desktop, Telegram or Discord)
+alerts:
+  enabled: false
+  events: []                # new_dxcc, parse_failures, target_unreachable, no_packets; empty for all
+  cty_file: ""              # cty.dat from country-files.com, needed for new_dxcc
+  parse_failures_per_minute: 10
+  target_failures: 3        # failed sends in a row before a target is unreachable
+  cooldown: 15m
+  desktop: false
+  telegram:
+    bot_token: ""
+    chat_id: ""
+  discord:
+    webhook_url: ""
+
+# Mask callsigns in alerts and APRS-IS packets (loggers still get full calls)
+privacy:
+  redact_callsigns: false
+
+# Relay-to-relay chaining (send to a central relay with a "relay" format target)
+chain:
+  node_id: ""               # defaults to the host name
+  max_hops: 8
+  tcp_listen: ""            # e.g. "0.0.0.0:2334" to accept chained QSOs over TCP
+  protocol_version: 0       # 0 for the newest; 1 for older relays behind UDP targets
+  tls:                      # encrypt chain connections; see the cert command
+    cert: ""
+    key: ""
+    ca: ""                  # CA that signs the other relays' certificates
+    fingerprints: []        # or SHA-256 fingerprints of their certificates
+
+# Require HMAC-signed datagrams from remote sources
+auth:
+  enabled: false
+  keys: []                  # - source: "203.0.113.7", secret: "..."
+  trusted: ["127.0.0.0/8", "::1"]
+  max_skew: 5m
+
+# Keepalive datagrams sent to every target
+heartbeat:
+  enabled: false
+  interval: 30s
+  payload: ""               # empty sends N1MM AppInfo XML
+
+# Warn (and alert) when no packets arrive from the sources
+watchdog:
+  enabled: false
+  timeout: 10m
+  heartbeat: false          # also send a heartbeat to every target when it trips
+
+# Primary/backup failover: only the active relay binds and forwards
+cluster:
+  enabled: false
+  role: "primary"           # or backup
+  listen: "0.0.0.0:2335"    # heartbeats from the other relay
+  peer: ""                  # the other relay's cluster listen address
+  interval: 1s
+  timeout: 5s               # silence before the backup takes over
+  secret: ""                # sign heartbeats
+
+# Color already-worked stations in WSJT-X's band activity window
+wsjtx:
+  highlight:
+    enabled: false
+    background: "#c0c0c0"
+    foreground: "#000000"
+
+# Per-band summary of the CQs WSJT-X decodes
+activity:
+  enabled: false
+  window: 15m
+  digest_interval: 15m      # 0 disables the periodic digest
+  webhook_url: ""           # POST each digest as JSON
+
+# Radio frequency/mode from Hamlib rigctld
+rig:
+  enabled: false
+  address: "127.0.0.1:4532"
+  poll_interval: 1s
+  radio_info: false         # send N1MM RadioInfo to n1mm targets on frequency/mode changes
+
+# Rover grid from gpsd
+gps:
+  enabled: false
+  address: "127.0.0.1:2947"
+  precision: 4              # grid locator length: 4, 6 or 8
+
+# Turn the antenna toward each QSO's grid (needs control.grid or gps)
+rotator:
+  enabled: false
+  protocol: rotctld         # rotctld or n1mm
+  address: "127.0.0.1:4533" # N1MM Rotor listens on 12040
+  rotor: ""                 # rotator name in N1MM Rotor
+  in_progress: false        # also turn when WSJT-X starts calling a station
+  min_change: 5             # degrees
+
+# High-throughput mode for FT8 DXpedition bursts
+performance:
+  enabled: false
+  max_in_flight: 64
+  socket_buffer: 4194304    # bytes
+  send_queue: 1024          # messages per target
+
+# Further relays run by this process, e.g. {name: "digital", listen: {port: 2237}, targets: [...]}
+pipelines: []
 `
 
 	return os.WriteFile(configPath, []byte(defaultConfig), 0644)
@@ -0,0 +1,422 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("UDP_LOGGER_LISTEN_PORT", "2334")
+	t.Setenv("UDP_LOGGER_VERBOSE", "true")
+	t.Setenv("UDP_LOGGER_FORMATTING_N1MM_STATION", "N7AKG")
+	t.Setenv("UDP_LOGGER_TARGETS", `[{"address":"10.0.0.5","port":9871,"format":"wintest"}]`)
+	t.Setenv("UDP_LOGGER_FORMATTING_RST_DEFAULTS", `{"SSB":"59"}`)
+	t.Setenv("UDP_LOGGER_WINLINK_LOG_FILES", "a.log, b.log")
+	t.Setenv("UDP_LOGGER_WINLINK_POLL_INTERVAL", "5s")
+
+	cfg, err := LoadEnv()
+	if err != nil {
+		t.Fatalf("LoadEnv failed: %v", err)
+	}
+
+	if cfg.Listen.Port != 2334 {
+		t.Errorf("Listen.Port = %d, want 2334", cfg.Listen.Port)
+	}
+	if cfg.Listen.Address != "0.0.0.0" {
+		t.Errorf("Listen.Address = %q, want default 0.0.0.0", cfg.Listen.Address)
+	}
+	if !cfg.Verbose {
+		t.Error("Verbose should be true")
+	}
+	if cfg.Formatting.N1MM.Station != "N7AKG" {
+		t.Errorf("Station = %q, want N7AKG", cfg.Formatting.N1MM.Station)
+	}
+	if len(cfg.Targets) != 1 || cfg.Targets[0].Port != 9871 || cfg.Targets[0].Format != "wintest" {
+		t.Errorf("Targets = %+v", cfg.Targets)
+	}
+	if cfg.Formatting.RST.Defaults["ssb"] != "59" && cfg.Formatting.RST.Defaults["SSB"] != "59" {
+		t.Errorf("RST defaults = %v", cfg.Formatting.RST.Defaults)
+	}
+	if len(cfg.Winlink.LogFiles) != 2 || cfg.Winlink.LogFiles[1] != "b.log" {
+		t.Errorf("Winlink.LogFiles = %v", cfg.Winlink.LogFiles)
+	}
+	if cfg.Winlink.PollInterval != 5*time.Second {
+		t.Errorf("Winlink.PollInterval = %v, want 5s", cfg.Winlink.PollInterval)
+	}
+	if cfg.ConfigFileUsed != "" {
+		t.Errorf("ConfigFileUsed = %q, want empty", cfg.ConfigFileUsed)
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	if got := EnvVar("formatting.n1mm.station"); got != "UDP_LOGGER_FORMATTING_N1MM_STATION" {
+		t.Errorf("EnvVar = %s", got)
+	}
+}
+
+func TestLoadFileWithEnvOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "listen:\n  port: 2400\ntarget:\n  address: \"192.168.1.10\"\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UDP_LOGGER_TARGET_PORT", "12061")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Listen.Port != 2400 || cfg.Target.Address != "192.168.1.10" {
+		t.Errorf("file values not applied: %+v %+v", cfg.Listen, cfg.Target)
+	}
+	if cfg.Target.Port != 12061 {
+		t.Errorf("Target.Port = %d, want 12061 from environment", cfg.Target.Port)
+	}
+	if cfg.Target.Format != "n1mm" {
+		t.Errorf("Target.Format = %q, want default n1mm", cfg.Target.Format)
+	}
+	if cfg.ConfigFileUsed != path {
+		t.Errorf("ConfigFileUsed = %q, want %q", cfg.ConfigFileUsed, path)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `profile: casual
+listen:
+  port: 2400
+formatting:
+  n1mm:
+    station: "N7AKG"
+    contest: "GENERAL"
+targets:
+  - address: "10.0.0.5"
+    port: 9871
+profiles:
+  casual: {}
+  contest:
+    formatting:
+      n1mm:
+        contest: "CQ-WW-CW"
+      callsign:
+        reject_invalid: true
+    targets:
+      - address: "10.0.0.6"
+        port: 9872
+        format: "wintest"
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadProfile(path, "Contest")
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	if cfg.Profile != "contest" {
+		t.Errorf("Profile = %q, want contest", cfg.Profile)
+	}
+	if cfg.Formatting.N1MM.Contest != "CQ-WW-CW" || !cfg.Formatting.Callsign.RejectInvalid {
+		t.Errorf("profile settings not applied: %+v", cfg.Formatting)
+	}
+	// Settings the profile doesn't mention keep their file values
+	if cfg.Formatting.N1MM.Station != "N7AKG" || cfg.Listen.Port != 2400 {
+		t.Errorf("file settings lost: %+v %+v", cfg.Formatting.N1MM, cfg.Listen)
+	}
+	if len(cfg.Targets) != 1 || cfg.Targets[0].Address != "10.0.0.6" {
+		t.Errorf("Targets = %+v, want the profile's list", cfg.Targets)
+	}
+
+	// Without --profile the file's profile key selects one
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Profile != "casual" || cfg.Formatting.N1MM.Contest != "GENERAL" || len(cfg.Targets) != 1 || cfg.Targets[0].Port != 9871 {
+		t.Errorf("casual profile: %+v %+v", cfg.Formatting.N1MM, cfg.Targets)
+	}
+
+	if _, err := LoadProfile(path, "pota"); err == nil || !strings.Contains(err.Error(), "casual, contest") {
+		t.Errorf("expected unknown profile error listing profiles, got %v", err)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("base.yaml", `include: [targets.yaml]
+listen:
+  port: 2400
+formatting:
+  n1mm:
+    station: "CLUB"
+    contest: "CQ-WW-CW"
+`)
+	write("targets.yaml", `targets:
+  - &logger {address: "10.0.0.5", port: 12060, format: "n1mm"}
+  - <<: *logger
+    address: "10.0.0.6"
+`)
+	write("extra/a.yaml", "verbose: true\n")
+	path := write("station.yaml", `include: [base.yaml, "extra/*.yaml"]
+formatting:
+  n1mm:
+    station: "N1-RUN"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Formatting.N1MM.Station != "N1-RUN" || cfg.Formatting.N1MM.Contest != "CQ-WW-CW" || cfg.Listen.Port != 2400 || !cfg.Verbose {
+		t.Errorf("included settings not merged: %+v %+v verbose=%v", cfg.Formatting.N1MM, cfg.Listen, cfg.Verbose)
+	}
+	if len(cfg.Targets) != 2 || cfg.Targets[1].Address != "10.0.0.6" || cfg.Targets[1].Port != 12060 {
+		t.Errorf("Targets = %+v, want the anchored pair", cfg.Targets)
+	}
+
+	// The including file's list replaces the included one
+	viper.Reset()
+	path = write("override.yaml", `include: [base.yaml]
+targets:
+  - address: "10.0.0.9"
+    port: 9871
+`)
+	if cfg, err = Load(path); err != nil || len(cfg.Targets) != 1 || cfg.Targets[0].Address != "10.0.0.9" {
+		t.Errorf("Targets = %+v (%v), want the including file's list", cfg.Targets, err)
+	}
+
+	viper.Reset()
+	write("loop.yaml", "include: [loop2.yaml]\n")
+	write("loop2.yaml", "include: [loop.yaml]\n")
+	if _, err := Load(filepath.Join(dir, "loop.yaml")); err == nil || !strings.Contains(err.Error(), "include loop") {
+		t.Errorf("expected an include loop error, got %v", err)
+	}
+
+	viper.Reset()
+	path = write("missing.yaml", "include: [nope.yaml]\n")
+	if _, err := Load(path); err == nil {
+		t.Error("expected a missing include to fail")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `listen:
+  port: 70000
+formating:
+  n1mm:
+    station: "N7AKG"
+formatting:
+  sourcetype: "wsjt-x"
+  source_type: "wsjtx"
+  time:
+    max_age_action: "warn"
+  n1mm_broadcasts:
+    radioinfo: "convert"
+    lookupinfo: "convert"
+listeners:
+  - address: "10.0.0.1"
+    port: 2237
+    interface: "eth1"
+targets:
+  - address: "10.0.0.5"
+    port: 9871
+    fromat: "wintest"
+  - address: "10.0.0.6"
+    port: 2334
+    format: "relay"
+    protocol: "tcp"
+    framing: "cobs"
+    response_timeout: 2s
+  - address: "10.0.0.7"
+    port: 5000
+    format: "adif"
+    protocol: "tcp"
+    local_address: "eth1"
+log:
+  format: "xml"
+  levels:
+    formater: debug
+scoring:
+  contest: "cqww"
+serial_port:
+  enabled: true
+  baud: 14400
+rotator:
+  enabled: true
+  protocol: "gs232"
+dedup:
+  enabled: true
+  fields: ["callsign", "freq"]
+  rules:
+    - type: "varac"
+      window: 0s
+    - type: "ft8"
+      scope: "band"
+profiles:
+  contest:
+    listen:
+      prot: 2400
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	want := []string{
+		`unknown key "formating" (did you mean "formatting"?)`,
+		`unknown key "formatting.sourcetype" (did you mean "formatting.source_type"?)`,
+		`unknown key "profiles.contest.listen.prot" (did you mean "profiles.contest.listen.port"?)`,
+		`unknown key "targets[0].fromat" (did you mean "targets[0].format"?)`,
+		`listen.port: port 70000 is out of range (1-65535)`,
+		`listeners[0]: set address or interface, not both`,
+		`targets[1].framing: relay connections are line framed`,
+		`targets[1].response_timeout: replies are only read from udp targets`,
+		`targets[2].framing: protocol tcp needs the relay format or a framing (line, length or cobs)`,
+		`targets[2].local_address: "eth1" is not an IP address`,
+		`log.format: unknown value "xml" (use auto, text or json)`,
+		`log.levels: unknown log module "formater"`,
+		`formatting.source_type: unknown source type "wsjtx"`,
+		`formatting.time.max_age_action: unknown value "warn" (use drop or flag)`,
+		`formatting.n1mm_broadcasts.radioinfo: unknown value "convert" (use ignore or pass)`,
+		`formatting.n1mm_broadcasts.lookupinfo: convert needs formatting.exchange.lookup`,
+		`dedup.fields: unknown field "freq"`,
+		`dedup.rules[1].type: unknown source type "ft8"`,
+		`dedup.rules[1].scope: unknown value "band" (use relay or target)`,
+		`scoring.contest: cqww scoring needs a country file`,
+		`serial_port.port: set the device, e.g. /dev/ttyUSB0`,
+		`serial_port.baud: 14400 is not supported (use 1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200 or 230400)`,
+		`rotator.protocol: unknown value "gs232" (use rotctld or n1mm)`,
+		`rotator.enabled: set control.grid or enable gps so headings have a starting point`,
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("got %d problems, want %d:\n%s", len(verr.Problems), len(want), verr)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(verr.Problems[i], w) {
+			t.Errorf("problem %d = %q, want %q", i, verr.Problems[i], w)
+		}
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	if _, err := Load(filepath.Join("..", "..", "config-example.yaml")); err != nil {
+		t.Errorf("config-example.yaml: %v", err)
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `listen:
+  port: 2333
+verbose: true
+formatting:
+  n1mm:
+    station: "N7AKG"
+    contest: "GENERAL"
+journal:
+  path: "qsos.jsonl"
+pipelines:
+  - name: "digital"
+    listen:
+      port: 2237
+    targets:
+      - address: "10.0.0.5"
+        port: 9871
+        format: "wintest"
+    formatting:
+      n1mm:
+        contest: "ARRL-RTTY"
+  - name: "spare"
+    enabled: false
+    listen:
+      port: 2334
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.PipelineConfigs) != 1 {
+		t.Fatalf("got %d pipelines, want only the enabled one", len(cfg.PipelineConfigs))
+	}
+	pc := cfg.PipelineConfigs[0]
+	if pc.Name != "digital" || pc.Listen.Port != 2237 || len(pc.Targets) != 1 || pc.Targets[0].Format != "wintest" {
+		t.Errorf("pipeline settings not applied: %s %+v %+v", pc.Name, pc.Listen, pc.Targets)
+	}
+	// Formatting is merged over the file's; other sections are the main relay's
+	if pc.Formatting.N1MM.Station != "N7AKG" || pc.Formatting.N1MM.Contest != "ARRL-RTTY" {
+		t.Errorf("pipeline formatting = %+v", pc.Formatting.N1MM)
+	}
+	if cfg.Formatting.N1MM.Contest != "GENERAL" {
+		t.Errorf("main contest changed to %q", cfg.Formatting.N1MM.Contest)
+	}
+	if pc.Journal.Path != "" || !pc.Verbose || pc.Target.Port != 12060 {
+		t.Errorf("pipeline should have the defaults and shared settings: journal %q verbose %t target %+v",
+			pc.Journal.Path, pc.Verbose, pc.Target)
+	}
+
+	bad := `pipelines:
+  - listen:
+      port: 2333
+    journal:
+      path: "qsos.jsonl"
+  - name: "b"
+    listen:
+      prot: 2400
+`
+	if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	want := []string{
+		`unknown key "pipelines[0].journal" (a pipeline has name, enabled, listen, listeners, target, targets, formatting)`,
+		`unknown key "pipelines[1].listen.prot" (did you mean "pipelines[1].listen.port"?)`,
+	}
+	if strings.Join(verr.Problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(verr.Problems, "\n"), strings.Join(want, "\n"))
+	}
+
+	clash := `pipelines:
+  - name: "digital"
+`
+	if err := os.WriteFile(path, []byte(clash), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), `pipeline "digital" listens on port 2333, which the main relay already uses`) {
+		t.Errorf("expected a port clash, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// applyIncludes merges the files named by the config file's include key
+// under its own settings, so a station's file can share a club's base config
+// and override parts of it. Maps are merged key by key; lists and other
+// values are replaced, as with profiles.
+func applyIncludes() error {
+	path := viper.ConfigFileUsed()
+	if path == "" || len(viper.GetStringSlice("include")) == 0 {
+		return nil
+	}
+	settings, err := readIncluding(path, nil)
+	if err != nil {
+		return err
+	}
+	return viper.MergeConfigMap(settings)
+}
+
+// readIncluding reads a config file with the files it includes merged under
+// it, in order, each later one overriding the earlier. Relative paths are
+// relative to the including file and may be glob patterns. chain holds the
+// files being read, to catch a file that includes itself.
+func readIncluding(path string, chain []string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	for _, p := range chain {
+		if p == abs {
+			return nil, fmt.Errorf("config include loop: %s", strings.Join(append(chain, abs), " -> "))
+		}
+	}
+	chain = append(chain, abs)
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	merged := make(map[string]interface{})
+	for _, include := range v.GetStringSlice("include") {
+		files, err := includedFiles(filepath.Dir(path), include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, file := range files {
+			settings, err := readIncluding(file, chain)
+			if err != nil {
+				return nil, err
+			}
+			mergeSettings(merged, settings)
+		}
+	}
+	mergeSettings(merged, v.AllSettings())
+	return merged, nil
+}
+
+// includedFiles resolves an include entry against dir. A pattern must match
+// at least one file, so a typo isn't silently ignored.
+func includedFiles(dir, include string) ([]string, error) {
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(dir, include)
+	}
+	if !strings.ContainsAny(include, "*?[") {
+		return []string{include}, nil
+	}
+	files, err := filepath.Glob(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern %q: %w", include, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("include pattern %q matches no files", include)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// mergeSettings merges src over dst: nested maps key by key, anything else
+// replaced
+func mergeSettings(dst, src map[string]interface{}) {
+	for key, value := range src {
+		key = strings.ToLower(key)
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeSettings(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			copied := make(map[string]interface{}, len(srcMap))
+			mergeSettings(copied, srcMap)
+			value = copied
+		}
+		dst[key] = value
+	}
+}
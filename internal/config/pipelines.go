@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// pipelineSections are the top-level sections a pipeline has its own copy
+// of. Everything else (journal, bridge, control API, pollers, ...) belongs
+// to the main relay.
+var pipelineSections = []string{"listen", "listeners", "target", "targets", "formatting"}
+
+// pipelineKeys checks the keys of one entry of the pipelines section
+func pipelineKeys(settings map[string]interface{}, t reflect.Type, prefix string) []string {
+	var problems []string
+	own := make(map[string]interface{})
+	for key, value := range settings {
+		switch {
+		case key == "name", key == "enabled":
+		case slices.Contains(pipelineSections, key):
+			own[key] = value
+		default:
+			problems = append(problems, fmt.Sprintf("unknown key %q (a pipeline has name, enabled, %s)",
+				prefix+key, strings.Join(pipelineSections, ", ")))
+		}
+	}
+	return append(problems, unknownKeys(own, t, prefix)...)
+}
+
+// buildPipelines makes the configuration of each enabled pipeline: the
+// defaults, then the file's formatting section, then the pipeline's own
+// sections. Verbose, log, auth and performance settings are shared with the
+// main relay.
+func (c *Config) buildPipelines() []string {
+	var problems []string
+	names := make(map[string]bool)
+	for i, settings := range c.Pipelines {
+		key := fmt.Sprintf("pipelines[%d]", i)
+
+		name, _ := settings["name"].(string)
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			problems = append(problems, key+".name: every pipeline needs a name")
+		case names[strings.ToLower(name)]:
+			problems = append(problems, fmt.Sprintf("%s.name: %q is used by another pipeline", key, name))
+		}
+		names[strings.ToLower(name)] = true
+
+		enabled := true
+		if value, ok := settings["enabled"]; ok {
+			if enabled, ok = value.(bool); !ok {
+				problems = append(problems, fmt.Sprintf("%s.enabled: expected true or false, got %v", key, value))
+			}
+		}
+
+		// AllSettings returns fresh maps, so merging the pipeline over the
+		// formatting section leaves the main configuration alone
+		v := viper.New()
+		if formatting, ok := viper.AllSettings()["formatting"]; ok {
+			v.MergeConfigMap(map[string]interface{}{"formatting": formatting})
+		}
+		own := make(map[string]interface{})
+		for _, section := range pipelineSections {
+			if value, ok := settings[section]; ok {
+				own[section] = value
+			}
+		}
+		v.MergeConfigMap(own)
+
+		pc := defaults()
+		strict := func(dc *mapstructure.DecoderConfig) { dc.ErrorUnused = true }
+		if err := v.Unmarshal(pc, viper.DecodeHook(envDecodeHook), strict); err != nil {
+			for _, p := range decodeProblems(err, false) {
+				problems = append(problems, key+": "+p)
+			}
+			continue
+		}
+		for _, p := range pc.validate() {
+			problems = append(problems, key+"."+p)
+		}
+
+		pc.Name = name
+		pc.Verbose, pc.Log, pc.Auth, pc.Performance = c.Verbose, c.Log, c.Auth, c.Performance
+		if enabled {
+			c.PipelineConfigs = append(c.PipelineConfigs, pc)
+		}
+	}
+
+	if len(problems) == 0 {
+		problems = c.checkPipelinePorts()
+	}
+	return problems
+}
+
+// checkPipelinePorts reports a UDP port that the main relay and a pipeline,
+// or two pipelines, would both bind. Shared ports (reuse_port) and multicast
+// groups are left to the operating system.
+func (c *Config) checkPipelinePorts() []string {
+	var problems []string
+	owners := make(map[int]string)
+	for _, cfg := range append([]*Config{c}, c.PipelineConfigs...) {
+		owner := "the main relay"
+		if cfg.Name != "" {
+			owner = fmt.Sprintf("pipeline %q", cfg.Name)
+		}
+		for _, l := range append([]ListenerConfig{cfg.MainListener()}, cfg.Listeners...) {
+			if l.ReusePort || l.MulticastGroup != "" {
+				continue
+			}
+			if other, ok := owners[l.Port]; ok && other != owner {
+				problems = append(problems, fmt.Sprintf("%s listens on port %d, which %s already uses", owner, l.Port, other))
+				continue
+			}
+			owners[l.Port] = owner
+		}
+	}
+	return problems
+}
@@ -0,0 +1,463 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/comport"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/mapping"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/qsomap"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/scoreboard"
+)
+
+// ValidationError lists every problem found in a configuration, so they can
+// all be fixed in one go instead of one per restart
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid configuration: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid configuration (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// unknownKeys returns a problem for every key in settings that the struct
+// type t has no field for. Viper would otherwise ignore a typo such as
+// "formating:" and leave the user with the defaults.
+func unknownKeys(settings map[string]interface{}, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("mapstructure")
+		if tag != "" && tag != "-" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+
+	var problems []string
+	for key, value := range settings {
+		path := prefix + key
+		ft, ok := fields[key]
+		if !ok {
+			problem := fmt.Sprintf("unknown key %q", path)
+			if s := suggest(key, fields); s != "" {
+				problem += fmt.Sprintf(" (did you mean %q?)", prefix+s)
+			}
+			problems = append(problems, problem)
+			continue
+		}
+
+		switch {
+		case prefix == "" && key == "profiles":
+			// Each profile holds any of the top-level sections
+			profiles, _ := value.(map[string]interface{})
+			for name, p := range profiles {
+				if settings, ok := p.(map[string]interface{}); ok {
+					problems = append(problems, unknownKeys(settings, t, "profiles."+name+".")...)
+				}
+			}
+		case prefix == "" && key == "pipelines":
+			// Each pipeline holds its name and a few of the top-level sections
+			items, _ := value.([]interface{})
+			for i, item := range items {
+				if settings, ok := item.(map[string]interface{}); ok {
+					problems = append(problems, pipelineKeys(settings, t, fmt.Sprintf("pipelines[%d].", i))...)
+				}
+			}
+		case ft.Kind() == reflect.Struct:
+			if m, ok := value.(map[string]interface{}); ok {
+				problems = append(problems, unknownKeys(m, ft, path+".")...)
+			}
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			items, _ := value.([]interface{})
+			for i, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					problems = append(problems, unknownKeys(m, ft.Elem(), fmt.Sprintf("%s[%d].", path, i))...)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// suggest returns the known key closest to an unknown one, or "" when none
+// is close enough to be the intended key
+func suggest(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		// sourcetype for source_type
+		if strings.ReplaceAll(name, "_", "") == strings.ReplaceAll(key, "_", "") {
+			return name
+		}
+		if d := formatter.EditDistance(key, name); d < bestDistance || d == bestDistance && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance > 2 {
+		return ""
+	}
+	return best
+}
+
+// decodeProblems converts a strict unmarshalling error into problems. Unused
+// key errors are left out when unknownKeys already reported them with
+// suggestions.
+func decodeProblems(err error, haveUnknown bool) []string {
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	for _, e := range decodeErr.Errors {
+		if haveUnknown && strings.Contains(e, "has invalid keys") {
+			continue
+		}
+		problems = append(problems, e)
+	}
+	return problems
+}
+
+// validate checks the values of a decoded configuration
+func (c *Config) validate() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	checkPort := func(key string, port int) {
+		if port < 1 || port > 65535 {
+			add("%s: port %d is out of range (1-65535)", key, port)
+		}
+	}
+	checkSourceType := func(key, sourceType string) {
+		if sourceType != "" && !strings.EqualFold(sourceType, "auto") && !formatter.ValidMessageType(sourceType) {
+			add("%s: unknown source type %q (use auto or one of %s)", key, sourceType, strings.Join(formatter.MessageTypes(), ", "))
+		}
+	}
+	checkTarget := func(key string, t TargetConfig) {
+		checkPort(key+".port", t.Port)
+		if t.Format != "" && !formatter.ValidOutputFormat(t.Format) {
+			add("%s.format: unknown output format %q (use n1mm, wintest, dxlog, adif or relay)", key, t.Format)
+		}
+		switch strings.ToLower(t.Protocol) {
+		case "", "udp", "tcp":
+		case "tls":
+			if c.Chain.TLS.Cert == "" {
+				add("%s.protocol: tls needs chain.tls.cert and chain.tls.key", key)
+			}
+		default:
+			add("%s.protocol: unknown protocol %q (use udp, tcp or tls)", key, t.Protocol)
+		}
+		switch strings.ToLower(t.Framing) {
+		case "", "line", "length", "cobs":
+		default:
+			add("%s.framing: unknown framing %q (use line, length or cobs)", key, t.Framing)
+		}
+		if protocol := strings.ToLower(t.Protocol); protocol == "tcp" || protocol == "tls" {
+			relayFormat := strings.EqualFold(t.Format, string(formatter.OutputFormatRelay))
+			switch framing := strings.ToLower(t.Framing); {
+			case relayFormat && framing != "" && framing != "line":
+				add("%s.framing: relay connections are line framed", key)
+			case !relayFormat && framing == "":
+				add("%s.framing: protocol %s needs the relay format or a framing (line, length or cobs)", key, protocol)
+			}
+		}
+		if !formatter.ValidSNRReportStyle(t.SNRReports) {
+			add("%s.snr_reports: unknown value %q (use keep, rst or comment)", key, t.SNRReports)
+		}
+		if t.ResponseTimeout < 0 {
+			add("%s.response_timeout: %s must not be negative", key, t.ResponseTimeout)
+		}
+		if t.ResponseTimeout > 0 {
+			if protocol := strings.ToLower(t.Protocol); protocol != "" && protocol != "udp" {
+				add("%s.response_timeout: replies are only read from udp targets", key)
+			}
+			if c.Performance.Enabled && c.Performance.SendQueue > 0 {
+				add("%s.response_timeout: replies can't be read through the performance send queue; set performance.send_queue to 0", key)
+			}
+		}
+		for _, list := range []struct {
+			key   string
+			calls []string
+		}{{"my_calls", t.MyCalls}, {"operators", t.Operators}} {
+			for _, call := range list.calls {
+				if strings.TrimSpace(call) == "" {
+					add("%s.%s: empty callsign", key, list.key)
+				}
+			}
+		}
+		if t.ResponseError != "" {
+			if _, err := regexp.Compile(t.ResponseError); err != nil {
+				add("%s.response_error: %v", key, err)
+			}
+		}
+		if t.LocalAddress != "" {
+			if net.ParseIP(t.LocalAddress) == nil {
+				add("%s.local_address: %q is not an IP address", key, t.LocalAddress)
+			}
+			if t.Interface != "" {
+				add("%s: set interface or local_address, not both", key)
+			}
+		}
+	}
+	// Empty values are left to the defaults of the code that uses them
+	oneOf := func(key, value string, allowed ...string) {
+		if value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		add("%s: unknown value %q (use %s or %s)", key, value, strings.Join(allowed[:len(allowed)-1], ", "), allowed[len(allowed)-1])
+	}
+
+	checkGroup := func(key, group string) {
+		if ip := net.ParseIP(group); group != "" && (ip == nil || !ip.IsMulticast()) {
+			add("%s: %q is not a multicast address (224.0.0.0/4 or ff00::/8)", key, group)
+		}
+	}
+	// An interface takes the place of a specific address; multicast
+	// listeners have their own setting
+	checkInterface := func(key string, lc ListenerConfig) {
+		if lc.Interface == "" {
+			return
+		}
+		if lc.MulticastGroup != "" {
+			add("%s.interface: multicast listeners join on multicast_interface", key)
+		}
+		if ip := net.ParseIP(lc.Address); lc.Address != "" && (ip == nil || !ip.IsUnspecified()) {
+			add("%s: set address or interface, not both", key)
+		}
+	}
+
+	checkPort("listen.port", c.Listen.Port)
+	checkGroup("listen.multicast_group", c.Listen.MulticastGroup)
+	checkInterface("listen", c.MainListener())
+	if c.Listen.BufferSize < 1 || c.Listen.BufferSize > 65536 {
+		add("listen.buffer_size: %d is out of range (1-65536)", c.Listen.BufferSize)
+	}
+	if c.Listen.ReceiveBuffer < 0 {
+		add("listen.receive_buffer: %d must not be negative", c.Listen.ReceiveBuffer)
+	}
+	if c.Listen.DropCheck < 0 {
+		add("listen.drop_check: %s must not be negative", c.Listen.DropCheck)
+	}
+	for i, l := range c.Listeners {
+		checkPort(fmt.Sprintf("listeners[%d].port", i), l.Port)
+		checkGroup(fmt.Sprintf("listeners[%d].multicast_group", i), l.MulticastGroup)
+		checkSourceType(fmt.Sprintf("listeners[%d].source_type", i), l.SourceType)
+		checkInterface(fmt.Sprintf("listeners[%d]", i), l)
+	}
+	checkTarget("target", c.Target)
+	for i, t := range c.Targets {
+		checkTarget(fmt.Sprintf("targets[%d]", i), t)
+	}
+
+	if v := c.Chain.ProtocolVersion; v != 0 && (v < formatter.RelayMinVersion || v > formatter.RelayVersion) {
+		add("chain.protocol_version: %d is not supported (use 0 for the newest, or %d to %d)", v, formatter.RelayMinVersion, formatter.RelayVersion)
+	}
+	if tc := c.Chain.TLS; tc.Cert != "" || tc.Key != "" {
+		if tc.Cert == "" || tc.Key == "" {
+			add("chain.tls: cert and key must be set together")
+		}
+		if tc.CA == "" && len(tc.Fingerprints) == 0 {
+			add("chain.tls: set ca or fingerprints to trust the other relays")
+		}
+	}
+
+	oneOf("log.format", c.Log.Format, "auto", "text", "json")
+	oneOf("log.output", c.Log.Output, "auto", "stdout", "stderr")
+	oneOf("log.console", c.Log.Console, "auto", "on", "off")
+	for module, level := range c.Log.Levels {
+		if _, err := logging.ParseModule(module); err != nil && !strings.EqualFold(module, "all") {
+			add("log.levels: %v", err)
+		}
+		if _, err := logging.ParseLevel(level); err != nil {
+			add("log.levels.%s: %v", module, err)
+		}
+	}
+	checkSourceType("formatting.source_type", c.Formatting.SourceType)
+	oneOf("formatting.time.drift_action", c.Formatting.Time.DriftAction, "replace", "clamp")
+	if c.Formatting.Time.MaxAge < 0 {
+		add("formatting.time.max_age: %s must not be negative", c.Formatting.Time.MaxAge)
+	}
+	oneOf("formatting.time.max_age_action", c.Formatting.Time.MaxAgeAction, "drop", "flag")
+	oneOf("formatting.varac.events", c.Formatting.VarAC.Events, "drop", "count", "spot")
+	nb := c.Formatting.N1MMBroadcasts
+	oneOf("formatting.n1mm_broadcasts.radioinfo", nb.RadioInfo, "ignore", "pass")
+	oneOf("formatting.n1mm_broadcasts.spot", nb.Spot, "ignore", "convert", "pass")
+	oneOf("formatting.n1mm_broadcasts.lookupinfo", nb.LookupInfo, "ignore", "convert", "pass")
+	oneOf("formatting.n1mm_broadcasts.score", nb.Score, "ignore", "pass")
+	oneOf("formatting.n1mm_broadcasts.appinfo", nb.AppInfo, "ignore", "pass")
+	if nb.LookupInfo == "convert" && !c.Formatting.Exchange.Lookup {
+		add("formatting.n1mm_broadcasts.lookupinfo: convert needs formatting.exchange.lookup")
+	}
+	oneOf("formatting.xml.field_order", c.Formatting.XML.FieldOrder, "n1mm", "legacy")
+	for contest, parser := range c.Formatting.Exchange.Parsers {
+		if !formatter.ValidExchangeParser(parser) {
+			add("formatting.exchange.parsers.%s: unknown exchange parser %q (use skcc, qso_party, roundup, field_day, grid, eu_vhf, none or auto)", contest, parser)
+		}
+	}
+
+	if c.Control.Grid != "" {
+		if _, ok := qsomap.Position(c.Control.Grid); !ok {
+			add("control.grid: %q is not a 4, 6 or 8 character Maidenhead locator", c.Control.Grid)
+		}
+	}
+
+	if c.Dedup.Enabled {
+		dedupFields := func(key string, fields []string) {
+			for _, field := range fields {
+				if _, err := mapping.MatchField(field); err != nil {
+					add("%s: %v", key, err)
+				}
+			}
+		}
+		if c.Dedup.Window <= 0 {
+			add("dedup.window: %s must be positive", c.Dedup.Window)
+		}
+		if len(c.Dedup.Fields) == 0 {
+			add("dedup.fields: set the QSO fields that must match, e.g. callsign, band, mode")
+		}
+		dedupFields("dedup.fields", c.Dedup.Fields)
+		oneOf("dedup.scope", c.Dedup.Scope, "relay", "target")
+		for i, rule := range c.Dedup.Rules {
+			key := fmt.Sprintf("dedup.rules[%d]", i)
+			if !formatter.ValidMessageType(rule.Type) {
+				add("%s.type: unknown source type %q (use one of %s)", key, rule.Type, strings.Join(formatter.MessageTypes(), ", "))
+			}
+			if rule.Window < 0 {
+				add("%s.window: %s must not be negative", key, rule.Window)
+			}
+			dedupFields(key+".fields", rule.Fields)
+			if rule.Scope != "" {
+				oneOf(key+".scope", rule.Scope, "relay", "target")
+			}
+		}
+	}
+
+	oneOf("control.overlay.theme", c.Control.Overlay.Theme, "dark", "light", "transparent")
+	if c.Control.Overlay.FontSize < 0 {
+		add("control.overlay.font_size: %d must not be negative", c.Control.Overlay.FontSize)
+	}
+	overlay := c.Control.Overlay
+	for _, css := range []struct {
+		key, value string
+	}{{"background", overlay.Background}, {"text", overlay.Text}, {"accent", overlay.Accent}, {"font", overlay.Font}} {
+		if strings.ContainsAny(css.value, ";{}<>\\") {
+			add("control.overlay.%s: %q must be a plain CSS value", css.key, css.value)
+		}
+	}
+	for _, item := range c.Control.Overlay.Show {
+		oneOf("control.overlay.show", item, "last_qso", "count", "rate", "band")
+	}
+
+	if c.Stats.ErrorSamples < 0 {
+		add("stats.error_samples: %d must not be negative", c.Stats.ErrorSamples)
+	}
+	if c.Stats.LatencyWarn < 0 {
+		add("stats.latency_warn: %s must not be negative", c.Stats.LatencyWarn)
+	}
+	oneOf("scoring.contest", c.Scoring.Contest, "auto", "cqww", "arrldx", "wpx", "fieldday")
+	if contest, ok := c.ScoringContest(); ok && contest.NeedsCTY() && c.Stats.CTYFile == "" && (!c.Alerts.Enabled || c.Alerts.CTYFile == "") {
+		add("scoring.contest: %s scoring needs a country file; set stats.cty_file", contest)
+	}
+	oneOf("serial.mode", c.Serial.Mode, "off", "auto", "on")
+	if c.Serial.Mode != "" && c.Serial.Mode != "off" && c.Serial.Start < 1 {
+		add("serial.start: %d must be at least 1", c.Serial.Start)
+	}
+	if c.Review.Timeout < 0 {
+		add("review.timeout: %s must not be negative", c.Review.Timeout)
+	}
+	if c.Bridge.Enabled {
+		checkPort("bridge.listen_port", c.Bridge.ListenPort)
+	}
+	if c.Fldigi.Enabled {
+		if _, _, err := net.SplitHostPort(c.Fldigi.Address); err != nil {
+			add("fldigi.address: %q is not host:port", c.Fldigi.Address)
+		}
+		if c.Fldigi.PollInterval <= 0 {
+			add("fldigi.poll_interval: %s must be positive", c.Fldigi.PollInterval)
+		}
+	}
+	if c.APRS.Enabled {
+		oneOf("aprs.mode", c.APRS.Mode, "qso", "summary")
+	}
+	if c.Scoreboard.Enabled {
+		if len(c.Scoreboard.Boards) == 0 {
+			add("scoreboard.boards: set at least one scoreboard")
+		}
+		for _, board := range c.Scoreboard.Boards {
+			if _, err := scoreboard.ResolveBoard(board); err != nil {
+				add("scoreboard.boards: %v", err)
+			}
+		}
+		if c.Scoreboard.Interval < time.Minute {
+			add("scoreboard.interval: %s is too short; scoreboards ask for a minute or more", c.Scoreboard.Interval)
+		}
+		if c.Scoreboard.Retries < 0 {
+			add("scoreboard.retries: %d must not be negative", c.Scoreboard.Retries)
+		}
+	}
+	if c.SerialPort.Enabled {
+		if c.SerialPort.Port == "" {
+			add("serial_port.port: set the device, e.g. /dev/ttyUSB0")
+		}
+		if !comport.ValidBaud(c.SerialPort.Baud) {
+			bauds := make([]string, len(comport.Bauds))
+			for i, b := range comport.Bauds {
+				bauds[i] = strconv.Itoa(b)
+			}
+			add("serial_port.baud: %d is not supported (use %s or %s)", c.SerialPort.Baud, strings.Join(bauds[:len(bauds)-1], ", "), bauds[len(bauds)-1])
+		}
+		oneOf("serial_port.line_ending", c.SerialPort.LineEnding, "crlf", "lf", "cr")
+	}
+	if c.Cluster.Enabled {
+		oneOf("cluster.role", c.Cluster.Role, "primary", "backup")
+		if _, _, err := net.SplitHostPort(c.Cluster.Listen); err != nil {
+			add("cluster.listen: %q is not host:port", c.Cluster.Listen)
+		}
+		if _, _, err := net.SplitHostPort(c.Cluster.Peer); err != nil {
+			add("cluster.peer: %q is not host:port", c.Cluster.Peer)
+		}
+		if c.Cluster.Interval <= 0 || c.Cluster.Timeout <= c.Cluster.Interval {
+			add("cluster.timeout: %s must be longer than cluster.interval (%s)", c.Cluster.Timeout, c.Cluster.Interval)
+		}
+	}
+	if c.Watchdog.Enabled && c.Watchdog.Timeout <= 0 {
+		add("watchdog.timeout: %s must be positive", c.Watchdog.Timeout)
+	}
+	if c.Activity.Enabled && c.Activity.Window <= 0 {
+		add("activity.window: %s must be positive", c.Activity.Window)
+	}
+	if c.Rotator.Enabled {
+		oneOf("rotator.protocol", c.Rotator.Protocol, "rotctld", "n1mm")
+		if _, _, err := net.SplitHostPort(c.Rotator.Address); err != nil {
+			add("rotator.address: %q is not host:port", c.Rotator.Address)
+		}
+		if c.Rotator.MinChange < 0 {
+			add("rotator.min_change: %g must not be negative", c.Rotator.MinChange)
+		}
+		if c.Control.Grid == "" && !c.GPS.Enabled {
+			add("rotator.enabled: set control.grid or enable gps so headings have a starting point")
+		}
+	}
+	if c.GPS.Enabled && c.GPS.Precision != 4 && c.GPS.Precision != 6 && c.GPS.Precision != 8 {
+		add("gps.precision: %d is not a grid locator length (use 4, 6 or 8)", c.GPS.Precision)
+	}
+
+	return problems
+}
@@ -0,0 +1,128 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+)
+
+// FetchStats asks a running relay's control API at addr for its counters
+func FetchStats(addr, token string) (stats.Snapshot, error) {
+	var snap stats.Snapshot
+	if err := get(addr, token, "/api/stats", &snap); err != nil {
+		return snap, err
+	}
+	return snap, nil
+}
+
+// FetchErrors asks a running relay's control API at addr for its recent
+// parse failures
+func FetchErrors(addr, token string) ([]stats.Failure, error) {
+	var failures []stats.Failure
+	if err := get(addr, token, "/api/errors", &failures); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// FetchOperator asks a running relay's control API at addr for the
+// operator credited with new QSOs
+func FetchOperator(addr, token string) (string, error) {
+	var body struct {
+		Operator string `json:"operator"`
+	}
+	err := get(addr, token, "/api/operator", &body)
+	return body.Operator, err
+}
+
+// SetOperator puts an operator on duty at the running relay at addr; an
+// empty call goes back to the configured operator. It returns the operator
+// now credited.
+func SetOperator(addr, token, call string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"operator": call})
+	if err != nil {
+		return "", err
+	}
+	var body struct {
+		Operator string `json:"operator"`
+	}
+	err = do(addr, token, http.MethodPut, "/api/operator", payload, &body)
+	return body.Operator, err
+}
+
+// FetchPending asks a running relay's control API at addr for the QSOs
+// held for review
+func FetchPending(addr, token string) ([]review.Pending, error) {
+	var pending []review.Pending
+	err := get(addr, token, "/api/review", &pending)
+	return pending, err
+}
+
+// ForwardPending forwards a QSO held for review at the running relay at
+// addr, named by ID or number. Corrections, when given, are the QSO fields
+// to change by their JSON names. The QSO as forwarded is returned.
+func ForwardPending(addr, token, ref string, corrections map[string]any) (formatter.QSO, error) {
+	var qso formatter.QSO
+	path := "/api/review/" + url.PathEscape(ref)
+	if corrections == nil {
+		return qso, do(addr, token, http.MethodPost, path, nil, &qso)
+	}
+	payload, err := json.Marshal(corrections)
+	if err != nil {
+		return qso, err
+	}
+	return qso, do(addr, token, http.MethodPut, path, payload, &qso)
+}
+
+// DiscardPending drops a QSO held for review at the running relay at addr
+func DiscardPending(addr, token, ref string) (formatter.QSO, error) {
+	var qso formatter.QSO
+	err := do(addr, token, http.MethodDelete, "/api/review/"+url.PathEscape(ref), nil, &qso)
+	return qso, err
+}
+
+// get decodes the JSON response to a GET of path into v
+func get(addr, token, path string, v any) error {
+	return do(addr, token, http.MethodGet, path, nil, v)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into v
+func do(addr, token, method, path string, payload []byte, v any) error {
+	req, err := http.NewRequest(method, "http://"+addr+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("control API not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("control API returned %s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("control API returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from control API %s: %w", path, err)
+	}
+	return nil
+}
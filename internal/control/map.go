@@ -0,0 +1,29 @@
+package control
+
+import (
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+//go:embed map.html
+var mapPage string
+
+// mapTemplate renders the map page; html/template escapes the token for
+// the script
+var mapTemplate = template.Must(template.New("map").Parse(mapPage))
+
+// GET /map serves a live world map of forwarded QSOs, drawn from /api/map
+// and redrawn on each qso event from /ws
+func (s *Server) handleMapPage(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := mapTemplate.Execute(w, struct{ Token string }{s.token}); err != nil {
+		log.Printf("Failed to write map page: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package control
+
+import (
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+//go:embed overlay.html
+var overlayPage string
+
+// overlayTemplate renders the overlay page. html/template escapes the
+// title; the CSS values are vetted by cssValue.
+var overlayTemplate = template.Must(template.New("overlay").Parse(overlayPage))
+
+// overlayTheme is the look a theme gives the overlay
+type overlayTheme struct {
+	Background, Text, Accent template.CSS
+	Shadow                   bool // Outline the text, for when there is no background
+}
+
+// overlayThemes are the built-in themes by name
+var overlayThemes = map[string]overlayTheme{
+	"dark":        {Background: "rgba(0, 0, 0, 0.6)", Text: "#ffffff", Accent: "#ffcc00"},
+	"light":       {Background: "rgba(255, 255, 255, 0.85)", Text: "#111111", Accent: "#0055aa"},
+	"transparent": {Background: "transparent", Text: "#ffffff", Accent: "#ffcc00", Shadow: true},
+}
+
+// overlayData is what the page template sees
+type overlayData struct {
+	overlayTheme
+	Title    string
+	Font     template.CSS
+	FontSize int
+	Show     []string
+	Token    string
+}
+
+// cssUnsafe are the characters that could end a CSS declaration or the
+// style element; html/template would otherwise refuse rgba() and the like
+const cssUnsafe = ";{}<>\\"
+
+// cssValue returns value for use as a CSS property value, or fallback if
+// value is empty or could escape its declaration
+func cssValue(value string, fallback template.CSS) template.CSS {
+	if value == "" || strings.ContainsAny(value, cssUnsafe) {
+		return fallback
+	}
+	return template.CSS(value)
+}
+
+// SetOverlay themes the page served at /overlay
+func (s *Server) SetOverlay(o config.OverlayConfig) {
+	s.overlay = o
+}
+
+// GET /overlay serves a live QSO page for OBS browser sources
+func (s *Server) handleOverlay(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	o := s.overlay
+	theme, ok := overlayThemes[o.Theme]
+	if !ok {
+		theme = overlayThemes["dark"]
+	}
+	data := overlayData{overlayTheme: theme, Title: o.Title, FontSize: o.FontSize, Show: o.Show, Token: s.token}
+	data.Background = cssValue(o.Background, theme.Background)
+	data.Text = cssValue(o.Text, theme.Text)
+	data.Accent = cssValue(o.Accent, theme.Accent)
+	data.Font = cssValue(o.Font, "Helvetica, Arial, sans-serif")
+	if data.FontSize <= 0 {
+		data.FontSize = 32
+	}
+	if len(data.Show) == 0 {
+		data.Show = []string{"last_qso", "count", "rate", "band"}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := overlayTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to write overlay page: %v", err)
+	}
+}
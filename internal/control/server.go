@@ -0,0 +1,676 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/activity"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/qsomap"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
+)
+
+// Controller is the relay functionality exposed through the API
+type Controller interface {
+	GetStats() map[string]interface{}
+	Stats() stats.Snapshot
+	ParseFailures() []stats.Failure
+	Targets() []config.TargetConfig
+	SetTargets(targets []config.TargetConfig) error
+	FieldMappings() []config.FieldMapping
+	SetFieldMappings(mappings []config.FieldMapping) error
+	SetVerbose(verbose bool)
+	LogLevels() map[string]string
+	SetLogLevels(levels map[string]string) error
+	Pause()
+	Resume()
+	Operator() string
+	SetOperator(call string) error
+	Replay(since time.Time) (int, error)
+	WorkedBefore(call, band, mode string) (workeddb.Record, workeddb.Status, error)
+	QSO(id string) (formatter.QSO, bool)
+	ReplaceQSO(qso formatter.QSO) error
+	DeleteQSO(id string) error
+	PendingQSOs() []review.Pending
+	ForwardPending(ref string, corrected *formatter.QSO) (formatter.QSO, error)
+	DiscardPending(ref string) (formatter.QSO, error)
+	Activity() (activity.Digest, error)
+	QSOMap(limit int, since time.Time) []qsomap.Marker
+	Messages(limit int, since time.Time, call string) ([]formatter.JS8Message, error)
+	Subscribe() *events.Subscription
+}
+
+// Server is the authenticated localhost REST API for runtime control
+type Server struct {
+	addr    string
+	token   string
+	ctrl    Controller
+	server  *http.Server
+	closing chan struct{} // Closed on shutdown, which leaves WebSockets open
+	overlay config.OverlayConfig
+}
+
+// New creates a control server bound to addr. addr must be a loopback
+// address. If token is empty a random one is generated; see Token.
+func New(addr, token string, ctrl Controller) (*Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("control address %q must be a loopback address", addr)
+	}
+
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate control token: %w", err)
+		}
+		token = hex.EncodeToString(buf)
+	}
+
+	s := &Server{addr: addr, token: token, ctrl: ctrl, closing: make(chan struct{})}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	s.server.RegisterOnShutdown(func() { close(s.closing) })
+	return s, nil
+}
+
+// Token returns the bearer token clients must present
+func (s *Server) Token() string {
+	return s.token
+}
+
+// Run serves the API until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("control API stopped: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errChan; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// Handler returns the API routes wrapped in token authentication
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/errors", s.handleErrors)
+	mux.HandleFunc("/api/targets", s.handleTargets)
+	mux.HandleFunc("/api/mappings", s.handleMappings)
+	mux.HandleFunc("/api/verbose", s.handleVerbose)
+	mux.HandleFunc("/api/log/levels", s.handleLogLevels)
+	mux.HandleFunc("/api/pause", s.handlePause)
+	mux.HandleFunc("/api/resume", s.handleResume)
+	mux.HandleFunc("/api/operator", s.handleOperator)
+	mux.HandleFunc("/api/replay", s.handleReplay)
+	mux.HandleFunc("/api/worked", s.handleWorked)
+	mux.HandleFunc("/api/qso/", s.handleQSO)
+	mux.HandleFunc("/api/review", s.handleReview)
+	mux.HandleFunc("/api/review/", s.handleReviewQSO)
+	mux.HandleFunc("/api/activity", s.handleActivity)
+	mux.HandleFunc("/api/map", s.handleMap)
+	mux.HandleFunc("/api/messages", s.handleMessages)
+	mux.HandleFunc("/api/events/schema", s.handleEventSchema)
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/overlay", s.handleOverlay)
+	mux.HandleFunc("/map", s.handleMapPage)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the correct bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		presented := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		// Browsers can't set headers on a WebSocket, nor OBS on a browser
+		// source or a browser on a page it is sent to, so these may bring
+		// the token in the query instead
+		if presented == "" && (req.URL.Path == "/ws" || req.URL.Path == "/overlay" || req.URL.Path == "/map") {
+			presented = req.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// GET /api/status
+func (s *Server) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.GetStats())
+}
+
+// GET /api/stats
+func (s *Server) handleStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.Stats())
+}
+
+// GET /api/errors
+func (s *Server) handleErrors(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	failures := s.ctrl.ParseFailures()
+	if failures == nil {
+		failures = []stats.Failure{}
+	}
+	writeJSON(w, http.StatusOK, failures)
+}
+
+// GET /api/targets returns the targets, PUT replaces them
+func (s *Server) handleTargets(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.ctrl.Targets())
+	case http.MethodPut:
+		var targets []config.TargetConfig
+		if err := json.NewDecoder(req.Body).Decode(&targets); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid target list: "+err.Error())
+			return
+		}
+		if err := s.ctrl.SetTargets(targets); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.ctrl.Targets())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PUT")
+	}
+}
+
+// GET /api/mappings returns the field mappings, PUT replaces them
+func (s *Server) handleMappings(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.ctrl.FieldMappings())
+	case http.MethodPut:
+		var mappings []config.FieldMapping
+		if err := json.NewDecoder(req.Body).Decode(&mappings); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid mapping list: "+err.Error())
+			return
+		}
+		if err := s.ctrl.SetFieldMappings(mappings); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.ctrl.FieldMappings())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PUT")
+	}
+}
+
+// PUT /api/verbose {"verbose": true}
+func (s *Server) handleVerbose(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "use PUT")
+		return
+	}
+	var body struct {
+		Verbose *bool `json:"verbose"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Verbose == nil {
+		writeError(w, http.StatusBadRequest, `expected {"verbose": true|false}`)
+		return
+	}
+	s.ctrl.SetVerbose(*body.Verbose)
+	writeJSON(w, http.StatusOK, map[string]bool{"verbose": *body.Verbose})
+}
+
+// GET /api/log/levels returns each module's log level, PUT
+// {"formatter": "debug"} changes the modules named ("all" for every one)
+func (s *Server) handleLogLevels(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var levels map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&levels); err != nil || len(levels) == 0 {
+			writeError(w, http.StatusBadRequest, `expected {"module": "info"|"debug"}`)
+			return
+		}
+		if err := s.ctrl.SetLogLevels(levels); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PUT")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.LogLevels())
+}
+
+// POST /api/pause
+func (s *Server) handlePause(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	s.ctrl.Pause()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// POST /api/resume
+func (s *Server) handleResume(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	s.ctrl.Resume()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// GET /api/operator returns the operator credited with new QSOs, PUT
+// {"operator": "K1ABC"} puts one on duty ("" goes back to the configured one)
+func (s *Server) handleOperator(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Operator *string `json:"operator"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Operator == nil {
+			writeError(w, http.StatusBadRequest, `expected {"operator": "CALL"}`)
+			return
+		}
+		if err := s.ctrl.SetOperator(*body.Operator); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or PUT")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"operator": s.ctrl.Operator()})
+}
+
+// POST /api/replay?since=2024-06-01T00:00:00Z (since defaults to the start of the journal)
+func (s *Server) handleReplay(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	var since time.Time
+	if value := req.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be RFC3339, e.g. 2024-06-01T00:00:00Z")
+			return
+		}
+		since = t
+	}
+
+	count, err := s.ctrl.Replay(since)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"replayed": count})
+}
+
+// GET /api/worked?call=K1ABC[&band=20m&mode=FT8]
+func (s *Server) handleWorked(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	query := req.URL.Query()
+	call := query.Get("call")
+	if call == "" {
+		writeError(w, http.StatusBadRequest, "call is required")
+		return
+	}
+	band, mode := query.Get("band"), query.Get("mode")
+
+	record, status, err := s.ctrl.WorkedBefore(call, band, mode)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	body := struct {
+		workeddb.Record
+		Worked bool             `json:"worked"`
+		Status *workeddb.Status `json:"status,omitempty"` // Only with band and mode
+	}{Record: record, Worked: len(record.Slots) > 0}
+	if band != "" && mode != "" {
+		body.Status = &status
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// GET /api/qso/{id} returns a forwarded QSO, PUT corrects it (fields left
+// out of the body keep their values) and DELETE deletes it from the targets
+func (s *Server) handleQSO(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/api/qso/")
+	qso, ok := s.ctrl.QSO(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no forwarded QSO with ID %q", id))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, qso)
+	case http.MethodPut:
+		if err := json.NewDecoder(req.Body).Decode(&qso); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid QSO: "+err.Error())
+			return
+		}
+		// The ID in the path names the QSO being corrected
+		qso.ID = id
+		if err := s.ctrl.ReplaceQSO(qso); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, qso)
+	case http.MethodDelete:
+		if err := s.ctrl.DeleteQSO(id); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET, PUT or DELETE")
+	}
+}
+
+// GET /api/review lists the QSOs held for review
+func (s *Server) handleReview(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.PendingQSOs())
+}
+
+// GET /api/review/{id or number} returns a QSO held for review, POST
+// forwards it as it is, PUT corrects it (fields left out of the body keep
+// their values) and forwards it, and DELETE discards it
+func (s *Server) handleReviewQSO(w http.ResponseWriter, req *http.Request) {
+	ref := strings.TrimPrefix(req.URL.Path, "/api/review/")
+	var pending *review.Pending
+	for _, p := range s.ctrl.PendingQSOs() {
+		if p.QSO.ID == ref || strconv.Itoa(p.Number) == ref {
+			pending = &p
+			break
+		}
+	}
+	if pending == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no QSO held for review as %q", ref))
+		return
+	}
+
+	var qso formatter.QSO
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, pending)
+		return
+	case http.MethodPost:
+		qso, err = s.ctrl.ForwardPending(pending.QSO.ID, nil)
+	case http.MethodPut:
+		corrected := pending.QSO
+		if err := json.NewDecoder(req.Body).Decode(&corrected); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid QSO: "+err.Error())
+			return
+		}
+		qso, err = s.ctrl.ForwardPending(pending.QSO.ID, &corrected)
+	case http.MethodDelete:
+		qso, err = s.ctrl.DiscardPending(pending.QSO.ID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET, POST, PUT or DELETE")
+		return
+	}
+	if err != nil {
+		// Forwarded or discarded meanwhile, e.g. by its timeout
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, qso)
+}
+
+// GET /api/activity
+func (s *Server) handleActivity(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	digest, err := s.ctrl.Activity()
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, digest)
+}
+
+// Map marker limits for GET /api/map
+const (
+	defaultMapLimit = 500
+	maxMapLimit     = 5000
+)
+
+// GET /api/map[?limit=500&since=2024-06-01T00:00:00Z] returns the newest
+// forwarded QSOs with a grid as map markers. Poll with since set to the
+// newest marker's time to get only QSOs logged after it.
+func (s *Server) handleMap(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	query := req.URL.Query()
+	limit := defaultMapLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMapLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1 to %d", maxMapLimit))
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be RFC3339, e.g. 2024-06-01T00:00:00Z")
+			return
+		}
+		since = t
+	}
+
+	markers := s.ctrl.QSOMap(limit, since)
+	if markers == nil {
+		markers = []qsomap.Marker{}
+	}
+	writeJSON(w, http.StatusOK, markers)
+}
+
+// Message limits for GET /api/messages
+const (
+	defaultMessageLimit = 100
+	maxMessageLimit     = 5000
+)
+
+// GET /api/messages[?limit=100&since=2024-06-01T00:00:00Z&call=K1ABC]
+// returns the newest JS8Call directed messages, optionally only those from
+// or to call
+func (s *Server) handleMessages(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	query := req.URL.Query()
+	limit := defaultMessageLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMessageLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1 to %d", maxMessageLimit))
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be RFC3339, e.g. 2024-06-01T00:00:00Z")
+			return
+		}
+		since = t
+	}
+
+	messages, err := s.ctrl.Messages(limit, since, strings.ToUpper(strings.TrimSpace(query.Get("call"))))
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if messages == nil {
+		messages = []formatter.JS8Message{}
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// GET /api/events/schema returns the JSON Schema of the /ws events
+func (s *Server) handleEventSchema(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(events.Schema)
+}
+
+// GET /ws streams events to a WebSocket client as JSON text messages,
+// optionally only those of ?types=qso,paused,...
+func (s *Server) handleWebSocket(w http.ResponseWriter, req *http.Request) {
+	var types map[string]bool
+	if value := req.URL.Query().Get("types"); value != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(value, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !events.ValidType(t) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown event type %q (use qso, started, stopping, paused or resumed)", t))
+				return
+			}
+			types[t] = true
+		}
+	}
+
+	// Subscribed before the handshake, so that nothing published once the
+	// client is connected is missed
+	sub := s.ctrl.Subscribe()
+	defer sub.Close()
+	ws, err := upgradeWebSocket(w, req)
+	if err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.readLoop()
+	}()
+	ping := time.NewTicker(websocketPingInterval)
+	defer ping.Stop()
+
+	send := func(e events.Event) error {
+		if types != nil && !types[e.Type] {
+			return nil
+		}
+		e.Missed = sub.Missed()
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return ws.writeFrame(opText, data)
+	}
+
+	for {
+		select {
+		case e := <-sub.Events():
+			if err := send(e); err != nil {
+				ws.conn.Close()
+				<-done
+				return
+			}
+		case <-ping.C:
+			ws.writeFrame(opPing, nil)
+		case <-done:
+			ws.conn.Close()
+			return
+		case <-s.closing:
+			// Pass on what the relay said while stopping, then go away
+			for drained := false; !drained; {
+				select {
+				case e := <-sub.Events():
+					if send(e) != nil {
+						drained = true
+					}
+				default:
+					drained = true
+				}
+			}
+			ws.close(1001)
+			<-done
+			return
+		}
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write control API response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
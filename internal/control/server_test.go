@@ -0,0 +1,509 @@
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/activity"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/qsomap"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
+)
+
+// fakeController records calls made through the API
+type fakeController struct {
+	targets  []config.TargetConfig
+	mappings []config.FieldMapping
+	verbose  bool
+	paused   bool
+	since    time.Time
+	qsos     map[string]formatter.QSO
+	deleted  string
+	op       string
+	levels   map[string]string
+	pending  []review.Pending
+	sent     []formatter.QSO // Released from review
+	mapLimit int
+	msgCall  string
+	hub      events.Hub
+}
+
+func (f *fakeController) GetStats() map[string]interface{} {
+	return map[string]interface{}{"paused": f.paused}
+}
+func (f *fakeController) Stats() stats.Snapshot {
+	return stats.Snapshot{QSOs: 42}
+}
+func (f *fakeController) ParseFailures() []stats.Failure {
+	return []stats.Failure{{Source: "127.0.0.1:2237", Type: "fldigi", Error: "no callsign found", Payload: "hello"}}
+}
+func (f *fakeController) Targets() []config.TargetConfig { return f.targets }
+func (f *fakeController) SetTargets(t []config.TargetConfig) error {
+	f.targets = t
+	return nil
+}
+func (f *fakeController) FieldMappings() []config.FieldMapping { return f.mappings }
+func (f *fakeController) SetFieldMappings(m []config.FieldMapping) error {
+	for _, mapping := range m {
+		if len(mapping.Set) == 0 {
+			return fmt.Errorf("nothing to set")
+		}
+	}
+	f.mappings = m
+	return nil
+}
+func (f *fakeController) SetVerbose(v bool)            { f.verbose = v }
+func (f *fakeController) LogLevels() map[string]string { return f.levels }
+func (f *fakeController) SetLogLevels(levels map[string]string) error {
+	for module, level := range levels {
+		if _, ok := f.levels[module]; !ok {
+			return fmt.Errorf("unknown log module %q", module)
+		}
+		f.levels[module] = level
+	}
+	return nil
+}
+func (f *fakeController) Pause()           { f.paused = true }
+func (f *fakeController) Resume()          { f.paused = false }
+func (f *fakeController) Operator() string { return f.op }
+func (f *fakeController) SetOperator(call string) error {
+	if call == "BAD!" {
+		return fmt.Errorf("%q is not a valid callsign", call)
+	}
+	f.op = call
+	return nil
+}
+func (f *fakeController) Replay(since time.Time) (int, error) {
+	f.since = since
+	return 3, nil
+}
+func (f *fakeController) WorkedBefore(call, band, mode string) (workeddb.Record, workeddb.Status, error) {
+	record := workeddb.Record{Call: call, Slots: []workeddb.Contact{{Call: call, Band: "20m", Mode: "FT8"}}}
+	return record, workeddb.Status{NewSlot: band != "20m"}, nil
+}
+
+func (f *fakeController) QSO(id string) (formatter.QSO, bool) {
+	qso, ok := f.qsos[id]
+	return qso, ok
+}
+func (f *fakeController) ReplaceQSO(qso formatter.QSO) error {
+	f.qsos[qso.ID] = qso
+	return nil
+}
+func (f *fakeController) DeleteQSO(id string) error {
+	f.deleted = id
+	return nil
+}
+func (f *fakeController) PendingQSOs() []review.Pending { return f.pending }
+func (f *fakeController) ForwardPending(id string, corrected *formatter.QSO) (formatter.QSO, error) {
+	qso, err := f.DiscardPending(id)
+	if err != nil {
+		return qso, err
+	}
+	if corrected != nil {
+		qso = *corrected
+	}
+	f.sent = append(f.sent, qso)
+	return qso, nil
+}
+func (f *fakeController) DiscardPending(id string) (formatter.QSO, error) {
+	for i, p := range f.pending {
+		if p.QSO.ID == id {
+			f.pending = append(f.pending[:i], f.pending[i+1:]...)
+			return p.QSO, nil
+		}
+	}
+	return formatter.QSO{}, review.ErrNotHeld
+}
+func (f *fakeController) Activity() (activity.Digest, error) {
+	return activity.Digest{Window: "15m0s", Bands: []activity.Band{{Band: "20m", Mode: "FT8", CQs: 12, Calls: 9}}}, nil
+}
+
+func (f *fakeController) QSOMap(limit int, since time.Time) []qsomap.Marker {
+	f.mapLimit, f.since = limit, since
+	return []qsomap.Marker{{Callsign: "G4ABC", Band: "20m", Grid: "IO91", Position: qsomap.Point{Lat: 51.5, Lon: -1}, Color: qsomap.BandColor("20m")}}
+}
+
+func (f *fakeController) Messages(limit int, since time.Time, call string) ([]formatter.JS8Message, error) {
+	f.msgCall = call
+	return []formatter.JS8Message{{From: "K1ABC", To: "N7AKG", Command: "MSG", Text: "K1ABC: N7AKG MSG HELLO"}}, nil
+}
+
+func (f *fakeController) Subscribe() *events.Subscription {
+	return f.hub.Subscribe()
+}
+
+func request(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestControlAPI(t *testing.T) {
+	ctrl := &fakeController{levels: map[string]string{"relay": "info", "formatter": "info"}}
+	srv, err := New("127.0.0.1:0", "secret", ctrl)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if rec := request(t, h, http.MethodGet, "/api/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/status", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", rec.Code)
+	}
+
+	if rec := request(t, h, http.MethodPost, "/api/pause", "secret", ""); rec.Code != http.StatusOK || !ctrl.paused {
+		t.Errorf("Pause failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodPost, "/api/resume", "secret", ""); rec.Code != http.StatusOK || ctrl.paused {
+		t.Errorf("Resume failed: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := request(t, h, http.MethodPut, "/api/verbose", "secret", `{"verbose":true}`); rec.Code != http.StatusOK || !ctrl.verbose {
+		t.Errorf("Verbose failed: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := request(t, h, http.MethodPut, "/api/log/levels", "secret", `{"formatter":"debug"}`); rec.Code != http.StatusOK || ctrl.levels["formatter"] != "debug" {
+		t.Errorf("SetLogLevels failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/log/levels", "secret", ""); !strings.Contains(rec.Body.String(), `"relay":"info"`) {
+		t.Errorf("LogLevels failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodPut, "/api/log/levels", "secret", `{"sockets":"debug"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Unknown module: expected 400, got %d", rec.Code)
+	}
+
+	if rec := request(t, h, http.MethodPut, "/api/operator", "secret", `{"operator":"K1ABC"}`); rec.Code != http.StatusOK || ctrl.op != "K1ABC" {
+		t.Errorf("SetOperator failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/operator", "secret", ""); !strings.Contains(rec.Body.String(), `"operator":"K1ABC"`) {
+		t.Errorf("Operator failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodPut, "/api/operator", "secret", `{"operator":"BAD!"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid operator: expected 400, got %d", rec.Code)
+	}
+	if rec := request(t, h, http.MethodPut, "/api/operator", "secret", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Missing operator: expected 400, got %d", rec.Code)
+	}
+
+	rec := request(t, h, http.MethodPut, "/api/targets", "secret", `[{"address":"127.0.0.1","port":9871,"format":"wintest"}]`)
+	if rec.Code != http.StatusOK || len(ctrl.targets) != 1 || ctrl.targets[0].Format != "wintest" {
+		t.Errorf("SetTargets failed: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = request(t, h, http.MethodPut, "/api/mappings", "secret", `[{"type":"js8call","set":{"exchange":"{{.grid}}"}}]`)
+	if rec.Code != http.StatusOK || len(ctrl.mappings) != 1 || ctrl.mappings[0].Set["exchange"] != "{{.grid}}" {
+		t.Errorf("SetFieldMappings failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodPut, "/api/mappings", "secret", `[{"type":"js8call"}]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid mapping: expected 400, got %d", rec.Code)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/stats", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"qsos":42`) {
+		t.Errorf("Stats failed: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/errors", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"error":"no callsign found"`) {
+		t.Errorf("Errors failed: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = request(t, h, http.MethodPost, "/api/replay?since=2024-06-01T00:00:00Z", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"replayed":3`) {
+		t.Errorf("Replay failed: %d %s", rec.Code, rec.Body)
+	}
+	if !ctrl.since.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Replay since = %v", ctrl.since)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/worked?call=K1ABC&band=40m&mode=FT8", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"worked":true`) ||
+		!strings.Contains(rec.Body.String(), `"new_slot":true`) {
+		t.Errorf("Worked lookup failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/worked", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Worked lookup without a call: %d", rec.Code)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/activity", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"cqs":12`) {
+		t.Errorf("Activity failed: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/map?limit=50&since=2024-06-01T12:00:00Z", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"grid":"IO91"`) {
+		t.Errorf("Map failed: %d %s", rec.Code, rec.Body)
+	}
+	if ctrl.mapLimit != 50 || !ctrl.since.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Map limit %d since %v", ctrl.mapLimit, ctrl.since)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/map?limit=0", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Map with limit 0: %d", rec.Code)
+	}
+
+	rec = request(t, h, http.MethodGet, "/api/messages?call=n7akg", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"from":"K1ABC"`) || ctrl.msgCall != "N7AKG" {
+		t.Errorf("Messages failed: %d %s (call %q)", rec.Code, rec.Body, ctrl.msgCall)
+	}
+}
+
+func TestControlQSOEdits(t *testing.T) {
+	ctrl := &fakeController{qsos: map[string]formatter.QSO{
+		"abc123": {ID: "abc123", Callsign: "K1ABC", Band: "20m", Mode: "FT8", RST_Sent: "-05"},
+	}}
+	srv, err := New("127.0.0.1:0", "secret", ctrl)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := srv.Handler()
+
+	rec := request(t, h, http.MethodGet, "/api/qso/abc123", "secret", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"callsign":"K1ABC"`) {
+		t.Errorf("QSO lookup failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/qso/nope", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown QSO: expected 404, got %d", rec.Code)
+	}
+
+	// Fields left out keep their values, and the path ID wins over the body's
+	rec = request(t, h, http.MethodPut, "/api/qso/abc123", "secret", `{"callsign":"K1ABD","id":"other"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Correction failed: %d %s", rec.Code, rec.Body)
+	}
+	if qso := ctrl.qsos["abc123"]; qso.Callsign != "K1ABD" || qso.RST_Sent != "-05" || qso.ID != "abc123" {
+		t.Errorf("Corrected QSO = %+v", qso)
+	}
+	if _, ok := ctrl.qsos["other"]; ok {
+		t.Error("Correction used the body ID")
+	}
+
+	if rec := request(t, h, http.MethodDelete, "/api/qso/abc123", "secret", ""); rec.Code != http.StatusOK || ctrl.deleted != "abc123" {
+		t.Errorf("Delete failed: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestControlReview(t *testing.T) {
+	ctrl := &fakeController{pending: []review.Pending{
+		{Number: 1, QSO: formatter.QSO{ID: "abc123", Callsign: "K1ABC", Exchange: "5NN 05"}},
+		{Number: 2, QSO: formatter.QSO{ID: "def456", Callsign: "W1XYZ", Exchange: "5NN 04"}},
+		{Number: 3, QSO: formatter.QSO{ID: "ghi789", Callsign: "N0CALL"}},
+	}}
+	srv, err := New("127.0.0.1:0", "secret", ctrl)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if rec := request(t, h, http.MethodGet, "/api/review", "secret", ""); !strings.Contains(rec.Body.String(), `"callsign":"W1XYZ"`) {
+		t.Errorf("Review list failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/review/2", "secret", ""); !strings.Contains(rec.Body.String(), `"id":"def456"`) {
+		t.Errorf("Lookup by number failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/review/nope", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown QSO: expected 404, got %d", rec.Code)
+	}
+
+	// Fields left out keep their values
+	if rec := request(t, h, http.MethodPut, "/api/review/abc123", "secret", `{"callsign":"K1ABD"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Correction failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodPost, "/api/review/def456", "secret", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Release failed: %d %s", rec.Code, rec.Body)
+	}
+	if len(ctrl.sent) != 2 || ctrl.sent[0].Callsign != "K1ABD" || ctrl.sent[0].Exchange != "5NN 05" || ctrl.sent[1].Callsign != "W1XYZ" {
+		t.Errorf("Forwarded QSOs = %+v", ctrl.sent)
+	}
+
+	if rec := request(t, h, http.MethodDelete, "/api/review/3", "secret", ""); rec.Code != http.StatusOK || len(ctrl.pending) != 0 {
+		t.Errorf("Discard failed: %d %s", rec.Code, rec.Body)
+	}
+	if len(ctrl.sent) != 2 {
+		t.Error("A discarded QSO was forwarded")
+	}
+}
+
+func TestControlRequiresLoopback(t *testing.T) {
+	if _, err := New("0.0.0.0:8075", "", &fakeController{}); err == nil {
+		t.Error("Expected non-loopback address to be rejected")
+	}
+
+	srv, err := New("localhost:8075", "", &fakeController{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if len(srv.Token()) != 32 {
+		t.Errorf("Expected generated token, got %q", srv.Token())
+	}
+}
+
+// readServerFrame reads one unmasked frame from the server
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	size := int(header[1] & 0x7F)
+	if size == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// clientFrame builds a masked frame, as browsers send
+func clientFrame(opcode byte, payload []byte) []byte {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestControlWebSocket(t *testing.T) {
+	ctrl := &fakeController{}
+	srv, err := New("127.0.0.1:0", "secret", ctrl)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if rec := request(t, h, http.MethodGet, "/api/events/schema", "secret", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"$schema"`) {
+		t.Errorf("Schema failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, h, http.MethodGet, "/api/status?token=secret", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Query token outside /ws: expected 401, got %d", rec.Code)
+	}
+	if rec := request(t, h, http.MethodGet, "/ws?types=qso,bogus", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Unknown event type: expected 400, got %d", rec.Code)
+	}
+	if rec := request(t, h, http.MethodGet, "/ws", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Plain GET of /ws: expected 400, got %d", rec.Code)
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The example key and accept value from RFC 6455
+	fmt.Fprintf(conn, "GET /ws?token=secret&types=qso HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", ts.Listener.Addr())
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake response %d, accept %q", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// Only the requested types come through
+	ctrl.hub.Publish(events.Event{Type: events.TypePaused})
+	ctrl.hub.Publish(events.Event{Type: events.TypeQSO, QSO: &formatter.QSO{Callsign: "K1ABC", Band: "20m"}, Source: "wsjt-x", Targets: 2})
+	opcode, payload := readServerFrame(t, reader)
+	var e events.Event
+	if err := json.Unmarshal(payload, &e); opcode != 0x1 || err != nil || e.Type != events.TypeQSO || e.QSO == nil || e.QSO.Callsign != "K1ABC" || e.Targets != 2 {
+		t.Errorf("expected the QSO event as text, got opcode %d %s (%v)", opcode, payload, err)
+	}
+
+	conn.Write(clientFrame(0x9, []byte("hi")))
+	if opcode, payload := readServerFrame(t, reader); opcode != 0xA || string(payload) != "hi" {
+		t.Errorf("expected a pong with the ping's data, got opcode %d %q", opcode, payload)
+	}
+
+	conn.Write(clientFrame(0x8, []byte{0x03, 0xE8}))
+	if opcode, payload := readServerFrame(t, reader); opcode != 0x8 || !bytes.Equal(payload, []byte{0x03, 0xE8}) {
+		t.Errorf("expected the close echoed, got opcode %d %v", opcode, payload)
+	}
+}
+
+func TestControlOverlay(t *testing.T) {
+	srv, err := New("127.0.0.1:0", "secret", &fakeController{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	srv.SetOverlay(config.OverlayConfig{Title: "W1AW </title>", Theme: "light", Accent: "#00ff88", Show: []string{"rate", "last_qso"}})
+	h := srv.Handler()
+
+	if rec := request(t, h, http.MethodGet, "/overlay", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("No token: expected 401, got %d", rec.Code)
+	}
+	rec := request(t, h, http.MethodGet, "/overlay?token=secret", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Overlay failed: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	page := rec.Body.String()
+	if strings.Contains(page, "W1AW </title>") || !strings.Contains(page, "W1AW &lt;/title&gt;") {
+		t.Error("title was not escaped")
+	}
+	if !strings.Contains(page, "#00ff88") || !strings.Contains(page, "rgba(255, 255, 255, 0.85)") {
+		t.Error("expected the accent override over the light theme")
+	}
+	rate, last := strings.Index(page, `id="rate"`), strings.Index(page, `id="last_qso"`)
+	if rate < 0 || last < 0 || rate > last || strings.Contains(page, `id="band"`) {
+		t.Error("expected rate then last QSO, and no band")
+	}
+	if rec := request(t, h, http.MethodPost, "/overlay?token=secret", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", rec.Code)
+	}
+}
+
+func TestMapPage(t *testing.T) {
+	srv, err := New("127.0.0.1:0", "secret", &fakeController{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if rec := request(t, h, http.MethodGet, "/map", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("No token: expected 401, got %d", rec.Code)
+	}
+	rec := request(t, h, http.MethodGet, "/map?token=secret", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Map failed: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	page := rec.Body.String()
+	if !strings.Contains(page, `const token = "secret";`) {
+		t.Error("expected the token in the page script")
+	}
+	if !strings.Contains(page, `"/api/map"`) || !strings.Contains(page, `"/ws?types=qso&token="`) {
+		t.Error("expected the page to draw /api/map and follow qso events on /ws")
+	}
+	if rec := request(t, h, http.MethodPost, "/map?token=secret", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", rec.Code)
+	}
+}
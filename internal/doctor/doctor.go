@@ -0,0 +1,390 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/comport"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/relay"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusOK   Status = "OK"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+)
+
+// Finding is the result of one check, with a suggested fix when it didn't pass
+type Finding struct {
+	Status Status
+	Check  string
+	Detail string
+	Fix    string
+}
+
+// Run performs all checks against cfg
+func Run(cfg *config.Config) []Finding {
+	var findings []Finding
+	findings = append(findings, checkConfig(cfg)...)
+	findings = append(findings, checkListenPort(cfg))
+	for _, lc := range cfg.Listeners {
+		findings = append(findings, checkPort(lc, fmt.Sprintf("Listener :%d", lc.Port)))
+	}
+	findings = append(findings, checkPipeline(cfg))
+	for _, t := range cfg.AllTargets() {
+		findings = append(findings, checkTarget(t))
+	}
+	if cfg.Rig.Enabled {
+		findings = append(findings, checkRig(cfg.Rig.Address))
+	}
+	if cfg.GPS.Enabled {
+		findings = append(findings, checkGPS(cfg.GPS.Address))
+	}
+	if cfg.Rotator.Enabled && cfg.Rotator.Protocol == "rotctld" {
+		findings = append(findings, checkRotator(cfg.Rotator.Address))
+	}
+	if cfg.SerialPort.Enabled {
+		findings = append(findings, checkSerialPort(cfg.SerialPort.Port, cfg.SerialPort.Baud))
+	}
+	return findings
+}
+
+// Print writes the findings and reports whether every check passed
+func Print(w io.Writer, findings []Finding) bool {
+	ok := true
+	for _, f := range findings {
+		fmt.Fprintf(w, "[%-4s] %s: %s\n", f.Status, f.Check, f.Detail)
+		if f.Fix != "" {
+			fmt.Fprintf(w, "       -> %s\n", f.Fix)
+		}
+		if f.Status == StatusFail {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkConfig validates settings that would stop the relay from starting
+func checkConfig(cfg *config.Config) []Finding {
+	var findings []Finding
+
+	if cfg.ConfigFileUsed != "" {
+		findings = append(findings, Finding{StatusOK, "Config", "using " + cfg.ConfigFileUsed, ""})
+	} else {
+		findings = append(findings, Finding{StatusOK, "Config", "no config file found, using defaults and environment", ""})
+	}
+
+	for _, t := range cfg.AllTargets() {
+		if t.Format != "" && !formatter.ValidOutputFormat(t.Format) {
+			findings = append(findings, Finding{StatusFail, "Config",
+				fmt.Sprintf("unknown output format %q for %s:%d", t.Format, t.Address, t.Port),
+				"use one of n1mm, wintest, dxlog, adif"})
+		}
+	}
+
+	if _, err := relay.New(cfg); err != nil {
+		findings = append(findings, Finding{StatusFail, "Config", err.Error(), "fix the setting named in the error"})
+	}
+
+	return findings
+}
+
+// checkListenPort checks that the relay's listen port is free
+func checkListenPort(cfg *config.Config) Finding {
+	return checkPort(cfg.MainListener(), "Listen port")
+}
+
+// checkPort checks that a UDP port the relay listens on is free, can be
+// shared when reuse_port is set, or that its multicast group can be joined
+func checkPort(lc config.ListenerConfig, check string) Finding {
+	if lc.MulticastGroup != "" {
+		return checkMulticast(lc, check)
+	}
+
+	addr, err := relay.BindAddr(lc)
+	if err != nil {
+		return Finding{StatusFail, check, err.Error(), "check the interface name with ip addr (ipconfig on Windows) and that it has an IPv4 address"}
+	}
+	port, reusePort := lc.Port, lc.ReusePort
+
+	if _, err := net.ResolveUDPAddr("udp", addr); err != nil {
+		return Finding{StatusFail, check, fmt.Sprintf("cannot resolve %s: %v", addr, err), "check listen.address"}
+	}
+
+	conn, err := relay.ListenUDP(addr, reusePort)
+	if err == nil && reusePort {
+		conn.Close()
+		return Finding{StatusOK, check, addr + " can be bound with reuse_port", ""}
+	}
+	if err == nil {
+		conn.Close()
+		return Finding{StatusOK, check, addr + " is free", ""}
+	}
+
+	if errors.Is(err, syscall.EADDRINUSE) || strings.Contains(strings.ToLower(err.Error()), "address already in use") ||
+		strings.Contains(strings.ToLower(err.Error()), "only one usage") {
+		detail := addr + " is already in use"
+		if owner := portOwner(port); owner != "" {
+			detail += " by " + owner
+		}
+		fix := "stop the other program (or another copy of the relay) or choose a different --listen-port and point the source application at it"
+		if !reusePort {
+			fix += "; if the other program allows sharing the port, set reuse_port: true"
+		}
+		return Finding{StatusFail, check, detail, fix}
+	}
+
+	return Finding{StatusFail, check, err.Error(), "check listen.address is an address of this computer"}
+}
+
+// checkMulticast checks that a listener's multicast group can be joined
+func checkMulticast(lc config.ListenerConfig, check string) Finding {
+	group := net.JoinHostPort(lc.MulticastGroup, strconv.Itoa(lc.Port))
+	conn, err := relay.ListenMulticast(lc.MulticastGroup, lc.Port, lc.MulticastInterface)
+	if err != nil {
+		return Finding{StatusFail, check, fmt.Sprintf("cannot join multicast group %s: %v", group, err),
+			"set multicast_interface to the network interface WSJT-X's multicast traffic arrives on"}
+	}
+	conn.Close()
+	return Finding{StatusOK, check, "joined multicast group " + group, ""}
+}
+
+// portOwner tries to name the process bound to a UDP port using the
+// platform's tools. It returns "" if that isn't possible.
+func portOwner(port int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p := strconv.Itoa(port)
+	switch runtime.GOOS {
+	case "windows":
+		out, err := exec.CommandContext(ctx, "netstat", "-ano", "-p", "udp").Output()
+		if err != nil {
+			return ""
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && strings.HasSuffix(fields[1], ":"+p) {
+				pid := fields[len(fields)-1]
+				name := pid
+				if tl, err := exec.CommandContext(ctx, "tasklist", "/FI", "PID eq "+pid, "/FO", "CSV", "/NH").Output(); err == nil {
+					if parts := strings.Split(string(tl), ","); len(parts) > 0 && strings.Trim(parts[0], "\" \r\n") != "" {
+						name = strings.Trim(parts[0], "\"") + " (PID " + pid + ")"
+					}
+				}
+				return name
+			}
+		}
+	default:
+		out, err := exec.CommandContext(ctx, "lsof", "-nP", "-iUDP:"+p).Output()
+		if err != nil {
+			return ""
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(lines) >= 2 {
+			fields := strings.Fields(lines[1])
+			if len(fields) >= 2 {
+				return fields[0] + " (PID " + fields[1] + ")"
+			}
+		}
+	}
+	return ""
+}
+
+// checkPipeline runs a private relay on loopback with the configured
+// formatting and sends a test QSO through it
+func checkPipeline(cfg *config.Config) Finding {
+	check := "Pipeline"
+
+	capture, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return Finding{StatusFail, check, "cannot open loopback socket: " + err.Error(), "check that the loopback interface is up"}
+	}
+	defer capture.Close()
+
+	test := *cfg
+	test.Listen.Address = "127.0.0.1"
+	test.Listen.Port = 0
+	test.Listeners = nil
+	test.Target = config.TargetConfig{Address: "127.0.0.1", Port: capture.LocalAddr().(*net.UDPAddr).Port, Format: cfg.Target.Format}
+	test.Targets = nil
+	test.Verbose = false
+	test.Formatting.AutoDetect = true
+	test.Journal.Path = ""
+	test.WorkedDB.Enabled = false
+	test.Archive.Enabled = false
+	test.APRS.Enabled = false
+	test.SerialPort.Enabled = false
+	test.Bridge.Enabled = false
+	test.Winlink.Enabled = false
+	test.Heartbeat.Enabled = false
+	test.Rig.Enabled = false
+	test.GPS.Enabled = false
+	test.Rotator.Enabled = false
+	test.Alerts.Enabled = false
+	test.Log.Trace = false
+	test.Auth.Enabled = false
+	test.Chain.TCPListen = ""
+	test.Stats.Path = ""
+	test.Control.Enabled = false
+
+	r, err := relay.New(&test)
+	if err != nil {
+		return Finding{StatusFail, check, err.Error(), "fix the configuration error above"}
+	}
+
+	// The relay logs every forwarded QSO; keep the report readable
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- r.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-errc
+	}()
+
+	select {
+	case <-r.Ready():
+	case err := <-errc:
+		return Finding{StatusFail, check, "relay failed to start: " + fmt.Sprint(err), ""}
+	case <-time.After(3 * time.Second):
+		return Finding{StatusFail, check, "relay did not start", ""}
+	}
+
+	source, err := net.DialUDP("udp", nil, r.ListenAddr().(*net.UDPAddr))
+	if err != nil {
+		return Finding{StatusFail, check, err.Error(), ""}
+	}
+	defer source.Close()
+
+	sample := "<call:4>W1AW <band:3>20m <mode:3>FT8 <freq:9>14.074000 <qso_date:8>20240601 <time_on:6>120000 <programid:6>WSJT-X <eor>"
+	if _, err := source.Write([]byte(sample)); err != nil {
+		return Finding{StatusFail, check, err.Error(), ""}
+	}
+
+	buf := make([]byte, 65536)
+	capture.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := capture.ReadFromUDP(buf)
+	if err != nil {
+		return Finding{StatusFail, check, "test QSO was not forwarded", "run with --verbose to see why messages are dropped (e.g. callsign rejection or SCP settings)"}
+	}
+	if !strings.Contains(string(buf[:n]), "W1AW") {
+		return Finding{StatusWarn, check, "forwarded output does not contain the test callsign", ""}
+	}
+
+	format := cfg.Target.Format
+	if format == "" {
+		format = "n1mm"
+	}
+	return Finding{StatusOK, check, fmt.Sprintf("test QSO parsed and formatted as %s (%d bytes)", format, n), ""}
+}
+
+// checkTarget sends an empty datagram to a target and watches for an ICMP
+// port unreachable, which means nothing is listening there
+func checkTarget(t config.TargetConfig) Finding {
+	addr := net.JoinHostPort(t.Address, strconv.Itoa(t.Port))
+	check := "Target " + addr
+
+	if strings.EqualFold(t.Protocol, "tcp") {
+		conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+		if err != nil {
+			return Finding{StatusFail, check, "cannot connect: " + err.Error(),
+				"start the central relay with chain.tcp_listen set, and check the VPN or tunnel to it"}
+		}
+		conn.Close()
+		return Finding{StatusOK, check, "accepts TCP connections", ""}
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return Finding{StatusFail, check, "cannot resolve: " + err.Error(), "check the target address"}
+	}
+
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return Finding{StatusFail, check, "cannot send: " + err.Error(), "check the network route to the target"}
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(nil); err != nil {
+		return Finding{StatusFail, check, "send failed: " + err.Error(), "check the network route to the target"}
+	}
+
+	// A connected UDP socket reports an ICMP port unreachable on the next read
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	if err != nil && (errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "refused") ||
+		strings.Contains(err.Error(), "forcibly closed")) {
+		return Finding{StatusFail, check, "nothing is listening (port unreachable)",
+			"start the logger and enable its UDP listener on this port (N1MM: Config > Configure Ports > Broadcast Data)"}
+	}
+
+	if udpAddr.IP.IsLoopback() {
+		return Finding{StatusOK, check, "accepts datagrams", ""}
+	}
+	return Finding{StatusOK, check, "send succeeded; no port unreachable received (a firewall may still drop datagrams)", ""}
+}
+
+// checkRig checks that rigctld accepts connections
+func checkRig(addr string) Finding {
+	check := "rigctld " + addr
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return Finding{StatusWarn, check, "cannot connect: " + err.Error(),
+			"start rigctld (e.g. rigctld -m <model> -r <serial port>) or disable rig; QSOs are relayed without it"}
+	}
+	conn.Close()
+	return Finding{StatusOK, check, "accepts connections", ""}
+}
+
+// checkGPS checks that gpsd accepts connections
+func checkGPS(addr string) Finding {
+	check := "gpsd " + addr
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return Finding{StatusWarn, check, "cannot connect: " + err.Error(),
+			"start gpsd (e.g. gpsd -n /dev/ttyACM0) or disable gps; QSOs are relayed without a grid"}
+	}
+	conn.Close()
+	return Finding{StatusOK, check, "accepts connections", ""}
+}
+
+// checkRotator checks that rotctld accepts connections
+func checkRotator(addr string) Finding {
+	check := "rotctld " + addr
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return Finding{StatusWarn, check, "cannot connect: " + err.Error(),
+			"start rotctld (e.g. rotctld -m <model> -r <serial port>) or disable rotator; QSOs are relayed without it"}
+	}
+	conn.Close()
+	return Finding{StatusOK, check, "accepts connections", ""}
+}
+
+// checkSerialPort checks that the serial port opens at the configured baud
+func checkSerialPort(port string, baud int) Finding {
+	check := "Serial port " + port
+	if err := comport.Check(port, baud); err != nil {
+		return Finding{StatusWarn, check, "cannot open: " + err.Error(),
+			"check the device name and that this user may open it (e.g. the dialout group), or disable serial_port; QSOs are relayed without it"}
+	}
+	return Finding{StatusOK, check, fmt.Sprintf("opens at %d baud", baud), ""}
+}
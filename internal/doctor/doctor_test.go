@@ -0,0 +1,56 @@
+package doctor
+
+import (
+	"net"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Listen.Address = "127.0.0.1"
+	cfg.Target = config.TargetConfig{Address: "127.0.0.1", Port: 12060, Format: "n1mm"}
+	cfg.Formatting.AutoDetect = true
+	cfg.Formatting.N1MM.Station = "W1AW"
+	return cfg
+}
+
+func TestCheckPipeline(t *testing.T) {
+	for _, format := range []string{"n1mm", "adif", "wintest"} {
+		cfg := testConfig()
+		cfg.Target.Format = format
+		if f := checkPipeline(cfg); f.Status != StatusOK {
+			t.Errorf("%s: pipeline check = %+v", format, f)
+		}
+	}
+}
+
+func TestCheckListenPortInUse(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg := testConfig()
+	cfg.Listen.Port = conn.LocalAddr().(*net.UDPAddr).Port
+	if f := checkListenPort(cfg); f.Status != StatusFail || f.Fix == "" {
+		t.Errorf("expected failure with a fix for a bound port, got %+v", f)
+	}
+}
+
+func TestCheckTargetNotListening(t *testing.T) {
+	// Bind and release a port so nothing is listening on it
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	f := checkTarget(config.TargetConfig{Address: "127.0.0.1", Port: port})
+	if f.Status != StatusFail {
+		t.Errorf("expected failure for a closed port, got %+v", f)
+	}
+}
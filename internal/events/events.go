@@ -0,0 +1,118 @@
+// Package events fans relay events out to subscribers such as the control
+// API's WebSocket stream, so dashboards and stream overlays see each QSO as
+// it is forwarded instead of polling. Publishing never blocks the relay: a
+// subscriber that falls behind misses events and is told how many.
+package events
+
+import (
+	_ "embed"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Event types
+const (
+	TypeQSO      = "qso"      // A QSO, correction or deletion was forwarded
+	TypeStarted  = "started"  // A relay is listening
+	TypeStopping = "stopping" // A relay is shutting down
+	TypePaused   = "paused"   // Forwarding was paused
+	TypeResumed  = "resumed"  // Forwarding was resumed
+)
+
+// ValidType reports whether t names an event type
+func ValidType(t string) bool {
+	switch t {
+	case TypeQSO, TypeStarted, TypeStopping, TypePaused, TypeResumed:
+		return true
+	}
+	return false
+}
+
+// Schema is the JSON Schema of Event
+//
+//go:embed schema.json
+var Schema []byte
+
+// Event is something that happened in a relay. Its JSON form is described by
+// Schema; fields are only added, never renamed.
+type Event struct {
+	Type     string         `json:"type"`
+	Time     time.Time      `json:"time"`
+	Pipeline string         `json:"pipeline,omitempty"` // Empty for the main relay
+	QSO      *formatter.QSO `json:"qso,omitempty"`      // qso events only
+	Source   string         `json:"source,omitempty"`   // Source type of the QSO, e.g. wsjt-x
+	Targets  int            `json:"targets,omitempty"`  // Targets that accepted the QSO
+
+	// Missed counts the events this subscriber lost before this one
+	Missed int64 `json:"missed,omitempty"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+const subscriberBuffer = 256
+
+// Hub passes published events to every subscriber. The zero value is ready
+// to use.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events from a hub until it is closed
+type Subscription struct {
+	hub    *Hub
+	c      chan Event
+	missed atomic.Int64
+	once   sync.Once
+}
+
+// Subscribe starts receiving events
+func (h *Hub) Subscribe() *Subscription {
+	s := &Subscription{hub: h, c: make(chan Event, subscriberBuffer)}
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Publish sends e to every subscriber with room for it, setting its time if
+// unset
+func (h *Hub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		select {
+		case s.c <- e:
+		default:
+			s.missed.Add(1)
+		}
+	}
+}
+
+// Events returns the channel events arrive on; it is closed by Close
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Missed returns how many events were lost since it was last called
+func (s *Subscription) Missed() int64 {
+	return s.missed.Swap(0)
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.c)
+	})
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+func TestHub(t *testing.T) {
+	var h Hub
+	a, b := h.Subscribe(), h.Subscribe()
+
+	h.Publish(Event{Type: TypePaused})
+	for _, s := range []*Subscription{a, b} {
+		if e := <-s.Events(); e.Type != TypePaused || e.Time.IsZero() {
+			t.Errorf("got %+v, want a timed paused event", e)
+		}
+	}
+
+	// A subscriber that doesn't keep up misses events and learns how many
+	b.Close()
+	for i := 0; i < subscriberBuffer+3; i++ {
+		h.Publish(Event{Type: TypeQSO})
+	}
+	if n := a.Missed(); n != 3 {
+		t.Errorf("Missed = %d, want 3", n)
+	}
+	if n := a.Missed(); n != 0 {
+		t.Errorf("Missed after reading = %d, want 0", n)
+	}
+	if _, ok := <-b.Events(); ok {
+		t.Error("closed subscription still receives events")
+	}
+	a.Close()
+	a.Close()
+}
+
+// TestSchema checks that the schema describes every field of an event and
+// its QSO, so the two can't drift apart
+func TestSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       struct {
+			QSO struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"qso"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	check := func(name string, typ reflect.Type, properties map[string]json.RawMessage) {
+		fields := make(map[string]bool)
+		for i := 0; i < typ.NumField(); i++ {
+			field := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			fields[field] = true
+			if _, ok := properties[field]; !ok {
+				t.Errorf("%s field %q is missing from the schema", name, field)
+			}
+		}
+		for property := range properties {
+			if !fields[property] {
+				t.Errorf("schema describes %s field %q, which doesn't exist", name, property)
+			}
+		}
+	}
+	check("event", reflect.TypeOf(Event{}), schema.Properties)
+	check("QSO", reflect.TypeOf(formatter.QSO{}), schema.Defs.QSO.Properties)
+}
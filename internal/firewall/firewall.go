@@ -0,0 +1,153 @@
+// Package firewall creates and removes the Windows Firewall rules that let
+// datagrams from other PCs reach the relay. Blocked inbound UDP is the most
+// common reason a relay on one PC hears nothing from WSJT-X or N1MM on
+// another.
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+// RuleName names every rule the relay creates, so they can be listed and
+// removed together
+const RuleName = "N7AKG-UDP-Translator"
+
+// commandTimeout bounds a single netsh run
+const commandTimeout = 30 * time.Second
+
+// Port is a port the relay accepts traffic on from other hosts
+type Port struct {
+	Protocol string // UDP or TCP
+	Number   int
+	Purpose  string // e.g. "listen", "bridge", "pipeline digital"
+}
+
+// Ports returns the ports the configuration receives on, for the main relay
+// and its pipelines. Ports bound to a loopback address only hear the local
+// machine and need no rule.
+func Ports(cfg *config.Config) []Port {
+	var ports []Port
+	add := func(protocol, address string, number int, purpose string) {
+		if ip := net.ParseIP(address); number <= 0 || address == "localhost" || ip != nil && ip.IsLoopback() {
+			return
+		}
+		for _, p := range ports {
+			if p.Protocol == protocol && p.Number == number {
+				return
+			}
+		}
+		ports = append(ports, Port{Protocol: protocol, Number: number, Purpose: purpose})
+	}
+
+	for _, c := range append([]*config.Config{cfg}, cfg.PipelineConfigs...) {
+		purpose := "listen"
+		if c.Name != "" {
+			purpose = "pipeline " + c.Name
+		}
+		for _, l := range append([]config.ListenerConfig{c.MainListener()}, c.Listeners...) {
+			address := l.Address
+			if l.MulticastGroup != "" {
+				address = l.MulticastGroup
+			}
+			add("UDP", address, l.Port, purpose)
+		}
+	}
+
+	if cfg.Bridge.Enabled {
+		add("UDP", cfg.Bridge.ListenAddress, cfg.Bridge.ListenPort, "bridge")
+	}
+	if cfg.Chain.TCPListen != "" {
+		if host, port, err := net.SplitHostPort(cfg.Chain.TCPListen); err == nil {
+			number, _ := strconv.Atoi(port)
+			add("TCP", host, number, "chain")
+		}
+	}
+	return ports
+}
+
+// netsh is the prefix of every command
+var netsh = []string{"netsh", "advfirewall", "firewall"}
+
+// AddCommands returns the netsh commands that replace the relay's rules
+// with inbound allow rules for ports, one rule per protocol. A non-empty
+// program limits the rules to that executable.
+func AddCommands(ports []Port, program string) [][]string {
+	byProtocol := make(map[string][]string)
+	for _, p := range ports {
+		byProtocol[p.Protocol] = append(byProtocol[p.Protocol], strconv.Itoa(p.Number))
+	}
+	protocols := make([]string, 0, len(byProtocol))
+	for protocol := range byProtocol {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	commands := RemoveCommands()
+	for _, protocol := range protocols {
+		cmd := append(append([]string(nil), netsh...),
+			"add", "rule", "name="+RuleName, "dir=in", "action=allow",
+			"protocol="+protocol, "localport="+strings.Join(byProtocol[protocol], ","), "profile=any")
+		if program != "" {
+			cmd = append(cmd, "program="+program)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// RemoveCommands returns the netsh command that deletes every rule the
+// relay created
+func RemoveCommands() [][]string {
+	return [][]string{append(append([]string(nil), netsh...), "delete", "rule", "name="+RuleName)}
+}
+
+// ShowCommands returns the netsh command that lists the relay's rules
+func ShowCommands() [][]string {
+	return [][]string{append(append([]string(nil), netsh...), "show", "rule", "name="+RuleName, "verbose")}
+}
+
+// Format returns a command as it would be typed at a command prompt
+func Format(cmd []string) string {
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		if name, value, ok := strings.Cut(arg, "="); ok && strings.ContainsAny(value, " \t") {
+			arg = name + `="` + value + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Run runs the commands in order, copying their output to w, and stops at
+// the first failure. A delete that finds no rule to delete is not a failure.
+func Run(ctx context.Context, w io.Writer, commands [][]string) error {
+	for _, cmd := range commands {
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		out, err := exec.CommandContext(ctx, cmd[0], cmd[1:]...).CombinedOutput()
+		cancel()
+
+		deleting := len(cmd) > len(netsh) && cmd[len(netsh)] == "delete"
+		if err != nil && deleting && bytes.Contains(out, []byte("No rules match")) {
+			continue
+		}
+		w.Write(out)
+		if err != nil {
+			if bytes.Contains(bytes.ToLower(out), []byte("elevation")) {
+				return fmt.Errorf("%s: run the command from an administrator prompt", Format(cmd))
+			}
+			return fmt.Errorf("%s: %w", Format(cmd), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+func TestPorts(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Listen.Address = "0.0.0.0"
+	cfg.Listen.Port = 2333
+	cfg.Listeners = []config.ListenerConfig{
+		{Address: "127.0.0.1", Port: 2237},                // local only
+		{Address: "0.0.0.0", Port: 2333, ReusePort: true}, // already listed
+		{Port: 2238, MulticastGroup: "239.255.0.1"},
+	}
+	cfg.Bridge.Enabled = true
+	cfg.Bridge.ListenAddress = "0.0.0.0"
+	cfg.Bridge.ListenPort = 12061
+	cfg.Chain.TCPListen = "0.0.0.0:2334"
+
+	digital := &config.Config{Name: "digital"}
+	digital.Listen.Address = "0.0.0.0"
+	digital.Listen.Port = 2240
+	cfg.PipelineConfigs = []*config.Config{digital}
+
+	var got []string
+	for _, p := range Ports(cfg) {
+		got = append(got, fmt.Sprintf("%s %d %s", p.Protocol, p.Number, p.Purpose))
+	}
+	want := []string{"UDP 2333 listen", "UDP 2238 listen", "UDP 2240 pipeline digital", "UDP 12061 bridge", "TCP 2334 chain"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Ports = %v, want %v", got, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	ports := []Port{{"UDP", 2333, "listen"}, {"TCP", 2334, "chain"}, {"UDP", 12061, "bridge"}}
+	var got []string
+	for _, cmd := range AddCommands(ports, `C:\Program Files\Relay\N7AKG-UDP-Translator.exe`) {
+		got = append(got, Format(cmd))
+	}
+	want := []string{
+		`netsh advfirewall firewall delete rule name=N7AKG-UDP-Translator`,
+		`netsh advfirewall firewall add rule name=N7AKG-UDP-Translator dir=in action=allow protocol=TCP localport=2334 profile=any program="C:\Program Files\Relay\N7AKG-UDP-Translator.exe"`,
+		`netsh advfirewall firewall add rule name=N7AKG-UDP-Translator dir=in action=allow protocol=UDP localport=2333,12061 profile=any program="C:\Program Files\Relay\N7AKG-UDP-Translator.exe"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("AddCommands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,113 @@
+package fldigi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config holds the fldigi XML-RPC connection and polling settings
+type Config struct {
+	Address  string        // fldigi XML-RPC host:port
+	Interval time.Duration // Time between polls
+
+	// OnQSO is called from Run with the ADIF record of each QSO fldigi logs
+	OnQSO func(record string)
+}
+
+// Poller watches fldigi's log entry fields over XML-RPC and reports each QSO
+// when it is saved.
+//
+// fldigi has no XML-RPC notification for a saved QSO, so the poller follows
+// the callsign field: when it is cleared or replaced, the last logbook record
+// for the call is fetched with log.get_record. If it differs from the record
+// fldigi had when the call was entered, the QSO was saved. A call cleared
+// without saving, or a station worked before, produces nothing.
+type Poller struct {
+	cfg    Config
+	url    string
+	client *http.Client
+
+	call     string // Callsign in the log entry fields
+	baseline string // Last logbook record for call when it was entered
+}
+
+// NewPoller creates an fldigi poller. It does not connect until Run is called.
+func NewPoller(cfg Config) (*Poller, error) {
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:7362"
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("fldigi: invalid XML-RPC address %q: %w", cfg.Address, err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return &Poller{
+		cfg:    cfg,
+		url:    "http://" + cfg.Address + "/RPC2",
+		client: &http.Client{},
+	}, nil
+}
+
+// Run polls fldigi until ctx is cancelled
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	failed := false
+	for {
+		if err := p.poll(ctx); err != nil {
+			// Log once per outage rather than on every poll
+			if !failed && ctx.Err() == nil {
+				log.Printf("fldigi XML-RPC poll of %s failed: %v", p.cfg.Address, err)
+			}
+			failed = true
+		} else {
+			failed = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the callsign field and checks whether the previous call was
+// logged
+func (p *Poller) poll(ctx context.Context) error {
+	current, err := call(ctx, p.client, p.url, "log.get_call")
+	if err != nil {
+		return err
+	}
+	current = strings.ToUpper(strings.TrimSpace(current))
+	if current == p.call {
+		return nil
+	}
+
+	if p.call != "" {
+		record, err := call(ctx, p.client, p.url, "log.get_record", p.call)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(record) != "" && record != p.baseline && p.cfg.OnQSO != nil {
+			p.cfg.OnQSO(record)
+		}
+	}
+
+	p.call, p.baseline = current, ""
+	if current != "" {
+		if p.baseline, err = call(ctx, p.client, p.url, "log.get_record", current); err != nil {
+			// Ask again on the next poll rather than report an old QSO
+			p.call = ""
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package fldigi
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFldigi answers log.get_call and log.get_record like fldigi
+type fakeFldigi struct {
+	mu      sync.Mutex
+	call    string
+	records map[string]string // Last logbook record by callsign
+}
+
+func (f *fakeFldigi) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var mc methodCall
+	if err := xml.NewDecoder(req.Body).Decode(&mc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result string
+	switch mc.Method {
+	case "log.get_call":
+		result = f.call
+	case "log.get_record":
+		result = f.records[mc.Params[0]]
+	default:
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><fault><value><struct>` +
+			`<member><name>faultCode</name><value><i4>-506</i4></value></member>` +
+			`<member><name>faultString</name><value><string>Unknown method</string></value></member>` +
+			`</struct></value></fault></methodResponse>`))
+		return
+	}
+
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(result))
+	// fldigi sends strings as untyped values
+	w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value>` +
+		escaped.String() + `</value></param></params></methodResponse>`))
+}
+
+func (f *fakeFldigi) set(call string, records map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call = call
+	for k, v := range records {
+		f.records[k] = v
+	}
+}
+
+func TestPoller(t *testing.T) {
+	fake := &fakeFldigi{records: map[string]string{
+		"W1AW": "<CALL:4>W1AW <QSO_DATE:8>20240101 <TIME_ON:4>1200 <MODE:5>PSK31 <EOR>",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var logged []string
+	p, err := NewPoller(Config{
+		Address: strings.TrimPrefix(server.URL, "http://"),
+		OnQSO:   func(record string) { logged = append(logged, record) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	poll := func(call string, records map[string]string) {
+		t.Helper()
+		fake.set(call, records)
+		if err := p.poll(ctx); err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+	}
+
+	// Typed, then cleared without saving
+	poll("k1a", nil)
+	poll("K1ABC", nil)
+	poll("", nil)
+	if len(logged) != 0 {
+		t.Fatalf("nothing was saved, got %q", logged)
+	}
+
+	// Typed and saved
+	poll("K1ABC", nil)
+	saved := "<CALL:5>K1ABC <QSO_DATE:8>20240601 <TIME_ON:4>1500 <MODE:5>PSK31 <EOR>"
+	poll("", map[string]string{"K1ABC": saved})
+	if len(logged) != 1 || logged[0] != saved {
+		t.Fatalf("expected the saved K1ABC record, got %q", logged)
+	}
+
+	// A station worked before: its old record is not reported again, but a
+	// new one is, even when the next call is typed over it
+	poll("W1AW", nil)
+	poll("", nil)
+	poll("W1AW", nil)
+	again := "<CALL:4>W1AW <QSO_DATE:8>20240601 <TIME_ON:4>1510 <MODE:5>PSK31 <EOR>"
+	poll("G4ABC", map[string]string{"W1AW": again})
+	if len(logged) != 2 || logged[1] != again {
+		t.Fatalf("expected the new W1AW record, got %q", logged)
+	}
+}
+
+func TestCallFault(t *testing.T) {
+	server := httptest.NewServer(&fakeFldigi{})
+	defer server.Close()
+
+	_, err := call(context.Background(), server.Client(), server.URL, "log.get_nothing")
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != "-506" || fault.Message != "Unknown method" {
+		t.Errorf("expected an Unknown method fault, got %v", err)
+	}
+}
+
+func TestNewPollerAddress(t *testing.T) {
+	if _, err := NewPoller(Config{Address: "localhost"}); err == nil {
+		t.Error("expected an error for an address without a port")
+	}
+}
@@ -0,0 +1,116 @@
+// Package fldigi reads logged QSOs from fldigi's XML-RPC interface, for
+// stations whose fldigi UDP log broadcasts don't reliably reach the relay.
+package fldigi
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// callTimeout bounds a single XML-RPC request
+const callTimeout = 2 * time.Second
+
+// maxResponseBytes bounds the size of a response that is read
+const maxResponseBytes = 1 << 20
+
+// Fault is an XML-RPC fault returned by fldigi, e.g. for an unknown method
+type Fault struct {
+	Code    string
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("fldigi XML-RPC fault %s: %s", f.Code, f.Message)
+}
+
+// methodCall is an XML-RPC request with string parameters, the only kind
+// the log methods take
+type methodCall struct {
+	XMLName xml.Name `xml:"methodCall"`
+	Method  string   `xml:"methodName"`
+	Params  []string `xml:"params>param>value>string"`
+}
+
+// methodResponse is an XML-RPC response: one value, or a fault
+type methodResponse struct {
+	Params []value `xml:"params>param>value"`
+	Fault  *value  `xml:"fault>value"`
+}
+
+// value is an XML-RPC value. A value without a type element is a string.
+type value struct {
+	Text    string   `xml:",chardata"`
+	String  *string  `xml:"string"`
+	Int     *string  `xml:"int"`
+	I4      *string  `xml:"i4"`
+	Double  *string  `xml:"double"`
+	Members []member `xml:"struct>member"`
+}
+
+type member struct {
+	Name  string `xml:"name"`
+	Value value  `xml:"value"`
+}
+
+// text returns a scalar value as a string
+func (v value) text() string {
+	for _, s := range []*string{v.String, v.Int, v.I4, v.Double} {
+		if s != nil {
+			return *s
+		}
+	}
+	return strings.TrimSpace(v.Text)
+}
+
+// member returns the named member of a struct value
+func (v value) member(name string) string {
+	for _, m := range v.Members {
+		if m.Name == name {
+			return m.Value.text()
+		}
+	}
+	return ""
+}
+
+// call invokes an XML-RPC method at url and returns its result as a string
+func call(ctx context.Context, client *http.Client, url, method string, params ...string) (string, error) {
+	body, err := xml.Marshal(methodCall{Method: method, Params: params})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(append([]byte(xml.Header), body...)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: fldigi returned %s", method, resp.Status)
+	}
+
+	var result methodResponse
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&result); err != nil {
+		return "", fmt.Errorf("%s: invalid XML-RPC response: %w", method, err)
+	}
+	if result.Fault != nil {
+		return "", &Fault{Code: result.Fault.member("faultCode"), Message: result.Fault.member("faultString")}
+	}
+	if len(result.Params) == 0 {
+		return "", nil
+	}
+	return result.Params[0].text(), nil
+}
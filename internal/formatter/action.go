@@ -0,0 +1,102 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Action is what a message asks the loggers to do with a QSO
+type Action string
+
+const (
+	ActionLog     Action = ""        // Log a new QSO
+	ActionReplace Action = "replace" // Replace the QSO with the same ID
+	ActionDelete  Action = "delete"  // Delete the QSO with the same ID
+	ActionSpot    Action = "spot"    // Announce a station heard on the air; nothing is logged
+)
+
+// n1mmContactReplace is N1MM's contactreplace message: a contactinfo under
+// another name, matched to the logged contact by ID
+type n1mmContactReplace struct {
+	XMLName xml.Name `xml:"contactreplace"`
+	N1MMContactInfo
+}
+
+// n1mmContactDelete is N1MM's contactdelete message
+type n1mmContactDelete struct {
+	XMLName     xml.Name `xml:"contactdelete"`
+	App         string   `xml:"app"`
+	Timestamp   string   `xml:"timestamp"`
+	Call        string   `xml:"call"`
+	ContestNr   string   `xml:"contestnr"`
+	StationName string   `xml:"StationName"`
+	ID          string   `xml:"ID"`
+}
+
+// n1mmSpot is the spot message N1MM broadcasts for its band map. The
+// frequency is in kHz.
+type n1mmSpot struct {
+	XMLName     xml.Name `xml:"spot"`
+	App         string   `xml:"app"`
+	StationName string   `xml:"StationName"`
+	DXCall      string   `xml:"dxcall"`
+	Frequency   string   `xml:"frequency"`
+	SpotterCall string   `xml:"spottercall"`
+	Comment     string   `xml:"comment"`
+	Action      string   `xml:"action"`
+	Mode        string   `xml:"mode"`
+	Status      string   `xml:"status"`
+	Timestamp   string   `xml:"timestamp"`
+}
+
+// n1mmAction returns the action of an N1MM message from its root element
+func n1mmAction(message string) Action {
+	switch {
+	case strings.Contains(message, "<contactreplace"):
+		return ActionReplace
+	case strings.Contains(message, "<contactdelete"):
+		return ActionDelete
+	}
+	return ActionLog
+}
+
+// formatN1MMReplace converts a corrected QSO to a contactreplace message.
+// The ID is always sent since N1MM can't match the contact without it.
+func (f *Formatter) formatN1MMReplace(qso *QSO) (string, error) {
+	contact := f.n1mmContact(qso)
+	contact.ID = qso.ID
+	return f.marshalXML(n1mmContactReplace{N1MMContactInfo: contact})
+}
+
+// formatN1MMDelete converts a deleted QSO to a contactdelete message
+func (f *Formatter) formatN1MMDelete(qso *QSO) (string, error) {
+	station, _, _ := f.identity(qso)
+	stationName, _, _ := f.network(qso, station)
+	return f.marshalXML(n1mmContactDelete{
+		App:         f.appName(),
+		Timestamp:   f.outputTime(qso).Format("2006-01-02 15:04:05"),
+		Call:        qso.Callsign,
+		ContestNr:   "0",
+		StationName: stationName,
+		ID:          qso.ID,
+	})
+}
+
+// formatN1MMSpot converts a spot to N1MM's spot message, spotted by the
+// station callsign
+func (f *Formatter) formatN1MMSpot(qso *QSO) (string, error) {
+	station, _, _ := f.identity(qso)
+	stationName, _, _ := f.network(qso, station)
+	return f.marshalXML(n1mmSpot{
+		App:         f.appName(),
+		StationName: stationName,
+		DXCall:      qso.Callsign,
+		Frequency:   fmt.Sprintf("%.1f", float64(qso.Hz())/1000),
+		SpotterCall: station,
+		Comment:     qso.Comment,
+		Action:      "add",
+		Mode:        qso.Mode,
+		Timestamp:   f.outputTime(qso).Format("2006-01-02 15:04:05"),
+	})
+}
@@ -0,0 +1,399 @@
+package formatter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adifType is an ADIF 3.1.4 data type, as far as the checks need it
+type adifType int
+
+const (
+	adifString  adifType = iota // Any text
+	adifNumber                  // Decimal number, e.g. 14.074
+	adifInteger                 // Non-negative whole number
+	adifDate                    // YYYYMMDD
+	adifTime                    // HHMM or HHMMSS
+	adifEnum                    // One of a fixed list
+	adifGrid                    // Maidenhead locator of 2, 4, 6 or 8 characters
+)
+
+// adifField describes one field of the ADIF 3.1.4 QSO record
+type adifField struct {
+	kind     adifType
+	min, max int             // Range of an integer field; zero max means unbounded
+	values   map[string]bool // Allowed values of an enumeration, upper case
+}
+
+// adifModes maps each ADIF 3.1.4 mode to its submodes. Loggers and the
+// programs feeding the relay usually name the submode (USB, FT4, JS8), which
+// ADIF records as MODE plus SUBMODE.
+var adifModes = map[string][]string{
+	"AM":           nil,
+	"ARDOP":        nil,
+	"ATV":          nil,
+	"CHIP":         {"CHIP64", "CHIP128"},
+	"CLO":          nil,
+	"CONTESTI":     nil,
+	"CW":           {"PCW"},
+	"DIGITALVOICE": {"C4FM", "DMR", "DSTAR", "FREEDV", "M17"},
+	"DOMINO":       {"DOM-M", "DOM4", "DOM5", "DOM8", "DOM11", "DOM16", "DOM22", "DOM44", "DOM88", "DOMINOEX", "DOMINOF"},
+	"DYNAMIC":      {"VARA HF", "VARA SATELLITE", "VARA FM 1200", "VARA FM 9600"},
+	"FAX":          nil,
+	"FM":           nil,
+	"FSK441":       nil,
+	"FT8":          nil,
+	"HELL":         {"FMHELL", "FSKHELL", "HELL80", "HELLX5", "HELLX9", "HFSK", "PSKHELL", "SLOWHELL"},
+	"ISCAT":        {"ISCAT-A", "ISCAT-B"},
+	"JT4":          {"JT4A", "JT4B", "JT4C", "JT4D", "JT4E", "JT4F", "JT4G"},
+	"JT6M":         nil,
+	"JT9":          {"JT9-1", "JT9-2", "JT9-5", "JT9-10", "JT9-30", "JT9A", "JT9B", "JT9C", "JT9D", "JT9E", "JT9E FAST", "JT9F", "JT9F FAST", "JT9G", "JT9G FAST", "JT9H", "JT9H FAST"},
+	"JT44":         nil,
+	"JT65":         {"JT65A", "JT65B", "JT65B2", "JT65C", "JT65C2"},
+	"MFSK":         {"FSQCALL", "FST4", "FST4W", "FT4", "JS8", "JTMS", "MFSK4", "MFSK8", "MFSK11", "MFSK16", "MFSK22", "MFSK31", "MFSK32", "MFSK64", "MFSK64L", "MFSK128", "MFSK128L", "Q65"},
+	"MSK144":       nil,
+	"MT63":         nil,
+	"OLIVIA":       {"OLIVIA 4/125", "OLIVIA 4/250", "OLIVIA 8/250", "OLIVIA 8/500", "OLIVIA 16/500", "OLIVIA 16/1000", "OLIVIA 32/1000"},
+	"OPERA":        {"OPERA-BEACON", "OPERA-QSO"},
+	"PAC":          {"PAC2", "PAC3", "PAC4"},
+	"PAX":          {"PAX2"},
+	"PKT":          nil,
+	"PSK":          {"8PSK125", "8PSK125F", "8PSK125FL", "8PSK250", "8PSK250F", "8PSK250FL", "8PSK500", "8PSK500F", "8PSK1000", "8PSK1000F", "8PSK1200F", "FSK31", "PSK10", "PSK31", "PSK63", "PSK63F", "PSK63RC4", "PSK63RC5", "PSK63RC10", "PSK63RC20", "PSK63RC32", "PSK125", "PSK125C12", "PSK125R", "PSK125RC10", "PSK125RC12", "PSK125RC16", "PSK125RC4", "PSK125RC5", "PSK250", "PSK250C6", "PSK250R", "PSK250RC2", "PSK250RC3", "PSK250RC5", "PSK250RC6", "PSK250RC7", "PSK500", "PSK500C2", "PSK500C4", "PSK500R", "PSK500RC2", "PSK500RC3", "PSK500RC4", "PSK800C2", "PSK800RC2", "PSK1000", "PSK1000C2", "PSK1000R", "PSK1000RC2", "PSKAM10", "PSKAM31", "PSKAM50", "PSKFEC31", "QPSK31", "QPSK63", "QPSK125", "QPSK250", "QPSK500", "SIM31"},
+	"PSK2K":        nil,
+	"Q15":          nil,
+	"QRA64":        {"QRA64A", "QRA64B", "QRA64C", "QRA64D", "QRA64E"},
+	"ROS":          {"ROS-EME", "ROS-HF", "ROS-MF"},
+	"RTTY":         {"ASCI"},
+	"RTTYM":        nil,
+	"SSB":          {"LSB", "USB"},
+	"SSTV":         nil,
+	"T10":          nil,
+	"THOR":         {"THOR-M", "THOR4", "THOR5", "THOR8", "THOR11", "THOR16", "THOR22", "THOR25X4", "THOR50X1", "THOR50X2", "THOR100"},
+	"THRB":         {"THRBX", "THRBX1", "THRBX2", "THRBX4", "THROB1", "THROB2", "THROB4"},
+	"TOR":          {"AMTORFEC", "GTOR", "NAVTEX", "SITORB"},
+	"V4":           nil,
+	"VOI":          nil,
+	"WINMOR":       nil,
+	"WSPR":         nil,
+}
+
+// adifSubmodes maps each submode to its mode, built from adifModes
+var adifSubmodes = func() map[string]string {
+	m := make(map[string]string)
+	for mode, submodes := range adifModes {
+		for _, s := range submodes {
+			m[s] = mode
+		}
+	}
+	return m
+}()
+
+// adifBand is an ADIF 3.1.4 band and its edges in Hz
+type adifBand struct {
+	name     string
+	low, top int64
+}
+
+var adifBands = []adifBand{
+	{"2190m", 135700, 137800}, {"630m", 472000, 479000}, {"560m", 501000, 504000},
+	{"160m", 1800000, 2000000}, {"80m", 3500000, 4000000}, {"60m", 5060000, 5450000},
+	{"40m", 7000000, 7300000}, {"30m", 10100000, 10150000}, {"20m", 14000000, 14350000},
+	{"17m", 18068000, 18168000}, {"15m", 21000000, 21450000}, {"12m", 24890000, 24990000},
+	{"10m", 28000000, 29700000}, {"8m", 40000000, 45000000}, {"6m", 50000000, 54000000},
+	{"5m", 54000001, 69900000}, {"4m", 70000000, 71000000}, {"2m", 144000000, 148000000},
+	{"1.25m", 222000000, 225000000}, {"70cm", 420000000, 450000000}, {"33cm", 902000000, 928000000},
+	{"23cm", 1240000000, 1300000000}, {"13cm", 2300000000, 2450000000}, {"9cm", 3300000000, 3500000000},
+	{"6cm", 5650000000, 5925000000}, {"3cm", 10000000000, 10500000000}, {"1.25cm", 24000000000, 24250000000},
+	{"6mm", 47000000000, 47200000000}, {"4mm", 75500000000, 81000000000}, {"2.5mm", 119980000000, 123000000000},
+	{"2mm", 134000000000, 149000000000}, {"1mm", 241000000000, 250000000000}, {"submm", 300000000000, 7500000000000},
+}
+
+// adifBandForHz returns the ADIF band containing a frequency, or ""
+func adifBandForHz(hz int64) string {
+	for _, b := range adifBands {
+		if hz >= b.low && hz <= b.top {
+			return b.name
+		}
+	}
+	return ""
+}
+
+// enumOf builds an enumeration's value set
+func enumOf(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[strings.ToUpper(v)] = true
+	}
+	return m
+}
+
+// adifDictionary lists the ADIF 3.1.4 QSO fields the relay writes or
+// commonly passes on. Application-defined APP_ fields are always allowed.
+var adifDictionary = func() map[string]adifField {
+	bands := make([]string, len(adifBands))
+	for i, b := range adifBands {
+		bands[i] = b.name
+	}
+	modes := make([]string, 0, len(adifModes))
+	for m := range adifModes {
+		modes = append(modes, m)
+	}
+	submodes := make([]string, 0, len(adifSubmodes))
+	for s := range adifSubmodes {
+		submodes = append(submodes, s)
+	}
+	str := adifField{kind: adifString}
+
+	return map[string]adifField{
+		"ADDRESS":          str,
+		"AGE":              {kind: adifInteger, max: 120},
+		"ARRL_SECT":        str,
+		"BAND":             {kind: adifEnum, values: enumOf(bands...)},
+		"BAND_RX":          {kind: adifEnum, values: enumOf(bands...)},
+		"CALL":             str,
+		"CHECK":            str,
+		"CLASS":            str,
+		"CNTY":             str,
+		"COMMENT":          str,
+		"CONT":             {kind: adifEnum, values: enumOf("NA", "SA", "EU", "AF", "OC", "AS", "AN")},
+		"CONTEST_ID":       str,
+		"COUNTRY":          str,
+		"CQZ":              {kind: adifInteger, min: 1, max: 40},
+		"DXCC":             {kind: adifInteger, max: 999},
+		"EMAIL":            str,
+		"FREQ":             {kind: adifNumber},
+		"FREQ_RX":          {kind: adifNumber},
+		"GRIDSQUARE":       {kind: adifGrid},
+		"ITUZ":             {kind: adifInteger, min: 1, max: 90},
+		"MODE":             {kind: adifEnum, values: enumOf(modes...)},
+		"MY_GRIDSQUARE":    {kind: adifGrid},
+		"NAME":             str,
+		"NOTES":            str,
+		"OPERATOR":         str,
+		"PFX":              str,
+		"PRECEDENCE":       str,
+		"PROGRAMID":        str,
+		"PROGRAMVERSION":   str,
+		"QSO_DATE":         {kind: adifDate},
+		"QSO_DATE_OFF":     {kind: adifDate},
+		"QTH":              str,
+		"RST_RCVD":         str,
+		"RST_SENT":         str,
+		"RX_PWR":           {kind: adifNumber},
+		"SKCC":             str,
+		"SRX":              {kind: adifInteger},
+		"SRX_STRING":       str,
+		"STATE":            str,
+		"STATION_CALLSIGN": str,
+		"STX":              {kind: adifInteger},
+		"STX_STRING":       str,
+		"SUBMODE":          {kind: adifEnum, values: enumOf(submodes...)},
+		"TIME_OFF":         {kind: adifTime},
+		"TIME_ON":          {kind: adifTime},
+		"TX_PWR":           {kind: adifNumber},
+		"VE_PROV":          str,
+	}
+}()
+
+// ADIFProblem is one way an ADIF record breaks the specification
+type ADIFProblem struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+func (p ADIFProblem) String() string {
+	return fmt.Sprintf("%s %q %s", p.Field, p.Value, p.Reason)
+}
+
+// ADIFError is returned for ADIF output that fails validation
+type ADIFError struct {
+	Record   string
+	Problems []ADIFProblem
+}
+
+func (e *ADIFError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.String()
+	}
+	return "invalid ADIF: " + strings.Join(parts, "; ")
+}
+
+// ValidateADIF checks one ADIF record against the ADIF 3.1.4 field
+// dictionary: that each length matches its data, that the field is known,
+// and that the value suits the field's type and enumeration. It returns nil
+// for a valid record.
+func ValidateADIF(record string) []ADIFProblem {
+	var problems []ADIFProblem
+	fields := make(map[string]string)
+
+	rest := record
+	for {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '>')
+		if end < 0 {
+			problems = append(problems, ADIFProblem{Field: "record", Value: rest[start:], Reason: "has an unterminated tag"})
+			break
+		}
+		tag := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+		if strings.EqualFold(tag, "EOR") {
+			break
+		}
+
+		parts := strings.Split(tag, ":")
+		name := strings.ToUpper(parts[0])
+		length := -1
+		if len(parts) >= 2 {
+			if n, err := strconv.Atoi(parts[1]); err == nil && n >= 0 {
+				length = n
+			}
+		}
+		if length < 0 {
+			problems = append(problems, ADIFProblem{Field: name, Value: "<" + tag + ">", Reason: "has no valid length"})
+			continue
+		}
+		if length > len(rest) {
+			problems = append(problems, ADIFProblem{Field: name, Value: rest, Reason: fmt.Sprintf("is shorter than its length %d", length)})
+			break
+		}
+		value := rest[:length]
+		rest = rest[length:]
+		fields[name] = value
+
+		if p, ok := checkADIFField(name, value); !ok {
+			problems = append(problems, p)
+		}
+	}
+
+	if _, ok := fields["CALL"]; !ok {
+		problems = append(problems, ADIFProblem{Field: "CALL", Reason: "is missing"})
+	}
+	if sub, ok := fields["SUBMODE"]; ok {
+		if mode := adifSubmodes[strings.ToUpper(sub)]; mode != "" && !strings.EqualFold(fields["MODE"], mode) {
+			problems = append(problems, ADIFProblem{Field: "SUBMODE", Value: sub, Reason: "needs MODE " + mode})
+		}
+	}
+	if band, ok := fields["BAND"]; ok {
+		if hz, err := ParseMHz(fields["FREQ"]); err == nil && hz > 0 {
+			if in := adifBandForHz(hz); in != "" && !strings.EqualFold(in, band) {
+				problems = append(problems, ADIFProblem{Field: "BAND", Value: band, Reason: "does not match FREQ " + fields["FREQ"]})
+			}
+		}
+	}
+	return problems
+}
+
+// checkADIFField checks a value against the dictionary entry for its field
+func checkADIFField(name, value string) (ADIFProblem, bool) {
+	bad := func(reason string) (ADIFProblem, bool) {
+		return ADIFProblem{Field: name, Value: value, Reason: reason}, false
+	}
+	if strings.HasPrefix(name, "APP_") || strings.HasPrefix(name, "USERDEF") {
+		return ADIFProblem{}, true
+	}
+	field, ok := adifDictionary[name]
+	if !ok {
+		return bad("is not an ADIF 3.1.4 field")
+	}
+
+	switch field.kind {
+	case adifNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return bad("is not a number")
+		}
+	case adifInteger:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < field.min || (field.max > 0 && n > field.max) {
+			if field.max > 0 {
+				return bad(fmt.Sprintf("is not a whole number from %d to %d", field.min, field.max))
+			}
+			return bad("is not a whole number")
+		}
+	case adifDate:
+		if _, err := time.Parse("20060102", value); err != nil || len(value) != 8 {
+			return bad("is not a YYYYMMDD date")
+		}
+	case adifTime:
+		layout := "150405"
+		if len(value) == 4 {
+			layout = "1504"
+		}
+		if _, err := time.Parse(layout, value); err != nil || (len(value) != 4 && len(value) != 6) {
+			return bad("is not an HHMM or HHMMSS time")
+		}
+	case adifEnum:
+		upper := strings.ToUpper(value)
+		if field.values[upper] {
+			break
+		}
+		if mode := adifSubmodes[upper]; name == "MODE" && mode != "" {
+			return bad("is a submode; use MODE " + mode + " with SUBMODE " + value)
+		}
+		return bad("is not a valid " + name)
+	case adifGrid:
+		if !validGrid(value) {
+			return bad("is not a 2, 4, 6 or 8 character locator")
+		}
+	}
+	return ADIFProblem{}, true
+}
+
+// validGrid reports whether s is a Maidenhead locator of 2 to 8 characters
+func validGrid(s string) bool {
+	if len(s)%2 != 0 || len(s) < 2 || len(s) > 8 {
+		return false
+	}
+	s = strings.ToUpper(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 0, 1:
+			if c < 'A' || c > 'R' {
+				return false
+			}
+		case 2, 3, 6, 7:
+			if c < '0' || c > '9' {
+				return false
+			}
+		case 4, 5:
+			if c < 'A' || c > 'X' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// adifMode returns the ADIF MODE and SUBMODE for a QSO's mode, which may
+// name either
+func adifMode(mode string) (string, string) {
+	upper := strings.ToUpper(mode)
+	if parent := adifSubmodes[upper]; parent != "" {
+		if _, isMode := adifModes[upper]; !isMode {
+			return parent, upper
+		}
+	}
+	return mode, ""
+}
+
+// adifBandOf returns the QSO's band as ADIF names it, deriving it from the
+// frequency when the source used another form (N1MM sends "14")
+func adifBandOf(qso *QSO) string {
+	band := strings.ToLower(qso.Band)
+	for _, b := range adifBands {
+		if b.name == band {
+			return band
+		}
+	}
+	if in := adifBandForHz(qso.Hz()); in != "" {
+		return in
+	}
+	return qso.Band
+}
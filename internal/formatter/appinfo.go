@@ -0,0 +1,31 @@
+package formatter
+
+import (
+	"encoding/xml"
+)
+
+// N1MMAppInfo is the AppInfo message N1MM Logger Plus broadcasts when it
+// starts or opens a contest. The relay sends one as its heartbeat.
+type N1MMAppInfo struct {
+	XMLName     xml.Name `xml:"AppInfo"`
+	App         string   `xml:"app"`
+	DBName      string   `xml:"dbname"`
+	ContestNr   int      `xml:"contestnr"`
+	ContestName string   `xml:"contestname"`
+	StationName string   `xml:"StationName"`
+	RadioNr     int      `xml:"RadioNr"`
+}
+
+// FormatAppInfo builds an N1MM AppInfo message identifying the relay and the
+// configured station and contest
+func (f *Formatter) FormatAppInfo() (string, error) {
+	stationName, _, radioNr := f.network(&QSO{}, f.station)
+	info := N1MMAppInfo{
+		App:         f.appName(),
+		ContestName: f.contest,
+		StationName: stationName,
+		RadioNr:     radioNr,
+	}
+
+	return f.marshalXML(info)
+}
@@ -0,0 +1,144 @@
+package formatter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// baseCallRegex matches the core of an amateur callsign: a prefix of one to
+// three characters containing at least one letter, a call area digit block,
+// and a one to four letter suffix (W1AW, 2E0ABC, 3D2CR, VK100ABC)
+var baseCallRegex = regexp.MustCompile(`^([A-Z]{1,2}|[0-9][A-Z]{1,2}|[A-Z][0-9][A-Z]?)[0-9]{1,4}[A-Z]{1,4}$`)
+
+// strokePrefixRegex matches a country/area prefix used with a stroke (DL/, VP2E/, /VE3)
+var strokePrefixRegex = regexp.MustCompile(`^([A-Z]{1,2}|[0-9][A-Z]{1,2}|[A-Z][0-9][A-Z]?)[0-9]{0,2}[A-Z]?$`)
+
+// gridRegex matches 4 and 6 character Maidenhead locators that otherwise look like callsigns
+var gridRegex = regexp.MustCompile(`^[A-R]{2}[0-9]{2}([A-X]{2})?$`)
+
+// portableDesignators are suffixes accepted after a stroke
+var portableDesignators = map[string]bool{
+	"P": true, "M": true, "MM": true, "AM": true, "A": true,
+	"QRP": true, "R": true, "LH": true, "B": true,
+}
+
+// SanitizeCallsign trims whitespace and stray delimiters and upper-cases a callsign
+func SanitizeCallsign(call string) string {
+	call = strings.TrimSpace(call)
+	call = strings.Trim(call, "<>\"'")
+	return strings.ToUpper(strings.Join(strings.Fields(call), ""))
+}
+
+// ValidCallsign reports whether call looks like a real amateur callsign,
+// allowing stroke prefixes (DL/W1ABC), portable designators (/P, /MM, /QRP)
+// and call area suffixes (W1ABC/4)
+func ValidCallsign(call string) bool {
+	call = SanitizeCallsign(call)
+	parts := strings.Split(call, "/")
+	if len(parts) > 3 {
+		return false
+	}
+
+	// The base call is the longest part that looks like a full callsign, so
+	// short stroke prefixes such as VP2E in VP2E/K1ABC aren't mistaken for it
+	base := -1
+	for i, part := range parts {
+		if validBaseCall(part) && (base < 0 || len(part) > len(parts[base])) {
+			base = i
+		}
+	}
+	if base < 0 {
+		return false
+	}
+
+	for i, part := range parts {
+		switch {
+		case i == base:
+		case portableDesignators[part]:
+		case len(part) == 1 && part[0] >= '0' && part[0] <= '9':
+		case strokePrefixRegex.MatchString(part) && validPrefixStart(part):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// validBaseCall checks a callsign without stroke designators
+func validBaseCall(call string) bool {
+	if !baseCallRegex.MatchString(call) || gridRegex.MatchString(call) {
+		return false
+	}
+	return validPrefixStart(call)
+}
+
+// ituSeries lists the callsign series the ITU allocates (Radio Regulations
+// Appendix 42) by their first two characters, merged into ranges where
+// neighbouring series are all allocated. A letter on its own covers every
+// series starting with it. 1A (SMOM), 1S (Spratly Is.), S0 (Western Sahara)
+// and Z6 (Kosovo) aren't ITU allocations but are DXCC entities and on the air.
+var ituSeries = []string{
+	"B", "F", "G", "I", "K", "M", "N", "R", "W",
+	"AA-AZ", "A2-A9",
+	"CA-CZ", "C2-C9",
+	"DA-DZ", "D2-D9",
+	"EA-EZ", "E2-E7",
+	"HA-HZ", "H2-H4", "H6-H9",
+	"JA-JZ", "J2-J8",
+	"LA-LZ", "L2-L9",
+	"OA-OZ",
+	"PA-PZ", "P2-P9",
+	"SA-SZ", "S0", "S2-S3", "S5-S9",
+	"TA-TZ", "T2-T8",
+	"UA-UZ",
+	"VA-VZ", "V2-V8",
+	"XA-XZ",
+	"YA-YZ", "Y2-Y9",
+	"ZA-ZZ", "Z2-Z3", "Z6", "Z8",
+	"1A", "1S",
+	"2A-2Z", "3A-3Z", "4A-4Z", "5A-5Z", "6A-6Z", "7A-7Z", "8A-8Z", "9A-9Z",
+}
+
+// ituPrefixes holds every allocated two character prefix from ituSeries
+var ituPrefixes = expandSeries(ituSeries)
+
+// expandSeries turns series ranges into a set of two character prefixes
+func expandSeries(series []string) map[string]bool {
+	prefixes := make(map[string]bool)
+	for _, s := range series {
+		from, to, ok := strings.Cut(s, "-")
+		if !ok {
+			to = from
+		}
+		if len(from) == 1 {
+			from, to = from+"0", from+"Z"
+		}
+		for c := from[1]; c <= to[1]; c++ {
+			if c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' {
+				prefixes[string([]byte{from[0], c})] = true
+			}
+		}
+	}
+	return prefixes
+}
+
+// validPrefixStart reports whether a callsign or stroke prefix starts with
+// an allocated ITU series. A single letter prefix (W/, F/) is only valid for
+// a country holding the whole letter, the only series that include 0 and 1.
+func validPrefixStart(call string) bool {
+	if len(call) < 2 {
+		return len(call) == 1 && ituPrefixes[call+"0"] && ituPrefixes[call+"1"]
+	}
+	return ituPrefixes[call[:2]]
+}
+
+// findCallsign returns the first valid callsign among candidate regex matches
+func findCallsign(re *regexp.Regexp, text string) string {
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		if len(match) > 1 && ValidCallsign(match[1]) {
+			return match[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package formatter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// relayMarker starts every QSO one relay forwards to another
+const relayMarker = `{"n7akg_relay":`
+
+// Versions of the relay-to-relay envelope:
+//
+//	1  {"n7akg_relay":1,"qso":{...}}
+//	2  adds "compat", the oldest version that can read the envelope, and
+//	   "sender", the node ID and software version of the relay that sent it
+//
+// Readers ignore fields they don't know, so a relay reads any envelope whose
+// compat version it speaks, also from newer relays. Relays connected over TCP
+// exchange hello lines first, and the sender downgrades envelopes to the
+// newest version both speak.
+const (
+	RelayVersion    = 2 // Newest envelope version this relay writes and reads
+	RelayMinVersion = 1 // Oldest envelope version this relay reads
+)
+
+// relayHelloMarker starts the hello line relays exchange on a TCP connection.
+// Relays from before version 2 ignore it as a line that is not a QSO.
+const relayHelloMarker = `{"n7akg_relay_hello":`
+
+// ErrRelayLoop is returned for QSOs that have already passed through this relay
+var ErrRelayLoop = errors.New("relay loop")
+
+// Other formats carry the relay path in a loop marker: an X-Relay comment in
+// N1MM XML and an application-defined field in ADIF. The marker lists node
+// IDs oldest first, separated by commas.
+const adifLoopField = "APP_N7AKG_RELAY"
+
+var (
+	xmlLoopRegex  = regexp.MustCompile(`<!--\s*X-Relay:\s*(.*?)\s*-->`)
+	adifLoopRegex = regexp.MustCompile(`(?i)<` + adifLoopField + `:(\d+)(?::[a-z])?>`)
+)
+
+// relayEnvelope carries an already normalized QSO between relays. The QSO's
+// path lists the node IDs of the relays it has passed through, oldest first,
+// so a relay can drop QSOs that have come back to it.
+type relayEnvelope struct {
+	Version int          `json:"n7akg_relay"`
+	Compat  int          `json:"compat,omitempty"` // Version 2 on
+	Sender  *RelaySender `json:"sender,omitempty"` // Version 2 on
+	QSO     *QSO         `json:"qso"`
+}
+
+// RelaySender identifies the relay that sent an envelope or hello
+type RelaySender struct {
+	Node     string `json:"node"`
+	Software string `json:"software,omitempty"`
+}
+
+// RelayHello is what relays tell each other when a TCP chain connection
+// opens: the envelope versions they read and who they are
+type RelayHello struct {
+	Version    int `json:"version"`
+	MinVersion int `json:"min_version"`
+	RelaySender
+}
+
+// IsRelayEnvelope reports whether a message is a QSO forwarded by another relay
+func IsRelayEnvelope(message string) bool {
+	return strings.HasPrefix(strings.TrimSpace(message), relayMarker)
+}
+
+// FormatRelay wraps a QSO for another relay, adding this relay's node ID to
+// its path. The envelope has the version set in the options, by default
+// RelayVersion.
+func (f *Formatter) FormatRelay(qso *QSO) (string, error) {
+	if qso.Callsign == "" {
+		return "", fmt.Errorf("cannot format QSO without callsign")
+	}
+
+	chained := *qso
+	chained.Path = append(append([]string(nil), qso.Path...), f.opts.NodeID)
+
+	envelope := relayEnvelope{Version: f.relayVersion(), QSO: &chained}
+	if envelope.Version >= 2 {
+		envelope.Compat = RelayMinVersion
+		envelope.Sender = &RelaySender{Node: f.opts.NodeID, Software: f.opts.App.Version}
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal relay QSO: %w", err)
+	}
+	return string(data), nil
+}
+
+// relayVersion is the envelope version FormatRelay writes
+func (f *Formatter) relayVersion() int {
+	if f.opts.RelayVersion > 0 {
+		return f.opts.RelayVersion
+	}
+	return RelayVersion
+}
+
+// DowngradeRelay rewrites a relay envelope for a relay that reads at most
+// version. Envelopes it already reads are returned unchanged.
+func DowngradeRelay(message string, version int) (string, error) {
+	var envelope struct {
+		Version int             `json:"n7akg_relay"`
+		QSO     json.RawMessage `json:"qso"`
+	}
+	if err := json.Unmarshal([]byte(message), &envelope); err != nil {
+		return "", fmt.Errorf("invalid relay QSO: %w", err)
+	}
+	if envelope.Version <= version {
+		return message, nil
+	}
+	if version < RelayMinVersion {
+		return "", fmt.Errorf("unsupported relay QSO version %d", version)
+	}
+
+	// Version 1 is the only older one: the QSO without compat and sender
+	data, err := json.Marshal(struct {
+		Version int             `json:"n7akg_relay"`
+		QSO     json.RawMessage `json:"qso"`
+	}{version, envelope.QSO})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal relay QSO: %w", err)
+	}
+	return string(data), nil
+}
+
+// parseRelay decodes a QSO forwarded by another relay. QSOs that have
+// already passed through this relay, or through more than MaxHops relays,
+// are rejected to break forwarding loops.
+func (f *Formatter) parseRelay(message string) (*QSO, error) {
+	qso := newQSO()
+	envelope := relayEnvelope{QSO: qso}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(message)), &envelope); err != nil {
+		return nil, fmt.Errorf("invalid relay QSO: %w", err)
+	}
+	if err := checkRelayVersion(envelope.Version, envelope.Compat); err != nil {
+		return nil, err
+	}
+	if qso.Callsign == "" {
+		return nil, fmt.Errorf("relay QSO has no callsign")
+	}
+
+	if err := f.checkPath(qso); err != nil {
+		return nil, err
+	}
+	return qso, nil
+}
+
+// checkRelayVersion reports whether this relay reads an envelope of version,
+// which older relays can read from compat on (0 if unset)
+func checkRelayVersion(version, compat int) error {
+	if compat == 0 {
+		compat = version
+	}
+	if version < RelayMinVersion || compat > RelayVersion {
+		return fmt.Errorf("unsupported relay QSO version %d (this relay reads %d to %d)", version, RelayMinVersion, RelayVersion)
+	}
+	return nil
+}
+
+// relayHelloLine is the JSON of a hello line
+type relayHelloLine struct {
+	Hello *RelayHello `json:"n7akg_relay_hello"`
+}
+
+// HelloLine returns this relay's hello line
+func (f *Formatter) HelloLine() string {
+	data, _ := json.Marshal(relayHelloLine{Hello: &RelayHello{
+		Version:     f.relayVersion(),
+		MinVersion:  RelayMinVersion,
+		RelaySender: RelaySender{Node: f.opts.NodeID, Software: f.opts.App.Version},
+	}})
+	return string(data)
+}
+
+// IsRelayHello reports whether a line is another relay's hello
+func IsRelayHello(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), relayHelloMarker)
+}
+
+// ParseRelayHello decodes another relay's hello line
+func ParseRelayHello(line string) (RelayHello, error) {
+	var hello relayHelloLine
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &hello); err != nil {
+		return RelayHello{}, fmt.Errorf("invalid relay hello: %w", err)
+	}
+	if hello.Hello == nil || hello.Hello.Version < 1 {
+		return RelayHello{}, fmt.Errorf("invalid relay hello: no version")
+	}
+	h := *hello.Hello
+	if h.MinVersion == 0 {
+		h.MinVersion = h.Version
+	}
+	return h, nil
+}
+
+// NegotiateRelayVersion returns the newest envelope version this relay,
+// which writes up to version, and a peer both speak
+func NegotiateRelayVersion(version int, peer RelayHello) (int, error) {
+	v := min(version, peer.Version)
+	if v < max(RelayMinVersion, peer.MinVersion) {
+		return 0, fmt.Errorf("no common relay protocol version (this relay %d-%d, %s %d-%d)",
+			RelayMinVersion, version, peer.Node, peer.MinVersion, peer.Version)
+	}
+	return v, nil
+}
+
+// checkPath rejects a QSO whose path already contains this relay, or that
+// has passed through MaxHops relays
+func (f *Formatter) checkPath(qso *QSO) error {
+	for _, node := range qso.Path {
+		if node == f.opts.NodeID {
+			return fmt.Errorf("%w: QSO with %s already passed through %s (path %s)",
+				ErrRelayLoop, qso.Callsign, node, strings.Join(qso.Path, " > "))
+		}
+	}
+	if f.opts.MaxHops > 0 && len(qso.Path) >= f.opts.MaxHops {
+		return fmt.Errorf("relay QSO with %s exceeded %d hops (path %s)",
+			qso.Callsign, f.opts.MaxHops, strings.Join(qso.Path, " > "))
+	}
+	return nil
+}
+
+// markedPath returns the relay path from a message's loop marker, or nil if
+// it has none
+func markedPath(message string) []string {
+	// Every message is checked, so skip the regexes for the vast majority
+	// that carry no marker
+	xmlMarker := strings.Contains(message, "X-Relay")
+	if !xmlMarker && !strings.Contains(message, "N7AKG_RELAY") && !strings.Contains(message, "n7akg_relay") {
+		return nil
+	}
+
+	var marker string
+	if xmlMarker {
+		if m := xmlLoopRegex.FindStringSubmatch(message); m != nil {
+			marker = m[1]
+		}
+	} else if loc := adifLoopRegex.FindStringSubmatchIndex(message); loc != nil {
+		n, _ := strconv.Atoi(message[loc[2]:loc[3]])
+		marker = message[loc[1]:min(loc[1]+n, len(message))]
+	}
+	if marker == "" {
+		return nil
+	}
+	return strings.Split(marker, ",")
+}
+
+// markOutput adds the loop marker to a QSO formatted for another logger, so
+// a relay that receives it back can tell. The marker goes inside the root
+// element of XML, where batching and splitting keep it, and before the EOR
+// of ADIF. Win-Test messages have no room for one.
+func (f *Formatter) markOutput(message string, qso *QSO, format OutputFormat) string {
+	if f.opts.NodeID == "" {
+		return message
+	}
+	path := strings.Join(append(append([]string(nil), qso.Path...), f.opts.NodeID), ",")
+
+	switch format {
+	case OutputFormatN1MM, "":
+		i := strings.LastIndex(message, "</")
+		if i < 0 {
+			return message
+		}
+		comment := "<!-- X-Relay: " + path + " -->"
+		if f.opts.XML.Indent {
+			comment = "  " + comment + "\n"
+		}
+		return message[:i] + comment + message[i:]
+	case OutputFormatDXLog, OutputFormatADIF:
+		i := strings.LastIndex(strings.ToUpper(message), "<EOR>")
+		if i < 0 {
+			return message
+		}
+		var b strings.Builder
+		writeADIFField(&b, adifLoopField, path)
+		return message[:i] + b.String() + message[i:]
+	}
+	return message
+}
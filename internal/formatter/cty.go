@@ -0,0 +1,164 @@
+package formatter
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CTY maps callsigns to DXCC entities using a cty.dat country file, as
+// published by country-files.com for contest loggers
+type CTY struct {
+	prefixes map[string]CTYEntity // prefix -> entity
+	exact    map[string]CTYEntity // full callsign -> entity
+	longest  int
+}
+
+// CTYEntity is a DXCC entity, or one of the CQ WAE entities, as cty.dat
+// lists it. Continent and CQZone are those of the prefix or call looked up,
+// which may differ from the rest of the entity, e.g. for VO1 in Canada.
+type CTYEntity struct {
+	Name      string
+	Prefix    string // Primary prefix, e.g. K or VE
+	Continent string // AF, AN, AS, EU, NA, OC or SA
+	CQZone    int
+}
+
+// LoadCTY reads a cty.dat file. Each entity is a header line of
+// colon-separated fields starting with the entity name, followed by its
+// comma-separated prefixes ending with ';'. Prefixes starting with '=' are
+// exact callsigns; (CQ zone) and {continent} overrides apply to the prefix
+// they follow, and [ITU zone], <lat/lon> and ~offset~ overrides are ignored.
+func LoadCTY(path string) (*CTY, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cty.dat file: %w", err)
+	}
+
+	cty, err := ParseCTY(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cty.dat file %s: %w", path, err)
+	}
+	return cty, nil
+}
+
+// ParseCTY parses the contents of a cty.dat file
+func ParseCTY(data string) (*CTY, error) {
+	cty := &CTY{prefixes: make(map[string]CTYEntity), exact: make(map[string]CTYEntity)}
+
+	for _, record := range strings.Split(data, ";") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+
+		fields := strings.Split(record, ":")
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("malformed entity %q", firstLine(record))
+		}
+		zone, _ := strconv.Atoi(strings.TrimSpace(fields[1]))
+		base := CTYEntity{
+			Name:      strings.TrimSpace(fields[0]),
+			Prefix:    strings.TrimPrefix(strings.TrimSpace(fields[7]), "*"),
+			Continent: strings.TrimSpace(fields[3]),
+			CQZone:    zone,
+		}
+
+		for _, prefix := range strings.Split(fields[8], ",") {
+			prefix = strings.TrimSpace(prefix)
+			entity := ctyOverrides(base, prefix)
+			prefix = ctyStripOverrides(prefix)
+			switch {
+			case prefix == "":
+			case strings.HasPrefix(prefix, "="):
+				cty.exact[prefix[1:]] = entity
+			default:
+				cty.prefixes[prefix] = entity
+				cty.longest = max(cty.longest, len(prefix))
+			}
+		}
+	}
+
+	if len(cty.prefixes) == 0 {
+		return nil, fmt.Errorf("no entities found")
+	}
+	return cty, nil
+}
+
+// Len returns the number of prefixes and exact callsigns loaded
+func (c *CTY) Len() int {
+	return len(c.prefixes) + len(c.exact)
+}
+
+// Entity returns the name of the DXCC entity of a callsign
+func (c *CTY) Entity(call string) (string, bool) {
+	entity, ok := c.Lookup(call)
+	return entity.Name, ok
+}
+
+// Lookup returns the DXCC entity of a callsign. A stroke prefix such as the
+// VP2E in VP2E/K1ABC decides the entity; portable designators and call area
+// suffixes don't.
+func (c *CTY) Lookup(call string) (CTYEntity, bool) {
+	call = SanitizeCallsign(call)
+	if entity, ok := c.exact[call]; ok {
+		return entity, true
+	}
+
+	lookup := call
+	if parts := strings.Split(call, "/"); len(parts) > 1 {
+		lookup = ""
+		for _, part := range parts {
+			if portableDesignators[part] || len(part) == 1 && isDigit(part[0]) {
+				continue
+			}
+			if lookup == "" || len(part) < len(lookup) {
+				lookup = part
+			}
+		}
+		if entity, ok := c.exact[lookup]; ok {
+			return entity, true
+		}
+	}
+
+	for n := min(len(lookup), c.longest); n > 0; n-- {
+		if entity, ok := c.prefixes[lookup[:n]]; ok {
+			return entity, true
+		}
+	}
+	return CTYEntity{}, false
+}
+
+// ctyOverrides applies the (CQ zone) and {continent} overrides of a cty.dat
+// prefix to its entity
+func ctyOverrides(entity CTYEntity, prefix string) CTYEntity {
+	if _, rest, ok := strings.Cut(prefix, "("); ok {
+		if zone, _, ok := strings.Cut(rest, ")"); ok {
+			if n, err := strconv.Atoi(zone); err == nil {
+				entity.CQZone = n
+			}
+		}
+	}
+	if _, rest, ok := strings.Cut(prefix, "{"); ok {
+		if continent, _, ok := strings.Cut(rest, "}"); ok {
+			entity.Continent = continent
+		}
+	}
+	return entity
+}
+
+// ctyStripOverrides removes the zone, location, continent and time offset
+// overrides from a cty.dat prefix
+func ctyStripOverrides(prefix string) string {
+	if i := strings.IndexAny(prefix, "([<{~"); i >= 0 {
+		return prefix[:i]
+	}
+	return prefix
+}
+
+// firstLine returns the first line of s, for error messages
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,261 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// DetectRule classifies a message as Type when every condition it sets
+// matches. Text conditions are compared case-insensitively.
+type DetectRule struct {
+	Name        string
+	Type        MessageType
+	Magic       []byte         // message starts with these bytes
+	Contains    []string       // message contains all of these
+	ContainsAny []string       // message contains at least one of these
+	NotContains []string       // message contains none of these
+	Regex       *regexp.Regexp // message matches the expression
+	Binary      bool           // more than 10% of the message is control characters
+	TextLog     bool           // message fits the configured text log format
+	QSOLogged   bool           // message is a WSJT-X binary QSO Logged message
+}
+
+// CustomDetectRule is a detection rule as written in the configuration.
+// It replaces the built-in rule of the same name, or is inserted before the
+// rule named by Before, or ahead of all built-in rules.
+type CustomDetectRule struct {
+	Name        string
+	Type        string
+	Magic       string // hex, e.g. "adbccbda"
+	Contains    []string
+	ContainsAny []string
+	NotContains []string
+	Regex       string
+	Before      string
+}
+
+// messageTypes are the types a detection rule can assign
+var messageTypes = map[MessageType]bool{
+	MessageTypeWSJTX:       true,
+	MessageTypeFldigi:      true,
+	MessageTypeJS8Call:     true,
+	MessageTypeVarAC:       true,
+	MessageTypeN1MM:        true,
+	MessageTypeMacLoggerDX: true,
+	MessageTypeRUMlog:      true,
+	MessageTypeJTAlert:     true,
+	MessageTypeTextLog:     true,
+	MessageTypeGeneral:     true,
+}
+
+// ValidMessageType reports whether name is a source type detection rules
+// and listeners can assign
+func ValidMessageType(name string) bool {
+	return messageTypes[MessageType(strings.ToLower(name))]
+}
+
+// MessageTypes returns the names ValidMessageType accepts, sorted
+func MessageTypes() []string {
+	names := make([]string, 0, len(messageTypes))
+	for t := range messageTypes {
+		names = append(names, string(t))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wsjtxMagic starts every WSJT-X binary protocol datagram
+var wsjtxMagic = []byte{0xad, 0xbc, 0xcb, 0xda}
+
+// defaultDetectRules are used when no rules are configured
+var defaultDetectRules = DefaultDetectRules()
+
+// DefaultDetectRules returns the built-in detection rules in priority order
+func DefaultDetectRules() []DetectRule {
+	return []DetectRule{
+		// WSJT-X wraps logged ADIF in its binary protocol and sends the same
+		// QSO as a binary QSO Logged message; anything else with the header
+		// is a status or heartbeat message and is ignored
+		{Name: "wsjtx-binary-adif", Type: MessageTypeWSJTX, Magic: wsjtxMagic, ContainsAny: []string{"<adif", "<call:"}},
+		{Name: "wsjtx-binary-logged", Type: MessageTypeWSJTX, Magic: wsjtxMagic, QSOLogged: true},
+		{Name: "wsjtx-binary", Type: MessageTypeGeneral, Magic: wsjtxMagic},
+		{Name: "binary", Type: MessageTypeGeneral, Binary: true},
+
+		// MacLoggerDX, RUMlogNG and JTAlert name themselves; check before the
+		// JSON and ADIF rules below claim their messages
+		{Name: "macloggerdx", Type: MessageTypeMacLoggerDX, ContainsAny: []string{"macloggerdx"}},
+		{Name: "rumlog", Type: MessageTypeRUMlog, ContainsAny: []string{"rumlog"}},
+		// JTAlert's re-sent WSJT-X datagrams keep the WSJT-X header and match
+		// above; its own broadcasts name it
+		{Name: "jtalert", Type: MessageTypeJTAlert, ContainsAny: []string{"jtalert"}},
+
+		{Name: "n1mm", Type: MessageTypeN1MM, ContainsAny: []string{"<contactinfo", "<contactreplace", "<contactdelete", "<contestname>", "<mycall>", "n1mm"}},
+
+		{Name: "varac", Type: MessageTypeVarAC, ContainsAny: []string{"varac", "var-ac"}},
+		{Name: "varac-adif-mode", Type: MessageTypeVarAC, Contains: []string{"<mode:", "vara"}},
+		{Name: "varac-adif-submode", Type: MessageTypeVarAC, Contains: []string{"<submode:", "vara"}},
+		{Name: "varac-json", Type: MessageTypeVarAC, Contains: []string{"{", `"call"`, `"freq`}},
+
+		// Fldigi before WSJT-X since both send ADIF
+		{Name: "fldigi", Type: MessageTypeFldigi, ContainsAny: []string{"fldigi", "<fldigi_", "<station_callsign:"}},
+
+		{Name: "wsjtx-adif", Type: MessageTypeWSJTX, Contains: []string{"<call:"}, NotContains: []string{"vara"}},
+		// Text naming WSJT-X counts only if it carries ADIF-style tags
+		{Name: "wsjtx", Type: MessageTypeWSJTX, Contains: []string{"wsjt-x", "<", ":", ">"}},
+
+		{Name: "textlog", Type: MessageTypeTextLog, TextLog: true},
+
+		{Name: "js8call", Type: MessageTypeJS8Call, ContainsAny: []string{"js8"}},
+	}
+}
+
+// BuildDetectRules combines the built-in rules with custom ones, leaving out
+// the built-in rules named in disable
+func BuildDetectRules(custom []CustomDetectRule, disable []string) ([]DetectRule, error) {
+	rules := DefaultDetectRules()
+
+	index := func(name string) int {
+		for i, rule := range rules {
+			if strings.EqualFold(rule.Name, name) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, name := range disable {
+		i := index(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown detection rule %q in disable list", name)
+		}
+		rules = append(rules[:i], rules[i+1:]...)
+	}
+
+	// Rules without a position go ahead of the built-ins in the order given
+	first := 0
+	for _, c := range custom {
+		rule, err := c.compile()
+		if err != nil {
+			return nil, err
+		}
+
+		switch i := index(rule.Name); {
+		case i >= 0:
+			if c.Before != "" {
+				return nil, fmt.Errorf("detection rule %q replaces a built-in rule and can't also set before", rule.Name)
+			}
+			rules[i] = rule
+		case c.Before != "":
+			at := index(c.Before)
+			if at < 0 {
+				return nil, fmt.Errorf("detection rule %q: unknown rule %q in before", rule.Name, c.Before)
+			}
+			rules = append(rules[:at], append([]DetectRule{rule}, rules[at:]...)...)
+		default:
+			rules = append(rules[:first], append([]DetectRule{rule}, rules[first:]...)...)
+			first++
+		}
+	}
+
+	return rules, nil
+}
+
+// compile checks a custom rule and converts it
+func (c CustomDetectRule) compile() (DetectRule, error) {
+	rule := DetectRule{
+		Name:        c.Name,
+		Type:        MessageType(strings.ToLower(c.Type)),
+		Contains:    c.Contains,
+		ContainsAny: c.ContainsAny,
+		NotContains: c.NotContains,
+	}
+	if rule.Name == "" {
+		return rule, fmt.Errorf("detection rule needs a name")
+	}
+	if !messageTypes[rule.Type] {
+		return rule, fmt.Errorf("detection rule %q: unknown type %q", rule.Name, c.Type)
+	}
+
+	if c.Magic != "" {
+		magic, err := hex.DecodeString(strings.ReplaceAll(c.Magic, " ", ""))
+		if err != nil {
+			return rule, fmt.Errorf("detection rule %q: invalid magic %q: %w", rule.Name, c.Magic, err)
+		}
+		rule.Magic = magic
+	}
+	if c.Regex != "" {
+		regex, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return rule, fmt.Errorf("detection rule %q: invalid regex: %w", rule.Name, err)
+		}
+		rule.Regex = regex
+	}
+
+	if rule.Magic == nil && rule.Regex == nil && len(rule.Contains) == 0 && len(rule.ContainsAny) == 0 && len(rule.NotContains) == 0 {
+		return rule, fmt.Errorf("detection rule %q has no conditions", rule.Name)
+	}
+	return rule, nil
+}
+
+// match reports whether the rule matches a message; lower is the message in
+// lower case
+func (r *DetectRule) match(f *Formatter, message, lower string) bool {
+	if r.Magic != nil && !bytes.HasPrefix([]byte(message), r.Magic) {
+		return false
+	}
+	for _, s := range r.Contains {
+		if !strings.Contains(lower, strings.ToLower(s)) {
+			return false
+		}
+	}
+	if len(r.ContainsAny) > 0 {
+		found := false
+		for _, s := range r.ContainsAny {
+			if strings.Contains(lower, strings.ToLower(s)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, s := range r.NotContains {
+		if strings.Contains(lower, strings.ToLower(s)) {
+			return false
+		}
+	}
+	if r.Regex != nil && !r.Regex.MatchString(message) {
+		return false
+	}
+	if r.Binary && !isBinary(message) {
+		return false
+	}
+	if r.TextLog && (f.opts.TextLog == nil || !f.opts.TextLog.Match(message)) {
+		return false
+	}
+	if r.QSOLogged {
+		if h, ok := wsjtx.ParseHeader([]byte(message)); !ok || h.Type != wsjtx.MessageQSOLogged {
+			return false
+		}
+	}
+	return true
+}
+
+// isBinary reports whether more than 10% of the message is control
+// characters other than tab, CR and LF, as in binary protocol messages
+func isBinary(message string) bool {
+	count := 0
+	for _, b := range []byte(message) {
+		if b < 32 && b != 9 && b != 10 && b != 13 {
+			count++
+		}
+	}
+	return len(message) > 0 && float64(count)/float64(len(message)) > 0.1
+}
@@ -0,0 +1,91 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// N1MMScore is the dynamicresults message N1MM Logger Plus broadcasts as
+// the score changes. It is the format of the online scoreboards, so Raw is
+// what they are sent.
+type N1MMScore struct {
+	XMLName   xml.Name `xml:"dynamicresults"`
+	Contest   string   `xml:"contest"`
+	Call      string   `xml:"call"`
+	Ops       string   `xml:"ops"`
+	Score     int      `xml:"score"`
+	Timestamp string   `xml:"timestamp"`
+	Breakdown struct {
+		QSOs   []n1mmScoreCount `xml:"qso"`
+		Points []n1mmScoreCount `xml:"point"`
+		Mults  []n1mmScoreCount `xml:"mult"`
+	} `xml:"breakdown"`
+
+	Raw string `xml:"-"`
+}
+
+// n1mmScoreCount is one count of a score breakdown, by band and mode
+type n1mmScoreCount struct {
+	Band  string `xml:"band,attr"`
+	Mode  string `xml:"mode,attr"`
+	Type  string `xml:"type,attr"` // Multipliers only
+	Value int    `xml:",chardata"`
+}
+
+// ParseN1MMScore decodes an N1MM dynamicresults message
+func ParseN1MMScore(message string) (*N1MMScore, error) {
+	var score N1MMScore
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(message)), &score); err != nil {
+		return nil, fmt.Errorf("failed to parse N1MM score XML: %w", err)
+	}
+	score.Call = strings.ToUpper(strings.TrimSpace(score.Call))
+	score.Contest = strings.TrimSpace(score.Contest)
+	if score.Call == "" {
+		return nil, fmt.Errorf("no callsign found in N1MM score")
+	}
+	score.Raw = message
+	return &score, nil
+}
+
+// QSOs returns the total QSO count
+func (s *N1MMScore) QSOs() int {
+	return scoreTotal(s.Breakdown.QSOs)
+}
+
+// Points returns the total QSO points
+func (s *N1MMScore) Points() int {
+	return scoreTotal(s.Breakdown.Points)
+}
+
+// Mults returns the total multipliers, summed over the kinds of multiplier
+func (s *N1MMScore) Mults() int {
+	return scoreTotal(s.Breakdown.Mults)
+}
+
+// Time returns when N1MM worked out the score, or the zero time if it
+// didn't say
+func (s *N1MMScore) Time() time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(s.Timestamp))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// scoreTotal sums the all-band, all-mode counts of a breakdown
+func scoreTotal(counts []n1mmScoreCount) int {
+	total := 0
+	for _, c := range counts {
+		if strings.EqualFold(c.Band, "total") && strings.EqualFold(c.Mode, "all") {
+			total += c.Value
+		}
+	}
+	return total
+}
+
+// String summarizes the score for logs
+func (s *N1MMScore) String() string {
+	return fmt.Sprintf("%s in %s: %d points (%d QSOs, %d mults)", s.Call, s.Contest, s.Score, s.QSOs(), s.Mults())
+}
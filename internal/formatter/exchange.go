@@ -0,0 +1,295 @@
+package formatter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExchangeParser names a way of splitting a received exchange into fields
+type ExchangeParser string
+
+const (
+	ExchangeParserAuto     ExchangeParser = ""          // Chosen from the contest name
+	ExchangeParserNone     ExchangeParser = "none"      // Exchange kept as received
+	ExchangeParserSKCC     ExchangeParser = "skcc"      // RST, state/province/country, name, SKCC number
+	ExchangeParserQSOParty ExchangeParser = "qso_party" // State/province or county
+	ExchangeParserRoundup  ExchangeParser = "roundup"   // RST, state/province or serial number (RTTY and FT Roundup)
+	ExchangeParserFieldDay ExchangeParser = "field_day" // Class and section (ARRL and Winter Field Day)
+	ExchangeParserGrid     ExchangeParser = "grid"      // 4-character grid (WW Digi, ARRL VHF contests)
+	ExchangeParserEUVHF    ExchangeParser = "eu_vhf"    // RST and serial number, 6-character grid
+)
+
+// ValidExchangeParser reports whether name is a known exchange parser
+func ValidExchangeParser(name string) bool {
+	switch ExchangeParser(strings.ToLower(name)) {
+	case ExchangeParserAuto, "auto", ExchangeParserNone, ExchangeParserSKCC, ExchangeParserQSOParty,
+		ExchangeParserRoundup, ExchangeParserFieldDay, ExchangeParserGrid, ExchangeParserEUVHF:
+		return true
+	}
+	return false
+}
+
+// ContestExchange is a received exchange split into the fields loggers
+// keep it in
+type ContestExchange struct {
+	Exchange string // N1MM exchange1
+	Section  string // State, province or (SKCC) country
+	County   string
+	Name     string
+	SKCC     string // SKCC member number with any C/T/S suffix
+	Serial   string // Received serial number, N1MM rcvnr
+	Class    string // Field Day class, e.g. 3A
+	Grid     string // Maidenhead locator sent as the exchange
+}
+
+var (
+	skccNumberRegex  = regexp.MustCompile(`^\d+[CTS]?$`)
+	rstRegex         = regexp.MustCompile(`^[1-5][1-9][1-9]?$`)
+	qsoPartyRegex    = regexp.MustCompile(`^([A-Z]{2})QP$`)
+	exchangeSepRegex = regexp.MustCompile(`[\s,]+`)
+	serialRegex      = regexp.MustCompile(`^\d{1,5}$`)
+	fieldDayRegex    = regexp.MustCompile(`^\d{1,2}[A-FHIMO]$`)
+	// WSJT-X sends the EU VHF report and serial number as one word: 570007
+	reportSerialRegex = regexp.MustCompile(`^([1-5][1-9])(\d{3,4})$`)
+)
+
+// usStates and canadianProvinces are the abbreviations sent as a state or
+// province in exchanges
+var (
+	usStates = wordSet("AL AK AZ AR CA CO CT DE DC FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY")
+
+	canadianProvinces = wordSet("AB BC LB MB NB NF NL NS NT NU ON PE QC SK YT PEI")
+)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// isStateOrProvince reports whether a word is a US state or Canadian province
+func isStateOrProvince(word string) bool {
+	return usStates[word] || canadianProvinces[word]
+}
+
+// exchangeParser returns the parser for a contest: the configured one, else
+// SKCC for SKCC contests and the QSO party parser for state QSO parties
+// (NYQP, CQP, ...)
+func (f *Formatter) exchangeParser(contest string) ExchangeParser {
+	contest = strings.ToUpper(strings.TrimSpace(contest))
+	if p, ok := f.opts.ExchangeParsers[contest]; ok && p != ExchangeParserAuto && p != "auto" {
+		return p
+	}
+
+	// WSJT-X special activities, by N1MM and ADIF CONTEST_ID names
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, contest)
+	switch {
+	case strings.HasPrefix(name, "ARRLRTTY"), strings.HasPrefix(name, "RTTYRU"), strings.HasPrefix(name, "RTTYROUNDUP"),
+		strings.HasPrefix(name, "FTRU"), strings.HasPrefix(name, "FTROUNDUP"), strings.HasPrefix(name, "ARRLFTRU"):
+		return ExchangeParserRoundup
+	case name == "FD", name == "ARRLFD", name == "FIELDDAY", name == "ARRLFIELDDAY", name == "WFD", name == "WINTERFIELDDAY":
+		return ExchangeParserFieldDay
+	case strings.HasPrefix(name, "WWDIGI"), strings.HasPrefix(name, "CQWWDIGI"), strings.HasPrefix(name, "ARRLVHF"), strings.HasPrefix(name, "NAVHF"):
+		return ExchangeParserGrid
+	case strings.HasPrefix(name, "EUVHF"):
+		return ExchangeParserEUVHF
+	}
+
+	switch {
+	case strings.HasPrefix(contest, "SKCC"):
+		return ExchangeParserSKCC
+	case qsoPartyState(contest) != "":
+		return ExchangeParserQSOParty
+	case strings.Contains(strings.NewReplacer("-", "", "_", "", " ", "").Replace(contest), "QSOPARTY"):
+		return ExchangeParserQSOParty
+	}
+	return ExchangeParserNone
+}
+
+// qsoPartyState returns the state holding a state QSO party, from N1MM
+// contest names such as NYQP, or "" for other contests
+func qsoPartyState(contest string) string {
+	if contest == "CQP" {
+		return "CA"
+	}
+	if m := qsoPartyRegex.FindStringSubmatch(contest); m != nil && usStates[m[1]] {
+		return m[1]
+	}
+	return ""
+}
+
+// contestExchange splits a QSO's exchange with the parser for its contest
+func (f *Formatter) contestExchange(qso *QSO) ContestExchange {
+	_, _, contest := f.identity(qso)
+	exchange := strings.TrimSpace(qso.Exchange)
+	ce := ContestExchange{Exchange: exchange}
+	if exchange == "" {
+		return ce
+	}
+
+	words := exchangeSepRegex.Split(strings.ToUpper(exchange), -1)
+	switch f.exchangeParser(contest) {
+	case ExchangeParserSKCC:
+		parseSKCC(words, &ce)
+	case ExchangeParserQSOParty:
+		parseQSOParty(words, qsoPartyState(strings.ToUpper(contest)), &ce)
+	case ExchangeParserRoundup:
+		parseRoundup(withoutReport(words), &ce)
+	case ExchangeParserFieldDay:
+		parseFieldDay(words, &ce)
+	case ExchangeParserGrid:
+		parseGridExchange(withoutReport(words), &ce)
+	case ExchangeParserEUVHF:
+		parseEUVHF(words, &ce)
+	}
+	return ce
+}
+
+// withoutReport drops a leading signal report, which WSJT-X includes in the
+// exchange it logs for some contests
+func withoutReport(words []string) []string {
+	if len(words) > 1 && (rstRegex.MatchString(words[0]) || isSNRReport(words[0], "")) {
+		return words[1:]
+	}
+	return words
+}
+
+// serialNumber formats a received serial number the way N1MM does, without
+// leading zeros
+func serialNumber(word string) string {
+	n, err := strconv.Atoi(word)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// parseRoundup reads an RTTY or FT Roundup exchange: W/VE stations send
+// their state or province, others a serial number. exchange1 keeps the
+// exchange without the report.
+func parseRoundup(words []string, ce *ContestExchange) {
+	for _, w := range words {
+		switch {
+		case isStateOrProvince(w) && ce.Section == "":
+			ce.Section = w
+		case serialRegex.MatchString(w) && ce.Serial == "":
+			ce.Serial = serialNumber(w)
+		}
+	}
+	ce.Exchange = strings.Join(words, " ")
+}
+
+// parseFieldDay reads a Field Day exchange: the class, e.g. 3A, goes in
+// exchange1 and the ARRL section in the section
+func parseFieldDay(words []string, ce *ContestExchange) {
+	for _, w := range words {
+		switch {
+		case fieldDayRegex.MatchString(w) && ce.Class == "":
+			ce.Class = w
+			ce.Exchange = w
+		case rstRegex.MatchString(w):
+		case ce.Section == "":
+			ce.Section = w
+		}
+	}
+}
+
+// parseGridExchange reads an exchange that is a grid, which goes to
+// gridsquare as well as exchange1
+func parseGridExchange(words []string, ce *ContestExchange) {
+	for _, w := range words {
+		if gridRegex.MatchString(w) {
+			ce.Grid = w
+			ce.Exchange = w
+			return
+		}
+	}
+}
+
+// parseEUVHF reads an EU VHF exchange: a report and serial number, either
+// as one word or two, and a 6-character grid
+func parseEUVHF(words []string, ce *ContestExchange) {
+	for i, w := range words {
+		switch {
+		case gridRegex.MatchString(w):
+			ce.Grid = w
+			ce.Exchange = w
+		case ce.Serial != "":
+		case reportSerialRegex.MatchString(w):
+			ce.Serial = serialNumber(reportSerialRegex.FindStringSubmatch(w)[2])
+		case serialRegex.MatchString(w) && !(i == 0 && len(words) > 2 && rstRegex.MatchString(w)):
+			ce.Serial = serialNumber(w)
+		}
+	}
+}
+
+// parseSKCC reads an SKCC exchange: RST, state/province/country, name and
+// SKCC number, the last being NONE for non-members. The number goes in
+// exchange1.
+func parseSKCC(words []string, ce *ContestExchange) {
+	var numbers, others []string
+	for _, w := range words {
+		switch {
+		case skccNumberRegex.MatchString(w):
+			numbers = append(numbers, w)
+		case w == "NONE":
+		default:
+			others = append(others, w)
+		}
+	}
+
+	// A lone report is not a member number
+	if len(numbers) > 1 || len(numbers) == 1 && (numbers[0] != words[0] || !rstRegex.MatchString(numbers[0])) {
+		ce.SKCC = numbers[len(numbers)-1]
+		ce.Exchange = ce.SKCC
+	}
+
+	// The location comes before the name; a single word is the name unless
+	// it is a state or province
+	switch {
+	case len(others) >= 2:
+		ce.Section, ce.Name = others[0], strings.Join(others[1:], " ")
+	case len(others) == 1 && isStateOrProvince(others[0]):
+		ce.Section = others[0]
+	case len(others) == 1:
+		ce.Name = others[0]
+	}
+}
+
+// parseQSOParty reads a state QSO party exchange. Stations outside the
+// state send their state or province, those inside it their county; a
+// county line station sends several counties joined by "/".
+func parseQSOParty(words []string, partyState string, ce *ContestExchange) {
+	for _, w := range words {
+		switch {
+		case skccNumberRegex.MatchString(w):
+			// Report or serial number
+		case isStateOrProvince(w) && ce.Section == "":
+			ce.Section = w
+		case ce.County == "":
+			ce.County = w
+		}
+	}
+	if ce.County != "" && ce.Section == "" {
+		ce.Section = partyState
+	}
+}
+
+// countyComment notes the county in a comment the way addComment would
+func countyComment(comment, county string) string {
+	if county == "" {
+		return comment
+	}
+	q := QSO{Comment: comment}
+	q.addComment("County: " + county)
+	return q.Comment
+}
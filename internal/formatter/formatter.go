@@ -2,11 +2,14 @@ package formatter
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
 )
 
 // MessageType represents the type of source message
@@ -18,58 +21,200 @@ const (
 	MessageTypeJS8Call MessageType = "js8call"
 	MessageTypeVarAC   MessageType = "varac"
 	MessageTypeN1MM    MessageType = "n1mm"
+	MessageTypeWinlink MessageType = "winlink"
+	MessageTypeRelay   MessageType = "relay"
 	MessageTypeGeneral MessageType = "general"
 )
 
+// MaxMessageSize is the largest message the parsers accept, the size of the
+// largest UDP datagram. Anything longer is corrupt or hostile, and is not
+// worth running the parsers over.
+const MaxMessageSize = 65536
+
+// ErrMessageTooLarge is returned for messages longer than MaxMessageSize
+var ErrMessageTooLarge = errors.New("message too large")
+
 // QSO represents a QSO record
 type QSO struct {
-	Callsign  string
-	Frequency string
-	Mode      string
-	RST_Sent  string
-	RST_Rcvd  string
-	DateTime  time.Time
-	Band      string
-	Exchange  string
+	Callsign     string    `json:"callsign"`
+	Frequency    string    `json:"frequency,omitempty"` // MHz, as normalized by the parser
+	FrequencyHz  int64     `json:"frequency_hz,omitempty"`
+	Mode         string    `json:"mode,omitempty"`
+	RST_Sent     string    `json:"rst_sent,omitempty"`
+	RST_Rcvd     string    `json:"rst_rcvd,omitempty"`
+	DateTime     time.Time `json:"datetime"`
+	Band         string    `json:"band,omitempty"`
+	Exchange     string    `json:"exchange,omitempty"` // Received
+	ExchangeSent string    `json:"exchange_sent,omitempty"`
+	SerialSent   int       `json:"serial_sent,omitempty"` // Serial number sent, for contests whose exchange has one
+	Comment      string    `json:"comment,omitempty"`
+	Grid         string    `json:"grid,omitempty"` // Maidenhead locator of the worked station
+
+	// Station, Operator and Contest override the formatter's identity for
+	// this QSO, e.g. to reflect which multi-op computer logged it
+	Station  string `json:"station,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Contest  string `json:"contest,omitempty"`
+
+	// StationName, NetBiosName and RadioNr override the N1MM network
+	// identity for this QSO
+	StationName string `json:"station_name,omitempty"`
+	NetBiosName string `json:"netbios_name,omitempty"`
+	RadioNr     int    `json:"radio_nr,omitempty"`
+
+	// ID identifies the QSO to loggers, e.g. N1MM's contactinfo ID. The relay
+	// that first forwards a QSO assigns it.
+	ID string `json:"id,omitempty"`
+
+	// Action marks the message as a correction or deletion of the QSO with
+	// the same ID rather than a new QSO, or as a spot
+	Action Action `json:"action,omitempty"`
+
+	// Event names what a spot announces, e.g. a VarAC beacon
+	Event string `json:"event,omitempty"`
+
+	// MyGrid is the Maidenhead locator the station was in, e.g. from GPS
+	// while roving
+	MyGrid string `json:"my_grid,omitempty"`
+
+	// MyCall is the callsign the source logged the QSO under (N1MM mycall,
+	// ADIF STATION_CALLSIGN). It routes QSOs to targets; the station sent to
+	// the targets is still Station or the configured one.
+	MyCall string `json:"my_call,omitempty"`
+
+	// Path lists the node IDs of the relays a chained QSO has passed through
+	Path []string `json:"path,omitempty"`
+
+	// CountryPrefix, Continent and CQZone place the worked station, from
+	// the country file
+	CountryPrefix string `json:"country_prefix,omitempty"`
+	Continent     string `json:"continent,omitempty"`
+	CQZone        int    `json:"cq_zone,omitempty"`
+
+	// Points and IsMult1-3 are the contest score of the QSO when scoring is
+	// on. What each multiplier stands for depends on the contest.
+	Points  int  `json:"points,omitempty"`
+	IsMult1 bool `json:"is_mult1,omitempty"`
+	IsMult2 bool `json:"is_mult2,omitempty"`
+	IsMult3 bool `json:"is_mult3,omitempty"`
 }
 
-// N1MMContactInfo represents the N1MM Logger Plus contact info XML structure
+// N1MMContactInfo represents the N1MM Logger Plus contactinfo XML structure,
+// with elements in the order N1MM itself broadcasts them
 type N1MMContactInfo struct {
-	XMLName       xml.Name `xml:"contactinfo"`
-	App           string   `xml:"app,attr"`
-	Contest       string   `xml:"contestname"`
-	Station       string   `xml:"mycall"`
-	Band          string   `xml:"band"`
-	RXFreq        string   `xml:"rxfreq"`
-	TXFreq        string   `xml:"txfreq"`
-	Operator      string   `xml:"operator"`
-	Mode          string   `xml:"mode"`
-	Call          string   `xml:"call"`
-	Timestamp     string   `xml:"timestamp"`
-	CountryPrefix string   `xml:"countryprefix"`
-	WPXPrefix     string   `xml:"wpxprefix"`
-	StationPrefix string   `xml:"stationprefix"`
-	Continent     string   `xml:"continent"`
-	SentNr        string   `xml:"snt"`
-	RcvdNr        string   `xml:"rcv"`
-	GridSquare    string   `xml:"gridsquare"`
-	Exchange      string   `xml:"exchange1"`
-	Section       string   `xml:"section"`
-	Comment       string   `xml:"comment"`
-	Qth           string   `xml:"qth"`
-	Name          string   `xml:"name"`
-	Power         string   `xml:"power"`
-	MiscText      string   `xml:"misctext"`
-	Zone          string   `xml:"zone"`
-	Prec          string   `xml:"prec"`
-	CK            string   `xml:"ck"`
-	IsMult1       string   `xml:"ismult1"`
-	IsMult2       string   `xml:"ismult2"`
-	IsMult3       string   `xml:"ismult3"`
-	Points        string   `xml:"points"`
-	Radionr       string   `xml:"radionr"`
-	RoverLocation string   `xml:"roverlocation"`
-	RadioUsed     string   `xml:"RadioUsed"`
+	XMLName         xml.Name `xml:"contactinfo"`
+	App             string   `xml:"app"`
+	Contest         string   `xml:"contestname"`
+	ContestNr       string   `xml:"contestnr"`
+	Timestamp       string   `xml:"timestamp"`
+	Station         string   `xml:"mycall"`
+	Band            string   `xml:"band"`
+	RXFreq          string   `xml:"rxfreq"`
+	TXFreq          string   `xml:"txfreq"`
+	Operator        string   `xml:"operator"`
+	Mode            string   `xml:"mode"`
+	Call            string   `xml:"call"`
+	CountryPrefix   string   `xml:"countryprefix"`
+	WPXPrefix       string   `xml:"wpxprefix"`
+	StationPrefix   string   `xml:"stationprefix"`
+	Continent       string   `xml:"continent"`
+	Sent            string   `xml:"snt"`
+	SentNr          string   `xml:"sntnr"`
+	Rcvd            string   `xml:"rcv"`
+	RcvdNr          string   `xml:"rcvnr"`
+	GridSquare      string   `xml:"gridsquare"`
+	Exchange        string   `xml:"exchange1"`
+	Section         string   `xml:"section"`
+	Comment         string   `xml:"comment"`
+	Qth             string   `xml:"qth"`
+	Name            string   `xml:"name"`
+	Power           string   `xml:"power"`
+	MiscText        string   `xml:"misctext"`
+	Zone            string   `xml:"zone"`
+	Prec            string   `xml:"prec"`
+	CK              string   `xml:"ck"`
+	IsMult1         string   `xml:"ismultiplier1"`
+	IsMult2         string   `xml:"ismultiplier2"`
+	IsMult3         string   `xml:"ismultiplier3"`
+	Points          string   `xml:"points"`
+	Radionr         string   `xml:"radionr"`
+	Run1Run2        string   `xml:"run1run2"`
+	RoverLocation   string   `xml:"RoverLocation"`
+	RadioInterfaced string   `xml:"RadioInterfaced"`
+	NetworkedCompNr string   `xml:"NetworkedCompNr"`
+	IsOriginal      string   `xml:"IsOriginal"`
+	NetBiosName     string   `xml:"NetBiosName"`
+	IsRunQSO        string   `xml:"IsRunQSO"`
+	StationName     string   `xml:"StationName"`
+	ID              string   `xml:"ID"`
+	IsClaimedQso    string   `xml:"IsClaimedQso"`
+}
+
+// Options holds optional formatter behaviour that is not part of the basic
+// station/operator/contest identity
+type Options struct {
+	// SourceTimezones maps a source type to the location its timestamps are
+	// assumed to be in. Sources without an entry are treated as UTC.
+	SourceTimezones map[MessageType]*time.Location
+
+	// OutputUTC converts QSO timestamps to UTC before they are formatted
+	OutputUTC bool
+
+	// UseReceiveTime stamps QSOs with the relay receive time instead of the
+	// time found in the source message
+	UseReceiveTime bool
+
+	// RSTDefaults overrides the default report used when a QSO has none,
+	// keyed by upper-case mode (e.g. "SSB": "59")
+	RSTDefaults map[string]string
+
+	// NormalizeDBReports pads dB-style reports (FT8, FT4, ...) to a sign
+	// and two digits, e.g. "-5" becomes "-05"
+	NormalizeDBReports bool
+
+	// RejectInvalidCallsigns drops QSOs whose callsign fails ValidCallsign
+	RejectInvalidCallsigns bool
+
+	// StrictADIF refuses ADIF and DXLog output that fails ValidateADIF,
+	// returning an *ADIFError instead
+	StrictADIF bool
+
+	// SCP, when set, flags callsigns that are not in the Super Check Partial
+	// database but are within SCPMaxDistance edits (default 1) of a known call
+	SCP            *SCP
+	SCPMaxDistance int
+
+	// SCPAutoCorrect replaces a flagged callsign when exactly one known call
+	// is close enough
+	SCPAutoCorrect bool
+
+	// NodeID identifies this relay in the path of chained QSOs; MaxHops
+	// limits how many relays a chained QSO may pass through (0 = no limit)
+	NodeID  string
+	MaxHops int
+
+	// RelayVersion is the relay envelope version written for other relays;
+	// 0 writes RelayVersion
+	RelayVersion int
+
+	// ExchangeParsers picks the exchange parser by upper-case contest name,
+	// overriding the choice made from the name itself
+	ExchangeParsers map[string]ExchangeParser
+
+	// XML controls the layout of N1MM XML output
+	XML XMLStyle
+
+	// Network identifies the relay's computer in an N1MM network
+	Network N1MMNetwork
+
+	// App is the app name and QSO IDs the relay puts in N1MM XML
+	App N1MMApp
+
+	// TextLog, when set, parses plain text log lines from legacy programs
+	TextLog *TextLog
+
+	// DetectRules replace the built-in detection rules when set
+	DetectRules []DetectRule
 }
 
 // Formatter handles message format conversion
@@ -77,6 +222,7 @@ type Formatter struct {
 	station  string
 	operator string
 	contest  string
+	opts     Options
 }
 
 // New creates a new formatter instance
@@ -88,125 +234,310 @@ func New(station, operator, contest string) *Formatter {
 	}
 }
 
-// DetectMessageType attempts to detect the source message type
-func (f *Formatter) DetectMessageType(message string) MessageType {
-	messageLower := strings.ToLower(message)
-
-	// Check for WSJT-X binary protocol header (magic bytes: 0xADBCCBDA)
-	// WSJT-X wraps ADIF messages in binary headers, so check for this first
-	if len(message) >= 4 {
-		header := []byte(message[:4])
-		if header[0] == 0xad && header[1] == 0xbc && header[2] == 0xcb && header[3] == 0xda {
-			// This is a WSJT-X binary protocol message
-			// Check if it contains ADIF data (logged QSO) or is just a status/heartbeat
-			if strings.Contains(message, "<adif") || strings.Contains(message, "<call:") || strings.Contains(message, "<CALL:") {
-				return MessageTypeWSJTX
-			}
-			// Status/heartbeat messages without ADIF should be ignored
-			return MessageTypeGeneral
-		}
-	}
+// SetOptions replaces the formatter's optional behaviour settings
+func (f *Formatter) SetOptions(opts Options) {
+	f.opts = opts
+}
 
-	// Filter out obvious binary protocol messages (contain significant non-printable characters)
-	nonPrintableCount := 0
-	for _, b := range []byte(message) {
-		if b < 32 && b != 9 && b != 10 && b != 13 { // Exclude tab, LF, CR
-			nonPrintableCount++
-		}
-	}
-	// If more than 10% of the message is non-printable, likely binary protocol
-	if len(message) > 0 && float64(nonPrintableCount)/float64(len(message)) > 0.1 {
-		return MessageTypeGeneral // Will be ignored
+// sourceLocation returns the time zone assumed for timestamps from the given source type
+func (f *Formatter) sourceLocation(msgType MessageType) *time.Location {
+	if loc, ok := f.opts.SourceTimezones[msgType]; ok && loc != nil {
+		return loc
 	}
+	return time.UTC
+}
 
-	// N1MM detection - N1MM Logger Plus sends XML contactinfo messages (check first as it's most specific)
-	if strings.Contains(messageLower, "<contactinfo") || strings.Contains(messageLower, "<contestname>") ||
-		strings.Contains(messageLower, "<mycall>") || strings.Contains(messageLower, "n1mm") ||
-		(strings.Contains(messageLower, "app=") && strings.Contains(messageLower, "n1mm")) {
-		return MessageTypeN1MM
+// DetectMessageType attempts to detect the source message type
+func (f *Formatter) DetectMessageType(message string) MessageType {
+	// QSOs from another relay are already normalized
+	if IsRelayEnvelope(message) {
+		return MessageTypeRelay
 	}
 
-	// VarAC detection - VarAC can send ADIF format or JSON format
-	if strings.Contains(messageLower, "varac") || strings.Contains(messageLower, "var-ac") ||
-		strings.Contains(messageLower, "\"app\":\"varac\"") || strings.Contains(messageLower, "<app>varac</app>") ||
-		(strings.Contains(messageLower, "<mode:") && strings.Contains(messageLower, "vara")) ||
-		(strings.Contains(messageLower, "<submode:") && strings.Contains(messageLower, "vara")) ||
-		(strings.Contains(messageLower, "{") && strings.Contains(messageLower, "\"call\"") && strings.Contains(messageLower, "\"freq")) {
-		return MessageTypeVarAC
-	}
+	msgType, _ := f.Detect(message)
+	return msgType
+}
 
-	// Fldigi detection - check BEFORE WSJT-X since both use ADIF format
-	// Look for FLDIGI-specific tags or identifiers
-	if strings.Contains(messageLower, "fldigi") ||
-		strings.Contains(messageLower, "<fldigi_") ||
-		strings.Contains(messageLower, "<station_callsign:") ||
-		strings.Contains(messageLower, "<programid:") && strings.Contains(messageLower, "fldigi") {
-		return MessageTypeFldigi
+// Detect classifies a message with the detection rules and also returns the
+// name of the rule that matched, empty if none did
+func (f *Formatter) Detect(message string) (MessageType, string) {
+	if len(message) > MaxMessageSize {
+		return MessageTypeGeneral, ""
 	}
 
-	// WSJT-X sends both binary protocol messages and ADIF log messages
-	// Only process ADIF log messages (which contain proper ADIF field tags)
-	// Binary protocol messages should be ignored even if they contain "WSJT-X"
-	if (strings.Contains(messageLower, "<call:") && !strings.Contains(messageLower, "vara")) ||
-		(strings.Contains(messageLower, "wsjt-x") && strings.Contains(messageLower, "<") && strings.Contains(messageLower, ":") && strings.Contains(messageLower, ">")) {
-		return MessageTypeWSJTX
+	rules := f.opts.DetectRules
+	if rules == nil {
+		rules = defaultDetectRules
 	}
 
-	// JS8Call detection
-	if strings.Contains(messageLower, "js8call") || strings.Contains(messageLower, "js8") {
-		return MessageTypeJS8Call
+	lower := strings.ToLower(message)
+	for i := range rules {
+		if rules[i].match(f, message, lower) {
+			return rules[i].Type, rules[i].Name
+		}
 	}
-
-	return MessageTypeGeneral
+	return MessageTypeGeneral, ""
 }
 
 // ParseMessage attempts to parse the incoming message and extract QSO information
 func (f *Formatter) ParseMessage(message string, msgType MessageType) (*QSO, error) {
+	if len(message) > MaxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(message))
+	}
+
+	var qso *QSO
+	var err error
+
 	switch msgType {
 	case MessageTypeWSJTX:
-		return f.parseWSJTX(message)
+		qso, err = f.parseWSJTX(message)
 	case MessageTypeFldigi:
-		return f.parseFldigi(message)
+		qso, err = f.parseFldigi(message)
 	case MessageTypeJS8Call:
-		return f.parseJS8Call(message)
+		qso, err = f.parseJS8Call(message)
 	case MessageTypeVarAC:
-		return f.parseVarAC(message)
+		qso, err = f.parseVarAC(message)
 	case MessageTypeN1MM:
-		return f.parseN1MM(message)
+		qso, err = f.parseN1MM(message)
+	case MessageTypeTextLog:
+		qso, err = f.parseTextLog(message)
+	case MessageTypeMacLoggerDX, MessageTypeRUMlog:
+		qso, err = f.parseMacLog(message, msgType)
+	case MessageTypeJTAlert:
+		qso, err = f.parseJTAlert(message)
+	case MessageTypeRelay:
+		// Normalized by the relay that first received it
+		return f.parseRelay(message)
 	default:
-		return f.parseGeneral(message)
+		qso, err = f.parseGeneral(message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Output of this or another relay names the relays it came through
+	qso.Path = markedPath(message)
+	if err := f.checkPath(qso); err != nil {
+		ReleaseQSO(qso)
+		return nil, err
+	}
+
+	if err := f.Normalize(qso); err != nil {
+		ReleaseQSO(qso)
+		return nil, err
+	}
+
+	return qso, nil
+}
+
+// Normalize applies the configured callsign, report and timestamp rules to a
+// QSO. ParseMessage calls it for every parsed message; sources that build
+// QSOs themselves (log file tailers and the like) should call it directly.
+func (f *Formatter) Normalize(qso *QSO) error {
+	qso.Callsign = SanitizeCallsign(qso.Callsign)
+	if qso.Callsign == "" {
+		// The parsers only check for a value, which may be all blanks or quotes
+		return fmt.Errorf("no callsign found")
+	}
+	if f.opts.RejectInvalidCallsigns && !ValidCallsign(qso.Callsign) {
+		return fmt.Errorf("invalid callsign %q", qso.Callsign)
+	}
+
+	// Catch busted calls (e.g. FT8 false decodes) against MASTER.SCP
+	f.checkSCP(qso)
+
+	// Fill in missing reports and tidy up dB-style reports for the QSO's mode
+	f.applyReportRules(qso)
+
+	// Optionally ignore the source clock and use the time the relay saw the QSO
+	if f.opts.UseReceiveTime {
+		qso.DateTime = time.Now().UTC()
+	}
+
+	return nil
+}
+
+// identity returns the station, operator and contest for a QSO, preferring
+// the QSO's own overrides over the formatter defaults
+func (f *Formatter) identity(qso *QSO) (station, operator, contest string) {
+	station, operator, contest = f.station, f.operator, f.contest
+	if qso.Station != "" {
+		station = qso.Station
+	}
+	if qso.Operator != "" {
+		operator = qso.Operator
+	}
+	if qso.Contest != "" {
+		contest = qso.Contest
 	}
+	return station, operator, contest
 }
 
-// FormatForN1MM converts a QSO to N1MM Logger Plus XML format
+// FormatForN1MM converts a QSO to N1MM Logger Plus XML format: contactinfo
+// for a new QSO, contactreplace or contactdelete for a change to one, spot
+// for a spot
 func (f *Formatter) FormatForN1MM(qso *QSO) (string, error) {
-	contact := N1MMContactInfo{
-		App:       "N7AKG-UDP-Translator",
-		Contest:   f.contest,
-		Station:   f.station,
-		Band:      qso.Band,
-		RXFreq:    qso.Frequency,
-		TXFreq:    qso.Frequency,
-		Operator:  f.operator,
-		Mode:      qso.Mode,
-		Call:      qso.Callsign,
-		Timestamp: qso.DateTime.Format("2006-01-02 15:04:05"),
-		SentNr:    qso.RST_Sent,
-		RcvdNr:    qso.RST_Rcvd,
-		Exchange:  qso.Exchange,
-		Radionr:   "1",
-	}
-
-	xmlData, err := xml.MarshalIndent(contact, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal XML: %w", err)
+	switch qso.Action {
+	case ActionReplace:
+		return f.formatN1MMReplace(qso)
+	case ActionDelete:
+		return f.formatN1MMDelete(qso)
+	case ActionSpot:
+		return f.formatN1MMSpot(qso)
+	}
+
+	if f.opts.XML.LegacyOrder {
+		timestamp := f.outputTime(qso)
+		station, operator, contest := f.identity(qso)
+		_, _, radioNr := f.network(qso, station)
+		legacy := legacyContact(qso, timestamp, f.appName(), station, operator, contest)
+		legacy.Radionr = strconv.Itoa(radioNr)
+		legacy.RoverLocation = qso.MyGrid
+		return f.marshalXML(legacy)
+	}
+
+	contact := f.n1mmContact(qso)
+	if f.opts.App.SendID {
+		contact.ID = qso.ID
+	}
+	return f.marshalXML(contact)
+}
+
+// outputTime returns the QSO timestamp as it should appear in output
+func (f *Formatter) outputTime(qso *QSO) time.Time {
+	if f.opts.OutputUTC {
+		return qso.DateTime.UTC()
+	}
+	return qso.DateTime
+}
+
+// n1mmContact fills an N1MMContactInfo from a QSO, without the ID
+func (f *Formatter) n1mmContact(qso *QSO) N1MMContactInfo {
+	timestamp := f.outputTime(qso)
+	station, operator, contest := f.identity(qso)
+	stationName, netBiosName, radioNr := f.network(qso, station)
+	exchange := f.contestExchange(qso)
+	rcvdNr := exchange.Serial
+	if rcvdNr == "" {
+		rcvdNr = "0"
+	}
+	grid := qso.Grid
+	if grid == "" {
+		grid = exchange.Grid
+	}
+
+	return N1MMContactInfo{
+		App:             f.appName(),
+		Contest:         contest,
+		ContestNr:       "0",
+		Timestamp:       timestamp.Format("2006-01-02 15:04:05"),
+		Station:         station,
+		Band:            qso.Band,
+		RXFreq:          n1mmFrequency(qso.Hz()),
+		TXFreq:          n1mmFrequency(qso.Hz()),
+		Operator:        operator,
+		Mode:            qso.Mode,
+		Call:            qso.Callsign,
+		GridSquare:      grid,
+		CountryPrefix:   qso.CountryPrefix,
+		WPXPrefix:       WPXPrefix(qso.Callsign),
+		StationPrefix:   WPXPrefix(station),
+		Continent:       qso.Continent,
+		Sent:            qso.RST_Sent,
+		SentNr:          strconv.Itoa(qso.SerialSent),
+		Rcvd:            qso.RST_Rcvd,
+		RcvdNr:          rcvdNr,
+		Exchange:        exchange.Exchange,
+		Section:         exchange.Section,
+		Comment:         countyComment(qso.Comment, exchange.County),
+		Name:            exchange.Name,
+		Zone:            strconv.Itoa(qso.CQZone),
+		CK:              "0",
+		IsMult1:         n1mmFlag(qso.IsMult1),
+		IsMult2:         n1mmFlag(qso.IsMult2),
+		IsMult3:         n1mmFlag(qso.IsMult3),
+		Points:          strconv.Itoa(qso.Points),
+		Radionr:         strconv.Itoa(radioNr),
+		Run1Run2:        "1",
+		RoverLocation:   qso.MyGrid,
+		RadioInterfaced: "0",
+		NetworkedCompNr: "0",
+		IsOriginal:      "False",
+		NetBiosName:     netBiosName,
+		IsRunQSO:        "0",
+		StationName:     stationName,
+		IsClaimedQso:    "1",
 	}
+}
 
-	return string(xmlData), nil
+// n1mmFlag formats a contactinfo flag
+func n1mmFlag(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
 }
 
+// Field extractors for the source parsers, compiled once at startup so that
+// bursts of traffic do not recompile them for every datagram
+var (
+	wsjtxCallRegex    = regexp.MustCompile(`(?i)<call:\d+>([A-Z0-9/]+)`)
+	wsjtxBandRegex    = regexp.MustCompile(`(?i)<band:\d+>(\d+m)`)
+	wsjtxModeRegex    = regexp.MustCompile(`(?i)<mode:\d+>(\w+)`)
+	wsjtxRstSentRegex = regexp.MustCompile(`(?i)<rst_sent:\d+>([\-\+]?\d+)`)
+	wsjtxRstRcvdRegex = regexp.MustCompile(`(?i)<rst_rcvd:\d+>([\-\+]?\d+)`)
+	wsjtxFreqRegex    = regexp.MustCompile(`(?i)<freq:\d+>(\d+\.?\d*)`)
+	wsjtxQsoDateRegex = regexp.MustCompile(`(?i)<qso_date:\d+>(\d{8})`)
+	wsjtxTimeOnRegex  = regexp.MustCompile(`(?i)<time_on:\d+>(\d{4,6})`)
+	// Contest exchanges may contain spaces, so these are read by length
+	wsjtxSrxStringRegex = regexp.MustCompile(`(?i)<srx_string:(\d+)>`)
+	wsjtxStxStringRegex = regexp.MustCompile(`(?i)<stx_string:(\d+)>`)
+	wsjtxStationRegex   = regexp.MustCompile(`(?i)<station_callsign:(\d+)>`)
+
+	varacJSONCallRegex      = regexp.MustCompile(`"call"\s*:\s*"([A-Z0-9/]+)"`)
+	varacJSONFreqRegex      = regexp.MustCompile(`"freq(?:uency)?"\s*:\s*"?(\d+\.?\d*)"?`)
+	varacJSONModeRegex      = regexp.MustCompile(`"mode"\s*:\s*"([^"]+)"`)
+	varacJSONBandRegex      = regexp.MustCompile(`"band"\s*:\s*"([^"]+)"`)
+	varacJSONRstSentRegex   = regexp.MustCompile(`"rst_sent"\s*:\s*"([^"]+)"`)
+	varacJSONRstRcvdRegex   = regexp.MustCompile(`"rst_r(?:cvd|eceived)"\s*:\s*"([^"]+)"`)
+	varacJSONTimestampRegex = regexp.MustCompile(`"timestamp"\s*:\s*"([^"]+)"`)
+
+	varacTextCallRegex     = regexp.MustCompile(`(?i)(?:qso\s+(?:with\s+|completed\s+with\s+)|call[:\s]+)([A-Z0-9/]+)`)
+	varacTextFallbackRegex = regexp.MustCompile(`\b([A-Z0-9]{1,3}[0-9][A-Z0-9]{0,3}[A-Z])\b`)
+	varacTextFreqRegex     = regexp.MustCompile(`(?:on\s+|@\s+|freq[:\s]+)(\d+\.?\d*)\s*(?:MHz|khz)?`)
+	varacTextFreqRegex2    = regexp.MustCompile(`\b(\d{1,2}\.\d{3})\b`)
+
+	adifFieldRegex = regexp.MustCompile(`<([A-Z_]+):(\d+)>([^<]{0,})`)
+
+	n1mmCallRegex          = regexp.MustCompile(`<call>([^<]+)</call>`)
+	n1mmFreqRegex          = regexp.MustCompile(`<rxfreq>([^<]+)</rxfreq>`)
+	n1mmTxFreqRegex        = regexp.MustCompile(`<txfreq>([^<]+)</txfreq>`)
+	n1mmModeRegex          = regexp.MustCompile(`<mode>([^<]+)</mode>`)
+	n1mmBandRegex          = regexp.MustCompile(`<band>([^<]+)</band>`)
+	n1mmMyCallRegex        = regexp.MustCompile(`<mycall>([^<]+)</mycall>`)
+	n1mmOperatorRegex      = regexp.MustCompile(`<operator>([^<]+)</operator>`)
+	n1mmStationNameRegex   = regexp.MustCompile(`<StationName>([^<]+)</StationName>`)
+	n1mmNetBiosNameRegex   = regexp.MustCompile(`<NetBiosName>([^<]+)</NetBiosName>`)
+	n1mmRstSentRegex       = regexp.MustCompile(`<snt>([^<]+)</snt>`)
+	n1mmRstRcvdRegex       = regexp.MustCompile(`<rcv>([^<]+)</rcv>`)
+	n1mmSentNrRegex        = regexp.MustCompile(`<sntnr>\s*(\d+)\s*</sntnr>`)
+	n1mmTimestampAttrRegex = regexp.MustCompile(`timestamp="([^"]+)"`)
+	n1mmTimestampElemRegex = regexp.MustCompile(`<timestamp>([^<]+)</timestamp>`)
+	n1mmExchangeRegex      = regexp.MustCompile(`<exchange1?>([^<]+)</exchange1?>`)
+	n1mmIDRegex            = regexp.MustCompile(`<ID>([^<]+)</ID>`)
+
+	generalCallRegex = regexp.MustCompile(`\b([A-Z0-9]{1,3}[0-9][A-Z0-9]{0,3}[A-Z])\b`)
+	generalFreqRegex = regexp.MustCompile(`(\d+\.?\d*)\s*MHz`)
+	generalBandRegex = regexp.MustCompile(`(\d+)m\b`)
+	generalModeRegex = regexp.MustCompile(`\b(FT8|FT4|PSK31|RTTY|CW|SSB|LSB|USB|AM|FM)\b`)
+)
+
 // parseWSJTX parses WSJT-X format messages
 func (f *Formatter) parseWSJTX(message string) (*QSO, error) {
+	if logged, ok := wsjtx.ParseQSOLogged([]byte(message)); ok {
+		return parseQSOLogged(logged)
+	}
+
 	// Example WSJT-X ADIF format: <call:6>VK1ABC<band:3>20m<mode:4>FT8<rst_sent:3>-05<rst_rcvd:3>-12<qso_date:8>20231012<time_on:6>123000<eor>
 
 	// WSJT-X wraps ADIF messages in a binary protocol header
@@ -235,50 +566,42 @@ func (f *Formatter) parseWSJTX(message string) (*QSO, error) {
 		return nil, fmt.Errorf("not a valid ADIF QSO message")
 	}
 
-	qso := &QSO{
-		DateTime: time.Now(), // Default fallback
-	}
+	qso := newQSO()
 
 	// Parse ADIF-style fields
-	callRegex := regexp.MustCompile(`<call:\d+>([A-Z0-9/]+)`)
-	if match := callRegex.FindStringSubmatch(message); len(match) > 1 {
-		qso.Callsign = match[1]
+	// Tags are case-insensitive; saved logs often write them in capitals
+	if match := wsjtxCallRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.Callsign = strings.ToUpper(match[1])
 	}
 
-	bandRegex := regexp.MustCompile(`<band:\d+>(\d+m)`)
-	if match := bandRegex.FindStringSubmatch(message); len(match) > 1 {
-		qso.Band = match[1]
+	if match := wsjtxBandRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.Band = strings.ToLower(match[1])
 	}
 
-	modeRegex := regexp.MustCompile(`<mode:\d+>(\w+)`)
-	if match := modeRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxModeRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Mode = match[1]
 	}
 
-	rstSentRegex := regexp.MustCompile(`<rst_sent:\d+>([\-\+]?\d+)`)
-	if match := rstSentRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxRstSentRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.RST_Sent = match[1]
 	}
 
-	rstRcvdRegex := regexp.MustCompile(`<rst_rcvd:\d+>([\-\+]?\d+)`)
-	if match := rstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxRstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.RST_Rcvd = match[1]
 	}
 
-	freqRegex := regexp.MustCompile(`<freq:\d+>(\d+\.?\d*)`)
-	if match := freqRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxFreqRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Frequency = match[1]
+		normalizeMHz(qso)
 	}
 
 	// Parse date and time fields (case-insensitive, handle spaces)
-	qsoDateRegex := regexp.MustCompile(`(?i)<qso_date:\d+>(\d{8})`)
-	timeOnRegex := regexp.MustCompile(`(?i)<time_on:\d+>(\d{4,6})`)
 
 	var qsoDate, timeOn string
-	if match := qsoDateRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxQsoDateRegex.FindStringSubmatch(message); len(match) > 1 {
 		qsoDate = strings.TrimSpace(match[1])
 	}
-	if match := timeOnRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := wsjtxTimeOnRegex.FindStringSubmatch(message); len(match) > 1 {
 		timeOn = strings.TrimSpace(match[1])
 	}
 
@@ -293,8 +616,8 @@ func (f *Formatter) parseWSJTX(message string) (*QSO, error) {
 
 		dateTimeStr := qsoDate + timeOn
 		if len(dateTimeStr) >= 14 { // YYYYMMDDHHMMSS
-			// ADIF times are in UTC
-			if t, err := time.ParseInLocation("20060102150405", dateTimeStr, time.UTC); err == nil {
+			// ADIF times are in UTC unless configured otherwise
+			if t, err := time.ParseInLocation("20060102150405", dateTimeStr, f.sourceLocation(MessageTypeWSJTX)); err == nil {
 				qso.DateTime = t
 			}
 		}
@@ -304,6 +627,11 @@ func (f *Formatter) parseWSJTX(message string) (*QSO, error) {
 		qso.DateTime = time.Now()
 	}
 
+	// Special activity (contest) exchanges
+	qso.Exchange = adifValue(message, wsjtxSrxStringRegex)
+	qso.ExchangeSent = adifValue(message, wsjtxStxStringRegex)
+	qso.MyCall = strings.ToUpper(strings.TrimSpace(adifValue(message, wsjtxStationRegex)))
+
 	if qso.Callsign == "" {
 		return nil, fmt.Errorf("no callsign found in message")
 	}
@@ -311,6 +639,46 @@ func (f *Formatter) parseWSJTX(message string) (*QSO, error) {
 	return qso, nil
 }
 
+// adifValue returns the value of the ADIF field whose tag tag matches,
+// taking as many bytes as the tag gives, or "" when the field is missing or
+// cut short
+func adifValue(message string, tag *regexp.Regexp) string {
+	loc := tag.FindStringSubmatchIndex(message)
+	if loc == nil {
+		return ""
+	}
+	length, err := strconv.Atoi(message[loc[2]:loc[3]])
+	if err != nil || length > len(message)-loc[1] {
+		return ""
+	}
+	return strings.TrimSpace(message[loc[1] : loc[1]+length])
+}
+
+// parseQSOLogged converts WSJT-X's binary QSO Logged message. Its times are
+// always UTC.
+func parseQSOLogged(logged wsjtx.QSOLogged) (*QSO, error) {
+	if logged.DXCall == "" {
+		return nil, fmt.Errorf("no callsign found in message")
+	}
+
+	qso := newQSO()
+	qso.Callsign = strings.ToUpper(logged.DXCall)
+	qso.Mode = logged.Mode
+	qso.RST_Sent = logged.ReportSent
+	qso.RST_Rcvd = logged.ReportReceived
+	qso.DateTime = logged.TimeOn
+	qso.Exchange = logged.ExchangeReceived
+	qso.ExchangeSent = logged.ExchangeSent
+	qso.Comment = logged.Comments
+	qso.Grid = strings.ToUpper(logged.DXGrid)
+	qso.MyCall = strings.ToUpper(logged.MyCall)
+	if logged.TxFrequency > 0 {
+		qso.Frequency = strconv.FormatUint(logged.TxFrequency, 10)
+		normalizeFrequency(qso, 1)
+	}
+	return qso, nil
+}
+
 // parseFldigi parses Fldigi format messages
 func (f *Formatter) parseFldigi(message string) (*QSO, error) {
 	// Check if this is a test message (no CALL field = not a QSO)
@@ -319,7 +687,7 @@ func (f *Formatter) parseFldigi(message string) (*QSO, error) {
 	}
 
 	// Fldigi sends ADIF format, so use the ADIF parser
-	return f.parseADIF(message)
+	return f.parseADIF(message, f.sourceLocation(MessageTypeFldigi))
 }
 
 // parseJS8Call parses JS8Call format messages
@@ -334,59 +702,57 @@ func (f *Formatter) parseVarAC(message string) (*QSO, error) {
 	// 1. ADIF format: <command:3>Log<parameters:267><CALL:5>n7akg <MODE:7>DYNAMIC <SUBMODE:7>VARA HF...
 	// 2. JSON format: {"app":"VarAC","call":"W1ABC","freq":"14.105","mode":"VARA"...}
 
-	qso := &QSO{
-		DateTime: time.Now(),
-		Mode:     "VARA", // Default VarAC mode
-	}
+	qso := newQSO()
+	qso.Mode = "VARA" // Default VarAC mode
 
 	// Check if it's ADIF format (contains ADIF field tags like <CALL:5>)
 	if strings.Contains(message, "<CALL:") && strings.Contains(message, "<EOR>") {
-		return f.parseADIF(message)
+		return f.parseADIF(message, f.sourceLocation(MessageTypeVarAC))
 	}
 
 	// Parse JSON-like format
-	if strings.Contains(message, "{") && strings.Contains(message, "}") {
+	isJSON := strings.Contains(message, "{") && strings.Contains(message, "}")
+	if event := varacEvent(message, isJSON); event != "" {
+		// Beacons, pings and CQs announce a station, they don't log one
+		qso.Action = ActionSpot
+		qso.Event = event
+		qso.Comment = "VarAC " + event
+	}
+	if isJSON {
 		// Extract callsign
-		callRegex := regexp.MustCompile(`"call"\s*:\s*"([A-Z0-9/]+)"`)
-		if match := callRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONCallRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Callsign = match[1]
 		}
 
 		// Extract frequency
-		freqRegex := regexp.MustCompile(`"freq(?:uency)?"\s*:\s*"?(\d+\.?\d*)"?`)
-		if match := freqRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONFreqRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Frequency = match[1]
 		}
 
 		// Extract mode
-		modeRegex := regexp.MustCompile(`"mode"\s*:\s*"([^"]+)"`)
-		if match := modeRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONModeRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Mode = match[1]
 		}
 
 		// Extract band
-		bandRegex := regexp.MustCompile(`"band"\s*:\s*"([^"]+)"`)
-		if match := bandRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONBandRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Band = match[1]
 		}
 
 		// Extract RST sent
-		rstSentRegex := regexp.MustCompile(`"rst_sent"\s*:\s*"([^"]+)"`)
-		if match := rstSentRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONRstSentRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.RST_Sent = match[1]
 		}
 
 		// Extract RST received
-		rstRcvdRegex := regexp.MustCompile(`"rst_r(?:cvd|eceived)"\s*:\s*"([^"]+)"`)
-		if match := rstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacJSONRstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.RST_Rcvd = match[1]
 		}
 
 		// Extract timestamp if available
-		timestampRegex := regexp.MustCompile(`"timestamp"\s*:\s*"([^"]+)"`)
-		if match := timestampRegex.FindStringSubmatch(message); len(match) > 1 {
-			// Try to parse the timestamp (assuming UTC)
-			if t, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], time.UTC); err == nil {
+		if match := varacJSONTimestampRegex.FindStringSubmatch(message); len(match) > 1 {
+			// Try to parse the timestamp (UTC unless configured otherwise)
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], f.sourceLocation(MessageTypeVarAC)); err == nil {
 				qso.DateTime = t
 			} else if t, err := time.Parse("2006-01-02T15:04:05Z", match[1]); err == nil {
 				qso.DateTime = t
@@ -397,25 +763,21 @@ func (f *Formatter) parseVarAC(message string) (*QSO, error) {
 		// VarAC might also send plain text messages like "QSO with W1ABC on 14.105 VARA"
 
 		// Look for callsign pattern (multiple formats)
-		callRegex := regexp.MustCompile(`(?i)(?:qso\s+(?:with\s+|completed\s+with\s+)|call[:\s]+)([A-Z0-9/]+)`)
-		if match := callRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacEventCallRegex.FindStringSubmatch(message); qso.Action == ActionSpot && len(match) > 1 {
+			qso.Callsign = strings.ToUpper(match[1])
+		} else if match := varacTextCallRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Callsign = strings.ToUpper(match[1])
 		} else {
 			// Fallback: look for any valid callsign in the message
-			fallbackRegex := regexp.MustCompile(`\b([A-Z0-9]{1,3}[0-9][A-Z0-9]{0,3}[A-Z])\b`)
-			if match := fallbackRegex.FindStringSubmatch(strings.ToUpper(message)); len(match) > 1 {
-				qso.Callsign = match[1]
-			}
+			qso.Callsign = findCallsign(varacTextFallbackRegex, strings.ToUpper(message))
 		}
 
 		// Look for frequency (more specific pattern to avoid matching callsign numbers)
-		freqRegex := regexp.MustCompile(`(?:on\s+|@\s+|freq[:\s]+)(\d+\.?\d*)\s*(?:MHz|khz)?`)
-		if match := freqRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := varacTextFreqRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Frequency = match[1]
 		} else {
 			// Fallback: look for standalone frequency
-			freqRegex2 := regexp.MustCompile(`\b(\d{1,2}\.\d{3})\b`)
-			if match := freqRegex2.FindStringSubmatch(message); len(match) > 1 {
+			if match := varacTextFreqRegex2.FindStringSubmatch(message); len(match) > 1 {
 				qso.Frequency = match[1]
 			}
 		}
@@ -432,20 +794,8 @@ func (f *Formatter) parseVarAC(message string) (*QSO, error) {
 		}
 	}
 
-	// If we have frequency but no band, derive the band
-	if qso.Frequency != "" && qso.Band == "" {
-		if freq, err := strconv.ParseFloat(qso.Frequency, 64); err == nil {
-			qso.Band = FrequencyToBand(freq)
-		}
-	}
-
-	// Set default RST if not provided
-	if qso.RST_Sent == "" {
-		qso.RST_Sent = "599"
-	}
-	if qso.RST_Rcvd == "" {
-		qso.RST_Rcvd = "599"
-	}
+	// Normalize the frequency to Hz and derive the band if missing
+	normalizeFrequency(qso, 0)
 
 	if qso.Callsign == "" {
 		return nil, fmt.Errorf("no callsign found in VarAC message: %s", message)
@@ -454,19 +804,17 @@ func (f *Formatter) parseVarAC(message string) (*QSO, error) {
 	return qso, nil
 }
 
-// parseADIF parses ADIF format messages (used by VarAC and others)
-func (f *Formatter) parseADIF(message string) (*QSO, error) {
-	qso := &QSO{
-		DateTime: time.Now(),
-	}
+// parseADIF parses ADIF format messages (used by VarAC and others).
+// loc is the time zone assumed for QSO_DATE/TIME_ON, normally UTC.
+func (f *Formatter) parseADIF(message string, loc *time.Location) (*QSO, error) {
+	qso := newQSO()
 
 	// Extract ADIF fields using regex
 	// ADIF format: <FIELD:length>value
 	adifFields := make(map[string]string)
 
 	// Regex to match ADIF field format: <FIELD_NAME:length>value
-	fieldRegex := regexp.MustCompile(`<([A-Z_]+):(\d+)>([^<]{0,})`)
-	matches := fieldRegex.FindAllStringSubmatch(message, -1)
+	matches := adifFieldRegex.FindAllStringSubmatch(message, -1)
 
 	for _, match := range matches {
 		if len(match) >= 4 {
@@ -504,37 +852,50 @@ func (f *Formatter) parseADIF(message string) (*QSO, error) {
 		qso.RST_Rcvd = rstRcvd
 	}
 
+	if grid, exists := adifFields["GRIDSQUARE"]; exists {
+		qso.Grid = strings.ToUpper(grid)
+	}
+
+	if stx, exists := adifFields["STX"]; exists {
+		qso.SerialSent, _ = strconv.Atoi(strings.TrimSpace(stx))
+	}
+
+	// Contest exchanges; a serial number alone is the exchange in serial contests
+	if srx, exists := adifFields["SRX_STRING"]; exists {
+		qso.Exchange = strings.TrimSpace(srx)
+	} else if srx, exists := adifFields["SRX"]; exists {
+		qso.Exchange = strings.TrimSpace(srx)
+	}
+	if stx, exists := adifFields["STX_STRING"]; exists {
+		qso.ExchangeSent = strings.TrimSpace(stx)
+	}
+	if station, exists := adifFields["STATION_CALLSIGN"]; exists {
+		qso.MyCall = strings.ToUpper(strings.TrimSpace(station))
+	}
+
 	// Parse date and time
 	if qsoDate, dateExists := adifFields["QSO_DATE"]; dateExists {
 		if timeOn, timeExists := adifFields["TIME_ON"]; timeExists {
 			// ADIF date format: YYYYMMDD, time format: HHMMSS (in UTC)
 			dateTimeStr := qsoDate + timeOn
 			if len(dateTimeStr) >= 13 { // YYYYMMDDHHMMSS
-				if t, err := time.ParseInLocation("20060102150405", dateTimeStr, time.UTC); err == nil {
+				if t, err := time.ParseInLocation("20060102150405", dateTimeStr, loc); err == nil {
 					qso.DateTime = t
 				}
 			} else if len(dateTimeStr) >= 11 { // YYYYMMDDHHMM
-				if t, err := time.ParseInLocation("200601021504", dateTimeStr, time.UTC); err == nil {
+				if t, err := time.ParseInLocation("200601021504", dateTimeStr, loc); err == nil {
 					qso.DateTime = t
 				}
 			}
 		}
 	}
 
-	// Set defaults if not provided
-	if qso.RST_Sent == "" {
-		qso.RST_Sent = "+00"
-	}
-	if qso.RST_Rcvd == "" {
-		qso.RST_Rcvd = "+00"
+	if freq, exists := adifFields["FREQ"]; exists {
+		qso.Frequency = freq
 	}
 
-	// If we don't have a band but we have frequency, try to derive it
-	if qso.Band == "" && qso.Frequency != "" {
-		if freq, err := strconv.ParseFloat(qso.Frequency, 64); err == nil {
-			qso.Band = FrequencyToBand(freq)
-		}
-	}
+	// ADIF frequencies are MHz; normalize to Hz and derive the band if missing
+	normalizeMHz(qso)
 
 	if qso.Callsign == "" {
 		return nil, fmt.Errorf("no callsign found in ADIF message")
@@ -548,106 +909,114 @@ func (f *Formatter) parseN1MM(message string) (*QSO, error) {
 	// N1MM Logger Plus sends XML contactinfo messages
 	// Example: <contactinfo app="N1MM Logger Plus" timestamp="2023-10-12 14:30:00"><contestname>GENERAL</contestname><mycall>W1ABC</mycall><band>20m</band><rxfreq>14.074</rxfreq><call>VK1DEF</call><mode>FT8</mode><snt>-05</snt><rcv>-12</rcv></contactinfo>
 
-	qso := &QSO{
-		DateTime: time.Now(),
-	}
+	qso := newQSO()
 
 	// Parse XML-like format using regex (lighter than full XML parsing for this use case)
 
 	// Extract callsign (the contacted station)
-	callRegex := regexp.MustCompile(`<call>([^<]+)</call>`)
-	if match := callRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmCallRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Callsign = strings.TrimSpace(match[1])
 	}
 
 	// Extract frequency
-	freqRegex := regexp.MustCompile(`<rxfreq>([^<]+)</rxfreq>`)
-	if match := freqRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmFreqRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Frequency = strings.TrimSpace(match[1])
 	}
 	// Fallback to txfreq if rxfreq not found
 	if qso.Frequency == "" {
-		txFreqRegex := regexp.MustCompile(`<txfreq>([^<]+)</txfreq>`)
-		if match := txFreqRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := n1mmTxFreqRegex.FindStringSubmatch(message); len(match) > 1 {
 			qso.Frequency = strings.TrimSpace(match[1])
 		}
 	}
 
 	// Extract mode
-	modeRegex := regexp.MustCompile(`<mode>([^<]+)</mode>`)
-	if match := modeRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmModeRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Mode = strings.TrimSpace(match[1])
 	}
 
 	// Extract band
-	bandRegex := regexp.MustCompile(`<band>([^<]+)</band>`)
-	if match := bandRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmBandRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Band = strings.TrimSpace(match[1])
 	}
 
 	// Extract RST sent (N1MM uses <snt> tag)
-	rstSentRegex := regexp.MustCompile(`<snt>([^<]+)</snt>`)
-	if match := rstSentRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmRstSentRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.RST_Sent = strings.TrimSpace(match[1])
 	}
 
 	// Extract RST received (N1MM uses <rcv> tag)
-	rstRcvdRegex := regexp.MustCompile(`<rcv>([^<]+)</rcv>`)
-	if match := rstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmRstRcvdRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.RST_Rcvd = strings.TrimSpace(match[1])
 	}
 
+	// Serial number sent; N1MM sends 0 in contests without one
+	if match := n1mmSentNrRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.SerialSent, _ = strconv.Atoi(match[1])
+	}
+
 	// Extract timestamp if available (try both attribute and element formats)
 	var timestampStr string
 
 	// Try attribute format first: timestamp="2025-11-19 01:36:37"
-	timestampAttrRegex := regexp.MustCompile(`timestamp="([^"]+)"`)
-	if match := timestampAttrRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := n1mmTimestampAttrRegex.FindStringSubmatch(message); len(match) > 1 {
 		timestampStr = match[1]
 	}
 
 	// Try element format: <timestamp>2025-11-19 01:36:37</timestamp>
 	if timestampStr == "" {
-		timestampElemRegex := regexp.MustCompile(`<timestamp>([^<]+)</timestamp>`)
-		if match := timestampElemRegex.FindStringSubmatch(message); len(match) > 1 {
+		if match := n1mmTimestampElemRegex.FindStringSubmatch(message); len(match) > 1 {
 			timestampStr = strings.TrimSpace(match[1])
 		}
 	}
 
 	// Parse the timestamp if found
 	if timestampStr != "" {
-		// N1MM sends timestamps in UTC, so we need to parse them in UTC location
-		if t, err := time.ParseInLocation("2006-01-02 15:04:05", timestampStr, time.UTC); err == nil {
+		// N1MM normally sends timestamps in UTC, but a station whose PC clock is
+		// set to local time can be configured with its own time zone
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", timestampStr, f.sourceLocation(MessageTypeN1MM)); err == nil {
 			qso.DateTime = t
 		} else if t, err := time.Parse("2006-01-02T15:04:05Z", timestampStr); err == nil {
 			qso.DateTime = t
 		}
 	}
 
-	// Extract exchange information
-	exchangeRegex := regexp.MustCompile(`<exchange1?>([^<]+)</exchange1?>`)
-	if match := exchangeRegex.FindStringSubmatch(message); len(match) > 1 {
-		qso.Exchange = strings.TrimSpace(match[1])
+	// The call this contact was made under
+	if match := n1mmMyCallRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.MyCall = strings.ToUpper(strings.TrimSpace(match[1]))
 	}
 
-	// If we have frequency but no band, derive the band
-	if qso.Frequency != "" && qso.Band == "" {
-		if freq, err := strconv.ParseFloat(qso.Frequency, 64); err == nil {
-			qso.Band = FrequencyToBand(freq)
-		}
+	// Which operator and which networked computer logged it, for multi-op
+	// stations
+	if match := n1mmOperatorRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.Operator = strings.ToUpper(strings.TrimSpace(match[1]))
+	}
+	if match := n1mmStationNameRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.StationName = strings.TrimSpace(match[1])
+	}
+	if match := n1mmNetBiosNameRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.NetBiosName = strings.TrimSpace(match[1])
 	}
 
-	// Set default RST if not provided
-	if qso.RST_Sent == "" {
-		qso.RST_Sent = "599"
+	// Extract exchange information
+	if match := n1mmExchangeRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.Exchange = strings.TrimSpace(match[1])
 	}
-	if qso.RST_Rcvd == "" {
-		qso.RST_Rcvd = "599"
+
+	// N1MM reports whole-number frequencies in tens of Hz (1402500 = 14.025 MHz)
+	normalizeFrequency(qso, 10)
+
+	// Edits and deletions in N1MM's log name the contact by its ID
+	if match := n1mmIDRegex.FindStringSubmatch(message); len(match) > 1 {
+		qso.ID = strings.TrimSpace(match[1])
 	}
+	qso.Action = n1mmAction(message)
 
 	if qso.Callsign == "" {
 		return nil, fmt.Errorf("no callsign found in N1MM message: %s", message)
 	}
+	if qso.Action != ActionLog && qso.ID == "" {
+		return nil, fmt.Errorf("N1MM contact%s message without an ID", qso.Action)
+	}
 
 	return qso, nil
 }
@@ -664,32 +1033,28 @@ func (f *Formatter) parseGeneral(message string) (*QSO, error) {
 	// Simple regex-based parsing for common formats
 	// This is a fallback parser that tries to extract basic information
 
-	qso := &QSO{
-		DateTime: time.Now(),
-		Mode:     "DATA", // Default mode
-	}
+	qso := newQSO()
+	qso.Mode = "DATA" // Default mode
 
 	// Look for callsign pattern (basic ham radio callsign regex)
-	callRegex := regexp.MustCompile(`\b([A-Z0-9]{1,3}[0-9][A-Z0-9]{0,3}[A-Z])\b`)
-	if match := callRegex.FindStringSubmatch(message); len(match) > 1 {
-		qso.Callsign = match[1]
-	}
+	// Skip grid squares and words like TEST73 that merely look like callsigns
+	qso.Callsign = findCallsign(generalCallRegex, message)
 
 	// Look for frequency (MHz format)
-	freqRegex := regexp.MustCompile(`(\d+\.?\d*)\s*MHz`)
-	if match := freqRegex.FindStringSubmatch(message); len(match) > 1 {
-		qso.Frequency = match[1]
+	if match := generalFreqRegex.FindStringSubmatch(message); len(match) > 1 {
+		if mhz, err := strconv.ParseFloat(match[1], 64); err == nil {
+			qso.FrequencyHz = int64(mhz*1e6 + 0.5)
+			qso.Frequency = FormatMHz(qso.FrequencyHz)
+		}
 	}
 
 	// Look for band
-	bandRegex := regexp.MustCompile(`(\d+)m\b`)
-	if match := bandRegex.FindStringSubmatch(message); len(match) > 1 {
+	if match := generalBandRegex.FindStringSubmatch(message); len(match) > 1 {
 		qso.Band = match[1] + "m"
 	}
 
 	// Look for mode
-	modeRegex := regexp.MustCompile(`\b(FT8|FT4|PSK31|RTTY|CW|SSB|LSB|USB|AM|FM)\b`)
-	if match := modeRegex.FindStringSubmatch(strings.ToUpper(message)); len(match) > 1 {
+	if match := generalModeRegex.FindStringSubmatch(strings.ToUpper(message)); len(match) > 1 {
 		qso.Mode = match[1]
 	}
 
@@ -721,6 +1086,20 @@ func FrequencyToBand(freqMHz float64) string {
 		return "2m"
 	case freqMHz >= 420.0 && freqMHz <= 450.0:
 		return "70cm"
+	case freqMHz >= 902.0 && freqMHz <= 928.0:
+		return "33cm"
+	case freqMHz >= 1240.0 && freqMHz <= 1300.0:
+		return "23cm"
+	case freqMHz >= 2300.0 && freqMHz <= 2450.0:
+		return "13cm"
+	case freqMHz >= 3300.0 && freqMHz <= 3500.0:
+		return "9cm"
+	case freqMHz >= 5650.0 && freqMHz <= 5925.0:
+		return "6cm"
+	case freqMHz >= 10000.0 && freqMHz <= 10500.0:
+		return "3cm"
+	case freqMHz >= 24000.0 && freqMHz <= 24250.0:
+		return "1.25cm"
 	default:
 		return "UNK"
 	}
@@ -1,6 +1,8 @@
 package formatter
 
 import (
+	"errors"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -14,7 +16,8 @@ func TestDetectMessageType(t *testing.T) {
 		expected MessageType
 	}{
 		{"<call:6>VK1ABC<mode:3>FT8<eor>", MessageTypeWSJTX},
-		{"WSJT-X message here", MessageTypeWSJTX},
+		{"<programid:6>WSJT-X <adif_ver:5>3.1.0", MessageTypeWSJTX},
+		{"WSJT-X message here", MessageTypeGeneral},
 		{"fldigi message", MessageTypeFldigi},
 		{"js8call data", MessageTypeJS8Call},
 		{`{"app":"VarAC","call":"W1ABC"}`, MessageTypeVarAC},
@@ -36,6 +39,67 @@ func TestDetectMessageType(t *testing.T) {
 	}
 }
 
+func TestDetectRules(t *testing.T) {
+	jsonQSO := `{"call":"W1ABC","freq":"14.074","app":"GridTracker"}`
+
+	formatter := New("TEST", "OP", "GENERAL")
+	if msgType, rule := formatter.Detect(jsonQSO); msgType != MessageTypeVarAC || rule != "varac-json" {
+		t.Fatalf("Detect = %s, %s; expected the built-in varac-json rule", msgType, rule)
+	}
+
+	rules, err := BuildDetectRules([]CustomDetectRule{
+		// Replaces the built-in rule in place
+		{Name: "varac-json", Type: "varac", Contains: []string{`"call"`}, Regex: `"app"\s*:\s*"varac"`},
+		// Checked ahead of all built-in rules
+		{Name: "logger32", Type: "fldigi", ContainsAny: []string{"LOGGER32"}},
+		// Checked just before the WSJT-X ADIF rule
+		{Name: "gridtracker", Type: "general", Contains: []string{"gridtracker"}, Before: "wsjtx-adif"},
+		{Name: "magic", Type: "n1mm", Magic: "ca fe"},
+	}, []string{"js8call"})
+	if err != nil {
+		t.Fatalf("BuildDetectRules failed: %v", err)
+	}
+	formatter.SetOptions(Options{DetectRules: rules})
+
+	tests := []struct {
+		message string
+		msgType MessageType
+		rule    string
+	}{
+		{jsonQSO, MessageTypeGeneral, "gridtracker"},
+		{`{"app":"VarAC","call":"W1ABC","freq":"14.105"}`, MessageTypeVarAC, "varac"},
+		{"logger32 fldigi-style <CALL:4>W1AW", MessageTypeFldigi, "logger32"},
+		{"\xca\xfe<call>W1AW</call>", MessageTypeN1MM, "magic"},
+		{"<call:6>VK1ABC<mode:3>FT8<eor>", MessageTypeWSJTX, "wsjtx-adif"},
+		{"js8call data", MessageTypeGeneral, ""},
+	}
+	for _, test := range tests {
+		if msgType, rule := formatter.Detect(test.message); msgType != test.msgType || rule != test.rule {
+			t.Errorf("Detect(%q) = %s, %q; expected %s, %q", test.message, msgType, rule, test.msgType, test.rule)
+		}
+	}
+	if rules[0].Name != "logger32" {
+		t.Errorf("Expected custom rules first, got %s", rules[0].Name)
+	}
+
+	for _, bad := range []CustomDetectRule{
+		{Type: "fldigi", ContainsAny: []string{"x"}},
+		{Name: "x", Type: "nope", ContainsAny: []string{"x"}},
+		{Name: "x", Type: "fldigi"},
+		{Name: "x", Type: "fldigi", Regex: "("},
+		{Name: "x", Type: "fldigi", Magic: "zz"},
+		{Name: "x", Type: "fldigi", ContainsAny: []string{"x"}, Before: "nope"},
+		{Name: "fldigi", Type: "fldigi", ContainsAny: []string{"x"}, Before: "n1mm"},
+	} {
+		if _, err := BuildDetectRules([]CustomDetectRule{bad}, nil); err == nil {
+			t.Errorf("Expected error for rule %+v", bad)
+		}
+	}
+	if _, err := BuildDetectRules(nil, []string{"nope"}); err == nil {
+		t.Error("Expected error for unknown disabled rule")
+	}
+}
+
 func TestParseWSJTX(t *testing.T) {
 	formatter := New("TEST", "OP", "GENERAL")
 
@@ -127,6 +191,312 @@ func TestFormatForN1MM(t *testing.T) {
 	}
 }
 
+func TestN1MMNetwork(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "TEST-CONTEST")
+	qso := &QSO{Callsign: "VK1ABC", Mode: "FT8", DateTime: time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC)}
+
+	// Without a network identity the station callsign names the computer
+	output, _ := formatter.FormatForN1MM(qso)
+	for _, element := range []string{"<StationName>W1AW</StationName>", "<NetBiosName></NetBiosName>", "<radionr>1</radionr>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("default output missing %s: %s", element, output)
+		}
+	}
+
+	formatter.SetOptions(Options{Network: N1MMNetwork{StationName: "RUN-PC", RadioNr: 2}})
+	output, _ = formatter.FormatForN1MM(qso)
+	for _, element := range []string{"<StationName>RUN-PC</StationName>", "<NetBiosName>RUN-PC</NetBiosName>", "<radionr>2</radionr>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("configured output missing %s: %s", element, output)
+		}
+	}
+
+	// A source override on the QSO wins
+	qso.StationName, qso.NetBiosName, qso.RadioNr = "MULT-PC", "MULTPC01", 1
+	output, _ = formatter.FormatForN1MM(qso)
+	for _, element := range []string{"<StationName>MULT-PC</StationName>", "<NetBiosName>MULTPC01</NetBiosName>", "<radionr>1</radionr>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("override output missing %s: %s", element, output)
+		}
+	}
+
+	output, _ = formatter.FormatAppInfo()
+	if !strings.Contains(output, "<StationName>RUN-PC</StationName>") || !strings.Contains(output, "<RadioNr>2</RadioNr>") {
+		t.Errorf("AppInfo should carry the network identity: %s", output)
+	}
+}
+
+func TestN1MMApp(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "TEST-CONTEST")
+	qso := &QSO{Callsign: "VK1ABC", Mode: "FT8", ID: NewQSOID(), DateTime: time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC)}
+	if len(qso.ID) != 32 || qso.ID == NewQSOID() {
+		t.Fatalf("QSO IDs should be unique 32-digit GUIDs, got %q", qso.ID)
+	}
+
+	// IDs are only sent when enabled
+	output, _ := formatter.FormatForN1MM(qso)
+	if !strings.Contains(output, "<ID></ID>") {
+		t.Errorf("ID sent without send_id: %s", output)
+	}
+
+	formatter.SetOptions(Options{App: N1MMApp{Name: "Relay {version}", Version: "1.4.0", SendID: true}})
+	output, _ = formatter.FormatForN1MM(qso)
+	for _, element := range []string{"<app>Relay 1.4.0</app>", "<ID>" + qso.ID + "</ID>"} {
+		if !strings.Contains(output, element) {
+			t.Errorf("output missing %s: %s", element, output)
+		}
+	}
+	if !formatter.IsRelayOutput(output) {
+		t.Error("output with a configured app name not recognized as the relay's")
+	}
+	if output, _ = formatter.FormatAppInfo(); !strings.Contains(output, "<app>Relay 1.4.0</app>") {
+		t.Errorf("AppInfo should carry the app name: %s", output)
+	}
+}
+
+func TestN1MMEdits(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "TEST-CONTEST")
+	id := NewQSOID()
+	qso := &QSO{Callsign: "VK1ABD", Mode: "FT8", Band: "20m", ID: id, Action: ActionReplace,
+		DateTime: time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC)}
+
+	// Corrections always carry the ID, even without send_id
+	output, err := formatter.FormatForN1MM(qso)
+	if err != nil {
+		t.Fatalf("FormatForN1MM failed: %v", err)
+	}
+	if !strings.HasPrefix(output, "<contactreplace><app>") || !strings.Contains(output, "<ID>"+id+"</ID>") ||
+		!strings.HasSuffix(output, "</contactreplace>") {
+		t.Errorf("Expected contactreplace with ID: %s", output)
+	}
+
+	qso.Action = ActionDelete
+	output, _ = formatter.FormatForN1MM(qso)
+	want := "<contactdelete><app>N7AKG-UDP-Translator</app><timestamp>2023-10-12 14:30:00</timestamp><call>VK1ABD</call>" +
+		"<contestnr>0</contestnr><StationName>W1AW</StationName><ID>" + id + "</ID></contactdelete>"
+	if output != want {
+		t.Errorf("contactdelete =\n%s\nwant\n%s", output, want)
+	}
+
+	// Only N1MM and relay targets understand changes
+	if _, err := formatter.Format(qso, OutputFormatADIF); err == nil {
+		t.Error("Expected ADIF output of a deletion to fail")
+	}
+	formatter.SetOptions(Options{NodeID: "site-a"})
+	output, err = formatter.Format(qso, OutputFormatRelay)
+	if err != nil {
+		t.Fatalf("relay output failed: %v", err)
+	}
+	central := New("W1AW", "K1ABC", "TEST-CONTEST")
+	central.SetOptions(Options{NodeID: "central"})
+	chained, err := central.ParseMessage(output, MessageTypeRelay)
+	if err != nil || chained.Action != ActionDelete || chained.ID != id {
+		t.Errorf("chained deletion = %+v, %v", chained, err)
+	}
+
+	// N1MM's own edits and deletions
+	parsed, err := formatter.ParseMessage(`<contactreplace><app>N1MM</app><timestamp>2023-10-12 14:30:00</timestamp><call>VK1ABD</call><band>20</band><rxfreq>1407400</rxfreq><mode>FT8</mode><ID>`+id+`</ID></contactreplace>`, MessageTypeN1MM)
+	if err != nil || parsed.Action != ActionReplace || parsed.ID != id || parsed.Callsign != "VK1ABD" {
+		t.Errorf("contactreplace parsed as %+v, %v", parsed, err)
+	}
+	parsed, err = formatter.ParseMessage(want, MessageTypeN1MM)
+	if err != nil || parsed.Action != ActionDelete || parsed.ID != id {
+		t.Errorf("contactdelete parsed as %+v, %v", parsed, err)
+	}
+	if _, err := formatter.ParseMessage(`<contactdelete><call>VK1ABD</call></contactdelete>`, MessageTypeN1MM); err == nil {
+		t.Error("Expected a contactdelete without an ID to be rejected")
+	}
+	if msgType, _ := formatter.Detect(want); msgType != MessageTypeN1MM {
+		t.Errorf("contactdelete detected as %s", msgType)
+	}
+}
+
+func TestXMLStyle(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "TEST-CONTEST")
+	qso := &QSO{Callsign: "VK1ABC", Mode: "FT8", DateTime: time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC)}
+
+	// Default: compact, no declaration, N1MM's element order
+	output, err := formatter.FormatForN1MM(qso)
+	if err != nil {
+		t.Fatalf("FormatForN1MM failed: %v", err)
+	}
+	if strings.Contains(output, "\n") || strings.HasPrefix(output, "<?xml") {
+		t.Errorf("Expected compact XML without declaration: %s", output)
+	}
+	if !strings.HasPrefix(output, "<contactinfo><app>N7AKG-UDP-Translator</app><contestname>TEST-CONTEST</contestname><contestnr>0</contestnr><timestamp>") {
+		t.Errorf("Expected N1MM element order: %s", output)
+	}
+	if !strings.Contains(output, "<ismultiplier1>0</ismultiplier1>") || !formatter.IsRelayOutput(output) {
+		t.Errorf("Expected N1MM element names: %s", output)
+	}
+
+	formatter.SetOptions(Options{XML: XMLStyle{Indent: true, Declaration: true}})
+	output, _ = formatter.FormatForN1MM(qso)
+	if !strings.HasPrefix(output, `<?xml version="1.0" encoding="utf-8"?>`+"\n<contactinfo>\n  <app>") {
+		t.Errorf("Expected declaration and indented XML: %s", output)
+	}
+
+	formatter.SetOptions(Options{XML: XMLStyle{LegacyOrder: true}})
+	output, _ = formatter.FormatForN1MM(qso)
+	if !strings.HasPrefix(output, `<contactinfo app="N7AKG-UDP-Translator"><contestname>`) || !formatter.IsRelayOutput(output) {
+		t.Errorf("Expected legacy layout: %s", output)
+	}
+}
+
+func TestTextLog(t *testing.T) {
+	textLog, err := CompileTextLog("{date} {time} {call} {freq} {mode} {rst_sent} {rst_rcvd} {comment}")
+	if err != nil {
+		t.Fatalf("CompileTextLog failed: %v", err)
+	}
+	formatter := New("TEST", "OP", "GENERAL")
+	formatter.SetOptions(Options{TextLog: textLog})
+
+	line := "2024-06-01  1502Z  dl1xyz 14070.15 psk31 599 579 nice signal, 73"
+	if msgType := formatter.DetectMessageType(line); msgType != MessageTypeTextLog {
+		t.Fatalf("Expected %s, got %s", MessageTypeTextLog, msgType)
+	}
+
+	qso, err := formatter.ParseMessage(line, MessageTypeTextLog)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Callsign != "DL1XYZ" || qso.Mode != "PSK31" || qso.Band != "20m" || qso.FrequencyHz != 14070150 {
+		t.Errorf("Unexpected QSO: %+v", qso)
+	}
+	if qso.RST_Sent != "599" || qso.RST_Rcvd != "579" || qso.Comment != "nice signal, 73" {
+		t.Errorf("Unexpected reports or comment: %+v", qso)
+	}
+	if want := time.Date(2024, 6, 1, 15, 2, 0, 0, time.UTC); !qso.DateTime.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, qso.DateTime)
+	}
+
+	// Delimiters other than spaces are matched literally
+	textLog, err = CompileTextLog("{call};{skip};{mode};{freq}")
+	if err != nil {
+		t.Fatalf("CompileTextLog failed: %v", err)
+	}
+	formatter.SetOptions(Options{TextLog: textLog})
+	qso, err = formatter.ParseMessage("W1AW;MixW 2.20;RTTY;7.045", MessageTypeTextLog)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Callsign != "W1AW" || qso.Mode != "RTTY" || qso.Band != "40m" {
+		t.Errorf("Unexpected QSO: %+v", qso)
+	}
+	if formatter.DetectMessageType("W1AW 7.045 RTTY") == MessageTypeTextLog {
+		t.Error("Line without the delimiters should not be detected as a text log")
+	}
+
+	for _, bad := range []string{"", "{freq} {mode}", "{call} {power}", "{call}{freq}"} {
+		if _, err := CompileTextLog(bad); err == nil {
+			t.Errorf("CompileTextLog(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMacLoggers(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+
+	tests := []struct {
+		name    string
+		message string
+		msgType MessageType
+		want    QSO
+	}{
+		{
+			"MacLoggerDX plist",
+			`<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>
+<key>app</key><string>MacLoggerDX</string>
+<key>call</key><string>ja1abc</string>
+<key>frequency</key><real>21.074</real>
+<key>mode</key><string>FT8</string>
+<key>RST Sent</key><string>-10</string>
+<key>RST Rcvd</key><string>-15</string>
+<key>QSO Start</key><date>2024-06-01T15:02:30Z</date>
+<key>confirmed</key><false/>
+</dict></plist>`,
+			MessageTypeMacLoggerDX,
+			QSO{Callsign: "JA1ABC", FrequencyHz: 21074000, Band: "15m", Mode: "FT8", RST_Sent: "-10", RST_Rcvd: "-15",
+				DateTime: time.Date(2024, 6, 1, 15, 2, 30, 0, time.UTC)},
+		},
+		{
+			"RUMlogNG JSON",
+			`{"app":"RUMlogNG","qso":{"callsign":"EA8XYZ","freq":"7.0255","band":"40M","mode":"CW","rst_sent":"599","rst_rcvd":"579","qso_date":"20240601","time_on":"2130","comment":"QRP"}}`,
+			MessageTypeRUMlog,
+			QSO{Callsign: "EA8XYZ", FrequencyHz: 7025500, Band: "40m", Mode: "CW", RST_Sent: "599", RST_Rcvd: "579", Comment: "QRP",
+				DateTime: time.Date(2024, 6, 1, 21, 30, 0, 0, time.UTC)},
+		},
+		{
+			"RUMlogNG ADIF",
+			`RUMlogNG <CALL:5>K1ABC<FREQ:6>14.025<MODE:2>CW<QSO_DATE:8>20240601<TIME_ON:4>1200<EOR>`,
+			MessageTypeRUMlog,
+			QSO{Callsign: "K1ABC", FrequencyHz: 14025000, Band: "20m", Mode: "CW", RST_Sent: "599", RST_Rcvd: "599",
+				DateTime: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msgType := formatter.DetectMessageType(tt.message); msgType != tt.msgType {
+				t.Fatalf("Expected %s, got %s", tt.msgType, msgType)
+			}
+			qso, err := formatter.ParseMessage(tt.message, tt.msgType)
+			if err != nil {
+				t.Fatalf("ParseMessage failed: %v", err)
+			}
+			if qso.Callsign != tt.want.Callsign || qso.FrequencyHz != tt.want.FrequencyHz || qso.Band != tt.want.Band ||
+				qso.Mode != tt.want.Mode || qso.RST_Sent != tt.want.RST_Sent || qso.RST_Rcvd != tt.want.RST_Rcvd ||
+				qso.Comment != tt.want.Comment || !qso.DateTime.Equal(tt.want.DateTime) {
+				t.Errorf("Expected %+v, got %+v", tt.want, *qso)
+			}
+		})
+	}
+}
+
+func TestJTAlert(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+	want := QSO{Callsign: "VK2ABC", FrequencyHz: 14074000, Band: "20m", Mode: "FT8", RST_Sent: "-08", RST_Rcvd: "-12",
+		DateTime: time.Date(2024, 6, 1, 8, 15, 0, 0, time.UTC)}
+	adif := `<CALL:6>VK2ABC<BAND:3>20m<MODE:3>FT8<FREQ:9>14.074512<RST_SENT:3>-08<RST_RCVD:3>-12<QSO_DATE:8>20240601<TIME_ON:6>081500<EOR>`
+
+	for name, message := range map[string]string{
+		"bare ADIF":    `<PROGRAMID:7>JTAlert` + adif,
+		"escaped ADIF": `<?xml version="1.0" encoding="utf-8"?><JTAlert><LastQSO><ADIF>` + strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace(adif) + `</ADIF></LastQSO></JTAlert>`,
+		"CDATA ADIF":   `<JTAlert><LastQSO><ADIF><![CDATA[` + adif + `]]></ADIF></LastQSO></JTAlert>`,
+		"XML fields":   `<JTAlert><LastQSO><Call>VK2ABC</Call><Frequency>14.074512</Frequency><Mode>FT8</Mode><RstSent>-08</RstSent><RstRcvd>-12</RstRcvd><QsoDate>20240601</QsoDate><TimeOn>081500</TimeOn></LastQSO></JTAlert>`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if msgType := formatter.DetectMessageType(message); msgType != MessageTypeJTAlert {
+				t.Fatalf("Expected jtalert, got %s", msgType)
+			}
+			qso, err := formatter.ParseMessage(message, MessageTypeJTAlert)
+			if err != nil {
+				t.Fatalf("ParseMessage failed: %v", err)
+			}
+			if qso.Callsign != want.Callsign || qso.Band != want.Band || qso.Mode != want.Mode ||
+				qso.RST_Sent != want.RST_Sent || qso.RST_Rcvd != want.RST_Rcvd || !qso.DateTime.Equal(want.DateTime) {
+				t.Errorf("Expected %+v, got %+v", want, *qso)
+			}
+		})
+	}
+
+	station := `<?xml version="1.0" encoding="utf-8"?><JTAlert><Station><MyCall>n7akg</MyCall><MyGrid>CN87ts</MyGrid><Band>20m</Band><Mode>FT8</Mode><DialFreq>14.074</DialFreq></Station></JTAlert>`
+	if !IsJTAlertStation(station) {
+		t.Fatal("station broadcast not recognized")
+	}
+	if _, err := formatter.ParseMessage(station, MessageTypeJTAlert); err == nil {
+		t.Error("expected the station broadcast not to parse as a QSO")
+	}
+	info, err := ParseJTAlertStation(station)
+	if err != nil {
+		t.Fatalf("ParseJTAlertStation failed: %v", err)
+	}
+	if info.Call != "N7AKG" || info.Grid != "CN87ts" || info.Band != "20m" || info.Mode != "FT8" || info.Frequency != "14.074" {
+		t.Errorf("station = %+v", *info)
+	}
+}
+
 func TestFrequencyToBand(t *testing.T) {
 	tests := []struct {
 		freq float64
@@ -224,6 +594,49 @@ func TestParseVarAC(t *testing.T) {
 	}
 }
 
+func TestVarACEvents(t *testing.T) {
+	formatter := New("N7AKG", "N7AKG", "GENERAL")
+
+	for _, tc := range []struct {
+		message string
+		event   string
+		call    string
+	}{
+		{`{"app":"VarAC","type":"beacon","call":"W1ABC","freq":"14.105","mode":"VARA HF"}`, VarACBeacon, "W1ABC"},
+		{`{"app":"VarAC","event":"CQ","call":"EA1ABC","freq":"7.105"}`, VarACCQ, "EA1ABC"},
+		{"VarAC ping from VK2XYZ to N7AKG on 14.105 VARA HF", VarACPing, "VK2XYZ"},
+		{"VarAC CQ de G4ABC @ 14.105", VarACCQ, "G4ABC"},
+		{"QSO with VK2XYZ on 14.105 VARA after a CQ", "", "VK2XYZ"},
+		{`{"app":"VarAC","call":"W1ABC","freq":"14.105"}`, "", "W1ABC"},
+	} {
+		qso, err := formatter.parseVarAC(tc.message)
+		if err != nil {
+			t.Errorf("parseVarAC(%q) failed: %v", tc.message, err)
+			continue
+		}
+		if qso.Event != tc.event || qso.Callsign != tc.call || (tc.event != "") != (qso.Action == ActionSpot) {
+			t.Errorf("parseVarAC(%q) = event %q, call %s, action %q; want event %q, call %s",
+				tc.message, qso.Event, qso.Callsign, qso.Action, tc.event, tc.call)
+		}
+	}
+
+	spot := &QSO{Callsign: "W1ABC", FrequencyHz: 14105000, Mode: "VARA HF", Action: ActionSpot, Event: VarACBeacon,
+		Comment: "VarAC beacon", DateTime: time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC)}
+	output, err := formatter.Format(spot, OutputFormatN1MM)
+	if err != nil {
+		t.Fatalf("Format spot failed: %v", err)
+	}
+	for _, want := range []string{"<spot><app>", "<dxcall>W1ABC</dxcall><frequency>14105.0</frequency><spottercall>N7AKG</spottercall>",
+		"<comment>VarAC beacon</comment><action>add</action><mode>VARA HF</mode>", "<timestamp>2023-10-12 14:30:00</timestamp></spot>"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("spot missing %q: %s", want, output)
+		}
+	}
+	if _, err := formatter.Format(spot, OutputFormatADIF); err == nil {
+		t.Error("Expected ADIF output to refuse a spot")
+	}
+}
+
 func TestParseN1MM(t *testing.T) {
 	formatter := New("TEST", "OP", "GENERAL")
 
@@ -324,3 +737,1115 @@ func TestParseN1MM(t *testing.T) {
 		t.Errorf("Expected formatted XML to contain UTC timestamp '2025-11-19 01:36:37', got: %s", formattedXML)
 	}
 }
+
+func TestSourceTimezones(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+
+	eastern, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	formatter.SetOptions(Options{
+		SourceTimezones: map[MessageType]*time.Location{MessageTypeN1MM: eastern},
+		OutputUTC:       true,
+	})
+
+	// N1MM PC logging local (EST) time
+	message := `<contactinfo timestamp="2025-11-19 01:36:37"><call>WB4WOJ</call><mode>CW</mode></contactinfo>`
+	qso, err := formatter.ParseMessage(message, MessageTypeN1MM)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	expectedTime := time.Date(2025, 11, 19, 6, 36, 37, 0, time.UTC)
+	if !qso.DateTime.Equal(expectedTime) {
+		t.Errorf("Expected timestamp %v, got %v", expectedTime, qso.DateTime.UTC())
+	}
+
+	formattedXML, err := formatter.FormatForN1MM(qso)
+	if err != nil {
+		t.Fatalf("FormatForN1MM failed: %v", err)
+	}
+	if !strings.Contains(formattedXML, "2025-11-19 06:36:37") {
+		t.Errorf("Expected UTC timestamp in output, got: %s", formattedXML)
+	}
+
+	// ADIF sources without an entry remain UTC
+	adif := "<call:6>VK1ABC<mode:3>FT8<qso_date:8>20231012<time_on:6>123000<eor>"
+	qso2, err := formatter.ParseMessage(adif, MessageTypeWSJTX)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if !qso2.DateTime.Equal(time.Date(2023, 10, 12, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected WSJT-X timestamp to stay UTC, got %v", qso2.DateTime)
+	}
+}
+
+func TestUseReceiveTime(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+	formatter.SetOptions(Options{UseReceiveTime: true})
+
+	adif := "<call:6>VK1ABC<mode:3>FT8<qso_date:8>20001012<time_on:6>123000<eor>"
+	before := time.Now()
+	qso, err := formatter.ParseMessage(adif, MessageTypeWSJTX)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	if qso.DateTime.Before(before.Add(-time.Second)) {
+		t.Errorf("Expected receive time, got message time %v", qso.DateTime)
+	}
+}
+
+func TestReportRules(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+	formatter.SetOptions(Options{
+		RSTDefaults:        map[string]string{"RTTY": "59"},
+		NormalizeDBReports: true,
+	})
+
+	tests := []struct {
+		message string
+		msgType MessageType
+		rstSent string
+		rstRcvd string
+	}{
+		{`<contactinfo><call>JA1ABC</call><mode>SSB</mode></contactinfo>`, MessageTypeN1MM, "59", "59"},
+		{`<contactinfo><call>JA1ABC</call><mode>CW</mode></contactinfo>`, MessageTypeN1MM, "599", "599"},
+		{`<contactinfo><call>JA1ABC</call><mode>RTTY</mode></contactinfo>`, MessageTypeN1MM, "59", "59"},
+		{"<call:6>VK1ABC<mode:3>FT8<rst_sent:2>-5<rst_rcvd:1>7<eor>", MessageTypeWSJTX, "-05", "+07"},
+		{"<call:6>VK1ABC<mode:3>FT8<eor>", MessageTypeWSJTX, "+00", "+00"},
+	}
+
+	for _, test := range tests {
+		qso, err := formatter.ParseMessage(test.message, test.msgType)
+		if err != nil {
+			t.Fatalf("ParseMessage(%s) failed: %v", test.message, err)
+		}
+		if qso.RST_Sent != test.rstSent || qso.RST_Rcvd != test.rstRcvd {
+			t.Errorf("ParseMessage(%s) reports = %s/%s; expected %s/%s",
+				test.message, qso.RST_Sent, qso.RST_Rcvd, test.rstSent, test.rstRcvd)
+		}
+	}
+}
+
+func TestSNRReports(t *testing.T) {
+	qso := &QSO{Callsign: "VK1ABC", Mode: "FT8", RST_Sent: "-05", RST_Rcvd: "+03", Comment: "73"}
+
+	if got := ConvertSNRReports(qso, SNRKeep); got != qso {
+		t.Error("keep should leave the QSO as it is")
+	}
+
+	got := ConvertSNRReports(qso, SNRAsRST)
+	if got.RST_Sent != "599" || got.RST_Rcvd != "599" || got.Comment != "73" {
+		t.Errorf("rst style = %s/%s %q", got.RST_Sent, got.RST_Rcvd, got.Comment)
+	}
+	if qso.RST_Sent != "-05" {
+		t.Error("conversion modified the shared QSO")
+	}
+
+	got = ConvertSNRReports(qso, SNRInComment)
+	if got.RST_Sent != "599" || got.Comment != "73 SNR sent -05 rcvd +03" {
+		t.Errorf("comment style = %s %q", got.RST_Sent, got.Comment)
+	}
+
+	// RST reports, and unsigned numbers outside dB modes, are not SNR
+	for _, q := range []*QSO{
+		{Callsign: "K1ABC", Mode: "CW", RST_Sent: "579", RST_Rcvd: "5"},
+		{Callsign: "K1ABC", Mode: "FT8", RST_Sent: "599", RST_Rcvd: "599"},
+	} {
+		if ConvertSNRReports(q, SNRInComment) != q {
+			t.Errorf("%s reports %s/%s should not be converted", q.Mode, q.RST_Sent, q.RST_Rcvd)
+		}
+	}
+	if got := ConvertSNRReports(&QSO{Mode: "FT8", RST_Sent: "7", RST_Rcvd: "599"}, SNRAsRST); got.RST_Sent != "599" {
+		t.Errorf("unsigned FT8 report not converted: %s", got.RST_Sent)
+	}
+
+	if !ValidSNRReportStyle("comment") || !ValidSNRReportStyle("keep") || ValidSNRReportStyle("db") {
+		t.Error("ValidSNRReportStyle")
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "TEST-CONTEST")
+
+	qso := &QSO{
+		Callsign:  "VK1ABC",
+		Frequency: "14.074",
+		Mode:      "FT8",
+		RST_Sent:  "-05",
+		RST_Rcvd:  "-12",
+		DateTime:  time.Date(2023, 10, 12, 14, 30, 0, 0, time.UTC),
+		Band:      "20m",
+	}
+
+	adif, err := formatter.Format(qso, OutputFormatDXLog)
+	if err != nil {
+		t.Fatalf("Format(dxlog) failed: %v", err)
+	}
+	for _, field := range []string{"<CALL:6>VK1ABC", "<QSO_DATE:8>20231012", "<TIME_ON:6>143000", "<MODE:3>FT8", "<FREQ:9>14.074000", "<EOR>"} {
+		if !strings.Contains(adif, field) {
+			t.Errorf("ADIF output should contain %s, got: %s", field, adif)
+		}
+	}
+
+	wt, err := formatter.Format(qso, OutputFormatWinTest)
+	if err != nil {
+		t.Fatalf("Format(wintest) failed: %v", err)
+	}
+	if !strings.HasPrefix(wt, `ADDQSO: "W1AW" "" 1697121000 140740 "20m" "FT8" "VK1ABC"`) {
+		t.Errorf("Unexpected Win-Test output: %q", wt)
+	}
+	if !strings.HasSuffix(wt, "\x00") || wt[len(wt)-2]&0x80 == 0 {
+		t.Errorf("Win-Test output should end with checksum and NUL: %q", wt)
+	}
+
+	if _, err := formatter.Format(qso, "bogus"); err == nil {
+		t.Error("Expected error for unknown output format")
+	}
+}
+
+func TestFormatADIFSubmodeAndBand(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "")
+
+	// N1MM names the band in MHz and WSJT-X logs FT4 as a mode
+	qso := &QSO{Callsign: "DL1XYZ", Frequency: "14.080", Band: "14", Mode: "FT4", DateTime: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	adif, err := formatter.FormatADIF(qso)
+	if err != nil {
+		t.Fatalf("FormatADIF failed: %v", err)
+	}
+	for _, field := range []string{"<BAND:3>20m", "<MODE:4>MFSK", "<SUBMODE:3>FT4"} {
+		if !strings.Contains(adif, field) {
+			t.Errorf("ADIF output should contain %s, got: %s", field, adif)
+		}
+	}
+	if problems := ValidateADIF(adif); len(problems) > 0 {
+		t.Errorf("expected valid ADIF, got %v", problems)
+	}
+
+	qso.Mode = "USB"
+	if adif, _ := formatter.FormatADIF(qso); !strings.Contains(adif, "<MODE:3>SSB <SUBMODE:3>USB") {
+		t.Errorf("USB should be written as SSB/USB, got: %s", adif)
+	}
+}
+
+func TestValidateADIF(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		field  string // Field of the expected problem; empty for a valid record
+	}{
+		{"valid", "<CALL:5>K1ABC <QSO_DATE:8>20240601 <TIME_ON:4>1200 <BAND:3>40m <MODE:2>CW <FREQ:5>7.025 <CQZ:1>5 <APP_N7AKG_RELAY:4>site <EOR>", ""},
+		{"lower case band and type indicator", "<call:5>K1ABC <band:3:E>20M <mode:3>ft8 <eor>", ""},
+		{"length too long", "<CALL:9>K1ABC", "CALL"},
+		{"no call", "<BAND:3>20m <EOR>", "CALL"},
+		{"unknown band", "<CALL:5>K1ABC <BAND:2>14 <EOR>", "BAND"},
+		{"band off frequency", "<CALL:5>K1ABC <BAND:3>40m <FREQ:6>14.025 <EOR>", "BAND"},
+		{"submode as mode", "<CALL:5>K1ABC <MODE:3>FT4 <EOR>", "MODE"},
+		{"submode of another mode", "<CALL:5>K1ABC <MODE:3>FT8 <SUBMODE:3>USB <EOR>", "SUBMODE"},
+		{"unknown mode", "<CALL:5>K1ABC <MODE:4>VARA <EOR>", "MODE"},
+		{"bad date", "<CALL:5>K1ABC <QSO_DATE:8>20241301 <EOR>", "QSO_DATE"},
+		{"bad time", "<CALL:5>K1ABC <TIME_ON:5>12000 <EOR>", "TIME_ON"},
+		{"zone out of range", "<CALL:5>K1ABC <CQZ:2>41 <EOR>", "CQZ"},
+		{"bad grid", "<CALL:5>K1ABC <GRIDSQUARE:4>ZZ99 <EOR>", "GRIDSQUARE"},
+		{"not a number", "<CALL:5>K1ABC <FREQ:4>14.x <EOR>", "FREQ"},
+		{"unknown field", "<CALL:5>K1ABC <MYFIELD:1>x <EOR>", "MYFIELD"},
+	}
+	for _, tt := range tests {
+		problems := ValidateADIF(tt.record)
+		if tt.field == "" {
+			if len(problems) > 0 {
+				t.Errorf("%s: expected no problems, got %v", tt.name, problems)
+			}
+			continue
+		}
+		if len(problems) == 0 || problems[0].Field != tt.field {
+			t.Errorf("%s: expected a problem with %s, got %v", tt.name, tt.field, problems)
+		}
+	}
+}
+
+func TestStrictADIF(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "")
+	qso := &QSO{Callsign: "K1ABC", Frequency: "14.105", Mode: "VARA", DateTime: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	if _, err := formatter.Format(qso, OutputFormatADIF); err != nil {
+		t.Fatalf("without strict the record should be sent: %v", err)
+	}
+
+	formatter.SetOptions(Options{StrictADIF: true})
+	_, err := formatter.Format(qso, OutputFormatADIF)
+	var adifErr *ADIFError
+	if !errors.As(err, &adifErr) || len(adifErr.Problems) != 1 || adifErr.Problems[0].Field != "MODE" {
+		t.Fatalf("expected an ADIFError about MODE, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `MODE "VARA" is not a valid MODE`) {
+		t.Errorf("unexpected report: %v", err)
+	}
+
+	// N1MM output isn't ADIF
+	if _, err := formatter.Format(qso, OutputFormatN1MM); err != nil {
+		t.Errorf("strict ADIF should not affect N1MM output: %v", err)
+	}
+}
+
+func TestParseFrequency(t *testing.T) {
+	tests := []struct {
+		freq string
+		hz   int64
+	}{
+		{"14.074", 14074000},
+		{"144.174", 144174000},
+		{"1296.1", 1296100000},
+		{"14074", 14074000},
+		{"7074.5", 7074500},
+		{"14074000", 14074000},
+		{"50313000", 50313000},
+	}
+
+	for _, test := range tests {
+		hz, err := ParseFrequency(test.freq)
+		if err != nil {
+			t.Errorf("ParseFrequency(%s) failed: %v", test.freq, err)
+			continue
+		}
+		if hz != test.hz {
+			t.Errorf("ParseFrequency(%s) = %d; expected %d", test.freq, hz, test.hz)
+		}
+	}
+
+	if _, err := ParseFrequency("abc"); err == nil {
+		t.Error("Expected error for non-numeric frequency")
+	}
+
+	// MHz whatever the size, as in the ADIF FREQ field
+	for freq, want := range map[string]int64{"14.074": 14074000, "2304.1": 2304100000, "10368.1": 10368100000} {
+		if hz, err := ParseMHz(freq); err != nil || hz != want {
+			t.Errorf("ParseMHz(%s) = %d, %v; expected %d", freq, hz, err, want)
+		}
+	}
+}
+
+func TestFrequencyNormalization(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+
+	// N1MM reports integer frequencies in tens of Hz
+	qso, err := formatter.ParseMessage(`<contactinfo><call>DL1XYZ</call><mode>CW</mode><rxfreq>1402500</rxfreq></contactinfo>`, MessageTypeN1MM)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.FrequencyHz != 14025000 || qso.Frequency != "14.025" || qso.Band != "20m" {
+		t.Errorf("Expected 14025000 Hz / 14.025 / 20m, got %d / %s / %s", qso.FrequencyHz, qso.Frequency, qso.Band)
+	}
+
+	// VarAC in kHz
+	qso2, err := formatter.ParseMessage(`{"app":"VarAC","call":"W1ABC","freq":"7105"}`, MessageTypeVarAC)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso2.FrequencyHz != 7105000 || qso2.Band != "40m" {
+		t.Errorf("Expected 7105000 Hz on 40m, got %d on %s", qso2.FrequencyHz, qso2.Band)
+	}
+
+	// ADIF and WSJT-X frequencies are MHz, up into the microwave bands
+	for _, test := range []struct {
+		message string
+		msgType MessageType
+		hz      int64
+		band    string
+	}{
+		{"<CALL:5>G4ABC<FREQ:6>2304.1<MODE:2>CW<EOR>", MessageTypeFldigi, 2304100000, "13cm"},
+		{"<CALL:5>G4ABC<FREQ:7>10368.1<MODE:2>CW<EOR>", MessageTypeFldigi, 10368100000, "3cm"},
+		{"<call:5>G4ABC <freq:7>10368.1 <mode:3>FT8 <eor>", MessageTypeWSJTX, 10368100000, "3cm"},
+	} {
+		qso, err := formatter.ParseMessage(test.message, test.msgType)
+		if err != nil {
+			t.Fatalf("ParseMessage(%s) failed: %v", test.message, err)
+		}
+		if qso.FrequencyHz != test.hz || qso.Band != test.band {
+			t.Errorf("%s: expected %d Hz on %s, got %d on %s", test.message, test.hz, test.band, qso.FrequencyHz, qso.Band)
+		}
+	}
+
+	// N1MM output uses tens of Hz
+	xml, err := formatter.FormatForN1MM(qso2)
+	if err != nil {
+		t.Fatalf("FormatForN1MM failed: %v", err)
+	}
+	if !strings.Contains(xml, "<rxfreq>710500</rxfreq>") {
+		t.Errorf("Expected rxfreq in tens of Hz, got: %s", xml)
+	}
+}
+
+func TestValidCallsign(t *testing.T) {
+	tests := []struct {
+		call  string
+		valid bool
+	}{
+		{"W1AW", true},
+		{"K1ABC", true},
+		{"2E0ABC", true},
+		{"3D2CR", true},
+		{"VK100ABC", true},
+		{"9A1A", true},
+		{"w1aw/p", true},
+		{"W1ABC/MM", true},
+		{"W1ABC/4", true},
+		{"DL/W1ABC", true},
+		{"VP2E/K1ABC/P", true},
+		{"W1ABC/VE3", true},
+		{"TEST73", false},
+		{"FN42", false},
+		{"FN42AB", false},
+		{"QRZ1A", false},
+		{"W1ABC/XYZZY", false},
+		{"", false},
+		{"/P", false},
+	}
+
+	for _, test := range tests {
+		if result := ValidCallsign(test.call); result != test.valid {
+			t.Errorf("ValidCallsign(%q) = %t; expected %t", test.call, result, test.valid)
+		}
+	}
+}
+
+// TestCallsignITUSeries checks base calls and stroke prefixes against the
+// ITU allocation table
+func TestCallsignITUSeries(t *testing.T) {
+	tests := []struct {
+		call  string
+		valid bool
+	}{
+		{"XX9ABC", true},  // Macao
+		{"E74A", true},    // Bosnia and Herzegovina
+		{"H44MS", true},   // Solomon Islands
+		{"T88XX", true},   // Palau
+		{"V85A", true},    // Brunei
+		{"Z81X", true},    // South Sudan
+		{"K0ABC", true},   // whole letter holders get 0 and 1
+		{"1A0KM", true},   // SMOM, not ITU but a DXCC entity
+		{"S01WS", true},   // Western Sahara, likewise
+		{"Z60A", true},    // Kosovo, likewise
+		{"X5ABC", false},  // no X digit series
+		{"Z9ABC", false},  // Z ends at Z8
+		{"E9ABC", false},  // E ends at E7
+		{"J9ABC", false},  // J ends at J8
+		{"A1ABC", false},  // A digit series start at A2
+		{"1B1ABC", false}, // only 1A and 1S
+		{"0A1ABC", false}, // 0 isn't allocated
+		{"QA1ABC", false}, // Q codes
+		{"F/W1ABC", true}, // whole letter stroke prefix
+		{"VP2E/K1ABC", true},
+		{"X5/W1ABC", false},
+		{"J9/W1ABC", false},
+		{"D/W1ABC", false}, // D isn't held as a whole letter
+		{"W1ABC/Z9", false},
+	}
+
+	for _, test := range tests {
+		if result := ValidCallsign(test.call); result != test.valid {
+			t.Errorf("ValidCallsign(%q) = %t; expected %t", test.call, result, test.valid)
+		}
+	}
+}
+
+func TestRejectInvalidCallsigns(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+
+	// The general parser skips grid squares when looking for a callsign
+	qso, err := formatter.ParseMessage("FN42 TEST73 worked K1ABC on 20m", MessageTypeGeneral)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Callsign != "K1ABC" {
+		t.Errorf("Expected callsign K1ABC, got %s", qso.Callsign)
+	}
+
+	formatter.SetOptions(Options{RejectInvalidCallsigns: true})
+	if _, err := formatter.ParseMessage(`<contactinfo><call>TEST73</call></contactinfo>`, MessageTypeN1MM); err == nil {
+		t.Error("Expected invalid callsign to be rejected")
+	}
+
+	qso2, err := formatter.ParseMessage(`<contactinfo><call> dl1xyz/p </call></contactinfo>`, MessageTypeN1MM)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso2.Callsign != "DL1XYZ/P" {
+		t.Errorf("Expected sanitized callsign DL1XYZ/P, got %s", qso2.Callsign)
+	}
+}
+
+func TestSCPCheck(t *testing.T) {
+	scp := NewSCP([]string{"K1ABC", "K1ABD", "W1AW", "DL1XYZ"})
+	formatter := New("TEST", "OP", "GENERAL")
+	formatter.SetOptions(Options{SCP: scp})
+
+	tests := []struct {
+		call    string
+		comment string
+	}{
+		{"W1AW", ""},
+		{"DL1XYZ/P", ""},
+		{"W1AX", "SCP: W1AX not in MASTER.SCP, check W1AW"},
+		{"K1ABE", "SCP: K1ABE not in MASTER.SCP, check K1ABC K1ABD"},
+		{"JA1ZZZ", ""},
+	}
+
+	for _, test := range tests {
+		qso := &QSO{Callsign: test.call}
+		if err := formatter.Normalize(qso); err != nil {
+			t.Fatalf("Normalize(%s) failed: %v", test.call, err)
+		}
+		if qso.Comment != test.comment {
+			t.Errorf("%s: comment = %q; expected %q", test.call, qso.Comment, test.comment)
+		}
+	}
+
+	formatter.SetOptions(Options{SCP: scp, SCPAutoCorrect: true})
+	qso := &QSO{Callsign: "W1AX"}
+	formatter.Normalize(qso)
+	if qso.Callsign != "W1AW" || qso.Comment != "SCP: corrected from W1AX" {
+		t.Errorf("Expected correction to W1AW, got %s (%q)", qso.Callsign, qso.Comment)
+	}
+
+	// Ambiguous matches are flagged but never corrected
+	qso = &QSO{Callsign: "K1ABE"}
+	formatter.Normalize(qso)
+	if qso.Callsign != "K1ABE" {
+		t.Errorf("Ambiguous callsign should not be corrected, got %s", qso.Callsign)
+	}
+
+	output, _ := formatter.FormatForN1MM(&QSO{Callsign: "W1AW", Comment: "SCP: corrected from W1AX"})
+	if !strings.Contains(output, "<comment>SCP: corrected from W1AX</comment>") {
+		t.Errorf("Expected comment in N1MM output: %s", output)
+	}
+}
+
+func TestSplitRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		calls   []string
+	}{
+		{"single ADIF", "<call:4>W1AW <band:3>20m <eor>", []string{"W1AW"}},
+		{"ADIF batch", "<adif_ver:5>3.1.0 <eoh> <call:4>W1AW <mode:3>FT8 <eor> <call:5>K1ABC <mode:3>FT8 <eor>\n", []string{"W1AW", "K1ABC"}},
+		{"XML documents", `<?xml version="1.0"?><contactinfo><call>DL1XYZ</call></contactinfo><?xml version="1.0"?><contactinfo app="x"><call>G4ABC</call></contactinfo>`, []string{"DL1XYZ", "G4ABC"}},
+		{"JSON array", `[{"call":"W1ABC","freq":"14.105"},{"call":"N7AKG","freq":"7.105"}]`, []string{"W1ABC", "N7AKG"}},
+		{"JSON objects", "{\"call\":\"W1ABC\"}\n{\"call\":\"N7AKG\"}", []string{"W1ABC", "N7AKG"}},
+		{"plain text", "worked K1ABC on 20m", []string{"K1ABC"}},
+	}
+
+	for _, test := range tests {
+		records := SplitRecords(test.message)
+		if len(records) != len(test.calls) {
+			t.Errorf("%s: got %d records, expected %d: %q", test.name, len(records), len(test.calls), records)
+			continue
+		}
+		for i, call := range test.calls {
+			if !strings.Contains(records[i], call) {
+				t.Errorf("%s: record %d = %q, expected it to contain %s", test.name, i, records[i], call)
+			}
+		}
+	}
+}
+
+func TestWPXPrefix(t *testing.T) {
+	tests := []struct {
+		call   string
+		prefix string
+	}{
+		{"W8ABC", "W8"},
+		{"WD8ABC", "WD8"},
+		{"HG19ABC", "HG19"},
+		{"2E0ABC", "2E0"},
+		{"3D2CR", "3D2"},
+		{"3D2C/R", "3D2"},
+		{"VK100ABC", "VK100"},
+		{"N8BJQ/KH9", "KH9"},
+		{"VP2E/K1ABC", "VP2E"},
+		{"PA/N8BJQ", "PA0"},
+		{"F/W1AW", "F0"},
+		{"RAEM", "RA0"},
+		{"N8BJQ/3", "N3"},
+		{"WD8ABC/4", "WD4"},
+		{"DL1XYZ/P", "DL1"},
+		{"K1ABC/MM", "K1"},
+		{"G4ABC/QRP", "G4"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if result := WPXPrefix(test.call); result != test.prefix {
+			t.Errorf("WPXPrefix(%q) = %q; expected %q", test.call, result, test.prefix)
+		}
+	}
+
+	formatter := New("N7AKG", "OP", "CQ-WPX-CW")
+	output, err := formatter.FormatForN1MM(&QSO{Callsign: "N8BJQ/KH9"})
+	if err != nil {
+		t.Fatalf("FormatForN1MM failed: %v", err)
+	}
+	if !strings.Contains(output, "<wpxprefix>KH9</wpxprefix>") || !strings.Contains(output, "<stationprefix>N7</stationprefix>") {
+		t.Errorf("Expected WPX and station prefixes in output: %s", output)
+	}
+}
+
+func TestRedactCallsign(t *testing.T) {
+	tests := map[string]string{
+		"W1ABC":     "W1***",
+		"ve3xyz/p":  "VE3***/P",
+		"3D2CR":     "3D2**",
+		"N8BJQ/KH9": "N8***/KH9",
+		"RAEM":      "RA**",
+		"":          "",
+	}
+	for call, want := range tests {
+		if got := RedactCallsign(call); got != want {
+			t.Errorf("RedactCallsign(%q) = %q; expected %q", call, got, want)
+		}
+	}
+}
+
+func TestReleaseQSO(t *testing.T) {
+	formatter := New("TEST", "OP", "GENERAL")
+
+	qso, err := formatter.ParseMessage("<call:6>VK1ABC<band:3>20m<mode:3>FT8<eor>", MessageTypeWSJTX)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	ReleaseQSO(qso)
+
+	// A recycled QSO must not carry fields over from its previous use
+	qso, err = formatter.ParseMessage("<call:5>K2ABC<eor>", MessageTypeWSJTX)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Callsign != "K2ABC" || qso.Band != "" || qso.Mode != "" {
+		t.Errorf("Expected a clean QSO for K2ABC, got %+v", qso)
+	}
+}
+
+func BenchmarkParseMessage(b *testing.B) {
+	formatter := New("TEST", "OP", "GENERAL")
+	message := "<call:6>VK1ABC<band:3>20m<mode:3>FT8<rst_sent:3>-05<rst_rcvd:3>-12<freq:9>14.074123<qso_date:8>20231012<time_on:6>123000<eor>"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		qso, err := formatter.ParseMessage(message, MessageTypeWSJTX)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := formatter.FormatForN1MM(qso); err != nil {
+			b.Fatal(err)
+		}
+		ReleaseQSO(qso)
+	}
+}
+
+// BenchmarkParseSources parses one message from each kind of source. All
+// patterns are compiled once at package level, so none of this time is
+// spent compiling regular expressions.
+func BenchmarkParseSources(b *testing.B) {
+	formatter := New("TEST", "OP", "GENERAL")
+	messages := []struct {
+		name    string
+		msgType MessageType
+		message string
+	}{
+		{"wsjtx", MessageTypeWSJTX, "<call:6>VK1ABC<band:3>20m<mode:3>FT8<rst_sent:3>-05<rst_rcvd:3>-12<freq:9>14.074123<qso_date:8>20231012<time_on:6>123000<eor>"},
+		{"n1mm", MessageTypeN1MM, `<contactinfo><timestamp>2023-10-12 12:30:00</timestamp><call>K1ABC</call><band>20</band><rxfreq>1407400</rxfreq><mode>CW</mode><snt>599</snt><rcv>599</rcv><exchange1>05</exchange1></contactinfo>`},
+		{"varac_json", MessageTypeVarAC, `{"app":"VarAC","call":"W1ABC","freq":"14.105","mode":"VARA HF","rst_sent":"59","rst_rcvd":"57","timestamp":"2023-10-12 12:30:00"}`},
+		{"varac_text", MessageTypeVarAC, "VarAC: QSO completed with W1ABC on 14.105 MHz"},
+		{"general", MessageTypeGeneral, "Worked K1ABC 14.074 MHz 20m FT8"},
+	}
+
+	for _, m := range messages {
+		b.Run(m.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				qso, err := formatter.ParseMessage(m.message, m.msgType)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ReleaseQSO(qso)
+			}
+		})
+	}
+}
+
+func BenchmarkDetectMessageType(b *testing.B) {
+	formatter := New("TEST", "OP", "GENERAL")
+	message := `<contactinfo><call>K1ABC</call><band>20</band><mode>CW</mode></contactinfo>`
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		formatter.DetectMessageType(message)
+	}
+}
+
+// benchMessages are representative datagrams from each kind of source
+var benchMessages = []struct {
+	name    string
+	message string
+}{
+	{"wsjtx", "<call:6>VK1ABC<band:3>20m<mode:3>FT8<rst_sent:3>-05<rst_rcvd:3>-12<freq:9>14.074123<qso_date:8>20231012<time_on:6>123000<station_callsign:4>W1AW<eor>"},
+	{"n1mm", `<?xml version="1.0" encoding="utf-8"?><contactinfo app="N1MM Logger Plus"><contestname>CQ-WW-CW</contestname><timestamp>2023-10-12 12:30:00</timestamp><mycall>W1AW</mycall><call>K1ABC</call><band>14</band><rxfreq>1402500</rxfreq><txfreq>1402500</txfreq><mode>CW</mode><snt>599</snt><rcv>599</rcv><exchange1>05</exchange1></contactinfo>`},
+	{"fldigi", "<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<QSO_DATE:8>20240601<TIME_ON:6>150000<RST_SENT:3>599<RST_RCVD:3>579<PROGRAMID:6>fldigi<EOR>"},
+	{"varac_json", `{"app":"VarAC","call":"W1ABC","freq":"14.105","mode":"VARA HF","rst_sent":"59","rst_rcvd":"57","timestamp":"2023-10-12 12:30:00"}`},
+	{"varac_text", "VarAC: QSO completed with W1ABC on 14.105 MHz"},
+	{"js8call", "<call:5>K1ABC <gridsquare:4>FN42 <mode:3>JS8 <rst_sent:3>-10 <rst_rcvd:3>-08 <qso_date:8>20231012 <time_on:6>123000 <freq:8>7.078000 <programid:7>JS8Call <eor>"},
+	{"general", "Worked K1ABC 14.074 MHz 20m FT8"},
+}
+
+// BenchmarkDetect classifies a message from each kind of source with the
+// built-in detection rules
+func BenchmarkDetect(b *testing.B) {
+	formatter := New("TEST", "OP", "GENERAL")
+	for _, m := range benchMessages {
+		b.Run(m.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				formatter.Detect(m.message)
+			}
+		})
+	}
+}
+
+// BenchmarkFormat converts a contest QSO to each output format
+func BenchmarkFormat(b *testing.B) {
+	formatter := New("W1AW", "K1ABC", "CQ-WW-CW")
+	formatter.SetOptions(Options{NodeID: "bench"})
+	qso := &QSO{Callsign: "DL1ABC", FrequencyHz: 14025000, Frequency: "14.025000", Band: "20m", Mode: "CW",
+		RST_Sent: "599", RST_Rcvd: "599", Exchange: "14", ExchangeSent: "05", Grid: "JO62",
+		DateTime: time.Date(2023, 10, 12, 12, 30, 0, 0, time.UTC), ID: "3f2c9a0e5b7d4c1e"}
+
+	for _, format := range []OutputFormat{OutputFormatN1MM, OutputFormatADIF, OutputFormatDXLog, OutputFormatWinTest, OutputFormatRelay} {
+		b.Run(string(format), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := formatter.Format(qso, format); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRelayEnvelope(t *testing.T) {
+	remote := New("W1AW", "K1ABC", "GENERAL")
+	remote.SetOptions(Options{NodeID: "site-a", MaxHops: 3})
+
+	qso := &QSO{Callsign: "G4ABC", FrequencyHz: 14070000, Mode: "PSK31", Band: "20m", Operator: "N1XYZ",
+		DateTime: time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)}
+	output, err := remote.Format(qso, OutputFormatRelay)
+	if err != nil {
+		t.Fatalf("FormatRelay failed: %v", err)
+	}
+	if len(qso.Path) != 0 {
+		t.Errorf("FormatRelay modified the QSO path: %v", qso.Path)
+	}
+
+	central := New("W1AW", "K1ABC", "GENERAL")
+	central.SetOptions(Options{NodeID: "central", MaxHops: 3})
+	if msgType := central.DetectMessageType(output); msgType != MessageTypeRelay {
+		t.Fatalf("Expected relay message type, got %s", msgType)
+	}
+
+	parsed, err := central.ParseMessage(output, MessageTypeRelay)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if parsed.Callsign != "G4ABC" || parsed.FrequencyHz != 14070000 || parsed.Operator != "N1XYZ" || !parsed.DateTime.Equal(qso.DateTime) {
+		t.Errorf("Relay QSO did not round-trip: %+v", parsed)
+	}
+	if strings.Join(parsed.Path, ",") != "site-a" {
+		t.Errorf("Expected path [site-a], got %v", parsed.Path)
+	}
+
+	// Sent back to site-a, the QSO is recognised as a loop
+	looped, _ := central.Format(parsed, OutputFormatRelay)
+	if _, err := remote.ParseMessage(looped, MessageTypeRelay); err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Errorf("Expected relay loop error, got %v", err)
+	}
+
+	// Too many hops
+	parsed.Path = []string{"a", "b", "c"}
+	tooFar, _ := remote.Format(parsed, OutputFormatRelay)
+	if _, err := central.ParseMessage(tooFar, MessageTypeRelay); err == nil || !strings.Contains(err.Error(), "hops") {
+		t.Errorf("Expected max hops error, got %v", err)
+	}
+}
+
+func TestRelayVersions(t *testing.T) {
+	remote := New("W1AW", "K1ABC", "GENERAL")
+	remote.SetOptions(Options{NodeID: "site-a", App: N1MMApp{Version: "2.0.0"}})
+	central := New("W1AW", "K1ABC", "GENERAL")
+	central.SetOptions(Options{NodeID: "central"})
+
+	qso := &QSO{Callsign: "G4ABC", Mode: "PSK31", Band: "20m", DateTime: time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)}
+	current, err := remote.Format(qso, OutputFormatRelay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(current, `{"n7akg_relay":2,"compat":1,"sender":{"node":"site-a","software":"2.0.0"},`) {
+		t.Errorf("unexpected version 2 envelope: %s", current)
+	}
+
+	// An older relay gets version 1, which is the same QSO without the extras
+	old, err := DowngradeRelay(current, 1)
+	if err != nil || !strings.HasPrefix(old, `{"n7akg_relay":1,"qso":{"callsign":"G4ABC"`) {
+		t.Errorf("DowngradeRelay = %s, %v", old, err)
+	}
+	if same, _ := DowngradeRelay(current, 2); same != current {
+		t.Errorf("a version 2 relay should get the envelope unchanged: %s", same)
+	}
+
+	for _, c := range []struct {
+		message string
+		ok      bool
+	}{
+		{old, true},
+		{current, true},
+		// A newer relay's envelope that older ones can still read
+		{`{"n7akg_relay":3,"compat":2,"qso":{"callsign":"G4ABC","rig":"IC-7300"}}`, true},
+		{`{"n7akg_relay":3,"compat":3,"qso":{"callsign":"G4ABC"}}`, false},
+		{`{"n7akg_relay":3,"qso":{"callsign":"G4ABC"}}`, false},
+		{`{"n7akg_relay":0,"qso":{"callsign":"G4ABC"}}`, false},
+	} {
+		if _, err := central.ParseMessage(c.message, MessageTypeRelay); (err == nil) != c.ok {
+			t.Errorf("ParseMessage(%s): error %v, want ok %t", c.message, err, c.ok)
+		}
+	}
+
+	hello, err := ParseRelayHello(central.HelloLine())
+	if err != nil || hello.Node != "central" || hello.Version != RelayVersion || hello.MinVersion != RelayMinVersion {
+		t.Fatalf("hello did not round-trip: %+v, %v", hello, err)
+	}
+	if v, err := NegotiateRelayVersion(RelayVersion, RelayHello{Version: 1, MinVersion: 1}); v != 1 || err != nil {
+		t.Errorf("NegotiateRelayVersion with a version 1 relay = %d, %v", v, err)
+	}
+	if v, err := NegotiateRelayVersion(RelayVersion, RelayHello{Version: 5, MinVersion: 2}); v != RelayVersion || err != nil {
+		t.Errorf("NegotiateRelayVersion with a newer relay = %d, %v", v, err)
+	}
+	if _, err := NegotiateRelayVersion(RelayVersion, RelayHello{Version: 9, MinVersion: 8}); err == nil {
+		t.Error("expected no common version with a relay that only reads version 8 on")
+	}
+}
+
+func TestLoopMarker(t *testing.T) {
+	siteA := New("W1AW", "K1ABC", "GENERAL")
+	siteA.SetOptions(Options{NodeID: "site-a"})
+	siteB := New("W1AW", "K1ABC", "GENERAL")
+	siteB.SetOptions(Options{NodeID: "site-b", XML: XMLStyle{Indent: true}})
+
+	qso := &QSO{Callsign: "G4ABC", FrequencyHz: 14070000, Mode: "PSK31", Band: "20m",
+		DateTime: time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)}
+
+	for _, format := range []OutputFormat{OutputFormatN1MM, OutputFormatADIF} {
+		output, err := siteA.Format(qso, format)
+		if err != nil {
+			t.Fatalf("%s: Format failed: %v", format, err)
+		}
+		if !siteA.IsRelayOutput(output) {
+			t.Errorf("%s: output should be recognised as the relay's own: %s", format, output)
+		}
+
+		// Coming back to site-a directly is a loop
+		if _, err := siteA.ParseMessage(output, siteA.DetectMessageType(output)); !errors.Is(err, ErrRelayLoop) {
+			t.Errorf("%s: expected relay loop error, got %v", format, err)
+		}
+
+		// site-b adds itself to the path, so site-a still sees the loop
+		parsed, err := siteB.ParseMessage(output, siteB.DetectMessageType(output))
+		if err != nil {
+			t.Fatalf("%s: site-b failed to parse: %v", format, err)
+		}
+		if parsed.Callsign != "G4ABC" || strings.Join(parsed.Path, ",") != "site-a" {
+			t.Errorf("%s: site-b parsed %s with path %v", format, parsed.Callsign, parsed.Path)
+		}
+		again, err := siteB.Format(parsed, format)
+		if err != nil {
+			t.Fatalf("%s: site-b Format failed: %v", format, err)
+		}
+		if !strings.Contains(again, "site-a,site-b") {
+			t.Errorf("%s: site-b output should carry the whole path: %s", format, again)
+		}
+		if _, err := siteA.ParseMessage(again, siteA.DetectMessageType(again)); !errors.Is(err, ErrRelayLoop) {
+			t.Errorf("%s: expected relay loop error via site-b, got %v", format, err)
+		}
+	}
+
+	// The marker stays inside the contactinfo element
+	output, _ := siteB.Format(qso, OutputFormatN1MM)
+	if !strings.HasSuffix(output, "  <!-- X-Relay: site-b -->\n</contactinfo>") {
+		t.Errorf("unexpected N1MM marker placement: %s", output)
+	}
+	// Without a node ID nothing is added
+	plain := New("W1AW", "K1ABC", "GENERAL")
+	if output, _ := plain.Format(qso, OutputFormatADIF); strings.Contains(output, "APP_N7AKG_RELAY") {
+		t.Errorf("unexpected loop marker: %s", output)
+	}
+}
+func TestCTYEntity(t *testing.T) {
+	data := `United States:            05:  08:  NA:   37.53:    91.67:     5.0:  K:
+    AA,AB,AC,K,N,W,=VE3ABC/W1;
+Canada:                   05:  09:  NA:   44.35:    78.75:     5.0:  VE:
+    CF,CG,VA,VE,VO1(5)[9],VY;
+Hawaii:                   31:  61:  OC:   21.12:   157.48:    10.0:  KH6:
+    AH6,KH6,NH6,WH6,=K6HI;
+St. Kitts & Nevis:        08:  11:  NA:   17.30:    62.73:     4.0:  V4:
+    V4,VP2E;
+`
+	cty, err := ParseCTY(data)
+	if err != nil {
+		t.Fatalf("ParseCTY failed: %v", err)
+	}
+
+	tests := []struct {
+		call   string
+		entity string
+	}{
+		{"W1AW", "United States"},
+		{"KH6ABC", "Hawaii"},
+		{"K6HI", "Hawaii"},
+		{"VO1AA", "Canada"},
+		{"VP2E/K1ABC", "St. Kitts & Nevis"},
+		{"KH6/W1AW", "Hawaii"},
+		{"W1AW/P", "United States"},
+		{"VE3ABC/W1", "United States"},
+		{"ve3xyz", "Canada"},
+	}
+	for _, test := range tests {
+		if entity, ok := cty.Entity(test.call); !ok || entity != test.entity {
+			t.Errorf("Entity(%q) = %q, %v; expected %q", test.call, entity, ok, test.entity)
+		}
+	}
+	if entity, ok := cty.Entity("QQ1ABC"); ok {
+		t.Errorf("Entity(QQ1ABC) = %q; expected no match", entity)
+	}
+
+	// The primary prefix, continent and CQ zone, with prefix overrides
+	if e, ok := cty.Lookup("KH6ABC"); !ok || e.Prefix != "KH6" || e.Continent != "OC" || e.CQZone != 31 {
+		t.Errorf("Lookup(KH6ABC) = %+v, %v", e, ok)
+	}
+	if e, ok := cty.Lookup("VO1AA"); !ok || e.Prefix != "VE" || e.Continent != "NA" || e.CQZone != 5 {
+		t.Errorf("Lookup(VO1AA) = %+v, %v", e, ok)
+	}
+
+	if _, err := ParseCTY("not a country file"); err == nil {
+		t.Error("Expected error for malformed cty.dat")
+	}
+}
+
+func TestParseContestExchange(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "GENERAL")
+
+	// WSJT-X logs the special activity exchange in STX_STRING and SRX_STRING
+	wsjtx := "<call:5>K2ABC <mode:3>FT8 <qso_date:8>20240622 <time_on:6>180000 <stx_string:6>2B CT <srx_string:6>3A EMA <eor>"
+	qso, err := formatter.ParseMessage(wsjtx, MessageTypeWSJTX)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Exchange != "3A EMA" || qso.ExchangeSent != "2B CT" {
+		t.Errorf("WSJT-X exchanges = %q sent, %q received", qso.ExchangeSent, qso.Exchange)
+	}
+
+	// A length running past the end of the message is ignored
+	qso, err = formatter.ParseMessage("<call:5>K2ABC <mode:3>FT8 <srx_string:40>MA <eor>", MessageTypeWSJTX)
+	if err != nil || qso.Exchange != "" {
+		t.Errorf("truncated exchange = %q, %v", qso.Exchange, err)
+	}
+
+	adif := "<CALL:5>K2ABC<MODE:4>RTTY<QSO_DATE:8>20240106<TIME_ON:6>180000<STX_STRING:2>CT<SRX:3>013<EOR>"
+	qso, err = formatter.ParseMessage(adif, MessageTypeFldigi)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if qso.Exchange != "013" || qso.ExchangeSent != "CT" {
+		t.Errorf("ADIF exchanges = %q sent, %q received", qso.ExchangeSent, qso.Exchange)
+	}
+}
+
+func TestParseMyCall(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "GENERAL")
+	tests := []struct {
+		name    string
+		message string
+		msgType MessageType
+	}{
+		{"N1MM", `<contactinfo app="N1MM Logger Plus"><mycall>w1aw/7</mycall><call>G4ABC</call><band>14</band><mode>CW</mode></contactinfo>`, MessageTypeN1MM},
+		{"ADIF", "<CALL:5>G4ABC<MODE:5>PSK31<STATION_CALLSIGN:6>W1AW/7<EOR>", MessageTypeFldigi},
+		{"WSJT-X", "<call:5>G4ABC <mode:3>FT8 <station_callsign:6>W1AW/7 <eor>", MessageTypeWSJTX},
+	}
+	for _, tt := range tests {
+		qso, err := formatter.ParseMessage(tt.message, tt.msgType)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if qso.MyCall != "W1AW/7" {
+			t.Errorf("%s: MyCall = %q", tt.name, qso.MyCall)
+		}
+		// The configured station is still the one sent on
+		if output, _ := formatter.FormatForN1MM(qso); !strings.Contains(output, "<mycall>W1AW</mycall>") {
+			t.Errorf("%s: station changed: %s", tt.name, output)
+		}
+	}
+}
+
+func TestContestExchange(t *testing.T) {
+	formatter := New("W1AW", "K1ABC", "GENERAL")
+	formatter.SetOptions(Options{ExchangeParsers: map[string]ExchangeParser{"MYPARTY": ExchangeParserQSOParty}})
+
+	tests := []struct {
+		contest  string
+		exchange string
+		want     []string // Substrings of the N1MM output
+		adif     []string // Substrings of the ADIF output
+	}{
+		{"SKCC-WES", "599 MA BOB 1234S",
+			[]string{"<exchange1>1234S</exchange1>", "<section>MA</section>", "<name>BOB</name>"},
+			[]string{"<SKCC:5>1234S", "<NAME:3>BOB", "<STATE:2>MA"}},
+		{"SKCC-SKS", "579 ON JIM NONE",
+			[]string{"<exchange1>579 ON JIM NONE</exchange1>", "<section>ON</section>", "<name>JIM</name>"},
+			[]string{"<VE_PROV:2>ON"}},
+		{"NYQP", "59 ALB",
+			[]string{"<exchange1>59 ALB</exchange1>", "<section>NY</section>", "<comment>County: ALB</comment>"},
+			[]string{"<STATE:2>NY", "<CNTY:6>NY,ALB"}},
+		{"NYQP", "59 MA",
+			[]string{"<section>MA</section>", "<comment></comment>"},
+			[]string{"<STATE:2>MA"}},
+		{"CQP", "123 SCLA",
+			[]string{"<section>CA</section>", "<comment>County: SCLA</comment>"},
+			[]string{"<CNTY:7>CA,SCLA"}},
+		{"MYPARTY", "MA ESSX",
+			[]string{"<section>MA</section>", "<comment>County: ESSX</comment>"},
+			[]string{"<CNTY:7>MA,ESSX"}},
+		{"NAQP-CW", "BOB MA",
+			[]string{"<exchange1>BOB MA</exchange1>", "<section></section>", "<name></name>"},
+			nil},
+		{"ARRL-RTTY", "579 MA",
+			[]string{"<exchange1>MA</exchange1>", "<section>MA</section>", "<rcvnr>0</rcvnr>"},
+			[]string{"<STATE:2>MA"}},
+		{"ARRL-RTTY", "559 0013",
+			[]string{"<exchange1>0013</exchange1>", "<rcvnr>13</rcvnr>"},
+			[]string{"<SRX:2>13"}},
+		{"FD", "3A EMA",
+			[]string{"<exchange1>3A</exchange1>", "<section>EMA</section>"},
+			[]string{"<CLASS:2>3A", "<ARRL_SECT:3>EMA"}},
+		{"WW-DIGI", "FN42",
+			[]string{"<gridsquare>FN42</gridsquare>", "<exchange1>FN42</exchange1>"},
+			[]string{"<GRIDSQUARE:4>FN42"}},
+		{"EU-VHF", "570007 JO22DB",
+			[]string{"<rcvnr>7</rcvnr>", "<gridsquare>JO22DB</gridsquare>"},
+			[]string{"<SRX:1>7", "<GRIDSQUARE:6>JO22DB"}},
+		{"EUVHF", "57 0123 JO22DB",
+			[]string{"<rcvnr>123</rcvnr>", "<exchange1>JO22DB</exchange1>"},
+			nil},
+	}
+	for _, tt := range tests {
+		qso := &QSO{Callsign: "K2ABC", FrequencyHz: 7030000, Mode: "CW", Band: "40m",
+			Exchange: tt.exchange, Contest: tt.contest,
+			DateTime: time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)}
+
+		output, err := formatter.FormatForN1MM(qso)
+		if err != nil {
+			t.Fatalf("%s %q: FormatForN1MM failed: %v", tt.contest, tt.exchange, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s %q: N1MM output missing %s: %s", tt.contest, tt.exchange, want, output)
+			}
+		}
+
+		adif, err := formatter.FormatADIF(qso)
+		if err != nil {
+			t.Fatalf("%s %q: FormatADIF failed: %v", tt.contest, tt.exchange, err)
+		}
+		if !strings.Contains(adif, "<SRX_STRING:"+strconv.Itoa(len(tt.exchange))+">"+tt.exchange) {
+			t.Errorf("%s %q: ADIF should keep the exchange as received: %s", tt.contest, tt.exchange, adif)
+		}
+		for _, want := range tt.adif {
+			if !strings.Contains(adif, want) {
+				t.Errorf("%s %q: ADIF output missing %s: %s", tt.contest, tt.exchange, want, adif)
+			}
+		}
+	}
+}
+
+func TestParseJS8Directed(t *testing.T) {
+	message := `{"type":"RX.DIRECTED","value":"K1ABC: N7AKG MSG HELLO ♢","params":{"CMD":" MSG","FROM":"k1abc","TO":"N7AKG","GRID":" FN42","FREQ":7079500,"SNR":-12,"TEXT":"K1ABC: N7AKG MSG HELLO ♢","UTC":1717243200000}}`
+	if !IsJS8Directed(message) {
+		t.Fatal("IsJS8Directed = false")
+	}
+	if IsJS8Directed(`{"type":"RX.SPOT","params":{}}`) {
+		t.Error("IsJS8Directed true for a spot")
+	}
+
+	m, err := ParseJS8Directed(message)
+	if err != nil {
+		t.Fatalf("ParseJS8Directed failed: %v", err)
+	}
+	want := JS8Message{
+		Time:        time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		From:        "K1ABC",
+		To:          "N7AKG",
+		Command:     "MSG",
+		Text:        "K1ABC: N7AKG MSG HELLO",
+		Grid:        "FN42",
+		FrequencyHz: 7079500,
+		SNR:         -12,
+	}
+	if *m != want {
+		t.Errorf("ParseJS8Directed = %+v, want %+v", *m, want)
+	}
+	if m.Heartbeat() {
+		t.Error("A message is not a heartbeat")
+	}
+
+	hb, err := ParseJS8Directed(`{"type":"RX.DIRECTED","params":{"FROM":"K1ABC","TO":"@HB","CMD":" HEARTBEAT","TEXT":"K1ABC: @HB HEARTBEAT FN42"}}`)
+	if err != nil || !hb.Heartbeat() {
+		t.Errorf("Heartbeat not recognised: %+v %v", hb, err)
+	}
+	if _, err := ParseJS8Directed(`{"type":"RX.DIRECTED","params":{"TO":"N7AKG"}}`); err == nil {
+		t.Error("Expected an error without a sender")
+	}
+}
+
+func TestN1MMBroadcastKind(t *testing.T) {
+	tests := []struct {
+		message string
+		kind    string
+	}{
+		{`<?xml version="1.0" encoding="utf-8"?><RadioInfo><app>N1MM</app><Freq>1407400</Freq></RadioInfo>`, N1MMBroadcastRadioInfo},
+		{`<spot><app>N1MM</app><dxcall>G4ABC</dxcall></spot>`, N1MMBroadcastSpot},
+		{`<lookupinfo><app>N1MM</app><call>K1ABC</call></lookupinfo>`, N1MMBroadcastLookupInfo},
+		{"<?xml version=\"1.0\"?>\r\n<dynamicresults><contest>CQ-WW-CW</contest></dynamicresults>", N1MMBroadcastScore},
+		{`<AppInfo><app>N1MM</app></AppInfo>`, N1MMBroadcastAppInfo},
+		{`<contactinfo><app>N1MM</app><call>K1ABC</call></contactinfo>`, ""},
+		{`<contactdelete><call>K1ABC</call></contactdelete>`, ""},
+		{"<CALL:5>K1ABC<EOR>", ""},
+	}
+	for _, tt := range tests {
+		if kind := N1MMBroadcastKind(tt.message); kind != tt.kind {
+			t.Errorf("N1MMBroadcastKind(%.30q) = %q, want %q", tt.message, kind, tt.kind)
+		}
+	}
+}
+
+func TestParseN1MMSpot(t *testing.T) {
+	qso, err := ParseN1MMSpot(`<spot><app>N1MM</app><StationName>RUN</StationName><dxcall>g4abc</dxcall><frequency>14025.3</frequency>` +
+		`<spottercall>K1TTT</spottercall><comment>CQ</comment><action>add</action><mode>CW</mode><status>0</status><timestamp>2024-06-01 12:00:00</timestamp></spot>`)
+	if err != nil {
+		t.Fatalf("ParseN1MMSpot failed: %v", err)
+	}
+	if qso.Action != ActionSpot || qso.Callsign != "G4ABC" || qso.FrequencyHz != 14025300 || qso.Band != "20m" ||
+		qso.Mode != "CW" || qso.Comment != "CQ" || !qso.DateTime.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseN1MMSpot = %+v", qso)
+	}
+	if _, err := ParseN1MMSpot(`<spot><dxcall>G4ABC</dxcall><action>delete</action></spot>`); !errors.Is(err, ErrN1MMSpotDeleted) {
+		t.Errorf("deleted spot: %v", err)
+	}
+}
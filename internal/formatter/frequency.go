@@ -0,0 +1,124 @@
+package formatter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseFrequency converts a frequency string to Hz, guessing the unit from
+// its magnitude: values below 1800 are MHz (up to the 23cm band), values
+// below 1,000,000 are kHz (160m upward), and anything larger is Hz. It is
+// for free-form sources that don't say; a microwave frequency in MHz reads
+// as kHz.
+func ParseFrequency(freq string) (int64, error) {
+	value, err := parseFrequencyValue(freq)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case value < 1800:
+		return int64(value*1e6 + 0.5), nil
+	case value < 1e6:
+		return int64(value*1e3 + 0.5), nil
+	default:
+		return int64(value + 0.5), nil
+	}
+}
+
+// ParseMHz converts a frequency in MHz, the unit of the ADIF FREQ field, to
+// Hz (10368.1 -> 10368100000)
+func ParseMHz(freq string) (int64, error) {
+	value, err := parseFrequencyValue(freq)
+	if err != nil {
+		return 0, err
+	}
+	return int64(value*1e6 + 0.5), nil
+}
+
+// parseFrequencyValue parses a positive frequency in any unit
+func parseFrequencyValue(freq string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(freq), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid frequency %q: %w", freq, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("invalid frequency %q", freq)
+	}
+	return value, nil
+}
+
+// FormatMHz formats a frequency in Hz as MHz without trailing zeros (14074000 -> "14.074")
+func FormatMHz(hz int64) string {
+	return strconv.FormatFloat(float64(hz)/1e6, 'f', -1, 64)
+}
+
+// Hz returns the QSO frequency in Hz, parsing Frequency if FrequencyHz is unset
+func (q *QSO) Hz() int64 {
+	if q.FrequencyHz > 0 {
+		return q.FrequencyHz
+	}
+	if hz, err := ParseFrequency(q.Frequency); err == nil {
+		return hz
+	}
+	return 0
+}
+
+// normalizeFrequency converts the raw frequency string found by a parser to
+// Hz, rewrites Frequency as MHz and derives the band if it is missing.
+// integerUnitHz, when non-zero, is the unit of whole-number values for
+// sources with a fixed convention (N1MM reports integers in tens of Hz).
+func normalizeFrequency(qso *QSO, integerUnitHz int64) {
+	raw := strings.TrimSpace(qso.Frequency)
+	if raw == "" {
+		return
+	}
+
+	var hz int64
+	if integerUnitHz > 0 && !strings.Contains(raw, ".") {
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			hz = n * integerUnitHz
+		}
+	}
+	if hz == 0 {
+		parsed, err := ParseFrequency(raw)
+		if err != nil {
+			// Leave unparseable values alone rather than dropping them
+			return
+		}
+		hz = parsed
+	}
+
+	setFrequency(qso, hz)
+}
+
+// normalizeMHz is normalizeFrequency for sources whose frequency is always
+// in MHz, like the ADIF FREQ field, so microwave QSOs aren't taken for kHz
+func normalizeMHz(qso *QSO) {
+	hz, err := ParseMHz(qso.Frequency)
+	if err != nil {
+		// Leave unparseable values alone rather than dropping them
+		return
+	}
+	setFrequency(qso, hz)
+}
+
+// setFrequency sets a parsed frequency, rewriting Frequency as MHz and
+// deriving the band if it is missing
+func setFrequency(qso *QSO, hz int64) {
+	qso.FrequencyHz = hz
+	qso.Frequency = FormatMHz(hz)
+
+	if qso.Band == "" {
+		qso.Band = FrequencyToBand(float64(hz) / 1e6)
+	}
+}
+
+// n1mmFrequency formats Hz in N1MM's contactinfo unit of tens of Hz (14.025 MHz -> "1402500")
+func n1mmFrequency(hz int64) string {
+	if hz <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(hz/10, 10)
+}
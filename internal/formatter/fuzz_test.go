@@ -0,0 +1,98 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run with e.g. go test ./internal/formatter -fuzz FuzzParseADIF. Without
+// -fuzz the seeds below run as ordinary tests.
+
+var fuzzSeeds = []string{
+	"<command:3>Log<parameters:222><CALL:5>N7AKG <MODE:7>DYNAMIC <SUBMODE:7>VARA HF <BAND:3>20m <FREQ:6>14.105 <QSO_DATE:8>20240601 <TIME_ON:6>160000 <RST_SENT:3>599 <RST_RCVD:3>599 <EOR>",
+	`{"app":"VarAC","call":"W1ABC","freq":"14.105","mode":"VARA HF","timestamp":"2024-06-01 16:05:00","rst_sent":"599","rst_rcvd":"599","band":"20m"}`,
+	"VarAC: QSO with W1ABC on 14.105 VARA HF",
+	`<?xml version="1.0" encoding="utf-8"?><contactinfo app="N1MM Logger Plus" timestamp="2024-06-01 17:00:12"><contestname>CQ-WW-CW</contestname><mycall>W1AW</mycall><band>14</band><rxfreq>1402500</rxfreq><mode>CW</mode><call>DL1XYZ</call><snt>599</snt><sntnr>5</sntnr><rcv>599</rcv><exchange1>14</exchange1></contactinfo>`,
+	`<contactdelete><call>DL1XYZ</call><ID>abc123</ID></contactdelete>`,
+	"<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<QSO_DATE:8>20240601<TIME_ON:6>150000<RST_SENT:3>599<RST_RCVD:3>579<PROGRAMID:6>fldigi<EOR>",
+	"<CALL:99999999999999999999>G4ABC<EOR>",
+	"<CALL:5>G4<EOR>",
+	"\xad\xbc\xcb\xda\x00\x00\x00\x02<call:5>K1ABC",
+	`{"n7akg_relay":2,"compat":1,"qso":{"callsign":"G4ABC"}}`,
+	"",
+}
+
+// checkParsed fails when a parser reports success without a callsign
+func checkParsed(t *testing.T, qso *QSO, err error) {
+	t.Helper()
+	if err == nil && (qso == nil || qso.Callsign == "") {
+		t.Errorf("parsed without error but without a callsign: %+v", qso)
+	}
+}
+
+func FuzzDetectMessageType(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	formatter := New("W1AW", "W1AW", "GENERAL")
+	f.Fuzz(func(t *testing.T, message string) {
+		msgType := formatter.DetectMessageType(message)
+		for _, record := range SplitRecords(message) {
+			qso, err := formatter.ParseMessage(record, msgType)
+			checkParsed(t, qso, err)
+		}
+	})
+}
+
+func FuzzParseADIF(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	formatter := New("W1AW", "W1AW", "GENERAL")
+	f.Fuzz(func(t *testing.T, message string) {
+		qso, err := formatter.parseADIF(message, time.UTC)
+		checkParsed(t, qso, err)
+	})
+}
+
+func FuzzParseN1MM(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	formatter := New("W1AW", "W1AW", "GENERAL")
+	f.Fuzz(func(t *testing.T, message string) {
+		qso, err := formatter.parseN1MM(message)
+		checkParsed(t, qso, err)
+	})
+}
+
+func FuzzParseVarAC(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	formatter := New("W1AW", "W1AW", "GENERAL")
+	f.Fuzz(func(t *testing.T, message string) {
+		qso, err := formatter.parseVarAC(message)
+		checkParsed(t, qso, err)
+	})
+}
+
+func TestOversizedMessage(t *testing.T) {
+	formatter := New("W1AW", "W1AW", "GENERAL")
+	record := "<CALL:5>G4ABC<MODE:5>PSK31<EOR>"
+	huge := record + strings.Repeat(" ", MaxMessageSize)
+
+	if msgType := formatter.DetectMessageType(huge); msgType != MessageTypeGeneral {
+		t.Errorf("oversized message detected as %s", msgType)
+	}
+	if _, err := formatter.ParseMessage(huge, MessageTypeFldigi); err == nil {
+		t.Error("expected an oversized message to be rejected")
+	}
+	if records := SplitRecords(huge); len(records) != 1 {
+		t.Errorf("oversized message split into %d records", len(records))
+	}
+	if _, err := formatter.ParseMessage(record, MessageTypeFldigi); err != nil {
+		t.Errorf("ordinary message rejected: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JS8Message is a directed message JS8Call decoded, from its RX.DIRECTED
+// API event. Directed messages are traffic between stations, not QSOs.
+type JS8Message struct {
+	Time        time.Time `json:"time"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`                // A callsign or a group such as @HB or @ALLCALL
+	Command     string    `json:"command,omitempty"` // e.g. MSG, QUERY, SNR?, HEARTBEAT
+	Text        string    `json:"text"`              // The whole message as JS8Call shows it
+	Grid        string    `json:"grid,omitempty"`
+	FrequencyHz int64     `json:"frequency_hz,omitempty"`
+	SNR         int       `json:"snr"`
+}
+
+// js8Event is the part of a JS8Call API event the relay reads
+type js8Event struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Params struct {
+		From string `json:"FROM"`
+		To   string `json:"TO"`
+		Cmd  string `json:"CMD"`
+		Text string `json:"TEXT"`
+		Grid string `json:"GRID"`
+		Freq int64  `json:"FREQ"`
+		SNR  int    `json:"SNR"`
+		UTC  int64  `json:"UTC"` // Milliseconds since the epoch
+	} `json:"params"`
+}
+
+// IsJS8Directed reports whether a message is a JS8Call RX.DIRECTED event
+func IsJS8Directed(message string) bool {
+	trimmed := strings.TrimSpace(message)
+	return strings.HasPrefix(trimmed, "{") && strings.Contains(trimmed, `"RX.DIRECTED"`)
+}
+
+// ParseJS8Directed decodes a JS8Call RX.DIRECTED event
+func ParseJS8Directed(message string) (*JS8Message, error) {
+	var event js8Event
+	if err := json.Unmarshal([]byte(message), &event); err != nil {
+		return nil, fmt.Errorf("failed to parse JS8Call event: %w", err)
+	}
+	if event.Type != "RX.DIRECTED" {
+		return nil, fmt.Errorf("JS8Call %s event is not a directed message", event.Type)
+	}
+
+	p := event.Params
+	m := &JS8Message{
+		From:        strings.ToUpper(strings.TrimSpace(p.From)),
+		To:          strings.ToUpper(strings.TrimSpace(p.To)),
+		Command:     strings.TrimSpace(p.Cmd),
+		Text:        strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(p.Text), "♢")),
+		Grid:        strings.TrimSpace(p.Grid),
+		FrequencyHz: p.Freq,
+		SNR:         p.SNR,
+	}
+	if m.Text == "" {
+		m.Text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(event.Value), "♢"))
+	}
+	if p.UTC > 0 {
+		m.Time = time.UnixMilli(p.UTC).UTC()
+	} else {
+		m.Time = time.Now().UTC()
+	}
+	if m.From == "" {
+		return nil, fmt.Errorf("JS8Call directed message without a sender")
+	}
+	return m, nil
+}
+
+// Heartbeat reports whether the message is a JS8Call heartbeat, which
+// stations send every few minutes to show they are on the air
+func (m *JS8Message) Heartbeat() bool {
+	return m.To == "@HB" || strings.EqualFold(m.Command, "HEARTBEAT")
+}
@@ -0,0 +1,177 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const MessageTypeJTAlert MessageType = "jtalert"
+
+// JTAlertStation is the operating station JTAlert broadcasts when its
+// callsign, grid, band or mode changes
+type JTAlertStation struct {
+	Call      string
+	Grid      string
+	Band      string
+	Mode      string
+	Frequency string // MHz
+}
+
+// jtalertStationKeys maps the station fields to the element names JTAlert
+// uses for them, normalized like macLogKeys
+var jtalertStationKeys = map[string][]string{
+	"call": {"mycall", "stationcallsign", "callsign", "call"},
+	"grid": {"mygrid", "mygridsquare", "grid", "gridsquare", "locator"},
+	"band": {"band"},
+	"mode": {"mode"},
+	"freq": {"freq", "frequency", "dialfreq", "dialfrequency"},
+}
+
+// IsJTAlertStation reports whether a JTAlert message is a station broadcast
+// rather than a logged QSO
+func IsJTAlertStation(message string) bool {
+	lower := strings.ToLower(message)
+	return strings.Contains(lower, "jtalert") && strings.Contains(lower, "<station") &&
+		!strings.Contains(lower, "qso") && !strings.Contains(lower, "call:")
+}
+
+// ParseJTAlertStation decodes a JTAlert station broadcast
+func ParseJTAlertStation(message string) (*JTAlertStation, error) {
+	fields, err := xmlFields(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JTAlert station XML: %w", err)
+	}
+
+	value := func(field string) string {
+		for _, key := range jtalertStationKeys[field] {
+			if v := strings.TrimSpace(fields[key]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	station := &JTAlertStation{
+		Call: strings.ToUpper(value("call")),
+		Grid: value("grid"),
+		Band: strings.ToLower(value("band")),
+		Mode: strings.ToUpper(value("mode")),
+	}
+	if freq := value("freq"); freq != "" {
+		qso := QSO{Frequency: freq, Band: station.Band}
+		normalizeFrequency(&qso, 0)
+		station.Frequency, station.Band = qso.Frequency, qso.Band
+	}
+	if station.Call == "" && station.Grid == "" {
+		return nil, fmt.Errorf("JTAlert station message without a callsign or grid")
+	}
+	return station, nil
+}
+
+// parseJTAlert parses JTAlert's last QSO broadcast. JTAlert sends the ADIF
+// record of the logged QSO, either bare or inside an XML document (escaped
+// or as CDATA); QSOs broadcast as XML elements are read like the macOS
+// loggers' plists.
+func (f *Formatter) parseJTAlert(message string) (*QSO, error) {
+	if IsJTAlertStation(message) {
+		return nil, fmt.Errorf("jtalert station message, not a QSO")
+	}
+
+	loc := f.sourceLocation(MessageTypeJTAlert)
+	if strings.Contains(strings.ToUpper(message), "<CALL:") {
+		return f.parseADIF(message, loc)
+	}
+
+	// XML: an escaped ADIF record is the text of an element
+	text, fields, err := xmlContent(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jtalert message: %w", err)
+	}
+	if strings.Contains(strings.ToUpper(text), "<CALL:") {
+		return f.parseADIF(text, loc)
+	}
+
+	value := func(field string) string {
+		for _, key := range macLogKeys[field] {
+			if v := strings.TrimSpace(fields[macLogKey(key)]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	qso := newQSO()
+	qso.Callsign = strings.ToUpper(value("call"))
+	qso.Frequency = value("freq")
+	qso.Band = strings.ToLower(value("band"))
+	qso.Mode = strings.ToUpper(value("mode"))
+	qso.RST_Sent = value("rst_sent")
+	qso.RST_Rcvd = value("rst_rcvd")
+	qso.Exchange = value("exchange")
+	qso.Comment = value("comment")
+	if t, ok := macLogTimestamp(loc, value("timestamp"), value("date")); ok {
+		qso.DateTime = t
+	} else if t, ok := textLogTime(value("date"), value("time"), loc); ok {
+		qso.DateTime = t
+	}
+	normalizeFrequency(qso, 0)
+
+	if qso.Callsign == "" {
+		ReleaseQSO(qso)
+		return nil, fmt.Errorf("no callsign found in jtalert message")
+	}
+	return qso, nil
+}
+
+// xmlFields returns the text of the leaf elements of an XML document by
+// normalized element name
+func xmlFields(message string) (map[string]string, error) {
+	_, fields, err := xmlContent(message)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no XML elements found")
+	}
+	return fields, nil
+}
+
+// xmlContent walks an XML document, returning all of its text (entities
+// and CDATA decoded) and the text of each leaf element by normalized name
+func xmlContent(message string) (string, map[string]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(message))
+	decoder.Strict = false
+
+	var all strings.Builder
+	fields := make(map[string]string)
+	var element string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element = macLogKey(t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			all.Write(t)
+			text.Write(t)
+		case xml.EndElement:
+			// Only the innermost element gets the text
+			if element != "" {
+				fields[element] = text.String()
+				element = ""
+			}
+		}
+	}
+	return all.String(), fields, nil
+}
@@ -0,0 +1,50 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// N1MMLookupInfo is the lookupinfo message N1MM Logger Plus broadcasts when
+// a call is entered in the entry window. The exchange fields are prefilled
+// from N1MM's call history.
+type N1MMLookupInfo struct {
+	XMLName    xml.Name `xml:"lookupinfo"`
+	App        string   `xml:"app"`
+	Contest    string   `xml:"contestname"`
+	Call       string   `xml:"call"`
+	Exchange   string   `xml:"exchange1"`
+	Section    string   `xml:"section"`
+	Name       string   `xml:"name"`
+	Qth        string   `xml:"qth"`
+	GridSquare string   `xml:"gridsquare"`
+	Zone       string   `xml:"zone"`
+	RadioNr    int      `xml:"radionr"`
+}
+
+// IsLookupInfo reports whether a datagram is an N1MM lookupinfo message
+func IsLookupInfo(message string) bool {
+	return strings.Contains(message, "<lookupinfo")
+}
+
+// ParseLookupInfo decodes an N1MM lookupinfo message
+func ParseLookupInfo(message string) (*N1MMLookupInfo, error) {
+	var info N1MMLookupInfo
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(message)), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse lookupinfo XML: %w", err)
+	}
+	return &info, nil
+}
+
+// ExchangeText returns the received exchange N1MM knows for the call: the
+// exchange field if set, otherwise the section, otherwise name and QTH
+func (li *N1MMLookupInfo) ExchangeText() string {
+	if exchange := strings.TrimSpace(li.Exchange); exchange != "" {
+		return exchange
+	}
+	if section := strings.TrimSpace(li.Section); section != "" {
+		return section
+	}
+	return strings.TrimSpace(strings.TrimSpace(li.Name) + " " + strings.TrimSpace(li.Qth))
+}
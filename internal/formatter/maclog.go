@@ -0,0 +1,198 @@
+package formatter
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	MessageTypeMacLoggerDX MessageType = "macloggerdx"
+	MessageTypeRUMlog      MessageType = "rumlog"
+)
+
+// macLogKeys maps the QSO fields to the keys macOS loggers use for them.
+// Keys are compared lower-case with spaces, underscores and dashes removed,
+// so "RST_Sent", "rst sent" and "rstSent" are the same key.
+var macLogKeys = map[string][]string{
+	"call":      {"call", "callsign", "dxcall"},
+	"freq":      {"freq", "frequency", "txfreq", "rxfreq", "qrg"},
+	"band":      {"band"},
+	"mode":      {"mode", "submode"},
+	"rst_sent":  {"rstsent", "rsts", "rstsnt", "sent"},
+	"rst_rcvd":  {"rstrcvd", "rstr", "rstrcv", "rcvd", "received"},
+	"timestamp": {"timestamp", "datetime", "qsostart", "start"},
+	"date":      {"qsodate", "date"},
+	"time":      {"timeon", "qsotime", "time"},
+	"exchange":  {"srxstring", "exchange", "rcvdexchange"},
+	"comment":   {"comment", "comments", "note", "notes"},
+}
+
+// macLogTimestampLayouts are the timestamp forms seen from macOS loggers,
+// including NSDate's description format
+var macLogTimestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// parseMacLog parses the UDP broadcasts of MacLoggerDX and RUMlogNG. Both
+// send a JSON object or an Apple property list (XML plist) describing the
+// QSO; either may also forward plain ADIF records.
+func (f *Formatter) parseMacLog(message string, msgType MessageType) (*QSO, error) {
+	loc := f.sourceLocation(msgType)
+	if strings.Contains(strings.ToUpper(message), "<CALL:") {
+		return f.parseADIF(message, loc)
+	}
+
+	var (
+		fields map[string]string
+		err    error
+	)
+	if strings.Contains(message, "<plist") || strings.Contains(message, "<dict>") {
+		fields, err = plistFields(message)
+	} else {
+		fields, err = jsonFields(message)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s message: %w", msgType, err)
+	}
+
+	value := func(field string) string {
+		for _, key := range macLogKeys[field] {
+			if v := strings.TrimSpace(fields[macLogKey(key)]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	qso := newQSO()
+	qso.Callsign = strings.ToUpper(value("call"))
+	qso.Frequency = value("freq")
+	qso.Band = strings.ToLower(value("band"))
+	qso.Mode = strings.ToUpper(value("mode"))
+	qso.RST_Sent = value("rst_sent")
+	qso.RST_Rcvd = value("rst_rcvd")
+	qso.Exchange = value("exchange")
+	qso.Comment = value("comment")
+
+	// A plist <date> under a "date" key is a full timestamp, an ADIF-style
+	// QSO_DATE needs the time added
+	if t, ok := macLogTimestamp(loc, value("timestamp"), value("date")); ok {
+		qso.DateTime = t
+	} else if t, ok := textLogTime(value("date"), value("time"), loc); ok {
+		qso.DateTime = t
+	}
+
+	normalizeFrequency(qso, 0)
+
+	if qso.Callsign == "" {
+		return nil, fmt.Errorf("no callsign found in %s message", msgType)
+	}
+
+	return qso, nil
+}
+
+// macLogTimestamp parses the first value that is a complete timestamp
+func macLogTimestamp(loc *time.Location, values ...string) (time.Time, bool) {
+	for _, v := range values {
+		for _, layout := range macLogTimestampLayouts {
+			if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// macLogKey normalizes a key for lookup in macLogKeys
+func macLogKey(key string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// jsonFields flattens a JSON object into normalized key/value strings.
+// Nested objects (e.g. {"app":"RUMlogNG","qso":{...}}) are merged in.
+func jsonFields(message string) (map[string]string, error) {
+	start := strings.Index(message, "{")
+	if start < 0 {
+		return nil, fmt.Errorf("no JSON object found")
+	}
+
+	var object map[string]any
+	if err := json.NewDecoder(strings.NewReader(message[start:])).Decode(&object); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	var walk func(map[string]any)
+	walk = func(object map[string]any) {
+		for key, v := range object {
+			switch v := v.(type) {
+			case map[string]any:
+				walk(v)
+			case string:
+				fields[macLogKey(key)] = v
+			case float64, bool:
+				fields[macLogKey(key)] = fmt.Sprint(v)
+			}
+		}
+	}
+	walk(object)
+	return fields, nil
+}
+
+// plistFields collects the <key>/<value> pairs of an XML property list,
+// including those of nested dictionaries
+func plistFields(message string) (map[string]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(message))
+	decoder.Strict = false
+
+	fields := make(map[string]string)
+	var key string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "plist", "dict", "array":
+			continue
+		case "true", "false":
+			if key != "" {
+				fields[macLogKey(key)] = start.Name.Local
+				key = ""
+			}
+			continue
+		}
+
+		var text string
+		if err := decoder.DecodeElement(&text, &start); err != nil {
+			return nil, err
+		}
+		if start.Name.Local == "key" {
+			key = text
+		} else if key != "" {
+			fields[macLogKey(key)] = text
+			key = ""
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no plist keys found")
+	}
+	return fields, nil
+}
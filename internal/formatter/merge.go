@@ -0,0 +1,49 @@
+package formatter
+
+import (
+	"strings"
+	"time"
+)
+
+// DedupKey identifies a contact across the messages different programs, or
+// one program, send for it: the callsign, band and the UTC minute the QSO
+// started. The mode is left out since programs name it differently, e.g.
+// WSJT-X logs FT4 as MFSK in ADIF.
+func (q *QSO) DedupKey() string {
+	return strings.Join([]string{
+		strings.ToUpper(q.Callsign),
+		strings.ToLower(q.Band),
+		q.DateTime.UTC().Truncate(time.Minute).Format("200601021504"),
+	}, "|")
+}
+
+// Merge fills the fields q lacks from other, a second message for the same
+// contact, and reports whether it filled any. Fields q already has are kept.
+func (q *QSO) Merge(other *QSO) (changed bool) {
+	if q.FrequencyHz == 0 && other.FrequencyHz != 0 {
+		q.Frequency, q.FrequencyHz = other.Frequency, other.FrequencyHz
+		changed = true
+	}
+	if q.SerialSent == 0 && other.SerialSent != 0 {
+		q.SerialSent = other.SerialSent
+		changed = true
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&q.Mode, &other.Mode},
+		{&q.Band, &other.Band},
+		{&q.RST_Sent, &other.RST_Sent},
+		{&q.RST_Rcvd, &other.RST_Rcvd},
+		{&q.Exchange, &other.Exchange},
+		{&q.ExchangeSent, &other.ExchangeSent},
+		{&q.Comment, &other.Comment},
+		{&q.Grid, &other.Grid},
+		{&q.MyGrid, &other.MyGrid},
+		{&q.MyCall, &other.MyCall},
+	} {
+		if *f.dst == "" && *f.src != "" {
+			*f.dst = *f.src
+			changed = true
+		}
+	}
+	return changed
+}
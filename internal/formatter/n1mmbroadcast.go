@@ -0,0 +1,86 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of N1MM broadcasts that aren't contacts, as named in the
+// formatting.n1mm_broadcasts settings
+const (
+	N1MMBroadcastRadioInfo  = "radioinfo"
+	N1MMBroadcastSpot       = "spot"
+	N1MMBroadcastLookupInfo = "lookupinfo"
+	N1MMBroadcastScore      = "score"
+	N1MMBroadcastAppInfo    = "appinfo"
+)
+
+// n1mmBroadcastRoots maps the root element of each kind, lower case, to
+// the kind
+var n1mmBroadcastRoots = map[string]string{
+	"radioinfo":      N1MMBroadcastRadioInfo,
+	"spot":           N1MMBroadcastSpot,
+	"lookupinfo":     N1MMBroadcastLookupInfo,
+	"dynamicresults": N1MMBroadcastScore,
+	"appinfo":        N1MMBroadcastAppInfo,
+}
+
+// ErrN1MMSpotDeleted is returned for a spot N1MM removed from its band map
+var ErrN1MMSpotDeleted = errors.New("N1MM spot removed from the band map")
+
+// N1MMBroadcastKind returns the kind of an N1MM broadcast other than a
+// contact from its root element, or "" for anything else
+func N1MMBroadcastKind(message string) string {
+	rest := strings.TrimSpace(message)
+	for strings.HasPrefix(rest, "<?") || strings.HasPrefix(rest, "<!") {
+		end := strings.Index(rest, ">")
+		if end < 0 {
+			return ""
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	if !strings.HasPrefix(rest, "<") {
+		return ""
+	}
+	name := rest[1:]
+	if end := strings.IndexAny(name, " \t\r\n/>"); end >= 0 {
+		name = name[:end]
+	}
+	return n1mmBroadcastRoots[strings.ToLower(name)]
+}
+
+// ParseN1MMSpot converts an N1MM band map spot to a spot QSO
+func ParseN1MMSpot(message string) (*QSO, error) {
+	var spot n1mmSpot
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(message)), &spot); err != nil {
+		return nil, fmt.Errorf("failed to parse N1MM spot XML: %w", err)
+	}
+	if strings.EqualFold(strings.TrimSpace(spot.Action), "delete") {
+		return nil, ErrN1MMSpotDeleted
+	}
+	call := strings.ToUpper(strings.TrimSpace(spot.DXCall))
+	if call == "" {
+		return nil, fmt.Errorf("no callsign found in N1MM spot")
+	}
+
+	qso := newQSO()
+	qso.Action = ActionSpot
+	qso.Callsign = call
+	qso.Mode = strings.TrimSpace(spot.Mode)
+	qso.Comment = strings.TrimSpace(spot.Comment)
+	if khz, err := strconv.ParseFloat(strings.TrimSpace(spot.Frequency), 64); err == nil && khz > 0 {
+		qso.FrequencyHz = int64(khz*1000 + 0.5)
+		qso.Frequency = FormatMHz(qso.FrequencyHz)
+		qso.Band = FrequencyToBand(khz / 1000)
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(spot.Timestamp)); err == nil {
+		qso.DateTime = t
+	} else {
+		qso.DateTime = time.Now().UTC()
+	}
+	return qso, nil
+}
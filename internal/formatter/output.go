@@ -0,0 +1,182 @@
+package formatter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutputFormat selects the serializer used for a target
+type OutputFormat string
+
+const (
+	OutputFormatN1MM    OutputFormat = "n1mm"    // N1MM Logger Plus contactinfo XML
+	OutputFormatWinTest OutputFormat = "wintest" // Win-Test network ADDQSO message
+	OutputFormatDXLog   OutputFormat = "dxlog"   // DXLog.net UDP ADIF QSO record
+	OutputFormatADIF    OutputFormat = "adif"    // Plain ADIF record
+	OutputFormatRelay   OutputFormat = "relay"   // Normalized QSO JSON for another relay
+)
+
+// ValidOutputFormat reports whether name is a supported output format
+func ValidOutputFormat(name string) bool {
+	switch OutputFormat(strings.ToLower(name)) {
+	case OutputFormatN1MM, OutputFormatWinTest, OutputFormatDXLog, OutputFormatADIF, OutputFormatRelay:
+		return true
+	}
+	return false
+}
+
+// Format serializes a QSO in the requested output format. An empty format means N1MM.
+// Corrections, deletions and spots can only be sent as N1MM XML or to another relay.
+// N1MM and ADIF output carry the relay's loop marker. With StrictADIF, ADIF
+// output that fails validation is refused.
+func (f *Formatter) Format(qso *QSO, format OutputFormat) (string, error) {
+	format = OutputFormat(strings.ToLower(string(format)))
+	if qso.Action != ActionLog && format != OutputFormatN1MM && format != "" && format != OutputFormatRelay {
+		if qso.Action == ActionSpot {
+			return "", fmt.Errorf("%s output can't carry spots", format)
+		}
+		return "", fmt.Errorf("%s output can't %s QSOs", format, qso.Action)
+	}
+
+	var output string
+	var err error
+	switch format {
+	case OutputFormatN1MM, "":
+		output, err = f.FormatForN1MM(qso)
+	case OutputFormatWinTest:
+		output, err = f.FormatForWinTest(qso)
+	case OutputFormatDXLog, OutputFormatADIF:
+		output, err = f.FormatADIF(qso)
+	case OutputFormatRelay:
+		return f.FormatRelay(qso)
+	default:
+		return "", fmt.Errorf("unknown output format: %s", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	output = f.markOutput(output, qso, format)
+	if f.opts.StrictADIF && (format == OutputFormatDXLog || format == OutputFormatADIF) {
+		if problems := ValidateADIF(output); len(problems) > 0 {
+			return "", &ADIFError{Record: output, Problems: problems}
+		}
+	}
+	return output, nil
+}
+
+// FormatForWinTest converts a QSO to a Win-Test network ADDQSO message.
+//
+// Win-Test messages are plain text of the form
+//
+//	COMMAND: "from" "to" args...
+//
+// followed by a one byte checksum (the sum of all preceding bytes with the
+// high bit set) and a terminating NUL.
+func (f *Formatter) FormatForWinTest(qso *QSO) (string, error) {
+	if qso.Callsign == "" {
+		return "", fmt.Errorf("cannot format QSO without callsign")
+	}
+
+	// Win-Test carries frequencies in tenths of kHz
+	freqTenthsKHz := qso.Hz() / 100
+
+	station, operator, _ := f.identity(qso)
+
+	body := fmt.Sprintf(`ADDQSO: "%s" "" %d %d "%s" "%s" "%s" "%s" "%s" "%s" "%s"`,
+		station,
+		qso.DateTime.UTC().Unix(),
+		freqTenthsKHz,
+		qso.Band,
+		qso.Mode,
+		qso.Callsign,
+		qso.RST_Sent,
+		qso.RST_Rcvd,
+		qso.Exchange,
+		operator,
+	)
+
+	return body + string(winTestChecksum(body)) + "\x00", nil
+}
+
+// winTestChecksum computes the Win-Test message checksum byte
+func winTestChecksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum += body[i]
+	}
+	return sum | 0x80
+}
+
+// FormatADIF converts a QSO to a single ADIF record terminated by <eor>.
+// DXLog.net and most other loggers accept this over UDP.
+func (f *Formatter) FormatADIF(qso *QSO) (string, error) {
+	if qso.Callsign == "" {
+		return "", fmt.Errorf("cannot format QSO without callsign")
+	}
+
+	t := qso.DateTime.UTC()
+	if qso.DateTime.IsZero() {
+		t = time.Now().UTC()
+	}
+
+	var b strings.Builder
+	writeADIFField(&b, "CALL", qso.Callsign)
+	writeADIFField(&b, "PFX", WPXPrefix(qso.Callsign))
+	writeADIFField(&b, "QSO_DATE", t.Format("20060102"))
+	writeADIFField(&b, "TIME_ON", t.Format("150405"))
+	writeADIFField(&b, "BAND", adifBandOf(qso))
+	mode, submode := adifMode(qso.Mode)
+	writeADIFField(&b, "MODE", mode)
+	writeADIFField(&b, "SUBMODE", submode)
+	if hz := qso.Hz(); hz > 0 {
+		writeADIFField(&b, "FREQ", fmt.Sprintf("%.6f", float64(hz)/1e6))
+	}
+	writeADIFField(&b, "RST_SENT", qso.RST_Sent)
+	writeADIFField(&b, "RST_RCVD", qso.RST_Rcvd)
+	exchange := f.contestExchange(qso)
+	writeADIFField(&b, "SRX", exchange.Serial)
+	writeADIFField(&b, "SRX_STRING", qso.Exchange)
+	if qso.SerialSent > 0 {
+		writeADIFField(&b, "STX", strconv.Itoa(qso.SerialSent))
+	}
+	writeADIFField(&b, "STX_STRING", qso.ExchangeSent)
+	writeADIFField(&b, "SKCC", exchange.SKCC)
+	writeADIFField(&b, "NAME", exchange.Name)
+	switch {
+	case exchange.Class != "":
+		// Field Day sections are ARRL sections, not states
+		writeADIFField(&b, "CLASS", exchange.Class)
+		writeADIFField(&b, "ARRL_SECT", exchange.Section)
+	case usStates[exchange.Section]:
+		writeADIFField(&b, "STATE", exchange.Section)
+		if exchange.County != "" {
+			writeADIFField(&b, "CNTY", exchange.Section+","+exchange.County)
+		}
+	case canadianProvinces[exchange.Section]:
+		writeADIFField(&b, "VE_PROV", exchange.Section)
+	}
+	if qso.Grid != "" {
+		writeADIFField(&b, "GRIDSQUARE", qso.Grid)
+	} else {
+		writeADIFField(&b, "GRIDSQUARE", exchange.Grid)
+	}
+	writeADIFField(&b, "COMMENT", qso.Comment)
+	station, operator, contest := f.identity(qso)
+	writeADIFField(&b, "STATION_CALLSIGN", station)
+	writeADIFField(&b, "OPERATOR", operator)
+	writeADIFField(&b, "CONTEST_ID", contest)
+	writeADIFField(&b, "MY_GRIDSQUARE", qso.MyGrid)
+	b.WriteString("<EOR>")
+
+	return b.String(), nil
+}
+
+// writeADIFField appends <NAME:len>value, skipping empty values
+func writeADIFField(b *strings.Builder, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(b, "<%s:%d>%s ", name, len(value), value)
+}
@@ -0,0 +1,27 @@
+package formatter
+
+import (
+	"sync"
+	"time"
+)
+
+// qsoPool recycles QSO structs so that bursts of traffic (FT8 fox/hound
+// cycles and the like) do not allocate a new record for every message
+var qsoPool = sync.Pool{
+	New: func() interface{} { return new(QSO) },
+}
+
+// newQSO returns an empty QSO from the pool, stamped with the current time
+// as a fallback for messages that carry none
+func newQSO() *QSO {
+	qso := qsoPool.Get().(*QSO)
+	qso.DateTime = time.Now()
+	return qso
+}
+
+// ReleaseQSO returns a QSO obtained from ParseMessage to the pool. The caller
+// must not use the QSO, or keep any pointer to it, afterwards.
+func ReleaseQSO(qso *QSO) {
+	*qso = QSO{}
+	qsoPool.Put(qso)
+}
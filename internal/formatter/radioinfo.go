@@ -0,0 +1,79 @@
+package formatter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// N1MMRadioInfo is the RadioInfo message N1MM Logger Plus broadcasts when a
+// radio's frequency or mode changes. Frequencies are in tens of Hz.
+type N1MMRadioInfo struct {
+	XMLName        xml.Name `xml:"RadioInfo"`
+	App            string   `xml:"app"`
+	StationName    string   `xml:"StationName"`
+	RadioNr        int      `xml:"RadioNr"`
+	Freq           string   `xml:"Freq"`
+	TXFreq         string   `xml:"TXFreq"`
+	Mode           string   `xml:"Mode"`
+	OpCall         string   `xml:"OpCall"`
+	IsRunning      string   `xml:"IsRunning"`
+	FocusEntry     string   `xml:"FocusEntry"`
+	Antenna        string   `xml:"Antenna"`
+	Rotors         string   `xml:"Rotors"`
+	FocusRadioNr   string   `xml:"FocusRadioNr"`
+	IsStereo       string   `xml:"IsStereo"`
+	IsSplit        string   `xml:"IsSplit"`
+	ActiveRadioNr  string   `xml:"ActiveRadioNr"`
+	IsTransmitting string   `xml:"IsTransmitting"`
+	RadioName      string   `xml:"RadioName"`
+}
+
+// IsRadioInfo reports whether a datagram is an N1MM RadioInfo message
+func IsRadioInfo(message string) bool {
+	return strings.Contains(message, "<RadioInfo")
+}
+
+// ParseRadioInfo decodes an N1MM RadioInfo message
+func ParseRadioInfo(message string) (*N1MMRadioInfo, error) {
+	var info N1MMRadioInfo
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(message)), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse RadioInfo XML: %w", err)
+	}
+	return &info, nil
+}
+
+// FrequencyHz returns the receive frequency in Hz, or 0 if it is missing
+func (ri *N1MMRadioInfo) FrequencyHz() int64 {
+	tens, err := strconv.ParseInt(strings.TrimSpace(ri.Freq), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return tens * 10
+}
+
+// FormatRadioInfo builds an N1MM RadioInfo message for the configured radio
+// tuned to hz in the given mode, identifying the configured station and
+// operator
+func (f *Formatter) FormatRadioInfo(hz int64, mode string) (string, error) {
+	stationName, _, radioNr := f.network(&QSO{}, f.station)
+	info := N1MMRadioInfo{
+		App:            f.appName(),
+		StationName:    stationName,
+		RadioNr:        radioNr,
+		Freq:           n1mmFrequency(hz),
+		TXFreq:         n1mmFrequency(hz),
+		Mode:           mode,
+		OpCall:         f.operator,
+		IsRunning:      "False",
+		FocusEntry:     "0",
+		Antenna:        "0",
+		FocusRadioNr:   strconv.Itoa(radioNr),
+		IsStereo:       "False",
+		IsSplit:        "False",
+		ActiveRadioNr:  strconv.Itoa(radioNr),
+		IsTransmitting: "False",
+	}
+	return f.marshalXML(info)
+}
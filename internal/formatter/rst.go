@@ -0,0 +1,129 @@
+package formatter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// phoneModes use two-digit RS reports (59)
+var phoneModes = map[string]bool{
+	"SSB": true, "USB": true, "LSB": true, "AM": true, "FM": true,
+	"DIGITALVOICE": true, "DV": true, "C4FM": true, "DSTAR": true, "DMR": true,
+}
+
+// dbModes report signal-to-noise in dB (-24 .. +20) rather than RST
+var dbModes = map[string]bool{
+	"FT8": true, "FT4": true, "JT65": true, "JT9": true, "JT4": true,
+	"MSK144": true, "Q65": true, "FST4": true, "FST4W": true, "JS8": true,
+}
+
+// IsPhoneMode reports whether a mode is a voice mode
+func IsPhoneMode(mode string) bool {
+	return phoneModes[strings.ToUpper(strings.TrimSpace(mode))]
+}
+
+// DefaultReport returns the report used for a mode when the source supplied none
+func (f *Formatter) DefaultReport(mode string) string {
+	mode = strings.ToUpper(strings.TrimSpace(mode))
+
+	if report, ok := f.opts.RSTDefaults[mode]; ok {
+		return report
+	}
+
+	switch {
+	case phoneModes[mode]:
+		return "59"
+	case dbModes[mode]:
+		return "+00"
+	default:
+		return "599"
+	}
+}
+
+// applyReportRules fills in missing reports and normalizes dB reports for the QSO's mode
+func (f *Formatter) applyReportRules(qso *QSO) {
+	if qso.RST_Sent == "" {
+		qso.RST_Sent = f.DefaultReport(qso.Mode)
+	}
+	if qso.RST_Rcvd == "" {
+		qso.RST_Rcvd = f.DefaultReport(qso.Mode)
+	}
+
+	if f.opts.NormalizeDBReports && dbModes[strings.ToUpper(qso.Mode)] {
+		qso.RST_Sent = normalizeDBReport(qso.RST_Sent)
+		qso.RST_Rcvd = normalizeDBReport(qso.RST_Rcvd)
+	}
+}
+
+// normalizeDBReport formats a dB report as a sign followed by two digits.
+// Reports that are not plain integers are returned unchanged.
+func normalizeDBReport(report string) string {
+	db, err := strconv.Atoi(strings.TrimSpace(report))
+	if err != nil {
+		return report
+	}
+	if db < 0 {
+		return fmt.Sprintf("-%02d", -db)
+	}
+	return fmt.Sprintf("+%02d", db)
+}
+
+// SNRReportStyle selects how dB reports are written for loggers that reject
+// them in RST fields
+type SNRReportStyle string
+
+const (
+	SNRKeep      SNRReportStyle = ""        // Send dB reports as they are
+	SNRAsRST     SNRReportStyle = "rst"     // Replace dB reports with 599
+	SNRInComment SNRReportStyle = "comment" // Replace them with 599 and note the dB reports in the comment
+)
+
+// ValidSNRReportStyle reports whether name is a supported SNR report style
+func ValidSNRReportStyle(name string) bool {
+	switch SNRReportStyle(strings.ToLower(name)) {
+	case SNRKeep, "keep", SNRAsRST, SNRInComment:
+		return true
+	}
+	return false
+}
+
+// ConvertSNRReports returns the QSO with its dB reports written in the given
+// style. The QSO is shared by every target, so a converted copy is returned
+// and qso itself is left alone.
+func ConvertSNRReports(qso *QSO, style SNRReportStyle) *QSO {
+	style = SNRReportStyle(strings.ToLower(string(style)))
+	if style != SNRAsRST && style != SNRInComment {
+		return qso
+	}
+	sent, rcvd := isSNRReport(qso.RST_Sent, qso.Mode), isSNRReport(qso.RST_Rcvd, qso.Mode)
+	if !sent && !rcvd {
+		return qso
+	}
+
+	converted := *qso
+	var notes []string
+	if sent {
+		notes = append(notes, "sent "+qso.RST_Sent)
+		converted.RST_Sent = "599"
+	}
+	if rcvd {
+		notes = append(notes, "rcvd "+qso.RST_Rcvd)
+		converted.RST_Rcvd = "599"
+	}
+	if style == SNRInComment {
+		converted.Comment = strings.TrimSpace(qso.Comment + " SNR " + strings.Join(notes, " "))
+	}
+	return &converted
+}
+
+// isSNRReport reports whether a report is in dB: a signed number, or any
+// number in the range of dB reports for a dB mode
+func isSNRReport(report, mode string) bool {
+	report = strings.TrimSpace(report)
+	db, err := strconv.Atoi(report)
+	if err != nil || db < -50 || db > 50 {
+		return false
+	}
+	return strings.HasPrefix(report, "-") || strings.HasPrefix(report, "+") || dbModes[strings.ToUpper(mode)]
+}
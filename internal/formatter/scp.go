@@ -0,0 +1,164 @@
+package formatter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SCP is a Super Check Partial database of known active callsigns, as
+// distributed in MASTER.SCP files
+type SCP struct {
+	calls map[string]struct{}
+}
+
+// LoadSCP reads a MASTER.SCP file: one callsign per line, lines starting
+// with '#' are comments
+func LoadSCP(path string) (*SCP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SCP file: %w", err)
+	}
+	defer file.Close()
+
+	scp := &SCP{calls: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		scp.calls[strings.ToUpper(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read SCP file: %w", err)
+	}
+
+	return scp, nil
+}
+
+// NewSCP builds a database from a list of callsigns
+func NewSCP(calls []string) *SCP {
+	scp := &SCP{calls: make(map[string]struct{}, len(calls))}
+	for _, call := range calls {
+		scp.calls[strings.ToUpper(call)] = struct{}{}
+	}
+	return scp
+}
+
+// Len returns the number of callsigns in the database
+func (s *SCP) Len() int {
+	return len(s.calls)
+}
+
+// Known reports whether the callsign, or any part of a portable callsign
+// such as VP2E/K1ABC, is in the database
+func (s *SCP) Known(call string) bool {
+	call = strings.ToUpper(call)
+	if _, ok := s.calls[call]; ok {
+		return true
+	}
+	for _, part := range strings.Split(call, "/") {
+		if _, ok := s.calls[part]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Similar returns the known callsigns closest to call that are at most
+// maxDistance edits away, sorted alphabetically. Only the nearest distance
+// found is returned, so one-off matches hide two-off ones.
+func (s *SCP) Similar(call string, maxDistance int) []string {
+	call = strings.ToUpper(call)
+	best := maxDistance + 1
+	var matches []string
+
+	for known := range s.calls {
+		if abs(len(known)-len(call)) > maxDistance {
+			continue
+		}
+		d := EditDistance(call, known)
+		if d == 0 || d > best {
+			continue
+		}
+		if d < best {
+			best = d
+			matches = matches[:0]
+		}
+		matches = append(matches, known)
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+// checkSCP flags callsigns missing from the SCP database that are close to a
+// known call, and corrects them when there is a single candidate and
+// SCPAutoCorrect is set. Notes are appended to the QSO comment.
+func (f *Formatter) checkSCP(qso *QSO) {
+	scp := f.opts.SCP
+	if scp == nil || qso.Callsign == "" || scp.Known(qso.Callsign) {
+		return
+	}
+
+	maxDistance := f.opts.SCPMaxDistance
+	if maxDistance <= 0 {
+		maxDistance = 1
+	}
+
+	candidates := scp.Similar(qso.Callsign, maxDistance)
+	switch {
+	case len(candidates) == 0:
+		return
+	case len(candidates) == 1 && f.opts.SCPAutoCorrect:
+		qso.addComment(fmt.Sprintf("SCP: corrected from %s", qso.Callsign))
+		qso.Callsign = candidates[0]
+	default:
+		if len(candidates) > 5 {
+			candidates = candidates[:5]
+		}
+		qso.addComment(fmt.Sprintf("SCP: %s not in MASTER.SCP, check %s", qso.Callsign, strings.Join(candidates, " ")))
+	}
+}
+
+// addComment appends a note to the QSO comment
+func (q *QSO) addComment(note string) {
+	if q.Comment == "" {
+		q.Comment = note
+		return
+	}
+	q.Comment += "; " + note
+}
+
+// EditDistance returns the Levenshtein distance between two strings
+func EditDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+var (
+	eorRegex         = regexp.MustCompile(`(?i)<eor>`)
+	contactInfoRegex = regexp.MustCompile(`(?s)<contactinfo[\s>].*?</contactinfo>`)
+)
+
+// SplitRecords splits a datagram that carries several QSOs (multiple ADIF
+// records, several N1MM contactinfo documents, or a batch of JSON objects)
+// into one message per QSO. A datagram with a single record is returned
+// unchanged, so it parses exactly as before, as is one too large to parse.
+func SplitRecords(message string) []string {
+	if len(message) > MaxMessageSize {
+		return []string{message}
+	}
+	if records := splitADIF(message); len(records) > 1 {
+		return records
+	}
+	if records := contactInfoRegex.FindAllString(message, -1); len(records) > 1 {
+		return records
+	}
+	if records := splitJSON(message); len(records) > 1 {
+		return records
+	}
+	return []string{message}
+}
+
+// splitADIF cuts after each <EOR>. Anything before the first record (the
+// ADIF header or a WSJT-X binary header) stays with the first record, and
+// pieces without a CALL field are dropped.
+func splitADIF(message string) []string {
+	ends := eorRegex.FindAllStringIndex(message, -1)
+	if len(ends) < 2 {
+		return nil
+	}
+
+	var records []string
+	start := 0
+	for _, end := range ends {
+		record := message[start:end[1]]
+		start = end[1]
+		if strings.Contains(strings.ToUpper(record), "<CALL:") {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// splitJSON handles a JSON array of objects or several concatenated objects
+func splitJSON(message string) []string {
+	trimmed := strings.TrimSpace(message)
+	if trimmed == "" {
+		return nil
+	}
+
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &items); err != nil {
+			return nil
+		}
+		records := make([]string, 0, len(items))
+		for _, item := range items {
+			records = append(records, string(item))
+		}
+		return records
+	}
+
+	if trimmed[0] != '{' {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(trimmed)))
+	var records []string
+	for decoder.More() {
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return nil
+		}
+		records = append(records, string(item))
+	}
+	return records
+}
@@ -0,0 +1,191 @@
+package formatter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MessageTypeTextLog is a single-line text log described by a TextLog format
+const MessageTypeTextLog MessageType = "textlog"
+
+// textLogFields are the placeholders a TextLog format may use
+var textLogFields = map[string]bool{
+	"call":     true,
+	"freq":     true,
+	"band":     true,
+	"mode":     true,
+	"date":     true,
+	"time":     true,
+	"rst_sent": true,
+	"rst_rcvd": true,
+	"exchange": true,
+	"comment":  true,
+	"skip":     true,
+}
+
+// textLogDateLayouts are the date forms accepted for {date}
+var textLogDateLayouts = []string{"20060102", "2006-01-02", "2006/01/02", "2006.01.02", "02-Jan-2006", "02-Jan-06"}
+
+// textLogTimeLayouts are the time forms accepted for {time}
+var textLogTimeLayouts = []string{"150405", "1504", "15:04:05", "15:04"}
+
+var (
+	textLogPlaceholderRegex = regexp.MustCompile(`\{([a-z_]+)\}`)
+	textLogSpaceRegex       = regexp.MustCompile(`\s+`)
+)
+
+// TextLog parses log lines from legacy programs (DigiPan, MixW, ...) that
+// send one plain text line per QSO. The format names the fields in order,
+// e.g. "{date} {time} {call} {freq} {mode} {rst_sent} {rst_rcvd}"; text
+// between placeholders must appear literally, and a space matches any run
+// of whitespace. {skip} matches a field that is ignored.
+type TextLog struct {
+	format string
+	regex  *regexp.Regexp
+	fields []string
+}
+
+// CompileTextLog checks a TextLog format and prepares it for matching
+func CompileTextLog(format string) (*TextLog, error) {
+	format = strings.TrimSpace(format)
+	if format == "" {
+		return nil, fmt.Errorf("empty text log format")
+	}
+
+	var (
+		pattern strings.Builder
+		fields  []string
+		hasCall bool
+	)
+	pattern.WriteString(`^\s*`)
+
+	literal := func(text string) {
+		for i, part := range strings.Split(textLogSpaceRegex.ReplaceAllString(text, " "), " ") {
+			if i > 0 {
+				pattern.WriteString(`\s+`)
+			}
+			pattern.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+
+	last := 0
+	for _, loc := range textLogPlaceholderRegex.FindAllStringSubmatchIndex(format, -1) {
+		field := format[loc[2]:loc[3]]
+		if !textLogFields[field] {
+			return nil, fmt.Errorf("unknown text log field {%s}", field)
+		}
+		if loc[0] == last && len(fields) > 0 {
+			return nil, fmt.Errorf("text log fields {%s} and {%s} need a delimiter between them", fields[len(fields)-1], field)
+		}
+		literal(format[last:loc[0]])
+		pattern.WriteString(`(.*?)`)
+		fields = append(fields, field)
+		hasCall = hasCall || field == "call"
+		last = loc[1]
+	}
+	literal(format[last:])
+	pattern.WriteString(`\s*$`)
+
+	if !hasCall {
+		return nil, fmt.Errorf("text log format %q has no {call} field", format)
+	}
+
+	regex, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid text log format %q: %w", format, err)
+	}
+	return &TextLog{format: format, regex: regex, fields: fields}, nil
+}
+
+// Match reports whether a line has the shape of the format
+func (t *TextLog) Match(line string) bool {
+	return t.regex.MatchString(line)
+}
+
+// parseTextLog parses a line using the configured TextLog format
+func (f *Formatter) parseTextLog(message string) (*QSO, error) {
+	if f.opts.TextLog == nil {
+		return nil, fmt.Errorf("no text log format configured")
+	}
+
+	match := f.opts.TextLog.regex.FindStringSubmatch(message)
+	if match == nil {
+		return nil, fmt.Errorf("line does not match text log format %q", f.opts.TextLog.format)
+	}
+
+	qso := newQSO()
+	var date, clock string
+	for i, field := range f.opts.TextLog.fields {
+		value := strings.TrimSpace(match[i+1])
+		switch field {
+		case "call":
+			qso.Callsign = strings.ToUpper(value)
+		case "freq":
+			qso.Frequency = value
+		case "band":
+			qso.Band = strings.ToLower(value)
+		case "mode":
+			qso.Mode = strings.ToUpper(value)
+		case "date":
+			date = value
+		case "time":
+			clock = strings.TrimRight(value, "Zz")
+		case "rst_sent":
+			qso.RST_Sent = value
+		case "rst_rcvd":
+			qso.RST_Rcvd = value
+		case "exchange":
+			qso.Exchange = value
+		case "comment":
+			qso.Comment = value
+		}
+	}
+
+	if t, ok := textLogTime(date, clock, f.sourceLocation(MessageTypeTextLog)); ok {
+		qso.DateTime = t
+	}
+
+	normalizeFrequency(qso, 0)
+
+	if qso.Callsign == "" {
+		return nil, fmt.Errorf("no callsign found in text log line")
+	}
+
+	return qso, nil
+}
+
+// textLogTime combines a {date} and {time} value. A missing date means
+// today; a missing or unreadable time leaves the receive time in place.
+func textLogTime(date, clock string, loc *time.Location) (time.Time, bool) {
+	if clock == "" {
+		return time.Time{}, false
+	}
+
+	var day time.Time
+	if date == "" {
+		now := time.Now().In(loc)
+		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	} else {
+		parsed := false
+		for _, layout := range textLogDateLayouts {
+			if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+				day, parsed = t, true
+				break
+			}
+		}
+		if !parsed {
+			return time.Time{}, false
+		}
+	}
+
+	for _, layout := range textLogTimeLayouts {
+		if t, err := time.Parse(layout, clock); err == nil {
+			return day.Add(time.Duration(t.Hour())*time.Hour +
+				time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second), true
+		}
+	}
+	return time.Time{}, false
+}
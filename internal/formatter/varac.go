@@ -0,0 +1,41 @@
+package formatter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// VarAC events are broadcasts about stations heard on the air rather than
+// logged QSOs
+const (
+	VarACBeacon = "beacon"
+	VarACPing   = "ping"
+	VarACCQ     = "cq"
+)
+
+var (
+	varacJSONEventRegex = regexp.MustCompile(`"(?:type|event|command)"\s*:\s*"(?i:(beacon|ping|cq))"`)
+	varacTextEventRegex = regexp.MustCompile(`(?i)\b(beacon|ping|cq)\b`)
+	varacEventCallRegex = regexp.MustCompile(`(?i)\b(?:de|from)\s+([A-Z0-9/]+)`)
+)
+
+// varacEvent returns the kind of event a JSON or text VarAC message
+// announces, or "" for a QSO. A text message that mentions a QSO or the log
+// is a QSO even if it also mentions a CQ.
+func varacEvent(message string, isJSON bool) string {
+	if isJSON {
+		if match := varacJSONEventRegex.FindStringSubmatch(message); len(match) > 1 {
+			return strings.ToLower(match[1])
+		}
+		return ""
+	}
+
+	upper := strings.ToUpper(message)
+	if strings.Contains(upper, "QSO") || strings.Contains(upper, "LOG") {
+		return ""
+	}
+	if match := varacTextEventRegex.FindStringSubmatch(message); len(match) > 1 {
+		return strings.ToLower(match[1])
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package formatter
+
+import (
+	"strings"
+)
+
+// WPXPrefix derives the CQ WPX prefix of a callsign:
+//
+//   - the letters and digits up to the last digit before the suffix
+//     (W8ABC -> W8, WD8ABC -> WD8, HG19ABC -> HG19, 3D2CR -> 3D2)
+//   - a stroke prefix replaces it (N8BJQ/KH9 -> KH9, VP2E/K1ABC -> VP2E)
+//   - a prefix without a digit gets a zero (PA/N8BJQ -> PA0, RAEM -> RA0)
+//   - a call area suffix replaces the digit (N8BJQ/3 -> N3)
+//   - /P, /M, /MM, /AM, /QRP and similar designators are ignored
+//
+// It returns "" if no prefix can be derived.
+func WPXPrefix(call string) string {
+	call = SanitizeCallsign(call)
+	if call == "" {
+		return ""
+	}
+	parts := strings.Split(call, "/")
+
+	// Find the base call the same way ValidCallsign does; fall back to the
+	// longest part for unusual special-event calls
+	base := -1
+	for i, part := range parts {
+		if validBaseCall(part) && (base < 0 || len(part) > len(parts[base])) {
+			base = i
+		}
+	}
+	if base < 0 {
+		for i, part := range parts {
+			if base < 0 || len(part) > len(parts[base]) {
+				base = i
+			}
+		}
+	}
+
+	prefix := basePrefix(parts[base])
+
+	for i, part := range parts {
+		switch {
+		case i == base || part == "" || portableDesignators[part]:
+		case len(part) == 1 && isDigit(part[0]):
+			// Call area change keeps the letters: N8BJQ/3 -> N3
+			prefix = strings.TrimRight(prefix, "0123456789") + part
+		default:
+			prefix = strokePrefix(part)
+		}
+	}
+
+	return prefix
+}
+
+// RedactCallsign masks a callsign for outputs the public may see, keeping
+// the base call's prefix so the country still shows and any portable
+// designator: W1ABC -> W1***, VE3XYZ/P -> VE3***/P. A call without a
+// recognizable base call keeps its first two characters.
+func RedactCallsign(call string) string {
+	call = SanitizeCallsign(call)
+	parts := strings.Split(call, "/")
+	base := -1
+	for i, part := range parts {
+		if validBaseCall(part) && (base < 0 || len(part) > len(parts[base])) {
+			base = i
+		}
+	}
+	if base < 0 {
+		keep := min(2, len(call))
+		return call[:keep] + strings.Repeat("*", len(call)-keep)
+	}
+
+	keep := len(basePrefix(parts[base]))
+	parts[base] = parts[base][:keep] + strings.Repeat("*", len(parts[base])-keep)
+	return strings.Join(parts, "/")
+}
+
+// basePrefix returns the prefix of a call without strokes: everything up to
+// and including the last digit, since the suffix is letters only
+func basePrefix(call string) string {
+	last := -1
+	for i := 0; i < len(call); i++ {
+		if isDigit(call[i]) {
+			last = i
+		}
+	}
+
+	if last < 0 {
+		return noDigitPrefix(call)
+	}
+	return call[:last+1]
+}
+
+// strokePrefix returns the WPX prefix for a prefix written with a stroke
+func strokePrefix(part string) string {
+	if strings.IndexFunc(part, func(r rune) bool { return r >= '0' && r <= '9' }) < 0 {
+		return noDigitPrefix(part)
+	}
+	return part
+}
+
+// noDigitPrefix forms a prefix for calls and designators without a digit by
+// adding a zero after the first two letters
+func noDigitPrefix(s string) string {
+	if len(s) > 2 {
+		s = s[:2]
+	}
+	return s + "0"
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
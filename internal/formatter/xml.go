@@ -0,0 +1,205 @@
+package formatter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// relayApp is the app name the relay puts in the XML it produces unless
+// another is configured
+const relayApp = "N7AKG-UDP-Translator"
+
+// xmlDeclaration matches the declaration N1MM puts on its own broadcasts
+const xmlDeclaration = `<?xml version="1.0" encoding="utf-8"?>`
+
+// XMLStyle controls how N1MM XML output is laid out. The zero value is
+// compact single-line XML without a declaration, in N1MM's element order.
+type XMLStyle struct {
+	// Indent puts each element on its own indented line
+	Indent bool
+
+	// Declaration prefixes each message with the <?xml?> declaration
+	Declaration bool
+
+	// LegacyOrder uses the element layout of earlier relay versions (app as
+	// an attribute, ismult1..3) instead of N1MM's own
+	LegacyOrder bool
+}
+
+// N1MMNetwork identifies the computer QSOs are logged from in an N1MM
+// multi-computer network. N1MM attributes each contact to a PC by its
+// StationName and NetBiosName, so both must name the computer, not the
+// station callsign.
+type N1MMNetwork struct {
+	StationName string // Defaults to the station callsign
+	NetBiosName string // Defaults to StationName when that is set
+	RadioNr     int    // Defaults to 1
+}
+
+// N1MMApp is how the relay identifies itself and its QSOs in N1MM XML
+type N1MMApp struct {
+	// Name goes in the app element; "{version}" is replaced by Version.
+	// Empty uses N7AKG-UDP-Translator.
+	Name    string
+	Version string
+
+	// SendID writes each QSO's ID in the contactinfo ID element
+	SendID bool
+}
+
+// appName returns the app name for the XML the relay produces
+func (f *Formatter) appName() string {
+	name := f.opts.App.Name
+	if name == "" {
+		return relayApp
+	}
+	version := f.opts.App.Version
+	if version == "" {
+		version = "dev"
+	}
+	return strings.ReplaceAll(name, "{version}", version)
+}
+
+// NewQSOID returns a new QSO ID in the form N1MM uses: a GUID as 32
+// lower-case hex digits
+func NewQSOID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(err)
+	}
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return hex.EncodeToString(id[:])
+}
+
+// network returns the N1MM network identity for a QSO: the QSO's own values
+// from a source override, else the configured ones
+func (f *Formatter) network(qso *QSO, station string) (stationName, netBiosName string, radioNr int) {
+	stationName, netBiosName = qso.StationName, qso.NetBiosName
+	if stationName == "" {
+		stationName = f.opts.Network.StationName
+	}
+	if netBiosName == "" {
+		netBiosName = f.opts.Network.NetBiosName
+	}
+	if netBiosName == "" {
+		netBiosName = stationName
+	}
+	if stationName == "" {
+		stationName = station
+	}
+
+	radioNr = qso.RadioNr
+	if radioNr <= 0 {
+		radioNr = f.opts.Network.RadioNr
+	}
+	if radioNr <= 0 {
+		radioNr = 1
+	}
+	return stationName, netBiosName, radioNr
+}
+
+// IsRelayOutput reports whether an XML message was produced by the relay,
+// going by its loop marker or the configured app name
+func (f *Formatter) IsRelayOutput(message string) bool {
+	if f.opts.NodeID != "" && slices.Contains(markedPath(message), f.opts.NodeID) {
+		return true
+	}
+	app := f.appName()
+	return strings.Contains(message, `app="`+app+`"`) ||
+		strings.Contains(message, "<app>"+app+"</app>")
+}
+
+// marshalXML encodes v in the configured XML style
+func (f *Formatter) marshalXML(v any) (string, error) {
+	var (
+		xmlData []byte
+		err     error
+	)
+	if f.opts.XML.Indent {
+		xmlData, err = xml.MarshalIndent(v, "", "  ")
+	} else {
+		xmlData, err = xml.Marshal(v)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal XML: %w", err)
+	}
+
+	if !f.opts.XML.Declaration {
+		return string(xmlData), nil
+	}
+	separator := ""
+	if f.opts.XML.Indent {
+		separator = "\n"
+	}
+	return xmlDeclaration + separator + string(xmlData), nil
+}
+
+// legacyContactInfo is the contactinfo layout earlier relay versions sent
+type legacyContactInfo struct {
+	XMLName       xml.Name `xml:"contactinfo"`
+	App           string   `xml:"app,attr"`
+	Contest       string   `xml:"contestname"`
+	Station       string   `xml:"mycall"`
+	Band          string   `xml:"band"`
+	RXFreq        string   `xml:"rxfreq"`
+	TXFreq        string   `xml:"txfreq"`
+	Operator      string   `xml:"operator"`
+	Mode          string   `xml:"mode"`
+	Call          string   `xml:"call"`
+	Timestamp     string   `xml:"timestamp"`
+	CountryPrefix string   `xml:"countryprefix"`
+	WPXPrefix     string   `xml:"wpxprefix"`
+	StationPrefix string   `xml:"stationprefix"`
+	Continent     string   `xml:"continent"`
+	SentNr        string   `xml:"snt"`
+	RcvdNr        string   `xml:"rcv"`
+	GridSquare    string   `xml:"gridsquare"`
+	Exchange      string   `xml:"exchange1"`
+	Section       string   `xml:"section"`
+	Comment       string   `xml:"comment"`
+	Qth           string   `xml:"qth"`
+	Name          string   `xml:"name"`
+	Power         string   `xml:"power"`
+	MiscText      string   `xml:"misctext"`
+	Zone          string   `xml:"zone"`
+	Prec          string   `xml:"prec"`
+	CK            string   `xml:"ck"`
+	IsMult1       string   `xml:"ismult1"`
+	IsMult2       string   `xml:"ismult2"`
+	IsMult3       string   `xml:"ismult3"`
+	Points        string   `xml:"points"`
+	Radionr       string   `xml:"radionr"`
+	RoverLocation string   `xml:"roverlocation"`
+	RadioUsed     string   `xml:"RadioUsed"`
+}
+
+// legacyContact fills a legacyContactInfo from a QSO
+func legacyContact(qso *QSO, timestamp time.Time, app, station, operator, contest string) legacyContactInfo {
+	return legacyContactInfo{
+		App:           app,
+		Contest:       contest,
+		Station:       station,
+		Band:          qso.Band,
+		RXFreq:        n1mmFrequency(qso.Hz()),
+		TXFreq:        n1mmFrequency(qso.Hz()),
+		Operator:      operator,
+		Mode:          qso.Mode,
+		Call:          qso.Callsign,
+		GridSquare:    qso.Grid,
+		Timestamp:     timestamp.Format("2006-01-02 15:04:05"),
+		WPXPrefix:     WPXPrefix(qso.Callsign),
+		StationPrefix: WPXPrefix(station),
+		SentNr:        qso.RST_Sent,
+		RcvdNr:        qso.RST_Rcvd,
+		Exchange:      qso.Exchange,
+		Comment:       qso.Comment,
+		Radionr:       "1",
+	}
+}
@@ -0,0 +1,184 @@
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// staleAfter is how long a fix is used without an update from gpsd. gpsd
+// reports about once a second while it has a fix.
+const staleAfter = 30 * time.Second
+
+// Config holds the gpsd connection settings
+type Config struct {
+	Address   string // gpsd host:port
+	Precision int    // Grid locator length: 4, 6 or 8 characters
+
+	// OnGridChange, if set, is called from Run whenever the fix moves into
+	// another grid square
+	OnGridChange func(grid string)
+}
+
+// Fix is the position gpsd last reported
+type Fix struct {
+	Lat     float64
+	Lon     float64
+	Grid    string
+	Updated time.Time
+}
+
+// tpv is the part of a gpsd TPV (time-position-velocity) report the client
+// uses. Mode is 0 or 1 without a fix, 2 for 2D and 3 for 3D.
+type tpv struct {
+	Class string   `json:"class"`
+	Mode  int      `json:"mode"`
+	Lat   *float64 `json:"lat"`
+	Lon   *float64 `json:"lon"`
+}
+
+// Client follows the position reported by a gpsd daemon
+type Client struct {
+	cfg Config
+
+	mu  sync.RWMutex
+	fix Fix
+}
+
+// NewClient creates a gpsd client. It does not connect until Run is called.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:2947"
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("gpsd: invalid address %q: %w", cfg.Address, err)
+	}
+	switch cfg.Precision {
+	case 0:
+		cfg.Precision = 4
+	case 4, 6, 8:
+	default:
+		return nil, fmt.Errorf("gpsd: grid precision must be 4, 6 or 8, not %d", cfg.Precision)
+	}
+	return &Client{cfg: cfg}, nil
+}
+
+// Fix returns the last position. ok is false until gpsd reports a fix, and
+// once the fix is older than staleAfter (gpsd has lost the satellites or
+// gone away).
+func (c *Client) Fix() (fix Fix, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.fix.Updated.IsZero() || time.Since(c.fix.Updated) > staleAfter {
+		return c.fix, false
+	}
+	return c.fix, true
+}
+
+// Run follows gpsd's reports until ctx is cancelled, reconnecting after
+// failures
+func (c *Client) Run(ctx context.Context) error {
+	failed := false
+	for {
+		err := c.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// Log once per outage rather than on every attempt
+		if !failed {
+			log.Printf("gpsd connection to %s failed: %v", c.cfg.Address, err)
+			failed = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// watch connects to gpsd, asks it to stream JSON reports and reads them
+// until the connection fails or ctx is cancelled
+func (c *Client) watch(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", c.cfg.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write([]byte(`?WATCH={"enable":true,"json":true};` + "\n")); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		// gpsd sends at least a TPV a second, even without a fix
+		conn.SetReadDeadline(time.Now().Add(staleAfter))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("connection closed")
+		}
+
+		var report tpv
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil || report.Class != "TPV" {
+			continue
+		}
+		if report.Mode < 2 || report.Lat == nil || report.Lon == nil {
+			continue
+		}
+		c.update(*report.Lat, *report.Lon)
+	}
+}
+
+// update stores a new position and reports grid square changes
+func (c *Client) update(lat, lon float64) {
+	grid := Grid(lat, lon, c.cfg.Precision)
+
+	c.mu.Lock()
+	changed := grid != c.fix.Grid
+	c.fix = Fix{Lat: lat, Lon: lon, Grid: grid, Updated: time.Now()}
+	c.mu.Unlock()
+
+	if changed && c.cfg.OnGridChange != nil {
+		c.cfg.OnGridChange(grid)
+	}
+}
+
+// Grid returns the Maidenhead locator of a position with length characters
+// (4, 6 or 8), e.g. FN31 or FN31pr. It returns "" for an invalid position.
+func Grid(lat, lon float64, length int) string {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return ""
+	}
+
+	// Shift to positive values and keep the north pole and antimeridian
+	// inside the last square
+	lon = math.Min(lon+180, 360-1e-9)
+	lat = math.Min(lat+90, 180-1e-9)
+
+	grid := []byte{
+		'A' + byte(lon/20), 'A' + byte(lat/10),
+		'0' + byte(math.Mod(lon, 20)/2), '0' + byte(math.Mod(lat, 10)),
+	}
+	if length >= 6 {
+		lonRest, latRest := math.Mod(lon, 2), math.Mod(lat, 1)
+		grid = append(grid, 'a'+byte(lonRest*12), 'a'+byte(latRest*24))
+		if length >= 8 {
+			grid = append(grid, '0'+byte(math.Mod(lonRest, 2.0/24)*120), '0'+byte(math.Mod(latRest, 1.0/24)*240))
+		}
+	}
+	return string(grid)
+}
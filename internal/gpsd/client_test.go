@@ -0,0 +1,90 @@
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrid(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		length   int
+		want     string
+	}{
+		{41.714775, -72.727260, 4, "FN31"},
+		{41.714775, -72.727260, 6, "FN31pr"},
+		{41.714775, -72.727260, 8, "FN31pr21"},
+		{48.1375, 11.575, 6, "JN58sd"},
+		{-33.8688, 151.2093, 6, "QF56od"},
+		{90, 180, 4, "RR99"},
+		{-90, -180, 4, "AA00"},
+		{91, 0, 4, ""},
+	}
+	for _, tt := range tests {
+		if got := Grid(tt.lat, tt.lon, tt.length); got != tt.want {
+			t.Errorf("Grid(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A fake gpsd: after the WATCH command, a report without a fix, then a
+	// fix in FN31 and one after driving into FN41
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if !strings.HasPrefix(line, "?WATCH=") {
+			return
+		}
+		conn.Write([]byte(`{"class":"VERSION","release":"3.25"}` + "\n"))
+		conn.Write([]byte(`{"class":"TPV","mode":1}` + "\n"))
+		conn.Write([]byte(`{"class":"TPV","mode":3,"lat":41.714775,"lon":-72.727260}` + "\n"))
+		conn.Write([]byte(`{"class":"TPV","mode":2,"lat":41.9,"lon":-71.5}` + "\n"))
+		time.Sleep(time.Second)
+	}()
+
+	grids := make(chan string, 4)
+	client, err := NewClient(Config{Address: ln.Addr().String(), OnGridChange: func(grid string) { grids <- grid }})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, ok := client.Fix(); ok {
+		t.Error("expected no fix before Run")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	for _, want := range []string{"FN31", "FN41"} {
+		select {
+		case grid := <-grids:
+			if grid != want {
+				t.Errorf("grid change to %q, want %q", grid, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no grid change to %s", want)
+		}
+	}
+	if fix, ok := client.Fix(); !ok || fix.Grid != "FN41" || fix.Lat != 41.9 {
+		t.Errorf("unexpected fix %+v (ok %t)", fix, ok)
+	}
+
+	if _, err := NewClient(Config{Precision: 5}); err == nil {
+		t.Error("expected an error for a 5 character grid")
+	}
+}
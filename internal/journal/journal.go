@@ -0,0 +1,120 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Entry is one relayed QSO as recorded in the journal
+type Entry struct {
+	Time   time.Time             `json:"time"`   // When the relay forwarded the QSO
+	Source string                `json:"source"` // Address the datagram came from
+	Type   formatter.MessageType `json:"type"`   // Detected source message type
+	QSO    formatter.QSO         `json:"qso"`
+
+	// Replies from targets with a response timeout
+	Responses []Response `json:"responses,omitempty"`
+}
+
+// Response statuses
+const (
+	ResponseOK    = "ok"    // The target answered without an error
+	ResponseError = "error" // The target answered with an error
+	ResponseNone  = "none"  // Nothing came back in time
+)
+
+// Response is what a target answered to a QSO
+type Response struct {
+	Target string `json:"target"`
+	Status string `json:"status"` // ResponseOK, ResponseError or ResponseNone
+	Reply  string `json:"reply,omitempty"`
+}
+
+// Journal is an append-only JSON-lines file of relayed QSOs
+type Journal struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Open opens (or creates) the journal file at path
+func Open(path string) (*Journal, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create journal directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	return &Journal{path: path, file: file}, nil
+}
+
+// Append writes an entry to the end of the journal
+func (j *Journal) Append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return nil
+}
+
+// Entries returns all entries recorded at or after since, oldest first
+func (j *Journal) Entries(since time.Time) ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.Open(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Skip a partially written last line rather than failing the whole read
+			continue
+		}
+		if !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Path returns the journal file location
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package logging
+
+import "os"
+
+// enableColor reports whether a terminal understands ANSI colors; all
+// terminals outside Windows do, except a dumb one
+func enableColor(f *os.File) bool {
+	return os.Getenv("TERM") != "dumb"
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package logging
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableColor switches the Windows console to processing ANSI escape
+// sequences. Consoles older than Windows 10 can't, and get plain lines.
+func enableColor(f *os.File) bool {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(handle, &mode) != nil {
+		return false
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
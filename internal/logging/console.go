@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ANSI escape sequences for the console
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// Console prints one short line per relayed QSO for someone watching the
+// relay in a terminal. It writes to its own writer, so the log can still go
+// elsewhere for machines to read.
+type Console struct {
+	mu    sync.Mutex
+	w     io.Writer
+	color bool
+}
+
+// NewConsole creates a console writing to w, with ANSI colors if color is set
+func NewConsole(w io.Writer, color bool) *Console {
+	return &Console{w: w, color: color}
+}
+
+// ConsoleQSO is a relayed QSO as the console shows it
+type ConsoleQSO struct {
+	Time     time.Time // When it was relayed
+	Callsign string
+	Band     string
+	Mode     string
+	Source   string // Source application, e.g. wsjt-x
+	What     string // Empty for a QSO, or e.g. "spot" or "replace"
+	Targets  []TargetStatus
+}
+
+// TargetStatus is whether one target accepted a QSO
+type TargetStatus struct {
+	Name string
+	Err  error
+}
+
+// QSO prints the line for a relayed QSO
+func (c *Console) QSO(q ConsoleQSO) {
+	var b strings.Builder
+	b.WriteString(c.paint(ansiDim, q.Time.Format("15:04:05")))
+	b.WriteString("  ")
+	b.WriteString(c.paint(ansiBold+ansiCyan, pad(q.Callsign, 10)))
+	b.WriteString(c.paint(ansiYellow, pad(q.Band, 6)))
+	b.WriteString(pad(q.Mode, 8))
+	b.WriteString(c.paint(ansiDim, pad(q.Source, 12)))
+	if q.What != "" {
+		b.WriteString(c.paint(ansiYellow, "["+q.What+"] "))
+	}
+
+	for i, t := range q.Targets {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		if t.Err != nil {
+			b.WriteString(c.paint(ansiRed, "✗ "+t.Name+": "+t.Err.Error()))
+		} else {
+			b.WriteString(c.paint(ansiGreen, "✓ "+t.Name))
+		}
+	}
+	if len(q.Targets) == 0 {
+		b.WriteString(c.paint(ansiRed, "no targets"))
+	}
+	b.WriteByte('\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	io.WriteString(c.w, b.String())
+}
+
+// paint wraps s in an escape sequence when colors are on
+func (c *Console) paint(code, s string) string {
+	if !c.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// pad left-aligns s in a column of width runes, leaving at least one space
+func pad(s string, width int) string {
+	if n := len([]rune(s)); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s + " "
+}
+
+// IsTerminal reports whether f is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// UseColor reports whether the console on f should be colored: f is a
+// terminal that understands ANSI colors, and NO_COLOR is not set
+// (https://no-color.org)
+func UseColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || !IsTerminal(f) {
+		return false
+	}
+	return enableColor(f)
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Module is a part of the relay whose debug logging is switched on its own
+type Module string
+
+const (
+	ModuleRelay      Module = "relay"      // Sockets, listeners, chaining, the bridge and heartbeats
+	ModuleFormatter  Module = "formatter"  // Detection, parsing and formatting of messages
+	ModuleEnrichment Module = "enrichment" // Rig, GPS, JTAlert, exchange lookup and worked-before data
+	ModuleSinks      Module = "sinks"      // Messages sent to targets, alerts and stats
+)
+
+// Modules lists every module
+var Modules = []Module{ModuleRelay, ModuleFormatter, ModuleEnrichment, ModuleSinks}
+
+// Level is how much a module logs
+type Level string
+
+const (
+	LevelInfo  Level = "info"  // What happens to QSOs, and problems
+	LevelDebug Level = "debug" // Also the detailed message flow, like --verbose
+)
+
+// ParseLevel checks a level name
+func ParseLevel(name string) (Level, error) {
+	switch level := Level(strings.ToLower(name)); level {
+	case LevelInfo, LevelDebug:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown log level %q (use info or debug)", name)
+}
+
+// ParseModule checks a module name
+func ParseModule(name string) (Module, error) {
+	for _, m := range Modules {
+		if strings.EqualFold(name, string(m)) {
+			return m, nil
+		}
+	}
+	names := make([]string, len(Modules))
+	for i, m := range Modules {
+		names[i] = string(m)
+	}
+	return "", fmt.Errorf("unknown log module %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// Levels holds the log level of each module. It is safe for concurrent use.
+type Levels struct {
+	mu     sync.RWMutex
+	levels map[Module]Level
+}
+
+// NewLevels sets every module to debug when verbose, else info, and then
+// applies levels, which maps module names, or "all", to level names
+func NewLevels(verbose bool, levels map[string]string) (*Levels, error) {
+	l := &Levels{levels: make(map[Module]Level, len(Modules))}
+	l.SetAll(verbose)
+	if err := l.Set(levels); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Debug reports whether a module logs at debug level
+func (l *Levels) Debug(m Module) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.levels[m] == LevelDebug
+}
+
+// SetAll sets every module to debug or info, as --verbose does
+func (l *Levels) SetAll(debug bool) {
+	level := LevelInfo
+	if debug {
+		level = LevelDebug
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range Modules {
+		l.levels[m] = level
+	}
+}
+
+// Set changes the modules named in levels, or every module for "all",
+// which is applied first. Nothing changes if a name is unknown.
+func (l *Levels) Set(levels map[string]string) error {
+	all := Level("")
+	parsed := make(map[Module]Level, len(levels))
+	for name, value := range levels {
+		level, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if strings.EqualFold(name, "all") {
+			all = level
+			continue
+		}
+		m, err := ParseModule(name)
+		if err != nil {
+			return err
+		}
+		parsed[m] = level
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if all != "" {
+		for _, m := range Modules {
+			l.levels[m] = all
+		}
+	}
+	for m, level := range parsed {
+		l.levels[m] = level
+	}
+	return nil
+}
+
+// Map returns each module's level by name
+func (l *Levels) Map() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	levels := make(map[string]string, len(l.levels))
+	for m, level := range l.levels {
+		levels[string(m)] = string(level)
+	}
+	return levels
+}
+
+// AnyDebug reports whether any module logs at debug level
+func (l *Levels) AnyDebug() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, level := range l.levels {
+		if level == LevelDebug {
+			return true
+		}
+	}
+	return false
+}
+
+// String lists the modules at debug level, e.g. "formatter, sinks"
+func (l *Levels) String() string {
+	var debug []string
+	for m, level := range l.Map() {
+		if level == string(LevelDebug) {
+			debug = append(debug, m)
+		}
+	}
+	sort.Strings(debug)
+	if len(debug) == 0 {
+		return "none"
+	}
+	return strings.Join(debug, ", ")
+}
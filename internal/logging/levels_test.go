@@ -0,0 +1,37 @@
+package logging
+
+import "testing"
+
+func TestLevels(t *testing.T) {
+	l, err := NewLevels(false, map[string]string{"Formatter": "DEBUG"})
+	if err != nil {
+		t.Fatalf("NewLevels failed: %v", err)
+	}
+	if !l.Debug(ModuleFormatter) || l.Debug(ModuleRelay) {
+		t.Errorf("levels = %v, want only formatter at debug", l.Map())
+	}
+
+	// all is applied before the modules named with it
+	if err := l.Set(map[string]string{"sinks": "info", "all": "debug"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !l.Debug(ModuleRelay) || l.Debug(ModuleSinks) {
+		t.Errorf("levels = %v, want all but sinks at debug", l.Map())
+	}
+
+	// A bad name changes nothing
+	if err := l.Set(map[string]string{"relay": "info", "sockets": "debug"}); err == nil {
+		t.Error("expected an unknown module to be refused")
+	}
+	if err := l.Set(map[string]string{"relay": "trace"}); err == nil {
+		t.Error("expected an unknown level to be refused")
+	}
+	if !l.Debug(ModuleRelay) {
+		t.Error("a refused Set changed a level")
+	}
+
+	l.SetAll(false)
+	if l.AnyDebug() {
+		t.Errorf("levels = %v, want all at info", l.Map())
+	}
+}
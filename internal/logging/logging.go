@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Setup configures the standard logger. format is "text", "json" or "auto"
+// and output is "stdout", "stderr" or "auto"; auto picks JSON on stdout when
+// running in a container. It reports whether JSON logging is active.
+func Setup(format, output string) (bool, error) {
+	container := InContainer()
+
+	var w io.Writer
+	switch strings.ToLower(output) {
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	case "", "auto":
+		w = os.Stderr
+		if container {
+			w = os.Stdout
+		}
+	default:
+		return false, fmt.Errorf("unknown log output %q", output)
+	}
+
+	jsonLogs := false
+	switch strings.ToLower(format) {
+	case "json":
+		jsonLogs = true
+	case "text":
+	case "", "auto":
+		jsonLogs = container
+	default:
+		return false, fmt.Errorf("unknown log format %q", format)
+	}
+
+	if jsonLogs {
+		log.SetFlags(0)
+		log.SetOutput(&jsonWriter{w: w})
+	} else {
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(w)
+	}
+
+	return jsonLogs, nil
+}
+
+// InContainer reports whether the process appears to run in a container
+func InContainer() bool {
+	if os.Getenv("container") != "" {
+		return true
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return true
+	}
+	return false
+}
+
+// jsonWriter turns each log line into a JSON object
+type jsonWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+type jsonLine struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+func (j *jsonWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	data, err := json.Marshal(jsonLine{
+		Time:  time.Now().UTC().Format(time.RFC3339Nano),
+		Level: level(msg),
+		Msg:   msg,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// level guesses a severity from the message text, since the relay logs
+// through the standard logger without levels
+func level(msg string) string {
+	lower := strings.ToLower(msg)
+	if strings.Contains(lower, "failed") || strings.Contains(lower, "error") {
+		return "error"
+	}
+	if strings.HasPrefix(lower, "warning") {
+		return "warn"
+	}
+	return "info"
+}
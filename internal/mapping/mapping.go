@@ -0,0 +1,186 @@
+// Package mapping rewrites fields of parsed QSOs from templates, so that a
+// source's data can be moved to where a logger expects it, e.g. a JS8Call
+// grid into N1MM's exchange1, without code changes.
+package mapping
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// fields are the QSO fields a mapping can set, by name
+var fields = map[string]func(*formatter.QSO) *string{
+	"callsign":      func(q *formatter.QSO) *string { return &q.Callsign },
+	"mode":          func(q *formatter.QSO) *string { return &q.Mode },
+	"band":          func(q *formatter.QSO) *string { return &q.Band },
+	"rst_sent":      func(q *formatter.QSO) *string { return &q.RST_Sent },
+	"rst_rcvd":      func(q *formatter.QSO) *string { return &q.RST_Rcvd },
+	"exchange":      func(q *formatter.QSO) *string { return &q.Exchange },
+	"exchange_sent": func(q *formatter.QSO) *string { return &q.ExchangeSent },
+	"comment":       func(q *formatter.QSO) *string { return &q.Comment },
+	"grid":          func(q *formatter.QSO) *string { return &q.Grid },
+	"my_grid":       func(q *formatter.QSO) *string { return &q.MyGrid },
+	"station":       func(q *formatter.QSO) *string { return &q.Station },
+	"operator":      func(q *formatter.QSO) *string { return &q.Operator },
+	"contest":       func(q *formatter.QSO) *string { return &q.Contest },
+	"station_name":  func(q *formatter.QSO) *string { return &q.StationName },
+	"netbios_name":  func(q *formatter.QSO) *string { return &q.NetBiosName },
+}
+
+// aliases name fields by their N1MM contactinfo element
+var aliases = map[string]string{
+	"call":        "callsign",
+	"snt":         "rst_sent",
+	"rcv":         "rst_rcvd",
+	"exchange1":   "exchange",
+	"gridsquare":  "grid",
+	"mycall":      "station",
+	"contestname": "contest",
+	"stationname": "station_name",
+	"netbiosname": "netbios_name",
+}
+
+// Field resolves a field name or N1MM element name to the field name
+func Field(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	if _, ok := fields[name]; !ok {
+		return "", fmt.Errorf("unknown field %q (use %s)", name, strings.Join(Fields(), ", "))
+	}
+	return name, nil
+}
+
+// MatchField resolves the name of a field a condition can test: a field a
+// mapping can set, frequency or type
+func MatchField(name string) (string, error) {
+	field := strings.ToLower(strings.TrimSpace(name))
+	if field == "type" || field == "frequency" {
+		return field, nil
+	}
+	if _, err := Field(name); err != nil {
+		names := append(Fields(), "frequency", "type")
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown field %q (use %s)", field, strings.Join(names, ", "))
+	}
+	return Field(name)
+}
+
+// Fields lists the names of the fields a mapping can set
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Funcs returns the functions available in templates besides the
+// text/template builtins. Other QSO templates use them too, so every
+// template offers the same ones.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+	}
+}
+
+// Mapping sets QSO fields from templates when its conditions match. Its
+// conditions and templates see the settable fields, plus frequency (MHz),
+// type (the detected source type) and serial_sent, by name, e.g.
+// {{.grid}}.
+type Mapping struct {
+	match map[string]*regexp.Regexp
+	set   []setter
+}
+
+// setter is a compiled assignment of a template to a field
+type setter struct {
+	field string
+	tmpl  *template.Template
+}
+
+// New compiles a mapping. match maps field names to regular expressions the
+// fields must all match (case-insensitive); set maps field names to the
+// templates giving their new values.
+func New(match, set map[string]string) (*Mapping, error) {
+	if len(set) == 0 {
+		return nil, fmt.Errorf("nothing to set")
+	}
+
+	m := &Mapping{match: make(map[string]*regexp.Regexp, len(match))}
+	for name, pattern := range match {
+		field, err := MatchField(name)
+		if err != nil {
+			return nil, fmt.Errorf("match: %w", err)
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %w", name, err)
+		}
+		m.match[field] = re
+	}
+
+	for name, text := range set {
+		field, err := Field(name)
+		if err != nil {
+			return nil, fmt.Errorf("set: %w", err)
+		}
+		tmpl, err := template.New(field).Funcs(Funcs()).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %w", name, err)
+		}
+		m.set = append(m.set, setter{field: field, tmpl: tmpl})
+	}
+	// Deterministic order for errors and logs
+	sort.Slice(m.set, func(i, j int) bool { return m.set[i].field < m.set[j].field })
+	return m, nil
+}
+
+// Values returns the fields templates and conditions can read, by name
+func Values(qso *formatter.QSO, msgType formatter.MessageType) map[string]string {
+	v := make(map[string]string, len(fields)+3)
+	for name, field := range fields {
+		v[name] = *field(qso)
+	}
+	v["frequency"] = qso.Frequency
+	v["type"] = string(msgType)
+	if qso.SerialSent > 0 {
+		v["serial_sent"] = strconv.Itoa(qso.SerialSent)
+	}
+	return v
+}
+
+// Apply sets the mapped fields of qso if every condition matches, and
+// reports whether it did. Every template reads the fields as they were
+// before any was set. A template that fails leaves the QSO unchanged.
+func (m *Mapping) Apply(qso *formatter.QSO, msgType formatter.MessageType) (bool, error) {
+	v := Values(qso, msgType)
+	for field, re := range m.match {
+		if !re.MatchString(v[field]) {
+			return false, nil
+		}
+	}
+
+	results := make([]string, len(m.set))
+	for i, s := range m.set {
+		var b strings.Builder
+		if err := s.tmpl.Execute(&b, v); err != nil {
+			return false, fmt.Errorf("set %s: %w", s.field, err)
+		}
+		results[i] = b.String()
+	}
+	for i, s := range m.set {
+		*fields[s.field](qso) = results[i]
+	}
+	return true, nil
+}
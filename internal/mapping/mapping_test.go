@@ -0,0 +1,49 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+func TestApply(t *testing.T) {
+	m, err := New(map[string]string{"grid": "^[A-R]{2}[0-9]{2}"}, map[string]string{
+		"exchange1": "{{.grid}}",
+		"comment":   "{{upper .type}} {{.mode}}{{if .comment}}: {{.comment}}{{end}}",
+		"grid":      "",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	qso := &formatter.QSO{Callsign: "K1ABC", Mode: "JS8", Grid: "FN42", Comment: "hi"}
+	applied, err := m.Apply(qso, formatter.MessageTypeJS8Call)
+	if err != nil || !applied {
+		t.Fatalf("Apply = %v, %v", applied, err)
+	}
+	// Templates see the fields as parsed, not as set by the same mapping
+	if qso.Exchange != "FN42" || qso.Comment != "JS8CALL JS8: hi" || qso.Grid != "" {
+		t.Errorf("unexpected QSO: %+v", qso)
+	}
+
+	// No grid, no match
+	qso = &formatter.QSO{Callsign: "K1ABC", Exchange: "5NN 05"}
+	if applied, _ := m.Apply(qso, formatter.MessageTypeJS8Call); applied || qso.Exchange != "5NN 05" {
+		t.Errorf("mapping should not apply without a grid: %+v", qso)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, c := range map[string]struct{ match, set map[string]string }{
+		"nothing set":      {nil, nil},
+		"unknown field":    {nil, map[string]string{"exchange2": "x"}},
+		"unknown match":    {map[string]string{"rig": "."}, map[string]string{"comment": "x"}},
+		"bad template":     {nil, map[string]string{"comment": "{{.mode"}},
+		"bad expression":   {map[string]string{"mode": "("}, map[string]string{"comment": "x"}},
+		"unknown function": {nil, map[string]string{"comment": "{{title .mode}}"}},
+	} {
+		if _, err := New(c.match, c.set); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package messages keeps the JS8Call directed messages the relay receives
+// in a CSV file, apart from the QSO journal
+package messages
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// header is the first line of the file
+var header = []string{"time", "from", "to", "command", "text", "grid", "frequency_hz", "snr"}
+
+// Log is an append-only CSV file of directed messages
+type Log struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Open opens (or creates) the message log at path
+func Open(path string) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create message log directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open message log: %w", err)
+	}
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		w := csv.NewWriter(file)
+		w.Write(header)
+		if w.Flush(); w.Error() != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write message log header: %w", w.Error())
+		}
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// Append writes a message to the end of the log
+func (l *Log) Append(m formatter.JS8Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := csv.NewWriter(l.file)
+	w.Write([]string{
+		m.Time.UTC().Format(time.RFC3339),
+		m.From,
+		m.To,
+		m.Command,
+		m.Text,
+		m.Grid,
+		strconv.FormatInt(m.FrequencyHz, 10),
+		strconv.Itoa(m.SNR),
+	})
+	if w.Flush(); w.Error() != nil {
+		return fmt.Errorf("failed to write message log: %w", w.Error())
+	}
+	return nil
+}
+
+// Recent returns up to limit messages received after since, newest first.
+// A non-empty call keeps only the messages from or to it.
+func (l *Log) Recent(limit int, since time.Time, call string) ([]formatter.JS8Message, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message log: %w", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	var all []formatter.JS8Message
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Skip a partially written line rather than failing the whole read
+			continue
+		}
+		m, ok := parseRecord(record)
+		if !ok || !m.Time.After(since) {
+			continue
+		}
+		if call != "" && !strings.EqualFold(m.From, call) && !strings.EqualFold(m.To, call) {
+			continue
+		}
+		all = append(all, m)
+	}
+
+	recent := make([]formatter.JS8Message, 0, min(limit, len(all)))
+	for i := len(all) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, all[i])
+	}
+	return recent, nil
+}
+
+// parseRecord decodes a line of the file; the header and broken lines are
+// not messages
+func parseRecord(record []string) (formatter.JS8Message, bool) {
+	if len(record) != len(header) {
+		return formatter.JS8Message{}, false
+	}
+	t, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return formatter.JS8Message{}, false
+	}
+	hz, _ := strconv.ParseInt(record[6], 10, 64)
+	snr, _ := strconv.Atoi(record[7])
+	return formatter.JS8Message{
+		Time:        t,
+		From:        record[1],
+		To:          record[2],
+		Command:     record[3],
+		Text:        record[4],
+		Grid:        record[5],
+		FrequencyHz: hz,
+		SNR:         snr,
+	}, true
+}
+
+// Path returns the message log file location
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Close closes the message log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
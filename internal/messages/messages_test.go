@@ -0,0 +1,60 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages", "js8.csv")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, m := range []formatter.JS8Message{
+		{From: "K1ABC", To: "N7AKG", Command: "MSG", Text: "K1ABC: N7AKG MSG HELLO, WORLD"},
+		{From: "G4ABC", To: "@ALLCALL", Command: "CQ", Text: "G4ABC: @ALLCALL CQ CQ IO91", Grid: "IO91"},
+		{From: "N7AKG", To: "K1ABC", Command: "SNR", Text: "N7AKG: K1ABC SNR -12", SNR: -12},
+	} {
+		m.Time = base.Add(time.Duration(i) * time.Minute)
+		m.FrequencyHz = 7079500
+		if err := l.Append(m); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	l.Close()
+
+	// Reopening keeps the messages and doesn't repeat the header
+	if l, err = Open(path); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer l.Close()
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "time,from,to"); n != 1 {
+		t.Errorf("Header written %d times", n)
+	}
+
+	recent, err := l.Recent(10, time.Time{}, "")
+	if err != nil || len(recent) != 3 {
+		t.Fatalf("Recent = %d messages, %v", len(recent), err)
+	}
+	if recent[0].From != "N7AKG" || recent[0].SNR != -12 || recent[2].Text != "K1ABC: N7AKG MSG HELLO, WORLD" {
+		t.Errorf("Recent not newest first: %+v", recent)
+	}
+
+	if recent, _ = l.Recent(10, time.Time{}, "k1abc"); len(recent) != 2 {
+		t.Errorf("Messages from or to K1ABC: %d", len(recent))
+	}
+	if recent, _ = l.Recent(10, base, ""); len(recent) != 2 {
+		t.Errorf("Messages since the first: %d", len(recent))
+	}
+	if recent, _ = l.Recent(1, time.Time{}, ""); len(recent) != 1 || recent[0].From != "N7AKG" {
+		t.Errorf("Limit 1: %+v", recent)
+	}
+}
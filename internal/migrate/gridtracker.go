@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// importGridTracker reads GridTracker's exported settings: JSON objects by
+// name, e.g. appSettings and N1MMSettings, which may themselves be stored as
+// JSON strings
+func importGridTracker(r io.Reader) (*Settings, error) {
+	var root any
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("not a GridTracker settings file: %w", err)
+	}
+	v := make(values)
+	flatten(v, "", root)
+	if len(v) == 0 {
+		return nil, fmt.Errorf("no settings found; is this a GridTracker settings file?")
+	}
+
+	s := &Settings{Source: "GridTracker"}
+	s.Callsign = strings.ToUpper(v.get("myCall", "callsign"))
+	s.Grid = v.get("myGrid", "myRawGrid", "grid")
+
+	// GridTracker listens where WSJT-X sends: a multicast group when
+	// multicast is on, otherwise a port on wsjtIP
+	address := v.get("wsjtIP")
+	if v.enabled("multicast") && isMulticast(address) {
+		s.MulticastGroup = address
+	} else if address != "" && address != "127.0.0.1" && !isMulticast(address) {
+		s.ListenAddress = address
+	}
+	s.ListenPort = v.port("wsjtUdpPort")
+
+	if v.enabled("wsjtForwardUdpEnable") {
+		s.forward(v.get("wsjtForwardUdpIp"), v.port("wsjtForwardUdpPort"))
+	}
+
+	s.logger(v, "N1MM Logger+", "n1mm", "N1MMSettings", 12060)
+	s.logger(v, "Log4OM", "adif", "log4OMSettings", 2236)
+	for _, logger := range []struct{ settings, name string }{
+		{"acLogSettings", "ACLog"},
+		{"dxkLogSettings", "DXKeeper"},
+		{"HRDLogbookLogSettings", "HRD Logbook"},
+	} {
+		if v.enabled(logger.settings + ".enable") {
+			s.unsupported(logger.name)
+		}
+	}
+	return s, nil
+}
+
+// flatten stores every value in a decoded JSON document by its dotted path.
+// Strings that hold a JSON object are decoded too, as localStorage exports
+// store them.
+func flatten(v values, path string, node any) {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, child := range n {
+			name := normalize(key)
+			if path != "" {
+				name = path + "." + name
+			}
+			flatten(v, name, child)
+		}
+	case string:
+		if trimmed := strings.TrimSpace(n); strings.HasPrefix(trimmed, "{") {
+			var nested map[string]any
+			if json.Unmarshal([]byte(trimmed), &nested) == nil {
+				flatten(v, path, nested)
+				return
+			}
+		}
+		v[path] = n
+	case float64:
+		v[path] = strconv.FormatFloat(n, 'f', -1, 64)
+	case bool:
+		v[path] = strconv.FormatBool(n)
+	}
+}
@@ -0,0 +1,211 @@
+// Package migrate turns the UDP settings of other ham radio applications
+// (GridTracker) into an equivalent relay configuration, for
+// stations replacing their forwarding setup with the relay.
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sources the settings can be imported from
+var Sources = []string{"gridtracker"}
+
+// Settings is what an application's settings say about the station and
+// where WSJT-X traffic comes from and goes
+type Settings struct {
+	Source         string // Application the settings came from
+	Callsign       string
+	Grid           string
+	ListenAddress  string // Where WSJT-X sends, e.g. 0.0.0.0
+	ListenPort     int
+	MulticastGroup string
+	Targets        []Target
+	Notes          []string // Settings with no relay equivalent
+}
+
+// Target is a logger the application sent logged QSOs to
+type Target struct {
+	Name    string // e.g. N1MM Logger+
+	Address string
+	Port    int
+	Format  string // Relay output format: n1mm or adif
+}
+
+// Import reads an application's settings file
+func Import(source string, r io.Reader) (*Settings, error) {
+	switch strings.ToLower(source) {
+	case "gridtracker":
+		return importGridTracker(r)
+	}
+	return nil, fmt.Errorf("unknown application %q (use %s)", source, strings.Join(Sources, " or "))
+}
+
+// ImportFile reads an application's settings from a file
+func ImportFile(source, path string) (*Settings, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Import(source, file)
+}
+
+// WriteYAML writes the settings as a relay configuration file. Only what
+// the settings say is written; the relay's defaults cover the rest.
+func (s *Settings) WriteYAML(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Relay configuration imported from %s settings. Review it before use;\n", s.Source)
+	b.WriteString("# settings not listed here keep the relay's defaults.\n")
+	for _, note := range s.Notes {
+		fmt.Fprintf(&b, "#\n# Not carried over: %s\n", note)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("listen:                     # where WSJT-X sends\n")
+	address := s.ListenAddress
+	if address == "" {
+		address = "0.0.0.0"
+	}
+	fmt.Fprintf(&b, "  address: %q\n", address)
+	port := s.ListenPort
+	if port == 0 {
+		port = 2237
+	}
+	fmt.Fprintf(&b, "  port: %d\n", port)
+	if s.MulticastGroup != "" {
+		fmt.Fprintf(&b, "  multicast_group: %q\n", s.MulticastGroup)
+	}
+
+	if len(s.Targets) > 0 {
+		t := s.Targets[0]
+		fmt.Fprintf(&b, "\ntarget:                     # %s\n", t.Name)
+		fmt.Fprintf(&b, "  address: %q\n  port: %d\n  format: %q\n", t.Address, t.Port, t.Format)
+	}
+	if len(s.Targets) > 1 {
+		b.WriteString("\ntargets:\n")
+		for _, t := range s.Targets[1:] {
+			fmt.Fprintf(&b, "  - address: %q  # %s\n", t.Address, t.Name)
+			fmt.Fprintf(&b, "    port: %d\n    format: %q\n", t.Port, t.Format)
+		}
+	}
+
+	if s.Callsign != "" {
+		b.WriteString("\nformatting:\n  n1mm:\n")
+		fmt.Fprintf(&b, "    station: %q\n", s.Callsign)
+	}
+	if s.Grid != "" {
+		fmt.Fprintf(&b, "\ncontrol:\n  grid: %q\n", s.Grid)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// values holds settings by normalized name: lower case, letters and digits
+// only, with nested names joined by dots
+type values map[string]string
+
+// normalize reduces a setting name to lower case letters and digits
+func normalize(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// get returns the first of names that is set. A name matches a setting
+// with that name in any section.
+func (v values) get(names ...string) string {
+	for _, name := range names {
+		name = normalize(name)
+		if value, ok := v[name]; ok && value != "" {
+			return value
+		}
+		// Sorted so that the same file always gives the same result
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			if strings.HasSuffix(key, "."+name) && v[key] != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			return v[keys[0]]
+		}
+	}
+	return ""
+}
+
+// port returns the first of names that is a valid port number
+func (v values) port(names ...string) int {
+	for _, name := range names {
+		if port, err := strconv.Atoi(v.get(name)); err == nil && port > 0 && port <= 65535 {
+			return port
+		}
+	}
+	return 0
+}
+
+// enabled reports whether the first of names that is set is true
+func (v values) enabled(names ...string) bool {
+	switch strings.ToLower(v.get(names...)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// isMulticast reports whether address is a multicast group
+func isMulticast(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsMulticast()
+}
+
+// logger reads a logger the application sends logged QSOs to
+func (s *Settings) logger(v values, name, format, prefix string, defaultPort int) {
+	if !v.enabled(prefix+".enable", prefix+".enabled", prefix+"enabled", prefix+"enable") {
+		return
+	}
+	t := Target{Name: name, Format: format}
+	t.Address = v.get(prefix+".ip", prefix+".address", prefix+"ip", prefix+"address")
+	if t.Address == "" {
+		t.Address = "127.0.0.1"
+	}
+	if t.Port = v.port(prefix+".port", prefix+"port"); t.Port == 0 {
+		t.Port = defaultPort
+	}
+	s.Targets = append(s.Targets, t)
+}
+
+// forward notes that the application repeated WSJT-X datagrams, which the
+// relay parses rather than repeats
+func (s *Settings) forward(address string, port int) {
+	if port == 0 {
+		return
+	}
+	if address == "" {
+		address = "127.0.0.1"
+	}
+	advice := "Set WSJT-X to send to a multicast group (listen.multicast_group) so that program can join it too."
+	if s.MulticastGroup != "" {
+		advice = fmt.Sprintf("Have that program join WSJT-X's multicast group %s instead.", s.MulticastGroup)
+	}
+	s.Notes = append(s.Notes, fmt.Sprintf("%s repeated WSJT-X datagrams to %s. %s",
+		s.Source, net.JoinHostPort(address, strconv.Itoa(port)), advice))
+}
+
+// unsupported notes a logger the application sent QSOs to that the relay
+// has no output format for
+func (s *Settings) unsupported(logger string) {
+	s.Notes = append(s.Notes, fmt.Sprintf("%s logged QSOs to %s, which the relay can't send to. "+
+		"Add an n1mm or adif target if that logger can read one.", s.Source, logger))
+}
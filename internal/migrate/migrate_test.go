@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+// gridTrackerExport is a settings export as GridTracker writes it: each
+// localStorage value is itself a JSON string
+const gridTrackerExport = `{
+  "appSettings": "{\"wsjtUdpPort\":2237,\"wsjtIP\":\"239.255.0.1\",\"multicast\":true,\"myCall\":\"w1aw\",\"myGrid\":\"FN31pr\",\"wsjtForwardUdpEnable\":true,\"wsjtForwardUdpIp\":\"127.0.0.1\",\"wsjtForwardUdpPort\":2238}",
+  "N1MMSettings": "{\"enable\":true,\"ip\":\"192.168.1.20\",\"port\":12060}",
+  "log4OMSettings": "{\"enable\":true,\"ip\":\"127.0.0.1\",\"port\":2236}",
+  "acLogSettings": "{\"enable\":true,\"ip\":\"127.0.0.1\",\"port\":1100}",
+  "dxkLogSettings": "{\"enable\":false}"
+}`
+
+func TestImportGridTracker(t *testing.T) {
+	s, err := Import("gridtracker", strings.NewReader(gridTrackerExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Callsign != "W1AW" || s.Grid != "FN31pr" || s.ListenPort != 2237 || s.MulticastGroup != "239.255.0.1" {
+		t.Errorf("unexpected settings %+v", s)
+	}
+	want := []Target{
+		{Name: "N1MM Logger+", Address: "192.168.1.20", Port: 12060, Format: "n1mm"},
+		{Name: "Log4OM", Address: "127.0.0.1", Port: 2236, Format: "adif"},
+	}
+	if len(s.Targets) != len(want) {
+		t.Fatalf("got targets %+v, want %+v", s.Targets, want)
+	}
+	for i := range want {
+		if s.Targets[i] != want[i] {
+			t.Errorf("target %d = %+v, want %+v", i, s.Targets[i], want[i])
+		}
+	}
+	if len(s.Notes) != 2 || !strings.Contains(s.Notes[0], "127.0.0.1:2238") || !strings.Contains(s.Notes[1], "ACLog") {
+		t.Errorf("unexpected notes %q", s.Notes)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	if _, err := Import("jtalert", strings.NewReader(gridTrackerExport)); err == nil || !strings.Contains(err.Error(), "unknown application") {
+		t.Errorf("expected an unknown application error, got %v", err)
+	}
+	if _, err := Import("gridtracker", strings.NewReader("[Station]\nCallsign=K1ABC\n")); err == nil {
+		t.Error("expected an INI file to be rejected as GridTracker settings")
+	}
+}
+
+// TestWriteYAML loads the written config as the relay would
+func TestWriteYAML(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	s, err := Import("gridtracker", strings.NewReader(gridTrackerExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteYAML(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		data, _ := os.ReadFile(path)
+		t.Fatalf("written config doesn't load: %v\n%s", err, data)
+	}
+	if cfg.Listen.Port != 2237 || cfg.Listen.MulticastGroup != "239.255.0.1" {
+		t.Errorf("listen = %+v", cfg.Listen)
+	}
+	if cfg.Target.Address != "192.168.1.20" || cfg.Target.Format != "n1mm" {
+		t.Errorf("target = %+v", cfg.Target)
+	}
+	if len(cfg.Targets) != 1 || cfg.Targets[0].Format != "adif" || cfg.Targets[0].Port != 2236 {
+		t.Errorf("targets = %+v", cfg.Targets)
+	}
+	if cfg.Formatting.N1MM.Station != "W1AW" || cfg.Control.Grid != "FN31pr" {
+		t.Errorf("station %q grid %q", cfg.Formatting.N1MM.Station, cfg.Control.Grid)
+	}
+}
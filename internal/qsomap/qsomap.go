@@ -0,0 +1,180 @@
+// Package qsomap places forwarded QSOs on a world map: each worked station
+// at the centre of its grid square, colored by band, with the great-circle
+// path from this station. The control API serves the markers, and a page
+// at /map that draws them.
+package qsomap
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// pathPoints is how many points a great-circle path is drawn with
+const pathPoints = 32
+
+// Point is a position in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Marker is a QSO on the map
+type Marker struct {
+	ID       string    `json:"id,omitempty"`
+	Callsign string    `json:"callsign"`
+	Band     string    `json:"band"`
+	Mode     string    `json:"mode"`
+	Time     time.Time `json:"time"`
+	Grid     string    `json:"grid"`
+	Position Point     `json:"position"`
+	Color    string    `json:"color"`          // CSS color for the band
+	Path     []Point   `json:"path,omitempty"` // Great circle from this station, when its grid is known
+}
+
+// bandColors are the colors PSKReporter and most band maps use
+var bandColors = map[string]string{
+	"160m": "#7cfc00",
+	"80m":  "#e550e5",
+	"60m":  "#00008b",
+	"40m":  "#5959ff",
+	"30m":  "#62d962",
+	"20m":  "#f2c40c",
+	"17m":  "#f2f261",
+	"15m":  "#cca166",
+	"12m":  "#b22222",
+	"10m":  "#ff69b4",
+	"6m":   "#ff0000",
+	"2m":   "#ff1493",
+	"70cm": "#999900",
+}
+
+// otherBand colors bands without a color of their own
+const otherBand = "#808080"
+
+// BandColor returns the CSS color for a band, e.g. 20m
+func BandColor(band string) string {
+	if color, ok := bandColors[strings.ToLower(strings.TrimSpace(band))]; ok {
+		return color
+	}
+	return otherBand
+}
+
+// Position returns the centre of a 4, 6 or 8 character Maidenhead locator
+func Position(grid string) (Point, bool) {
+	grid = strings.ToUpper(strings.TrimSpace(grid))
+	if len(grid) < 4 || len(grid) > 8 || len(grid)%2 != 0 {
+		return Point{}, false
+	}
+
+	// Field (20x10 degrees), square (2x1), subsquare (5'x2.5'),
+	// extended square (30"x15")
+	lon, lat := -180.0, -90.0
+	size := [2]float64{20, 10}
+	for i := 0; i < len(grid); i += 2 {
+		base, limit := byte('A'), byte('R')
+		switch i {
+		case 2, 6:
+			base, limit = '0', '9'
+		case 4:
+			limit = 'X'
+		}
+		x, y := grid[i], grid[i+1]
+		if x < base || x > limit || y < base || y > limit {
+			return Point{}, false
+		}
+		lon += float64(x-base) * size[0]
+		lat += float64(y-base) * size[1]
+
+		if i+2 < len(grid) {
+			divisions := 10.0
+			if i == 2 {
+				divisions = 24
+			}
+			size[0] /= divisions
+			size[1] /= divisions
+		}
+	}
+	return Point{Lat: lat + size[1]/2, Lon: lon + size[0]/2}, true
+}
+
+// GreatCircle returns points along the shortest path between two positions,
+// both included
+func GreatCircle(from, to Point, points int) []Point {
+	if points < 2 {
+		points = 2
+	}
+	lat1, lon1 := radians(from.Lat), radians(from.Lon)
+	lat2, lon2 := radians(to.Lat), radians(to.Lon)
+
+	// Angular distance (haversine)
+	d := 2 * math.Asin(math.Sqrt(math.Pow(math.Sin((lat2-lat1)/2), 2)+
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)))
+	if d == 0 {
+		return []Point{from, to}
+	}
+
+	path := make([]Point, points)
+	for i := range path {
+		f := float64(i) / float64(points-1)
+		a := math.Sin((1-f)*d) / math.Sin(d)
+		b := math.Sin(f*d) / math.Sin(d)
+		x := a*math.Cos(lat1)*math.Cos(lon1) + b*math.Cos(lat2)*math.Cos(lon2)
+		y := a*math.Cos(lat1)*math.Sin(lon1) + b*math.Cos(lat2)*math.Sin(lon2)
+		z := a*math.Sin(lat1) + b*math.Sin(lat2)
+		path[i] = Point{
+			Lat: round(degrees(math.Atan2(z, math.Hypot(x, y)))),
+			Lon: round(degrees(math.Atan2(y, x))),
+		}
+	}
+	return path
+}
+
+// Bearing returns the initial great-circle heading from one position to
+// another, in degrees clockwise from true north
+func Bearing(from, to Point) float64 {
+	lat1, lat2 := radians(from.Lat), radians(to.Lat)
+	dLon := radians(to.Lon - from.Lon)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// Markers places QSOs that have a grid on the map. A QSO's path starts at
+// its own MyGrid, e.g. from GPS, or at station when it has none.
+func Markers(qsos []formatter.QSO, station string) []Marker {
+	home, homeKnown := Position(station)
+
+	markers := make([]Marker, 0, len(qsos))
+	for _, qso := range qsos {
+		position, ok := Position(qso.Grid)
+		if !ok {
+			continue
+		}
+		m := Marker{
+			ID:       qso.ID,
+			Callsign: qso.Callsign,
+			Band:     qso.Band,
+			Mode:     qso.Mode,
+			Time:     qso.DateTime,
+			Grid:     strings.ToUpper(qso.Grid),
+			Position: position,
+			Color:    BandColor(qso.Band),
+		}
+		if from, ok := Position(qso.MyGrid); ok {
+			m.Path = GreatCircle(from, position, pathPoints)
+		} else if homeKnown {
+			m.Path = GreatCircle(home, position, pathPoints)
+		}
+		markers = append(markers, m)
+	}
+	return markers
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// round keeps four decimals, about 10 m, which is plenty for a map
+func round(v float64) float64 { return math.Round(v*1e4) / 1e4 }
@@ -0,0 +1,109 @@
+package qsomap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/gpsd"
+)
+
+func TestPosition(t *testing.T) {
+	p, ok := Position("FN31pr")
+	if !ok || math.Abs(p.Lat-41.7292) > 1e-3 || math.Abs(p.Lon+72.7083) > 1e-3 {
+		t.Errorf("Position(FN31pr) = %+v, %v", p, ok)
+	}
+
+	// Each locator's centre lies inside it
+	for _, grid := range []string{"JO22", "QF56od", "RR99xx", "AA00aa", "IO91wm48"} {
+		p, ok := Position(grid)
+		if !ok || gpsd.Grid(p.Lat, p.Lon, len(grid)) != grid[:4]+lowerTail(grid) {
+			t.Errorf("Position(%s) = %+v, which is in %s", grid, p, gpsd.Grid(p.Lat, p.Lon, len(grid)))
+		}
+	}
+
+	for _, grid := range []string{"", "FN3", "FN31p", "SN31", "FN3A", "FN31zz", "FN31pr4"} {
+		if _, ok := Position(grid); ok {
+			t.Errorf("Position(%q) should fail", grid)
+		}
+	}
+}
+
+// lowerTail returns the subsquare and extended square of a locator as
+// gpsd.Grid writes them
+func lowerTail(grid string) string {
+	if len(grid) <= 4 {
+		return ""
+	}
+	tail := []byte(grid[4:])
+	tail[0], tail[1] = tail[0]|0x20, tail[1]|0x20
+	return string(tail)
+}
+
+func TestGreatCircle(t *testing.T) {
+	// W1 to G: the short path goes north-east over the Atlantic
+	from, _ := Position("FN31")
+	to, _ := Position("IO91")
+	path := GreatCircle(from, to, 16)
+	if len(path) != 16 {
+		t.Fatalf("got %d points", len(path))
+	}
+	if math.Abs(path[0].Lat-from.Lat) > 1e-3 || math.Abs(path[15].Lon-to.Lon) > 1e-3 {
+		t.Errorf("path does not join the ends: %+v ... %+v", path[0], path[15])
+	}
+	if mid := path[8]; mid.Lat < 50 {
+		t.Errorf("great circle should bow north of both ends, midpoint %+v", mid)
+	}
+
+	// Across the antimeridian, not the long way round
+	from, _ = Position("BL11") // Hawaii
+	to, _ = Position("QM05")   // Japan
+	for _, p := range GreatCircle(from, to, 16) {
+		if p.Lon > -150 && p.Lon < 130 {
+			t.Errorf("path goes the long way: %+v", p)
+		}
+	}
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"FN31", "IO91", 52},  // W1 to G: north-east
+		{"FN31", "PM95", 334}, // W1 to JA: over the pole
+		{"IO91", "FN31", 288},
+		{"JJ00", "JJ50", 90}, // along the equator
+	}
+	for _, tt := range tests {
+		from, _ := Position(tt.from)
+		to, _ := Position(tt.to)
+		if got := Bearing(from, to); math.Abs(got-tt.want) > 1 {
+			t.Errorf("Bearing(%s, %s) = %.1f, want about %.0f", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	qsos := []formatter.QSO{
+		{ID: "1", Callsign: "G4ABC", Band: "20m", Grid: "io91"},
+		{ID: "2", Callsign: "K2XYZ", Band: "40m"},
+		{ID: "3", Callsign: "JA1ABC", Band: "5m", Grid: "PM95", MyGrid: "CM87"},
+	}
+	markers := Markers(qsos, "FN31pr")
+	if len(markers) != 2 {
+		t.Fatalf("got %d markers, want 2: %+v", len(markers), markers)
+	}
+	if m := markers[0]; m.Grid != "IO91" || m.Color != "#f2c40c" || len(m.Path) != pathPoints {
+		t.Errorf("unexpected marker %+v", m)
+	}
+	// A QSO's own grid, e.g. a rover's from GPS, is where its path starts
+	home, _ := Position("CM87")
+	if m := markers[1]; m.Color != otherBand || m.Path[0] != (Point{Lat: round(home.Lat), Lon: round(home.Lon)}) {
+		t.Errorf("unexpected marker %+v", m)
+	}
+
+	if markers := Markers(qsos[:1], ""); markers[0].Path != nil {
+		t.Error("no path without a station grid")
+	}
+}
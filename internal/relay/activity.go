@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/activity"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// trackActivity feeds the band activity tracker from WSJT-X: Status messages
+// say which band an instance is on, and its CQ decodes are counted there
+func (r *Relay) trackActivity(data []byte, c *wsjtxClient) {
+	if r.activity == nil || c == nil {
+		return
+	}
+
+	if status, ok := wsjtx.ParseStatus(data); ok {
+		if status.DialFrequency > 0 {
+			r.activity.SetBand(c.id, formatter.FrequencyToBand(float64(status.DialFrequency)/1e6), status.Mode)
+		}
+		return
+	}
+
+	// Repeats of earlier decodes and decodes of recordings say nothing
+	// about the band now
+	decode, ok := wsjtx.ParseDecode(data)
+	if !ok || !decode.New || decode.OffAir {
+		return
+	}
+	if call, grid, ok := wsjtx.ParseCQ(decode.Message); ok {
+		r.activity.Heard(c.id, call, grid, decode.SNR, time.Now())
+	}
+}
+
+// Activity returns the band activity over the configured window
+func (r *Relay) Activity() (activity.Digest, error) {
+	if r.activity == nil {
+		return activity.Digest{}, fmt.Errorf("band activity is not enabled")
+	}
+	return r.activity.Digest(time.Now()), nil
+}
@@ -0,0 +1,109 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/alert"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// newAlerts creates the alert manager and, for new DXCC alerts, loads the
+// country file
+func newAlerts(cfg *config.Config, levels *logging.Levels) (*alert.Manager, *formatter.CTY, error) {
+	ac := cfg.Alerts
+	alertCfg := alert.Config{
+		ParseFailuresPerMinute: ac.ParseFailuresPerMinute,
+		TargetFailures:         ac.TargetFailures,
+		Cooldown:               ac.Cooldown,
+	}
+	for _, e := range ac.Events {
+		alertCfg.Events = append(alertCfg.Events, alert.Event(e))
+	}
+
+	if ac.Desktop {
+		alertCfg.Notifiers = append(alertCfg.Notifiers, alert.Desktop{})
+	}
+	if ac.Telegram.BotToken != "" || ac.Telegram.ChatID != "" {
+		if ac.Telegram.BotToken == "" || ac.Telegram.ChatID == "" {
+			return nil, nil, fmt.Errorf("alerts: telegram needs both bot_token and chat_id")
+		}
+		alertCfg.Notifiers = append(alertCfg.Notifiers, &alert.Telegram{Token: ac.Telegram.BotToken, ChatID: ac.Telegram.ChatID})
+	}
+	if ac.Discord.WebhookURL != "" {
+		alertCfg.Notifiers = append(alertCfg.Notifiers, &alert.Discord{WebhookURL: ac.Discord.WebhookURL})
+	}
+
+	m, err := alert.NewManager(alertCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !m.Enabled(alert.EventNewDXCC) {
+		return m, nil, nil
+	}
+
+	if ac.CTYFile == "" {
+		// Only an error when new_dxcc was asked for by name
+		if len(ac.Events) > 0 {
+			return nil, nil, fmt.Errorf("alerts: new_dxcc needs cty_file")
+		}
+		if levels.Debug(logging.ModuleSinks) {
+			log.Printf("New DXCC alerts disabled: no cty_file configured")
+		}
+		return m, nil, nil
+	}
+	cty, err := formatter.LoadCTY(ac.CTYFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if levels.Debug(logging.ModuleSinks) {
+		log.Printf("Loaded %d prefixes and calls from %s", cty.Len(), ac.CTYFile)
+	}
+	return m, cty, nil
+}
+
+// alertQSO checks a delivered QSO for a new DXCC entity. The callsign is
+// masked in the alert when privacy.redact_callsigns is set.
+func (r *Relay) alertQSO(qso *formatter.QSO) {
+	if r.alerts == nil || r.cty == nil {
+		return
+	}
+	if entity, ok := r.cty.Entity(qso.Callsign); ok {
+		call := qso.Callsign
+		if r.config.Privacy.RedactCallsigns {
+			call = formatter.RedactCallsign(call)
+		}
+		r.alerts.QSO(call, entity)
+	}
+}
+
+// alertWorked records a journaled QSO's DXCC entity as already worked
+func (r *Relay) alertWorked(call string) {
+	if r.alerts == nil || r.cty == nil {
+		return
+	}
+	if entity, ok := r.cty.Entity(call); ok {
+		r.alerts.Worked(entity)
+	}
+}
+
+// alertParseFailed counts a parse failure towards the failure rate alert
+func (r *Relay) alertParseFailed() {
+	if r.alerts != nil {
+		r.alerts.ParseFailed()
+	}
+}
+
+// alertSend records the outcome of a send to a target
+func (r *Relay) alertSend(t *target, err error) {
+	if r.alerts == nil {
+		return
+	}
+	if err != nil {
+		r.alerts.TargetFailed(t.addr, err)
+	} else {
+		r.alerts.TargetOK(t.addr)
+	}
+}
@@ -0,0 +1,147 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// callAlias is a parsed config.CallAlias
+type callAlias struct {
+	call     string
+	station  string
+	operator string
+	network  *net.IPNet // nil matches any source
+	schedule callSchedule
+}
+
+// callSchedule is when an alias applies, by QSO time. The zero schedule
+// always applies.
+type callSchedule struct {
+	from, until time.Time // Absolute; a zero end is open
+
+	// Every day, in minutes after midnight UTC; until may be before from
+	// for a shift across midnight
+	daily             bool
+	fromMin, untilMin int
+}
+
+// Schedule layouts, UTC
+const (
+	scheduleDateTime = "2006-01-02 15:04"
+	scheduleDaily    = "15:04"
+)
+
+// parseCallAliases validates the call alias table
+func parseCallAliases(aliases []config.CallAlias) ([]callAlias, error) {
+	parsed := make([]callAlias, 0, len(aliases))
+	for i, a := range aliases {
+		ca := callAlias{
+			call:     strings.ToUpper(strings.TrimSpace(a.Call)),
+			station:  strings.ToUpper(strings.TrimSpace(a.Station)),
+			operator: strings.ToUpper(strings.TrimSpace(a.Operator)),
+		}
+		if ca.call == "" || ca.station == "" {
+			return nil, fmt.Errorf("call alias %d: set both call and station", i+1)
+		}
+		if ca.operator == "" {
+			ca.operator = ca.call
+		}
+		if a.Source != "" {
+			network, err := parseSource(a.Source)
+			if err != nil {
+				return nil, fmt.Errorf("call alias %d: invalid source %q: %w", i+1, a.Source, err)
+			}
+			ca.network = network
+		}
+		var err error
+		if ca.schedule, err = parseCallSchedule(a.From, a.Until); err != nil {
+			return nil, fmt.Errorf("call alias %d: %w", i+1, err)
+		}
+		parsed = append(parsed, ca)
+	}
+	return parsed, nil
+}
+
+// parseCallSchedule parses from and until, either both times of day or
+// dates with times, either of which may be left out
+func parseCallSchedule(from, until string) (callSchedule, error) {
+	from, until = strings.TrimSpace(from), strings.TrimSpace(until)
+	if from == "" && until == "" {
+		return callSchedule{}, nil
+	}
+
+	if f, err := time.Parse(scheduleDaily, from); err == nil {
+		u, err := time.Parse(scheduleDaily, until)
+		if err != nil {
+			return callSchedule{}, fmt.Errorf("until %q must be a time of day like from, e.g. 06:00", until)
+		}
+		return callSchedule{daily: true, fromMin: f.Hour()*60 + f.Minute(), untilMin: u.Hour()*60 + u.Minute()}, nil
+	}
+
+	var s callSchedule
+	for _, p := range []struct {
+		name, value string
+		t           *time.Time
+	}{{"from", from, &s.from}, {"until", until, &s.until}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := time.Parse(scheduleDateTime, p.value)
+		if err != nil {
+			return callSchedule{}, fmt.Errorf("%s %q is not a UTC date and time like 2024-06-22 18:00, or a time of day", p.name, p.value)
+		}
+		*p.t = t
+	}
+	if !s.from.IsZero() && !s.until.IsZero() && !s.until.After(s.from) {
+		return callSchedule{}, fmt.Errorf("until %s is not after from %s", until, from)
+	}
+	return s, nil
+}
+
+// contains reports whether a QSO made at t falls in the schedule. Until is
+// exclusive.
+func (s callSchedule) contains(t time.Time) bool {
+	t = t.UTC()
+	if s.daily {
+		minute := t.Hour()*60 + t.Minute()
+		if s.fromMin <= s.untilMin {
+			return minute >= s.fromMin && minute < s.untilMin
+		}
+		return minute >= s.fromMin || minute < s.untilMin
+	}
+	return (s.from.IsZero() || !t.Before(s.from)) && (s.until.IsZero() || t.Before(s.until))
+}
+
+// applyCallAliases credits a QSO logged under, or by, a personal call to
+// the club call of the first alias that matches. ip may be nil for sources
+// that aren't network datagrams.
+func (r *Relay) applyCallAliases(qso *formatter.QSO, ip net.IP) {
+	if len(r.aliases) == 0 {
+		return
+	}
+	when := qso.DateTime
+	if when.IsZero() {
+		when = time.Now()
+	}
+	for _, a := range r.aliases {
+		if !strings.EqualFold(qso.MyCall, a.call) && !strings.EqualFold(qso.Operator, a.call) {
+			continue
+		}
+		if a.network != nil && (ip == nil || !a.network.Contains(ip)) {
+			continue
+		}
+		if !a.schedule.contains(when) {
+			continue
+		}
+
+		qso.MyCall = a.station
+		qso.Station = a.station
+		qso.Operator = a.operator
+		return
+	}
+}
@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/auth"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// sourceKey is a parsed config.SourceKey
+type sourceKey struct {
+	network *net.IPNet // nil matches any source
+	secret  string
+}
+
+// authenticator verifies HMAC-signed datagrams
+type authenticator struct {
+	keys    []sourceKey
+	trusted []*net.IPNet
+	maxSkew time.Duration
+}
+
+// newAuthenticator validates the auth configuration
+func newAuthenticator(cfg config.Config) (*authenticator, error) {
+	a := &authenticator{maxSkew: cfg.Auth.MaxSkew}
+
+	for _, k := range cfg.Auth.Keys {
+		if k.Secret == "" {
+			return nil, fmt.Errorf("auth key for source %q has no secret", k.Source)
+		}
+		key := sourceKey{secret: k.Secret}
+		if k.Source != "" {
+			network, err := parseSource(k.Source)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth key source %q: %w", k.Source, err)
+			}
+			key.network = network
+		}
+		a.keys = append(a.keys, key)
+	}
+
+	for _, source := range cfg.Auth.Trusted {
+		network, err := parseSource(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted source %q: %w", source, err)
+		}
+		a.trusted = append(a.trusted, network)
+	}
+
+	return a, nil
+}
+
+// verify returns the payload of a datagram signed with one of the source's
+// keys. Unsigned datagrams are accepted, unchanged, only from trusted sources.
+func (a *authenticator) verify(datagram []byte, ip net.IP) ([]byte, error) {
+	if !auth.Signed(datagram) {
+		if a.isTrusted(ip) {
+			return datagram, nil
+		}
+		return nil, auth.ErrUnsigned
+	}
+
+	err := fmt.Errorf("no key for source %s", ip)
+	for _, k := range a.keys {
+		if k.network != nil && !k.network.Contains(ip) {
+			continue
+		}
+		var payload []byte
+		if payload, err = auth.Verify(datagram, k.secret, time.Now(), a.maxSkew); err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, err
+}
+
+// isTrusted reports whether ip may send without a signature
+func (a *authenticator) isTrusted(ip net.IP) bool {
+	for _, network := range a.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate checks a datagram when source authentication is enabled and
+// returns the payload to process. signed reports that the payload carried a
+// valid signature; ok is false if the datagram was dropped.
+func (r *Relay) authenticate(datagram []byte, source *net.UDPAddr) (payload []byte, signed, ok bool) {
+	if r.auth == nil {
+		return datagram, false, true
+	}
+
+	payload, err := r.auth.verify(datagram, source.IP)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnsigned) {
+			r.stats.Dropped(dropAuthUnsigned)
+		} else {
+			r.stats.Dropped(dropAuthInvalid)
+		}
+		if r.debug(logging.ModuleRelay) {
+			log.Printf("Dropping datagram from %s: %v", source, err)
+		}
+		return nil, false, false
+	}
+	return payload, len(payload) < len(datagram), true
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// bandTracker remembers the band the N1MM targets were last told about
+type bandTracker struct {
+	mu   sync.Mutex
+	band string
+}
+
+// moved records band and reports whether it differs from the last one
+func (b *bandTracker) moved(band string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if band == b.band {
+		return false
+	}
+	b.band = band
+	return true
+}
+
+// announceBand tells the N1MM targets about a forwarded QSO's frequency
+// when it is on a different band from the one they last heard about
+func (r *Relay) announceBand(qso *formatter.QSO) {
+	if !r.config.Formatting.N1MM.BandChanges || qso.Action != formatter.ActionLog {
+		return
+	}
+	r.bandChange(qso.Hz(), qso.Mode, qso.Callsign)
+}
+
+// trackBand follows WSJT-X's dial frequency, so N1MM changes band when the
+// operator does rather than at the next QSO
+func (r *Relay) trackBand(data []byte) {
+	if !r.config.Formatting.N1MM.BandChanges {
+		return
+	}
+	if status, ok := wsjtx.ParseStatus(data); ok {
+		r.bandChange(int64(status.DialFrequency), status.Mode, "WSJT-X")
+	}
+}
+
+// bandChange sends RadioInfo for hz when it is on a new band
+func (r *Relay) bandChange(hz int64, mode, from string) {
+	if hz <= 0 {
+		return
+	}
+	band := formatter.FrequencyToBand(float64(hz) / 1e6)
+	if band == "" || band == "UNK" || !r.band.moved(band) {
+		return
+	}
+	if r.debug(logging.ModuleSinks) {
+		log.Printf("Band change to %s from %s", band, from)
+	}
+	r.broadcastRadioInfo(hz, radioMode(mode, hz))
+}
+
+// radioMode returns the radio mode N1MM shows for a logged mode. Data modes
+// are sent on upper sideband.
+func radioMode(mode string, hz int64) string {
+	switch mode = strings.ToUpper(mode); mode {
+	case "CW", "RTTY", "AM", "FM", "USB", "LSB":
+		return mode
+	case "SSB":
+		if hz < 10_000_000 {
+			return "LSB"
+		}
+		return "USB"
+	}
+	return "USB"
+}
@@ -0,0 +1,93 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+// benchPayloads are representative datagrams from each kind of source. The
+// WSJT-X ADIF is sent as text so that it isn't held for its QSO Logged
+// partner.
+var benchPayloads = []struct {
+	name    string
+	message string
+}{
+	{"wsjtx", "<call:6>VK1ABC<band:3>20m<mode:3>FT8<rst_sent:3>-05<rst_rcvd:3>-12<freq:9>14.074123<qso_date:8>20231012<time_on:6>123000<eor>"},
+	{"fldigi", "<CALL:5>G4ABC<FREQ:9>14.070000<MODE:5>PSK31<QSO_DATE:8>20240601<TIME_ON:6>150000<RST_SENT:3>599<RST_RCVD:3>579<PROGRAMID:6>fldigi<EOR>"},
+	{"varac", `{"app":"VarAC","call":"W1ABC","freq":"14.105","mode":"VARA HF","timestamp":"2024-06-01 16:05:00","rst_sent":"599","rst_rcvd":"599","band":"20m"}`},
+	{"n1mm", `<?xml version="1.0" encoding="utf-8"?><contactinfo app="N1MM Logger Plus"><contestname>CQ-WW-CW</contestname><timestamp>2024-06-01 17:00:12</timestamp><mycall>W1AW</mycall><band>14</band><rxfreq>1402500</rxfreq><txfreq>1402500</txfreq><mode>CW</mode><call>DL1ABC</call><snt>599</snt><rcv>599</rcv><exchange1>14</exchange1></contactinfo>`},
+	{"general", "Worked K1ABC 14.074 MHz 20m FT8"},
+}
+
+// startBenchRelay runs a relay sending to a target that discards what it
+// receives. The per-QSO log lines are discarded too.
+func startBenchRelay(b *testing.B) *Relay {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatalf("failed to open target socket: %v", err)
+	}
+	b.Cleanup(func() { target.Close() })
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			if _, _, err := target.ReadFromUDP(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	cfg := &config.Config{}
+	cfg.Listen.Address = "127.0.0.1"
+	cfg.Target.Address = "127.0.0.1"
+	cfg.Target.Port = target.LocalAddr().(*net.UDPAddr).Port
+	cfg.Target.Format = "n1mm"
+	cfg.Formatting.AutoDetect = true
+	cfg.Formatting.SourceType = "auto"
+	cfg.Formatting.N1MM.Station = "W1AW"
+	cfg.Formatting.N1MM.Operator = "K1ABC"
+	cfg.Formatting.N1MM.Contest = "GENERAL"
+	cfg.Formatting.Time.OutputUTC = true
+
+	r, err := New(cfg)
+	if err != nil {
+		b.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- r.Run(ctx) }()
+	b.Cleanup(func() {
+		cancel()
+		<-errc
+	})
+	select {
+	case <-r.Ready():
+	case err := <-errc:
+		b.Fatalf("relay failed to start: %v", err)
+	}
+	return r
+}
+
+// BenchmarkProcessMessage runs a datagram through the relay's hot path:
+// detection, parsing, enrichment, formatting and the send to a target
+func BenchmarkProcessMessage(b *testing.B) {
+	r := startBenchRelay(b)
+	source := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2237}
+	for _, p := range benchPayloads {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.processMessage(job{message: p.message, addr: source, size: len(p.message)})
+			}
+		})
+	}
+}
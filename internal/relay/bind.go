@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+// InterfaceAddr returns the first IPv4 address of a network interface. It
+// is looked up on every bind, so a listener rebound after a DHCP renewal
+// follows the interface to its new address.
+func InterfaceAddr(name string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %q: %w", name, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %q: %w", name, err)
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %q has no IPv4 address", name)
+}
+
+// BindAddr returns the address a listener binds: its interface's address
+// when it names one, or the configured address or multicast group
+func BindAddr(lc config.ListenerConfig) (string, error) {
+	if lc.Interface == "" || lc.MulticastGroup != "" {
+		return listenerAddr(lc), nil
+	}
+	ip, err := InterfaceAddr(lc.Interface)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(lc.Port)), nil
+}
+
+// targetLocalIP returns the address a target sends from, or nil to let the
+// OS choose. A local address must belong to one of this computer's
+// interfaces.
+func targetLocalIP(tc config.TargetConfig) (net.IP, error) {
+	switch {
+	case tc.Interface != "":
+		return InterfaceAddr(tc.Interface)
+	case tc.LocalAddress != "":
+		ip := net.ParseIP(tc.LocalAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("local address %q is not an IP address", tc.LocalAddress)
+		}
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return ip, nil
+			}
+		}
+		return nil, fmt.Errorf("local address %s is not an address of this computer", ip)
+	}
+	return nil, nil
+}
@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// The reverse bridge listens for N1MM's own broadcasts (RadioInfo,
+// contactinfo, ...), passes them through to other applications and
+// translates what it can back to the WSJT-X instances the relay has heard from.
+
+// wsjtxClient is a WSJT-X instance that sent datagrams to the relay. WSJT-X
+// accepts commands on the socket it sends from, and they are sent from the
+// relay socket it sends to.
+type wsjtxClient struct {
+	id   string
+	addr *net.UDPAddr
+	conn *net.UDPConn
+	seen time.Time
+}
+
+// rememberClient records the sender of a WSJT-X datagram received on conn.
+// It returns nil if data is not a WSJT-X message.
+func (r *Relay) rememberClient(data []byte, addr *net.UDPAddr, conn *net.UDPConn) *wsjtxClient {
+	h, ok := wsjtx.ParseHeader(data)
+	if !ok || h.ID == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients == nil {
+		r.clients = make(map[string]*wsjtxClient)
+	}
+	if c, ok := r.clients[h.ID]; !ok || c.addr.String() != addr.String() {
+		if r.debug(logging.ModuleRelay) {
+			log.Printf("WSJT-X instance %q at %s", h.ID, addr)
+		}
+	}
+	c := &wsjtxClient{id: h.ID, addr: addr, conn: conn, seen: time.Now()}
+	r.clients[h.ID] = c
+	return c
+}
+
+// currentClients returns the WSJT-X instances heard from recently
+func (r *Relay) currentClients() []*wsjtxClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// WSJT-X sends a heartbeat every 15 seconds; anything silent for much
+	// longer has gone away or moved to a new port
+	cutoff := time.Now().Add(-2 * time.Minute)
+	clients := make([]*wsjtxClient, 0, len(r.clients))
+	for _, c := range r.clients {
+		if c.seen.After(cutoff) {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// sendToClients sends a WSJT-X message, built per instance id, to every known
+// WSJT-X instance from the socket it sends to
+func (r *Relay) sendToClients(build func(id string) []byte) {
+	for _, c := range r.currentClients() {
+		if _, err := c.conn.WriteToUDP(build(c.id), c.addr); err != nil {
+			log.Printf("Failed to send to WSJT-X %q at %s: %v", c.id, c.addr, err)
+		}
+	}
+}
+
+// openBridge creates the listener for N1MM broadcasts
+func (r *Relay) openBridge() error {
+	cfg := r.config.Bridge
+	addr := net.JoinHostPort(cfg.ListenAddress, strconv.Itoa(cfg.ListenPort))
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve bridge address: %w", err)
+	}
+
+	r.bridge, err = net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start N1MM bridge listener: %w", err)
+	}
+	return nil
+}
+
+// runBridge listens for N1MM broadcasts until ctx is cancelled
+func (r *Relay) runBridge(ctx context.Context) {
+	defer r.wg.Done()
+
+	cfg := r.config.Bridge
+	conn := r.bridge
+
+	var forward []*net.UDPAddr
+	for _, f := range cfg.Forward {
+		fa, err := net.ResolveUDPAddr("udp", f)
+		if err != nil {
+			log.Printf("Failed to resolve bridge forward address %s: %v", f, err)
+			continue
+		}
+		forward = append(forward, fa)
+	}
+
+	if r.debug(logging.ModuleRelay) {
+		log.Printf("N1MM bridge listening on %s", conn.LocalAddr())
+	}
+
+	var lastMode string
+	buffer := make([]byte, 65536)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if r.debug(logging.ModuleRelay) {
+				log.Printf("Error reading N1MM broadcast: %v", err)
+			}
+			continue
+		}
+		message := string(buffer[:n])
+
+		// Never bounce the relay's own output back around the loop
+		if r.formatter.IsRelayOutput(message) {
+			continue
+		}
+
+		for _, fa := range forward {
+			if _, err := conn.WriteToUDP(buffer[:n], fa); err != nil && r.debug(logging.ModuleRelay) {
+				log.Printf("Failed to pass N1MM broadcast to %s: %v", fa, err)
+			}
+		}
+
+		if formatter.IsRadioInfo(message) && cfg.WSJTXModeSync {
+			lastMode = r.bridgeRadioInfo(message, lastMode)
+		}
+
+		if formatter.IsLookupInfo(message) && r.lookup != nil {
+			r.bridgeLookupInfo(message)
+		}
+
+		if formatter.N1MMBroadcastKind(message) == formatter.N1MMBroadcastScore {
+			r.postScore(message, addr.String(), 0)
+		}
+	}
+}
+
+// bridgeRadioInfo pushes N1MM mode changes to WSJT-X. It returns the mode
+// now in effect. WSJT-X's UDP protocol cannot change the dial frequency, so
+// frequency changes are only logged.
+func (r *Relay) bridgeRadioInfo(message, lastMode string) string {
+	info, err := formatter.ParseRadioInfo(message)
+	if err != nil {
+		if r.debug(logging.ModuleRelay) {
+			log.Printf("Skipping N1MM RadioInfo: %v", err)
+		}
+		return lastMode
+	}
+
+	mode := strings.ToUpper(strings.TrimSpace(info.Mode))
+	if r.debug(logging.ModuleRelay) {
+		log.Printf("N1MM radio %d: %s %s", info.RadioNr, formatter.FormatMHz(info.FrequencyHz()), mode)
+	}
+	if mode == lastMode || !wsjtx.IsMode(mode) {
+		return mode
+	}
+
+	r.sendToClients(func(id string) []byte {
+		return wsjtx.ConfigureMessage(id, wsjtx.Configure{
+			Mode:               mode,
+			FrequencyTolerance: wsjtx.NoChange,
+			TRPeriod:           wsjtx.NoChange,
+			RxDF:               wsjtx.NoChange,
+		})
+	})
+	log.Printf("N1MM switched to %s, sent mode change to WSJT-X", mode)
+	return mode
+}
@@ -0,0 +1,348 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// tcpDialTimeout bounds how long a send to a TCP target may wait on connecting
+const tcpDialTimeout = 5 * time.Second
+
+// nodeID returns the name this relay adds to the path of chained QSOs
+func nodeID(configured, pipeline string) string {
+	id := configured
+	if id == "" {
+		id = "N7AKG-UDP-Translator"
+		if host, err := os.Hostname(); err == nil && host != "" {
+			id = host
+		}
+	}
+
+	// Pipelines in one process need names of their own for loop markers
+	if pipeline != "" {
+		id += "/" + pipeline
+	}
+	return id
+}
+
+// tlsHandshakeTimeout bounds how long a chain connection may take to agree
+// on TLS
+const tlsHandshakeTimeout = 10 * time.Second
+
+// helloTimeout is how long a relay waits for the hello of the relay it
+// connected to. Relays from before protocol version 2 never answer, so
+// connecting to one takes this long.
+const helloTimeout = 2 * time.Second
+
+// tcpConn sends framed messages to a TCP target; newline-delimited for
+// another relay. The connection
+// is made on first use and remade after a write error, so a central relay
+// that restarts is picked up again without restarting this one.
+type tcpConn struct {
+	addr    string
+	tls     *tls.Config // Set for TLS targets
+	local   net.IP      // Address to connect from; nil lets the OS choose
+	hello   string      // This relay's hello line; empty for targets that aren't relays
+	framing Framing
+	mu      sync.Mutex
+	conn    net.Conn
+	peer    int // Relay protocol version agreed with the connected relay
+	closed  bool
+}
+
+// dial connects to the target, over TLS if configured, and agrees on the
+// relay protocol version with it
+func (c *tcpConn) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: tcpDialTimeout}
+	if c.local != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: c.local}
+	}
+	var conn net.Conn
+	if c.tls == nil {
+		var err error
+		if conn, err = dialer.Dial("tcp", c.addr); err != nil {
+			return nil, err
+		}
+	} else {
+		start := time.Now()
+		tlsConn, err := tls.DialWithDialer(dialer, "tcp", c.addr, c.tls)
+		if err != nil {
+			return nil, err
+		}
+		// A relay answers the hello, and reading that answer brings any
+		// refusal with it; only other targets have to wait for one
+		if c.hello == "" {
+			if err := confirmTLS(tlsConn, time.Since(start)); err != nil {
+				tlsConn.Close()
+				return nil, err
+			}
+		}
+		conn = tlsConn
+	}
+
+	if c.hello == "" {
+		return conn, nil
+	}
+	if err := c.negotiate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// negotiate sends this relay's hello and reads the other relay's, to agree
+// on the newest protocol version both speak. A relay that doesn't answer
+// predates hellos and reads version 1.
+func (c *tcpConn) negotiate(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte(c.hello + "\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		c.peer = formatter.RelayMinVersion
+		log.Printf("Relay %s sent no hello, sending it protocol version %d", c.addr, c.peer)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading hello: %w", err)
+	}
+
+	hello, err := formatter.ParseRelayHello(line)
+	if err != nil {
+		return err
+	}
+	if c.peer, err = formatter.NegotiateRelayVersion(formatter.RelayVersion, hello); err != nil {
+		return err
+	}
+	if c.peer < formatter.RelayVersion {
+		log.Printf("Relay %s (%s %s) reads protocol version %d, sending it that", c.addr, hello.Node, hello.Software, c.peer)
+	}
+	return nil
+}
+
+// confirmTLS waits for the other relay to refuse a new TLS connection. A
+// TLS 1.3 client finishes its handshake before the server has checked the
+// client's certificate, and the server's refusal arrives about a round trip
+// later; without waiting, a refused relay would keep writing QSOs that are
+// never read. Connecting took at least two round trips, so waiting as long
+// again is enough. Such a target never writes, so the read either fails
+// with the refusal or times out. The wait, at least 100ms, happens while
+// Write holds the connection's lock, so each reconnect stalls the sends to
+// that target for as long.
+func confirmTLS(conn *tls.Conn, connect time.Duration) error {
+	conn.SetReadDeadline(time.Now().Add(max(connect, 100*time.Millisecond)))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, err := conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	return fmt.Errorf("%s refused the connection: %w", conn.RemoteAddr(), err)
+}
+
+// Write sends one message in a frame, reconnecting once if the existing
+// connection has failed
+func (c *tcpConn) Write(message []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if c.conn, err = c.dial(); err != nil {
+				c.conn = nil
+				return 0, err
+			}
+		}
+
+		// The relay on the other end may be older than this one
+		envelope := string(message)
+		if formatter.IsRelayEnvelope(envelope) {
+			if envelope, err = formatter.DowngradeRelay(envelope, c.peer); err != nil {
+				return 0, err
+			}
+		}
+		frame := appendFrame(make([]byte, 0, len(envelope)+len(envelope)/254+4), c.framing, []byte(envelope))
+
+		c.conn.SetWriteDeadline(time.Now().Add(tcpDialTimeout))
+		if _, err = c.conn.Write(frame); err == nil {
+			return len(message), nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the connection; later writes fail
+func (c *tcpConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// openChain starts the TCP listener for chained QSOs. With chain.tls set,
+// it only accepts TLS connections from trusted relays.
+func (r *Relay) openChain() error {
+	ln, err := net.Listen("tcp", r.config.Chain.TCPListen)
+	if err != nil {
+		return fmt.Errorf("failed to start chain listener on %s: %w", r.config.Chain.TCPListen, err)
+	}
+	if r.peerTLS != nil {
+		ln = tls.NewListener(ln, r.peerTLS.Server())
+	}
+	r.chain = ln
+	return nil
+}
+
+// runChain accepts connections from remote relays until ctx is cancelled.
+// Connections still open at shutdown are closed.
+func (r *Relay) runChain(ctx context.Context) {
+	defer r.wg.Done()
+
+	if r.debug(logging.ModuleRelay) {
+		transport := "TCP"
+		if r.peerTLS != nil {
+			transport = "TLS"
+		}
+		log.Printf("Accepting chained QSOs over %s on %s", transport, r.chain.Addr())
+	}
+
+	var conns sync.WaitGroup
+	var mu sync.Mutex
+	open := make(map[net.Conn]struct{})
+
+	for {
+		conn, err := r.chain.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				break
+			}
+			log.Printf("Error accepting chain connection: %v", err)
+			continue
+		}
+
+		mu.Lock()
+		open[conn] = struct{}{}
+		mu.Unlock()
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			r.readChain(conn)
+			mu.Lock()
+			delete(open, conn)
+			mu.Unlock()
+		}()
+	}
+
+	mu.Lock()
+	for conn := range open {
+		conn.Close()
+	}
+	mu.Unlock()
+	conns.Wait()
+}
+
+// readChain processes newline-delimited QSOs from one remote relay. Plain
+// TCP chain connections are not signed; with auth enabled only trusted
+// sources may connect, so run them over a VPN or tunnel. A relay that
+// connects over TLS has proven itself with its certificate instead.
+func (r *Relay) readChain(conn net.Conn) {
+	defer conn.Close()
+
+	remote := conn.RemoteAddr().(*net.TCPAddr)
+	source := &net.UDPAddr{IP: remote.IP, Port: remote.Port, Zone: remote.Zone}
+
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if isTLS {
+		conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			r.stats.Dropped(dropAuthInvalid)
+			log.Printf("Refusing chain connection from %s: %v", remote, err)
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	} else if r.auth != nil && !r.auth.isTrusted(source.IP) {
+		r.stats.Dropped(dropAuthUnsigned)
+		log.Printf("Refusing chain connection from untrusted source %s", remote)
+		return
+	}
+
+	if r.debug(logging.ModuleRelay) {
+		if isTLS {
+			log.Printf("Chain connection from %s (%s)", remote, tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName)
+		} else {
+			log.Printf("Chain connection from %s", remote)
+		}
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxBufferSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if formatter.IsRelayHello(line) {
+			if err := r.answerHello(conn, line); err != nil {
+				log.Printf("Closing chain connection from %s: %v", remote, err)
+				return
+			}
+			continue
+		}
+		if !formatter.IsRelayEnvelope(line) {
+			if r.debug(logging.ModuleRelay) {
+				log.Printf("Ignoring non-relay line from chain connection %s", remote)
+			}
+			continue
+		}
+		r.processMessage(job{message: line, addr: source, size: len(line), trusted: true, trace: r.traceDatagram([]byte(line), source)})
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Chain connection from %s failed: %v", remote, err)
+	}
+}
+
+// answerHello replies to the hello of a relay that connected with this
+// relay's own, so the other relay knows which protocol versions it reads
+func (r *Relay) answerHello(conn net.Conn, line string) error {
+	hello, err := formatter.ParseRelayHello(line)
+	if err != nil {
+		return err
+	}
+	if _, err := formatter.NegotiateRelayVersion(formatter.RelayVersion, hello); err != nil {
+		// Answer anyway, so the other relay can say why it gives up
+		log.Printf("Chain connection from %s: %v", conn.RemoteAddr(), err)
+	} else if r.debug(logging.ModuleRelay) {
+		log.Printf("Chain connection from %s is relay %s %s, protocol versions %d to %d",
+			conn.RemoteAddr(), hello.Node, hello.Software, hello.MinVersion, hello.Version)
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	_, err = conn.Write([]byte(r.formatter.HelloLine() + "\n"))
+	return err
+}
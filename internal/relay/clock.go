@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// clockDrift corrects QSO timestamps from source machines whose clocks are
+// further from the relay's than the threshold
+type clockDrift struct {
+	threshold time.Duration
+	clamp     bool // move the timestamp to the threshold instead of to now
+	now       func() time.Time
+}
+
+// newClockDrift checks the drift settings; it returns nil when compensation
+// is off
+func newClockDrift(cfg *config.Config) (*clockDrift, error) {
+	tc := cfg.Formatting.Time
+	if tc.DriftThreshold < 0 {
+		return nil, fmt.Errorf("invalid drift_threshold %s", tc.DriftThreshold)
+	}
+
+	d := &clockDrift{threshold: tc.DriftThreshold, now: time.Now}
+	switch tc.DriftAction {
+	case "", "replace":
+	case "clamp":
+		d.clamp = true
+	default:
+		return nil, fmt.Errorf("invalid drift_action %q (use replace or clamp)", tc.DriftAction)
+	}
+
+	if d.threshold == 0 {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// compensateDrift corrects the timestamp of a QSO that is off by more than
+// the threshold and logs the measured skew
+func (r *Relay) compensateDrift(qso *formatter.QSO, msgType formatter.MessageType, source *net.UDPAddr, trace uint64) {
+	if r.drift == nil || qso.DateTime.IsZero() {
+		return
+	}
+
+	now := r.drift.now()
+	skew := qso.DateTime.Sub(now)
+	if skew.Abs() <= r.drift.threshold {
+		return
+	}
+
+	corrected := now
+	action := "replaced with relay time"
+	if r.drift.clamp {
+		action = "clamped"
+		if skew > 0 {
+			corrected = now.Add(r.drift.threshold)
+		} else {
+			corrected = now.Add(-r.drift.threshold)
+		}
+	}
+
+	direction := "ahead"
+	if skew < 0 {
+		direction = "behind"
+	}
+	log.Printf("Warning: clock of %s (%s) is %s %s; timestamp of QSO with %s %s",
+		source, msgType, skew.Abs().Round(time.Second), direction, qso.Callsign, action)
+	r.tracef(trace, "timestamp %s is %s %s, %s", qso.DateTime.UTC().Format(time.RFC3339), skew.Abs().Round(time.Second), direction, action)
+
+	qso.DateTime = corrected.In(qso.DateTime.Location())
+}
+
+// tooOld checks a logged QSO against formatting.time.max_age and reports
+// whether to drop it. VarAC and JS8Call can replay their log when they
+// start, which would forward every old QSO again. With max_age_action flag
+// an old QSO is forwarded with its age noted in the comment instead.
+func (r *Relay) tooOld(qso *formatter.QSO, msgType formatter.MessageType, source *net.UDPAddr, trace uint64) bool {
+	tc := r.config.Formatting.Time
+	if tc.MaxAge <= 0 || tc.AcceptOld || qso.Action != formatter.ActionLog || qso.DateTime.IsZero() {
+		return false
+	}
+
+	age := time.Since(qso.DateTime)
+	if age <= tc.MaxAge {
+		return false
+	}
+	age = age.Round(time.Minute)
+
+	if tc.MaxAgeAction == "flag" {
+		note := fmt.Sprintf("Old QSO: logged %s ago", age)
+		if qso.Comment == "" {
+			qso.Comment = note
+		} else {
+			qso.Comment += "; " + note
+		}
+		r.tracef(trace, "timestamp %s is %s old, flagged", qso.DateTime.UTC().Format(time.RFC3339), age)
+		return false
+	}
+
+	r.stats.Dropped(dropTooOld)
+	r.tracef(trace, "dropped: timestamp %s is %s old, more than max_age %s", qso.DateTime.UTC().Format(time.RFC3339), age, tc.MaxAge)
+	if r.debug(logging.ModuleFormatter) {
+		log.Printf("Dropping QSO with %s from %s (%s): logged %s ago", qso.Callsign, source, msgType, age)
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// COBS (Consistent Overhead Byte Stuffing) removes every zero byte from a
+// message, at a cost of one byte in 254, so a zero can mark where each
+// message ends. Serial links use it because a reader that starts mid-stream
+// finds the next message at the next zero.
+
+// errCOBS is returned for a frame that is not valid COBS
+var errCOBS = errors.New("invalid COBS frame")
+
+// cobsEncode appends the COBS encoding of src to dst, without the zero
+// delimiter
+func cobsEncode(dst, src []byte) []byte {
+	codeAt := len(dst)
+	dst = append(dst, 0)
+	code := byte(1)
+	for i, b := range src {
+		if b != 0 {
+			dst = append(dst, b)
+			code++
+		}
+		// A full block at the very end needs no empty block after it
+		if b == 0 || code == 0xFF && i < len(src)-1 {
+			dst[codeAt] = code
+			codeAt = len(dst)
+			dst = append(dst, 0)
+			code = 1
+		}
+	}
+	dst[codeAt] = code
+	return dst
+}
+
+// cobsDecode decodes a COBS frame without its zero delimiter
+func cobsDecode(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src))
+	for i := 0; i < len(src); {
+		code := int(src[i])
+		if code == 0 || i+code > len(src) {
+			return nil, errCOBS
+		}
+		dst = append(dst, src[i+1:i+code]...)
+		i += code
+		if code < 0xFF && i < len(src) {
+			dst = append(dst, 0)
+		}
+	}
+	return dst, nil
+}
+
+// splitCOBS is a bufio.SplitFunc returning the frames between zero bytes,
+// without the zero
+func splitCOBS(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, fmt.Errorf("last COBS frame has no end: %w", io.ErrUnexpectedEOF)
+	}
+	return 0, nil, nil
+}
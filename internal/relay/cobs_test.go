@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// nonZero returns n bytes counting up from first, skipping zero
+func nonZero(first byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = first
+		if first++; first == 0 {
+			first = 1
+		}
+	}
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestCOBS(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		encoded []byte
+	}{
+		{"empty", nil, []byte{0x01}},
+		{"zero", []byte{0x00}, []byte{0x01, 0x01}},
+		{"two zeros", []byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01}},
+		{"zero between", []byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33}},
+		{"no zero", []byte{0x11, 0x22, 0x33, 0x44}, []byte{0x05, 0x11, 0x22, 0x33, 0x44}},
+		{"trailing zeros", []byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01}},
+		{"253 bytes", nonZero(1, 253), concat([]byte{0xFE}, nonZero(1, 253))},
+		{"254 bytes", nonZero(1, 254), concat([]byte{0xFF}, nonZero(1, 254))},
+		{"255 bytes", nonZero(1, 255), concat([]byte{0xFF}, nonZero(1, 254), []byte{0x02, 0xFF})},
+		{"zero then 254 bytes", concat([]byte{0x00}, nonZero(1, 254)), concat([]byte{0x01, 0xFF}, nonZero(1, 254))},
+		{"254 bytes then zero", concat(nonZero(2, 254), []byte{0x00}), concat([]byte{0xFF}, nonZero(2, 254), []byte{0x01, 0x01})},
+		{"253 bytes, zero, byte", concat(nonZero(3, 253), []byte{0x00, 0x01}), concat([]byte{0xFE}, nonZero(3, 253), []byte{0x02, 0x01})},
+		{"508 bytes", concat(nonZero(1, 254), nonZero(1, 254)), concat([]byte{0xFF}, nonZero(1, 254), []byte{0xFF}, nonZero(1, 254))},
+		{"508 bytes with zero", concat(nonZero(1, 254), []byte{0x00}, nonZero(1, 253)), concat([]byte{0xFF}, nonZero(1, 254), []byte{0x01, 0xFE}, nonZero(1, 253))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := cobsEncode(nil, test.message)
+			if !bytes.Equal(encoded, test.encoded) {
+				t.Fatalf("cobsEncode = % x\nexpected % x", encoded, test.encoded)
+			}
+			if bytes.IndexByte(encoded, 0) >= 0 {
+				t.Fatalf("encoding holds a zero byte: % x", encoded)
+			}
+			decoded, err := cobsDecode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, test.message) {
+				t.Errorf("cobsDecode = % x\nexpected % x", decoded, test.message)
+			}
+		})
+	}
+}
+
+func TestCOBSDecodeInvalid(t *testing.T) {
+	for _, frame := range [][]byte{
+		{0x00},
+		{0x05, 0x11, 0x22},
+		concat([]byte{0xFF}, nonZero(1, 253)),
+	} {
+		if _, err := cobsDecode(frame); !errors.Is(err, errCOBS) {
+			t.Errorf("cobsDecode(% x) = %v, expected %v", frame, err, errCOBS)
+		}
+	}
+}
+
+func TestReadCOBSFrames(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 0)
+	for _, message := range []string{"first", "second\x00with a zero", strings.Repeat("x", 600)} {
+		stream = append(cobsEncode(stream, []byte(message)), 0)
+	}
+	var messages []string
+	if err := readFrames(bytes.NewReader(stream), FramingCOBS, func(m []byte) {
+		messages = append(messages, string(m))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 || messages[1] != "second\x00with a zero" || len(messages[2]) != 600 {
+		t.Errorf("read %q", messages)
+	}
+
+	err := readFrames(bytes.NewReader([]byte{0x02, 'a'}), FramingCOBS, func([]byte) {})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected EOF for an unfinished frame, got %v", err)
+	}
+
+	// An endless frame stops at the buffer limit instead of filling memory
+	err = readFrames(io.LimitReader(neverZero{}, 2*maxBufferSize), FramingCOBS, func([]byte) {})
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected an oversize frame error, got %v", err)
+	}
+}
+
+// neverZero is an endless stream without a zero byte
+type neverZero struct{}
+
+func (neverZero) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
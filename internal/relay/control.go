@@ -0,0 +1,204 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// Runtime controls used by the control API. These are safe to call while
+// Run is active.
+
+// debug reports whether a module currently logs at debug level
+func (r *Relay) debug(m logging.Module) bool {
+	return r.levels.Debug(m)
+}
+
+// SetVerbose turns debug logging on or off for every module
+func (r *Relay) SetVerbose(verbose bool) {
+	r.levels.SetAll(verbose)
+	log.Printf("Verbose logging set to %t", verbose)
+}
+
+// LogLevels returns each module's log level
+func (r *Relay) LogLevels() map[string]string {
+	return r.levels.Map()
+}
+
+// SetLogLevels changes the log level of the modules named in levels, or of
+// every module for "all", e.g. {"formatter": "debug"}
+func (r *Relay) SetLogLevels(levels map[string]string) error {
+	if err := r.levels.Set(levels); err != nil {
+		return err
+	}
+	log.Printf("Debug logging for: %s", r.levels)
+	return nil
+}
+
+// isPaused reports whether forwarding is paused
+func (r *Relay) isPaused() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused
+}
+
+// Pause stops forwarding QSOs to targets; incoming datagrams are still read and parsed
+func (r *Relay) Pause() {
+	r.mu.Lock()
+	r.paused = true
+	r.mu.Unlock()
+	log.Println("Forwarding paused")
+	r.publish(events.Event{Type: events.TypePaused})
+}
+
+// Resume restarts forwarding after Pause
+func (r *Relay) Resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.mu.Unlock()
+	log.Println("Forwarding resumed")
+	r.publish(events.Event{Type: events.TypeResumed})
+}
+
+// SetOperator sets the operator on duty, credited with the QSOs forwarded
+// from now on in place of formatting.n1mm.operator. Per-source overrides
+// still credit their own operator. An empty call goes back to the
+// configured operator.
+func (r *Relay) SetOperator(call string) error {
+	call = strings.ToUpper(strings.TrimSpace(call))
+	if call != "" && !formatter.ValidCallsign(call) {
+		return fmt.Errorf("%q is not a valid callsign", call)
+	}
+	r.mu.Lock()
+	r.onDuty = call
+	r.mu.Unlock()
+
+	if call == "" {
+		call = r.config.Formatting.N1MM.Operator
+	}
+	log.Printf("Operator on duty: %s", call)
+	return nil
+}
+
+// Operator returns the operator credited with new QSOs: the one on duty,
+// or the configured one
+func (r *Relay) Operator() string {
+	if call := r.dutyOperator(); call != "" {
+		return call
+	}
+	return r.config.Formatting.N1MM.Operator
+}
+
+// dutyOperator returns the operator set with SetOperator, or ""
+func (r *Relay) dutyOperator() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.onDuty
+}
+
+// currentConsole returns the console QSOs are shown on, or nil
+func (r *Relay) currentConsole() *logging.Console {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.console
+}
+
+// SetConsole shows each relayed QSO as one line on c instead of logging a
+// line per target; nil goes back to the log lines
+func (r *Relay) SetConsole(c *logging.Console) {
+	r.mu.Lock()
+	r.console = c
+	r.mu.Unlock()
+}
+
+// currentTargets returns a snapshot of the active targets
+func (r *Relay) currentTargets() []*target {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*target(nil), r.targets...)
+}
+
+// Targets returns the configuration of the active targets
+func (r *Relay) Targets() []config.TargetConfig {
+	targets := r.currentTargets()
+	configs := make([]config.TargetConfig, 0, len(targets))
+	for _, t := range targets {
+		configs = append(configs, t.config)
+	}
+	return configs
+}
+
+// SetTargets replaces the active targets. All new targets are validated and
+// opened before any existing connection is closed, so a bad entry leaves the
+// current targets untouched.
+func (r *Relay) SetTargets(configs []config.TargetConfig) error {
+	if len(configs) == 0 {
+		return fmt.Errorf("at least one target is required")
+	}
+
+	var opened []*target
+	for _, tc := range configs {
+		if tc.Format == "" {
+			tc.Format = string(formatter.OutputFormatN1MM)
+		}
+		if err := validateTarget(tc); err != nil {
+			closeTargets(opened)
+			return err
+		}
+		t, err := r.dialTarget(tc)
+		if err != nil {
+			closeTargets(opened)
+			return err
+		}
+		opened = append(opened, t)
+	}
+
+	r.mu.Lock()
+	old := r.targets
+	r.targets = opened
+	r.mu.Unlock()
+
+	closeTargets(old)
+
+	for _, t := range opened {
+		log.Printf("Now forwarding to %s (%s)", t.addr, t.format)
+	}
+	return nil
+}
+
+// closeTargets closes the given target connections
+func closeTargets(targets []*target) {
+	for _, t := range targets {
+		t.close()
+	}
+}
+
+// Replay re-sends every journaled QSO recorded at or after since to the
+// current targets and returns how many were sent
+func (r *Relay) Replay(since time.Time) (int, error) {
+	if r.journal == nil {
+		return 0, fmt.Errorf("journal is not enabled")
+	}
+
+	entries, err := r.journal.Entries(since)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, e := range entries {
+		qso := e.QSO
+		if sent, _ := r.forward(&qso, e.Type, fmt.Sprintf("Journal replay of %s QSO from %s", e.Type, e.Time.Format(time.RFC3339)), nil); sent > 0 {
+			count++
+		}
+	}
+
+	log.Printf("Replayed %d of %d journaled QSOs", count, len(entries))
+	return count, nil
+}
@@ -0,0 +1,158 @@
+package relay
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/mapping"
+)
+
+// dropDuplicate counts QSOs no target got because they repeat one already
+// forwarded
+const dropDuplicate = "duplicate"
+
+// dedupRule is a parsed config.DedupRule, or the dedup settings themselves
+type dedupRule struct {
+	window    time.Duration
+	fields    []string
+	perTarget bool // Each target gets a QSO once, rather than the relay forwarding it once
+}
+
+// dedupKey is a QSO as the deduper compares it
+type dedupKey struct {
+	key     string
+	rule    dedupRule
+	repeats int // Targets forward held the QSO back from
+}
+
+// deduper recognizes repeats of forwarded QSOs: QSOs whose fields match
+// those of one forwarded less than a window ago
+type deduper struct {
+	fallback dedupRule
+	rules    map[formatter.MessageType]dedupRule // The first rule for each type
+
+	mu        sync.Mutex
+	expires   map[string]time.Time // When each key, with the target for per-target rules, stops blocking repeats
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// newDeduper parses the dedup settings
+func newDeduper(cfg config.Config) (*deduper, error) {
+	d := &deduper{
+		rules:   make(map[formatter.MessageType]dedupRule),
+		expires: make(map[string]time.Time),
+		now:     time.Now,
+	}
+	var err error
+	if d.fallback, err = parseDedupRule(cfg.Dedup.Window, cfg.Dedup.Fields, cfg.Dedup.Scope); err != nil {
+		return nil, fmt.Errorf("dedup: %w", err)
+	}
+	for i, r := range cfg.Dedup.Rules {
+		fields, scope := r.Fields, r.Scope
+		if len(fields) == 0 {
+			fields = cfg.Dedup.Fields
+		}
+		if scope == "" {
+			scope = cfg.Dedup.Scope
+		}
+		rule, err := parseDedupRule(r.Window, fields, scope)
+		if err != nil {
+			return nil, fmt.Errorf("dedup rule %d: %w", i+1, err)
+		}
+		msgType := formatter.MessageType(strings.ToLower(r.Type))
+		if !formatter.ValidMessageType(string(msgType)) {
+			return nil, fmt.Errorf("dedup rule %d: unknown source type %q", i+1, r.Type)
+		}
+		if _, ok := d.rules[msgType]; !ok {
+			d.rules[msgType] = rule
+		}
+	}
+	return d, nil
+}
+
+// parseDedupRule checks the fields and scope of a rule
+func parseDedupRule(window time.Duration, fields []string, scope string) (dedupRule, error) {
+	rule := dedupRule{window: window, perTarget: scope == "target"}
+	for _, name := range fields {
+		field, err := mapping.MatchField(name)
+		if err != nil {
+			return dedupRule{}, err
+		}
+		rule.fields = append(rule.fields, field)
+	}
+	if len(rule.fields) == 0 {
+		return dedupRule{}, fmt.Errorf("no fields to compare")
+	}
+	return rule, nil
+}
+
+// key returns the key of a QSO from a source of msgType under the rule for
+// the type. It reports false when repeats from the type are let through.
+func (d *deduper) key(qso *formatter.QSO, msgType formatter.MessageType) (*dedupKey, bool) {
+	if d == nil {
+		return nil, false
+	}
+	rule, ok := d.rules[msgType]
+	if !ok {
+		rule = d.fallback
+	}
+	if rule.window <= 0 {
+		return nil, false
+	}
+
+	values := mapping.Values(qso, msgType)
+	parts := make([]string, len(rule.fields))
+	for i, field := range rule.fields {
+		parts[i] = field + "=" + strings.ToUpper(strings.TrimSpace(values[field]))
+	}
+	return &dedupKey{key: strings.Join(parts, "|"), rule: rule}, true
+}
+
+// repeat reports whether target, or the relay for an empty target, was
+// sent a QSO with the key within the window. If not, the QSO is recorded
+// as sent in the same step, so of two workers with the same QSO only one
+// sends it; the caller forgets it again if the send fails.
+func (d *deduper) repeat(k *dedupKey, target string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen(k, target) {
+		return true
+	}
+	d.expires[k.key+"|"+target] = d.now().Add(k.rule.window)
+	return false
+}
+
+// forget lets a QSO that turned out not to be sent through again
+func (d *deduper) forget(k *dedupKey, target string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.expires, k.key+"|"+target)
+}
+
+// seen reports whether a key blocks repeats to target. The caller holds
+// d.mu.
+func (d *deduper) seen(k *dedupKey, target string) bool {
+	now := d.now()
+	d.prune(now)
+	until, ok := d.expires[k.key+"|"+target]
+	return ok && now.Before(until)
+}
+
+// prune drops keys that no longer block anything, at most once a minute.
+// The caller holds d.mu.
+func (d *deduper) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < time.Minute {
+		return
+	}
+	d.lastPrune = now
+	for id, until := range d.expires {
+		if !now.Before(until) {
+			delete(d.expires, id)
+		}
+	}
+}
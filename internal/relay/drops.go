@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+)
+
+// Datagrams the relay hasn't read yet wait in the listener socket's kernel
+// receive buffer. When a pileup fills it, the kernel drops further datagrams
+// without the relay ever seeing them, which looks just like a lost QSO. Where
+// the OS exposes its drop counters, the relay reads them and logs the drops,
+// so buffer exhaustion can be told apart from a relay bug.
+
+// setReceiveBuffer sets a listener socket's kernel receive buffer to
+// listen.receive_buffer, which takes precedence over performance mode's
+// socket_buffer
+func (r *Relay) setReceiveBuffer(conn *net.UDPConn, name string) {
+	size := r.config.Listen.ReceiveBuffer
+	if size <= 0 {
+		if r.performanceEnabled() && r.config.Performance.SocketBuffer > 0 {
+			checkReceiveBuffer(conn, name, r.config.Performance.SocketBuffer)
+		}
+		return
+	}
+	if err := conn.SetReadBuffer(size); err != nil {
+		log.Printf("Failed to set %s receive buffer to %d bytes: %v", name, size, err)
+		return
+	}
+	checkReceiveBuffer(conn, name, size)
+}
+
+// checkReceiveBuffer warns when the OS granted a smaller receive buffer than
+// was asked for. Linux silently caps it at net.core.rmem_max.
+func checkReceiveBuffer(conn *net.UDPConn, name string, size int) {
+	if got, ok := receiveBufferSize(conn); ok && got < size {
+		log.Printf("The %s receive buffer is %d bytes, not the %d asked for: the OS caps it (on Linux raise net.core.rmem_max)", name, got, size)
+	}
+}
+
+// kernelDrops is a listener socket's drop counter as last read
+type kernelDrops struct {
+	conn  *net.UDPConn
+	count uint64
+}
+
+// runDropCheck reads the kernel's drop counters of the listener sockets once
+// per listen.drop_check until ctx is cancelled
+func (r *Relay) runDropCheck(ctx context.Context) {
+	defer r.wg.Done()
+
+	interval := r.config.Listen.DropCheck
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := make(map[*listener]kernelDrops)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkDrops(last, interval)
+		}
+	}
+}
+
+// checkDrops logs and counts the datagrams the kernel dropped on each
+// listener since the last check
+func (r *Relay) checkDrops(last map[*listener]kernelDrops, interval time.Duration) {
+	for _, l := range r.listeners {
+		conn := l.socket()
+		count, ok := socketDrops(conn)
+		if !ok {
+			continue
+		}
+
+		prev := last[l]
+		last[l] = kernelDrops{conn: conn, count: count}
+		if prev.conn != conn {
+			// A new or rebound socket counts from zero
+			prev.count = 0
+		}
+		if count <= prev.count {
+			continue
+		}
+
+		dropped := count - prev.count
+		r.stats.DroppedN(dropKernel, dropped)
+		log.Printf("The kernel dropped %d datagrams for listener %s in the last %s: its receive buffer was full (raise listen.receive_buffer)", dropped, l.addr, interval)
+	}
+}
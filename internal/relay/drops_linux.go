@@ -0,0 +1,88 @@
+//go:build linux
+
+package relay
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelDropCounters reports whether socketDrops works on this platform
+const kernelDropCounters = true
+
+// socketDrops returns the number of datagrams the kernel dropped for a
+// socket, from the drops column of /proc/net/udp or /proc/net/udp6
+func socketDrops(conn *net.UDPConn) (uint64, bool) {
+	inode, ok := socketInode(conn)
+	if !ok {
+		return 0, false
+	}
+	for _, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		if drops, ok := procUDPDrops(path, inode); ok {
+			return drops, true
+		}
+	}
+	return 0, false
+}
+
+// procUDPDrops finds a socket by inode in a /proc/net/udp table and returns
+// its drops column. The columns are:
+//
+//	sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ref pointer drops
+func procUDPDrops(path string, inode uint64) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	want := strconv.FormatUint(inode, 10)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 || fields[9] != want {
+			continue
+		}
+		drops, err := strconv.ParseUint(fields[12], 10, 64)
+		return drops, err == nil
+	}
+	return 0, false
+}
+
+// socketInode returns the inode that identifies a socket in /proc/net
+func socketInode(conn *net.UDPConn) (uint64, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var st unix.Stat_t
+	var statErr error
+	if err := raw.Control(func(fd uintptr) { statErr = unix.Fstat(int(fd), &st) }); err != nil || statErr != nil {
+		return 0, false
+	}
+	return st.Ino, true
+}
+
+// receiveBufferSize returns the usable size of a socket's receive buffer.
+// Linux reports twice the size that was set, to leave room for its own
+// bookkeeping.
+func receiveBufferSize(conn *net.UDPConn) (int, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var size int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		size, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	}); err != nil || sockErr != nil {
+		return 0, false
+	}
+	return size / 2, true
+}
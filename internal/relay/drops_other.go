@@ -0,0 +1,18 @@
+//go:build !linux
+
+package relay
+
+import "net"
+
+// kernelDropCounters reports whether socketDrops works on this platform
+const kernelDropCounters = false
+
+// socketDrops is not available: only Linux exposes per-socket drop counters
+func socketDrops(conn *net.UDPConn) (uint64, bool) {
+	return 0, false
+}
+
+// receiveBufferSize is not checked on this platform
+func receiveBufferSize(conn *net.UDPConn) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,139 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+)
+
+// messageTypeAPI is the journal type of changes made through the control API
+const messageTypeAPI formatter.MessageType = "api"
+
+// maxSentQSOs bounds the forwarded QSOs kept for corrections; a busy contest
+// weekend stays well inside it
+const maxSentQSOs = 20000
+
+// sentQSOs remembers forwarded QSOs by ID, so a correction made through the
+// API can be sent in full and a deletion can name the QSO
+type sentQSOs struct {
+	mu    sync.Mutex
+	qsos  map[string]formatter.QSO
+	order []string // IDs oldest first, for eviction
+}
+
+func newSentQSOs() *sentQSOs {
+	return &sentQSOs{qsos: make(map[string]formatter.QSO)}
+}
+
+// apply records a forwarded QSO, correction or deletion
+func (s *sentQSOs) apply(qso formatter.QSO) {
+	if qso.ID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if qso.Action == formatter.ActionDelete {
+		delete(s.qsos, qso.ID)
+		return
+	}
+	if _, ok := s.qsos[qso.ID]; !ok {
+		s.order = append(s.order, qso.ID)
+	}
+	qso.Action = formatter.ActionLog
+	qso.Path = append([]string(nil), qso.Path...)
+	s.qsos[qso.ID] = qso
+
+	for len(s.order) > maxSentQSOs {
+		delete(s.qsos, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// get returns the forwarded QSO with an ID
+func (s *sentQSOs) get(id string) (formatter.QSO, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	qso, ok := s.qsos[id]
+	return qso, ok
+}
+
+// recent returns up to limit forwarded QSOs logged after since for which
+// keep returns true, newest first
+func (s *sentQSOs) recent(limit int, since time.Time, keep func(formatter.QSO) bool) []formatter.QSO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var qsos []formatter.QSO
+	for i := len(s.order) - 1; i >= 0 && len(qsos) < limit; i-- {
+		qso, ok := s.qsos[s.order[i]]
+		if ok && qso.DateTime.After(since) && keep(qso) {
+			qsos = append(qsos, qso)
+		}
+	}
+	return qsos
+}
+
+// deliverChange forwards a correction or deletion of a QSO to the targets
+// and returns how many accepted it
+func (r *Relay) deliverChange(qso *formatter.QSO, msgType formatter.MessageType, source, origin string) (int, error) {
+	if qso.ID == "" {
+		return 0, fmt.Errorf("%s without a QSO ID", qso.Action)
+	}
+
+	sent, responses := r.forward(qso, msgType, origin, nil)
+	if sent == 0 {
+		return 0, fmt.Errorf("no target accepted the %s", qso.Action)
+	}
+	r.sent.apply(*qso)
+
+	if r.journal != nil {
+		entry := journal.Entry{Time: time.Now().UTC(), Source: source, Type: msgType, QSO: *qso, Responses: responses}
+		if err := r.journal.Append(entry); err != nil {
+			log.Printf("Failed to write journal: %v", err)
+		}
+	}
+	r.publishQSO(qso, msgType, sent)
+	return sent, nil
+}
+
+// QSO returns a forwarded QSO by ID
+func (r *Relay) QSO(id string) (formatter.QSO, bool) {
+	return r.sent.get(id)
+}
+
+// ReplaceQSO sends a correction of a forwarded QSO, matched by ID
+func (r *Relay) ReplaceQSO(qso formatter.QSO) error {
+	if _, ok := r.sent.get(qso.ID); !ok {
+		return fmt.Errorf("no forwarded QSO with ID %q", qso.ID)
+	}
+	qso.Action = formatter.ActionReplace
+	return r.changeFromAPI(&qso)
+}
+
+// DeleteQSO asks the targets to delete a forwarded QSO
+func (r *Relay) DeleteQSO(id string) error {
+	qso, ok := r.sent.get(id)
+	if !ok {
+		return fmt.Errorf("no forwarded QSO with ID %q", id)
+	}
+	qso.Action = formatter.ActionDelete
+	return r.changeFromAPI(&qso)
+}
+
+// changeFromAPI delivers a change made through the control API
+func (r *Relay) changeFromAPI(qso *formatter.QSO) error {
+	if r.isPaused() {
+		return fmt.Errorf("forwarding is paused")
+	}
+	origin := "Correction received from the control API"
+	if qso.Action == formatter.ActionDelete {
+		origin = "Deletion received from the control API"
+	}
+	_, err := r.deliverChange(qso, messageTypeAPI, "control API", origin)
+	return err
+}
@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Subscribe starts receiving the relay's events; a supervisor's relays
+// share one stream
+func (r *Relay) Subscribe() *events.Subscription {
+	return r.events.Subscribe()
+}
+
+// publish sends an event from this relay to the subscribers
+func (r *Relay) publish(e events.Event) {
+	e.Pipeline = r.config.Name
+	r.events.Publish(e)
+}
+
+// publishQSO announces a QSO, correction or deletion the targets accepted
+func (r *Relay) publishQSO(qso *formatter.QSO, msgType formatter.MessageType, sent int) {
+	// Subscribers read the QSO later; keep a copy of it
+	forwarded := *qso
+	r.publish(events.Event{Type: events.TypeQSO, QSO: &forwarded, Source: string(msgType), Targets: sent})
+}
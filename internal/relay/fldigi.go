@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// fldigiQSO relays a QSO read from fldigi over XML-RPC. The record is the
+// same ADIF fldigi broadcasts over UDP, so it is parsed as an fldigi message.
+func (r *Relay) fldigiQSO(record string) {
+	r.stats.Received(string(formatter.MessageTypeFldigi))
+	qso, err := r.formatter.ParseMessage(record, formatter.MessageTypeFldigi)
+	if err != nil {
+		r.stats.ParseFailed(failureReason(err))
+		r.failures.Add(r.config.Fldigi.Address, string(formatter.MessageTypeFldigi), err, record)
+		r.alertParseFailed()
+		if r.debug(logging.ModuleFormatter) {
+			log.Printf("Skipping fldigi XML-RPC record: %v", err)
+		}
+		return
+	}
+
+	r.applyOverrides(qso, formatter.MessageTypeFldigi, nil)
+	r.complete(qso, formatter.MessageTypeFldigi, "fldigi-xmlrpc", "fldigi XML-RPC QSO logged", 0)
+}
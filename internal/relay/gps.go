@@ -0,0 +1,23 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// fillFromGPS stamps a QSO with the grid square gpsd last placed the
+// station in, unless the QSO came with one
+func (r *Relay) fillFromGPS(qso *formatter.QSO) {
+	if r.gps == nil || qso.MyGrid != "" {
+		return
+	}
+	if fix, ok := r.gps.Fix(); ok {
+		qso.MyGrid = fix.Grid
+	}
+}
+
+// gridChanged logs the rover's move into another grid square
+func (r *Relay) gridChanged(grid string) {
+	log.Printf("GPS: station is now in grid %s", grid)
+}
@@ -0,0 +1,59 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// heartbeatPayload returns the datagram sent as a heartbeat: the configured
+// payload, or an N1MM AppInfo message naming the relay's station and contest
+func (r *Relay) heartbeatPayload() (string, error) {
+	if r.config.Heartbeat.Payload != "" {
+		return r.config.Heartbeat.Payload, nil
+	}
+	return r.formatter.FormatAppInfo()
+}
+
+// runHeartbeat sends a heartbeat to every target at startup and then once
+// per interval until ctx is cancelled. Heartbeats are sent while forwarding
+// is paused too, since they only show that the path is alive.
+func (r *Relay) runHeartbeat(ctx context.Context) {
+	defer r.wg.Done()
+
+	payload, err := r.heartbeatPayload()
+	if err != nil {
+		log.Printf("Heartbeat disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(r.config.Heartbeat.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.sendHeartbeat(payload)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendHeartbeat sends the heartbeat payload to each current target
+func (r *Relay) sendHeartbeat(payload string) {
+	for _, t := range r.currentTargets() {
+		err := r.sendMessage(t, payload)
+		r.alertSend(t, err)
+		if err != nil {
+			log.Printf("Failed to send heartbeat to %s: %v", t.addr, err)
+			continue
+		}
+		if r.debug(logging.ModuleSinks) {
+			log.Printf("Heartbeat sent to %s", t.addr)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// workedBefore remembers which stations were worked on each band and mode,
+// and which of them are highlighted in each WSJT-X instance. WSJT-X colors a
+// highlighted call wherever it is decoded, so highlights are swapped when an
+// instance changes band or mode.
+type workedBefore struct {
+	background wsjtx.Color
+	foreground wsjtx.Color
+
+	mu        sync.Mutex
+	worked    map[string]map[string]bool // slot -> calls
+	instances map[string]*highlights     // WSJT-X id -> highlights
+}
+
+// highlights is the band/mode a WSJT-X instance is on and the calls it has
+// been told to color
+type highlights struct {
+	slot  string
+	calls map[string]bool
+}
+
+// newWorkedBefore creates the tracker with the configured colors
+func newWorkedBefore(cfg config.Config) (*workedBefore, error) {
+	background, err := wsjtx.ParseColor(cfg.WSJTX.Highlight.Background)
+	if err != nil {
+		return nil, err
+	}
+	foreground, err := wsjtx.ParseColor(cfg.WSJTX.Highlight.Foreground)
+	if err != nil {
+		return nil, err
+	}
+	if !background.Valid && !foreground.Valid {
+		return nil, fmt.Errorf("wsjtx.highlight needs a background or foreground color")
+	}
+	return &workedBefore{
+		background: background,
+		foreground: foreground,
+		worked:     make(map[string]map[string]bool),
+		instances:  make(map[string]*highlights),
+	}, nil
+}
+
+// add records a worked station and returns its slot
+func (w *workedBefore) add(call, band, mode string) string {
+	slot := workeddb.Slot(band, mode)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.worked[slot] == nil {
+		w.worked[slot] = make(map[string]bool)
+	}
+	w.worked[slot][call] = true
+	return slot
+}
+
+// markWorked records a delivered QSO and highlights the call in every WSJT-X
+// instance on the same band and mode
+func (r *Relay) markWorked(qso *formatter.QSO) {
+	w := r.worked
+	if w == nil || qso.Callsign == "" {
+		return
+	}
+	slot := w.add(qso.Callsign, qso.Band, qso.Mode)
+
+	for _, c := range r.currentClients() {
+		w.mu.Lock()
+		state, ok := w.instances[c.id]
+		send := ok && state.slot == slot && !state.calls[qso.Callsign]
+		if send {
+			state.calls[qso.Callsign] = true
+		}
+		w.mu.Unlock()
+
+		if send {
+			r.highlight(c, qso.Callsign, w.background, w.foreground)
+		}
+	}
+}
+
+// trackStatus follows the band and mode of a WSJT-X instance from its Status
+// messages. On a change, the old band's highlights are removed and the
+// stations worked on the new band and mode are highlighted.
+func (r *Relay) trackStatus(data []byte, c *wsjtxClient) {
+	w := r.worked
+	if w == nil || c == nil {
+		return
+	}
+	status, ok := wsjtx.ParseStatus(data)
+	if !ok || status.DialFrequency == 0 {
+		return
+	}
+	slot := workeddb.Slot(formatter.FrequencyToBand(float64(status.DialFrequency)/1e6), status.Mode)
+
+	w.mu.Lock()
+	state, ok := w.instances[c.id]
+	if ok && state.slot == slot {
+		w.mu.Unlock()
+		return
+	}
+	var clear []string
+	if ok {
+		for call := range state.calls {
+			if !w.worked[slot][call] {
+				clear = append(clear, call)
+			}
+		}
+	}
+	next := &highlights{slot: slot, calls: make(map[string]bool, len(w.worked[slot]))}
+	for call := range w.worked[slot] {
+		next.calls[call] = true
+	}
+	w.instances[c.id] = next
+	w.mu.Unlock()
+
+	if r.debug(logging.ModuleEnrichment) {
+		log.Printf("WSJT-X %q on %s: highlighting %d worked stations", c.id, slot, len(next.calls))
+	}
+	for _, call := range clear {
+		r.highlight(c, call, wsjtx.Color{}, wsjtx.Color{})
+	}
+	for call := range next.calls {
+		if !ok || !state.calls[call] {
+			r.highlight(c, call, w.background, w.foreground)
+		}
+	}
+}
+
+// highlight sends one HighlightCallsign message; zero colors clear it
+func (r *Relay) highlight(c *wsjtxClient, call string, background, foreground wsjtx.Color) {
+	message := wsjtx.HighlightCallsignMessage(c.id, call, background, foreground, false)
+	if _, err := c.conn.WriteToUDP(message, c.addr); err != nil {
+		log.Printf("Failed to send highlight to WSJT-X %q at %s: %v", c.id, c.addr, err)
+	}
+}
@@ -0,0 +1,41 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// jtalertStation remembers the station a JTAlert station broadcast describes
+func (r *Relay) jtalertStation(message string, trace uint64) {
+	station, err := formatter.ParseJTAlertStation(message)
+	if err != nil {
+		r.stats.ParseFailed(failureReason(err))
+		r.tracef(trace, "dropped: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	changed := r.jtalert == nil || *r.jtalert != *station
+	r.jtalert = station
+	r.mu.Unlock()
+
+	r.tracef(trace, "JTAlert station %s in %s on %s %s", station.Call, station.Grid, station.Band, station.Mode)
+	if changed && r.debug(logging.ModuleEnrichment) {
+		log.Printf("JTAlert: station %s in %s on %s %s", station.Call, station.Grid, station.Band, station.Mode)
+	}
+}
+
+// fillFromJTAlert stamps a JTAlert QSO with the grid of the station JTAlert
+// last broadcast, unless the QSO came with one
+func (r *Relay) fillFromJTAlert(qso *formatter.QSO, msgType formatter.MessageType) {
+	if msgType != formatter.MessageTypeJTAlert || qso.MyGrid != "" {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.jtalert != nil {
+		qso.MyGrid = r.jtalert.Grid
+	}
+}
@@ -0,0 +1,221 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// listener is a UDP socket the relay receives datagrams on: the main listen
+// socket or one of the additional listeners. A listener with a source type
+// treats everything it receives as that type and skips detection; a raw
+// listener repeats datagrams without parsing them.
+type listener struct {
+	config     config.ListenerConfig
+	addr       string // Configured address or multicast group, for log messages
+	sourceType formatter.MessageType
+
+	raw     bool
+	forward []*net.UDPAddr
+	prepend []byte
+	append  []byte
+
+	mu     sync.Mutex
+	conn   *net.UDPConn // Replaced when the socket is rebound
+	closed bool         // Closed for shutdown, so not to be rebound
+}
+
+// socket returns the listener's current socket
+func (l *listener) socket() *net.UDPConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn
+}
+
+// replace swaps in a rebound socket. It returns false, leaving conn to the
+// caller, when the listener has been closed for shutdown.
+func (l *listener) replace(conn *net.UDPConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conn = conn
+	return true
+}
+
+// close closes the socket for shutdown
+func (l *listener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.conn.Close()
+}
+
+// checkListeners validates the additional listeners
+func checkListeners(listeners []config.ListenerConfig) error {
+	for _, lc := range listeners {
+		if lc.Raw && lc.SourceType != "" {
+			return fmt.Errorf("listener %s:%d is raw and can't also have a source type", lc.Address, lc.Port)
+		}
+		if !lc.Raw && (len(lc.Forward) > 0 || lc.Prepend != "" || lc.Append != "") {
+			return fmt.Errorf("listener %s:%d: forward, prepend and append need raw: true", lc.Address, lc.Port)
+		}
+		if ip := net.ParseIP(lc.MulticastGroup); lc.MulticastGroup != "" && (ip == nil || !ip.IsMulticast()) {
+			return fmt.Errorf("listener port %d: %q is not a multicast group address", lc.Port, lc.MulticastGroup)
+		}
+		if _, err := resolveForward(lc.Forward); err != nil {
+			return err
+		}
+		if !pinned(lc.SourceType) && !strings.EqualFold(lc.SourceType, "auto") && lc.SourceType != "" {
+			return fmt.Errorf("unknown source type %q for listener %s:%d", lc.SourceType, lc.Address, lc.Port)
+		}
+	}
+	return nil
+}
+
+// pinned reports whether a listener source type names a parser, as opposed
+// to "auto" or empty for detection
+func pinned(sourceType string) bool {
+	t := strings.ToLower(sourceType)
+	return t != "auto" && t != "general" && formatter.ValidMessageType(t)
+}
+
+// listenerAddr returns the address a listener binds, the multicast group
+// it joins, or for a listener bound to an interface, the interface's name
+// with the port
+func listenerAddr(lc config.ListenerConfig) string {
+	if lc.MulticastGroup != "" {
+		return net.JoinHostPort(lc.MulticastGroup, strconv.Itoa(lc.Port))
+	}
+	if lc.Interface != "" {
+		return net.JoinHostPort(lc.Interface, strconv.Itoa(lc.Port))
+	}
+	return net.JoinHostPort(lc.Address, strconv.Itoa(lc.Port))
+}
+
+// bindListener binds a UDP socket for a listener, or joins its multicast group
+func (r *Relay) bindListener(lc config.ListenerConfig) (*net.UDPConn, error) {
+	listenAddr, err := BindAddr(lc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start UDP listener on port %d: %w", lc.Port, err)
+	}
+
+	var conn *net.UDPConn
+	if lc.MulticastGroup != "" {
+		conn, err = ListenMulticast(lc.MulticastGroup, lc.Port, lc.MulticastInterface)
+	} else {
+		conn, err = ListenUDP(listenAddr, lc.ReusePort)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start UDP listener on %s: %w", listenAddr, err)
+	}
+	r.setSocketBuffers(conn, "listener "+listenAddr)
+	r.setReceiveBuffer(conn, "listener "+listenAddr)
+	return conn, nil
+}
+
+// openListener binds a UDP listener, or joins its multicast group
+func (r *Relay) openListener(lc config.ListenerConfig) (*listener, error) {
+	conn, err := r.bindListener(lc)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listener{config: lc, addr: listenerAddr(lc), conn: conn}
+	if pinned(lc.SourceType) {
+		l.sourceType = formatter.MessageType(strings.ToLower(lc.SourceType))
+	}
+	return l, nil
+}
+
+// openListeners binds the main listen socket and the additional listeners
+func (r *Relay) openListeners() error {
+	main, err := r.openListener(r.config.MainListener())
+	if err != nil {
+		return err
+	}
+	r.listeners = []*listener{main}
+
+	for _, lc := range r.config.Listeners {
+		l, err := r.openListener(lc)
+		if err != nil {
+			return err
+		}
+		r.listeners = append(r.listeners, l)
+
+		if lc.Raw {
+			l.raw = true
+			l.prepend = []byte(lc.Prepend)
+			l.append = []byte(lc.Append)
+			if l.forward, err = resolveForward(lc.Forward); err != nil {
+				return err
+			}
+		}
+
+		if r.debug(logging.ModuleRelay) {
+			kind := "auto-detect"
+			switch {
+			case l.raw:
+				kind = "raw"
+			case l.sourceType != "":
+				kind = string(l.sourceType)
+			}
+			log.Printf("Also listening on %s (%s)", l.socket().LocalAddr(), kind)
+		}
+	}
+	return nil
+}
+
+// startListeners starts a read loop per listener, all feeding one worker
+// pool. The pool is closed once every read loop has stopped.
+func (r *Relay) startListeners(ctx context.Context) {
+	pool := r.startWorkers()
+
+	var readers sync.WaitGroup
+	for _, l := range r.listeners {
+		readers.Add(1)
+		go func(l *listener) {
+			defer readers.Done()
+			r.listen(ctx, l, pool)
+		}(l)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		readers.Wait()
+		pool.close()
+	}()
+}
+
+// closeListeners closes every listening socket, which stops the read loops
+func (r *Relay) closeListeners() {
+	for _, l := range r.listeners {
+		l.close()
+	}
+}
+
+// ListenAddrs returns the addresses of the main listener and the additional
+// listeners, in configuration order. It returns nil before the relay is ready.
+func (r *Relay) ListenAddrs() []net.Addr {
+	select {
+	case <-r.ready:
+	default:
+		return nil
+	}
+
+	addrs := make([]net.Addr, len(r.listeners))
+	for i, l := range r.listeners {
+		addrs[i] = l.socket().LocalAddr()
+	}
+	return addrs
+}
@@ -0,0 +1,113 @@
+package relay
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// exchangeLookup remembers the last received exchange for each callsign.
+// It is filled from the journal, from QSOs as they are forwarded, and from
+// N1MM lookupinfo broadcasts (N1MM's call history) received by the bridge.
+type exchangeLookup struct {
+	mu        sync.RWMutex
+	exchanges map[string]string
+}
+
+// newExchangeLookup creates an empty lookup
+func newExchangeLookup() *exchangeLookup {
+	return &exchangeLookup{exchanges: make(map[string]string)}
+}
+
+// learn records the exchange for call; empty values are ignored
+func (l *exchangeLookup) learn(call, exchange string) {
+	call = formatter.SanitizeCallsign(call)
+	if call == "" || exchange == "" {
+		return
+	}
+	l.mu.Lock()
+	l.exchanges[call] = exchange
+	l.mu.Unlock()
+}
+
+// find returns the last exchange recorded for call
+func (l *exchangeLookup) find(call string) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	exchange, ok := l.exchanges[formatter.SanitizeCallsign(call)]
+	return exchange, ok
+}
+
+// seedFromJournal loads previously worked stations, their exchanges and the
+// QSOs that can still be corrected from the journal
+func (r *Relay) seedFromJournal() {
+	if r.journal == nil {
+		return
+	}
+
+	entries, err := r.journal.Entries(time.Time{})
+	if err != nil {
+		log.Printf("Failed to read journal: %v", err)
+		return
+	}
+	for _, e := range entries {
+		// Journaled QSOs can still be corrected through the API
+		r.sent.apply(e.QSO)
+		if e.QSO.Action != formatter.ActionLog {
+			continue
+		}
+		if r.lookup != nil {
+			r.lookup.learn(e.QSO.Callsign, e.QSO.Exchange)
+		}
+		if r.worked != nil {
+			r.worked.add(e.QSO.Callsign, e.QSO.Band, e.QSO.Mode)
+		}
+		if r.scorer != nil {
+			r.scorer.Score(r.stationCall(&e.QSO), &e.QSO)
+		}
+		r.alertWorked(e.QSO.Callsign)
+	}
+	if r.debug(logging.ModuleEnrichment) {
+		log.Printf("Worked stations loaded from %d journal entries", len(entries))
+	}
+}
+
+// prefillExchange fills in a missing exchange from an earlier QSO or N1MM
+// lookup, and remembers the exchange of QSOs that have one
+func (r *Relay) prefillExchange(qso *formatter.QSO) {
+	if r.lookup == nil {
+		return
+	}
+
+	if qso.Exchange != "" {
+		r.lookup.learn(qso.Callsign, qso.Exchange)
+		return
+	}
+
+	if exchange, ok := r.lookup.find(qso.Callsign); ok {
+		qso.Exchange = exchange
+		if r.debug(logging.ModuleEnrichment) {
+			log.Printf("Prefilled exchange %q for %s", exchange, qso.Callsign)
+		}
+	}
+}
+
+// bridgeLookupInfo records the exchange from an N1MM lookupinfo broadcast
+func (r *Relay) bridgeLookupInfo(message string) {
+	info, err := formatter.ParseLookupInfo(message)
+	if err != nil {
+		if r.debug(logging.ModuleEnrichment) {
+			log.Printf("Skipping N1MM lookupinfo: %v", err)
+		}
+		return
+	}
+
+	exchange := info.ExchangeText()
+	r.lookup.learn(info.Call, exchange)
+	if r.debug(logging.ModuleEnrichment) && exchange != "" {
+		log.Printf("N1MM lookup for %s: %s", info.Call, exchange)
+	}
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/mapping"
+)
+
+// fieldMapping is a parsed config.FieldMapping
+type fieldMapping struct {
+	network *net.IPNet // nil matches any source
+	msgType formatter.MessageType
+	mapping *mapping.Mapping
+	config  config.FieldMapping
+}
+
+// parseMappings validates the field mappings
+func parseMappings(mappings []config.FieldMapping) ([]fieldMapping, error) {
+	parsed := make([]fieldMapping, 0, len(mappings))
+	for i, m := range mappings {
+		fm := fieldMapping{
+			msgType: formatter.MessageType(strings.ToLower(m.Type)),
+			config:  m,
+		}
+		if fm.msgType != "" && !formatter.ValidMessageType(string(fm.msgType)) {
+			return nil, fmt.Errorf("mapping %d: unknown source type %q", i+1, m.Type)
+		}
+		if m.Source != "" {
+			network, err := parseSource(m.Source)
+			if err != nil {
+				return nil, fmt.Errorf("mapping %d: invalid source %q: %w", i+1, m.Source, err)
+			}
+			fm.network = network
+		}
+
+		var err error
+		if fm.mapping, err = mapping.New(m.Match, m.Set); err != nil {
+			return nil, fmt.Errorf("mapping %d: %w", i+1, err)
+		}
+		parsed = append(parsed, fm)
+	}
+	return parsed, nil
+}
+
+// sourceIP returns the IP address of a host:port source, or nil for sources
+// that aren't network datagrams
+func sourceIP(source string) net.IP {
+	host, _, err := net.SplitHostPort(source)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// applyMappings rewrites the QSO with every mapping matching the source
+// address and message type, in order. ip may be nil for sources that aren't
+// network datagrams.
+func (r *Relay) applyMappings(qso *formatter.QSO, msgType formatter.MessageType, ip net.IP) {
+	r.mu.RLock()
+	mappings := r.mappings
+	r.mu.RUnlock()
+
+	for i, m := range mappings {
+		if m.network != nil && (ip == nil || !m.network.Contains(ip)) {
+			continue
+		}
+		if m.msgType != "" && m.msgType != msgType {
+			continue
+		}
+		applied, err := m.mapping.Apply(qso, msgType)
+		if err != nil {
+			log.Printf("Field mapping %d not applied to %s: %v", i+1, qso.Callsign, err)
+			continue
+		}
+		if applied && r.debug(logging.ModuleFormatter) {
+			log.Printf("Field mapping %d applied to %s", i+1, qso.Callsign)
+		}
+	}
+}
+
+// FieldMappings returns the active field mappings
+func (r *Relay) FieldMappings() []config.FieldMapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	configs := make([]config.FieldMapping, 0, len(r.mappings))
+	for _, m := range r.mappings {
+		configs = append(configs, m.config)
+	}
+	return configs
+}
+
+// SetFieldMappings replaces the field mappings while the relay runs. A bad
+// entry leaves the current mappings untouched.
+func (r *Relay) SetFieldMappings(configs []config.FieldMapping) error {
+	mappings, err := parseMappings(configs)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.mappings = mappings
+	r.mu.Unlock()
+	log.Printf("Now applying %d field mappings", len(mappings))
+	return nil
+}
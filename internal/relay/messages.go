@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// js8Message keeps a JS8Call directed message in the message log. Without
+// one, and for heartbeats unless messages.heartbeats is set, the message is
+// counted and dropped.
+func (r *Relay) js8Message(message, source string, trace uint64) {
+	m, err := formatter.ParseJS8Directed(message)
+	if err != nil {
+		r.stats.ParseFailed(failureReason(err))
+		r.failures.Add(source, string(formatter.MessageTypeJS8Call), err, message)
+		r.tracef(trace, "dropped: %v", err)
+		return
+	}
+
+	if r.messages == nil || (m.Heartbeat() && !r.config.Messages.Heartbeats) {
+		reason := dropJS8Message
+		if m.Heartbeat() {
+			reason = dropJS8Heartbeat
+		}
+		r.stats.Dropped(reason)
+		r.tracef(trace, "dropped: JS8Call %s from %s to %s", m.Command, m.From, m.To)
+		return
+	}
+
+	if err := r.messages.Append(*m); err != nil {
+		log.Printf("Failed to write message log: %v", err)
+		return
+	}
+	r.tracef(trace, "JS8Call %s from %s to %s kept in %s", m.Command, m.From, m.To, r.messages.Path())
+	if r.debug(logging.ModuleSinks) {
+		log.Printf("JS8Call message from %s to %s: %s", m.From, m.To, m.Text)
+	}
+}
+
+// Messages returns up to limit JS8Call directed messages received after
+// since, newest first, optionally only those from or to call
+func (r *Relay) Messages(limit int, since time.Time, call string) ([]formatter.JS8Message, error) {
+	if r.messages == nil {
+		return nil, fmt.Errorf("the message log is not enabled (set messages.path)")
+	}
+	return r.messages.Recent(limit, since, call)
+}
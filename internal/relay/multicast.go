@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+)
+
+// ListenMulticast joins a multicast group on port, e.g. the 224.0.0.1 or
+// 239.255.0.1 group WSJT-X can be set to send to. Every program that joins
+// receives every datagram. ifname picks the interface to join on; empty
+// leaves the choice to the OS.
+func ListenMulticast(group string, port int, ifname string) (*net.UDPConn, error) {
+	ip := net.ParseIP(group)
+	if ip == nil || !ip.IsMulticast() {
+		return nil, fmt.Errorf("%q is not a multicast group address", group)
+	}
+
+	var ifi *net.Interface
+	if ifname != "" {
+		var err error
+		if ifi, err = net.InterfaceByName(ifname); err != nil {
+			return nil, fmt.Errorf("multicast interface %q: %w", ifname, err)
+		}
+	}
+
+	network := "udp4"
+	if ip.To4() == nil {
+		network = "udp6"
+	}
+	return net.ListenMulticastUDP(network, ifi, &net.UDPAddr{IP: ip, Port: port})
+}
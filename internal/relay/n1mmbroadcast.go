@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"errors"
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// n1mmBroadcast applies formatting.n1mm_broadcasts to an N1MM message that
+// isn't a contact: a RadioInfo, spot, lookupinfo, score or AppInfo message
+func (r *Relay) n1mmBroadcast(kind, message, source, origin string, trace uint64) {
+	// The relay's own RadioInfo and spots coming back from N1MM
+	if r.formatter.IsRelayOutput(message) {
+		r.stats.Dropped(dropRelayLoop)
+		r.tracef(trace, "dropped: the relay's own N1MM %s message", kind)
+		return
+	}
+
+	// Scores go to the online scoreboards whatever else becomes of them
+	posted := kind == formatter.N1MMBroadcastScore && r.postScore(message, source, trace)
+
+	switch r.n1mmBroadcastAction(kind) {
+	case "pass":
+		r.passN1MM(kind, message, trace)
+	case "convert":
+		r.convertN1MM(kind, message, source, origin, trace)
+	default:
+		if posted {
+			return
+		}
+		r.stats.Dropped("n1mm_" + kind)
+		r.tracef(trace, "dropped: N1MM %s message (counted)", kind)
+		if r.debug(logging.ModuleFormatter) {
+			log.Printf("Ignoring N1MM %s message from %s", kind, source)
+		}
+	}
+}
+
+// n1mmBroadcastAction returns the configured handling of a kind of N1MM
+// broadcast
+func (r *Relay) n1mmBroadcastAction(kind string) string {
+	cfg := r.config.Formatting.N1MMBroadcasts
+	switch kind {
+	case formatter.N1MMBroadcastRadioInfo:
+		return cfg.RadioInfo
+	case formatter.N1MMBroadcastSpot:
+		return cfg.Spot
+	case formatter.N1MMBroadcastLookupInfo:
+		return cfg.LookupInfo
+	case formatter.N1MMBroadcastScore:
+		return cfg.Score
+	case formatter.N1MMBroadcastAppInfo:
+		return cfg.AppInfo
+	}
+	return "ignore"
+}
+
+// postScore hands an N1MM score to the scoreboard poster. It reports
+// whether the score will be posted.
+func (r *Relay) postScore(message, source string, trace uint64) bool {
+	if r.scoreboard == nil {
+		return false
+	}
+	score, err := formatter.ParseN1MMScore(message)
+	if err != nil {
+		r.stats.ParseFailed(failureReason(err))
+		r.failures.Add(source, string(formatter.MessageTypeN1MM), err, message)
+		r.tracef(trace, "N1MM score not posted: %v", err)
+		return false
+	}
+	r.scoreboard.Update(score)
+	r.tracef(trace, "N1MM score of %s queued for the scoreboards", score)
+	if r.debug(logging.ModuleRelay) {
+		log.Printf("N1MM score of %s", score)
+	}
+	return true
+}
+
+// passN1MM sends an N1MM message unchanged to the n1mm targets
+func (r *Relay) passN1MM(kind, message string, trace uint64) {
+	sent := 0
+	for _, t := range r.currentTargets() {
+		if t.format != formatter.OutputFormatN1MM {
+			continue
+		}
+		if err := r.sendMessage(t, message); err != nil {
+			log.Printf("Failed to pass N1MM %s message to %s: %v", kind, t.addr, err)
+			continue
+		}
+		sent++
+	}
+	r.tracef(trace, "N1MM %s message passed to %d n1mm targets", kind, sent)
+}
+
+// convertN1MM turns a spot into a spot for the targets, and a lookupinfo
+// message into an exchange to prefill
+func (r *Relay) convertN1MM(kind, message, source, origin string, trace uint64) {
+	switch kind {
+	case formatter.N1MMBroadcastSpot:
+		qso, err := formatter.ParseN1MMSpot(message)
+		if errors.Is(err, formatter.ErrN1MMSpotDeleted) {
+			r.stats.Dropped("n1mm_" + kind)
+			r.tracef(trace, "dropped: %v", err)
+			return
+		}
+		if err != nil {
+			r.stats.ParseFailed(failureReason(err))
+			r.failures.Add(source, string(formatter.MessageTypeN1MM), err, message)
+			r.tracef(trace, "dropped: parse failed: %v", err)
+			return
+		}
+		r.tracef(trace, "N1MM spot of %s on %s", qso.Callsign, qso.Band)
+		r.complete(qso, formatter.MessageTypeN1MM, source, origin, trace)
+	case formatter.N1MMBroadcastLookupInfo:
+		if r.lookup == nil {
+			r.stats.Dropped("n1mm_" + kind)
+			r.tracef(trace, "dropped: N1MM lookupinfo message without exchange lookup")
+			return
+		}
+		r.bridgeLookupInfo(message)
+		r.tracef(trace, "N1MM lookupinfo message used for exchange lookup")
+	default:
+		r.stats.Dropped("n1mm_" + kind)
+		r.tracef(trace, "dropped: N1MM %s messages can't be converted", kind)
+	}
+}
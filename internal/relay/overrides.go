@@ -0,0 +1,93 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// sourceOverride is a parsed config.SourceOverride
+type sourceOverride struct {
+	network *net.IPNet // nil matches any source
+	msgType formatter.MessageType
+	config  config.SourceOverride
+}
+
+// parseOverrides validates the per-source identity overrides
+func parseOverrides(overrides []config.SourceOverride) ([]sourceOverride, error) {
+	parsed := make([]sourceOverride, 0, len(overrides))
+	for _, o := range overrides {
+		so := sourceOverride{
+			msgType: formatter.MessageType(strings.ToLower(o.Type)),
+			config:  o,
+		}
+
+		if o.RadioNr < 0 {
+			return nil, fmt.Errorf("invalid override radio_nr %d", o.RadioNr)
+		}
+
+		if o.Source != "" {
+			network, err := parseSource(o.Source)
+			if err != nil {
+				return nil, fmt.Errorf("invalid override source %q: %w", o.Source, err)
+			}
+			so.network = network
+		}
+
+		parsed = append(parsed, so)
+	}
+	return parsed, nil
+}
+
+// parseSource parses a source IP address or CIDR. A plain address is a
+// single-host network.
+func parseSource(source string) (*net.IPNet, error) {
+	if !strings.Contains(source, "/") {
+		if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+			source += "/32"
+		} else {
+			source += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(source)
+	return network, err
+}
+
+// applyOverrides sets the QSO's station identity from the first override
+// matching the source address and message type, then credits personal calls
+// to their club call. ip may be nil for sources that aren't network
+// datagrams.
+func (r *Relay) applyOverrides(qso *formatter.QSO, msgType formatter.MessageType, ip net.IP) {
+	for _, o := range r.overrides {
+		if o.network != nil && (ip == nil || !o.network.Contains(ip)) {
+			continue
+		}
+		if o.msgType != "" && o.msgType != msgType {
+			continue
+		}
+
+		if o.config.Station != "" {
+			qso.Station = o.config.Station
+		}
+		if o.config.Operator != "" {
+			qso.Operator = o.config.Operator
+		}
+		if o.config.Contest != "" {
+			qso.Contest = o.config.Contest
+		}
+		if o.config.StationName != "" {
+			qso.StationName = o.config.StationName
+		}
+		if o.config.NetBiosName != "" {
+			qso.NetBiosName = o.config.NetBiosName
+		}
+		if o.config.RadioNr > 0 {
+			qso.RadioNr = o.config.RadioNr
+		}
+		break
+	}
+	r.applyCallAliases(qso, ip)
+}
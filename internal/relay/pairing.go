@@ -0,0 +1,181 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// wsjtxPairWindow is how long a binary QSO Logged message waits for the
+// Logged ADIF message WSJT-X sends right after it
+const wsjtxPairWindow = 2 * time.Second
+
+// What became of a QSO given to qsoPairs.pair
+type pairResult int
+
+const (
+	pairHeld      pairResult = iota // waiting for its partner
+	pairMerged                      // merged with the held partner and delivered
+	pairDelivered                   // delivered on its own
+	pairLate                        // its ADIF partner was already delivered alone
+)
+
+// heldQSO is a message waiting for its partner
+type heldQSO struct {
+	qso     *formatter.QSO
+	binary  bool
+	deliver func(*formatter.QSO)
+	timer   *time.Timer
+}
+
+// sentAlone is an ADIF message delivered without its binary partner
+type sentAlone struct {
+	id string
+	at time.Time
+}
+
+// qsoPairs reconciles the two messages WSJT-X sends for every logged QSO:
+// the binary QSO Logged message, which has the exchanges and comments, and
+// the Logged ADIF message. They are matched by source and dedup key and
+// delivered as one QSO.
+//
+// Workers may handle the two in either order. A binary message waits for
+// its partner, and so does an ADIF message from a source that has sent
+// binary ones before. An ADIF message from any other source, such as
+// JS8Call, which sends ADIF alone, goes out at once; should a binary partner
+// turn up after all, the caller corrects the delivered QSO from it.
+type qsoPairs struct {
+	mu      sync.Mutex
+	window  time.Duration
+	held    map[string]*heldQSO
+	alone   map[string]sentAlone
+	pairing map[string]bool // sources that send binary QSO Logged messages
+	closed  bool
+	wg      *sync.WaitGroup // counts held QSOs, so shutdown waits for them
+	now     func() time.Time
+}
+
+// newQSOPairs creates an empty set of pairs
+func newQSOPairs(window time.Duration, wg *sync.WaitGroup) *qsoPairs {
+	return &qsoPairs{
+		window:  window,
+		held:    make(map[string]*heldQSO),
+		alone:   make(map[string]sentAlone),
+		pairing: make(map[string]bool),
+		wg:      wg,
+		now:     time.Now,
+	}
+}
+
+// wsjtxLogged reports whether a message is one of the two WSJT-X sends when
+// a QSO is logged, and whether it is the binary one
+func wsjtxLogged(message string) (logged, binary bool) {
+	h, ok := wsjtx.ParseHeader([]byte(message))
+	if !ok {
+		return false, false
+	}
+	return h.Type == wsjtx.MessageQSOLogged || h.Type == wsjtx.MessageLoggedADIF, h.Type == wsjtx.MessageQSOLogged
+}
+
+// pair takes a QSO from one of the two messages sent by source. If its
+// partner is held the two are merged, the binary one's fields winning, and
+// delivered through the held one's deliver. Otherwise it is held until the
+// partner arrives or the window passes, or delivered at once as described
+// for qsoPairs. For a binary message whose ADIF partner went out alone,
+// nothing is delivered and the ID that partner was given is returned.
+func (p *qsoPairs) pair(source string, qso *formatter.QSO, binary bool, deliver func(*formatter.QSO)) (result pairResult, partnerID string) {
+	key := source + "|" + qso.DedupKey()
+
+	p.mu.Lock()
+	now := p.now()
+	for k, a := range p.alone {
+		if now.Sub(a.at) > p.window {
+			delete(p.alone, k)
+		}
+	}
+
+	if p.closed {
+		p.mu.Unlock()
+		deliver(qso)
+		return pairDelivered, ""
+	}
+	if binary {
+		p.pairing[source] = true
+	}
+
+	if h, ok := p.held[key]; ok && h.binary != binary {
+		delete(p.held, key)
+		h.timer.Stop()
+		p.mu.Unlock()
+
+		merged := h.qso
+		if binary {
+			merged = qso
+			merged.Merge(h.qso)
+		} else {
+			merged.Merge(qso)
+		}
+		h.deliver(merged)
+		p.wg.Done()
+		return pairMerged, ""
+	}
+
+	if a, ok := p.alone[key]; ok && binary {
+		delete(p.alone, key)
+		p.mu.Unlock()
+		return pairLate, a.id
+	}
+
+	if _, ok := p.held[key]; !ok && (binary || p.pairing[source]) {
+		h := &heldQSO{qso: qso, binary: binary, deliver: deliver}
+		p.held[key] = h
+		p.wg.Add(1)
+		h.timer = time.AfterFunc(p.window, func() { p.expire(key, h) })
+		p.mu.Unlock()
+		return pairHeld, ""
+	}
+
+	// The ID is given here, as deliver would, so a late partner can correct
+	// the QSO
+	if !binary {
+		if qso.ID == "" {
+			qso.ID = formatter.NewQSOID()
+		}
+		p.alone[key] = sentAlone{id: qso.ID, at: now}
+	}
+	p.mu.Unlock()
+	deliver(qso)
+	return pairDelivered, ""
+}
+
+// expire delivers a held QSO whose partner never came
+func (p *qsoPairs) expire(key string, h *heldQSO) {
+	p.mu.Lock()
+	if p.held[key] != h {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.held, key)
+	p.mu.Unlock()
+
+	h.deliver(h.qso)
+	p.wg.Done()
+}
+
+// close delivers the held QSOs without waiting for their partners, and
+// makes pair deliver from now on
+func (p *qsoPairs) close() {
+	p.mu.Lock()
+	p.closed = true
+	held := p.held
+	p.held = make(map[string]*heldQSO)
+	p.mu.Unlock()
+
+	for _, h := range held {
+		h.timer.Stop()
+		h.deliver(h.qso)
+		p.wg.Done()
+	}
+}
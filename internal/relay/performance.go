@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"log"
+	"net"
+)
+
+// Performance mode trades a little latency for predictable resource use when
+// a burst of QSOs arrives at once (FT8 fox/hound cycles log dozens of QSOs
+// every 15 seconds). MaxInFlight sets the size of the worker pool, parsed
+// QSOs are recycled, and each target gets a send queue drained by its own
+// sender so a slow socket never holds up parsing.
+
+// performanceEnabled reports whether the high-throughput mode is on
+func (r *Relay) performanceEnabled() bool {
+	return r.config.Performance.Enabled
+}
+
+// setSocketBuffers enlarges the kernel buffers of conn when performance mode
+// asks for it. Failures are only logged; the OS default still works.
+func (r *Relay) setSocketBuffers(conn *net.UDPConn, name string) {
+	size := r.config.Performance.SocketBuffer
+	if !r.performanceEnabled() || size <= 0 {
+		return
+	}
+	if err := conn.SetReadBuffer(size); err != nil {
+		log.Printf("Failed to set %s receive buffer to %d bytes: %v", name, size, err)
+	}
+	if err := conn.SetWriteBuffer(size); err != nil {
+		log.Printf("Failed to set %s send buffer to %d bytes: %v", name, size, err)
+	}
+}
+
+// startQueue gives the target a send queue of the given size and starts the
+// goroutine that drains it
+func (t *target) startQueue(size int) {
+	t.queue = make(chan string, size)
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go t.drain()
+}
+
+// enqueue queues a message for the target's sender. It never blocks: a full
+// queue means the target cannot keep up, and the message is refused.
+func (t *target) enqueue(message string) bool {
+	select {
+	case t.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain writes queued messages until the target is closed. Everything that
+// is already queued at that point is still sent. A single write buffer is
+// reused for every datagram.
+func (t *target) drain() {
+	defer close(t.done)
+
+	buffer := make([]byte, 0, maxBufferSize)
+	write := func(message string) {
+		buffer = append(buffer[:0], message...)
+		if _, err := t.conn.Write(buffer); err != nil {
+			log.Printf("Failed to relay packet to %s: %v", t.addr, err)
+		}
+	}
+
+	for {
+		select {
+		case message := <-t.queue:
+			write(message)
+		case <-t.stop:
+			for {
+				select {
+				case message := <-t.queue:
+					write(message)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// close flushes the target's send queue, if it has one, and closes its socket
+func (t *target) close() {
+	if t.queue != nil {
+		close(t.stop)
+		<-t.done
+	}
+	t.conn.Close()
+}
@@ -0,0 +1,19 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/qsomap"
+)
+
+// QSOMap places up to limit forwarded QSOs logged after since on the map,
+// newest first. QSOs without a grid can't be placed and are left out. Paths
+// start at control.grid unless a QSO carries its own, e.g. from GPS.
+func (r *Relay) QSOMap(limit int, since time.Time) []qsomap.Marker {
+	hasGrid := func(qso formatter.QSO) bool {
+		_, ok := qsomap.Position(qso.Grid)
+		return ok
+	}
+	return qsomap.Markers(r.sent.recent(limit, since, hasGrid), r.config.Control.Grid)
+}
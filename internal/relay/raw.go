@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// Raw listeners make the relay a plain UDP repeater: datagrams are forwarded
+// as received, with optional framing bytes around them, and never parsed.
+
+// rawSource is the stats source type for datagrams from raw listeners
+const rawSource = "raw"
+
+// resolveForward resolves a raw listener's forward addresses
+func resolveForward(addrs []string) ([]*net.UDPAddr, error) {
+	var forward []*net.UDPAddr
+	for _, a := range addrs {
+		fa, err := net.ResolveUDPAddr("udp", a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve raw forward address %s: %w", a, err)
+		}
+		forward = append(forward, fa)
+	}
+	return forward, nil
+}
+
+// relayRaw repeats a datagram from a raw listener. With forward addresses it
+// is sent from the listener's own socket; otherwise it goes to every target.
+func (r *Relay) relayRaw(l *listener, payload []byte, source *net.UDPAddr, trace uint64) {
+	r.stats.Received(rawSource)
+	if r.isPaused() {
+		r.stats.Dropped(dropPaused)
+		r.tracef(trace, "dropped: forwarding is paused")
+		return
+	}
+
+	framed := make([]byte, 0, len(l.prepend)+len(payload)+len(l.append))
+	framed = append(append(append(framed, l.prepend...), payload...), l.append...)
+
+	sent := 0
+	if len(l.forward) > 0 {
+		for _, fa := range l.forward {
+			if _, err := l.socket().WriteToUDP(framed, fa); err != nil {
+				r.stats.TargetFailed(fa.String())
+				log.Printf("Failed to repeat datagram from %s to %s: %v", source, fa, err)
+				continue
+			}
+			r.stats.Forwarded(fa.String())
+			sent++
+		}
+		r.tracef(trace, "repeated raw to %d of %d addresses", sent, len(l.forward))
+	} else {
+		targets := r.currentTargets()
+		for _, t := range targets {
+			err := r.sendMessage(t, string(framed))
+			r.alertSend(t, err)
+			if err != nil {
+				r.stats.TargetFailed(t.addr)
+				log.Printf("Failed to repeat datagram from %s to %s: %v", source, t.addr, err)
+				continue
+			}
+			r.stats.Forwarded(t.addr)
+			sent++
+		}
+		r.tracef(trace, "repeated raw to %d of %d targets", sent, len(targets))
+	}
+
+	if r.debug(logging.ModuleRelay) {
+		log.Printf("Repeated %d-byte datagram from %s to %d destinations", len(payload), source, sent)
+	}
+}
@@ -0,0 +1,209 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+)
+
+const (
+	// maxReadFailures is the number of read errors in a row after which a
+	// socket is rebound even if the errors don't say it is dead
+	maxReadFailures = 10
+
+	// Wait before the first rebind attempt and the most waited between
+	// later ones
+	rebindMinBackoff = 500 * time.Millisecond
+	rebindMaxBackoff = 30 * time.Second
+
+	// interfaceCheckInterval is how often the network addresses are compared
+	// with the last ones seen
+	interfaceCheckInterval = 5 * time.Second
+)
+
+// deadSocket reports whether a socket error means the socket no longer works,
+// e.g. after its interface went away during suspend or a Wi-Fi roam
+func deadSocket(err error) bool {
+	return errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EBADF) ||
+		errors.Is(err, syscall.ENETDOWN) ||
+		errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.EADDRNOTAVAIL)
+}
+
+// rebindDelay returns the wait before rebind attempt n, counting from 0: it
+// doubles from rebindMinBackoff up to rebindMaxBackoff, give or take a
+// quarter so relays on one machine don't retry in step
+func rebindDelay(attempt int) time.Duration {
+	d := rebindMaxBackoff
+	if attempt < 16 {
+		d = min(rebindMinBackoff<<attempt, rebindMaxBackoff)
+	}
+	return d - d/4 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// rebind replaces a listener's dead socket, retrying with backoff until a
+// new one is bound. It returns false if ctx is cancelled first.
+func (r *Relay) rebind(ctx context.Context, l *listener, dead *net.UDPConn, cause error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	// A socket closed by watchInterfaces has already been logged
+	if !errors.Is(cause, net.ErrClosed) {
+		log.Printf("Listener on %s stopped working (%v); rebinding", l.addr, cause)
+	}
+	dead.Close()
+
+	// An ephemeral port is rebound as the port it had
+	lc := l.config
+	if addr, ok := dead.LocalAddr().(*net.UDPAddr); ok && lc.Port == 0 {
+		lc.Port = addr.Port
+	}
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(rebindDelay(attempt)):
+		}
+
+		conn, err := r.bindListener(lc)
+		if err != nil {
+			// An interface can stay down for hours, so only attempts 1, 2,
+			// 4, 8, ... are logged
+			if attempt&(attempt+1) == 0 {
+				log.Printf("Rebinding listener on %s failed (attempt %d): %v", l.addr, attempt+1, err)
+			}
+			continue
+		}
+		if !l.replace(conn) {
+			conn.Close()
+			return false
+		}
+		log.Printf("Listener on %s rebound", conn.LocalAddr())
+		return true
+	}
+}
+
+// Rebind closes every listener's socket, so that each is bound again as
+// after a network change
+func (r *Relay) Rebind() {
+	for _, l := range r.listeners {
+		l.socket().Close()
+	}
+}
+
+// watchInterfaces logs changes to the machine's network addresses and
+// rebinds the listeners a change can break silently: those bound to a
+// particular address, and those in a multicast group, whose membership is
+// lost when the interface goes down. Listeners on the wildcard address keep
+// working.
+func (r *Relay) watchInterfaces(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interfaceCheckInterval)
+	defer ticker.Stop()
+
+	known, _ := interfaceAddrs()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := interfaceAddrs()
+		if err != nil {
+			continue
+		}
+		if known == nil {
+			known = current
+			continue
+		}
+		added, removed := diffAddrs(known, current)
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		known = current
+
+		var changes []string
+		for _, a := range added {
+			changes = append(changes, "up "+a)
+		}
+		for _, a := range removed {
+			changes = append(changes, "down "+a)
+		}
+		log.Printf("Network interfaces changed: %s", strings.Join(changes, ", "))
+
+		for _, l := range r.listeners {
+			if boundToInterface(l.config) {
+				log.Printf("Rebinding listener on %s after the network change", l.addr)
+				l.socket().Close()
+			}
+		}
+	}
+}
+
+// boundToInterface reports whether a listener depends on a particular
+// interface: a multicast group, a named interface, or an address other than
+// the wildcard and loopback
+func boundToInterface(lc config.ListenerConfig) bool {
+	if lc.MulticastGroup != "" || lc.Interface != "" {
+		return true
+	}
+	if lc.Address == "" || lc.Address == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(lc.Address)
+	return ip == nil || !ip.IsUnspecified() && !ip.IsLoopback()
+}
+
+// interfaceAddrs returns the addresses of the interfaces that are up, as
+// "name address" strings
+func interfaceAddrs() (map[string]bool, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make(map[string]bool)
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+		ifAddrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			addrs[ifi.Name+" "+a.String()] = true
+		}
+	}
+	return addrs, nil
+}
+
+// diffAddrs returns the addresses in current but not known, and the other
+// way round, each sorted
+func diffAddrs(known, current map[string]bool) (added, removed []string) {
+	for a := range current {
+		if !known[a] {
+			added = append(added, a)
+		}
+	}
+	for a := range known {
+		if !current[a] {
+			removed = append(removed, a)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
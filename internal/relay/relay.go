@@ -1,27 +1,115 @@
 package relay
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/activity"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/alert"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/aprs"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/archive"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/comport"
 	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/events"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/fldigi"
 	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/gpsd"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/messages"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/rigctl"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/rotator"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/scoreboard"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/scoring"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/serial"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/tlspeer"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/winlink"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
 )
 
+// target is a destination connection and the format it expects
+type target struct {
+	addr   string
+	format formatter.OutputFormat
+	conn   io.WriteCloser
+	config config.TargetConfig
+
+	// Send queue used in performance mode; nil means messages are written
+	// directly by the goroutine that formatted them
+	queue chan string
+	stop  chan struct{}
+	done  chan struct{}
+
+	// Reading replies, for targets with a response timeout
+	replyMu    sync.Mutex
+	replyError *regexp.Regexp
+}
+
 // Relay manages the UDP listener and broadcaster
 type Relay struct {
-	config    *config.Config
-	formatter *formatter.Formatter
-	listener  *net.UDPConn
-	sender    *net.UDPConn
-	running   bool
-	stopChan  chan bool
-	wg        sync.WaitGroup
-	mu        sync.RWMutex
+	config     *config.Config
+	formatter  *formatter.Formatter
+	listeners  []*listener
+	targets    []*target
+	journal    *journal.Journal
+	messages   *messages.Log // JS8Call directed messages; nil when not kept
+	workedDB   *workeddb.DB
+	archive    *archive.Archive
+	aprs       *aprs.Client
+	scoreboard *scoreboard.Poster
+	serialPort *comport.Sink
+	events     *events.Hub // Shared by a supervisor's relays
+	activity   *activity.Tracker
+	alerts     *alert.Manager
+	cty        *formatter.CTY
+	scorer     *scoring.Scorer
+	serials    *serial.Counter
+	trace      *tracer
+	drift      *clockDrift
+	overrides  []sourceOverride
+	aliases    []callAlias
+	mappings   []fieldMapping // guarded by mu
+	auth       *authenticator
+	lookup     *exchangeLookup
+	worked     *workedBefore
+	rig        *rigctl.Client
+	fldigi     *fldigi.Poller
+	gps        *gpsd.Client
+	rotator    *rotator.Client
+	jtalert    *formatter.JTAlertStation // Last JTAlert station broadcast
+	band       bandTracker               // Band last sent to N1MM in RadioInfo
+	sent       *sentQSOs
+	pairs      *qsoPairs
+	dedup      *deduper      // nil when dedup is off
+	review     *review.Queue // QSOs held for the operator to check; nil when review is off
+	stats      *stats.Stats
+	failures   *stats.Failures // Recent parse failures; nil when not kept
+	console    *logging.Console
+	clients    map[string]*wsjtxClient
+	bridge     *net.UDPConn
+	chain      net.Listener
+	peerTLS    *tlspeer.Peer // Certificate and trusted relays for TLS chain connections
+	running    bool
+	levels     *logging.Levels // Log level of each module
+	paused     bool
+	onDuty     string       // Operator set with SetOperator; empty credits the configured one
+	lastPacket atomic.Int64 // UnixNano of the last source packet, for the watchdog
+	ready      chan struct{}
+	readyOnce  sync.Once
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
 }
 
 // New creates a new relay instance
@@ -32,15 +120,342 @@ func New(cfg *config.Config) (*Relay, error) {
 		cfg.Formatting.N1MM.Contest,
 	)
 
-	return &Relay{
+	levels, err := logging.NewLevels(cfg.Verbose, cfg.Log.Levels)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := formatterOptions(cfg, levels)
+	if err != nil {
+		return nil, err
+	}
+	f.SetOptions(opts)
+
+	for _, t := range cfg.AllTargets() {
+		if err := validateTarget(t); err != nil {
+			return nil, err
+		}
+		if _, err := targetLocalIP(t); err != nil {
+			return nil, fmt.Errorf("target %s:%d: %w", t.Address, t.Port, err)
+		}
+	}
+	for _, lc := range append([]config.ListenerConfig{cfg.MainListener()}, cfg.Listeners...) {
+		if _, err := BindAddr(lc); err != nil {
+			return nil, fmt.Errorf("listener on port %d: %w", lc.Port, err)
+		}
+	}
+
+	if cfg.Heartbeat.Enabled && cfg.Heartbeat.Interval <= 0 {
+		return nil, fmt.Errorf("heartbeat interval must be positive, got %s", cfg.Heartbeat.Interval)
+	}
+
+	if cfg.Watchdog.Enabled && cfg.Watchdog.Timeout <= 0 {
+		return nil, fmt.Errorf("watchdog timeout must be positive, got %s", cfg.Watchdog.Timeout)
+	}
+
+	overrides, err := parseOverrides(cfg.Formatting.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := parseCallAliases(cfg.Formatting.CallAliases)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := parseMappings(cfg.Formatting.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	var peerTLS *tlspeer.Peer
+	if tc := cfg.Chain.TLS; tc.Cert != "" {
+		peerTLS, err = tlspeer.Load(tlspeer.Config{Cert: tc.Cert, Key: tc.Key, CA: tc.CA, Fingerprints: tc.Fingerprints})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Relay{
 		config:    cfg,
 		formatter: f,
-		stopChan:  make(chan bool, 1),
-	}, nil
+		levels:    levels,
+		ready:     make(chan struct{}),
+		overrides: overrides,
+		aliases:   aliases,
+		mappings:  mappings,
+		peerTLS:   peerTLS,
+		sent:      newSentQSOs(),
+		events:    &events.Hub{},
+	}
+	r.pairs = newQSOPairs(wsjtxPairWindow, &r.wg)
+	if cfg.Review.Enabled {
+		r.review = review.New(cfg.Review.Timeout, &r.wg)
+	}
+	if cfg.Dedup.Enabled {
+		if r.dedup, err = newDeduper(*cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	r.stats, err = stats.New(cfg.Stats.Path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Stats.ErrorSamples > 0 {
+		r.failures = stats.NewFailures(cfg.Stats.ErrorSamples)
+	}
+
+	if err := checkListeners(cfg.Listeners); err != nil {
+		return nil, err
+	}
+
+	r.drift, err = newClockDrift(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Formatting.Exchange.Lookup {
+		r.lookup = newExchangeLookup()
+	}
+
+	if cfg.WSJTX.Highlight.Enabled {
+		r.worked, err = newWorkedBefore(*cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Auth.Enabled {
+		r.auth, err = newAuthenticator(*cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Activity.Enabled {
+		r.activity = activity.New(activity.Config{
+			Window:         cfg.Activity.Window,
+			DigestInterval: cfg.Activity.DigestInterval,
+			WebhookURL:     cfg.Activity.WebhookURL,
+		})
+	}
+
+	if cfg.APRS.Enabled {
+		r.aprs, err = aprs.NewClient(aprs.Config{
+			Server:      cfg.APRS.Server,
+			Callsign:    cfg.APRS.Callsign,
+			Passcode:    cfg.APRS.Passcode,
+			Mode:        cfg.APRS.Mode,
+			Interval:    cfg.APRS.Interval,
+			MinInterval: cfg.APRS.MinInterval,
+			Redact:      cfg.Privacy.RedactCallsigns,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Scoreboard.Enabled {
+		r.scoreboard, err = scoreboard.New(scoreboard.Config{
+			Boards:   cfg.Scoreboard.Boards,
+			Interval: cfg.Scoreboard.Interval,
+			Retries:  cfg.Scoreboard.Retries,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SerialPort.Enabled {
+		r.serialPort, err = comport.New(comport.Config{
+			Port:       cfg.SerialPort.Port,
+			Baud:       cfg.SerialPort.Baud,
+			Template:   cfg.SerialPort.Template,
+			LineEnding: cfg.SerialPort.LineEnding,
+			Redact:     cfg.Privacy.RedactCallsigns,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Alerts.Enabled {
+		r.alerts, r.cty, err = newAlerts(cfg, levels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The rate meter counts DXCC multipliers with the alerts' country file
+	// or its own
+	if r.cty == nil && cfg.Stats.CTYFile != "" {
+		r.cty, err = formatter.LoadCTY(cfg.Stats.CTYFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if contest, ok := cfg.ScoringContest(); ok {
+		r.scorer, err = scoring.New(contest, r.cty)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Rig.Enabled {
+		rigCfg := rigctl.Config{
+			Address:  cfg.Rig.Address,
+			Interval: cfg.Rig.PollInterval,
+		}
+		if cfg.Rig.RadioInfo {
+			rigCfg.OnChange = r.sendRadioInfo
+		}
+		r.rig, err = rigctl.NewClient(rigCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Fldigi.Enabled {
+		r.fldigi, err = fldigi.NewPoller(fldigi.Config{
+			Address:  cfg.Fldigi.Address,
+			Interval: cfg.Fldigi.PollInterval,
+			OnQSO:    r.fldigiQSO,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.GPS.Enabled {
+		r.gps, err = gpsd.NewClient(gpsd.Config{
+			Address:      cfg.GPS.Address,
+			Precision:    cfg.GPS.Precision,
+			OnGridChange: r.gridChanged,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Rotator.Enabled {
+		r.rotator, err = rotator.NewClient(rotator.Config{
+			Protocol:  cfg.Rotator.Protocol,
+			Address:   cfg.Rotator.Address,
+			Rotor:     cfg.Rotator.Rotor,
+			MinChange: cfg.Rotator.MinChange,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// formatterOptions builds the formatter's optional settings from the configuration
+func formatterOptions(cfg *config.Config, levels *logging.Levels) (formatter.Options, error) {
+	opts := formatter.Options{
+		SourceTimezones:        make(map[formatter.MessageType]*time.Location),
+		OutputUTC:              cfg.Formatting.Time.OutputUTC,
+		UseReceiveTime:         cfg.Formatting.Time.UseReceiveTime,
+		RSTDefaults:            make(map[string]string),
+		NormalizeDBReports:     cfg.Formatting.RST.NormalizeDB,
+		RejectInvalidCallsigns: cfg.Formatting.Callsign.RejectInvalid,
+		StrictADIF:             cfg.Formatting.ADIF.Strict,
+		SCPMaxDistance:         cfg.Formatting.SCP.MaxDistance,
+		SCPAutoCorrect:         cfg.Formatting.SCP.AutoCorrect,
+		NodeID:                 nodeID(cfg.Chain.NodeID, cfg.Name),
+		MaxHops:                cfg.Chain.MaxHops,
+		RelayVersion:           cfg.Chain.ProtocolVersion,
+		XML: formatter.XMLStyle{
+			Indent:      cfg.Formatting.XML.Indent,
+			Declaration: cfg.Formatting.XML.Declaration,
+		},
+		Network: formatter.N1MMNetwork{
+			StationName: cfg.Formatting.N1MM.StationName,
+			NetBiosName: cfg.Formatting.N1MM.NetBiosName,
+			RadioNr:     cfg.Formatting.N1MM.RadioNr,
+		},
+		App: formatter.N1MMApp{
+			Name:    cfg.Formatting.N1MM.App,
+			Version: cfg.Version,
+			SendID:  cfg.Formatting.N1MM.SendID,
+		},
+	}
+
+	if cfg.Formatting.N1MM.RadioNr < 0 {
+		return opts, fmt.Errorf("invalid N1MM radio_nr %d", cfg.Formatting.N1MM.RadioNr)
+	}
+
+	switch cfg.Formatting.XML.FieldOrder {
+	case "", "n1mm":
+	case "legacy":
+		opts.XML.LegacyOrder = true
+	default:
+		return opts, fmt.Errorf("invalid XML field order %q (use n1mm or legacy)", cfg.Formatting.XML.FieldOrder)
+	}
+
+	if len(cfg.Formatting.Exchange.Parsers) > 0 {
+		opts.ExchangeParsers = make(map[string]formatter.ExchangeParser)
+		for contest, parser := range cfg.Formatting.Exchange.Parsers {
+			if !formatter.ValidExchangeParser(parser) {
+				return opts, fmt.Errorf("invalid exchange parser %q for contest %s", parser, contest)
+			}
+			opts.ExchangeParsers[strings.ToUpper(contest)] = formatter.ExchangeParser(strings.ToLower(parser))
+		}
+	}
+
+	if cfg.Formatting.TextLog.Format != "" {
+		textLog, err := formatter.CompileTextLog(cfg.Formatting.TextLog.Format)
+		if err != nil {
+			return opts, err
+		}
+		opts.TextLog = textLog
+	}
+
+	if len(cfg.Formatting.Detection.Rules) > 0 || len(cfg.Formatting.Detection.Disable) > 0 {
+		var custom []formatter.CustomDetectRule
+		for _, rule := range cfg.Formatting.Detection.Rules {
+			custom = append(custom, formatter.CustomDetectRule(rule))
+		}
+		rules, err := formatter.BuildDetectRules(custom, cfg.Formatting.Detection.Disable)
+		if err != nil {
+			return opts, err
+		}
+		opts.DetectRules = rules
+	}
+
+	if cfg.Formatting.SCP.File != "" {
+		scp, err := formatter.LoadSCP(cfg.Formatting.SCP.File)
+		if err != nil {
+			return opts, err
+		}
+		opts.SCP = scp
+		if levels.Debug(logging.ModuleFormatter) {
+			log.Printf("Loaded %d callsigns from %s", scp.Len(), cfg.Formatting.SCP.File)
+		}
+	}
+
+	// Viper lower-cases map keys, modes are matched in upper case
+	for mode, report := range cfg.Formatting.RST.Defaults {
+		opts.RSTDefaults[strings.ToUpper(mode)] = report
+	}
+
+	for source, name := range cfg.Formatting.Time.SourceTimezones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return opts, fmt.Errorf("invalid time zone %q for source %s: %w", name, source, err)
+		}
+		opts.SourceTimezones[formatter.MessageType(source)] = loc
+	}
+
+	return opts, nil
 }
 
-// Start begins listening for UDP messages and relaying them
-func (r *Relay) Start() error {
+// Run listens for UDP messages and relays them until ctx is cancelled.
+// It returns an error if the sockets cannot be set up; a cancelled context
+// is a normal shutdown and returns nil once all in-flight messages are done.
+func (r *Relay) Run(ctx context.Context) error {
 	r.mu.Lock()
 	if r.running {
 		r.mu.Unlock()
@@ -49,130 +464,560 @@ func (r *Relay) Start() error {
 	r.running = true
 	r.mu.Unlock()
 
-	// Setup UDP listener
-	listenAddr := net.JoinHostPort(r.config.Listen.Address, strconv.Itoa(r.config.Listen.Port))
-	udpAddr, err := net.ResolveUDPAddr("udp", listenAddr)
-	if err != nil {
-		return fmt.Errorf("failed to resolve listen address: %w", err)
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	if err := r.open(); err != nil {
+		r.closeConnections()
+		return err
 	}
 
-	r.listener, err = net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		return fmt.Errorf("failed to start UDP listener: %w", err)
+	// Start listening for messages
+	r.markPacket()
+	r.startListeners(ctx)
+	r.wg.Add(1)
+	go r.watchInterfaces(ctx)
+
+	if r.aprs != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.aprs.Run(ctx)
+		}()
 	}
 
-	// Setup UDP sender
-	targetAddr := net.JoinHostPort(r.config.Target.Address, strconv.Itoa(r.config.Target.Port))
-	targetUDPAddr, err := net.ResolveUDPAddr("udp", targetAddr)
-	if err != nil {
-		r.listener.Close()
-		return fmt.Errorf("failed to resolve target address: %w", err)
+	if r.scoreboard != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.scoreboard.Run(ctx)
+		}()
 	}
 
-	r.sender, err = net.DialUDP("udp", nil, targetUDPAddr)
-	if err != nil {
-		r.listener.Close()
-		return fmt.Errorf("failed to create UDP sender: %w", err)
+	if r.serialPort != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.serialPort.Run(ctx)
+		}()
 	}
 
-	if r.config.Verbose {
-		log.Printf("UDP Relay started - listening on %s, forwarding to %s", listenAddr, targetAddr)
+	if r.alerts != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.alerts.Run(ctx)
+		}()
+	}
+
+	if r.activity != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.activity.Run(ctx)
+		}()
+	}
+
+	if r.rig != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.rig.Run(ctx)
+		}()
+	}
+
+	if r.fldigi != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.fldigi.Run(ctx)
+		}()
+	}
+
+	if r.gps != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.gps.Run(ctx)
+		}()
+	}
+
+	if r.rotator != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.rotator.Run(ctx)
+		}()
+	}
+
+	if r.config.Bridge.Enabled {
+		r.wg.Add(1)
+		go r.runBridge(ctx)
+	}
+
+	if r.config.Winlink.Enabled {
+		r.wg.Add(1)
+		go r.tailWinlink(ctx)
+	}
+
+	if r.config.Heartbeat.Enabled {
+		r.wg.Add(1)
+		go r.runHeartbeat(ctx)
+	}
+
+	if r.config.Watchdog.Enabled {
+		r.wg.Add(1)
+		go r.runWatchdog(ctx)
+	}
+
+	if r.config.Listen.DropCheck > 0 && kernelDropCounters {
+		r.wg.Add(1)
+		go r.runDropCheck(ctx)
+	}
+
+	if r.chain != nil {
+		r.wg.Add(1)
+		go r.runChain(ctx)
 	}
 
-	// Start listening for messages
 	r.wg.Add(1)
-	go r.listen()
+	go r.saveStats(ctx)
+	r.readyOnce.Do(func() { close(r.ready) })
+	r.publish(events.Event{Type: events.TypeStarted})
 
-	// Wait for stop signal
-	<-r.stopChan
+	<-ctx.Done()
+	r.publish(events.Event{Type: events.TypeStopping})
+
+	if r.debug(logging.ModuleRelay) {
+		log.Println("Stopping UDP relay...")
+	}
+
+	// Closing the listeners unblocks the read loops; targets stay open until
+	// messages already being processed have been sent
+	r.closeListeners()
+	if r.bridge != nil {
+		r.bridge.Close()
+	}
+	if r.chain != nil {
+		r.chain.Close()
+	}
+	r.pairs.close()
+	if r.review != nil {
+		r.review.Close()
+	}
+	r.wg.Wait()
+	r.closeConnections()
+
+	if err := r.stats.Save(); err != nil {
+		log.Printf("Failed to save stats: %v", err)
+	}
+
+	if r.debug(logging.ModuleRelay) {
+		log.Println("UDP relay stopped")
+	}
 
 	return nil
 }
 
-// Stop gracefully stops the relay
-func (r *Relay) Stop() {
-	r.mu.Lock()
-	if !r.running {
-		r.mu.Unlock()
-		return
+// Ready returns a channel that is closed once Run has opened its sockets
+func (r *Relay) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// ListenAddr returns the address the relay is bound to, which is useful when
+// the configured listen port is 0. It returns nil before the relay is ready.
+func (r *Relay) ListenAddr() net.Addr {
+	select {
+	case <-r.ready:
+		return r.listeners[0].socket().LocalAddr()
+	default:
+		return nil
 	}
-	r.running = false
-	r.mu.Unlock()
+}
 
-	if r.config.Verbose {
-		log.Println("Stopping UDP relay...")
+// ChainAddr returns the address the TCP chain listener is bound to, or nil
+// if it is disabled or the relay is not ready
+func (r *Relay) ChainAddr() net.Addr {
+	select {
+	case <-r.ready:
+		if r.chain != nil {
+			return r.chain.Addr()
+		}
+	default:
+	}
+	return nil
+}
+
+// BridgeAddr returns the address the N1MM bridge is bound to, or nil if the
+// bridge is disabled or the relay is not ready
+func (r *Relay) BridgeAddr() net.Addr {
+	select {
+	case <-r.ready:
+		if r.bridge != nil {
+			return r.bridge.LocalAddr()
+		}
+	default:
 	}
+	return nil
+}
+
+// open creates the UDP listener and one sender per target
+func (r *Relay) open() error {
+	if err := r.openListeners(); err != nil {
+		return err
+	}
+	listenAddr := r.listeners[0].socket().LocalAddr()
+
+	r.targets = nil
+	for _, tc := range r.config.AllTargets() {
+		t, err := r.dialTarget(tc)
+		if err != nil {
+			return err
+		}
+		r.targets = append(r.targets, t)
 
-	// Close connections
-	if r.listener != nil {
-		r.listener.Close()
+		if r.debug(logging.ModuleRelay) {
+			log.Printf("UDP Relay started - listening on %s, forwarding to %s (%s)", listenAddr, t.addr, tc.Format)
+		}
 	}
-	if r.sender != nil {
-		r.sender.Close()
+
+	if err := r.openState(); err != nil {
+		return err
 	}
 
-	// Signal stop and wait for goroutines
-	select {
-	case r.stopChan <- true:
+	if r.config.Bridge.Enabled {
+		if err := r.openBridge(); err != nil {
+			return err
+		}
+	}
+
+	if r.config.Chain.TCPListen != "" {
+		if err := r.openChain(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openState opens the trace, journal, worked-before database, serial
+// number counter and archive, which every way of running the relay uses
+func (r *Relay) openState() error {
+	var err error
+
+	if r.config.Log.Trace {
+		r.trace, err = newTracer(r.config.Log.TraceFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.config.Journal.Path != "" {
+		r.journal, err = journal.Open(r.config.Journal.Path)
+		if err != nil {
+			return err
+		}
+		r.seedFromJournal()
+	}
+
+	if r.config.Messages.Path != "" {
+		r.messages, err = messages.Open(r.config.Messages.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.config.WorkedDB.Enabled {
+		r.workedDB, err = workeddb.Open(r.config.WorkedDB.Path)
+		if err != nil {
+			return err
+		}
+		if r.debug(logging.ModuleEnrichment) {
+			calls, slots, entities := r.workedDB.Counts()
+			log.Printf("Worked-before database: %d calls, %d band/mode slots, %d DXCC entities", calls, slots, entities)
+		}
+	}
+
+	if r.config.Serial.Mode == "auto" || r.config.Serial.Mode == "on" {
+		r.serials, err = serial.Open(r.config.Serial.Path, r.config.Formatting.N1MM.Contest, r.config.Serial.Start)
+		if err != nil {
+			return err
+		}
+		if r.debug(logging.ModuleEnrichment) {
+			log.Printf("Serial numbers: next sent is %d", r.serials.Last()+1)
+		}
+	}
+
+	if r.config.Archive.Enabled {
+		r.archive, err = archive.Open(r.config.Archive.Directory, r.config.Archive.RetentionDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateTarget checks a target's format and protocol
+func validateTarget(tc config.TargetConfig) error {
+	if tc.Format != "" && !formatter.ValidOutputFormat(tc.Format) {
+		return fmt.Errorf("unknown output format %q for target %s:%d", tc.Format, tc.Address, tc.Port)
+	}
+	if tc.Framing != "" && !ValidFraming(tc.Framing) {
+		return fmt.Errorf("unknown framing %q for target %s:%d", tc.Framing, tc.Address, tc.Port)
+	}
+	switch strings.ToLower(tc.Protocol) {
+	case "", "udp":
+	case "tcp", "tls":
+		// Other relays read one envelope per line; other formats need a
+		// framing to be split again
+		framing := Framing(strings.ToLower(tc.Framing))
+		if strings.EqualFold(tc.Format, string(formatter.OutputFormatRelay)) {
+			if framing != "" && framing != FramingLine {
+				return fmt.Errorf("target %s:%d: relay connections are line framed", tc.Address, tc.Port)
+			}
+		} else if framing == "" {
+			return fmt.Errorf("target %s:%d: protocol %s needs the relay format or a framing", tc.Address, tc.Port, strings.ToLower(tc.Protocol))
+		}
 	default:
+		return fmt.Errorf("unknown protocol %q for target %s:%d", tc.Protocol, tc.Address, tc.Port)
+	}
+	if !formatter.ValidSNRReportStyle(tc.SNRReports) {
+		return fmt.Errorf("unknown snr_reports %q for target %s:%d", tc.SNRReports, tc.Address, tc.Port)
 	}
+	return nil
+}
 
-	r.wg.Wait()
+// dialTarget creates the sender for one target
+func (r *Relay) dialTarget(tc config.TargetConfig) (*target, error) {
+	targetAddr := net.JoinHostPort(tc.Address, strconv.Itoa(tc.Port))
+	localIP, err := targetLocalIP(tc)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %w", targetAddr, err)
+	}
 
-	if r.config.Verbose {
-		log.Println("UDP relay stopped")
+	framing := Framing(strings.ToLower(tc.Framing))
+	if protocol := strings.ToLower(tc.Protocol); protocol == "tcp" || protocol == "tls" {
+		// Only another relay says hello
+		conn := &tcpConn{addr: targetAddr, local: localIP, framing: framing}
+		if strings.EqualFold(tc.Format, string(formatter.OutputFormatRelay)) {
+			conn.hello, conn.framing = r.formatter.HelloLine(), FramingLine
+		}
+		if protocol == "tls" {
+			if r.peerTLS == nil {
+				return nil, fmt.Errorf("target %s: protocol tls needs chain.tls.cert and chain.tls.key", targetAddr)
+			}
+			conn.tls = r.peerTLS.Client()
+		}
+		t := &target{
+			addr:   targetAddr,
+			format: formatter.OutputFormat(tc.Format),
+			conn:   conn,
+			config: tc,
+		}
+		if r.performanceEnabled() && r.config.Performance.SendQueue > 0 {
+			t.startQueue(r.config.Performance.SendQueue)
+		}
+		return t, nil
+	}
+
+	targetUDPAddr, err := net.ResolveUDPAddr("udp", targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target address %s: %w", targetAddr, err)
+	}
+
+	var localAddr *net.UDPAddr
+	if localIP != nil {
+		localAddr = &net.UDPAddr{IP: localIP}
 	}
+	conn, err := net.DialUDP("udp", localAddr, targetUDPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create UDP sender for %s: %w", targetAddr, err)
+	}
+
+	t := &target{
+		addr:   targetAddr,
+		format: formatter.OutputFormat(tc.Format),
+		conn:   conn,
+		config: tc,
+	}
+	if framing != "" {
+		t.conn = &framedConn{UDPConn: conn, framing: framing}
+	}
+	if tc.ResponseTimeout > 0 {
+		if t.replyError, err = responseError(tc.ResponseError); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("target %s: %w", targetAddr, err)
+		}
+	}
+
+	if r.performanceEnabled() {
+		r.setSocketBuffers(conn, targetAddr)
+		if r.config.Performance.SendQueue > 0 {
+			t.startQueue(r.config.Performance.SendQueue)
+		}
+	}
+
+	return t, nil
 }
 
-// listen continuously listens for incoming UDP messages
-func (r *Relay) listen() {
-	defer r.wg.Done()
+// closeConnections closes the listener and all target connections
+func (r *Relay) closeConnections() {
+	r.closeListeners()
 
-	buffer := make([]byte, 4096)
+	if r.bridge != nil {
+		r.bridge.Close()
+	}
 
-	for {
-		r.mu.RLock()
-		running := r.running
-		r.mu.RUnlock()
+	if r.chain != nil {
+		r.chain.Close()
+	}
 
-		if !running {
-			break
+	r.mu.Lock()
+	for _, t := range r.targets {
+		t.close()
+	}
+	r.mu.Unlock()
+
+	if r.journal != nil {
+		r.journal.Close()
+	}
+
+	if r.messages != nil {
+		r.messages.Close()
+	}
+
+	if r.workedDB != nil {
+		r.workedDB.Close()
+	}
+
+	if r.archive != nil {
+		r.archive.Close()
+	}
+
+	if r.trace != nil {
+		r.trace.close()
+	}
+}
+
+// listen reads datagrams from a listener and queues them for the workers
+// until ctx is cancelled
+func (r *Relay) listen(ctx context.Context, l *listener, pool *workerPool) {
+	buffer := make([]byte, bufferSize(r.config.Listen.BufferSize))
+	failures := 0 // Read errors in a row
+
+	for {
+		if ctx.Err() != nil {
+			return
 		}
 
-		// Set a read timeout to allow periodic checking of running status
-		err := r.listener.SetReadDeadline(time.Now().Add(1 * time.Second))
+		// Set a read timeout to allow periodic checking for shutdown
+		conn := l.socket()
+		err := conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 		if err != nil {
-			if r.config.Verbose {
+			if deadSocket(err) && !r.rebind(ctx, l, conn, err) {
+				return
+			}
+			if r.debug(logging.ModuleRelay) {
 				log.Printf("Error setting read deadline: %v", err)
 			}
 			continue
 		}
 
-		n, clientAddr, err := r.listener.ReadFromUDP(buffer)
+		n, clientAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				// Timeout is expected, continue
 				continue
 			}
-			if r.config.Verbose {
+			if ctx.Err() != nil {
+				// Listener was closed for shutdown
+				return
+			}
+
+			// A one-off error, such as an ICMP port unreachable report on
+			// Windows, leaves the socket usable; a dead one has to be rebound
+			failures++
+			if deadSocket(err) || failures >= maxReadFailures {
+				if !r.rebind(ctx, l, conn, err) {
+					return
+				}
+				failures = 0
+				continue
+			}
+			if r.debug(logging.ModuleRelay) {
 				log.Printf("Error reading UDP message: %v", err)
 			}
 			continue
 		}
+		failures = 0
+
+		trace := r.traceDatagram(buffer[:n], clientAddr)
+
+		// A datagram that fills the buffer was most likely cut short by the
+		// kernel; parsing the remainder would produce a corrupt QSO
+		if n == len(buffer) {
+			r.stats.Dropped(dropTruncated)
+			r.tracef(trace, "dropped: filled the %d-byte buffer, probably truncated", n)
+			log.Printf("Dropping datagram from %s: it filled the %d-byte buffer and was probably truncated (increase listen.buffer_size)", clientAddr, n)
+			continue
+		}
 
-		message := string(buffer[:n])
+		payload, signed, ok := r.authenticate(buffer[:n], clientAddr)
+		if !ok {
+			r.tracef(trace, "dropped: missing or invalid signature")
+			continue
+		}
+		r.markPacket()
 
-		if r.config.Verbose {
+		if l.raw {
+			r.relayRaw(l, payload, clientAddr, trace)
+			continue
+		}
+
+		message := string(payload)
+		client := r.rememberClient(payload, clientAddr, conn)
+		r.trackStatus(payload, client)
+		r.trackActivity(payload, client)
+		r.trackRotator(payload)
+		r.trackBand(payload)
+
+		if r.debug(logging.ModuleRelay) {
 			log.Printf("UDP packet received from %s (%d bytes)", clientAddr, n)
 		}
 
-		// Process the message
-		go r.processMessage(message, clientAddr, n)
+		pool.submit(job{message: message, addr: clientAddr, size: n, trusted: signed || l.sourceType != "", trace: trace, sourceType: l.sourceType})
+	}
+}
+
+// Datagram size limits. UDP payloads are at most 65,507 bytes over IPv4, so
+// the maximum buffer can never be filled and nothing is truncated.
+const (
+	minBufferSize     = 512
+	maxBufferSize     = formatter.MaxMessageSize
+	defaultBufferSize = maxBufferSize
+)
+
+// bufferSize returns the read buffer size for a configured value
+func bufferSize(configured int) int {
+	switch {
+	case configured <= 0:
+		return defaultBufferSize
+	case configured < minBufferSize:
+		return minBufferSize
+	case configured > maxBufferSize:
+		return maxBufferSize
 	}
+	return configured
 }
 
 // processMessage handles the conversion and forwarding of a single message
-func (r *Relay) processMessage(message string, sourceAddr *net.UDPAddr, packetSize int) {
+func (r *Relay) processMessage(j job) {
+	message, sourceAddr, packetSize, trace := j.message, j.addr, j.size, j.trace
+
 	// Filter messages based on source port - only process messages from expected application ports
 	// Common ham radio application UDP ports:
 	// 2333 - WSJT-X logging port (what we're listening on)
@@ -192,70 +1037,436 @@ func (r *Relay) processMessage(message string, sourceAddr *net.UDPAddr, packetSi
 		}
 	}
 
-	// Also allow messages from localhost on any port (applications use ephemeral ports)
-	if sourceAddr.IP.IsLoopback() {
+	// Also allow messages from localhost on any port (applications use ephemeral ports),
+	// and trusted and chained messages, which remote relays and signers send from
+	// ephemeral ports too
+	chained := formatter.IsRelayEnvelope(message)
+	if sourceAddr.IP.IsLoopback() || j.trusted || chained {
 		isExpectedPort = true
 	}
 
 	if !isExpectedPort {
 		// Silently ignore messages from unexpected ports (likely binary protocol)
+		r.stats.Dropped(dropUnexpectedPort)
+		r.tracef(trace, "dropped: source port %d is not a known application port and %s is not local", sourcePort, sourceAddr.IP)
 		return
 	}
+	r.tracef(trace, "source %s accepted by the port filter", sourceAddr)
+
+	msgType := r.messageType(message, j.sourceType, trace)
 
-	// Detect message type if auto-detection is enabled
-	var msgType formatter.MessageType
-	if r.config.Formatting.AutoDetect {
-		msgType = r.formatter.DetectMessageType(message)
-	} else {
-		msgType = formatter.MessageType(r.config.Formatting.SourceType)
+	// JTAlert station broadcasts describe this station rather than a QSO
+	if msgType == formatter.MessageTypeJTAlert && formatter.IsJTAlertStation(message) {
+		r.stats.Received(string(msgType))
+		r.jtalertStation(message, trace)
+		return
 	}
 
-	// Parse the message
-	qso, err := r.formatter.ParseMessage(message, msgType)
-	if err != nil {
-		if r.config.Verbose {
-			log.Printf("Skipping message from %s: %v", sourceAddr, err)
-		}
+	// JS8Call directed messages are traffic between stations, not QSOs
+	if formatter.IsJS8Directed(message) {
+		r.stats.Received(string(formatter.MessageTypeJS8Call))
+		r.js8Message(message, sourceAddr.String(), trace)
 		return
 	}
 
-	if r.config.Verbose {
-		log.Printf("Parsed message type: %s, Callsign: %s, Band: %s, Mode: %s",
-			msgType, qso.Callsign, qso.Band, qso.Mode)
+	origin := j.origin
+	if origin == "" {
+		origin = fmt.Sprintf("UDP packet received (%d bytes) from %s", packetSize, sourceAddr)
 	}
 
-	// Convert to N1MM format
-	n1mmMessage, err := r.formatter.FormatForN1MM(qso)
-	if err != nil {
-		if r.config.Verbose {
-			log.Printf("Failed to format message for N1MM: %v", err)
-		}
+	// N1MM's "all messages" port also carries RadioInfo, spots, lookups and
+	// scores, which aren't contacts
+	if kind := formatter.N1MMBroadcastKind(message); kind != "" {
+		r.stats.Received(string(formatter.MessageTypeN1MM))
+		r.n1mmBroadcast(kind, message, sourceAddr.String(), origin, trace)
 		return
 	}
 
-	// Send to target
-	err = r.sendMessage(n1mmMessage)
-	if err != nil {
-		log.Printf("Failed to relay packet: %v", err)
-		if r.config.Verbose {
-			log.Printf("Failed to send message: %v", err)
+	// A datagram may carry several records; each becomes its own QSO
+	records := formatter.SplitRecords(message)
+	if len(records) > 1 && r.debug(logging.ModuleFormatter) {
+		log.Printf("Datagram from %s contains %d records", sourceAddr, len(records))
+	}
+	for _, record := range records {
+		// Parse the message
+		r.stats.Received(string(msgType))
+		qso, err := r.formatter.ParseMessage(record, msgType)
+		if errors.Is(err, formatter.ErrRelayLoop) {
+			// Our own output coming back, not a broken message
+			r.stats.Dropped(dropRelayLoop)
+			r.tracef(trace, "dropped: %v", err)
+			if r.debug(logging.ModuleFormatter) {
+				log.Printf("Dropping message from %s: %v", sourceAddr, err)
+			}
+			continue
+		}
+		if err != nil {
+			r.stats.ParseFailed(failureReason(err))
+			if !wsjtxChatter(record) {
+				r.failures.Add(sourceAddr.String(), string(msgType), err, record)
+			}
+			r.alertParseFailed()
+			r.tracef(trace, "dropped: parse failed: %v", err)
+			if r.debug(logging.ModuleFormatter) {
+				log.Printf("Skipping message from %s: %v", sourceAddr, err)
+			}
+			continue
+		}
+		r.tracef(trace, "parsed QSO with %s on %s %s", qso.Callsign, qso.Band, qso.Mode)
+
+		if r.debug(logging.ModuleFormatter) {
+			log.Printf("Parsed message type: %s, Callsign: %s, Band: %s, Mode: %s",
+				msgType, qso.Callsign, qso.Band, qso.Mode)
+		}
+
+		// VarAC beacons, pings and CQs; a spot from another relay was let
+		// through by the first one
+		if qso.Action == formatter.ActionSpot && msgType != formatter.MessageTypeRelay && !r.keepEvent(qso, sourceAddr.String(), trace) {
+			continue
+		}
+
+		if msgType != formatter.MessageTypeRelay {
+			// Old QSOs first, before drift compensation moves them to now
+			if r.tooOld(qso, msgType, sourceAddr, trace) {
+				continue
+			}
+			r.compensateDrift(qso, msgType, sourceAddr, trace)
+		}
+		r.applyOverrides(qso, msgType, sourceAddr.IP)
+
+		// WSJT-X sends every logged QSO twice, in binary and in ADIF
+		if logged, binary := wsjtxLogged(record); logged && qso.Action == formatter.ActionLog {
+			r.pairWSJTX(qso, binary, msgType, sourceAddr.String(), origin, trace)
+			continue
+		}
+		r.complete(qso, msgType, sourceAddr.String(), origin, trace)
+	}
+}
+
+// complete fills in a parsed QSO from the rig, GPS, JTAlert, exchange lookup
+// and worked-before data, applies the field mappings, and delivers it or
+// holds it for review
+func (r *Relay) complete(qso *formatter.QSO, msgType formatter.MessageType, source, origin string, trace uint64) {
+	// Corrections and deletions carry the QSO as the logger now has it
+	if qso.Action == formatter.ActionLog {
+		r.fillFromRig(qso)
+		r.fillFromGPS(qso)
+		r.fillFromJTAlert(qso, msgType)
+		r.prefillExchange(qso)
+		r.annotateWorked(qso)
+	}
+	r.applyMappings(qso, msgType, sourceIP(source))
+
+	if qso.Action == formatter.ActionLog {
+		finish := func(q *formatter.QSO) { r.finish(q, msgType, source, origin, trace) }
+		if r.holdForReview(qso, finish) {
+			r.tracef(trace, "held for review")
+			return
+		}
+	}
+	r.finish(qso, msgType, source, origin, trace)
+}
+
+// finish delivers a completed QSO
+func (r *Relay) finish(qso *formatter.QSO, msgType formatter.MessageType, source, origin string, trace uint64) {
+	disposition := r.deliver(qso, msgType, source, origin)
+	r.tracef(trace, "%s", disposition)
+
+	// Nothing keeps a reference once the QSO has been delivered
+	if r.performanceEnabled() {
+		formatter.ReleaseQSO(qso)
+	}
+}
+
+// pairWSJTX merges the QSO Logged and Logged ADIF messages WSJT-X sends for
+// one QSO, so that it is forwarded once with the exchanges and comments only
+// the binary message has. A binary message that comes after its partner was
+// forwarded alone is sent as a correction of that QSO instead.
+func (r *Relay) pairWSJTX(qso *formatter.QSO, binary bool, msgType formatter.MessageType, source, origin string, trace uint64) {
+	callsign := qso.Callsign
+	deliver := func(q *formatter.QSO) { r.complete(q, msgType, source, origin, trace) }
+
+	result, partnerID := r.pairs.pair(source, qso, binary, deliver)
+	switch result {
+	case pairHeld:
+		r.tracef(trace, "holding QSO for up to %s for the other message WSJT-X sends for it", wsjtxPairWindow)
+	case pairMerged:
+		r.tracef(trace, "merged with the message WSJT-X sent earlier for this QSO")
+		if r.debug(logging.ModuleFormatter) {
+			log.Printf("Merged WSJT-X QSO Logged and Logged ADIF messages for %s", callsign)
+		}
+	case pairLate:
+		sent, ok := r.sent.get(partnerID)
+		if !ok || !sent.Merge(qso) {
+			r.tracef(trace, "dropped: the Logged ADIF message for this QSO was already forwarded")
+		} else {
+			sent.Action = formatter.ActionReplace
+			origin := "Late WSJT-X QSO Logged message from " + source
+			if _, err := r.deliverChange(&sent, msgType, source, origin); err != nil {
+				r.tracef(trace, "dropped: correction from the late QSO Logged message: %v", err)
+			} else {
+				r.tracef(trace, "sent as a correction of the QSO forwarded from its Logged ADIF message")
+			}
+		}
+		if r.performanceEnabled() {
+			formatter.ReleaseQSO(qso)
+		}
+	}
+}
+
+// messageType picks the parser for a message: the type pinned by the
+// listener, the relay envelope, auto-detection or the configured source type
+func (r *Relay) messageType(message string, pinned formatter.MessageType, trace uint64) formatter.MessageType {
+	switch {
+	case pinned != "":
+		r.tracef(trace, "type %s (pinned by listener)", pinned)
+		return pinned
+	case formatter.IsRelayEnvelope(message):
+		r.tracef(trace, "detected %s (relay envelope)", formatter.MessageTypeRelay)
+		return formatter.MessageTypeRelay
+	case r.config.Formatting.AutoDetect:
+		msgType, rule := r.formatter.Detect(message)
+		if rule == "" {
+			r.tracef(trace, "detected %s (no rule matched)", msgType)
+		} else {
+			r.tracef(trace, "detected %s (rule %s)", msgType, rule)
+		}
+		return msgType
+	default:
+		msgType := formatter.MessageType(r.config.Formatting.SourceType)
+		r.tracef(trace, "type %s (configured source type)", msgType)
+		return msgType
+	}
+}
+
+// deliver forwards a parsed QSO unless forwarding is paused. Once a target
+// has accepted it the QSO is journaled, archived and reported to APRS-IS.
+// The returned disposition says what became of it, for the trace.
+func (r *Relay) deliver(qso *formatter.QSO, msgType formatter.MessageType, source, origin string) (disposition string) {
+	if r.isPaused() {
+		r.stats.Dropped(dropPaused)
+		if r.debug(logging.ModuleSinks) {
+			log.Printf("Forwarding paused, dropping QSO with %s", qso.Callsign)
+		}
+		return "dropped: forwarding is paused"
+	}
+
+	if qso.Action == formatter.ActionSpot {
+		return r.deliverSpot(qso, msgType, origin)
+	}
+	if qso.Action != formatter.ActionLog {
+		sent, err := r.deliverChange(qso, msgType, source, origin)
+		if err != nil {
+			return "dropped: " + err.Error()
+		}
+		return fmt.Sprintf("%s forwarded to %d of %d targets", qso.Action, sent, len(r.currentTargets()))
+	}
+
+	// A repeat of a QSO already forwarded goes no further, or only to the
+	// targets that haven't had it
+	dupe, dedup := r.dedup.key(qso, msgType)
+	var perTarget *dedupKey
+	if dedup && dupe.rule.perTarget {
+		perTarget = dupe
+	} else if dedup && r.dedup.repeat(dupe, "") {
+		r.stats.Duplicate(string(msgType))
+		r.stats.Dropped(dropDuplicate)
+		return fmt.Sprintf("dropped: repeat of a QSO forwarded less than %s ago", dupe.rule.window)
+	}
+
+	// Every target sees the same ID, and chained QSOs keep the first relay's
+	if qso.ID == "" {
+		qso.ID = formatter.NewQSOID()
+	}
+	if qso.Operator == "" {
+		qso.Operator = r.dutyOperator()
+	}
+	r.score(qso)
+	r.number(qso)
+	sent, responses := r.forward(qso, msgType, origin, perTarget)
+	if perTarget != nil && perTarget.repeats > 0 {
+		r.stats.Duplicate(string(msgType))
+	}
+	if sent == 0 {
+		if perTarget != nil && perTarget.repeats > 0 {
+			r.stats.Dropped(dropDuplicate)
+			return fmt.Sprintf("dropped: the targets had this QSO less than %s ago", perTarget.rule.window)
+		}
+		if dedup && perTarget == nil {
+			r.dedup.forget(dupe, "")
+		}
+		return "dropped: no target accepted the QSO"
+	}
+	r.sent.apply(*qso)
+	r.stats.QSO(r.contact(qso))
+	r.turnRotator(qso)
+	r.announceBand(qso)
+	r.recordLatency(qso, msgType, source)
+
+	if r.journal != nil {
+		entry := journal.Entry{Time: time.Now().UTC(), Source: source, Type: msgType, QSO: *qso, Responses: responses}
+		if err := r.journal.Append(entry); err != nil {
+			log.Printf("Failed to write journal: %v", err)
 		}
-		return
 	}
+	r.markWorked(qso)
+	r.recordWorked(qso)
+	r.alertQSO(qso)
 
-	// Only log when packet is successfully received and relayed
-	log.Printf("UDP packet received (%d bytes) from %s and relayed to %s:%d (QSO: %s on %s %s)",
-		packetSize, sourceAddr, r.config.Target.Address, r.config.Target.Port,
-		qso.Callsign, qso.Band, qso.Mode)
+	if r.archive != nil {
+		if record, err := r.formatter.FormatADIF(qso); err == nil {
+			if err := r.archive.Append(record); err != nil {
+				log.Printf("Failed to write archive: %v", err)
+			}
+		}
+	}
+
+	if r.aprs != nil {
+		r.aprs.QSO(qso)
+	}
+	if r.serialPort != nil {
+		r.serialPort.QSO(qso, msgType)
+	}
+	r.publishQSO(qso, msgType, sent)
+	return fmt.Sprintf("forwarded to %d of %d targets", sent, len(r.currentTargets()))
+}
+
+// forward converts a QSO to each target's format and sends it. origin
+// describes where the QSO came from for the log line. With dupe set, targets
+// sent the QSO within its window are skipped and counted in dupe.repeats,
+// and the others are reserved before sending and released if it fails.
+// It returns the number of targets that accepted the QSO and the replies of
+// targets with a response timeout.
+func (r *Relay) forward(qso *formatter.QSO, msgType formatter.MessageType, origin string, dupe *dedupKey) (sent int, responses []journal.Response) {
+	what := "QSO"
+	switch qso.Action {
+	case formatter.ActionLog:
+	case formatter.ActionSpot:
+		what = "spot"
+	default:
+		what = "QSO " + string(qso.Action)
+	}
+
+	// The console replaces the log line per target with one line per QSO
+	console := r.currentConsole()
+	var statuses []logging.TargetStatus
+
+	station, operator := r.routing(qso)
+	targets := r.currentTargets()
+	routed := 0
+	for _, t := range targets {
+		if !t.routes(station, operator) {
+			continue
+		}
+		routed++
+		if dupe != nil && r.dedup.repeat(dupe, t.addr) {
+			dupe.repeats++
+			continue
+		}
+		report := formatter.ConvertSNRReports(qso, formatter.SNRReportStyle(t.config.SNRReports))
+		output, err := r.formatter.Format(report, t.format)
+		if err != nil && dupe != nil {
+			r.dedup.forget(dupe, t.addr)
+		}
+		var adifErr *formatter.ADIFError
+		if errors.As(err, &adifErr) {
+			// Strict ADIF: say what was wrong even without --verbose
+			log.Printf("Not sending %s to %s: %v", qso.Callsign, t.addr, err)
+			r.failures.Add(t.addr, string(msgType), err, adifErr.Record)
+			statuses = append(statuses, logging.TargetStatus{Name: t.addr, Err: err})
+			continue
+		}
+		if err != nil {
+			if r.debug(logging.ModuleFormatter) {
+				log.Printf("Failed to format message for %s: %v", t.addr, err)
+			}
+			continue
+		}
+
+		if t.config.ResponseTimeout > 0 && t.queue == nil {
+			var resp journal.Response
+			resp, err = r.sendAwaitingReply(t, output)
+			responses = append(responses, resp)
+			if resp.Status == journal.ResponseNone && err == nil && r.debug(logging.ModuleSinks) {
+				log.Printf("No reply from %s within %s", t.addr, t.config.ResponseTimeout)
+			}
+		} else {
+			err = r.sendMessage(t, output)
+		}
+		r.alertSend(t, err)
+		statuses = append(statuses, logging.TargetStatus{Name: t.addr, Err: err})
+		if err != nil {
+			if dupe != nil {
+				r.dedup.forget(dupe, t.addr)
+			}
+			r.stats.TargetFailed(t.addr)
+			log.Printf("Failed to relay packet to %s: %v", t.addr, err)
+			continue
+		}
+		r.stats.Forwarded(t.addr)
+		sent++
+
+		// Only log when packet is successfully received and relayed
+		if console == nil {
+			log.Printf("%s and relayed to %s (%s: %s on %s %s)",
+				origin, t.addr, what, qso.Callsign, qso.Band, qso.Mode)
+		}
+
+		if r.debug(logging.ModuleSinks) {
+			log.Printf("%s message sent: %s", t.format, output)
+		}
+	}
+	if routed == 0 && len(targets) > 0 {
+		r.stats.Dropped(dropNoRoute)
+		log.Printf("%s: no target takes %s made under %s by %s", origin, what, station, operator)
+	}
+
+	if console != nil {
+		line := logging.ConsoleQSO{Time: time.Now(), Callsign: qso.Callsign, Band: qso.Band, Mode: qso.Mode, Source: string(msgType), Targets: statuses}
+		if qso.Action != formatter.ActionLog {
+			line.What = string(qso.Action)
+		}
+		console.QSO(line)
+	}
+	return sent, responses
+}
+
+// tailWinlink follows the Winlink Express session logs and relays each
+// completed session until ctx is cancelled
+func (r *Relay) tailWinlink(ctx context.Context) {
+	defer r.wg.Done()
 
-	if r.config.Verbose {
-		log.Printf("N1MM message sent: %s", n1mmMessage)
+	cfg := r.config.Winlink
+	if r.debug(logging.ModuleRelay) {
+		log.Printf("Watching Winlink session logs: %s", strings.Join(cfg.LogFiles, ", "))
 	}
+
+	tailer := winlink.NewTailer(cfg.LogFiles, cfg.Mode, cfg.PollInterval, func(qso *formatter.QSO) {
+		r.stats.Received(string(formatter.MessageTypeWinlink))
+		if err := r.formatter.Normalize(qso); err != nil {
+			r.stats.ParseFailed(failureReason(err))
+			r.alertParseFailed()
+			if r.debug(logging.ModuleFormatter) {
+				log.Printf("Skipping Winlink session: %v", err)
+			}
+			return
+		}
+		r.applyOverrides(qso, formatter.MessageTypeWinlink, nil)
+		r.complete(qso, formatter.MessageTypeWinlink, "winlink", "Winlink session logged", 0)
+	})
+	tailer.Run(ctx)
 }
 
-// sendMessage sends a message to the target UDP address
-func (r *Relay) sendMessage(message string) error {
-	_, err := r.sender.Write([]byte(message))
+// sendMessage sends a message to a target UDP address. Targets with a send
+// queue only enqueue it; write errors are then logged by the sender.
+func (r *Relay) sendMessage(t *target, message string) error {
+	if t.queue != nil {
+		if !t.enqueue(message) {
+			return fmt.Errorf("send queue full (%d messages)", cap(t.queue))
+		}
+		return nil
+	}
+	_, err := t.conn.Write([]byte(message))
 	return err
 }
 
@@ -264,9 +1475,38 @@ func (r *Relay) GetStats() map[string]interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	return map[string]interface{}{
+	targets := make([]string, 0, len(r.targets))
+	for _, t := range r.targets {
+		targets = append(targets, t.addr)
+	}
+
+	stats := map[string]interface{}{
 		"running":     r.running,
+		"paused":      r.paused,
+		"verbose":     r.levels.AnyDebug(),
+		"log_levels":  r.levels.Map(),
 		"listen_addr": fmt.Sprintf("%s:%d", r.config.Listen.Address, r.config.Listen.Port),
 		"target_addr": fmt.Sprintf("%s:%d", r.config.Target.Address, r.config.Target.Port),
+		"targets":     targets,
 	}
+
+	snap := r.stats.Snapshot()
+	stats["stats"] = snap
+	if r.auth != nil {
+		stats["auth_rejected_unsigned"] = snap.Dropped[dropAuthUnsigned]
+		stats["auth_rejected_invalid"] = snap.Dropped[dropAuthInvalid]
+	}
+
+	return stats
+}
+
+// Stats returns the relay's counters and rates
+func (r *Relay) Stats() stats.Snapshot {
+	return r.stats.Snapshot()
+}
+
+// ParseFailures returns the most recent messages that failed to parse,
+// oldest first
+func (r *Relay) ParseFailures() []stats.Failure {
+	return r.failures.List()
 }
@@ -0,0 +1,93 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+)
+
+// Most targets never answer, so QSOs are sent and forgotten. Some loggers
+// answer each datagram with an acknowledgement or an error, though; for a
+// target with target.response_timeout set, the relay waits for the reply to
+// each QSO, counts an error reply as a failed send, and records the reply in
+// the journal and stats.
+
+// defaultResponseError matches replies that report a problem
+var defaultResponseError = regexp.MustCompile(`(?i)\b(err(or)?|fail(ed|ure)?|reject(ed)?|invalid|denied|refused|nak|dupe)\b`)
+
+// responseDrain is how long to wait for late replies to earlier QSOs before
+// sending the next one, so they are not taken for its reply
+const responseDrain = time.Millisecond
+
+// responseError compiles a target's response_error, or returns the default
+func responseError(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return defaultResponseError, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response_error %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// sendAwaitingReply sends a message to a target with a response timeout and
+// reads its reply. err is set when the send fails or the reply is an error.
+func (r *Relay) sendAwaitingReply(t *target, message string) (journal.Response, error) {
+	resp := journal.Response{Target: t.addr, Status: journal.ResponseNone}
+	var conn *net.UDPConn
+	switch c := t.conn.(type) {
+	case *net.UDPConn:
+		conn = c
+	case *framedConn:
+		conn = c.UDPConn
+	default:
+		// Validation keeps response_timeout to UDP targets
+		return resp, r.sendMessage(t, message)
+	}
+
+	// Workers share the connection; one QSO at a time, so replies match up
+	t.replyMu.Lock()
+	defer t.replyMu.Unlock()
+
+	buffer := make([]byte, maxBufferSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(responseDrain))
+		if _, err := conn.Read(buffer); err != nil {
+			break
+		}
+	}
+
+	if _, err := t.conn.Write([]byte(message)); err != nil {
+		return resp, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(t.config.ResponseTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	n, err := conn.Read(buffer)
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return resp, nil
+	case err != nil:
+		// Typically ICMP port unreachable: nothing is listening
+		resp.Status = journal.ResponseError
+		resp.Reply = err.Error()
+		return resp, err
+	}
+
+	resp.Reply = strings.TrimSpace(string(buffer[:n]))
+	if t.replyError.MatchString(resp.Reply) {
+		resp.Status = journal.ResponseError
+		r.stats.Replied(t.addr, false)
+		return resp, fmt.Errorf("rejected: %s", resp.Reply)
+	}
+	resp.Status = journal.ResponseOK
+	r.stats.Replied(t.addr, true)
+	return resp, nil
+}
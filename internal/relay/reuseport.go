@@ -0,0 +1,32 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// ListenUDP binds a UDP socket. With reusePort it sets SO_REUSEADDR and,
+// where the platform has it, SO_REUSEPORT first, so the relay can share the
+// port with another program that does the same.
+func ListenUDP(address string, reusePort bool) (*net.UDPConn, error) {
+	if !reusePort {
+		udpAddr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			return nil, err
+		}
+		return net.ListenUDP("udp", udpAddr)
+	}
+
+	lc := net.ListenConfig{Control: reuseControl}
+	conn, err := lc.ListenPacket(context.Background(), "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected socket type %T", conn)
+	}
+	return udpConn, nil
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package relay
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// reuseControl fails: sharing a port isn't supported on this platform
+func reuseControl(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("reuse_port is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+)
+
+// holdForReview puts a QSO in the review queue, to be passed to finish once
+// the operator releases it or its timeout passes. It reports false when
+// review is off or the relay is stopping, and the caller delivers the QSO.
+func (r *Relay) holdForReview(qso *formatter.QSO, finish func(*formatter.QSO)) bool {
+	if r.review == nil {
+		return false
+	}
+	// The ID names the QSO in the queue and stays with it when forwarded
+	if qso.ID == "" {
+		qso.ID = formatter.NewQSOID()
+	}
+	p, ok := r.review.Hold(qso, finish)
+	if !ok {
+		return false
+	}
+	// The queue owns the QSO now and may forward it at any moment, so only
+	// the copy it returned is read from here on
+
+	until := "until released"
+	if p.ForwardAt != nil {
+		until = "until " + p.ForwardAt.Format("15:04:05")
+	}
+	log.Printf("Holding QSO #%d for review %s: %s on %s %s, exchange %q",
+		p.Number, until, p.QSO.Callsign, p.QSO.Band, p.QSO.Mode, p.QSO.Exchange)
+	return true
+}
+
+// PendingQSOs returns the QSOs held for review, oldest first
+func (r *Relay) PendingQSOs() []review.Pending {
+	if r.review == nil {
+		return []review.Pending{}
+	}
+	return r.review.List()
+}
+
+// ForwardPending forwards a QSO held for review, named by ID or number. A
+// corrected QSO is forwarded in its place. The QSO as forwarded is returned.
+func (r *Relay) ForwardPending(ref string, corrected *formatter.QSO) (formatter.QSO, error) {
+	if r.review == nil {
+		return formatter.QSO{}, fmt.Errorf("%w: review is not enabled", review.ErrNotHeld)
+	}
+	qso, err := r.review.Release(ref, corrected)
+	if err == nil && corrected != nil {
+		log.Printf("QSO with %s corrected in review", qso.Callsign)
+	}
+	return qso, err
+}
+
+// DiscardPending drops a QSO held for review, named by ID or number,
+// without forwarding it
+func (r *Relay) DiscardPending(ref string) (formatter.QSO, error) {
+	if r.review == nil {
+		return formatter.QSO{}, fmt.Errorf("%w: review is not enabled", review.ErrNotHeld)
+	}
+	qso, err := r.review.Discard(ref)
+	if err == nil {
+		log.Printf("Discarded QSO with %s held for review", qso.Callsign)
+	}
+	return qso, err
+}
+
+// notHeld reports whether err says a relay doesn't hold the QSO, so the
+// next relay should be asked
+func notHeld(err error) bool {
+	return errors.Is(err, review.ErrNotHeld)
+}
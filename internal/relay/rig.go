@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/rigctl"
+)
+
+// fillFromRig completes a QSO that arrived without a frequency or mode
+// using what rigctld last reported for the radio
+func (r *Relay) fillFromRig(qso *formatter.QSO) {
+	if r.rig == nil {
+		return
+	}
+	state, ok := r.rig.State()
+	if !ok {
+		return
+	}
+
+	if qso.Hz() == 0 {
+		qso.FrequencyHz = state.FrequencyHz
+		qso.Frequency = formatter.FormatMHz(state.FrequencyHz)
+		if qso.Band == "" || qso.Band == "UNK" {
+			qso.Band = formatter.FrequencyToBand(float64(state.FrequencyHz) / 1e6)
+		}
+		if r.debug(logging.ModuleEnrichment) {
+			log.Printf("Frequency for %s taken from the radio: %s MHz", qso.Callsign, qso.Frequency)
+		}
+	}
+	if qso.Mode == "" {
+		qso.Mode = state.LogMode()
+	}
+}
+
+// sendRadioInfo tells the N1MM targets the radio's new frequency and mode
+func (r *Relay) sendRadioInfo(state rigctl.State) {
+	// A band change seen here needn't be announced again by the next QSO
+	r.band.moved(formatter.FrequencyToBand(float64(state.FrequencyHz) / 1e6))
+	r.broadcastRadioInfo(state.FrequencyHz, state.RadioMode())
+}
+
+// broadcastRadioInfo sends a RadioInfo message to the N1MM targets
+func (r *Relay) broadcastRadioInfo(hz int64, mode string) {
+	message, err := r.formatter.FormatRadioInfo(hz, mode)
+	if err != nil {
+		log.Printf("Failed to format RadioInfo: %v", err)
+		return
+	}
+
+	for _, t := range r.currentTargets() {
+		if t.format != formatter.OutputFormatN1MM {
+			continue
+		}
+		if err := r.sendMessage(t, message); err != nil {
+			log.Printf("Failed to send RadioInfo to %s: %v", t.addr, err)
+			continue
+		}
+		if r.debug(logging.ModuleSinks) {
+			log.Printf("RadioInfo sent to %s: %s %s", t.addr, formatter.FormatMHz(hz), mode)
+		}
+	}
+}
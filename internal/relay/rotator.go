@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/qsomap"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// turnRotator points the antenna at a logged QSO's grid square, from its
+// own grid (e.g. from GPS) or the station's
+func (r *Relay) turnRotator(qso *formatter.QSO) {
+	if r.rotator == nil || qso.Action != formatter.ActionLog {
+		return
+	}
+	from := qso.MyGrid
+	if from == "" {
+		from = r.stationGrid()
+	}
+	r.turnToward(from, qso.Grid, qso.Band, qso.Callsign)
+}
+
+// trackRotator turns the antenna as soon as WSJT-X starts working a station
+// whose grid it has decoded, before the QSO is logged
+func (r *Relay) trackRotator(data []byte) {
+	if r.rotator == nil || !r.config.Rotator.InProgress {
+		return
+	}
+	status, ok := wsjtx.ParseStatus(data)
+	if !ok || status.DXCall == "" || status.DXGrid == "" {
+		return
+	}
+	band := ""
+	if status.DialFrequency > 0 {
+		band = formatter.FrequencyToBand(float64(status.DialFrequency) / 1e6)
+	}
+	r.turnToward(r.stationGrid(), status.DXGrid, band, status.DXCall)
+}
+
+// stationGrid returns where the station is: the GPS fix if there is one,
+// otherwise control.grid
+func (r *Relay) stationGrid() string {
+	if r.gps != nil {
+		if fix, ok := r.gps.Fix(); ok {
+			return fix.Grid
+		}
+	}
+	return r.config.Control.Grid
+}
+
+// turnToward asks the rotator for the heading from one grid to another.
+// Grids that can't be placed leave the antenna where it is.
+func (r *Relay) turnToward(fromGrid, toGrid, band, call string) {
+	from, ok := qsomap.Position(fromGrid)
+	if !ok {
+		return
+	}
+	to, ok := qsomap.Position(toGrid)
+	if !ok {
+		return
+	}
+	azimuth := qsomap.Bearing(from, to)
+	if r.rotator.Turn(azimuth, band) && r.debug(logging.ModuleSinks) {
+		log.Printf("Rotator: turning to %.0f° for %s (%s)", azimuth, call, toGrid)
+	}
+}
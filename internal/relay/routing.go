@@ -0,0 +1,46 @@
+package relay
+
+import (
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// routes reports whether a target takes QSOs made under station by
+// operator. Targets without my_calls or operators take every QSO.
+func (t *target) routes(station, operator string) bool {
+	return matchesAny(t.config.MyCalls, station) && matchesAny(t.config.Operators, operator)
+}
+
+// matchesAny reports whether value is one of calls, ignoring case; an empty
+// list matches anything
+func matchesAny(calls []string, value string) bool {
+	if len(calls) == 0 {
+		return true
+	}
+	for _, call := range calls {
+		if strings.EqualFold(strings.TrimSpace(call), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// routing returns the station call a QSO was made under and its operator,
+// as target routes match them: the call the source logged it under, else
+// the per-source or configured station, and the QSO's operator, else the
+// one on duty
+func (r *Relay) routing(qso *formatter.QSO) (station, operator string) {
+	station = qso.MyCall
+	if station == "" {
+		station = qso.Station
+	}
+	if station == "" {
+		station = r.config.Formatting.N1MM.Station
+	}
+	operator = qso.Operator
+	if operator == "" {
+		operator = r.Operator()
+	}
+	return station, operator
+}
@@ -0,0 +1,60 @@
+package relay
+
+import (
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/serial"
+)
+
+// score fills in where the worked station is from the country file and,
+// with scoring.contest set, the points and multipliers the QSO is worth.
+// Every QSO scored counts as worked, so score only QSOs being forwarded.
+func (r *Relay) score(qso *formatter.QSO) {
+	if r.cty != nil {
+		if entity, ok := r.cty.Lookup(qso.Callsign); ok {
+			qso.CountryPrefix = entity.Prefix
+			qso.Continent = entity.Continent
+			qso.CQZone = entity.CQZone
+		}
+	}
+
+	if r.scorer == nil {
+		return
+	}
+	score := r.scorer.Score(r.stationCall(qso), qso)
+	qso.Points = score.Points
+	qso.IsMult1, qso.IsMult2, qso.IsMult3 = score.Mults[0], score.Mults[1], score.Mults[2]
+}
+
+// number gives the QSO the next sent serial number when its contest has a
+// serial exchange. A serial the source or an earlier relay sent is kept.
+func (r *Relay) number(qso *formatter.QSO) {
+	if r.serials == nil || qso.SerialSent > 0 {
+		return
+	}
+	if r.config.Serial.Mode == "auto" && !serial.Required(r.contestName(qso)) {
+		return
+	}
+	n, err := r.serials.Next()
+	if err != nil {
+		log.Printf("Failed to save serial number %d: %v", n, err)
+	}
+	qso.SerialSent = n
+}
+
+// contestName returns the contest the QSO was logged in
+func (r *Relay) contestName(qso *formatter.QSO) string {
+	if qso.Contest != "" {
+		return qso.Contest
+	}
+	return r.config.Formatting.N1MM.Contest
+}
+
+// stationCall returns the call the QSO was made with
+func (r *Relay) stationCall(qso *formatter.QSO) string {
+	if qso.Station != "" {
+		return qso.Station
+	}
+	return r.config.Formatting.N1MM.Station
+}
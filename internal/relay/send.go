@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+)
+
+// SendResult is what became of one record of a message given to Send
+type SendResult struct {
+	Type formatter.MessageType
+	QSO  *formatter.QSO // nil when the record could not be parsed
+	Sent int            // Targets that accepted the QSO
+	Err  error
+
+	// Replies of targets with a response timeout
+	Responses []journal.Response
+}
+
+// Send runs a raw source message through detection, parsing and formatting
+// and sends each QSO in it once to the configured targets, for scripting and
+// for checking that N1MM receives what the relay sends. pinned forces the
+// source type like a listener's source_type; source names where the message
+// came from in the log. Send must not be used while the relay is running,
+// and nothing is journaled, archived or recorded as worked.
+func (r *Relay) Send(message []byte, pinned formatter.MessageType, source string) ([]SendResult, error) {
+	if len(message) > formatter.MaxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes is more than a datagram can carry", formatter.ErrMessageTooLarge, len(message))
+	}
+
+	var targets []*target
+	for _, tc := range r.config.AllTargets() {
+		t, err := r.dialTarget(tc)
+		if err != nil {
+			closeTargets(targets)
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	r.mu.Lock()
+	r.targets = targets
+	r.mu.Unlock()
+	defer closeTargets(targets)
+
+	text := string(message)
+	msgType := r.messageType(text, pinned, 0)
+	if msgType == formatter.MessageTypeJTAlert && formatter.IsJTAlertStation(text) {
+		return nil, fmt.Errorf("jtalert station message, not a QSO")
+	}
+
+	origin := "Message read from " + source
+	var results []SendResult
+	for _, record := range formatter.SplitRecords(text) {
+		result := SendResult{Type: msgType}
+		qso, err := r.formatter.ParseMessage(record, msgType)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		r.applyOverrides(qso, msgType, net.IPv4(127, 0, 0, 1))
+		if qso.ID == "" {
+			qso.ID = formatter.NewQSOID()
+		}
+		result.QSO = qso
+		if result.Sent, result.Responses = r.forward(qso, msgType, origin, nil); result.Sent == 0 {
+			result.Err = fmt.Errorf("no target accepted the QSO")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,38 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+)
+
+// keepEvent applies formatting.varac.events to a VarAC beacon, ping or CQ.
+// It reports whether the event should be forwarded as a spot; otherwise it
+// has been dropped, and counted unless the setting is drop.
+func (r *Relay) keepEvent(qso *formatter.QSO, source string, trace uint64) bool {
+	switch r.config.Formatting.VarAC.Events {
+	case "spot":
+		return true
+	case "drop":
+		r.tracef(trace, "dropped: VarAC %s from %s", qso.Event, qso.Callsign)
+	default:
+		r.stats.Dropped("varac_" + qso.Event)
+		r.tracef(trace, "dropped: VarAC %s from %s (counted)", qso.Event, qso.Callsign)
+		if r.debug(logging.ModuleFormatter) {
+			log.Printf("Dropping VarAC %s from %s (%s)", qso.Event, qso.Callsign, source)
+		}
+	}
+	return false
+}
+
+// deliverSpot forwards a spot to the targets that can carry one. Spots are
+// not QSOs, so they are neither journaled nor counted as QSOs.
+func (r *Relay) deliverSpot(qso *formatter.QSO, msgType formatter.MessageType, origin string) (disposition string) {
+	sent, _ := r.forward(qso, msgType, origin, nil)
+	if sent == 0 {
+		return "dropped: no target accepted the spot"
+	}
+	return fmt.Sprintf("spot forwarded to %d of %d targets", sent, len(r.currentTargets()))
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/wsjtx"
+)
+
+// Reasons datagrams and QSOs are dropped, as counted in the stats
+const (
+	dropTruncated      = "truncated"
+	dropUnexpectedPort = "unexpected_port"
+	dropPaused         = "paused"
+	dropAuthUnsigned   = "auth_unsigned"
+	dropAuthInvalid    = "auth_invalid"
+	dropRelayLoop      = "relay_loop"
+	dropKernel         = "kernel_buffer_full"
+	dropTooOld         = "too_old"
+	dropNoRoute        = "no_route"
+	dropJS8Message     = "js8call_message"
+	dropJS8Heartbeat   = "js8call_heartbeat"
+)
+
+// failureReason reduces a parse error to a stable reason for the counters
+// by dropping the message-specific detail after the first colon or quote
+func failureReason(err error) string {
+	reason := err.Error()
+	if i := strings.IndexAny(reason, `:"`); i > 0 {
+		reason = reason[:i]
+	}
+	return strings.TrimSpace(reason)
+}
+
+// wsjtxChatter reports whether a message is one of the WSJT-X protocol
+// messages that never carry a QSO (heartbeats, status, decodes, ...). They
+// fail to parse many times a minute and would push the failures worth
+// reporting out of the sample buffer.
+func wsjtxChatter(message string) bool {
+	h, ok := wsjtx.ParseHeader([]byte(message))
+	return ok && h.Type != wsjtx.MessageQSOLogged && h.Type != wsjtx.MessageLoggedADIF
+}
+
+// contact describes a delivered QSO for the rate meter. WPX prefixes are
+// always counted as multipliers, DXCC entities when a country file is loaded.
+func (r *Relay) contact(qso *formatter.QSO) stats.Contact {
+	c := stats.Contact{
+		Band:  qso.Band,
+		Mode:  qso.Mode,
+		Mults: map[string]string{"wpx": formatter.WPXPrefix(qso.Callsign)},
+	}
+	if r.cty != nil {
+		if entity, ok := r.cty.Entity(qso.Callsign); ok {
+			c.Mults["dxcc"] = entity
+		}
+	}
+	return c
+}
+
+// recordLatency measures how long after its own timestamp a delivered QSO
+// was forwarded, counts it in the stats and warns when it exceeds
+// stats.latency_warn. QSOs restamped with the receive time say nothing about
+// the source and are skipped. Sources that log whole minutes only (fldigi's
+// HHMM times) read up to a minute high.
+func (r *Relay) recordLatency(qso *formatter.QSO, msgType formatter.MessageType, source string) {
+	if qso.DateTime.IsZero() || r.config.Formatting.Time.UseReceiveTime {
+		return
+	}
+
+	latency := time.Since(qso.DateTime)
+	r.stats.Latency(string(msgType), latency)
+
+	latency = latency.Round(100 * time.Millisecond)
+	if warn := r.config.Stats.LatencyWarn; warn > 0 && latency > warn {
+		log.Printf("Warning: QSO with %s from %s (%s) forwarded %s after its timestamp (latency_warn %s)",
+			qso.Callsign, source, msgType, latency, warn)
+	} else if r.debug(logging.ModuleSinks) {
+		log.Printf("QSO with %s forwarded %s after its timestamp", qso.Callsign, latency)
+	}
+}
+
+// saveStats saves the counters every save interval until ctx is cancelled.
+// Run saves them once more after shutdown.
+func (r *Relay) saveStats(ctx context.Context) {
+	defer r.wg.Done()
+
+	interval := r.config.Stats.SaveInterval
+	if r.config.Stats.Path == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.stats.Save(); err != nil {
+				log.Printf("Failed to save stats: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Framing is how messages are delimited on a stream, which unlike a UDP
+// socket does not keep them apart
+type Framing string
+
+const (
+	// FramingLine puts one message on each line, as chain connections and
+	// TCP targets do. It suits the text formats; empty lines are skipped.
+	FramingLine Framing = "line"
+
+	// FramingLength puts a 4-byte big-endian length before each message,
+	// for binary WSJT-X messages and multi-line records
+	FramingLength Framing = "length"
+
+	// FramingCOBS encodes each message with COBS and ends it with a zero
+	// byte, for serial bridges and other byte streams a reader may join
+	// part way through
+	FramingCOBS Framing = "cobs"
+)
+
+// ValidFraming reports whether f names a framing
+func ValidFraming(f string) bool {
+	switch Framing(strings.ToLower(f)) {
+	case FramingLine, FramingLength, FramingCOBS:
+		return true
+	}
+	return false
+}
+
+// appendFrame appends message to dst in a frame
+func appendFrame(dst []byte, framing Framing, message []byte) []byte {
+	switch framing {
+	case FramingLength:
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(message)))
+		return append(dst, message...)
+	case FramingCOBS:
+		return append(cobsEncode(dst, message), 0)
+	}
+	return append(append(dst, message...), '\n')
+}
+
+// Stream is a reader and writer the relay runs its pipeline over in place of
+// sockets: standard input and output, a file, a pipe or an in-memory buffer
+type Stream struct {
+	In      io.Reader
+	Out     io.Writer
+	InName  string                 // Names In in log messages, e.g. "standard input"
+	OutName string                 // Names Out in log messages
+	Framing Framing                // Empty means FramingLine
+	Format  formatter.OutputFormat // Empty means target.format
+}
+
+// RunStream relays the messages read from s.In to s.Out until s.In ends or
+// ctx is cancelled. Messages go through the same detection, parsing, pairing
+// and formatting as datagrams and are processed in order. The configured
+// listeners, targets, bridge and chain are not opened; the journal, archive
+// and worked-before database are used as in Run. If s.In is an io.Closer it
+// is closed when ctx is cancelled, so a blocked read returns.
+func (r *Relay) RunStream(ctx context.Context, s Stream) error {
+	framing := Framing(strings.ToLower(string(s.Framing)))
+	if framing == "" {
+		framing = FramingLine
+	}
+	if !ValidFraming(string(framing)) {
+		return fmt.Errorf("unknown framing %q", s.Framing)
+	}
+	format := s.Format
+	if format == "" {
+		format = formatter.OutputFormat(r.config.Target.Format)
+	}
+	if !formatter.ValidOutputFormat(string(format)) {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	name, outName := s.InName, s.OutName
+	if name == "" {
+		name = "input"
+	}
+	if outName == "" {
+		outName = "output"
+	}
+
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return fmt.Errorf("relay is already running")
+	}
+	r.running = true
+	r.targets = []*target{{addr: outName, format: format, conn: &frameWriter{w: s.Out, framing: framing}}}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	if err := r.openState(); err != nil {
+		r.closeConnections()
+		return err
+	}
+	r.readyOnce.Do(func() { close(r.ready) })
+
+	if c, ok := s.In.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer stop()
+	}
+
+	// Streams have no sender address; the messages count as local
+	source := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	err := readFrames(s.In, framing, func(message []byte) {
+		trace := r.traceDatagram(message, source)
+		origin := fmt.Sprintf("Message read (%d bytes) from %s", len(message), name)
+		r.processMessage(job{message: string(message), addr: source, size: len(message), trusted: true, trace: trace, origin: origin})
+	})
+	if ctx.Err() != nil {
+		err = nil
+	}
+
+	// Held QSOs are written out now rather than after their review timeout
+	r.pairs.close()
+	if r.review != nil {
+		r.review.Close()
+	}
+	r.wg.Wait()
+	r.closeConnections()
+
+	if saveErr := r.stats.Save(); saveErr != nil {
+		log.Printf("Failed to save stats: %v", saveErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read from %s: %w", name, err)
+	}
+	return nil
+}
+
+// readFrames calls fn with each message read from in until it ends
+func readFrames(in io.Reader, framing Framing, fn func([]byte)) error {
+	if framing == FramingCOBS {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 4096), maxBufferSize)
+		scanner.Split(splitCOBS)
+		for scanner.Scan() {
+			// Empty frames only separate messages
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			message, err := cobsDecode(scanner.Bytes())
+			if err != nil {
+				return err
+			}
+			fn(message)
+		}
+		if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+			return fmt.Errorf("COBS frame is larger than %d bytes", maxBufferSize)
+		}
+		return scanner.Err()
+	}
+
+	if framing == FramingLength {
+		reader := bufio.NewReader(in)
+		var size uint32
+		for {
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if size > maxBufferSize {
+				return fmt.Errorf("%d-byte message is larger than %d bytes", size, maxBufferSize)
+			}
+			message := make([]byte, size)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				return err
+			}
+			fn(message)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 4096), maxBufferSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if len(line) > 0 {
+			fn(append([]byte(nil), line...))
+		}
+	}
+	return scanner.Err()
+}
+
+// ADIFRecords reads an ADIF file as line framed messages: the header is
+// left out and each record, over however many lines it spans, becomes one
+// line. Line breaks inside a record turn into spaces, which keeps the
+// lengths of multi-line values right.
+func ADIFRecords(in io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeADIFRecords(pw, in))
+	}()
+	return pr
+}
+
+// writeADIFRecords writes the records of the ADIF file in to w, one per line
+func writeADIFRecords(w io.Writer, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 4096), maxBufferSize)
+	scanner.Split(splitADIFRecord)
+	first := true
+	for scanner.Scan() {
+		record := scanner.Bytes()
+		if first {
+			first = false
+			if i := indexFold(record, "<eoh>"); i >= 0 {
+				record = record[i+len("<eoh>"):]
+			}
+		}
+		line := strings.Map(func(c rune) rune {
+			if c == '\r' || c == '\n' {
+				return ' '
+			}
+			return c
+		}, string(record))
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// splitADIFRecord is a bufio.SplitFunc that ends each token after <EOR>
+func splitADIFRecord(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := indexFold(data, "<eor>"); i >= 0 {
+		end := i + len("<eor>")
+		return end, data[:end], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// indexFold returns the index of the first ASCII-case-insensitive match of
+// tag in data, or -1
+func indexFold(data []byte, tag string) int {
+	for i := 0; i+len(tag) <= len(data); i++ {
+		if data[i] == '<' && strings.EqualFold(string(data[i:i+len(tag)]), tag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// frameWriter writes each message to w in a frame. Held WSJT-X QSOs are
+// delivered from timers, so writes are serialized.
+type frameWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	framing Framing
+}
+
+// Write writes one message
+func (f *frameWriter) Write(message []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	frame := appendFrame(make([]byte, 0, len(message)+len(message)/254+4), f.framing, message)
+	if _, err := f.w.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
+
+// Close does nothing; the writer belongs to the caller
+func (f *frameWriter) Close() error {
+	return nil
+}
+
+// WriteFrame writes one message to w in a frame, for feeding RunStream
+func WriteFrame(w io.Writer, framing Framing, message []byte) error {
+	_, err := (&frameWriter{w: w, framing: framing}).Write(message)
+	return err
+}
+
+// framedConn sends each message to a UDP target in a frame, for consumers
+// that join the datagrams into a stream
+type framedConn struct {
+	*net.UDPConn
+	framing Framing
+}
+
+// Write sends one message as a single datagram
+func (c *framedConn) Write(message []byte) (int, error) {
+	frame := appendFrame(make([]byte, 0, len(message)+len(message)/254+4), c.framing, message)
+	if _, err := c.UDPConn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
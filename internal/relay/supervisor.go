@@ -0,0 +1,228 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+)
+
+// Supervisor runs the main relay together with the pipelines of its
+// configuration, each an independent relay with its own listeners, targets
+// and formatting. It is controlled like the main relay: counters, parse
+// failures, pause, log levels, the operator on duty and the review queue cover
+// every pipeline, as does the event stream; the rest of the control API acts
+// on the main relay only.
+type Supervisor struct {
+	*Relay
+	pipelines []*Relay
+	ready     chan struct{}
+}
+
+// NewSupervisor creates the main relay and one relay per enabled pipeline
+func NewSupervisor(cfg *config.Config) (*Supervisor, error) {
+	primary, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Supervisor{Relay: primary, ready: make(chan struct{})}
+	for _, pc := range cfg.PipelineConfigs {
+		r, err := New(pc)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", pc.Name, err)
+		}
+		r.events = primary.events
+		s.pipelines = append(s.pipelines, r)
+	}
+	return s, nil
+}
+
+// relays returns the main relay followed by the pipelines
+func (s *Supervisor) relays() []*Relay {
+	return append([]*Relay{s.Relay}, s.pipelines...)
+}
+
+// Pipeline returns the relay of the named pipeline, or nil
+func (s *Supervisor) Pipeline(name string) *Relay {
+	for _, r := range s.pipelines {
+		if r.config.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Run runs every relay until ctx is cancelled. When one fails the others
+// are stopped and its error returned.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	relays := s.relays()
+	errChan := make(chan error, len(relays))
+	for _, r := range relays {
+		go func(r *Relay) {
+			err := r.Run(ctx)
+			if err != nil {
+				if r.config.Name != "" {
+					err = fmt.Errorf("pipeline %s: %w", r.config.Name, err)
+				}
+				cancel()
+			}
+			errChan <- err
+		}(r)
+	}
+
+	go func() {
+		for _, r := range relays {
+			select {
+			case <-r.Ready():
+			case <-ctx.Done():
+				return
+			}
+		}
+		close(s.ready)
+	}()
+
+	var firstErr error
+	for range relays {
+		if err := <-errChan; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Ready returns a channel that is closed once every relay is listening
+func (s *Supervisor) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// GetStats returns the main relay's status with each pipeline's under
+// "pipelines"
+func (s *Supervisor) GetStats() map[string]interface{} {
+	status := s.Relay.GetStats()
+	if len(s.pipelines) > 0 {
+		pipelines := make(map[string]interface{}, len(s.pipelines))
+		for _, r := range s.pipelines {
+			pipelines[r.config.Name] = r.GetStats()
+		}
+		status["pipelines"] = pipelines
+	}
+	return status
+}
+
+// Stats returns the main relay's counters with each pipeline's
+func (s *Supervisor) Stats() stats.Snapshot {
+	snap := s.Relay.Stats()
+	if len(s.pipelines) > 0 {
+		snap.Pipelines = make(map[string]stats.Snapshot, len(s.pipelines))
+		for _, r := range s.pipelines {
+			snap.Pipelines[r.config.Name] = r.Stats()
+		}
+	}
+	return snap
+}
+
+// ParseFailures returns the recent parse failures of every relay, oldest
+// first. A pipeline's failures have its name before the source address.
+func (s *Supervisor) ParseFailures() []stats.Failure {
+	failures := s.Relay.ParseFailures()
+	for _, r := range s.pipelines {
+		for _, f := range r.ParseFailures() {
+			f.Source = r.config.Name + "/" + f.Source
+			failures = append(failures, f)
+		}
+	}
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Time.Before(failures[j].Time)
+	})
+	return failures
+}
+
+// SetVerbose turns verbose logging on or off for every relay
+func (s *Supervisor) SetVerbose(verbose bool) {
+	for _, r := range s.relays() {
+		r.SetVerbose(verbose)
+	}
+}
+
+// SetLogLevels changes module log levels on every relay
+func (s *Supervisor) SetLogLevels(levels map[string]string) error {
+	for _, r := range s.relays() {
+		if err := r.SetLogLevels(levels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetConsole shows the QSOs of every relay on c
+func (s *Supervisor) SetConsole(c *logging.Console) {
+	for _, r := range s.relays() {
+		r.SetConsole(c)
+	}
+}
+
+// Pause stops forwarding QSOs on every relay
+func (s *Supervisor) Pause() {
+	for _, r := range s.relays() {
+		r.Pause()
+	}
+}
+
+// SetOperator sets the operator on duty on every relay
+func (s *Supervisor) SetOperator(call string) error {
+	for _, r := range s.relays() {
+		if err := r.SetOperator(call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingQSOs returns the QSOs every relay holds for review, oldest first.
+// Numbers are per relay, so a pipeline's QSOs are best named by ID.
+func (s *Supervisor) PendingQSOs() []review.Pending {
+	var pending []review.Pending
+	for _, r := range s.relays() {
+		pending = append(pending, r.PendingQSOs()...)
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].HeldAt.Before(pending[j].HeldAt)
+	})
+	return pending
+}
+
+// ForwardPending forwards a QSO held for review by whichever relay holds it
+func (s *Supervisor) ForwardPending(ref string, corrected *formatter.QSO) (formatter.QSO, error) {
+	for _, r := range s.relays() {
+		if qso, err := r.ForwardPending(ref, corrected); !notHeld(err) {
+			return qso, err
+		}
+	}
+	return formatter.QSO{}, fmt.Errorf("%w: %q", review.ErrNotHeld, ref)
+}
+
+// DiscardPending drops a QSO held for review by whichever relay holds it
+func (s *Supervisor) DiscardPending(ref string) (formatter.QSO, error) {
+	for _, r := range s.relays() {
+		if qso, err := r.DiscardPending(ref); !notHeld(err) {
+			return qso, err
+		}
+	}
+	return formatter.QSO{}, fmt.Errorf("%w: %q", review.ErrNotHeld, ref)
+}
+
+// Resume restarts forwarding on every relay
+func (s *Supervisor) Resume() {
+	for _, r := range s.relays() {
+		r.Resume()
+	}
+}
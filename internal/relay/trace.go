@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tracer records what happens to each received datagram: a hex/ASCII dump,
+// the port filter and detection decisions, parse errors and where the QSO
+// went. Datagrams are numbered so the lines of one can be followed while
+// workers process several at once.
+type tracer struct {
+	seq atomic.Uint64
+
+	mu   sync.Mutex
+	file *os.File // nil writes to the log
+}
+
+// newTracer opens the trace output; an empty path traces to the log
+func newTracer(path string) (*tracer, error) {
+	t := &tracer{}
+	if path == "" {
+		return t, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	t.file = file
+	return t, nil
+}
+
+// printf writes one trace line for datagram id
+func (t *tracer) printf(id uint64, format string, args ...any) {
+	line := fmt.Sprintf("trace #%d: ", id) + fmt.Sprintf(format, args...)
+	if t.file == nil {
+		log.Print(line)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.file, "%s %s\n", time.Now().Format("2006/01/02 15:04:05.000"), line)
+}
+
+// close closes the trace file
+func (t *tracer) close() {
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+// traceDatagram numbers a received datagram and dumps it. It returns 0, which
+// the other trace calls ignore, when tracing is off.
+func (r *Relay) traceDatagram(data []byte, source net.Addr) uint64 {
+	if r.trace == nil {
+		return 0
+	}
+	id := r.trace.seq.Add(1)
+	r.trace.printf(id, "%d bytes from %s\n%s", len(data), source, strings.TrimRight(hex.Dump(data), "\n"))
+	return id
+}
+
+// tracef adds a line to the trace of datagram id
+func (r *Relay) tracef(id uint64, format string, args ...any) {
+	if r.trace == nil || id == 0 {
+		return
+	}
+	r.trace.printf(id, format, args...)
+}
@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// markPacket records that a packet arrived from a source
+func (r *Relay) markPacket() {
+	r.lastPacket.Store(time.Now().UnixNano())
+}
+
+// lastPacketTime returns when the last source packet arrived, or when the
+// relay started if none has
+func (r *Relay) lastPacketTime() time.Time {
+	return time.Unix(0, r.lastPacket.Load())
+}
+
+// watchdogInterval returns how often the watchdog checks for silence: often
+// enough to trip within a tenth of the timeout, and at least every 30s
+func watchdogInterval(timeout time.Duration) time.Duration {
+	return max(min(timeout/10, 30*time.Second), time.Millisecond)
+}
+
+// runWatchdog warns once when no source packets have arrived within the
+// timeout, and again when they resume. With alerts enabled it raises a
+// no_packets alert, and it can send a heartbeat so the targets see that the
+// relay itself is still up.
+func (r *Relay) runWatchdog(ctx context.Context) {
+	defer r.wg.Done()
+
+	timeout := r.config.Watchdog.Timeout
+	ticker := time.NewTicker(watchdogInterval(timeout))
+	defer ticker.Stop()
+
+	var silentSince time.Time // last packet before the watchdog tripped; zero while packets arrive
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		last := r.lastPacketTime()
+		switch {
+		case silentSince.IsZero() && time.Since(last) >= timeout:
+			silentSince = last
+			silence := time.Since(last)
+			log.Printf("Watchdog: no packets received for %s; check that the sources are still broadcasting", silence.Round(time.Second))
+			if r.alerts != nil {
+				r.alerts.NoPackets(silence)
+			}
+			if r.config.Watchdog.Heartbeat {
+				r.watchdogHeartbeat()
+			}
+
+		case !silentSince.IsZero() && last.After(silentSince):
+			silence := last.Sub(silentSince)
+			silentSince = time.Time{}
+			log.Printf("Watchdog: packets received again after %s", silence.Round(time.Second))
+			if r.alerts != nil {
+				r.alerts.PacketsResumed(silence)
+			}
+		}
+	}
+}
+
+// watchdogHeartbeat sends a heartbeat to every target when the watchdog trips
+func (r *Relay) watchdogHeartbeat() {
+	payload, err := r.heartbeatPayload()
+	if err != nil {
+		log.Printf("Watchdog heartbeat not sent: %v", err)
+		return
+	}
+	r.sendHeartbeat(payload)
+}
@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
+)
+
+// entity returns the DXCC entity of a call, or "" without a country file
+func (r *Relay) entity(call string) string {
+	if r.cty == nil {
+		return ""
+	}
+	entity, _ := r.cty.Entity(call)
+	return entity
+}
+
+// annotateWorked notes in the QSO's comment whether it is a new DXCC
+// entity, a new call or a new band/mode slot for the call
+func (r *Relay) annotateWorked(qso *formatter.QSO) {
+	if r.workedDB == nil || !r.config.WorkedDB.Annotate {
+		return
+	}
+
+	tag := r.workedDB.Check(qso.Callsign, qso.Band, qso.Mode, r.entity(qso.Callsign)).Tag()
+	if tag == "" || strings.Contains(qso.Comment, tag) {
+		return
+	}
+	if qso.Comment == "" {
+		qso.Comment = tag
+	} else {
+		qso.Comment = tag + " " + qso.Comment
+	}
+}
+
+// recordWorked adds a delivered QSO to the worked-before database
+func (r *Relay) recordWorked(qso *formatter.QSO) {
+	if r.workedDB == nil {
+		return
+	}
+	c := workeddb.Contact{
+		Call:   qso.Callsign,
+		Band:   qso.Band,
+		Mode:   qso.Mode,
+		Entity: r.entity(qso.Callsign),
+		Time:   qso.DateTime.UTC(),
+	}
+	if _, err := r.workedDB.Add(c); err != nil {
+		log.Printf("Failed to update worked-before database: %v", err)
+	}
+}
+
+// WorkedBefore looks a call up in the worked-before database. With a band
+// and mode, status tells what a QSO there would be new for.
+func (r *Relay) WorkedBefore(call, band, mode string) (workeddb.Record, workeddb.Status, error) {
+	if r.workedDB == nil {
+		return workeddb.Record{}, workeddb.Status{}, fmt.Errorf("worked-before database is not enabled")
+	}
+	record, _ := r.workedDB.Lookup(call)
+	return record, r.workedDB.Check(call, band, mode, r.entity(call)), nil
+}
@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"hash/fnv"
+	"net"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Datagrams are handed from the read loop to a fixed pool of workers instead
+// of a goroutine each. With preserve_order every source is pinned to one
+// worker, so its QSOs are forwarded in the order they arrived; otherwise all
+// workers share one queue and a slow QSO never holds up the next.
+
+// defaultWorkers is the pool size when listen.workers is not set
+const defaultWorkers = 4
+
+// job is a datagram waiting for a worker
+type job struct {
+	message string
+	addr    *net.UDPAddr
+	size    int
+
+	// trusted skips the source port filter for messages whose origin is
+	// already established (a valid signature, a chain connection or a
+	// listener dedicated to one application)
+	trusted bool
+
+	// trace numbers the message in the trace output; 0 when tracing is off
+	trace uint64
+
+	// sourceType is the type pinned by the receiving listener; empty detects it
+	sourceType formatter.MessageType
+
+	// origin describes where the message came from in the log; empty for a
+	// UDP datagram
+	origin string
+}
+
+// workerPool feeds datagrams to the relay's workers
+type workerPool struct {
+	queues []chan job
+}
+
+// workerCount returns the configured pool size. Performance mode sizes the
+// pool by max_in_flight.
+func (r *Relay) workerCount() int {
+	if r.performanceEnabled() && r.config.Performance.MaxInFlight > 0 {
+		return r.config.Performance.MaxInFlight
+	}
+	if r.config.Listen.Workers > 0 {
+		return r.config.Listen.Workers
+	}
+	return defaultWorkers
+}
+
+// startWorkers starts the worker goroutines. They exit once the pool is
+// closed and their queue is empty.
+func (r *Relay) startWorkers() *workerPool {
+	workers := r.workerCount()
+	size := r.config.Listen.QueueSize
+	if size <= 0 {
+		size = workers
+	}
+
+	shared := make(chan job, size)
+	pool := &workerPool{queues: []chan job{shared}}
+	if r.config.Listen.PreserveOrder {
+		pool.queues = make([]chan job, workers)
+		for i := range pool.queues {
+			pool.queues[i] = make(chan job, size)
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		queue := shared
+		if r.config.Listen.PreserveOrder {
+			queue = pool.queues[i]
+		}
+		r.wg.Add(1)
+		go r.work(queue)
+	}
+	return pool
+}
+
+// work processes datagrams from queue until it is closed
+func (r *Relay) work(queue <-chan job) {
+	defer r.wg.Done()
+	for j := range queue {
+		r.processMessage(j)
+	}
+}
+
+// submit queues a datagram. It blocks while the queue is full, so reads
+// pause and the kernel socket buffer absorbs the burst.
+func (p *workerPool) submit(j job) {
+	queue := p.queues[0]
+	if len(p.queues) > 1 {
+		h := fnv.New32a()
+		h.Write(j.addr.IP)
+		h.Write([]byte{byte(j.addr.Port >> 8), byte(j.addr.Port)})
+		queue = p.queues[h.Sum32()%uint32(len(p.queues))]
+	}
+	queue <- j
+}
+
+// close stops accepting datagrams; queued ones are still processed
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
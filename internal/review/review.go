@@ -0,0 +1,217 @@
+// Package review holds parsed QSOs for the operator to check before the
+// relay forwards them, so that a busted callsign or exchange can be fixed
+// before it reaches the logger. A QSO nobody looks at is forwarded as it is
+// once its timeout passes.
+package review
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// ErrNotHeld is returned for a QSO that is not, or no longer, in the queue
+var ErrNotHeld = errors.New("no QSO held for review")
+
+// Pending is a QSO waiting in the queue
+type Pending struct {
+	Number    int           `json:"number"` // Short reference for typing at the keyboard
+	HeldAt    time.Time     `json:"held_at"`
+	ForwardAt *time.Time    `json:"forward_at,omitempty"` // When it goes out unreviewed; nil waits for the operator
+	QSO       formatter.QSO `json:"qso"`
+}
+
+// entry is a held QSO and how to forward it
+type entry struct {
+	Pending
+	qso     *formatter.QSO
+	forward func(*formatter.QSO)
+	timer   *time.Timer
+}
+
+// Queue holds QSOs until they are released, discarded or time out
+type Queue struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	held    map[string]*entry // by QSO ID
+	last    int               // Number of the last QSO held
+	closed  bool
+	wg      *sync.WaitGroup // counts held QSOs, so shutdown waits for them
+	now     func() time.Time
+}
+
+// New creates an empty queue. QSOs are forwarded timeout after they are
+// held; 0 holds them until released.
+func New(timeout time.Duration, wg *sync.WaitGroup) *Queue {
+	return &Queue{
+		timeout: timeout,
+		held:    make(map[string]*entry),
+		wg:      wg,
+		now:     time.Now,
+	}
+}
+
+// Hold queues a QSO, which must have an ID, to be passed to forward once it
+// is released or times out. It reports false, holding nothing, once the
+// queue is closed.
+func (q *Queue) Hold(qso *formatter.QSO, forward func(*formatter.QSO)) (Pending, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Pending{}, false
+	}
+
+	q.last++
+	e := &entry{qso: qso, forward: forward}
+	e.Number = q.last
+	e.HeldAt = q.now()
+	if q.timeout > 0 {
+		at := e.HeldAt.Add(q.timeout)
+		e.ForwardAt = &at
+		e.timer = time.AfterFunc(q.timeout, func() { q.expire(qso.ID, e) })
+	}
+	q.held[qso.ID] = e
+	q.wg.Add(1)
+	return e.pending(), true
+}
+
+// pending returns a copy of the entry for callers outside the queue
+func (e *entry) pending() Pending {
+	p := e.Pending
+	p.QSO = *e.qso
+	p.QSO.Path = append([]string(nil), e.qso.Path...)
+	return p
+}
+
+// List returns the held QSOs, oldest first
+func (q *Queue) List() []Pending {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]Pending, 0, len(q.held))
+	for _, e := range q.held {
+		list = append(list, e.pending())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// find looks a held QSO up by ID or number. Callers hold mu.
+func (q *Queue) find(ref string) *entry {
+	if e, ok := q.held[ref]; ok {
+		return e
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		for _, e := range q.held {
+			if e.Number == n {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// take removes a held QSO by ID or number. Callers hold mu.
+func (q *Queue) take(ref string) (*entry, error) {
+	e := q.find(ref)
+	if e == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNotHeld, ref)
+	}
+	delete(q.held, e.qso.ID)
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	return e, nil
+}
+
+// Release forwards a held QSO now. A corrected QSO replaces it, keeping its
+// ID and action. The QSO as forwarded is returned.
+func (q *Queue) Release(ref string, corrected *formatter.QSO) (formatter.QSO, error) {
+	q.mu.Lock()
+	e, err := q.take(ref)
+	q.mu.Unlock()
+	if err != nil {
+		return formatter.QSO{}, err
+	}
+
+	if corrected != nil {
+		corrected.ID = e.qso.ID
+		corrected.Action = e.qso.Action
+		*e.qso = *corrected
+	}
+	qso := *e.qso
+	e.forward(e.qso)
+	q.wg.Done()
+	return qso, nil
+}
+
+// Discard drops a held QSO without forwarding it, returning it
+func (q *Queue) Discard(ref string) (formatter.QSO, error) {
+	q.mu.Lock()
+	e, err := q.take(ref)
+	q.mu.Unlock()
+	if err != nil {
+		return formatter.QSO{}, err
+	}
+	q.wg.Done()
+	return *e.qso, nil
+}
+
+// expire forwards a QSO nobody reviewed in time
+func (q *Queue) expire(id string, e *entry) {
+	q.mu.Lock()
+	if q.held[id] != e {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.held, id)
+	q.mu.Unlock()
+
+	e.forward(e.qso)
+	q.wg.Done()
+}
+
+// Close forwards every held QSO, so that none is lost at shutdown, and makes
+// Hold refuse QSOs from now on
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	held := make([]*entry, 0, len(q.held))
+	for _, e := range q.held {
+		held = append(held, e)
+	}
+	q.held = make(map[string]*entry)
+	q.mu.Unlock()
+
+	sort.Slice(held, func(i, j int) bool { return held[i].Number < held[j].Number })
+	for _, e := range held {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		e.forward(e.qso)
+		q.wg.Done()
+	}
+}
+
+// Print writes the held QSOs for a person to read
+func Print(w io.Writer, pending []Pending) {
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "No QSOs held for review")
+		return
+	}
+
+	for _, p := range pending {
+		until := "held until released"
+		if p.ForwardAt != nil {
+			until = "forwarded at " + p.ForwardAt.Local().Format("15:04:05")
+		}
+		fmt.Fprintf(w, "#%-3d %s  %-10s %-5s %-5s %-14q %s\n", p.Number, p.HeldAt.Local().Format("15:04:05"),
+			p.QSO.Callsign, p.QSO.Band, p.QSO.Mode, p.QSO.Exchange, until)
+	}
+}
@@ -0,0 +1,107 @@
+package review
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// forwarded collects the QSOs a queue forwards
+type forwarded struct {
+	mu   sync.Mutex
+	qsos []formatter.QSO
+}
+
+func (f *forwarded) forward(qso *formatter.QSO) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.qsos = append(f.qsos, *qso)
+}
+
+func (f *forwarded) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []string
+	for _, q := range f.qsos {
+		calls = append(calls, q.Callsign)
+	}
+	return calls
+}
+
+func TestReleaseAndDiscard(t *testing.T) {
+	var wg sync.WaitGroup
+	var out forwarded
+	q := New(0, &wg)
+
+	for _, call := range []string{"K1ABC", "W1XYZ", "N0CALL"} {
+		if _, ok := q.Hold(&formatter.QSO{ID: "id-" + call, Callsign: call, Exchange: "5NN 05"}, out.forward); !ok {
+			t.Fatalf("Hold(%s) refused", call)
+		}
+	}
+	if list := q.List(); len(list) != 3 || list[0].Number != 1 || list[0].ForwardAt != nil {
+		t.Fatalf("unexpected queue: %+v", list)
+	}
+
+	// Corrected by number, keeping the ID
+	qso, err := q.Release("2", &formatter.QSO{Callsign: "W1XY", Exchange: "5NN 04"})
+	if err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if qso.ID != "id-W1XYZ" || qso.Callsign != "W1XY" || qso.Exchange != "5NN 04" {
+		t.Errorf("unexpected correction: %+v", qso)
+	}
+
+	// As it is, by ID
+	if _, err := q.Release("id-K1ABC", nil); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := q.Discard("3"); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	if _, err := q.Release("3", nil); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld, got %v", err)
+	}
+
+	if calls := out.calls(); len(calls) != 2 || calls[0] != "W1XY" || calls[1] != "K1ABC" {
+		t.Errorf("unexpected QSOs forwarded: %v", calls)
+	}
+	wg.Wait()
+}
+
+func TestTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	var out forwarded
+	q := New(20*time.Millisecond, &wg)
+
+	p, _ := q.Hold(&formatter.QSO{ID: "1", Callsign: "K1ABC"}, out.forward)
+	if p.ForwardAt == nil || !p.ForwardAt.After(p.HeldAt) {
+		t.Errorf("expected a forward time after %s, got %v", p.HeldAt, p.ForwardAt)
+	}
+	wg.Wait()
+	if calls := out.calls(); len(calls) != 1 {
+		t.Errorf("expected the QSO forwarded after the timeout, got %v", calls)
+	}
+	if len(q.List()) != 0 {
+		t.Error("the QSO should have left the queue")
+	}
+}
+
+func TestClose(t *testing.T) {
+	var wg sync.WaitGroup
+	var out forwarded
+	q := New(time.Hour, &wg)
+
+	q.Hold(&formatter.QSO{ID: "1", Callsign: "K1ABC"}, out.forward)
+	q.Hold(&formatter.QSO{ID: "2", Callsign: "W1XYZ"}, out.forward)
+	q.Close()
+	wg.Wait()
+	if calls := out.calls(); len(calls) != 2 || calls[0] != "K1ABC" {
+		t.Errorf("expected held QSOs forwarded in order at close, got %v", calls)
+	}
+	if _, ok := q.Hold(&formatter.QSO{ID: "3"}, out.forward); ok {
+		t.Error("a closed queue should not hold QSOs")
+	}
+}
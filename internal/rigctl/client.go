@@ -0,0 +1,211 @@
+package rigctl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the rigctld connection and polling settings
+type Config struct {
+	Address  string        // rigctld host:port
+	Interval time.Duration // Time between polls
+
+	// OnChange, if set, is called from Run whenever the frequency or mode changes
+	OnChange func(State)
+}
+
+// State is the radio's frequency and mode as last reported by rigctld
+type State struct {
+	FrequencyHz int64
+	Mode        string // Hamlib mode name, e.g. USB, CW, PKTUSB
+	Updated     time.Time
+}
+
+// LogMode returns the mode as it is logged: SSB for either sideband, the
+// base mode for reversed and packet variants
+func (s State) LogMode() string {
+	switch s.Mode {
+	case "USB", "LSB":
+		return "SSB"
+	case "CWR":
+		return "CW"
+	case "RTTYR":
+		return "RTTY"
+	case "WFM":
+		return "FM"
+	case "PKTUSB", "PKTLSB", "PKTFM":
+		return "DATA"
+	}
+	return s.Mode
+}
+
+// RadioMode returns the mode as N1MM shows it in RadioInfo (USB, LSB, CW, ...)
+func (s State) RadioMode() string {
+	switch s.Mode {
+	case "CWR":
+		return "CW"
+	case "RTTYR":
+		return "RTTY"
+	case "PKTUSB":
+		return "USB"
+	case "PKTLSB":
+		return "LSB"
+	case "PKTFM", "WFM":
+		return "FM"
+	}
+	return s.Mode
+}
+
+// Client polls a Hamlib rigctld daemon for the radio's frequency and mode
+type Client struct {
+	cfg Config
+
+	mu    sync.RWMutex
+	state State
+}
+
+// NewClient creates a rigctld client. It does not connect until Run is called.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:4532"
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("rigctl: invalid address %q: %w", cfg.Address, err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return &Client{cfg: cfg}, nil
+}
+
+// State returns the last polled state. ok is false until the first
+// successful poll, and once the state is older than three poll intervals
+// (rigctld or the radio has gone away).
+func (c *Client) State() (state State, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.state.Updated.IsZero() || time.Since(c.state.Updated) > 3*c.cfg.Interval {
+		return c.state, false
+	}
+	return c.state, true
+}
+
+// Run polls rigctld until ctx is cancelled, reconnecting after failures
+func (c *Client) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	var (
+		conn   net.Conn
+		reader *bufio.Reader
+		failed bool
+	)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		if conn == nil {
+			dialer := net.Dialer{Timeout: 5 * time.Second}
+			var err error
+			if conn, err = dialer.DialContext(ctx, "tcp", c.cfg.Address); err != nil {
+				// Log once per outage rather than on every poll
+				if !failed {
+					log.Printf("rigctld connection to %s failed: %v", c.cfg.Address, err)
+					failed = true
+				}
+				conn = nil
+			} else {
+				reader = bufio.NewReader(conn)
+				failed = false
+			}
+		}
+
+		if conn != nil {
+			state, err := poll(conn, reader)
+			if err != nil {
+				log.Printf("rigctld poll failed: %v", err)
+				conn.Close()
+				conn = nil
+			} else {
+				c.update(state)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// update stores a new state and reports changes
+func (c *Client) update(state State) {
+	c.mu.Lock()
+	changed := state.FrequencyHz != c.state.FrequencyHz || state.Mode != c.state.Mode
+	c.state = state
+	c.mu.Unlock()
+
+	if changed && c.cfg.OnChange != nil {
+		c.cfg.OnChange(state)
+	}
+}
+
+// poll asks rigctld for the frequency (f) and mode (m)
+func poll(conn net.Conn, reader *bufio.Reader) (State, error) {
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	freq, err := command(conn, reader, "f", 1)
+	if err != nil {
+		return State{}, err
+	}
+	hz, err := strconv.ParseFloat(freq[0], 64)
+	if err != nil || hz <= 0 {
+		return State{}, fmt.Errorf("invalid frequency %q", freq[0])
+	}
+
+	// The mode reply is the mode followed by the passband width
+	mode, err := command(conn, reader, "m", 2)
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{
+		FrequencyHz: int64(hz + 0.5),
+		Mode:        strings.ToUpper(mode[0]),
+		Updated:     time.Now(),
+	}, nil
+}
+
+// command sends a rigctld command and reads lines reply lines. rigctld
+// answers errors with a single "RPRT <code>" line instead.
+func command(conn net.Conn, reader *bufio.Reader, cmd string, lines int) ([]string, error) {
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+
+	reply := make([]string, 0, lines)
+	for len(reply) < lines {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "RPRT ") {
+			return nil, fmt.Errorf("rigctld %s: error %s", cmd, strings.TrimPrefix(line, "RPRT "))
+		}
+		reply = append(reply, line)
+	}
+	return reply, nil
+}
@@ -0,0 +1,144 @@
+package rigctl
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRig answers rigctld f and m commands with the current frequency and mode
+type fakeRig struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	freq string
+	mode string
+}
+
+func startFakeRig(t *testing.T, freq, mode string) *fakeRig {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	rig := &fakeRig{ln: ln, freq: freq, mode: mode}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go rig.serve(conn)
+		}
+	}()
+	return rig
+}
+
+func (r *fakeRig) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		switch strings.TrimSpace(line) {
+		case "f":
+			conn.Write([]byte(r.freq + "\n"))
+		case "m":
+			conn.Write([]byte(r.mode + "\n2400\n"))
+		default:
+			conn.Write([]byte("RPRT -11\n"))
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *fakeRig) set(freq, mode string) {
+	r.mu.Lock()
+	r.freq, r.mode = freq, mode
+	r.mu.Unlock()
+}
+
+func TestClientPolls(t *testing.T) {
+	rig := startFakeRig(t, "14074000", "PKTUSB")
+
+	changes := make(chan State, 4)
+	client, err := NewClient(Config{
+		Address:  rig.ln.Addr().String(),
+		Interval: 20 * time.Millisecond,
+		OnChange: func(s State) { changes <- s },
+	})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, ok := client.State(); ok {
+		t.Error("State should not be available before the first poll")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case s := <-changes:
+		if s.FrequencyHz != 14074000 || s.Mode != "PKTUSB" || s.LogMode() != "DATA" || s.RadioMode() != "USB" {
+			t.Errorf("unexpected state: %+v", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no state reported")
+	}
+
+	// Unchanged polls are not reported, a QSY is
+	rig.set("7030000", "CW")
+	select {
+	case s := <-changes:
+		if s.FrequencyHz != 7030000 || s.LogMode() != "CW" {
+			t.Errorf("unexpected state after QSY: %+v", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("QSY not reported")
+	}
+
+	if s, ok := client.State(); !ok || s.FrequencyHz != 7030000 {
+		t.Errorf("State() = %+v, %v", s, ok)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	rig := startFakeRig(t, "RPRT -5", "USB")
+
+	conn, err := net.Dial("tcp", rig.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := poll(conn, bufio.NewReader(conn)); err == nil || !strings.Contains(err.Error(), "-5") {
+		t.Errorf("expected rigctld error, got %v", err)
+	}
+}
+
+func TestNewClientValidation(t *testing.T) {
+	if _, err := NewClient(Config{Address: "localhost"}); err == nil {
+		t.Error("expected error for address without port")
+	}
+	client, err := NewClient(Config{})
+	if err != nil || client.cfg.Address != "127.0.0.1:4532" || client.cfg.Interval != time.Second {
+		t.Errorf("unexpected defaults: %+v, %v", client, err)
+	}
+}
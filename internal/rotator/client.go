@@ -0,0 +1,213 @@
+package rotator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocols the client can speak
+const (
+	ProtocolRotctld = "rotctld" // Hamlib rotctld over TCP
+	ProtocolN1MM    = "n1mm"    // N1MM Rotor's UDP XML
+)
+
+// Config holds the rotator connection settings
+type Config struct {
+	Protocol  string  // rotctld or n1mm
+	Address   string  // rotctld or N1MM Rotor host:port
+	Rotor     string  // N1MM Rotor's name for the rotator
+	MinChange float64 // Degrees; turns smaller than this are skipped
+}
+
+// Client turns an antenna rotator. Turn only records the heading; Run
+// sends it, so a slow or absent rotator never holds up the relay.
+type Client struct {
+	cfg Config
+
+	mu      sync.Mutex
+	pending *heading
+	last    *heading // Last heading sent
+	wake    chan struct{}
+}
+
+// heading is an azimuth in degrees and the band it is for
+type heading struct {
+	azimuth float64
+	band    string
+}
+
+// NewClient creates a rotator client. It does not connect until Run is called.
+func NewClient(cfg Config) (*Client, error) {
+	switch cfg.Protocol {
+	case "", ProtocolRotctld:
+		cfg.Protocol = ProtocolRotctld
+		if cfg.Address == "" {
+			cfg.Address = "127.0.0.1:4533"
+		}
+	case ProtocolN1MM:
+		if cfg.Address == "" {
+			cfg.Address = "127.0.0.1:12040"
+		}
+		if cfg.Rotor == "" {
+			cfg.Rotor = "Rotor1"
+		}
+	default:
+		return nil, fmt.Errorf("rotator: unknown protocol %q (use rotctld or n1mm)", cfg.Protocol)
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, fmt.Errorf("rotator: invalid address %q: %w", cfg.Address, err)
+	}
+	return &Client{cfg: cfg, wake: make(chan struct{}, 1)}, nil
+}
+
+// Turn asks for the antenna to point at azimuth degrees for a QSO on band
+// (e.g. 20m, may be empty). It returns false when the antenna already points
+// within MinChange of it. A heading not yet sent is replaced.
+func (c *Client) Turn(azimuth float64, band string) bool {
+	azimuth = math.Mod(math.Mod(azimuth, 360)+360, 360)
+
+	c.mu.Lock()
+	target := c.pending
+	if target == nil {
+		target = c.last
+	}
+	if target != nil && target.band == band && angle(target.azimuth, azimuth) < c.cfg.MinChange {
+		c.mu.Unlock()
+		return false
+	}
+	c.pending = &heading{azimuth: azimuth, band: band}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Run sends headings until ctx is cancelled, reconnecting to rotctld after
+// failures
+func (c *Client) Run(ctx context.Context) error {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.wake:
+		}
+
+		c.mu.Lock()
+		h := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		if h == nil {
+			continue
+		}
+
+		var err error
+		if conn == nil {
+			network := "tcp"
+			if c.cfg.Protocol == ProtocolN1MM {
+				network = "udp"
+			}
+			dialer := net.Dialer{Timeout: 5 * time.Second}
+			if conn, err = dialer.DialContext(ctx, network, c.cfg.Address); err != nil {
+				log.Printf("Rotator connection to %s failed: %v", c.cfg.Address, err)
+				conn = nil
+				continue
+			}
+		}
+
+		if c.cfg.Protocol == ProtocolN1MM {
+			_, err = conn.Write([]byte(n1mmMessage(c.cfg.Rotor, *h)))
+		} else {
+			err = setPosition(conn, h.azimuth)
+		}
+		if err != nil {
+			log.Printf("Rotator turn to %.0f° failed: %v", h.azimuth, err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+
+		c.mu.Lock()
+		c.last = h
+		c.mu.Unlock()
+	}
+}
+
+// setPosition sends rotctld's P (set position) command, elevation 0, and
+// reads its "RPRT <code>" reply
+func setPosition(conn net.Conn, azimuth float64) error {
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := fmt.Fprintf(conn, "P %.1f 0\n", azimuth); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if code := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "RPRT")); code != "0" {
+		return fmt.Errorf("rotctld P: error %s", code)
+	}
+	return nil
+}
+
+// bandMHz is how N1MM names bands in rotator messages
+var bandMHz = map[string]string{
+	"160m": "1.8",
+	"80m":  "3.5",
+	"60m":  "5.3",
+	"40m":  "7.0",
+	"30m":  "10.1",
+	"20m":  "14.0",
+	"17m":  "18.1",
+	"15m":  "21.0",
+	"12m":  "24.9",
+	"10m":  "28.0",
+	"6m":   "50.0",
+	"2m":   "144.0",
+	"70cm": "432.0",
+}
+
+// n1mmMessage builds the datagram N1MM Logger+ sends its rotator program
+func n1mmMessage(rotor string, h heading) string {
+	var b strings.Builder
+	b.WriteString("<N1MMRotor>")
+	fmt.Fprintf(&b, "<rotor>%s</rotor>", xmlEscape(rotor))
+	fmt.Fprintf(&b, "<goazi>%.1f</goazi>", h.azimuth)
+	b.WriteString("<offset>0.0</offset><bidirectional>0</bidirectional>")
+	if band, ok := bandMHz[strings.ToLower(h.band)]; ok {
+		fmt.Fprintf(&b, "<freqband>%s</freqband>", band)
+	}
+	b.WriteString("</N1MMRotor>")
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// angle returns the difference between two azimuths, 0 to 180 degrees
+func angle(a, b float64) float64 {
+	d := math.Abs(a - b)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
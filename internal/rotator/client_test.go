@@ -0,0 +1,124 @@
+package rotator
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFakeRotctld answers P commands with RPRT 0 and passes each one on
+func startFakeRotctld(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	commands := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					commands <- scanner.Text()
+					conn.Write([]byte("RPRT 0\n"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), commands
+}
+
+func run(t *testing.T, c *Client) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go c.Run(ctx)
+}
+
+func next(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the rotator")
+		return ""
+	}
+}
+
+func TestRotctld(t *testing.T) {
+	addr, commands := startFakeRotctld(t)
+	c, err := NewClient(Config{Address: addr, MinChange: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, c)
+
+	if !c.Turn(-27.4, "20m") {
+		t.Fatal("first turn skipped")
+	}
+	if cmd := next(t, commands); cmd != "P 332.6 0" {
+		t.Errorf("got %q", cmd)
+	}
+
+	// Within min_change of where the antenna points, across north
+	time.Sleep(50 * time.Millisecond)
+	if c.Turn(336, "20m") {
+		t.Error("small turn should be skipped")
+	}
+	if !c.Turn(90, "20m") {
+		t.Error("large turn skipped")
+	}
+	if cmd := next(t, commands); cmd != "P 90.0 0" {
+		t.Errorf("got %q", cmd)
+	}
+}
+
+func TestN1MMRotor(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c, err := NewClient(Config{Protocol: ProtocolN1MM, Address: conn.LocalAddr().String(), Rotor: "Tower & Beam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, c)
+	c.Turn(45, "15m")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<N1MMRotor><rotor>Tower &amp; Beam</rotor><goazi>45.0</goazi><offset>0.0</offset>" +
+		"<bidirectional>0</bidirectional><freqband>21.0</freqband></N1MMRotor>"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := NewClient(Config{Protocol: "gs232"}); err == nil || !strings.Contains(err.Error(), "unknown protocol") {
+		t.Errorf("expected an unknown protocol error, got %v", err)
+	}
+	if _, err := NewClient(Config{Address: "localhost"}); err == nil {
+		t.Error("expected an address without a port to be rejected")
+	}
+	c, err := NewClient(Config{Protocol: ProtocolN1MM})
+	if err != nil || c.cfg.Address != "127.0.0.1:12040" || c.cfg.Rotor != "Rotor1" {
+		t.Errorf("unexpected defaults %+v, %v", c.cfg, err)
+	}
+}
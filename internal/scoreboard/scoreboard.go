@@ -0,0 +1,194 @@
+// Package scoreboard posts N1MM's score broadcasts to the online contest
+// scoreboards. They take the dynamicresults XML N1MM broadcasts as it is,
+// in the form field xml, so the relay can report the score of stations
+// whose loggers can't reach the internet themselves.
+package scoreboard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Boards are the scoreboards known by name
+var Boards = map[string]string{
+	"contestonlinescore": "https://contestonlinescore.com/post/",
+	"cqcontest":          "http://cqcontest.net/post/",
+}
+
+// Config holds the scoreboards and how often to post to them
+type Config struct {
+	Boards     []string      // Names in Boards or http(s) URLs
+	Interval   time.Duration // Time between posts; scores that haven't changed aren't posted again
+	Retries    int           // Further attempts at a failed post before waiting for the next interval
+	RetryDelay time.Duration // Before the first retry, doubling for each one after it
+}
+
+// ResolveBoard returns the URL of a scoreboard given by name or URL
+func ResolveBoard(board string) (string, error) {
+	if u, ok := Boards[strings.ToLower(board)]; ok {
+		return u, nil
+	}
+	u, err := url.Parse(board)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("unknown scoreboard %q (use an http(s) URL or one of contestonlinescore, cqcontest)", board)
+	}
+	return board, nil
+}
+
+// entry is the latest score of one station in one contest
+type entry struct {
+	score   *formatter.N1MMScore
+	version int
+	posted  map[string]int // Version last accepted, by board URL
+}
+
+// Poster sends the latest score of each station to the scoreboards
+type Poster struct {
+	cfg    Config
+	urls   []string
+	client *http.Client
+
+	mu     sync.Mutex
+	scores map[string]*entry // By call and contest
+}
+
+// New creates a poster. A zero interval posts every 2 minutes and a zero
+// retry delay waits 5 seconds.
+func New(cfg Config) (*Poster, error) {
+	if len(cfg.Boards) == 0 {
+		return nil, fmt.Errorf("scoreboard: no boards to post to")
+	}
+	p := &Poster{
+		client: &http.Client{Timeout: 15 * time.Second},
+		scores: make(map[string]*entry),
+	}
+	for _, board := range cfg.Boards {
+		u, err := ResolveBoard(board)
+		if err != nil {
+			return nil, fmt.Errorf("scoreboard: %w", err)
+		}
+		p.urls = append(p.urls, u)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Minute
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 5 * time.Second
+	}
+	p.cfg = cfg
+	return p, nil
+}
+
+// Update records a score broadcast; it is posted at the next interval
+// unless it is the same as the last one
+func (p *Poster) Update(score *formatter.N1MMScore) {
+	key := score.Call + "|" + strings.ToUpper(score.Contest)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.scores[key]
+	if !ok {
+		e = &entry{posted: make(map[string]int)}
+		p.scores[key] = e
+	}
+	if e.score != nil && e.score.Raw == score.Raw {
+		return
+	}
+	e.score = score
+	e.version++
+}
+
+// Run posts changed scores every Interval until ctx is cancelled. A post
+// that still fails after its retries is tried again at the next interval.
+func (p *Poster) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.flush(ctx)
+		}
+	}
+}
+
+// pending is a score a board hasn't accepted yet
+type pending struct {
+	e       *entry
+	url     string
+	score   *formatter.N1MMScore
+	version int
+}
+
+// flush posts each board the scores it hasn't accepted
+func (p *Poster) flush(ctx context.Context) {
+	p.mu.Lock()
+	var todo []pending
+	for _, e := range p.scores {
+		for _, u := range p.urls {
+			if e.posted[u] != e.version {
+				todo = append(todo, pending{e: e, url: u, score: e.score, version: e.version})
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	for _, t := range todo {
+		if err := p.postWithRetries(ctx, t.url, t.score); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to post score of %s to %s: %v", t.score.Call, t.url, err)
+			}
+			continue
+		}
+		p.mu.Lock()
+		t.e.posted[t.url] = t.version
+		p.mu.Unlock()
+	}
+}
+
+// postWithRetries posts a score, retrying with a doubling delay
+func (p *Poster) postWithRetries(ctx context.Context, board string, score *formatter.N1MMScore) error {
+	delay := p.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := p.post(ctx, board, score)
+		if err == nil || attempt >= p.cfg.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends a score's XML to a board as the form field xml
+func (p *Poster) post(ctx context.Context, board string, score *formatter.N1MMScore) error {
+	form := url.Values{"xml": {score.Raw}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, board, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package scoreboard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+const testScore = `<?xml version="1.0"?><dynamicresults><contest>CQ-WW-CW</contest><call>W1AW</call>` +
+	`<breakdown><qso band="total" mode="ALL">120</qso><point band="total" mode="ALL">300</point>` +
+	`<mult band="total" mode="ALL" type="zone">20</mult><mult band="total" mode="ALL" type="country">30</mult></breakdown>` +
+	`<score>15000</score><timestamp>2024-11-23 14:05:00</timestamp></dynamicresults>`
+
+func TestResolveBoard(t *testing.T) {
+	if u, err := ResolveBoard("ContestOnlineScore"); err != nil || u != Boards["contestonlinescore"] {
+		t.Errorf("by name: %q %v", u, err)
+	}
+	if u, err := ResolveBoard("https://example.com/post/"); err != nil || u != "https://example.com/post/" {
+		t.Errorf("by URL: %q %v", u, err)
+	}
+	for _, bad := range []string{"scoreboard", "ftp://example.com/", "http://"} {
+		if _, err := ResolveBoard(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestPosterRetries(t *testing.T) {
+	var mu sync.Mutex
+	var posts []string
+	fail := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail > 0 {
+			fail--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		posts = append(posts, req.FormValue("xml"))
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Boards: []string{srv.URL}, Retries: 1, RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, err := formatter.ParseN1MMScore(testScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.QSOs() != 120 || score.Points() != 300 || score.Mults() != 50 || score.Score != 15000 ||
+		!score.Time().Equal(time.Date(2024, 11, 23, 14, 5, 0, 0, time.UTC)) {
+		t.Errorf("ParseN1MMScore = %s at %s", score, score.Time())
+	}
+	p.Update(score)
+
+	// Both attempts fail; the score stays pending for the next interval
+	p.flush(context.Background())
+	if len(posts) != 0 || fail != 0 {
+		t.Fatalf("expected two failed attempts, %d posted, %d failures left", len(posts), fail)
+	}
+	p.flush(context.Background())
+	if len(posts) != 1 || posts[0] != testScore {
+		t.Fatalf("expected the XML posted as it came, got %q", posts)
+	}
+
+	// An unchanged score isn't posted again
+	same, _ := formatter.ParseN1MMScore(testScore)
+	p.Update(same)
+	p.flush(context.Background())
+	if len(posts) != 1 {
+		t.Errorf("unchanged score posted again: %d posts", len(posts))
+	}
+}
+
+func TestPostError(t *testing.T) {
+	p, err := New(Config{Boards: []string{"http://127.0.0.1:1/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, err := formatter.ParseN1MMScore(testScore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.post(ctx, "http://127.0.0.1:1/", score); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cause kept in the error, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Package scoring works out the contest points of each QSO and whether it
+// is a new multiplier, for the contests most often run with the relay, so
+// that loggers and scoreboards reading N1MM contactinfo get real values.
+// The rules are those of each contest's QSO points and per-QSO multipliers;
+// bonuses and overall power multipliers are left to the logger.
+package scoring
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Contest names a set of scoring rules
+type Contest string
+
+const (
+	CQWW     Contest = "cqww"     // CQ World Wide DX: zones and countries per band
+	ARRLDX   Contest = "arrldx"   // ARRL International DX: W/VE work the world
+	WPX      Contest = "wpx"      // CQ WPX: prefixes once per contest
+	FieldDay Contest = "fieldday" // ARRL Field Day: points by mode, no multipliers
+)
+
+// Contests lists the supported rules
+var Contests = []Contest{CQWW, ARRLDX, WPX, FieldDay}
+
+// ContestFromName returns the rules for an N1MM contest name such as
+// CQWWCW, CQ-WPX-SSB, ARRLDXCW or FD
+func ContestFromName(name string) (Contest, bool) {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, name)
+
+	switch {
+	case strings.HasPrefix(name, "CQWW") && !strings.HasPrefix(name, "CQWWDIGI") && !strings.HasPrefix(name, "CQWWVHF"):
+		return CQWW, true
+	case strings.HasPrefix(name, "CQWPX"):
+		return WPX, true
+	case strings.HasPrefix(name, "ARRLDX"):
+		return ARRLDX, true
+	case name == "FD" || name == "ARRLFD" || name == "FIELDDAY" || name == "ARRLFIELDDAY":
+		return FieldDay, true
+	}
+	return "", false
+}
+
+// NeedsCTY reports whether the rules need a country file
+func (c Contest) NeedsCTY() bool {
+	return c != FieldDay
+}
+
+// Score is what one QSO is worth. Mults are N1MM's IsMultiplier1-3; which
+// multiplier each stands for depends on the contest.
+type Score struct {
+	Points int
+	Mults  [3]bool
+}
+
+// Scorer scores the QSOs of one contest as they are logged. It remembers
+// what has been worked, so a repeat of a call on a band is a dupe worth
+// nothing, and only the first QSO with each multiplier is flagged.
+type Scorer struct {
+	contest Contest
+	cty     *formatter.CTY
+
+	mu     sync.Mutex
+	worked map[string]bool // dupe and multiplier keys
+}
+
+// New creates a scorer. cty may be nil only for contests that don't need it.
+func New(contest Contest, cty *formatter.CTY) (*Scorer, error) {
+	known := false
+	for _, c := range Contests {
+		known = known || c == contest
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown contest %q", contest)
+	}
+	if cty == nil && contest.NeedsCTY() {
+		return nil, fmt.Errorf("scoring %s needs a country file", contest)
+	}
+	return &Scorer{contest: contest, cty: cty, worked: make(map[string]bool)}, nil
+}
+
+// Contest returns the rules the scorer applies
+func (s *Scorer) Contest() Contest {
+	return s.contest
+}
+
+// Score scores a QSO the station made and records it as worked
+func (s *Scorer) Score(station string, qso *formatter.QSO) Score {
+	call := strings.ToUpper(formatter.SanitizeCallsign(qso.Callsign))
+	band := strings.ToLower(qso.Band)
+	if call == "" {
+		return Score{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Field Day allows the same call once per band and mode category
+	dupe := "q|" + call + "|" + band
+	if s.contest == FieldDay {
+		dupe += "|" + modeCategory(qso.Mode)
+	}
+	if s.worked[dupe] {
+		return Score{}
+	}
+	s.worked[dupe] = true
+
+	if s.contest == FieldDay {
+		if modeCategory(qso.Mode) == "phone" {
+			return Score{Points: 1}
+		}
+		return Score{Points: 2}
+	}
+
+	dx, ok := s.cty.Lookup(call)
+	if !ok {
+		return Score{}
+	}
+	me, ok := s.cty.Lookup(station)
+	if !ok {
+		return Score{}
+	}
+
+	var score Score
+	switch s.contest {
+	case CQWW:
+		switch {
+		case dx.Name == me.Name:
+		case dx.Continent != me.Continent:
+			score.Points = 3
+		case me.Continent == "NA":
+			score.Points = 2
+		default:
+			score.Points = 1
+		}
+		zone := dx.CQZone
+		if n, err := strconv.Atoi(strings.TrimSpace(qso.Exchange)); err == nil && n >= 1 && n <= 40 {
+			zone = n
+		}
+		score.Mults[0] = s.first("z|" + band + "|" + strconv.Itoa(zone))
+		score.Mults[1] = s.first("c|" + band + "|" + dx.Name)
+
+	case ARRLDX:
+		// Only QSOs between W/VE and the rest of the world count
+		if wve(me) == wve(dx) {
+			return Score{}
+		}
+		score.Points = 3
+		if wve(me) {
+			score.Mults[0] = s.first("c|" + band + "|" + dx.Name)
+		} else if state := stateOrProvince(qso.Exchange); state != "" {
+			score.Mults[0] = s.first("s|" + band + "|" + state)
+		}
+
+	case WPX:
+		low := band == "160m" || band == "80m" || band == "40m"
+		switch {
+		case dx.Name == me.Name:
+			score.Points = 1
+		case dx.Continent != me.Continent:
+			score.Points = 3
+		case me.Continent == "NA":
+			score.Points = 2
+		default:
+			score.Points = 1
+		}
+		if low && dx.Name != me.Name {
+			score.Points *= 2
+		}
+		if prefix := formatter.WPXPrefix(call); prefix != "" {
+			score.Mults[0] = s.first("p|" + prefix)
+		}
+	}
+	return score
+}
+
+// first records a multiplier key and reports whether it is new
+func (s *Scorer) first(key string) bool {
+	if s.worked[key] {
+		return false
+	}
+	s.worked[key] = true
+	return true
+}
+
+// wve reports whether an entity is on the W/VE side of the ARRL DX contest:
+// the contiguous United States and Canada
+func wve(e formatter.CTYEntity) bool {
+	return e.Prefix == "K" || e.Prefix == "VE"
+}
+
+// stateOrProvince returns the state or province in an ARRL DX exchange such
+// as "599 CT", or "" if there is none
+func stateOrProvince(exchange string) string {
+	for _, field := range strings.Fields(strings.ToUpper(exchange)) {
+		if len(field) >= 2 && len(field) <= 3 && strings.Trim(field, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+			return field
+		}
+	}
+	return ""
+}
+
+// modeCategory returns the Field Day mode category of a mode
+func modeCategory(mode string) string {
+	switch {
+	case formatter.IsPhoneMode(mode):
+		return "phone"
+	case strings.EqualFold(mode, "CW"):
+		return "cw"
+	}
+	return "digital"
+}
@@ -0,0 +1,166 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+const testCTY = `United States:            05:  08:  NA:   37.53:    91.67:     5.0:  K:
+    AA,AB,AC,K,N,W,W6(3);
+Canada:                   05:  09:  NA:   44.35:    78.75:     5.0:  VE:
+    CF,CG,VA,VE,VO1(5),VY;
+Alaska:                   01:  01:  NA:   61.40:   148.87:     9.0:  KL:
+    AL,KL,NL,WL;
+England:                  14:  27:  EU:   52.77:     1.47:     0.0:  G:
+    2E,G,M;
+Germany:                  14:  28:  EU:   51.00:   -10.00:    -1.0:  DL:
+    DA,DB,DC,DD,DF,DG,DH,DJ,DK,DL;
+Japan:                    25:  45:  AS:   36.40:  -138.38:    -9.0:  JA:
+    JA,JE,JF,JG,JH,JI,JJ,JK,JL,JM,JN,JO,JP,JQ,JR,JS;
+`
+
+func newScorer(t *testing.T, contest Contest) *Scorer {
+	t.Helper()
+	cty, err := formatter.ParseCTY(testCTY)
+	if err != nil {
+		t.Fatalf("ParseCTY failed: %v", err)
+	}
+	s, err := New(contest, cty)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func qso(call, band, mode, exchange string) *formatter.QSO {
+	return &formatter.QSO{Callsign: call, Band: band, Mode: mode, Exchange: exchange}
+}
+
+func TestContestFromName(t *testing.T) {
+	tests := map[string]Contest{
+		"CQWWCW":     CQWW,
+		"CQ-WW-SSB":  CQWW,
+		"CQWPXRTTY":  WPX,
+		"ARRLDXCW":   ARRLDX,
+		"FD":         FieldDay,
+		"ARRL-FD":    FieldDay,
+		"CQWWDIGI":   "",
+		"GENERAL":    "",
+		"cq-wpx-ssb": WPX,
+	}
+	for name, want := range tests {
+		if got, ok := ContestFromName(name); got != want || ok != (want != "") {
+			t.Errorf("ContestFromName(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(CQWW, nil); err == nil {
+		t.Error("expected an error for CQ WW without a country file")
+	}
+	if _, err := New(FieldDay, nil); err != nil {
+		t.Errorf("Field Day needs no country file: %v", err)
+	}
+	if _, err := New("sweepstakes", nil); err == nil {
+		t.Error("expected an error for an unknown contest")
+	}
+}
+
+func TestCQWW(t *testing.T) {
+	s := newScorer(t, CQWW)
+	tests := []struct {
+		qso  *formatter.QSO
+		want Score
+	}{
+		{qso("DL1ABC", "20m", "CW", "14"), Score{Points: 3, Mults: [3]bool{true, true}}},
+		{qso("G4XYZ", "20m", "CW", "14"), Score{Points: 3, Mults: [3]bool{false, true}}}, // zone 14 already worked
+		{qso("DL2ABC", "20m", "CW", "14"), Score{Points: 3}},
+		{qso("DL1ABC", "20m", "CW", "14"), Score{}},                                      // dupe
+		{qso("DL1ABC", "40m", "CW", "14"), Score{Points: 3, Mults: [3]bool{true, true}}}, // new band
+		{qso("VE3XYZ", "20m", "CW", "4"), Score{Points: 2, Mults: [3]bool{true, true}}},  // NA to NA
+		{qso("W6ABC", "20m", "CW", ""), Score{Points: 0, Mults: [3]bool{true, true}}},    // own country, zone 3 from cty
+		{qso("KL7AA", "20m", "CW", ""), Score{Points: 2, Mults: [3]bool{true, true}}},
+		{qso("QQ1ABC", "20m", "CW", ""), Score{}},
+	}
+	for _, test := range tests {
+		if got := s.Score("W1AW", test.qso); got != test.want {
+			t.Errorf("Score(%s %s) = %+v; want %+v", test.qso.Callsign, test.qso.Band, got, test.want)
+		}
+	}
+
+	// Outside North America a QSO within the continent is 1 point
+	s = newScorer(t, CQWW)
+	if got := s.Score("G4XYZ", qso("DL1ABC", "20m", "CW", "")); got.Points != 1 {
+		t.Errorf("EU to EU scored %d points; want 1", got.Points)
+	}
+}
+
+func TestARRLDX(t *testing.T) {
+	s := newScorer(t, ARRLDX)
+	tests := []struct {
+		qso  *formatter.QSO
+		want Score
+	}{
+		{qso("DL1ABC", "20m", "CW", "599 100"), Score{Points: 3, Mults: [3]bool{true}}},
+		{qso("DL2ABC", "20m", "CW", "599 KW"), Score{Points: 3}},
+		{qso("KL7AA", "20m", "CW", "599 100"), Score{Points: 3, Mults: [3]bool{true}}}, // Alaska is DX
+		{qso("VE3XYZ", "20m", "CW", "599 ON"), Score{}},                                // W/VE to W/VE
+	}
+	for _, test := range tests {
+		if got := s.Score("W1AW", test.qso); got != test.want {
+			t.Errorf("Score(%s) = %+v; want %+v", test.qso.Callsign, got, test.want)
+		}
+	}
+
+	// DX stations count states and provinces
+	s = newScorer(t, ARRLDX)
+	if got := s.Score("DL1ABC", qso("W1AW", "20m", "CW", "599 CT")); got != (Score{Points: 3, Mults: [3]bool{true}}) {
+		t.Errorf("DX to W/VE scored %+v", got)
+	}
+	if got := s.Score("DL1ABC", qso("K1XYZ", "20m", "CW", "599 CT")); got != (Score{Points: 3}) {
+		t.Errorf("second CT scored %+v", got)
+	}
+}
+
+func TestWPX(t *testing.T) {
+	s := newScorer(t, WPX)
+	tests := []struct {
+		qso  *formatter.QSO
+		want Score
+	}{
+		{qso("DL1ABC", "20m", "CW", ""), Score{Points: 3, Mults: [3]bool{true}}},
+		{qso("DL1ABC", "40m", "CW", ""), Score{Points: 6}}, // prefixes count once per contest
+		{qso("VE3XYZ", "80m", "CW", ""), Score{Points: 4, Mults: [3]bool{true}}},
+		{qso("K2ABC", "40m", "CW", ""), Score{Points: 1, Mults: [3]bool{true}}},
+		{qso("JA1XYZ", "15m", "CW", ""), Score{Points: 3, Mults: [3]bool{true}}},
+	}
+	for _, test := range tests {
+		if got := s.Score("W1AW", test.qso); got != test.want {
+			t.Errorf("Score(%s %s) = %+v; want %+v", test.qso.Callsign, test.qso.Band, got, test.want)
+		}
+	}
+}
+
+func TestFieldDay(t *testing.T) {
+	s, err := New(FieldDay, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	tests := []struct {
+		qso    *formatter.QSO
+		points int
+	}{
+		{qso("K2ABC", "20m", "SSB", "3A EMA"), 1},
+		{qso("K2ABC", "20m", "CW", "3A EMA"), 2},
+		{qso("K2ABC", "20m", "FT8", "3A EMA"), 2},
+		{qso("K2ABC", "20m", "RTTY", "3A EMA"), 0}, // digital already worked on 20m
+		{qso("K2ABC", "20m", "USB", "3A EMA"), 0},
+	}
+	for _, test := range tests {
+		if got := s.Score("W1AW", test.qso); got != (Score{Points: test.points}) {
+			t.Errorf("Score(%s %s) = %+v; want %d points", test.qso.Callsign, test.qso.Mode, got, test.points)
+		}
+	}
+}
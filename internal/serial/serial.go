@@ -0,0 +1,137 @@
+// Package serial numbers QSOs for contests whose exchange includes a serial
+// number. None of the programs feeding the relay send one, so the relay
+// keeps the count, saving it after every QSO so that a restart mid-contest
+// carries on where it left off.
+package serial
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// serialContests are the normalized name prefixes of contests whose
+// exchange includes a serial number
+var serialContests = []string{
+	"CQWPX",     // CQ WPX
+	"ARRLSS",    // ARRL Sweepstakes
+	"DARCWAEDC", // Worked All Europe
+	"WAE",
+	"RDXC",  // Russian DX
+	"ARIDX", // ARI International DX
+	"UBADX",
+	"SPDX",
+	"HADX",
+	"YODX",
+	"OKOMDX",
+	"EUDX",
+	"PACC",
+}
+
+// Required reports whether an N1MM contest name such as CQ-WPX-CW or
+// ARRL-SS-SSB names a contest with a serial number exchange
+func Required(contest string) bool {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, contest)
+	for _, prefix := range serialContests {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// state is what the file holds
+type state struct {
+	Contest string `json:"contest"`
+	Last    int    `json:"last"` // Last serial number sent
+}
+
+// Counter hands out serial numbers for one contest
+type Counter struct {
+	path string
+
+	mu    sync.Mutex
+	state state
+}
+
+// Open loads the counter saved at path, or starts one at start. A file
+// saved for another contest is ignored, so numbering begins again for a new
+// contest; deleting the file starts it again for the same one. An empty
+// path keeps the count in memory only.
+func Open(path, contest string, start int) (*Counter, error) {
+	if start < 1 {
+		start = 1
+	}
+	c := &Counter{path: path, state: state{Contest: contest, Last: start - 1}}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read serial number file: %w", err)
+	}
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to read serial number file %s: %w", path, err)
+	}
+	if strings.EqualFold(saved.Contest, contest) && saved.Last >= c.state.Last {
+		c.state.Last = saved.Last
+	}
+	return c, nil
+}
+
+// Last returns the last serial number handed out, or start-1 before the first
+func (c *Counter) Last() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Last
+}
+
+// Next returns the next serial number and saves it. The number is used even
+// if saving fails, and the error is returned for logging.
+func (c *Counter) Next() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Last++
+	return c.state.Last, c.save()
+}
+
+// save writes the state to the file, replacing it atomically. Callers
+// hold mu.
+func (c *Counter) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode serial number: %w", err)
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create serial number directory: %w", err)
+		}
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write serial number file: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write serial number file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package serial
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequired(t *testing.T) {
+	tests := map[string]bool{
+		"CQ-WPX-CW":     true,
+		"cq-wpx-ssb":    true,
+		"ARRL-SS-CW":    true,
+		"DARC-WAEDC-CW": true,
+		"CQ-WW-CW":      false,
+		"ARRL-FD":       false,
+		"":              false,
+	}
+	for contest, want := range tests {
+		if got := Required(contest); got != want {
+			t.Errorf("Required(%q) = %v, want %v", contest, got, want)
+		}
+	}
+}
+
+func TestCounterPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serial.json")
+
+	c, err := Open(path, "CQ-WPX-CW", 1)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for want := 1; want <= 3; want++ {
+		if n, err := c.Next(); err != nil || n != want {
+			t.Fatalf("Next = %d, %v; want %d", n, err, want)
+		}
+	}
+
+	// A restart carries on
+	c, err = Open(path, "CQ-WPX-CW", 1)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if n, _ := c.Next(); n != 4 {
+		t.Errorf("after a restart Next = %d, want 4", n)
+	}
+
+	// A new contest starts again, at the start number
+	c, err = Open(path, "ARRL-SS-CW", 100)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if n, _ := c.Next(); n != 100 {
+		t.Errorf("for a new contest Next = %d, want 100", n)
+	}
+
+	// A start number past the saved serial wins
+	c, _ = Open(path, "ARRL-SS-CW", 500)
+	if last := c.Last(); last != 499 {
+		t.Errorf("Last = %d, want 499", last)
+	}
+}
+
+func TestCounterErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "serial.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "CQ-WPX-CW", 1); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+
+	// Without a file the count is kept in memory
+	c, err := Open("", "CQ-WPX-CW", 1)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if n, err := c.Next(); err != nil || n != 1 {
+		t.Errorf("Next = %d, %v; want 1", n, err)
+	}
+}
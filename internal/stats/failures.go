@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxSampleBytes is how much of a failed message is kept
+const maxSampleBytes = 512
+
+// Failure is a message the relay could not turn into a QSO
+type Failure struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"` // Address the message came from
+	Type    string    `json:"type"`   // Detected or configured source type
+	Error   string    `json:"error"`
+	Size    int       `json:"size"`    // Length of the whole message
+	Payload string    `json:"payload"` // Start of the message, hex-encoded when Binary
+	Binary  bool      `json:"binary,omitempty"`
+}
+
+// Failures keeps the most recent parse failures in a ring buffer. It is safe
+// for concurrent use; a nil *Failures records nothing.
+type Failures struct {
+	mu     sync.Mutex
+	ring   []Failure
+	next   int
+	filled bool
+}
+
+// NewFailures creates a buffer holding the last size failures
+func NewFailures(size int) *Failures {
+	return &Failures{ring: make([]Failure, size)}
+}
+
+// Add records a failed message, keeping the first maxSampleBytes of it
+func (f *Failures) Add(source, msgType string, err error, message string) {
+	if f == nil || len(f.ring) == 0 {
+		return
+	}
+
+	sample := Failure{
+		Time:   time.Now().UTC(),
+		Source: source,
+		Type:   msgType,
+		Error:  err.Error(),
+		Size:   len(message),
+	}
+	payload := message[:min(len(message), maxSampleBytes)]
+	if printable(payload) {
+		sample.Payload = payload
+	} else {
+		sample.Payload = hex.EncodeToString([]byte(payload))
+		sample.Binary = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ring[f.next] = sample
+	f.next = (f.next + 1) % len(f.ring)
+	if f.next == 0 {
+		f.filled = true
+	}
+}
+
+// List returns the recorded failures, oldest first
+func (f *Failures) List() []Failure {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.filled {
+		return append([]Failure(nil), f.ring[:f.next]...)
+	}
+	return append(append([]Failure(nil), f.ring[f.next:]...), f.ring[:f.next]...)
+}
+
+// printable reports whether a payload can be shown as text. A cut at
+// maxSampleBytes may split the last character, which is allowed.
+func printable(s string) bool {
+	for i, r := range s {
+		if r == utf8.RuneError && len(s)-i >= utf8.UTFMax {
+			return false
+		}
+		if r != utf8.RuneError && !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// PrintFailures writes a human-readable list of failures, oldest first
+func PrintFailures(w io.Writer, failures []Failure) {
+	if len(failures) == 0 {
+		fmt.Fprintln(w, "No parse failures recorded")
+		return
+	}
+
+	for i, f := range failures {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s  %s from %s (%d bytes)\n", f.Time.Local().Format("2006-01-02 15:04:05"), f.Type, f.Source, f.Size)
+		fmt.Fprintf(w, "  error:   %s\n", f.Error)
+		if f.Binary {
+			fmt.Fprintf(w, "  payload: hex %s\n", f.Payload)
+		} else {
+			fmt.Fprintf(w, "  payload: %q\n", f.Payload)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Latency is how long after their own timestamps the QSOs of one source type
+// were forwarded. A source that batches or delays its broadcasts shows up as
+// a high average. Like Rates it is not persisted.
+type Latency struct {
+	Count   uint64  `json:"count"`
+	Last    float64 `json:"last_seconds"`
+	Average float64 `json:"average_seconds"`
+	Max     float64 `json:"max_seconds"`
+}
+
+// Latency records that a QSO of msgType was forwarded d after its timestamp.
+// A negative d, from a source clock running ahead, counts as zero.
+func (s *Stats) Latency(msgType string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts.Latency == nil {
+		s.counts.Latency = make(map[string]Latency)
+	}
+
+	seconds := max(d, 0).Seconds()
+	l := s.counts.Latency[msgType]
+	l.Count++
+	l.Last = seconds
+	l.Average += (seconds - l.Average) / float64(l.Count)
+	l.Max = max(l.Max, seconds)
+	s.counts.Latency[msgType] = l
+}
+
+// printLatency writes the latency section of the report
+func printLatency(w io.Writer, latency map[string]Latency) {
+	if len(latency) == 0 {
+		return
+	}
+
+	types := make([]string, 0, len(latency))
+	for t := range latency {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	fmt.Fprintf(w, "\nLatency (QSO time to forward):\n")
+	for _, t := range types {
+		l := latency[t]
+		fmt.Fprintf(w, "  %-20s last %8s  avg %8s  max %8s  (%d QSOs)\n", t,
+			seconds(l.Last), seconds(l.Average), seconds(l.Max), l.Count)
+	}
+}
+
+// seconds formats a number of seconds as a rounded duration
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
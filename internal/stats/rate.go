@@ -0,0 +1,159 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// streakGap is the longest pause between QSOs that keeps a streak going
+const streakGap = 5 * time.Minute
+
+// Contact is a forwarded QSO as seen by the rate meter
+type Contact struct {
+	Band  string
+	Mode  string
+	Mults map[string]string // multiplier kind (wpx, dxcc) -> value; empty values are skipped
+}
+
+// RateMeter is the contest view of the QSOs forwarded since the relay
+// started. Like Rates it is not persisted.
+type RateMeter struct {
+	LastHour    int               `json:"last_hour"`             // QSOs in the last 60 minutes
+	Last10m     int               `json:"last_10m"`              // QSOs in the last 10 minutes
+	Best10m     int               `json:"best_10m"`              // Most QSOs in any 10 minutes
+	Best10mAt   time.Time         `json:"best_10m_at,omitempty"` // When that 10 minutes ended
+	Streak      int               `json:"streak"`                // QSOs in the current run without a long pause
+	BestStreak  int               `json:"best_streak"`
+	ByBand      map[string]uint64 `json:"by_band"`
+	ByMode      map[string]uint64 `json:"by_mode"`
+	Multipliers map[string]int    `json:"multipliers"` // Distinct values by multiplier kind
+}
+
+// rateMeter keeps the QSO times of the last hour and the running totals
+type rateMeter struct {
+	times      []time.Time
+	best10m    int
+	best10mAt  time.Time
+	streak     int
+	bestStreak int
+	byBand     map[string]uint64
+	byMode     map[string]uint64
+	mults      map[string]map[string]bool
+}
+
+// add counts a contact forwarded at now
+func (m *rateMeter) add(now time.Time, c Contact) {
+	if m.byBand == nil {
+		m.byBand = make(map[string]uint64)
+		m.byMode = make(map[string]uint64)
+		m.mults = make(map[string]map[string]bool)
+	}
+
+	if n := len(m.times); n > 0 && now.Sub(m.times[n-1]) <= streakGap {
+		m.streak++
+	} else {
+		m.streak = 1
+	}
+	m.bestStreak = max(m.bestStreak, m.streak)
+
+	m.prune(now)
+	m.times = append(m.times, now)
+	// The busiest 10 minutes always end on a QSO, so checking at each one
+	// finds the best rate
+	if n := m.count(now, 10*time.Minute); n > m.best10m {
+		m.best10m = n
+		m.best10mAt = now.UTC()
+	}
+
+	m.byBand[orUnknown(c.Band)]++
+	m.byMode[orUnknown(strings.ToUpper(c.Mode))]++
+	for kind, value := range c.Mults {
+		if value == "" {
+			continue
+		}
+		if m.mults[kind] == nil {
+			m.mults[kind] = make(map[string]bool)
+		}
+		m.mults[kind][value] = true
+	}
+}
+
+// prune forgets QSO times older than an hour
+func (m *rateMeter) prune(now time.Time) {
+	i := 0
+	for i < len(m.times) && now.Sub(m.times[i]) >= time.Hour {
+		i++
+	}
+	m.times = m.times[i:]
+}
+
+// count returns the QSOs in the span before now
+func (m *rateMeter) count(now time.Time, span time.Duration) int {
+	n := 0
+	for i := len(m.times) - 1; i >= 0 && now.Sub(m.times[i]) < span; i-- {
+		n++
+	}
+	return n
+}
+
+// snapshot returns the meter as of now
+func (m *rateMeter) snapshot(now time.Time) RateMeter {
+	m.prune(now)
+	rm := RateMeter{
+		LastHour:    len(m.times),
+		Last10m:     m.count(now, 10*time.Minute),
+		Best10m:     m.best10m,
+		Best10mAt:   m.best10mAt,
+		BestStreak:  m.bestStreak,
+		ByBand:      copyMap(m.byBand),
+		ByMode:      copyMap(m.byMode),
+		Multipliers: make(map[string]int, len(m.mults)),
+	}
+	if n := len(m.times); n > 0 && now.Sub(m.times[n-1]) <= streakGap {
+		rm.Streak = m.streak
+	}
+	for kind, values := range m.mults {
+		rm.Multipliers[kind] = len(values)
+	}
+	return rm
+}
+
+// orUnknown names an empty band or mode
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// printRate writes the rate meter section of the report
+func printRate(w io.Writer, rm RateMeter) {
+	if rm.BestStreak == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nRate: %d/hr (last 60m), %d/hr (last 10m), best 10m %d/hr", rm.LastHour, rm.Last10m*6, rm.Best10m*6)
+	if !rm.Best10mAt.IsZero() {
+		fmt.Fprintf(w, " at %s", rm.Best10mAt.Local().Format("15:04"))
+	}
+	fmt.Fprintf(w, "\nStreak: %d QSOs (best %d)\n", rm.Streak, rm.BestStreak)
+
+	if len(rm.Multipliers) > 0 {
+		kinds := make([]string, 0, len(rm.Multipliers))
+		for kind := range rm.Multipliers {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		parts := make([]string, len(kinds))
+		for i, kind := range kinds {
+			parts[i] = fmt.Sprintf("%s %d", kind, rm.Multipliers[kind])
+		}
+		fmt.Fprintf(w, "Multipliers: %s\n", strings.Join(parts, ", "))
+	}
+
+	printCounts(w, "QSOs by band", rm.ByBand)
+	printCounts(w, "QSOs by mode", rm.ByMode)
+}
@@ -0,0 +1,340 @@
+// Package stats counts what the relay receives, forwards and drops, keeps
+// rolling message rates and a contest rate meter, and persists the counters
+// across restarts.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// windowSeconds is the longest rolling rate window (15 minutes)
+const windowSeconds = 15 * 60
+
+// Snapshot is a point-in-time copy of the counters
+type Snapshot struct {
+	Since         time.Time          `json:"since"`          // When counting started; survives restarts
+	Received      map[string]uint64  `json:"received"`       // Messages by detected source type
+	QSOs          uint64             `json:"qsos"`           // QSOs accepted by at least one target
+	Forwarded     map[string]uint64  `json:"forwarded"`      // Messages sent, by target
+	TargetErrors  map[string]uint64  `json:"target_errors"`  // Failed sends, by target
+	Acknowledged  map[string]uint64  `json:"acknowledged"`   // QSOs a target replied to without an error, by target
+	Rejected      map[string]uint64  `json:"rejected"`       // QSOs a target replied to with an error, by target
+	ParseFailures map[string]uint64  `json:"parse_failures"` // Messages that produced no QSO, by reason
+	Dropped       map[string]uint64  `json:"dropped"`        // Datagrams and QSOs dropped, by reason
+	Duplicates    map[string]uint64  `json:"duplicates"`     // QSOs held back from some or all targets as repeats, by source type
+	Rates         Rates              `json:"rates"`
+	Rate          RateMeter          `json:"rate"`
+	Latency       map[string]Latency `json:"latency,omitempty"` // Delay from QSO timestamp to forwarding, by source type
+
+	// Counters of the other pipelines run by the same process, by name.
+	// Only the main relay's counters are persisted.
+	Pipelines map[string]Snapshot `json:"pipelines,omitempty"`
+}
+
+// Rates are rolling per-minute averages. They are not persisted, so they
+// start from zero after a restart.
+type Rates struct {
+	Received1m  float64 `json:"received_1m"`
+	Received15m float64 `json:"received_15m"`
+	QSOs1m      float64 `json:"qsos_1m"`
+	QSOs15m     float64 `json:"qsos_15m"`
+}
+
+// Stats is the relay's set of counters. It is safe for concurrent use.
+type Stats struct {
+	mu       sync.Mutex
+	path     string
+	counts   Snapshot
+	received window
+	qsos     window
+	meter    rateMeter
+	now      func() time.Time
+}
+
+// New creates the counters. If path is set, counters saved there by an
+// earlier run are loaded and Save writes them back.
+func New(path string) (*Stats, error) {
+	s := &Stats{path: path, now: time.Now}
+	s.counts = emptySnapshot(s.now())
+
+	if path != "" {
+		saved, err := Load(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			s.counts = saved
+		}
+	}
+	return s, nil
+}
+
+// emptySnapshot returns zeroed counters starting at since
+func emptySnapshot(since time.Time) Snapshot {
+	return Snapshot{
+		Since:         since.UTC(),
+		Received:      make(map[string]uint64),
+		Forwarded:     make(map[string]uint64),
+		TargetErrors:  make(map[string]uint64),
+		Acknowledged:  make(map[string]uint64),
+		Rejected:      make(map[string]uint64),
+		ParseFailures: make(map[string]uint64),
+		Dropped:       make(map[string]uint64),
+		Duplicates:    make(map[string]uint64),
+	}
+}
+
+// Load reads counters saved by Save
+func Load(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snap := emptySnapshot(time.Now())
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read stats file %s: %w", path, err)
+	}
+	// A file written by hand or by an older version may lack some maps
+	for _, m := range []*map[string]uint64{&snap.Received, &snap.Forwarded, &snap.TargetErrors, &snap.Acknowledged, &snap.Rejected, &snap.ParseFailures, &snap.Dropped, &snap.Duplicates} {
+		if *m == nil {
+			*m = make(map[string]uint64)
+		}
+	}
+	snap.Rates = Rates{}
+	snap.Rate = RateMeter{}
+	snap.Latency = nil
+	return snap, nil
+}
+
+// Received counts a message of the given source type
+func (s *Stats) Received(msgType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Received[msgType]++
+	s.received.add(s.now())
+}
+
+// ParseFailed counts a message that could not be turned into a QSO
+func (s *Stats) ParseFailed(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.ParseFailures[reason]++
+}
+
+// QSO counts a QSO accepted by at least one target and adds it to the rate
+// meter
+func (s *Stats) QSO(c Contact) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.counts.QSOs++
+	s.qsos.add(now)
+	s.meter.add(now, c)
+}
+
+// Forwarded counts a message sent to target
+func (s *Stats) Forwarded(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Forwarded[target]++
+}
+
+// TargetFailed counts a failed send to target
+func (s *Stats) TargetFailed(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.TargetErrors[target]++
+}
+
+// Replied counts a target's reply to a QSO, ok or an error
+func (s *Stats) Replied(target string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		s.counts.Acknowledged[target]++
+	} else {
+		s.counts.Rejected[target]++
+	}
+}
+
+// Dropped counts a datagram or QSO dropped for reason
+func (s *Stats) Dropped(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Dropped[reason]++
+}
+
+// Duplicate counts a QSO from a source of msgType that dedup held back
+// from some or all targets
+func (s *Stats) Duplicate(msgType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Duplicates[msgType]++
+}
+
+// DroppedN counts n datagrams dropped for reason, e.g. by the kernel
+func (s *Stats) DroppedN(reason string, n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Dropped[reason] += n
+}
+
+// Snapshot returns a copy of the counters with the current rates
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.counts
+	snap.Received = copyMap(s.counts.Received)
+	snap.Forwarded = copyMap(s.counts.Forwarded)
+	snap.TargetErrors = copyMap(s.counts.TargetErrors)
+	snap.Acknowledged = copyMap(s.counts.Acknowledged)
+	snap.Rejected = copyMap(s.counts.Rejected)
+	snap.ParseFailures = copyMap(s.counts.ParseFailures)
+	snap.Dropped = copyMap(s.counts.Dropped)
+	snap.Duplicates = copyMap(s.counts.Duplicates)
+	if s.counts.Latency != nil {
+		snap.Latency = make(map[string]Latency, len(s.counts.Latency))
+		for t, l := range s.counts.Latency {
+			snap.Latency[t] = l
+		}
+	}
+
+	now := s.now()
+	snap.Rates = Rates{
+		Received1m:  s.received.perMinute(now, 60),
+		Received15m: s.received.perMinute(now, windowSeconds),
+		QSOs1m:      s.qsos.perMinute(now, 60),
+		QSOs15m:     s.qsos.perMinute(now, windowSeconds),
+	}
+	snap.Rate = s.meter.snapshot(now)
+	return snap
+}
+
+// Save writes the counters to the stats file, if one is configured. The
+// file is replaced atomically so a crash never leaves it half written.
+func (s *Stats) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %w", err)
+	}
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create stats directory: %w", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stats file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write stats file: %w", err)
+	}
+	return nil
+}
+
+// copyMap returns a copy of a counter map
+func copyMap(m map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// window counts events per second over the last windowSeconds
+type window struct {
+	counts [windowSeconds]uint32
+	stamps [windowSeconds]int64
+}
+
+// add counts one event at now
+func (w *window) add(now time.Time) {
+	sec := now.Unix()
+	i := sec % windowSeconds
+	if w.stamps[i] != sec {
+		w.stamps[i] = sec
+		w.counts[i] = 0
+	}
+	w.counts[i]++
+}
+
+// perMinute returns the average events per minute over the last span seconds
+func (w *window) perMinute(now time.Time, span int64) float64 {
+	sec := now.Unix()
+	var total uint64
+	for s := sec - span + 1; s <= sec; s++ {
+		if i := s % windowSeconds; w.stamps[i] == s {
+			total += uint64(w.counts[i])
+		}
+	}
+	return float64(total) / (float64(span) / 60)
+}
+
+// Print writes a human-readable report of a snapshot
+func Print(w io.Writer, snap Snapshot) {
+	fmt.Fprintf(w, "Since %s (%s)\n\n", snap.Since.Local().Format("2006-01-02 15:04:05"), time.Since(snap.Since).Round(time.Second))
+
+	fmt.Fprintf(w, "QSOs forwarded: %d\n", snap.QSOs)
+	fmt.Fprintf(w, "Rates (per minute): received %.1f (1m) %.1f (15m), QSOs %.1f (1m) %.1f (15m)\n",
+		snap.Rates.Received1m, snap.Rates.Received15m, snap.Rates.QSOs1m, snap.Rates.QSOs15m)
+	printRate(w, snap.Rate)
+	printLatency(w, snap.Latency)
+
+	printCounts(w, "Received by source type", snap.Received)
+	printCounts(w, "Forwarded by target", snap.Forwarded)
+	printCounts(w, "Target errors", snap.TargetErrors)
+	printCounts(w, "Acknowledged by target", snap.Acknowledged)
+	printCounts(w, "Rejected by target", snap.Rejected)
+	printCounts(w, "Parse failures", snap.ParseFailures)
+	printCounts(w, "Dropped", snap.Dropped)
+	printCounts(w, "Duplicates by source type", snap.Duplicates)
+
+	names := make([]string, 0, len(snap.Pipelines))
+	for name := range snap.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "\n=== Pipeline %s ===\n", name)
+		Print(w, snap.Pipelines[name])
+	}
+}
+
+// printCounts writes one section of counters, largest first
+func printCounts(w io.Writer, title string, counts map[string]uint64) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %-40s %8d\n", k, counts[k])
+	}
+}
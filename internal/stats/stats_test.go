@@ -0,0 +1,200 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRates(t *testing.T) {
+	s, err := New("")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	// 30 messages ten minutes ago, 10 in the last minute
+	now = now.Add(-10 * time.Minute)
+	for i := 0; i < 30; i++ {
+		s.Received("wsjt-x")
+	}
+	now = now.Add(10 * time.Minute)
+	for i := 0; i < 10; i++ {
+		s.Received("wsjt-x")
+		s.QSO(Contact{})
+	}
+
+	rates := s.Snapshot().Rates
+	if rates.Received1m != 10 || rates.Received15m != 40.0/15 || rates.QSOs1m != 10 {
+		t.Errorf("unexpected rates %+v", rates)
+	}
+
+	// Everything ages out of the 15 minute window
+	now = now.Add(20 * time.Minute)
+	if rates := s.Snapshot().Rates; rates != (Rates{}) {
+		t.Errorf("expected zero rates after 20 minutes, got %+v", rates)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats", "stats.json")
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.Received("n1mm")
+	s.QSO(Contact{})
+	s.Forwarded("127.0.0.1:12060")
+	s.TargetFailed("10.0.0.1:9871")
+	s.Replied("127.0.0.1:12060", true)
+	s.Replied("10.0.0.1:9871", false)
+	s.ParseFailed("no callsign found in message")
+	s.Dropped("paused")
+	s.DroppedN("kernel_buffer_full", 3)
+	s.Duplicate("wsjt-x")
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	since := s.Snapshot().Since
+
+	// A restart picks the counters up again
+	s, err = New(path)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.Received("n1mm")
+	snap := s.Snapshot()
+	if snap.Received["n1mm"] != 2 || snap.QSOs != 1 || snap.Forwarded["127.0.0.1:12060"] != 1 ||
+		snap.TargetErrors["10.0.0.1:9871"] != 1 || snap.Acknowledged["127.0.0.1:12060"] != 1 || snap.Rejected["10.0.0.1:9871"] != 1 ||
+		snap.ParseFailures["no callsign found in message"] != 1 ||
+		snap.Dropped["paused"] != 1 || snap.Dropped["kernel_buffer_full"] != 3 || snap.Duplicates["wsjt-x"] != 1 {
+		t.Errorf("counters not restored: %+v", snap)
+	}
+	if !snap.Since.Equal(since) {
+		t.Errorf("since = %v, expected %v", snap.Since, since)
+	}
+
+	var out bytes.Buffer
+	Print(&out, snap)
+	for _, want := range []string{"QSOs forwarded: 1", "n1mm", "127.0.0.1:12060", "paused"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRateMeter(t *testing.T) {
+	s, err := New("")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	qso := func(band, mode, wpx string) {
+		s.QSO(Contact{Band: band, Mode: mode, Mults: map[string]string{"wpx": wpx, "dxcc": ""}})
+	}
+
+	// A burst of 12 QSOs a minute apart on 20m, then a 10 minute pause and
+	// 3 more on 40m
+	for i := 0; i < 12; i++ {
+		qso("20m", "ft8", []string{"K1", "DL1", "G4"}[i%3])
+		now = now.Add(time.Minute)
+	}
+	now = now.Add(10 * time.Minute)
+	for i := 0; i < 3; i++ {
+		qso("40m", "CW", "K1")
+		now = now.Add(30 * time.Second)
+	}
+
+	rm := s.Snapshot().Rate
+	if rm.LastHour != 15 || rm.Last10m != 3 || rm.Best10m != 10 {
+		t.Errorf("rates: last hour %d, last 10m %d, best 10m %d", rm.LastHour, rm.Last10m, rm.Best10m)
+	}
+	if rm.Streak != 3 || rm.BestStreak != 12 {
+		t.Errorf("streak %d, best %d; expected 3 and 12", rm.Streak, rm.BestStreak)
+	}
+	if rm.ByBand["20m"] != 12 || rm.ByBand["40m"] != 3 || rm.ByMode["FT8"] != 12 || rm.ByMode["CW"] != 3 {
+		t.Errorf("unexpected counts by band %v and mode %v", rm.ByBand, rm.ByMode)
+	}
+	if rm.Multipliers["wpx"] != 3 || rm.Multipliers["dxcc"] != 0 {
+		t.Errorf("unexpected multipliers %v", rm.Multipliers)
+	}
+
+	var out bytes.Buffer
+	Print(&out, s.Snapshot())
+	for _, want := range []string{"best 10m 60/hr", "Streak: 3 QSOs (best 12)", "wpx 3", "QSOs by band"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+
+	// A long pause ends the streak and the hour ages out
+	now = now.Add(2 * time.Hour)
+	if rm := s.Snapshot().Rate; rm.Streak != 0 || rm.LastHour != 0 || rm.Best10m != 10 {
+		t.Errorf("after two hours: %+v", rm)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	f := NewFailures(2)
+	f.Add("127.0.0.1:2237", "fldigi", errors.New("no callsign found"), "first")
+	f.Add("127.0.0.1:2237", "fldigi", errors.New("no callsign found"), "second")
+	f.Add("127.0.0.1:2333", "wsjt-x", errors.New("not a QSO"), "\xad\xbc\xcb\xda\x00\x00\x00\x02")
+
+	list := f.List()
+	if len(list) != 2 || list[0].Payload != "second" || list[1].Type != "wsjt-x" {
+		t.Fatalf("expected the last two failures, oldest first, got %+v", list)
+	}
+	if !list[1].Binary || list[1].Payload != "adbccbda00000002" || list[1].Size != 8 {
+		t.Errorf("binary payload should be hex-encoded: %+v", list[1])
+	}
+
+	long := strings.Repeat("x", 2*maxSampleBytes)
+	f.Add("127.0.0.1:2237", "general", errors.New("no callsign found"), long)
+	if last := f.List()[1]; len(last.Payload) != maxSampleBytes || last.Size != len(long) || last.Binary {
+		t.Errorf("long payload should be cut to %d bytes: %d of %d", maxSampleBytes, len(last.Payload), last.Size)
+	}
+
+	var out bytes.Buffer
+	PrintFailures(&out, f.List())
+	if !strings.Contains(out.String(), "hex adbccbda00000002") || !strings.Contains(out.String(), "error:   not a QSO") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	var none *Failures
+	none.Add("", "", errors.New("ignored"), "")
+	if none.List() != nil {
+		t.Error("nil Failures should record nothing")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	s, err := New("")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.Latency("fldigi", 10*time.Second)
+	s.Latency("fldigi", 50*time.Second)
+	s.Latency("fldigi", 30*time.Second)
+	s.Latency("wsjt-x", -2*time.Second) // source clock ahead
+
+	latency := s.Snapshot().Latency
+	if l := latency["fldigi"]; l != (Latency{Count: 3, Last: 30, Average: 30, Max: 50}) {
+		t.Errorf("unexpected fldigi latency %+v", l)
+	}
+	if l := latency["wsjt-x"]; l.Count != 1 || l.Max != 0 {
+		t.Errorf("negative latency should count as zero: %+v", l)
+	}
+
+	var out bytes.Buffer
+	Print(&out, s.Snapshot())
+	if !strings.Contains(out.String(), "last      30s  avg      30s  max      50s  (3 QSOs)") {
+		t.Errorf("report missing fldigi latency:\n%s", out.String())
+	}
+}
@@ -0,0 +1,201 @@
+// Package tlspeer sets up TLS between two relays. Each relay presents its
+// own certificate and accepts the other's if a private CA signed it or its
+// SHA-256 fingerprint is pinned, so self-signed certificates work without
+// running a CA. Host names are not checked: relays are often reached by IP
+// address, and a peer is identified by its certificate alone.
+package tlspeer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config names the files and pins for one relay
+type Config struct {
+	Cert         string   // This relay's certificate (PEM)
+	Key          string   // Its private key (PEM)
+	CA           string   // CA certificate (PEM) that signs trusted peers; may be empty with Fingerprints
+	Fingerprints []string // SHA-256 fingerprints of trusted peer certificates
+}
+
+// Peer holds a relay's certificate and the peers it trusts
+type Peer struct {
+	cert         tls.Certificate
+	roots        *x509.CertPool
+	fingerprints map[string]bool
+}
+
+// Load reads the certificate, key and CA. At least one of CA and
+// Fingerprints is needed, or no peer could ever be trusted.
+func Load(cfg Config) (*Peer, error) {
+	if cfg.Cert == "" || cfg.Key == "" {
+		return nil, errors.New("tls: cert and key are required")
+	}
+	if cfg.CA == "" && len(cfg.Fingerprints) == 0 {
+		return nil, errors.New("tls: ca or fingerprints is required to trust the other relay")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	p := &Peer{cert: cert, fingerprints: make(map[string]bool)}
+
+	if cfg.CA != "" {
+		data, err := os.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		p.roots = x509.NewCertPool()
+		if !p.roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls: no certificates in %s", cfg.CA)
+		}
+	}
+
+	for _, f := range cfg.Fingerprints {
+		normalized, err := normalizeFingerprint(f)
+		if err != nil {
+			return nil, err
+		}
+		p.fingerprints[normalized] = true
+	}
+	return p, nil
+}
+
+// Server returns the TLS configuration for accepting relays. Clients must
+// present a trusted certificate.
+func (p *Peer) Server() *tls.Config {
+	return &tls.Config{
+		Certificates:          []tls.Certificate{p.cert},
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: p.verify,
+		MinVersion:            tls.VersionTLS13,
+	}
+}
+
+// Client returns the TLS configuration for connecting to a relay
+func (p *Peer) Client() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.cert},
+		// The standard verification checks the host name against public
+		// roots; verify replaces it with the CA and pins
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: p.verify,
+		MinVersion:            tls.VersionTLS13,
+	}
+}
+
+// verify accepts a peer whose certificate is pinned or chains to the CA
+func (p *Peer) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("tls: the other relay sent no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tls: bad certificate from the other relay: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	leaf := certs[0]
+	if p.fingerprints[fingerprintHex(leaf)] {
+		return nil
+	}
+	if p.roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         p.roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("tls: certificate %q (fingerprint %s) is not trusted", leaf.Subject.CommonName, Fingerprint(leaf))
+}
+
+// Fingerprint returns a certificate's SHA-256 fingerprint in the form
+// openssl x509 -fingerprint -sha256 prints
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// fingerprintHex returns a certificate's fingerprint as plain hex
+func fingerprintHex(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts a fingerprint with or without colons, in
+// either case
+func normalizeFingerprint(f string) (string, error) {
+	s := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(f), ":", ""))
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("tls: %q is not a SHA-256 fingerprint", f)
+	}
+	return s, nil
+}
+
+// Generate creates a self-signed certificate and key for a relay, valid for
+// both ends of a connection
+func Generate(name string, validity time.Duration) (certPEM, keyPEM []byte, fingerprint string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, Fingerprint(cert), nil
+}
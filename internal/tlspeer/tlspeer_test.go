@@ -0,0 +1,182 @@
+package tlspeer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePair generates a certificate and key in dir and returns their paths
+// and the fingerprint
+func writePair(t *testing.T, dir, name string) (certFile, keyFile, fingerprint string) {
+	t.Helper()
+	certPEM, keyPEM, fingerprint, err := Generate(name, time.Hour)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, fingerprint
+}
+
+// handshake connects a client and a server over loopback TCP and returns
+// their handshake errors
+func handshake(t *testing.T, client, server *Peer) (clientErr, serverErr error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- tls.Server(conn, server.Server()).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), client.Client())
+	if err == nil {
+		conn.Close()
+	}
+	return err, <-done
+}
+
+func TestPinnedHandshake(t *testing.T) {
+	dir := t.TempDir()
+	centralCert, centralKey, centralFP := writePair(t, dir, "central")
+	siteCert, siteKey, siteFP := writePair(t, dir, "site-north")
+	_, _, strangerFP := writePair(t, dir, "stranger")
+
+	central, err := Load(Config{Cert: centralCert, Key: centralKey, Fingerprints: []string{siteFP}})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// Fingerprints may be written without colons and in lower case
+	plain := strings.ToLower(strings.ReplaceAll(centralFP, ":", ""))
+	site, err := Load(Config{Cert: siteCert, Key: siteKey, Fingerprints: []string{plain}})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if clientErr, serverErr := handshake(t, site, central); clientErr != nil || serverErr != nil {
+		t.Fatalf("expected the pinned relays to connect: client %v, server %v", clientErr, serverErr)
+	}
+
+	// The central relay refuses a client it hasn't pinned
+	picky, _ := Load(Config{Cert: centralCert, Key: centralKey, Fingerprints: []string{strangerFP}})
+	if _, serverErr := handshake(t, site, picky); serverErr == nil || !strings.Contains(serverErr.Error(), siteFP) {
+		t.Errorf("expected the server to refuse site-north by fingerprint, got %v", serverErr)
+	}
+
+	// And the remote relay refuses a server it hasn't pinned
+	wary, _ := Load(Config{Cert: siteCert, Key: siteKey, Fingerprints: []string{strangerFP}})
+	if clientErr, _ := handshake(t, wary, central); clientErr == nil {
+		t.Error("expected the client to refuse an unpinned server")
+	}
+}
+
+// writeSigned creates a CA in dir, or with ca set a certificate signed by
+// it, and returns the certificate and key paths
+func writeSigned(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (string, string, *x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca, caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, cert, key
+}
+
+func TestCAHandshake(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _, ca, caKey := writeSigned(t, dir, "contest-ca", nil, nil)
+	centralCert, centralKey, _, _ := writeSigned(t, dir, "central", ca, caKey)
+	siteCert, siteKey, _, _ := writeSigned(t, dir, "site-north", ca, caKey)
+	selfCert, selfKey, _ := writePair(t, dir, "stranger")
+
+	central, err := Load(Config{Cert: centralCert, Key: centralKey, CA: caFile})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	site, err := Load(Config{Cert: siteCert, Key: siteKey, CA: caFile})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if clientErr, serverErr := handshake(t, site, central); clientErr != nil || serverErr != nil {
+		t.Fatalf("expected relays signed by the CA to connect: client %v, server %v", clientErr, serverErr)
+	}
+
+	stranger, _ := Load(Config{Cert: selfCert, Key: selfKey, CA: caFile})
+	if _, serverErr := handshake(t, stranger, central); serverErr == nil {
+		t.Error("expected the server to refuse a certificate the CA didn't sign")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, _ := writePair(t, dir, "relay")
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no key", Config{Cert: cert, Fingerprints: []string{strings.Repeat("ab", 32)}}},
+		{"nothing trusted", Config{Cert: cert, Key: key}},
+		{"bad fingerprint", Config{Cert: cert, Key: key, Fingerprints: []string{"AB:CD"}}},
+		{"missing ca", Config{Cert: cert, Key: key, CA: filepath.Join(dir, "ca.crt")}},
+		{"ca without certificates", Config{Cert: cert, Key: key, CA: key}},
+	}
+	for _, tt := range tests {
+		if _, err := Load(tt.cfg); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
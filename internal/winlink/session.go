@@ -0,0 +1,126 @@
+package winlink
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Winlink Express session logs are plain text, one event per line:
+//
+//	2024/06/01 14:23:01 *** Connected to KN6KB-10 (VARA HF)
+//	2024/06/01 14:23:02 Dial frequency: 14103.000 kHz
+//	...
+//	2024/06/01 14:25:30 *** Disconnected from KN6KB-10
+
+var (
+	timestampRegex  = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})`)
+	connectRegex    = regexp.MustCompile(`(?i)\*\*\*\s*(?:connected (?:to|with)|connection from)\s+([A-Z0-9/]+)(?:-\d+)?`)
+	disconnectRegex = regexp.MustCompile(`(?i)\*\*\*\s*(?:disconnected|connection closed|session ended)`)
+	modeRegex       = regexp.MustCompile(`(?i)\b(VARA HF|VARA FM|VARA|ARDOP|PACTOR(?: [1-4])?|PACKET)\b`)
+	freqRegex       = regexp.MustCompile(`(?i)(?:dial|center|freq(?:uency)?)[^0-9]*(\d+\.?\d*)\s*(khz|mhz|hz)?`)
+)
+
+// session is a connection in progress
+type session struct {
+	call      string
+	mode      string
+	frequency int64 // Hz, 0 if the log didn't mention it
+	start     time.Time
+}
+
+// SessionParser turns session log lines into QSOs, one per completed connection
+type SessionParser struct {
+	defaultMode string
+	current     *session
+}
+
+// NewSessionParser creates a parser; defaultMode is used when the log does not name the mode
+func NewSessionParser(defaultMode string) *SessionParser {
+	if defaultMode == "" {
+		defaultMode = "VARA HF"
+	}
+	return &SessionParser{defaultMode: defaultMode}
+}
+
+// Feed processes one log line and returns a QSO when it completes a connection
+func (p *SessionParser) Feed(line string) *formatter.QSO {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	lineTime := time.Now().UTC()
+	if match := timestampRegex.FindStringSubmatch(line); len(match) > 1 {
+		// Winlink Express writes its session logs in UTC
+		if t, err := time.ParseInLocation("2006/01/02 15:04:05", match[1], time.UTC); err == nil {
+			lineTime = t
+		}
+	}
+
+	if match := connectRegex.FindStringSubmatch(line); len(match) > 1 {
+		p.current = &session{
+			call:  strings.ToUpper(match[1]),
+			mode:  p.defaultMode,
+			start: lineTime,
+		}
+		p.updateSession(line)
+		return nil
+	}
+
+	if p.current == nil {
+		return nil
+	}
+
+	if disconnectRegex.MatchString(line) {
+		s := p.current
+		p.current = nil
+		qso := &formatter.QSO{
+			Callsign: s.call,
+			Mode:     s.mode,
+			DateTime: s.start,
+		}
+		if s.frequency > 0 {
+			qso.FrequencyHz = s.frequency
+			qso.Frequency = formatter.FormatMHz(s.frequency)
+			qso.Band = formatter.FrequencyToBand(float64(s.frequency) / 1e6)
+		}
+		return qso
+	}
+
+	p.updateSession(line)
+	return nil
+}
+
+// updateSession records mode and frequency details mentioned during a connection
+func (p *SessionParser) updateSession(line string) {
+	if match := modeRegex.FindStringSubmatch(line); len(match) > 1 {
+		p.current.mode = strings.ToUpper(match[1])
+	}
+
+	if match := freqRegex.FindStringSubmatch(line); len(match) > 1 {
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return
+		}
+		var hz int64
+		switch strings.ToLower(match[2]) {
+		case "khz":
+			hz = int64(value*1e3 + 0.5)
+		case "mhz":
+			hz = int64(value*1e6 + 0.5)
+		case "hz":
+			hz = int64(value + 0.5)
+		default:
+			parsed, err := formatter.ParseFrequency(match[1])
+			if err != nil {
+				return
+			}
+			hz = parsed
+		}
+		p.current.frequency = hz
+	}
+}
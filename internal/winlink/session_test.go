@@ -0,0 +1,58 @@
+package winlink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionParser(t *testing.T) {
+	p := NewSessionParser("")
+
+	lines := []string{
+		"2024/06/01 14:22:58 *** Connecting to KN6KB-10",
+		"2024/06/01 14:23:01 *** Connected to KN6KB-10 (VARA HF)",
+		"2024/06/01 14:23:02 Dial frequency: 14103.000 kHz",
+		"2024/06/01 14:24:10 [WL2K-5.0-B2FWIHJM$]",
+	}
+	for _, line := range lines {
+		if qso := p.Feed(line); qso != nil {
+			t.Fatalf("unexpected QSO before disconnect: %+v", qso)
+		}
+	}
+
+	qso := p.Feed("2024/06/01 14:25:30 *** Disconnected from KN6KB-10")
+	if qso == nil {
+		t.Fatal("expected QSO on disconnect")
+	}
+
+	if qso.Callsign != "KN6KB" {
+		t.Errorf("Callsign = %q, want KN6KB", qso.Callsign)
+	}
+	if qso.Mode != "VARA HF" {
+		t.Errorf("Mode = %q, want VARA HF", qso.Mode)
+	}
+	if qso.FrequencyHz != 14103000 || qso.Band != "20m" {
+		t.Errorf("frequency = %d Hz band %q, want 14103000 Hz 20m", qso.FrequencyHz, qso.Band)
+	}
+	want := time.Date(2024, 6, 1, 14, 23, 1, 0, time.UTC)
+	if !qso.DateTime.Equal(want) {
+		t.Errorf("DateTime = %v, want %v", qso.DateTime, want)
+	}
+
+	// A disconnect without a connection doesn't produce a QSO
+	if qso := p.Feed("2024/06/01 14:26:00 *** Disconnected"); qso != nil {
+		t.Errorf("unexpected QSO: %+v", qso)
+	}
+}
+
+func TestSessionParserDefaultMode(t *testing.T) {
+	p := NewSessionParser("ARDOP")
+	p.Feed("2024/06/01 10:00:00 *** Connected to W1AW")
+	qso := p.Feed("2024/06/01 10:02:00 *** Disconnected")
+	if qso == nil || qso.Mode != "ARDOP" {
+		t.Fatalf("expected ARDOP QSO, got %+v", qso)
+	}
+	if qso.Frequency != "" {
+		t.Errorf("Frequency = %q, want empty", qso.Frequency)
+	}
+}
@@ -0,0 +1,124 @@
+package winlink
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Tailer follows Winlink Express / VARA session log files and reports each
+// completed connection as a QSO
+type Tailer struct {
+	patterns []string
+	interval time.Duration
+	parser   *SessionParser
+	handler  func(*formatter.QSO)
+
+	offsets map[string]int64  // read position per file
+	partial map[string]string // incomplete trailing line per file
+}
+
+// NewTailer creates a tailer for the files matching the glob patterns.
+// handler is called from the tailer's goroutine for every completed session.
+func NewTailer(patterns []string, defaultMode string, interval time.Duration, handler func(*formatter.QSO)) *Tailer {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &Tailer{
+		patterns: patterns,
+		interval: interval,
+		parser:   NewSessionParser(defaultMode),
+		handler:  handler,
+		offsets:  make(map[string]int64),
+		partial:  make(map[string]string),
+	}
+}
+
+// Run polls the log files until ctx is cancelled. Files that exist at
+// startup are read from their current end so old sessions aren't re-logged;
+// files created later (daily rotation) are read from the beginning.
+func (t *Tailer) Run(ctx context.Context) error {
+	for _, path := range t.matches() {
+		if info, err := os.Stat(path); err == nil {
+			t.offsets[path] = info.Size()
+		}
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, path := range t.matches() {
+				t.poll(path)
+			}
+		}
+	}
+}
+
+// matches expands the configured glob patterns
+func (t *Tailer) matches() []string {
+	var paths []string
+	for _, pattern := range t.patterns {
+		found, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Printf("Invalid Winlink log pattern %q: %v", pattern, err)
+			continue
+		}
+		paths = append(paths, found...)
+	}
+	return paths
+}
+
+// poll reads any new lines from one file
+func (t *Tailer) poll(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	offset := t.offsets[path]
+	if info.Size() < offset {
+		// File was truncated or replaced, start over
+		offset = 0
+		t.partial[path] = ""
+	}
+	if info.Size() == offset {
+		return
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Failed to read Winlink log %s: %v", path, err)
+		return
+	}
+	t.offsets[path] = offset + int64(len(data))
+
+	text := t.partial[path] + string(data)
+	lines := strings.Split(text, "\n")
+	t.partial[path] = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		if qso := t.parser.Feed(strings.TrimRight(line, "\r")); qso != nil {
+			t.handler(qso)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package workeddb is the worked-before database: every call, band/mode slot
+// and DXCC entity worked, bootstrapped from the station's master ADIF log
+// and kept up to date with the QSOs the relay forwards.
+package workeddb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// Contact is one worked call on a band and mode, as stored in the database
+type Contact struct {
+	Call   string    `json:"call"`
+	Band   string    `json:"band"`
+	Mode   string    `json:"mode"`
+	Entity string    `json:"entity,omitempty"` // DXCC entity, when a country file was loaded
+	Time   time.Time `json:"time"`             // When the first QSO in this slot was made
+}
+
+// Status tells what a QSO would be new for
+type Status struct {
+	NewCall   bool `json:"new_call"`
+	NewSlot   bool `json:"new_slot"` // first QSO with the call on this band and mode
+	NewEntity bool `json:"new_entity"`
+}
+
+// Tag returns the most significant news as a short comment tag, or "" for
+// a dupe
+func (s Status) Tag() string {
+	switch {
+	case s.NewEntity:
+		return "NEW DXCC"
+	case s.NewCall:
+		return "NEW CALL"
+	case s.NewSlot:
+		return "NEW BAND/MODE"
+	}
+	return ""
+}
+
+// Record is everything known about one call
+type Record struct {
+	Call   string    `json:"call"`
+	Entity string    `json:"entity,omitempty"`
+	Slots  []Contact `json:"slots"`
+}
+
+// DB is the worked-before database. It is an append-only JSON-lines file
+// holding one line per new slot, indexed in memory.
+type DB struct {
+	path string
+	file *os.File
+
+	mu       sync.RWMutex
+	calls    map[string]map[string]Contact // call -> slot -> first contact
+	entities map[string]bool
+}
+
+// Slot is the band and mode key calls are tracked under. FT4 is logged as
+// MODE MFSK in ADIF, so MFSK matches WSJT-X's FT4.
+func Slot(band, mode string) string {
+	mode = strings.ToUpper(mode)
+	if mode == "MFSK" {
+		mode = "FT4"
+	}
+	return strings.ToLower(band) + "/" + mode
+}
+
+// Open loads the database at path, creating it if needed
+func Open(path string) (*DB, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create worked-before directory: %w", err)
+		}
+	}
+
+	db := &DB{path: path, calls: make(map[string]map[string]Contact), entities: make(map[string]bool)}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worked-before database: %w", err)
+	}
+	db.file = file
+	return db, nil
+}
+
+// load indexes the contacts already in the file
+func (db *DB) load() error {
+	file, err := os.Open(db.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read worked-before database: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var c Contact
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil || c.Call == "" {
+			// Skip a partially written last line rather than failing the whole load
+			continue
+		}
+		db.index(c)
+	}
+	return scanner.Err()
+}
+
+// index adds a contact to the in-memory index and reports whether its slot
+// was new. The caller holds the lock or is loading.
+func (db *DB) index(c Contact) bool {
+	slots := db.calls[c.Call]
+	if slots == nil {
+		slots = make(map[string]Contact)
+		db.calls[c.Call] = slots
+	}
+	if c.Entity != "" {
+		db.entities[c.Entity] = true
+	}
+
+	slot := Slot(c.Band, c.Mode)
+	if _, ok := slots[slot]; ok {
+		return false
+	}
+	slots[slot] = c
+	return true
+}
+
+// Check reports what a QSO with call on band and mode would be new for.
+// entity may be empty when no country file is loaded.
+func (db *DB) Check(call, band, mode, entity string) Status {
+	call = formatter.SanitizeCallsign(call)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	slots, worked := db.calls[call]
+	_, slotWorked := slots[Slot(band, mode)]
+	return Status{
+		NewCall:   !worked,
+		NewSlot:   !slotWorked,
+		NewEntity: entity != "" && !db.entities[entity],
+	}
+}
+
+// Add records a contact and reports whether it was the first in its slot.
+// Only the first contact in a slot is written.
+func (db *DB) Add(c Contact) (bool, error) {
+	c.Call = formatter.SanitizeCallsign(c.Call)
+	if c.Call == "" {
+		return false, fmt.Errorf("contact without a callsign")
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if !db.index(c) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return true, fmt.Errorf("failed to encode worked-before contact: %w", err)
+	}
+	if _, err := db.file.Write(append(data, '\n')); err != nil {
+		return true, fmt.Errorf("failed to write worked-before database: %w", err)
+	}
+	return true, nil
+}
+
+// Lookup returns what has been worked with call; ok is false for a call
+// never worked
+func (db *DB) Lookup(call string) (Record, bool) {
+	call = formatter.SanitizeCallsign(call)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	slots, ok := db.calls[call]
+	if !ok {
+		return Record{Call: call, Slots: []Contact{}}, false
+	}
+
+	rec := Record{Call: call, Slots: make([]Contact, 0, len(slots))}
+	for _, c := range slots {
+		rec.Slots = append(rec.Slots, c)
+		if c.Entity != "" {
+			rec.Entity = c.Entity
+		}
+	}
+	sort.Slice(rec.Slots, func(i, j int) bool { return rec.Slots[i].Time.Before(rec.Slots[j].Time) })
+	return rec, true
+}
+
+// Counts returns the number of calls, slots and DXCC entities worked
+func (db *DB) Counts() (calls, slots, entities int) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, s := range db.calls {
+		slots += len(s)
+	}
+	return len(db.calls), slots, len(db.entities)
+}
+
+// Import adds the QSOs of an ADIF log, e.g. an export of the station's
+// master log. cty, if set, assigns DXCC entities. It returns the number of
+// QSOs read and how many of them were in a new slot.
+func (db *DB) Import(r io.Reader, cty *formatter.CTY) (read, added int, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read ADIF: %w", err)
+	}
+
+	f := formatter.New("", "", "")
+	for _, record := range formatter.SplitRecords(string(data)) {
+		qso, err := f.ParseMessage(record, formatter.MessageTypeFldigi)
+		if err != nil {
+			continue
+		}
+		read++
+
+		c := Contact{Call: qso.Callsign, Band: qso.Band, Mode: qso.Mode, Time: qso.DateTime.UTC()}
+		if cty != nil {
+			c.Entity, _ = cty.Entity(qso.Callsign)
+		}
+		formatter.ReleaseQSO(qso)
+
+		isNew, err := db.Add(c)
+		if err != nil {
+			return read, added, err
+		}
+		if isNew {
+			added++
+		}
+	}
+
+	if read == 0 {
+		return 0, 0, fmt.Errorf("no QSOs found in ADIF")
+	}
+	return read, added, nil
+}
+
+// Close closes the database file
+func (db *DB) Close() error {
+	return db.file.Close()
+}
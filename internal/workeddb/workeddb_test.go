@@ -0,0 +1,88 @@
+package workeddb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+const masterLog = `Exported by a logger
+<ADIF_VER:5>3.1.4 <EOH>
+<CALL:5>K1ABC <BAND:3>20m <MODE:3>FT8 <QSO_DATE:8>20240601 <TIME_ON:4>1200 <EOR>
+<CALL:5>K1ABC <BAND:3>40m <MODE:2>CW <QSO_DATE:8>20240602 <TIME_ON:4>0100 <EOR>
+<CALL:6>DL1XYZ <BAND:3>20m <MODE:4>MFSK <SUBMODE:3>FT4 <QSO_DATE:8>20240603 <TIME_ON:4>1500 <EOR>
+<CALL:5>K1ABC <BAND:3>20m <MODE:3>FT8 <QSO_DATE:8>20240604 <TIME_ON:4>1200 <EOR>
+`
+
+const cty = `United States:            05:  08:  NA:   37.53:    91.67:     5.0:  K:
+    K,N,W;
+Fed. Rep. of Germany:     14:  28:  EU:   51.00:   -10.00:    -1.0:  DL:
+    DA,DL;
+Japan:                    25:  45:  AS:   36.40:  -138.38:    -9.0:  JA:
+    JA;
+`
+
+func TestImportAndCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worked.jsonl")
+	countries, err := formatter.ParseCTY(cty)
+	if err != nil {
+		t.Fatalf("ParseCTY failed: %v", err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	read, added, err := db.Import(strings.NewReader(masterLog), countries)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if read != 4 || added != 3 {
+		t.Errorf("Import read %d and added %d, expected 4 and 3", read, added)
+	}
+	db.Close()
+
+	// Reopening loads the file again
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	if calls, slots, entities := db.Counts(); calls != 2 || slots != 3 || entities != 2 {
+		t.Errorf("counts %d calls, %d slots, %d entities", calls, slots, entities)
+	}
+
+	tests := []struct {
+		call, band, mode, entity string
+		want                     string
+	}{
+		{"K1ABC", "20m", "FT8", "United States", ""},
+		{"DL1XYZ", "20m", "FT4", "Fed. Rep. of Germany", ""}, // logged as MFSK
+		{"K1ABC", "15m", "FT8", "United States", "NEW BAND/MODE"},
+		{"W1AW", "20m", "FT8", "United States", "NEW CALL"},
+		{"JA1ABC", "20m", "FT8", "Japan", "NEW DXCC"},
+		{"JA1ABC", "20m", "FT8", "", "NEW CALL"}, // no country file
+	}
+	for _, tt := range tests {
+		if got := db.Check(tt.call, tt.band, tt.mode, tt.entity).Tag(); got != tt.want {
+			t.Errorf("Check(%s, %s, %s) = %q, want %q", tt.call, tt.band, tt.mode, got, tt.want)
+		}
+	}
+
+	if isNew, err := db.Add(Contact{Call: "ja1abc", Band: "20m", Mode: "FT8", Entity: "Japan"}); err != nil || !isNew {
+		t.Errorf("Add returned %t, %v", isNew, err)
+	}
+	if db.Check("JA2XYZ", "40m", "CW", "Japan").NewEntity {
+		t.Error("Japan should be worked after adding JA1ABC")
+	}
+
+	record, ok := db.Lookup("k1abc")
+	if !ok || len(record.Slots) != 2 || record.Entity != "United States" || record.Slots[0].Band != "20m" {
+		t.Errorf("unexpected lookup %+v", record)
+	}
+	if _, ok := db.Lookup("N0CALL"); ok {
+		t.Error("N0CALL should not be worked")
+	}
+}
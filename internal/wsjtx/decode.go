@@ -0,0 +1,86 @@
+package wsjtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Decode is a message WSJT-X decoded from the band
+type Decode struct {
+	New            bool          // False for decodes WSJT-X repeats on request
+	Time           time.Duration // Since midnight UTC
+	SNR            int           // dB
+	DeltaTime      float64       // Seconds
+	DeltaFrequency uint32        // Audio offset in Hz
+	Mode           string        // Mode character, e.g. "~" for FT8
+	Message        string        // e.g. "CQ K1ABC FN42"
+	LowConfidence  bool
+	OffAir         bool // Decoded from a recording, not the radio
+}
+
+// ParseDecode decodes a Decode message; ok is false if data is not one
+func ParseDecode(data []byte) (d Decode, ok bool) {
+	h, ok := ParseHeader(data)
+	if !ok || h.Type != MessageDecode {
+		return d, false
+	}
+
+	// Skip magic, schema, type and id
+	r := bytes.NewReader(data[12+4+len(h.ID):])
+	var fields struct {
+		New       bool
+		Time      uint32 // QTime: milliseconds since midnight
+		SNR       int32
+		DeltaTime float64
+		DeltaFreq uint32
+	}
+	if binary.Read(r, binary.BigEndian, &fields) != nil {
+		return d, false
+	}
+	d.New = fields.New
+	d.Time = time.Duration(fields.Time) * time.Millisecond
+	d.SNR = int(fields.SNR)
+	d.DeltaTime = fields.DeltaTime
+	d.DeltaFrequency = fields.DeltaFreq
+
+	if d.Mode, ok = readUTF8(r); !ok {
+		return d, false
+	}
+	if d.Message, ok = readUTF8(r); !ok {
+		return d, false
+	}
+	// Older WSJT-X versions end the message here
+	var flags [2]bool
+	binary.Read(r, binary.BigEndian, &flags)
+	d.LowConfidence, d.OffAir = flags[0], flags[1]
+	return d, true
+}
+
+// gridRegex matches a four-character Maidenhead locator
+var gridRegex = regexp.MustCompile(`^[A-R]{2}[0-9]{2}$`)
+
+// ParseCQ returns the calling station and its grid from a CQ message such as
+// "CQ K1ABC FN42", "CQ DX K1ABC FN42" or "CQ POTA K1ABC". ok is false for
+// anything that is not a CQ.
+func ParseCQ(message string) (call, grid string, ok bool) {
+	words := strings.Fields(strings.ToUpper(message))
+	if len(words) < 2 || words[0] != "CQ" {
+		return "", "", false
+	}
+	words = words[1:]
+
+	// A directed CQ names the target area or activity before the call; the
+	// call is the word before the grid, or the last word without one
+	if last := words[len(words)-1]; gridRegex.MatchString(last) && last != "RR73" && len(words) > 1 {
+		grid = last
+		words = words[:len(words)-1]
+	}
+	call = words[len(words)-1]
+	if !strings.ContainsAny(call, "0123456789") {
+		return "", "", false
+	}
+	return call, grid, true
+}
@@ -0,0 +1,134 @@
+package wsjtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// julianUnixEpoch is the Julian day number of 1970-01-01, as QDate counts
+const julianUnixEpoch = 2440588
+
+// QSOLogged is the binary QSO Logged message WSJT-X sends when a QSO is
+// logged, just before the Logged ADIF message for the same QSO. It carries
+// the exchanges and comments the ADIF record leaves out.
+type QSOLogged struct {
+	TimeOff          time.Time
+	DXCall           string
+	DXGrid           string
+	TxFrequency      uint64 // Hz
+	Mode             string
+	ReportSent       string
+	ReportReceived   string
+	TxPower          string
+	Comments         string
+	Name             string
+	TimeOn           time.Time
+	OperatorCall     string
+	MyCall           string
+	MyGrid           string
+	ExchangeSent     string
+	ExchangeReceived string
+}
+
+// ParseQSOLogged decodes a QSO Logged message; ok is false if data is not
+// one. Fields added by later WSJT-X versions are left empty when missing.
+func ParseQSOLogged(data []byte) (q QSOLogged, ok bool) {
+	h, ok := ParseHeader(data)
+	if !ok || h.Type != MessageQSOLogged {
+		return q, false
+	}
+
+	// Skip magic, schema, type and id
+	r := bytes.NewReader(data[12+4+len(h.ID):])
+	if q.TimeOff, ok = readDateTime(r); !ok {
+		return q, false
+	}
+	for _, s := range []*string{&q.DXCall, &q.DXGrid} {
+		if *s, ok = readUTF8(r); !ok {
+			return q, false
+		}
+	}
+	if binary.Read(r, binary.BigEndian, &q.TxFrequency) != nil {
+		return q, false
+	}
+	for _, s := range []*string{&q.Mode, &q.ReportSent, &q.ReportReceived, &q.TxPower, &q.Comments, &q.Name} {
+		if *s, ok = readUTF8(r); !ok {
+			return q, false
+		}
+	}
+
+	// Time on and everything after it came with WSJT-X 2.0
+	if r.Len() == 0 {
+		q.TimeOn = q.TimeOff
+		return q, true
+	}
+	if q.TimeOn, ok = readDateTime(r); !ok {
+		return q, false
+	}
+	for _, s := range []*string{&q.OperatorCall, &q.MyCall, &q.MyGrid, &q.ExchangeSent, &q.ExchangeReceived} {
+		if r.Len() == 0 {
+			break
+		}
+		if *s, ok = readUTF8(r); !ok {
+			return q, false
+		}
+	}
+	return q, true
+}
+
+// readDateTime reads a QDateTime: the Julian day, the milliseconds since
+// midnight and the time spec, followed by the UTC offset in seconds for
+// Qt::OffsetFromUTC. WSJT-X always sends UTC; time zone specs are rejected.
+func readDateTime(r *bytes.Reader) (time.Time, bool) {
+	var day int64
+	var ms uint32
+	var spec uint8
+	if binary.Read(r, binary.BigEndian, &day) != nil ||
+		binary.Read(r, binary.BigEndian, &ms) != nil ||
+		binary.Read(r, binary.BigEndian, &spec) != nil {
+		return time.Time{}, false
+	}
+
+	t := time.Unix((day-julianUnixEpoch)*86400, 0).UTC().Add(time.Duration(ms) * time.Millisecond)
+	switch spec {
+	case 0, 1: // local time, UTC
+	case 2: // offset from UTC
+		var offset int32
+		if binary.Read(r, binary.BigEndian, &offset) != nil {
+			return time.Time{}, false
+		}
+		t = t.Add(-time.Duration(offset) * time.Second)
+	default:
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// dateTime writes t as a UTC QDateTime
+func (e *encoder) dateTime(t time.Time) {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	binary.Write(&e.Buffer, binary.BigEndian, midnight.Unix()/86400+julianUnixEpoch)
+	e.uint32(uint32(t.Sub(midnight) / time.Millisecond))
+	e.WriteByte(1) // Qt::UTC
+}
+
+// QSOLoggedMessage encodes a QSO Logged message from the instance id, as
+// WSJT-X 2.0 and later send it
+func QSOLoggedMessage(id string, q QSOLogged) []byte {
+	e := newMessage(MessageQSOLogged, id)
+	e.dateTime(q.TimeOff)
+	e.utf8(q.DXCall)
+	e.utf8(q.DXGrid)
+	binary.Write(&e.Buffer, binary.BigEndian, q.TxFrequency)
+	for _, s := range []string{q.Mode, q.ReportSent, q.ReportReceived, q.TxPower, q.Comments, q.Name} {
+		e.utf8(s)
+	}
+	e.dateTime(q.TimeOn)
+	for _, s := range []string{q.OperatorCall, q.MyCall, q.MyGrid, q.ExchangeSent, q.ExchangeReceived} {
+		e.utf8(s)
+	}
+	e.utf8("") // ADIF propagation mode
+	return e.Bytes()
+}
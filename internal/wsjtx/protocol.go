@@ -0,0 +1,269 @@
+package wsjtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Magic starts every WSJT-X UDP datagram
+const Magic uint32 = 0xadbccbda
+
+// SchemaVersion is the protocol schema the relay speaks
+const SchemaVersion uint32 = 2
+
+// NoChange leaves a numeric Configure field unchanged in WSJT-X
+const NoChange = ^uint32(0)
+
+// MessageType identifies a WSJT-X UDP message
+type MessageType uint32
+
+// Message types from NetworkMessage.hpp in the WSJT-X sources
+const (
+	MessageHeartbeat           MessageType = 0
+	MessageStatus              MessageType = 1
+	MessageDecode              MessageType = 2
+	MessageClear               MessageType = 3
+	MessageReply               MessageType = 4
+	MessageQSOLogged           MessageType = 5
+	MessageClose               MessageType = 6
+	MessageReplay              MessageType = 7
+	MessageHaltTx              MessageType = 8
+	MessageFreeText            MessageType = 9
+	MessageWSPRDecode          MessageType = 10
+	MessageLocation            MessageType = 11
+	MessageLoggedADIF          MessageType = 12
+	MessageHighlightCallsign   MessageType = 13
+	MessageSwitchConfiguration MessageType = 14
+	MessageConfigure           MessageType = 15
+)
+
+// Header is the common start of every message
+type Header struct {
+	Schema uint32
+	Type   MessageType
+	ID     string // Unique id of the WSJT-X instance, e.g. "WSJT-X"
+}
+
+// ParseHeader decodes the header of a WSJT-X datagram; ok is false if the
+// data is not a WSJT-X message
+func ParseHeader(data []byte) (h Header, ok bool) {
+	r := bytes.NewReader(data)
+
+	var magic uint32
+	if binary.Read(r, binary.BigEndian, &magic) != nil || magic != Magic {
+		return h, false
+	}
+	if binary.Read(r, binary.BigEndian, &h.Schema) != nil {
+		return h, false
+	}
+	var msgType uint32
+	if binary.Read(r, binary.BigEndian, &msgType) != nil {
+		return h, false
+	}
+	h.Type = MessageType(msgType)
+
+	id, ok := readUTF8(r)
+	if !ok {
+		return h, false
+	}
+	h.ID = id
+	return h, true
+}
+
+// Status is the start of the Status message WSJT-X sends when its dial
+// frequency, mode or other state changes
+type Status struct {
+	DialFrequency uint64 // Hz
+	Mode          string // e.g. FT8
+	DXCall        string // Station being worked, empty between QSOs
+	DXGrid        string // Its grid, when WSJT-X has decoded one
+}
+
+// ParseStatus decodes the dial frequency, mode and DX station of a Status
+// message; ok is false if data is not a Status message. The DX station is
+// left empty if the message ends early.
+func ParseStatus(data []byte) (s Status, ok bool) {
+	h, ok := ParseHeader(data)
+	if !ok || h.Type != MessageStatus {
+		return s, false
+	}
+
+	// Skip magic, schema, type and id
+	r := bytes.NewReader(data[12+4+len(h.ID):])
+	if binary.Read(r, binary.BigEndian, &s.DialFrequency) != nil {
+		return s, false
+	}
+	if s.Mode, ok = readUTF8(r); !ok {
+		return s, false
+	}
+
+	// DX call, report, Tx mode, three flags (Tx enabled, transmitting,
+	// decoding), Rx and Tx audio offsets, DE call, DE grid, DX grid
+	dxCall, ok := readUTF8(r)
+	if !ok {
+		return s, true
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := readUTF8(r); !ok {
+			return s, true
+		}
+	}
+	var skip [3 + 4 + 4]byte
+	if _, err := io.ReadFull(r, skip[:]); err != nil {
+		return s, true
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := readUTF8(r); !ok {
+			return s, true
+		}
+	}
+	dxGrid, ok := readUTF8(r)
+	if !ok {
+		return s, true
+	}
+	s.DXCall, s.DXGrid = dxCall, dxGrid
+	return s, true
+}
+
+// readUTF8 reads a QDataStream QByteArray: a length (0xffffffff for null)
+// followed by the bytes
+func readUTF8(r *bytes.Reader) (string, bool) {
+	var n uint32
+	if binary.Read(r, binary.BigEndian, &n) != nil {
+		return "", false
+	}
+	if n == 0xffffffff {
+		return "", true
+	}
+	if int64(n) > int64(r.Len()) {
+		return "", false
+	}
+	buf := make([]byte, n)
+	if _, err := r.Read(buf); err != nil && n > 0 {
+		return "", false
+	}
+	return string(buf), true
+}
+
+// encoder builds a message in QDataStream format
+type encoder struct {
+	bytes.Buffer
+}
+
+// newMessage starts a message of the given type for the WSJT-X instance id
+func newMessage(t MessageType, id string) *encoder {
+	e := &encoder{}
+	e.uint32(Magic)
+	e.uint32(SchemaVersion)
+	e.uint32(uint32(t))
+	e.utf8(id)
+	return e
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.Write(&e.Buffer, binary.BigEndian, v)
+}
+
+func (e *encoder) utf8(s string) {
+	e.uint32(uint32(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+}
+
+// Configure changes WSJT-X settings remotely. Empty strings and NoChange
+// leave the corresponding setting alone. WSJT-X has no message to change the
+// dial frequency.
+type Configure struct {
+	Mode               string
+	FrequencyTolerance uint32
+	Submode            string
+	FastMode           bool
+	TRPeriod           uint32
+	RxDF               uint32
+	DXCall             string
+	DXGrid             string
+	GenerateMessages   bool
+}
+
+// ConfigureMessage encodes a Configure message for the instance id
+func ConfigureMessage(id string, c Configure) []byte {
+	e := newMessage(MessageConfigure, id)
+	e.utf8(c.Mode)
+	e.uint32(c.FrequencyTolerance)
+	e.utf8(c.Submode)
+	e.bool(c.FastMode)
+	e.uint32(c.TRPeriod)
+	e.uint32(c.RxDF)
+	e.utf8(c.DXCall)
+	e.utf8(c.DXGrid)
+	e.bool(c.GenerateMessages)
+	return e.Bytes()
+}
+
+// Color is an RGB color for HighlightCallsign. The zero Color is "invalid"
+// in Qt terms, which tells WSJT-X to remove a highlight.
+type Color struct {
+	R, G, B uint8
+	Valid   bool
+}
+
+// ParseColor parses a "#rrggbb" color; an empty string is the zero Color
+func ParseColor(s string) (Color, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Color{}, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return Color{}, fmt.Errorf("invalid color %q, want #rrggbb", s)
+	}
+	return Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), Valid: true}, nil
+}
+
+// color writes a QColor: spec, then alpha, red, green, blue and padding as
+// 16-bit values
+func (e *encoder) color(c Color) {
+	if !c.Valid {
+		e.WriteByte(0) // QColor::Invalid
+		e.Write(make([]byte, 10))
+		return
+	}
+	e.WriteByte(1) // QColor::Rgb
+	for _, v := range []uint8{0xff, c.R, c.G, c.B} {
+		binary.Write(&e.Buffer, binary.BigEndian, uint16(v)*0x101)
+	}
+	binary.Write(&e.Buffer, binary.BigEndian, uint16(0))
+}
+
+// HighlightCallsignMessage encodes a HighlightCallsign message that colors
+// call in the band activity window of the instance id. Zero colors remove
+// the highlight. With last set only the most recent occurrence is colored.
+func HighlightCallsignMessage(id, call string, background, foreground Color, last bool) []byte {
+	e := newMessage(MessageHighlightCallsign, id)
+	e.utf8(call)
+	e.color(background)
+	e.color(foreground)
+	e.bool(last)
+	return e.Bytes()
+}
+
+// IsMode reports whether mode is one WSJT-X can switch to
+func IsMode(mode string) bool {
+	switch mode {
+	case "FT8", "FT4", "JT4", "JT9", "JT65", "Q65", "MSK144", "FST4", "FST4W", "WSPR", "ECHO", "FREQCAL":
+		return true
+	}
+	return false
+}
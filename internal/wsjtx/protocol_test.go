@@ -0,0 +1,183 @@
+package wsjtx
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestConfigureMessage(t *testing.T) {
+	msg := ConfigureMessage("WSJT-X", Configure{
+		Mode:               "FT4",
+		FrequencyTolerance: NoChange,
+		TRPeriod:           NoChange,
+		RxDF:               NoChange,
+	})
+
+	h, ok := ParseHeader(msg)
+	if !ok {
+		t.Fatal("ParseHeader failed on encoded message")
+	}
+	if h.Schema != SchemaVersion || h.Type != MessageConfigure || h.ID != "WSJT-X" {
+		t.Errorf("unexpected header: %+v", h)
+	}
+
+	// magic, schema, type, id(4+6), mode(4+3), tolerance, submode(4), fast, period, rxdf, dxcall(4), dxgrid(4), generate
+	if want := 4 + 4 + 4 + 10 + 7 + 4 + 4 + 1 + 4 + 4 + 4 + 4 + 1; len(msg) != want {
+		t.Errorf("message length = %d, want %d", len(msg), want)
+	}
+	if !bytes.Contains(msg, []byte("\x00\x00\x00\x03FT4\xff\xff\xff\xff")) {
+		t.Errorf("mode and tolerance not encoded as expected: % x", msg)
+	}
+}
+
+func TestParseHeaderRejectsOtherData(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("<contactinfo>"), {0xad, 0xbc, 0xcb, 0xda, 0, 0}} {
+		if _, ok := ParseHeader(data); ok {
+			t.Errorf("ParseHeader(% x) should fail", data)
+		}
+	}
+}
+
+func TestHighlightCallsignMessage(t *testing.T) {
+	yellow, err := ParseColor("#ffff00")
+	if err != nil {
+		t.Fatalf("ParseColor failed: %v", err)
+	}
+	msg := HighlightCallsignMessage("WSJT-X", "K1ABC", yellow, Color{}, false)
+
+	h, ok := ParseHeader(msg)
+	if !ok || h.Type != MessageHighlightCallsign || h.ID != "WSJT-X" {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	// header, call(4+5), two colors of 11 bytes, last
+	if want := 4 + 4 + 4 + 10 + 9 + 11 + 11 + 1; len(msg) != want {
+		t.Errorf("message length = %d, want %d", len(msg), want)
+	}
+	if !bytes.Contains(msg, []byte("K1ABC\x01\xff\xff\xff\xff\xff\xff\x00\x00\x00\x00\x00")) {
+		t.Errorf("background not encoded as opaque yellow: % x", msg)
+	}
+
+	for _, bad := range []string{"yellow", "#ffff", "#gggggg"} {
+		if _, err := ParseColor(bad); err == nil {
+			t.Errorf("ParseColor(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	e := newMessage(MessageStatus, "WSJT-X")
+	e.uint32(0)
+	e.uint32(14074000)
+	e.utf8("FT8")
+	e.utf8("K1ABC")
+
+	s, ok := ParseStatus(e.Bytes())
+	if !ok || s.DialFrequency != 14074000 || s.Mode != "FT8" {
+		t.Errorf("ParseStatus = %+v, %v", s, ok)
+	}
+	if s.DXCall != "" {
+		t.Errorf("truncated Status gave DX call %q", s.DXCall)
+	}
+
+	// A full Status while calling a station
+	e = newMessage(MessageStatus, "WSJT-X")
+	e.uint32(0)
+	e.uint32(14074000)
+	e.utf8("FT8")
+	e.utf8("G4ABC") // DX call
+	e.utf8("-12")   // report
+	e.utf8("FT8")   // Tx mode
+	e.bool(true)    // Tx enabled
+	e.bool(false)   // transmitting
+	e.bool(false)   // decoding
+	e.uint32(1500)  // Rx DF
+	e.uint32(1200)  // Tx DF
+	e.utf8("W1AW")  // DE call
+	e.utf8("FN31")  // DE grid
+	e.utf8("IO91")  // DX grid
+	e.bool(false)   // Tx watchdog
+	s, ok = ParseStatus(e.Bytes())
+	if !ok || s.DXCall != "G4ABC" || s.DXGrid != "IO91" {
+		t.Errorf("ParseStatus = %+v, %v", s, ok)
+	}
+	if _, ok := ParseStatus(ConfigureMessage("WSJT-X", Configure{})); ok {
+		t.Error("ParseStatus should reject other message types")
+	}
+}
+
+func TestParseDecode(t *testing.T) {
+	e := newMessage(MessageDecode, "WSJT-X")
+	e.bool(true)
+	e.uint32(uint32((12*time.Hour + 30*time.Second) / time.Millisecond))
+	e.uint32(uint32(0xfffffff4)) // -12 dB
+	dt := math.Float64bits(0.2)
+	e.uint32(uint32(dt >> 32))
+	e.uint32(uint32(dt))
+	e.uint32(1500)
+	e.utf8("~")
+	e.utf8("CQ DX K1ABC FN42")
+	e.bool(false)
+	e.bool(false)
+
+	d, ok := ParseDecode(e.Bytes())
+	if !ok || !d.New || d.Time != 12*time.Hour+30*time.Second || d.SNR != -12 || d.DeltaTime != 0.2 ||
+		d.DeltaFrequency != 1500 || d.Mode != "~" || d.Message != "CQ DX K1ABC FN42" {
+		t.Errorf("ParseDecode = %+v, %v", d, ok)
+	}
+	if _, ok := ParseDecode(ConfigureMessage("WSJT-X", Configure{})); ok {
+		t.Error("ParseDecode should reject other message types")
+	}
+}
+
+func TestParseCQ(t *testing.T) {
+	tests := []struct {
+		message, call, grid string
+		ok                  bool
+	}{
+		{"CQ K1ABC FN42", "K1ABC", "FN42", true},
+		{"CQ DX K1ABC FN42", "K1ABC", "FN42", true},
+		{"CQ POTA W1XYZ", "W1XYZ", "", true},
+		{"cq ja1abc pm95", "JA1ABC", "PM95", true},
+		{"K1ABC W1XYZ -12", "", "", false},
+		{"CQ DX", "", "", false},
+		{"CQ", "", "", false},
+	}
+	for _, tt := range tests {
+		call, grid, ok := ParseCQ(tt.message)
+		if call != tt.call || grid != tt.grid || ok != tt.ok {
+			t.Errorf("ParseCQ(%q) = %q, %q, %v; want %q, %q, %v", tt.message, call, grid, ok, tt.call, tt.grid, tt.ok)
+		}
+	}
+}
+
+func TestQSOLogged(t *testing.T) {
+	on := time.Date(2024, 6, 1, 14, 2, 15, 0, time.UTC)
+	want := QSOLogged{
+		TimeOff:          on.Add(45 * time.Second),
+		DXCall:           "K1ABC",
+		DXGrid:           "FN42",
+		TxFrequency:      14075500,
+		Mode:             "FT8",
+		ReportSent:       "-05",
+		ReportReceived:   "-12",
+		Comments:         "FD test",
+		TimeOn:           on,
+		MyCall:           "N7AKG",
+		MyGrid:           "CN87",
+		ExchangeSent:     "1D WWA",
+		ExchangeReceived: "2A EMA",
+	}
+	got, ok := ParseQSOLogged(QSOLoggedMessage("WSJT-X", want))
+	if !ok {
+		t.Fatal("ParseQSOLogged failed on encoded message")
+	}
+	if got != want {
+		t.Errorf("ParseQSOLogged =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, ok := ParseQSOLogged(ConfigureMessage("WSJT-X", Configure{})); ok {
+		t.Error("ParseQSOLogged should reject other message types")
+	}
+}
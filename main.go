@@ -2,15 +2,37 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/auth"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/cluster"
 	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/control"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/doctor"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/firewall"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/journal"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/logging"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/migrate"
 	"github.com/akgordon/N7AKG-UDP-Translator/internal/relay"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/review"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/stats"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/tlspeer"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/workeddb"
 	"github.com/spf13/cobra"
 )
 
@@ -55,22 +77,63 @@ Examples:
 
 var (
 	configFile string
+	profile    string
 	listenAddr string
 	listenPort int
 	targetAddr string
 	targetPort int
+	targetFmt  string
 	sourceType string
 	verbose    bool
+	logLevels  map[string]string
+	noConfig   bool
+	logFormat  string
+	trace      bool
+	traceFile  string
+	noColor    bool
+	strictADIF bool
+	acceptOld  bool
+
+	signSecret string
+	signListen string
+	signRelay  string
+	signOnce   bool
+
+	certName string
+	certFile string
+	keyFile  string
+	certDays int
+
+	statsJSON  bool
+	errorsJSON bool
+
+	firewallDryRun     bool
+	firewallAnyProgram bool
+
+	filterFraming string
+	filterADIF    bool
+
+	importOutput string
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file (default is $HOME/.N7AKG-UDP-Translator.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "p", "", "apply a named profile from the config file's profiles section (e.g. contest, casual, pota)")
 	rootCmd.PersistentFlags().StringVar(&listenAddr, "listen-addr", "0.0.0.0", "address to listen for incoming UDP messages")
 	rootCmd.PersistentFlags().IntVar(&listenPort, "listen-port", 2333, "port to listen for incoming UDP messages")
 	rootCmd.PersistentFlags().StringVar(&targetAddr, "target-addr", "127.0.0.1", "address to send reformatted UDP messages")
 	rootCmd.PersistentFlags().IntVar(&targetPort, "target-port", 12060, "port to send reformatted UDP messages (N1MM default)")
-	rootCmd.PersistentFlags().StringVar(&sourceType, "source-type", "auto", "expected source message type (auto, wsjt-x, fldigi, js8call, varac, n1mm)")
+	rootCmd.PersistentFlags().StringVar(&targetFmt, "target-format", "n1mm", "output format for the target (n1mm, wintest, dxlog, adif, relay)")
+	rootCmd.PersistentFlags().StringVar(&sourceType, "source-type", "auto", "expected source message type (auto, wsjt-x, fldigi, js8call, varac, n1mm, macloggerdx, rumlog, textlog)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose logging")
+	rootCmd.PersistentFlags().StringToStringVar(&logLevels, "log-level", nil, "log level per module, e.g. formatter=debug,relay=info (modules: relay, formatter, enrichment, sinks, all)")
+	rootCmd.PersistentFlags().BoolVar(&noConfig, "no-config-file", false, "ignore config files and configure from defaults and UDP_LOGGER_* environment variables only")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "auto", "log format (auto, text, json)")
+	rootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "log a hex dump of every received datagram and what became of it")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "write the trace to this file instead of the log (implies --trace)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "don't color the console's QSO lines")
+	rootCmd.PersistentFlags().BoolVar(&strictADIF, "strict-adif", false, "refuse QSOs whose ADIF output fails ADIF 3.1.4 validation")
+	rootCmd.PersistentFlags().BoolVar(&acceptOld, "accept-old", false, "forward QSOs older than formatting.time.max_age, e.g. while importing a log")
 
 	// Add version command
 	rootCmd.AddCommand(&cobra.Command{
@@ -81,6 +144,205 @@ func init() {
 		},
 	})
 
+	// Add doctor command for diagnosing setup problems
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "doctor",
+		Short: "Check the setup and report problems",
+		Long: `Check the configuration, whether the listen port is free (and what holds it),
+send a test QSO through the whole pipeline on loopback, and check that each
+target is reachable. Exits with status 1 if any check fails.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig(cmd)
+			if !doctor.Print(os.Stdout, doctor.Run(cfg)) {
+				os.Exit(1)
+			}
+		},
+	})
+
+	// Add stats command for the relay's counters and rates
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show message counters and rates",
+		Long: `Show what the relay has received, forwarded and dropped, with rolling
+1 and 15 minute rates. A running relay is asked through the control API when
+the API is enabled with a fixed token; otherwise the counters last saved to
+stats.path are shown.`,
+		Run: runStats,
+	}
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "print the counters as JSON")
+	rootCmd.AddCommand(statsCmd)
+
+	// Add errors command for messages the relay could not parse
+	errorsCmd := &cobra.Command{
+		Use:   "errors",
+		Short: "Show recent messages that failed to parse",
+		Long: `Show the most recent messages the running relay could not turn into a
+QSO: when and where each came from, the source type, the error and the start
+of the message (hex for binary messages). With --strict-adif it also lists
+the ADIF records refused for each target and what was wrong with them. Include this output when reporting
+a message the relay should understand. Needs the control API enabled with a
+fixed token; stats.error_samples sets how many are kept.`,
+		Run: runErrors,
+	}
+	errorsCmd.Flags().BoolVar(&errorsJSON, "json", false, "print the failures as JSON")
+	rootCmd.AddCommand(errorsCmd)
+
+	// Add operator command for the operator on duty
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "operator [set CALL|clear]",
+		Short: "Show or change the operator on duty",
+		Long: `Show the operator the running relay credits with new QSOs, put another
+operator on duty with "operator set K1ABC", or go back to the configured
+formatting.n1mm.operator with "operator clear". QSOs that already name an
+operator keep it. Needs the control API enabled with a fixed token; while the
+relay runs in a terminal, type "operator set K1ABC" there instead.`,
+		Args: cobra.RangeArgs(0, 2),
+		Run:  runOperator,
+	})
+
+	// Add review command for QSOs held before forwarding
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "review [send REF [CALL [EXCHANGE...]]|drop REF]",
+		Short: "List, correct and release QSOs held for review",
+		Long: `With review.enabled the relay holds each parsed QSO for review.timeout
+before forwarding it, so a busted callsign or exchange can be fixed first.
+"review" lists the held QSOs with their numbers; "review send 3" forwards QSO
+#3 now, "review send 3 K1ABD 5NN 05" forwards it with a corrected callsign
+and exchange, and "review drop 3" discards it. QSOs are also named by ID.
+Needs the control API enabled with a fixed token; while the relay runs in a
+terminal, type the same commands there instead.`,
+		Run: runReview,
+	})
+
+	// Add firewall command for the Windows Firewall rules
+	firewallCmd := &cobra.Command{
+		Use:   "firewall add|remove|show",
+		Short: "Allow the listen ports through Windows Firewall",
+		Long: `Create, remove or list the Windows Firewall rules that let other PCs reach
+the relay: inbound UDP on the listen port, the additional listeners, the
+pipelines and the N1MM bridge, and TCP on chain.tcp_listen. Ports bound to a
+loopback address are left out. "add" replaces the rules created earlier, so
+run it again after changing ports. The rules are limited to this executable
+unless --any-program is given. Needs an administrator prompt; --dry-run prints
+the netsh commands instead.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"add", "remove", "show"},
+		Run:       runFirewall,
+	}
+	firewallCmd.Flags().BoolVar(&firewallDryRun, "dry-run", false, "print the netsh commands instead of running them")
+	firewallCmd.Flags().BoolVar(&firewallAnyProgram, "any-program", false, "allow the ports for any program, not just this executable")
+	rootCmd.AddCommand(firewallCmd)
+
+	// Add sign command for senders to a relay with source authentication
+	signCmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign datagrams for a relay that requires source authentication",
+		Long: `Receive datagrams on a local port, sign them with the shared secret and
+forward them to a remote relay with auth enabled. Point WSJT-X, fldigi and
+other applications at the local port instead of the relay. With --once, a
+single datagram is read from standard input, signed and sent.
+
+The secret may be given in UDP_LOGGER_SIGN_SECRET instead of --secret so it
+does not show up in the process list.`,
+		Run: runSign,
+	}
+	signCmd.Flags().StringVar(&signSecret, "secret", "", "shared secret (default $UDP_LOGGER_SIGN_SECRET)")
+	signCmd.Flags().StringVar(&signListen, "listen", "127.0.0.1:2333", "local address applications send to")
+	signCmd.Flags().StringVar(&signRelay, "relay", "", "relay host:port to forward signed datagrams to (required)")
+	signCmd.Flags().BoolVar(&signOnce, "once", false, "sign one datagram read from standard input and exit")
+	rootCmd.AddCommand(signCmd)
+
+	// Add cert command for TLS chain connections
+	certCmd := &cobra.Command{
+		Use:   "cert",
+		Short: "Create a self-signed certificate for TLS chain connections",
+		Long: `Create a certificate and private key for this relay to use in chain.tls,
+and print the certificate's SHA-256 fingerprint. Put the fingerprint in the
+other relay's chain.tls.fingerprints, and theirs in yours. Existing files are
+not overwritten.`,
+		Run: runCert,
+	}
+	certCmd.Flags().StringVar(&certName, "name", "", "name in the certificate (default: host name)")
+	certCmd.Flags().StringVar(&certFile, "cert", "relay.crt", "certificate file to write")
+	certCmd.Flags().StringVar(&keyFile, "key", "relay.key", "private key file to write")
+	certCmd.Flags().IntVar(&certDays, "days", 3650, "days the certificate is valid")
+	rootCmd.AddCommand(certCmd)
+
+	// Add send command for one-off test sends
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "send [file]",
+		Short: "Send one source message to the targets and exit",
+		Long: `Read a raw source message (an ADIF record, N1MM XML, a captured WSJT-X
+datagram, ...) from a file or standard input, run it through detection,
+parsing and formatting as the relay would, and send the result once to the
+configured targets. Use it from scripts, or to check that N1MM receives the
+relay's QSOs without a source application running. --source-type forces the
+parser. Nothing is journaled. Exits with status 1 if no QSO was sent.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  runSend,
+	})
+
+	// Add filter command for translating messages in shell pipelines
+	filterCmd := &cobra.Command{
+		Use:   "filter [file]...",
+		Short: "Translate source messages to the target format on standard output",
+		Long: `Read raw source messages from the files named, or from standard input, run
+them through the relay's detection, parsing and formatting, and write the
+result in the target format (--target-format) to standard output. Use it in
+shell pipelines, to convert saved files, or under inetd, which connects a
+client to standard input and output. No sockets are opened and nothing is
+sent to the targets; the journal, archive and worked-before database are used
+as when relaying. Logs go to standard error.
+
+With --framing line (the default) each line is one message and each output
+message ends with a newline. ADIF files named .adi or .adif are read one
+record at a time instead, skipping the header, so exported logs convert as
+they are; --adif does the same for standard input. Binary WSJT-X messages
+need --framing length, which puts a 4-byte big-endian length before each
+message instead, on both input and output; --framing cobs COBS-encodes each
+message and ends it with a zero byte. Stops at the end of the input.`,
+		Run: runFilter,
+	}
+	filterCmd.Flags().StringVar(&filterFraming, "framing", "line", "how messages are delimited on input and output (line, length, cobs)")
+	filterCmd.Flags().BoolVar(&filterADIF, "adif", false, "read the input as ADIF files, one record at a time (automatic for .adi and .adif files)")
+	rootCmd.AddCommand(filterCmd)
+
+	// Add import-worked command to seed the worked-before database
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "import-worked <log.adi>...",
+		Short: "Import ADIF logs into the worked-before database",
+		Long: `Add the QSOs of one or more ADIF files, e.g. an export of your master log,
+to the worked-before database at worked_db.path. Calls already in the
+database are kept. DXCC entities are recorded when a country file is set
+(stats.cty_file or alerts.cty_file). Restart a running relay to pick up the
+imported QSOs.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runImportWorked,
+	})
+
+	// Add config command for creating configuration files
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Create configuration files",
+	}
+	importFromCmd := &cobra.Command{
+		Use:   "import-from gridtracker <settings file>",
+		Short: "Create a relay config from GridTracker settings",
+		Long: `Read the UDP settings of a GridTracker setup and write an equivalent
+relay configuration: the port or multicast group WSJT-X sends to, the
+N1MM Logger+ and Log4OM loggers QSOs were sent to as targets, and the
+station callsign and grid. Settings are read from GridTracker's JSON
+settings export. Settings the relay has no equivalent for are listed as
+comments at the top. The config is written to standard output unless
+--output names a file, which must not exist yet.`,
+		Args:      cobra.ExactArgs(2),
+		ValidArgs: migrate.Sources,
+		Run:       runImportFrom,
+	}
+	importFromCmd.Flags().StringVarP(&importOutput, "output", "o", "", "file to write the config to (default standard output)")
+	configCmd.AddCommand(importFromCmd)
+	rootCmd.AddCommand(configCmd)
+
 	// Add help command with extended information
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "help-extended",
@@ -99,12 +361,22 @@ func showExtendedHelp() {
 
 	fmt.Println("COMMAND LINE FLAGS:")
 	fmt.Println("  -c, --config <file>        Configuration file path")
+	fmt.Println("  -p, --profile <name>       Apply a profile from the config file (e.g. contest, pota)")
 	fmt.Println("      --listen-addr <addr>   Listen address (default: 0.0.0.0)")
 	fmt.Println("      --listen-port <port>   Listen port (default: 2333)")
 	fmt.Println("      --target-addr <addr>   Target address (default: 127.0.0.1)")
 	fmt.Println("      --target-port <port>   Target port (default: 12060)")
-	fmt.Println("      --source-type <type>   Source type: auto, wsjt-x, fldigi, js8call, varac, n1mm")
+	fmt.Println("      --target-format <fmt>  Target output format: n1mm, wintest, dxlog, adif, relay")
+	fmt.Println("      --source-type <type>   Source type: auto, wsjt-x, fldigi, js8call, varac, n1mm, macloggerdx, rumlog, textlog")
 	fmt.Println("  -v, --verbose              Enable verbose logging")
+	fmt.Println("      --log-level <m=lvl>    Log level per module: relay, formatter, enrichment, sinks or all = info|debug")
+	fmt.Println("      --no-config-file       Use defaults and environment variables only")
+	fmt.Println("      --log-format <fmt>     Log format: auto, text, json")
+	fmt.Println("      --trace                Hex dump every datagram and what became of it")
+	fmt.Println("      --trace-file <file>    Write the trace to a file instead of the log")
+	fmt.Println("      --no-color             Don't color the console's QSO lines (or set NO_COLOR)")
+	fmt.Println("      --strict-adif          Refuse QSOs whose ADIF output fails ADIF 3.1.4 validation")
+	fmt.Println("      --accept-old           Forward QSOs older than formatting.time.max_age")
 	fmt.Println("  -h, --help                 Show basic help")
 	fmt.Println()
 
@@ -126,6 +398,11 @@ func showExtendedHelp() {
 	fmt.Println("  target:")
 	fmt.Println("    address: \"127.0.0.1\"")
 	fmt.Println("    port: 12060")
+	fmt.Println("    format: \"n1mm\"        # n1mm, wintest, dxlog, adif, relay")
+	fmt.Println("  targets:                   # optional additional targets")
+	fmt.Println("    - address: \"192.168.1.20\"")
+	fmt.Println("      port: 9871")
+	fmt.Println("      format: \"wintest\"")
 	fmt.Println("  formatting:")
 	fmt.Println("    source_type: \"auto\"")
 	fmt.Println("    auto_detect: true")
@@ -137,19 +414,30 @@ func showExtendedHelp() {
 	fmt.Println("  ```")
 	fmt.Println()
 
+	fmt.Println("ENVIRONMENT VARIABLES:")
+	fmt.Println("  Every config key can be set as UDP_LOGGER_<KEY>, with dots replaced by")
+	fmt.Println("  underscores, e.g. UDP_LOGGER_LISTEN_PORT=2333 or")
+	fmt.Println("  UDP_LOGGER_FORMATTING_N1MM_STATION=N7AKG. Lists of targets and maps take")
+	fmt.Println("  JSON, other lists are comma-separated. Environment values override the file.")
+	fmt.Println()
+
 	fmt.Println("DEFAULT PORTS:")
 	fmt.Println("  2333   - Common WSJT-X UDP broadcast port")
 	fmt.Println("  12060  - N1MM Logger Plus default UDP port")
 	fmt.Println("  2237   - Fldigi default UDP port")
 	fmt.Println("  2442   - JS8Call default UDP port")
+	fmt.Println("  9871   - Win-Test network broadcast port")
 	fmt.Println()
 
 	fmt.Println("TROUBLESHOOTING:")
-	fmt.Println("  • Use --verbose flag to see detailed message flow")
-	fmt.Println("  • Check firewall settings for UDP ports")
-	fmt.Println("  • Verify source application is broadcasting UDP messages")
-	fmt.Println("  • Ensure N1MM Logger is listening on target port")
-	fmt.Println("  • Use 'netstat -an | findstr UDP' to check port usage")
+	fmt.Println("  Run 'N7AKG-UDP-Translator doctor' (with the same flags you start the relay")
+	fmt.Println("  with) to check the listen port, test the pipeline and probe each target.")
+	fmt.Println("  Use --verbose to see the detailed message flow while running, and --trace")
+	fmt.Println("  to find out why a particular packet is ignored. 'send' pushes a single")
+	fmt.Println("  message from a file or stdin to the targets to test N1MM reception, and")
+	fmt.Println("  'filter' translates messages from stdin to stdout without any sockets.")
+	fmt.Println("  On Windows, 'firewall add' (as administrator) lets other PCs reach the")
+	fmt.Println("  listen ports through Windows Firewall.")
 }
 
 func main() {
@@ -158,17 +446,67 @@ func main() {
 	}
 }
 
-func runRelay(cmd *cobra.Command, args []string) {
-	// Display startup message
+// printBanner shows the startup banner and effective configuration
+func printBanner(cfg *config.Config) {
 	fmt.Printf("N7AKG UDP Translator\n")
 	fmt.Printf("Built: %s (commit: %s)\n", date, commit)
 	fmt.Println("=========================================")
 
+	// Display configuration information
+	fmt.Printf("Configuration:\n")
+	if cfg.ConfigFileUsed != "" {
+		fmt.Printf("  Using config file: %s\n", cfg.ConfigFileUsed)
+	}
+	if cfg.Profile != "" {
+		fmt.Printf("  Profile:        %s\n", cfg.Profile)
+	}
+	fmt.Printf("  Listen Address: %s:%d\n", cfg.Listen.Address, cfg.Listen.Port)
+	for _, t := range cfg.AllTargets() {
+		fmt.Printf("  Target Address: %s:%d (%s)\n", t.Address, t.Port, t.Format)
+	}
+	fmt.Printf("  Source Type:    %s\n", cfg.Formatting.SourceType)
+	fmt.Printf("  Verbose Mode:   %t\n", cfg.Verbose)
+	fmt.Printf("\n  N1MM Parameters:\n")
+	fmt.Printf("    Station:      %s\n", cfg.Formatting.N1MM.Station)
+	fmt.Printf("    Operator:     %s\n", cfg.Formatting.N1MM.Operator)
+	fmt.Printf("    Contest:      %s\n", cfg.Formatting.N1MM.Contest)
+	if cfg.Formatting.N1MM.StationName != "" {
+		fmt.Printf("    Station Name: %s\n", cfg.Formatting.N1MM.StationName)
+	}
+	for _, pc := range cfg.PipelineConfigs {
+		fmt.Printf("\n  Pipeline %s:\n", pc.Name)
+		fmt.Printf("    Listen Address: %s:%d\n", pc.Listen.Address, pc.Listen.Port)
+		for _, t := range pc.AllTargets() {
+			fmt.Printf("    Target Address: %s:%d (%s)\n", t.Address, t.Port, t.Format)
+		}
+		fmt.Printf("    Station:        %s\n", pc.Formatting.N1MM.Station)
+		fmt.Printf("    Contest:        %s\n", pc.Formatting.N1MM.Contest)
+	}
+	fmt.Println("=========================================")
+
+	fmt.Printf("Start with option \"help\" to see all command line options.\n\n")
+}
+
+// loadConfig loads the configuration and applies command line overrides
+func loadConfig(cmd *cobra.Command) *config.Config {
 	// Load configuration
-	cfg, err := config.Load(configFile)
+	var cfg *config.Config
+	var err error
+	if noConfig {
+		if profile != "" {
+			log.Fatalf("--profile needs a config file; it can't be combined with --no-config-file")
+		}
+		cfg, err = config.LoadEnv()
+	} else {
+		cfg, err = config.LoadProfile(configFile, profile)
+	}
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	cfg.Version = version
+	for _, pc := range cfg.PipelineConfigs {
+		pc.Version = version
+	}
 
 	// Override config with command line flags if provided
 	if cmd.Flag("listen-addr").Changed {
@@ -183,46 +521,109 @@ func runRelay(cmd *cobra.Command, args []string) {
 	if cmd.Flag("target-port").Changed {
 		cfg.Target.Port = targetPort
 	}
+	if cmd.Flag("target-format").Changed {
+		cfg.Target.Format = targetFmt
+	}
 	if cmd.Flag("source-type").Changed {
 		cfg.Formatting.SourceType = sourceType
 	}
 	if cmd.Flag("verbose").Changed {
 		cfg.Verbose = verbose
 	}
+	if cmd.Flag("log-level").Changed {
+		for _, c := range append([]*config.Config{cfg}, cfg.PipelineConfigs...) {
+			levels := make(map[string]string, len(c.Log.Levels)+len(logLevels))
+			for module, level := range c.Log.Levels {
+				levels[module] = level
+			}
+			for module, level := range logLevels {
+				levels[module] = level
+			}
+			c.Log.Levels = levels
+		}
+	}
+	if cmd.Flag("log-format").Changed {
+		cfg.Log.Format = logFormat
+	}
+	if cmd.Flag("trace").Changed {
+		cfg.Log.Trace = trace
+	}
+	if cmd.Flag("trace-file").Changed {
+		cfg.Log.Trace = true
+		cfg.Log.TraceFile = traceFile
+	}
+	if cmd.Flag("strict-adif").Changed {
+		cfg.Formatting.ADIF.Strict = strictADIF
+	}
+	if cmd.Flag("accept-old").Changed {
+		cfg.Formatting.Time.AcceptOld = acceptOld
+	}
 
-	// Display configuration information
-	fmt.Printf("Configuration:\n")
-	if cfg.ConfigFileUsed != "" {
-		fmt.Printf("  Using config file: %s\n", cfg.ConfigFileUsed)
+	return cfg
+}
+
+func runRelay(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	jsonLogs, err := logging.Setup(cfg.Log.Format, cfg.Log.Output)
+	if err != nil {
+		log.Fatalf("Invalid log configuration: %v", err)
 	}
-	fmt.Printf("  Listen Address: %s:%d\n", cfg.Listen.Address, cfg.Listen.Port)
-	fmt.Printf("  Target Address: %s:%d\n", cfg.Target.Address, cfg.Target.Port)
-	fmt.Printf("  Source Type:    %s\n", cfg.Formatting.SourceType)
-	fmt.Printf("  Verbose Mode:   %t\n", cfg.Verbose)
-	fmt.Printf("\n  N1MM Parameters:\n")
-	fmt.Printf("    Station:      %s\n", cfg.Formatting.N1MM.Station)
-	fmt.Printf("    Operator:     %s\n", cfg.Formatting.N1MM.Operator)
-	fmt.Printf("    Contest:      %s\n", cfg.Formatting.N1MM.Contest)
-	fmt.Println("=========================================")
 
-	fmt.Printf("Start with option \"help\" to see all command line options.\n\n")
+	// The banner would break line-oriented JSON logs, so log a summary instead
+	if jsonLogs {
+		log.Printf("N7AKG UDP Translator %s starting, listening on %s:%d", version, cfg.Listen.Address, cfg.Listen.Port)
+		for _, t := range cfg.AllTargets() {
+			log.Printf("Forwarding to %s:%d (%s)", t.Address, t.Port, t.Format)
+		}
+		for _, pc := range cfg.PipelineConfigs {
+			log.Printf("Pipeline %s listening on %s:%d", pc.Name, pc.Listen.Address, pc.Listen.Port)
+			for _, t := range pc.AllTargets() {
+				log.Printf("Pipeline %s forwarding to %s:%d (%s)", pc.Name, t.Address, t.Port, t.Format)
+			}
+		}
+	} else {
+		printBanner(cfg)
+	}
 
-	if cfg.Verbose {
+	if cfg.Verbose && !jsonLogs {
 		log.Printf("Starting UDP Logger Relay...")
 		log.Printf("Listening on %s:%d", cfg.Listen.Address, cfg.Listen.Port)
-		log.Printf("Forwarding to %s:%d", cfg.Target.Address, cfg.Target.Port)
+		for _, t := range cfg.AllTargets() {
+			log.Printf("Forwarding to %s:%d (%s)", t.Address, t.Port, t.Format)
+		}
 	}
 
-	// Create and start the relay
-	r, err := relay.New(cfg)
-	if err != nil {
-		log.Fatalf("Failed to create relay: %v", err)
+	// Run the relay until a signal or quit command cancels the context. In a
+	// cluster it only runs while this relay is the active one.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serve := func(ctx context.Context) error {
+		return serveRelay(ctx, cfg, jsonLogs)
+	}
+	run := serve
+	if cfg.Cluster.Enabled {
+		node, err := cluster.New(cluster.Config{
+			NodeID:   clusterNodeID(cfg),
+			Role:     cluster.Role(cfg.Cluster.Role),
+			Listen:   cfg.Cluster.Listen,
+			Peer:     cfg.Cluster.Peer,
+			Interval: cfg.Cluster.Interval,
+			Timeout:  cfg.Cluster.Timeout,
+			Secret:   cfg.Cluster.Secret,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start cluster node: %v", err)
+		}
+		run = func(ctx context.Context) error {
+			return node.Run(ctx, serve)
+		}
 	}
 
-	// Start the relay in a goroutine
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- r.Start()
+		errChan <- run(ctx)
 	}()
 
 	// Wait for interrupt signal
@@ -233,7 +634,12 @@ func runRelay(cmd *cobra.Command, args []string) {
 	quitChan := make(chan bool, 1)
 	go func() {
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Println("Enter 'Q' or 'Quit' to shut down...")
+		if !jsonLogs {
+			fmt.Println("Enter 'Q' or 'Quit' to shut down, 'operator set CALL' to change the operator on duty...")
+			if cfg.Review.Enabled {
+				fmt.Println("Enter 'review' to list QSOs held for review, 'review send N [CALL [EXCHANGE]]' or 'review drop N' to release one")
+			}
+		}
 		for {
 			input, err := reader.ReadString('\n')
 			if err != nil {
@@ -244,19 +650,736 @@ func runRelay(cmd *cobra.Command, args []string) {
 				quitChan <- true
 				return
 			}
+			keyboardCommand(input)
 		}
 	}()
 
 	select {
 	case err := <-errChan:
-		log.Fatalf("Relay error: %v", err)
+		if err != nil {
+			log.Fatalf("Relay error: %v", err)
+		}
 	case sig := <-sigChan:
 		log.Printf("Received signal %v, shutting down...", sig)
-		r.Stop()
+		cancel()
+		if err := <-errChan; err != nil {
+			log.Printf("Relay error during shutdown: %v", err)
+		}
 	case <-quitChan:
 		log.Println("Quit command received, shutting down...")
-		r.Stop()
+		cancel()
+		if err := <-errChan; err != nil {
+			log.Printf("Relay error during shutdown: %v", err)
+		}
 	}
 
 	log.Println("UDP Logger Relay stopped")
 }
+
+// serveRelay runs the relay, its pipelines and the control API until ctx is
+// cancelled or the relay fails
+func serveRelay(ctx context.Context, cfg *config.Config, jsonLogs bool) error {
+	r, err := relay.NewSupervisor(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create relay: %w", err)
+	}
+	if console := newConsole(cfg, jsonLogs); console != nil {
+		r.SetConsole(console)
+	}
+	if err := running.attach(r); err != nil {
+		log.Printf("Operator on duty: %v", err)
+	}
+	defer running.attach(nil)
+
+	if !cfg.Control.Enabled {
+		return r.Run(ctx)
+	}
+
+	srv, err := control.New(cfg.Control.Address, cfg.Control.Token, r)
+	if err != nil {
+		return fmt.Errorf("failed to create control API: %w", err)
+	}
+	srv.SetOverlay(cfg.Control.Overlay)
+	log.Printf("Control API listening on http://%s", cfg.Control.Address)
+	if cfg.Control.Token == "" {
+		log.Printf("Control API token: %s", srv.Token())
+	}
+
+	// The control API stops once the relay has, so a cluster node that
+	// stands down frees its address and event stream clients see the relay
+	// stopping
+	apiCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	apiDone := make(chan struct{})
+	go func() {
+		defer close(apiDone)
+		if err := srv.Run(apiCtx); err != nil {
+			log.Printf("Control API error: %v", err)
+		}
+	}()
+	err = r.Run(ctx)
+	cancel()
+	<-apiDone
+	return err
+}
+
+// running is the relay serveRelay is running, for commands typed at the
+// keyboard
+var running runningRelay
+
+// runningRelay hands the running relay to keyboard commands, and remembers
+// the operator put on duty there so the next relay started, e.g. when a
+// cluster node takes over again, credits them too
+type runningRelay struct {
+	mu       sync.Mutex
+	r        *relay.Supervisor
+	operator string
+}
+
+// attach records the relay that is running, or nil once it stops, putting
+// the remembered operator on duty there
+func (rr *runningRelay) attach(r *relay.Supervisor) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.r = r
+	if r == nil || rr.operator == "" {
+		return nil
+	}
+	return r.SetOperator(rr.operator)
+}
+
+// relay returns the running relay, or nil
+func (rr *runningRelay) relay() *relay.Supervisor {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.r
+}
+
+// setOperator puts call on duty, or the configured operator when call is
+// empty
+func (rr *runningRelay) setOperator(call string) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.r == nil {
+		return fmt.Errorf("the relay is not running")
+	}
+	if err := rr.r.SetOperator(call); err != nil {
+		return err
+	}
+	rr.operator = call
+	return nil
+}
+
+// keyboardCommand runs an operator or review command typed while the relay
+// runs, ignoring anything else
+func keyboardCommand(input string) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "operator", "op":
+		operatorCommand(fields[1:])
+	case "review":
+		reviewCommand(fields[1:])
+	}
+}
+
+// operatorCommand handles "operator", "operator set CALL" and
+// "operator clear" typed at the keyboard
+func operatorCommand(args []string) {
+	var call string
+	switch {
+	case len(args) == 0:
+		if r := running.relay(); r != nil {
+			fmt.Printf("Operator on duty: %s\n", r.Operator())
+		}
+		return
+	case args[0] == "set" && len(args) == 2:
+		call = args[1]
+	case args[0] == "clear" && len(args) == 1:
+	default:
+		fmt.Println("Usage: operator [set CALL|clear]")
+		return
+	}
+	if err := running.setOperator(call); err != nil {
+		fmt.Printf("Operator not changed: %v\n", err)
+	}
+}
+
+// reviewArgs is a parsed "review" command: list, or send or drop the held
+// QSO ref, with a corrected callsign and exchange when given
+type reviewArgs struct {
+	action   string // list, send or drop
+	ref      string // ID or number of the QSO
+	call     string
+	exchange string
+}
+
+// parseReviewArgs parses "review", "review send REF [CALL [EXCHANGE...]]"
+// and "review drop REF"
+func parseReviewArgs(args []string) (reviewArgs, error) {
+	usage := fmt.Errorf("usage: review [send REF [CALL [EXCHANGE...]]|drop REF]")
+	if len(args) == 0 {
+		return reviewArgs{action: "list"}, nil
+	}
+	if len(args) < 2 {
+		return reviewArgs{}, usage
+	}
+	ra := reviewArgs{action: args[0], ref: strings.TrimPrefix(args[1], "#")}
+	switch {
+	case ra.action == "send" && len(args) > 2:
+		ra.call = strings.ToUpper(args[2])
+		ra.exchange = strings.ToUpper(strings.Join(args[3:], " "))
+	case ra.action == "send", ra.action == "drop" && len(args) == 2:
+	default:
+		return reviewArgs{}, usage
+	}
+	return ra, nil
+}
+
+// reviewCommand handles the review commands typed at the keyboard
+func reviewCommand(args []string) {
+	ra, err := parseReviewArgs(args)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	r := running.relay()
+	if r == nil {
+		fmt.Println("The relay is not running")
+		return
+	}
+
+	switch ra.action {
+	case "list":
+		review.Print(os.Stdout, r.PendingQSOs())
+		return
+	case "drop":
+		_, err = r.DiscardPending(ra.ref)
+	case "send":
+		var corrected *formatter.QSO
+		if ra.call != "" {
+			for _, p := range r.PendingQSOs() {
+				if p.QSO.ID == ra.ref || strconv.Itoa(p.Number) == ra.ref {
+					corrected = &p.QSO
+				}
+			}
+			if corrected != nil {
+				corrected.Callsign = ra.call
+				if ra.exchange != "" {
+					corrected.Exchange = ra.exchange
+				}
+			}
+		}
+		_, err = r.ForwardPending(ra.ref, corrected)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// clusterNodeID names this relay in cluster heartbeats: chain.node_id, or
+// the host name and role
+func clusterNodeID(cfg *config.Config) string {
+	if cfg.Chain.NodeID != "" {
+		return cfg.Chain.NodeID
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "N7AKG-UDP-Translator"
+	}
+	return host + "/" + cfg.Cluster.Role
+}
+
+// newConsole returns the console for log.console, or nil when QSOs are
+// logged like everything else. In auto mode a person watching a terminal
+// gets the console, and machine-read JSON logs keep the log lines.
+func newConsole(cfg *config.Config, jsonLogs bool) *logging.Console {
+	switch strings.ToLower(cfg.Log.Console) {
+	case "off":
+		return nil
+	case "on":
+	default:
+		if jsonLogs || !logging.IsTerminal(os.Stdout) {
+			return nil
+		}
+	}
+	return logging.NewConsole(os.Stdout, !noColor && logging.UseColor(os.Stdout))
+}
+
+// runFirewall creates, removes or lists the Windows Firewall rules for the
+// listen ports
+func runFirewall(cmd *cobra.Command, args []string) {
+	var commands [][]string
+	switch args[0] {
+	case "add":
+		cfg := loadConfig(cmd)
+		ports := firewall.Ports(cfg)
+		if len(ports) == 0 {
+			log.Fatalf("No ports to open: every listener is bound to a loopback address")
+		}
+		for _, p := range ports {
+			fmt.Printf("%s %d (%s)\n", p.Protocol, p.Number, p.Purpose)
+		}
+
+		program := ""
+		if !firewallAnyProgram {
+			exe, err := os.Executable()
+			if err == nil {
+				exe, err = filepath.EvalSymlinks(exe)
+			}
+			if err != nil {
+				log.Fatalf("Failed to find this executable (use --any-program): %v", err)
+			}
+			program = exe
+		}
+		commands = firewall.AddCommands(ports, program)
+	case "remove":
+		commands = firewall.RemoveCommands()
+	case "show":
+		commands = firewall.ShowCommands()
+	default:
+		log.Fatalf("Unknown firewall action %q (use add, remove or show)", args[0])
+	}
+
+	if firewallDryRun {
+		for _, c := range commands {
+			fmt.Println(firewall.Format(c))
+		}
+		return
+	}
+	if runtime.GOOS != "windows" {
+		log.Fatalf("The firewall command manages Windows Firewall; allow the ports with this system's own firewall (ufw, firewalld, pf) instead, or use --dry-run to see the netsh commands")
+	}
+	if err := firewall.Run(context.Background(), os.Stdout, commands); err != nil {
+		log.Fatalf("Failed to update the firewall: %v", err)
+	}
+}
+
+// runSign signs datagrams for a relay that has source authentication enabled
+func runSign(cmd *cobra.Command, args []string) {
+	secret := signSecret
+	if secret == "" {
+		secret = os.Getenv("UDP_LOGGER_SIGN_SECRET")
+	}
+	if secret == "" {
+		log.Fatal("A secret is required (--secret or UDP_LOGGER_SIGN_SECRET)")
+	}
+	if signRelay == "" {
+		log.Fatal("--relay is required")
+	}
+
+	if signOnce {
+		payload, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Failed to read datagram: %v", err)
+		}
+		conn, err := net.Dial("udp", signRelay)
+		if err != nil {
+			log.Fatalf("Failed to create UDP sender for %s: %v", signRelay, err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write(auth.Sign(payload, secret, time.Now())); err != nil {
+			log.Fatalf("Failed to send signed datagram: %v", err)
+		}
+		return
+	}
+
+	signer, err := auth.NewSigner(signListen, signRelay, secret)
+	if err != nil {
+		log.Fatalf("Failed to start signer: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Signing datagrams received on %s and forwarding them to %s", signer.LocalAddr(), signRelay)
+	signer.Run(ctx)
+}
+
+// runCert writes a self-signed certificate and key for TLS chain
+// connections and prints the certificate's fingerprint
+func runCert(cmd *cobra.Command, args []string) {
+	name := certName
+	if name == "" {
+		if host, err := os.Hostname(); err == nil && host != "" {
+			name = host
+		} else {
+			name = "N7AKG-UDP-Translator"
+		}
+	}
+	if certDays <= 0 {
+		log.Fatalf("--days must be positive, got %d", certDays)
+	}
+	for _, path := range []string{certFile, keyFile} {
+		if _, err := os.Stat(path); err == nil {
+			log.Fatalf("%s already exists; remove it or choose another file", path)
+		}
+	}
+
+	certPEM, keyPEM, fingerprint, err := tlspeer.Generate(name, time.Duration(certDays)*24*time.Hour)
+	if err != nil {
+		log.Fatalf("Failed to create certificate: %v", err)
+	}
+	for _, f := range []struct {
+		path string
+		data []byte
+		perm os.FileMode
+	}{{certFile, certPEM, 0644}, {keyFile, keyPEM, 0600}} {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.perm)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", f.path, err)
+		}
+		if _, err := file.Write(f.data); err != nil {
+			log.Fatalf("Failed to write %s: %v", f.path, err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatalf("Failed to write %s: %v", f.path, err)
+		}
+	}
+
+	fmt.Printf("Wrote %s and %s for %q\n", certFile, keyFile, name)
+	fmt.Printf("SHA-256 fingerprint: %s\n", fingerprint)
+}
+
+// runSend sends a single source message to the targets
+func runSend(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	input, source := io.Reader(os.Stdin), "standard input"
+	if len(args) == 1 {
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("Failed to open message: %v", err)
+		}
+		defer file.Close()
+		input, source = file, args[0]
+	}
+	message, err := io.ReadAll(input)
+	if err != nil {
+		log.Fatalf("Failed to read message from %s: %v", source, err)
+	}
+	if len(message) == 0 {
+		log.Fatalf("No message in %s", source)
+	}
+
+	var pinned formatter.MessageType
+	if cmd.Flag("source-type").Changed && !strings.EqualFold(sourceType, "auto") {
+		pinned = formatter.MessageType(strings.ToLower(sourceType))
+	}
+
+	r, err := relay.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create relay: %v", err)
+	}
+	results, err := r.Send(message, pinned, source)
+	if err != nil {
+		log.Fatalf("Failed to send message: %v", err)
+	}
+
+	sent := 0
+	for _, res := range results {
+		if res.Err != nil {
+			fmt.Printf("%s: not sent: %v\n", res.Type, res.Err)
+			continue
+		}
+		sent++
+		fmt.Printf("%s: %s on %s %s sent to %d of %d targets\n",
+			res.Type, res.QSO.Callsign, res.QSO.Band, res.QSO.Mode, res.Sent, len(cfg.AllTargets()))
+		for _, resp := range res.Responses {
+			if resp.Status == journal.ResponseNone {
+				fmt.Printf("  %s: no reply\n", resp.Target)
+				continue
+			}
+			fmt.Printf("  %s replied (%s): %s\n", resp.Target, resp.Status, resp.Reply)
+		}
+	}
+	if sent == 0 {
+		os.Exit(1)
+	}
+}
+
+// runFilter translates source messages from files or standard input to
+// standard output
+func runFilter(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	// Standard output carries the messages, so the log can't share it
+	if _, err := logging.Setup(cfg.Log.Format, "stderr"); err != nil {
+		log.Fatalf("Invalid log configuration: %v", err)
+	}
+	if !relay.ValidFraming(filterFraming) {
+		log.Fatalf("Unknown framing %q (use line, length or cobs)", filterFraming)
+	}
+	framing := relay.Framing(strings.ToLower(filterFraming))
+	if filterADIF && framing != relay.FramingLine {
+		log.Fatalf("--adif reads line framed input; it can't be used with --framing %s", framing)
+	}
+
+	input, name, closeInput, err := filterInput(args, framing, filterADIF)
+	if err != nil {
+		log.Fatalf("Failed to open input: %v", err)
+	}
+	defer closeInput()
+
+	r, err := relay.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create relay: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Every message is written as soon as it is formatted, so an inetd
+	// client sees each reply without waiting for the end of its input
+	err = r.RunStream(ctx, relay.Stream{
+		In:      input,
+		Out:     os.Stdout,
+		InName:  name,
+		OutName: "standard output",
+		Framing: framing,
+	})
+	if err != nil {
+		log.Fatalf("Filter failed: %v", err)
+	}
+}
+
+// filterInput opens the files named as one input, in order, or standard
+// input if there are none. With line framing, ADIF files (.adi and .adif,
+// or every input with adif) are read a record at a time instead of a line
+// at a time, so their headers and multi-line records come through.
+func filterInput(paths []string, framing relay.Framing, adif bool) (io.Reader, string, func(), error) {
+	if len(paths) == 0 {
+		if adif {
+			return relay.ADIFRecords(os.Stdin), "standard input", func() {}, nil
+		}
+		return os.Stdin, "standard input", func() {}, nil
+	}
+
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	var readers []io.Reader
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, "", nil, err
+		}
+		files = append(files, file)
+
+		// A last line without a newline must not run into the next file
+		if len(readers) > 0 && framing == relay.FramingLine {
+			readers = append(readers, strings.NewReader("\n"))
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if framing == relay.FramingLine && (adif || ext == ".adi" || ext == ".adif") {
+			readers = append(readers, relay.ADIFRecords(file))
+		} else {
+			readers = append(readers, file)
+		}
+	}
+	return io.MultiReader(readers...), strings.Join(paths, ", "), closeAll, nil
+}
+
+// runImportWorked adds ADIF logs to the worked-before database
+func runImportWorked(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	var cty *formatter.CTY
+	for _, path := range []string{cfg.Stats.CTYFile, cfg.Alerts.CTYFile} {
+		if path == "" {
+			continue
+		}
+		var err error
+		if cty, err = formatter.LoadCTY(path); err != nil {
+			log.Fatalf("Failed to load country file: %v", err)
+		}
+		break
+	}
+	if cty == nil {
+		log.Printf("No country file configured (stats.cty_file); DXCC entities are not recorded")
+	}
+
+	db, err := workeddb.Open(cfg.WorkedDB.Path)
+	if err != nil {
+		log.Fatalf("Failed to open worked-before database: %v", err)
+	}
+	defer db.Close()
+
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		read, added, err := db.Import(file, cty)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to import %s: %v", path, err)
+		}
+		fmt.Printf("%s: %d QSOs, %d new band/mode slots\n", path, read, added)
+	}
+
+	calls, slots, entities := db.Counts()
+	fmt.Printf("%s: %d calls, %d band/mode slots, %d DXCC entities\n", cfg.WorkedDB.Path, calls, slots, entities)
+}
+
+// runImportFrom writes a relay config from another application's settings
+func runImportFrom(cmd *cobra.Command, args []string) {
+	settings, err := migrate.ImportFile(args[0], args[1])
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", args[1], err)
+	}
+
+	if importOutput == "" {
+		if err := settings.WriteYAML(os.Stdout); err != nil {
+			log.Fatalf("Failed to write config: %v", err)
+		}
+		return
+	}
+	file, err := os.OpenFile(importOutput, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", importOutput, err)
+	}
+	if err := settings.WriteYAML(file); err != nil {
+		log.Fatalf("Failed to write %s: %v", importOutput, err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %v", importOutput, err)
+	}
+	fmt.Printf("Wrote %s; run the relay with --config %s\n", importOutput, importOutput)
+	for _, note := range settings.Notes {
+		fmt.Printf("Not carried over: %s\n", note)
+	}
+}
+
+// runStats prints the relay's counters
+func runStats(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	snap, err := readStats(cfg)
+	if err != nil {
+		log.Fatalf("No stats available: %v", err)
+	}
+
+	if statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(snap)
+		return
+	}
+	stats.Print(os.Stdout, snap)
+}
+
+// runErrors prints the running relay's recent parse failures
+func runErrors(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+	if !cfg.Control.Enabled || cfg.Control.Token == "" {
+		log.Fatalf("The errors command needs the control API enabled with a fixed token")
+	}
+
+	failures, err := control.FetchErrors(cfg.Control.Address, cfg.Control.Token)
+	if err != nil {
+		log.Fatalf("Failed to read parse failures: %v", err)
+	}
+
+	if errorsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(failures)
+		return
+	}
+	stats.PrintFailures(os.Stdout, failures)
+}
+
+// runOperator shows or changes the operator on duty at the running relay
+func runOperator(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+	if !cfg.Control.Enabled || cfg.Control.Token == "" {
+		log.Fatalf("The operator command needs the control API enabled with a fixed token")
+	}
+
+	var call string
+	var err error
+	switch {
+	case len(args) == 0:
+		call, err = control.FetchOperator(cfg.Control.Address, cfg.Control.Token)
+	case args[0] == "set" && len(args) == 2:
+		call, err = control.SetOperator(cfg.Control.Address, cfg.Control.Token, args[1])
+	case args[0] == "clear" && len(args) == 1:
+		call, err = control.SetOperator(cfg.Control.Address, cfg.Control.Token, "")
+	default:
+		log.Fatalf("Usage: operator [set CALL|clear]")
+	}
+	if err != nil {
+		log.Fatalf("Failed to reach the operator on duty: %v", err)
+	}
+	if call == "" {
+		call = "(none)"
+	}
+	fmt.Printf("Operator on duty: %s\n", call)
+}
+
+// runReview lists, corrects and releases QSOs held for review at the
+// running relay
+func runReview(cmd *cobra.Command, args []string) {
+	ra, err := parseReviewArgs(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	cfg := loadConfig(cmd)
+	if !cfg.Control.Enabled || cfg.Control.Token == "" {
+		log.Fatalf("The review command needs the control API enabled with a fixed token")
+	}
+	addr, token := cfg.Control.Address, cfg.Control.Token
+
+	var qso formatter.QSO
+	switch ra.action {
+	case "list":
+		pending, err := control.FetchPending(addr, token)
+		if err != nil {
+			log.Fatalf("Failed to read the review queue: %v", err)
+		}
+		review.Print(os.Stdout, pending)
+		return
+	case "drop":
+		qso, err = control.DiscardPending(addr, token, ra.ref)
+	case "send":
+		var corrections map[string]any
+		if ra.call != "" {
+			corrections = map[string]any{"callsign": ra.call}
+			if ra.exchange != "" {
+				corrections["exchange"] = ra.exchange
+			}
+		}
+		qso, err = control.ForwardPending(addr, token, ra.ref, corrections)
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s QSO %s: %v", ra.action, ra.ref, err)
+	}
+	if ra.action == "drop" {
+		fmt.Printf("Discarded QSO with %s\n", qso.Callsign)
+	} else {
+		fmt.Printf("Forwarded QSO with %s\n", qso.Callsign)
+	}
+}
+
+// readStats asks the running relay for its counters, falling back to the
+// stats file when the control API can't be used
+func readStats(cfg *config.Config) (stats.Snapshot, error) {
+	if cfg.Control.Enabled && cfg.Control.Token != "" {
+		snap, err := control.FetchStats(cfg.Control.Address, cfg.Control.Token)
+		if err == nil || cfg.Stats.Path == "" {
+			return snap, err
+		}
+		log.Printf("%v; showing the counters saved in %s", err, cfg.Stats.Path)
+	}
+
+	if cfg.Stats.Path == "" {
+		return stats.Snapshot{}, fmt.Errorf("set stats.path, or enable the control API with a token")
+	}
+	return stats.Load(cfg.Stats.Path)
+}
@@ -1,7 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/config"
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/relay"
 )
 
 func TestVersionNotEmpty(t *testing.T) {
@@ -14,3 +23,116 @@ func TestMainPackageExists(t *testing.T) {
 	// This test ensures the main package can be imported
 	// which validates that all imports are correct
 }
+
+// An exported log: a header, then records over several lines
+const day1ADIF = "Exported by a logger\r\n<ADIF_VER:5>3.1.4\r\n<EOH>\r\n" +
+	"<CALL:5>K2ABC <QSO_DATE:8>20240601 <TIME_ON:6>142315\r\n<FREQ:9>14.075123 <MODE:3>FT8\r\n<EOR>\r\n" +
+	"<CALL:5>W9XYZ <QSO_DATE:8>20240601\n<TIME_ON:6>150000 <FREQ:6>7.0350 <MODE:2>CW\n<COMMENT:9>two\nlines <eor>\n"
+
+func TestFilterInput(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// The second file has no header, and its last record no newline; the
+	// text file is still read a line at a time
+	paths := []string{
+		write("day1.adi", day1ADIF),
+		write("day2.ADIF", "<CALL:5>G4ABC <QSO_DATE:8>20240602 <TIME_ON:4>0900 <FREQ:6>3.5250 <MODE:2>CW <EOR>"),
+		write("more.txt", "<call:5>DL1AB <mode:3>FT8 <qso_date:8>20240602 <time_on:6>100000 <freq:9>14.074000 <eor>"),
+	}
+
+	input, name, closeInput, err := filterInput(paths, relay.FramingLine, false)
+	if err != nil {
+		t.Fatalf("filterInput failed: %v", err)
+	}
+	defer closeInput()
+	if name != strings.Join(paths, ", ") {
+		t.Errorf("name = %q", name)
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty lines between the files are skipped when read
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{"<CALL:5>K2ABC", "<CALL:5>W9XYZ", "<CALL:5>G4ABC", "<call:5>DL1AB"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d records, one per line, got %q", len(want), lines)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d = %q, want it to start with %s", i, lines[i], w)
+		}
+	}
+	if !strings.Contains(lines[1], "<COMMENT:9>two lines") {
+		t.Errorf("multi-line value not kept at its length: %q", lines[1])
+	}
+
+	// Length framing reads the files as they are
+	input, _, closeRaw, err := filterInput(paths[:1], relay.FramingLength, false)
+	if err != nil {
+		t.Fatalf("filterInput failed: %v", err)
+	}
+	defer closeRaw()
+	if data, _ := io.ReadAll(input); string(data) != day1ADIF {
+		t.Errorf("length framed input changed: %q", data)
+	}
+
+	if _, _, _, err := filterInput([]string{filepath.Join(dir, "missing.adi")}, relay.FramingLine, false); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestFilterADIFFiles(t *testing.T) {
+	// Two exported logs convert to one ADIF stream, a record per line
+	dir := t.TempDir()
+	var paths []string
+	for i, data := range []string{day1ADIF, "<ADIF_VER:5>3.1.4 <EOH>\n<CALL:5>G4ABC <QSO_DATE:8>20240602 <TIME_ON:4>0900 <FREQ:6>3.5250 <MODE:2>CW <EOR>\n"} {
+		path := filepath.Join(dir, []string{"day1.adi", "day2.adi"}[i])
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	input, name, closeInput, err := filterInput(paths, relay.FramingLine, false)
+	if err != nil {
+		t.Fatalf("filterInput failed: %v", err)
+	}
+	defer closeInput()
+
+	cfg := &config.Config{}
+	cfg.Target.Address = "127.0.0.1"
+	cfg.Target.Port = 12060
+	cfg.Target.Format = "n1mm"
+	cfg.Formatting.AutoDetect = true
+	cfg.Formatting.SourceType = "auto"
+	cfg.Formatting.N1MM.Station = "W1AW"
+	cfg.Formatting.N1MM.Operator = "W1AW"
+	cfg.Formatting.N1MM.Contest = "GENERAL"
+	cfg.Formatting.Time.OutputUTC = true
+	r, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := r.RunStream(context.Background(), relay.Stream{In: input, Out: &out, InName: name, Format: "adif"}); err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "<CALL:5>K2ABC") || !strings.Contains(lines[1], "<CALL:5>W9XYZ") || !strings.Contains(lines[2], "<CALL:5>G4ABC") {
+		t.Errorf("expected the three QSOs in order, got: %q", out.String())
+	}
+	if failed := r.Stats().ParseFailures; len(failed) != 0 {
+		t.Errorf("parse failures: %v", failed)
+	}
+}
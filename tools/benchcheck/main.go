@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Benchmark regression gate
+// Compares `go test -bench` output against a baseline run and fails when a
+// benchmark has slowed down by more than the threshold. With -count above 1
+// the fastest run of each benchmark is used, which is the least disturbed by
+// whatever else the machine was doing.
+
+// benchLine matches a result line, e.g.
+// "BenchmarkDetect/n1mm-8   	 750000	      1585 ns/op	 352 B/op"
+var benchLine = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+([\d.]+) ns/op`)
+
+func main() {
+	var baselinePath, currentPath string
+	var threshold float64
+	flag.StringVar(&baselinePath, "baseline", "bench_baseline.txt", "Benchmark output to compare against")
+	flag.StringVar(&currentPath, "current", "-", "Benchmark output to check (- for stdin)")
+	flag.Float64Var(&threshold, "threshold", 20, "Percent slowdown allowed before failing")
+	flag.Parse()
+
+	baseline, err := readFile(baselinePath)
+	if err != nil {
+		log.Fatalf("Failed to read baseline: %v (record one with make bench-baseline)", err)
+	}
+	var current map[string]float64
+	if currentPath == "-" {
+		current, err = parse(os.Stdin)
+	} else {
+		current, err = readFile(currentPath)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read benchmark results: %v", err)
+	}
+	if len(current) == 0 {
+		log.Fatal("No benchmark results to check")
+	}
+
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regressions := 0
+	fmt.Printf("%-40s %12s %12s %8s\n", "benchmark", "baseline", "current", "change")
+	for _, name := range names {
+		now := current[name]
+		before, ok := baseline[name]
+		if !ok {
+			fmt.Printf("%-40s %12s %12s %8s\n", name, "-", formatNs(now), "new")
+			continue
+		}
+		change := (now - before) / before * 100
+		mark := ""
+		if change > threshold {
+			mark = "  REGRESSION"
+			regressions++
+		}
+		fmt.Printf("%-40s %12s %12s %+7.1f%%%s\n", name, formatNs(before), formatNs(now), change, mark)
+	}
+	for name := range baseline {
+		if _, ok := current[name]; !ok {
+			fmt.Printf("%-40s missing from this run\n", name)
+		}
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\n%d benchmark(s) more than %.0f%% slower than the baseline\n", regressions, threshold)
+		os.Exit(1)
+	}
+	fmt.Printf("\nNo benchmark more than %.0f%% slower than the baseline\n", threshold)
+}
+
+// readFile parses benchmark output saved to a file
+func readFile(path string) (map[string]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parse(file)
+}
+
+// parse returns the fastest ns/op of each benchmark in go test output
+func parse(r io.Reader) (map[string]float64, error) {
+	results := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := benchLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		ns, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		if best, ok := results[match[1]]; !ok || ns < best {
+			results[match[1]] = ns
+		}
+	}
+	return results, scanner.Err()
+}
+
+// formatNs formats a time per operation for the table
+func formatNs(ns float64) string {
+	if ns >= 1000 {
+		return fmt.Sprintf("%.1f µs/op", ns/1000)
+	}
+	return fmt.Sprintf("%.0f ns/op", ns)
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// N1MM Logger+ contactinfo simulator
+// Generates the contactinfo broadcasts of a multi-op contest station: each
+// StationName is one networked computer, the first running on one band and
+// the others searching for multipliers across the bands. QSOs arrive at
+// random intervals averaging the configured hourly rate.
+
+// N1MMStation is one networked N1MM computer
+type N1MMStation struct {
+	Name     string `yaml:"name"`     // StationName, e.g. RUN1
+	Operator string `yaml:"operator"` // Operator callsign; empty uses the station callsign
+}
+
+// n1mmContact is a contactinfo broadcast, with elements in the order N1MM
+// sends them
+type n1mmContact struct {
+	XMLName         xml.Name `xml:"contactinfo"`
+	App             string   `xml:"app"`
+	Contest         string   `xml:"contestname"`
+	ContestNr       string   `xml:"contestnr"`
+	Timestamp       string   `xml:"timestamp"`
+	MyCall          string   `xml:"mycall"`
+	Band            string   `xml:"band"`
+	RXFreq          string   `xml:"rxfreq"`
+	TXFreq          string   `xml:"txfreq"`
+	Operator        string   `xml:"operator"`
+	Mode            string   `xml:"mode"`
+	Call            string   `xml:"call"`
+	CountryPrefix   string   `xml:"countryprefix"`
+	WPXPrefix       string   `xml:"wpxprefix"`
+	StationPrefix   string   `xml:"stationprefix"`
+	Continent       string   `xml:"continent"`
+	Sent            string   `xml:"snt"`
+	SentNr          string   `xml:"sntnr"`
+	Rcvd            string   `xml:"rcv"`
+	RcvdNr          string   `xml:"rcvnr"`
+	GridSquare      string   `xml:"gridsquare"`
+	Exchange        string   `xml:"exchange1"`
+	Section         string   `xml:"section"`
+	Comment         string   `xml:"comment"`
+	Qth             string   `xml:"qth"`
+	Name            string   `xml:"name"`
+	Power           string   `xml:"power"`
+	MiscText        string   `xml:"misctext"`
+	Zone            string   `xml:"zone"`
+	Prec            string   `xml:"prec"`
+	CK              string   `xml:"ck"`
+	IsMult1         string   `xml:"ismultiplier1"`
+	IsMult2         string   `xml:"ismultiplier2"`
+	IsMult3         string   `xml:"ismultiplier3"`
+	Points          string   `xml:"points"`
+	Radionr         string   `xml:"radionr"`
+	Run1Run2        string   `xml:"run1run2"`
+	RoverLocation   string   `xml:"RoverLocation"`
+	RadioInterfaced string   `xml:"RadioInterfaced"`
+	NetworkedCompNr string   `xml:"NetworkedCompNr"`
+	IsOriginal      string   `xml:"IsOriginal"`
+	NetBiosName     string   `xml:"NetBiosName"`
+	IsRunQSO        string   `xml:"IsRunQSO"`
+	StationName     string   `xml:"StationName"`
+	ID              string   `xml:"ID"`
+	IsClaimedQso    string   `xml:"IsClaimedQso"`
+}
+
+// contestProfile describes how a contest's QSOs look
+type contestProfile struct {
+	cw       bool // CW, otherwise SSB
+	domestic bool // Works only US and Canadian stations (Sweepstakes)
+	exchange func(s *n1mmSimulator, c *n1mmContact, dx dxEntity)
+}
+
+var contests = map[string]contestProfile{
+	"CQ-WW-CW":   {cw: true, exchange: cqwwExchange},
+	"CQ-WW-SSB":  {exchange: cqwwExchange},
+	"CQ-WPX-CW":  {cw: true, exchange: wpxExchange},
+	"CQ-WPX-SSB": {exchange: wpxExchange},
+	"ARRL-SS-CW": {cw: true, domestic: true, exchange: sweepstakesExchange},
+}
+
+// contestNames lists the contests the simulator knows, for the usage text
+func contestNames() []string {
+	names := make([]string, 0, len(contests))
+	for name := range contests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dxEntity is a country the simulated stations work
+type dxEntity struct {
+	prefix    string // Call prefix; a digit is added unless it ends in one
+	country   string // N1MM countryprefix
+	continent string
+	zone      int // CQ zone
+}
+
+var dxEntities = []dxEntity{
+	{"DL", "DL", "EU", 14}, {"G", "G", "EU", 14}, {"F", "F", "EU", 14},
+	{"EA", "EA", "EU", 14}, {"I", "I", "EU", 15}, {"OH", "OH", "EU", 15},
+	{"SP", "SP", "EU", 15}, {"UA", "UA", "EU", 16}, {"JA", "JA", "AS", 25},
+	{"BY", "BY", "AS", 24}, {"VK", "VK", "OC", 30}, {"ZL", "ZL", "OC", 32},
+	{"PY", "PY", "SA", 11}, {"LU", "LU", "SA", 13}, {"ZS", "ZS", "AF", 38},
+	{"EA8", "EA8", "AF", 33}, {"KP4", "KP4", "NA", 8}, {"XE", "XE", "NA", 6},
+	{"VE", "VE", "NA", 4}, {"K", "K", "NA", 5}, {"W", "K", "NA", 4},
+	{"N", "K", "NA", 3}, {"AA", "K", "NA", 5},
+}
+
+// domesticEntities are the entries Sweepstakes stations come from
+var domesticEntities = []dxEntity{
+	{"VE", "VE", "NA", 4}, {"K", "K", "NA", 5}, {"W", "K", "NA", 4},
+	{"N", "K", "NA", 3}, {"AA", "K", "NA", 5}, {"KB", "K", "NA", 4},
+}
+
+var sweepstakesSections = []string{
+	"CT", "EMA", "ENY", "NNJ", "WPA", "MDC", "VA", "NC", "GA", "NFL", "AL", "TN",
+	"OH", "MI", "IL", "WI", "MN", "IA", "MO", "KS", "NTX", "STX", "CO", "AZ",
+	"SV", "SCV", "LAX", "SDG", "OR", "WWA", "ONE", "ONS", "BC", "QC",
+}
+
+// contestBand is a contest band and its CW and phone segments in kHz
+type contestBand struct {
+	band            string // N1MM band, in MHz
+	cwLow, cwHigh   int
+	ssbLow, ssbHigh int
+}
+
+var contestBands = []contestBand{
+	{"1.8", 1800, 1840, 1840, 1990},
+	{"3.5", 3500, 3600, 3600, 3800},
+	{"7", 7000, 7070, 7070, 7200},
+	{"14", 14000, 14070, 14150, 14350},
+	{"21", 21000, 21070, 21200, 21450},
+	{"28", 28000, 28070, 28300, 28700},
+}
+
+// stationState is where one networked computer is operating
+type stationState struct {
+	N1MMStation
+	band int // Index into contestBands
+	freq int // Hz
+}
+
+// n1mmSimulator generates the QSOs of one multi-op station
+type n1mmSimulator struct {
+	contest  string
+	profile  contestProfile
+	myCall   string
+	rate     int
+	stations []*stationState
+	serial   int             // Last serial number sent; shared across the network as in N1MM
+	worked   map[string]bool // Multipliers worked, keyed by kind, band and value
+}
+
+// newN1MMSimulator checks the settings and places each station on a band
+func newN1MMSimulator(contest, myCall string, rate int, stations []N1MMStation) (*n1mmSimulator, error) {
+	profile, ok := contests[strings.ToUpper(contest)]
+	if !ok {
+		return nil, fmt.Errorf("unknown contest %q (use %s)", contest, strings.Join(contestNames(), ", "))
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %d", rate)
+	}
+	if len(stations) == 0 {
+		return nil, fmt.Errorf("at least one station is required")
+	}
+
+	s := &n1mmSimulator{
+		contest: strings.ToUpper(contest),
+		profile: profile,
+		myCall:  strings.ToUpper(myCall),
+		rate:    rate,
+		worked:  make(map[string]bool),
+	}
+	for i, st := range stations {
+		if st.Operator == "" {
+			st.Operator = s.myCall
+		}
+		state := &stationState{N1MMStation: st, band: rand.Intn(len(contestBands))}
+		if i == 0 {
+			// The run station holds a frequency until it changes band
+			state.band = 3
+			state.freq = s.frequency(state.band)
+		}
+		s.stations = append(s.stations, state)
+	}
+	return s, nil
+}
+
+// parseStations reads a -stations list of StationName[:operator] entries
+func parseStations(list string) []N1MMStation {
+	var stations []N1MMStation
+	for _, entry := range strings.Split(list, ",") {
+		name, operator, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			continue
+		}
+		stations = append(stations, N1MMStation{Name: name, Operator: strings.ToUpper(operator)})
+	}
+	return stations
+}
+
+// printSettings prints the N1MM part of the startup banner
+func (s *n1mmSimulator) printSettings() {
+	fmt.Printf("Contest: %s\n", s.contest)
+	fmt.Printf("Rate: %d QSOs/hour\n", s.rate)
+	for i, st := range s.stations {
+		role := "mult"
+		if i == 0 {
+			role = "run"
+		}
+		fmt.Printf("Station: %s (%s, operator %s)\n", st.Name, role, st.Operator)
+	}
+}
+
+// run sends QSOs until a signal arrives. The gaps between QSOs are random
+// with the configured average, as contest QSOs come in bursts and lulls.
+func (s *n1mmSimulator) run(conn *net.UDPConn, sigChan <-chan os.Signal) {
+	mean := time.Hour / time.Duration(s.rate)
+	count := 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			s.sendQSO(conn, count)
+			count++
+			gap := time.Duration(rand.ExpFloat64() * float64(mean))
+			timer.Reset(min(max(gap, mean/10), 5*mean))
+		case sig := <-sigChan:
+			fmt.Printf("\nReceived signal %v, shutting down...\n", sig)
+			fmt.Printf("Total QSOs sent: %d\n", count)
+			return
+		}
+	}
+}
+
+// sendQSO logs the next QSO on a random station and broadcasts it
+func (s *n1mmSimulator) sendQSO(conn *net.UDPConn, count int) {
+	index := rand.Intn(len(s.stations))
+	contact := s.nextContact(index)
+
+	payload, err := contactXML(contact)
+	if err != nil {
+		log.Printf("Failed to build contactinfo: %v", err)
+		return
+	}
+
+	n, err := conn.Write(payload)
+	if err != nil {
+		log.Printf("Failed to send message: %v", err)
+		return
+	}
+	fmt.Printf("[%d] Sent %d bytes: %s %sMHz %s %s %s %s\n", count+1, n,
+		contact.StationName, contact.Band, contact.Mode, contact.Call, contact.Rcvd, contact.Exchange)
+}
+
+// contactXML is the datagram N1MM broadcasts for a contact
+func contactXML(contact *n1mmContact) ([]byte, error) {
+	payload, err := xml.Marshal(contact)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), payload...), nil
+}
+
+// nextContact moves station index as its role would and fills in its next QSO
+func (s *n1mmSimulator) nextContact(index int) *n1mmContact {
+	st := s.stations[index]
+	run := index == 0
+	if run {
+		// Runners change band now and then as conditions change
+		if rand.Intn(20) == 0 {
+			st.band = rand.Intn(len(contestBands))
+			st.freq = s.frequency(st.band)
+		}
+	} else {
+		// Multiplier stations tune the bands for new ones
+		st.band = rand.Intn(len(contestBands))
+		st.freq = s.frequency(st.band)
+	}
+
+	entities := dxEntities
+	if s.profile.domestic {
+		entities = domesticEntities
+	}
+	dx := entities[rand.Intn(len(entities))]
+	call, wpx := randomCall(dx.prefix)
+
+	s.serial++
+	freq := strconv.Itoa(st.freq / 10)
+	c := &n1mmContact{
+		App:             "N1MM",
+		Contest:         s.contest,
+		ContestNr:       "1",
+		Timestamp:       time.Now().UTC().Format("2006-01-02 15:04:05"),
+		MyCall:          s.myCall,
+		Band:            contestBands[st.band].band,
+		RXFreq:          freq,
+		TXFreq:          freq,
+		Operator:        st.Operator,
+		Mode:            s.mode(st.freq),
+		Call:            call,
+		CountryPrefix:   dx.country,
+		WPXPrefix:       wpx,
+		StationPrefix:   wpxOf(s.myCall),
+		Continent:       dx.continent,
+		SentNr:          strconv.Itoa(s.serial),
+		RcvdNr:          "0",
+		Zone:            "0",
+		CK:              "0",
+		IsMult1:         "0",
+		IsMult2:         "0",
+		IsMult3:         "0",
+		Points:          "0",
+		Radionr:         "1",
+		Run1Run2:        "1",
+		RadioInterfaced: "1",
+		NetworkedCompNr: strconv.Itoa(index + 1),
+		IsOriginal:      "True",
+		NetBiosName:     st.Name,
+		IsRunQSO:        flagOf(run),
+		StationName:     st.Name,
+		ID:              fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64()),
+		IsClaimedQso:    "1",
+	}
+	s.profile.exchange(s, c, dx)
+	return c
+}
+
+// frequency picks a frequency in a band's segment for the contest's mode
+func (s *n1mmSimulator) frequency(band int) int {
+	b := contestBands[band]
+	if s.profile.cw {
+		return (b.cwLow*10 + rand.Intn((b.cwHigh-b.cwLow)*10)) * 100
+	}
+	return (b.ssbLow + rand.Intn(b.ssbHigh-b.ssbLow)) * 1000
+}
+
+// mode returns the N1MM mode for a frequency: sideband follows the band
+func (s *n1mmSimulator) mode(freq int) string {
+	switch {
+	case s.profile.cw:
+		return "CW"
+	case freq < 10000000:
+		return "LSB"
+	default:
+		return "USB"
+	}
+}
+
+// report returns the signal report contesters always send
+func (s *n1mmSimulator) report() string {
+	if s.profile.cw {
+		return "599"
+	}
+	return "59"
+}
+
+// newMult reports whether a multiplier is new, and records it
+func (s *n1mmSimulator) newMult(kind, value string) bool {
+	if s.worked[kind+"|"+value] {
+		return false
+	}
+	s.worked[kind+"|"+value] = true
+	return true
+}
+
+// cqwwExchange is RS(T) and CQ zone; zones and countries count once per band
+func cqwwExchange(s *n1mmSimulator, c *n1mmContact, dx dxEntity) {
+	zone := strconv.Itoa(dx.zone)
+	c.Sent, c.Rcvd = s.report(), s.report()
+	c.Exchange, c.Zone = zone, zone
+
+	// Scored from a North American station
+	switch {
+	case dx.country == "K":
+		c.Points = "0"
+	case dx.continent == "NA":
+		c.Points = "2"
+	default:
+		c.Points = "3"
+	}
+	c.IsMult1 = flagOf(s.newMult("zone|"+c.Band, zone))
+	c.IsMult2 = flagOf(s.newMult("country|"+c.Band, dx.country))
+}
+
+// wpxExchange is RS(T) and serial number; each prefix counts once
+func wpxExchange(s *n1mmSimulator, c *n1mmContact, dx dxEntity) {
+	c.Sent, c.Rcvd = s.report(), s.report()
+	c.RcvdNr = strconv.Itoa(1 + rand.Intn(1500))
+	c.Exchange = c.RcvdNr
+
+	points := 1
+	if dx.continent != "NA" {
+		points = 3
+	}
+	if c.Band == "1.8" || c.Band == "3.5" || c.Band == "7" {
+		points *= 2
+	}
+	c.Points = strconv.Itoa(points)
+	c.IsMult1 = flagOf(s.newMult("prefix", c.WPXPrefix))
+}
+
+// sweepstakesExchange is serial, precedence, callsign, check and section;
+// each section counts once
+func sweepstakesExchange(s *n1mmSimulator, c *n1mmContact, _ dxEntity) {
+	c.RcvdNr = strconv.Itoa(1 + rand.Intn(800))
+	c.Prec = string("QABUMS"[rand.Intn(6)])
+	c.CK = fmt.Sprintf("%02d", rand.Intn(100))
+	c.Section = sweepstakesSections[rand.Intn(len(sweepstakesSections))]
+	c.Exchange = fmt.Sprintf("%s %s %s %s", c.RcvdNr, c.Prec, c.CK, c.Section)
+	c.Points = "2"
+	c.IsMult1 = flagOf(s.newMult("section", c.Section))
+}
+
+// randomCall makes a callsign from a prefix and returns it with its WPX prefix
+func randomCall(prefix string) (call, wpx string) {
+	wpx = prefix
+	if last := prefix[len(prefix)-1]; last < '0' || last > '9' {
+		wpx += strconv.Itoa(rand.Intn(10))
+	}
+	suffix := make([]byte, 1+rand.Intn(3))
+	for i := range suffix {
+		suffix[i] = byte('A' + rand.Intn(26))
+	}
+	return wpx + string(suffix), wpx
+}
+
+// wpxOf returns a callsign's WPX prefix: everything up to its last digit
+func wpxOf(call string) string {
+	if i := strings.LastIndexAny(call, "0123456789"); i >= 0 {
+		return call[:i+1]
+	}
+	return call
+}
+
+// flagOf formats an N1MM flag
+func flagOf(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/akgordon/N7AKG-UDP-Translator/internal/formatter"
+)
+
+// TestN1MMContactParses feeds generated contactinfo to the relay's parser
+func TestN1MMContactParses(t *testing.T) {
+	f := formatter.New("TEST", "OP", "GENERAL")
+	for _, contest := range contestNames() {
+		t.Run(contest, func(t *testing.T) {
+			s, err := newN1MMSimulator(contest, "w1aw", 120, parseStations("RUN1:k1abc,MULT1:n1xyz,MULT2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 50; i++ {
+				index := i % len(s.stations)
+				contact := s.nextContact(index)
+				payload, err := contactXML(contact)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if detected := f.DetectMessageType(string(payload)); detected != formatter.MessageTypeN1MM {
+					t.Fatalf("detected as %s: %s", detected, payload)
+				}
+				qso, err := f.ParseMessage(string(payload), formatter.MessageTypeN1MM)
+				if err != nil {
+					t.Fatalf("%v: %s", err, payload)
+				}
+
+				operator := map[int]string{0: "K1ABC", 1: "N1XYZ", 2: "W1AW"}[index]
+				if qso.MyCall != "W1AW" || qso.Operator != operator || qso.StationName != s.stations[index].Name {
+					t.Errorf("station %s, operator %s, station name %s; expected W1AW, %s, %s",
+						qso.MyCall, qso.Operator, qso.StationName, operator, s.stations[index].Name)
+				}
+				if qso.SerialSent != i+1 || contact.SentNr != strconv.Itoa(i+1) {
+					t.Errorf("serial %d, expected %d", qso.SerialSent, i+1)
+				}
+				if qso.Callsign != contact.Call || !formatter.ValidCallsign(qso.Callsign) {
+					t.Errorf("callsign %q from %q", qso.Callsign, contact.Call)
+				}
+				if qso.Band == "" || qso.Mode == "" || qso.Exchange != contact.Exchange {
+					t.Errorf("band %q, mode %q, exchange %q: %s", qso.Band, qso.Mode, qso.Exchange, payload)
+				}
+			}
+		})
+	}
+}
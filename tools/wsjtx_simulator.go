@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,10 +15,12 @@ import (
 )
 
 // WSJT-X UDP message simulator
-// This tool simulates WSJT-X UDP broadcasts for testing the UDP Logger Relay
+// This tool simulates WSJT-X UDP broadcasts for testing the UDP Logger Relay,
+// or with -source n1mm a multi-op N1MM Logger+ station (see n1mm_simulator.go)
 
 // Config represents the simulator configuration
 type Config struct {
+	Source string `yaml:"source"`
 	Target struct {
 		Address string `yaml:"address"`
 		Port    int    `yaml:"port"`
@@ -37,6 +40,11 @@ type Config struct {
 		RemoteGrid     string `yaml:"remote_grid"`
 		SignalReport   string `yaml:"signal_report"`
 	} `yaml:"messages"`
+	N1MM struct {
+		Contest  string        `yaml:"contest"`
+		Rate     int           `yaml:"rate"`
+		Stations []N1MMStation `yaml:"stations"`
+	} `yaml:"n1mm"`
 }
 
 var (
@@ -49,6 +57,10 @@ var (
 	frequency  string
 	band       string
 	grid       string
+	source     string
+	rate       int
+	contest    string
+	stations   string
 
 	// Track which flags were explicitly set
 	addrSet      bool
@@ -59,6 +71,10 @@ var (
 	frequencySet bool
 	bandSet      bool
 	gridSet      bool
+	sourceSet    bool
+	rateSet      bool
+	contestSet   bool
+	stationsSet  bool
 )
 
 func init() {
@@ -71,6 +87,10 @@ func init() {
 	flag.StringVar(&frequency, "frequency", "14074000", "Frequency in Hz")
 	flag.StringVar(&band, "band", "20m", "Band designation")
 	flag.StringVar(&grid, "grid", "FN42", "Grid square")
+	flag.StringVar(&source, "source", "wsjtx", "Logger to simulate (wsjtx or n1mm)")
+	flag.IntVar(&rate, "rate", 120, "N1MM: QSOs per hour across all stations")
+	flag.StringVar(&contest, "contest", "CQ-WW-CW", "N1MM: contest to simulate ("+strings.Join(contestNames(), ", ")+")")
+	flag.StringVar(&stations, "stations", "RUN1,MULT1", "N1MM: comma-separated StationName[:operator] list")
 }
 
 // loadConfig loads configuration from a YAML file
@@ -98,6 +118,10 @@ func main() {
 	origFreq := frequency
 	origBand := band
 	origGrid := grid
+	origSource := source
+	origRate := rate
+	origContest := contest
+	origStations := stations
 
 	flag.Parse()
 
@@ -110,6 +134,10 @@ func main() {
 	frequencySet = frequency != origFreq
 	bandSet = band != origBand
 	gridSet = grid != origGrid
+	sourceSet = source != origSource
+	rateSet = rate != origRate
+	contestSet = contest != origContest
+	stationsSet = stations != origStations
 
 	// Load config file if specified
 	var cfg *Config
@@ -145,19 +173,55 @@ func main() {
 		if !gridSet && cfg.Radio.Grid != "" {
 			grid = cfg.Radio.Grid
 		}
+		if !sourceSet && cfg.Source != "" {
+			source = cfg.Source
+		}
+		if !rateSet && cfg.N1MM.Rate != 0 {
+			rate = cfg.N1MM.Rate
+		}
+		if !contestSet && cfg.N1MM.Contest != "" {
+			contest = cfg.N1MM.Contest
+		}
+	}
+
+	if source != "wsjtx" && source != "n1mm" {
+		log.Fatalf("Unknown source %q (use wsjtx or n1mm)", source)
+	}
+	var sim *n1mmSimulator
+	if source == "n1mm" {
+		var stationList []N1MMStation
+		if cfg != nil && !stationsSet {
+			stationList = cfg.N1MM.Stations
+		}
+		if len(stationList) == 0 {
+			stationList = parseStations(stations)
+		}
+		var err error
+		sim, err = newN1MMSimulator(contest, callsign, rate, stationList)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
 	}
 
-	fmt.Println("WSJT-X UDP Simulator")
+	if sim != nil {
+		fmt.Println("N1MM UDP Simulator")
+	} else {
+		fmt.Println("WSJT-X UDP Simulator")
+	}
 	fmt.Println("====================")
 	if configFile != "" {
 		fmt.Printf("Config File: %s\n", configFile)
 	}
 	fmt.Printf("Target: %s:%d\n", targetAddr, targetPort)
-	fmt.Printf("Mode: %s\n", mode)
 	fmt.Printf("Callsign: %s\n", callsign)
-	fmt.Printf("Grid: %s\n", grid)
-	fmt.Printf("Frequency: %s Hz (%s)\n", frequency, band)
-	fmt.Printf("Interval: %d seconds\n", interval)
+	if sim != nil {
+		sim.printSettings()
+	} else {
+		fmt.Printf("Mode: %s\n", mode)
+		fmt.Printf("Grid: %s\n", grid)
+		fmt.Printf("Frequency: %s Hz (%s)\n", frequency, band)
+		fmt.Printf("Interval: %d seconds\n", interval)
+	}
 	fmt.Println("====================")
 	fmt.Println("Press Ctrl+C to stop")
 	fmt.Println()
@@ -179,6 +243,11 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	if sim != nil {
+		sim.run(conn, sigChan)
+		return
+	}
+
 	// Create ticker for periodic messages
 	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()